@@ -0,0 +1,28 @@
+package replay
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewReplayCommand() *cobra.Command {
+	var debug bool
+
+	cmd := &cobra.Command{
+		Use:   "replay <trace>",
+		Short: "Re-run a recorded turn trace offline",
+		Long: `Re-run a turn recorded with agents.defaults.turn_trace against the current
+config and workspace. The model and tools are replaced by stubs that return
+the recorded responses, so nothing is sent to a provider and no tool runs.
+
+Exits with an error if the replay diverges from the recording.`,
+		Example: "picoclaw replay ~/.picoclaw/workspace/traces/20260101-120000.000-main-turn-1.trace.json",
+		Args:    cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return replayCmd(args[0], debug)
+		},
+	}
+
+	cmd.Flags().BoolVarP(&debug, "debug", "d", false, "Enable debug logging")
+
+	return cmd
+}
@@ -0,0 +1,27 @@
+package replay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewReplayCommand(t *testing.T) {
+	cmd := NewReplayCommand()
+
+	require.NotNil(t, cmd)
+
+	assert.Equal(t, "replay <trace>", cmd.Use)
+	assert.Equal(t, "Re-run a recorded turn trace offline", cmd.Short)
+
+	assert.False(t, cmd.HasSubCommands())
+
+	assert.Nil(t, cmd.Run)
+	assert.NotNil(t, cmd.RunE)
+
+	assert.NotNil(t, cmd.Flags().Lookup("debug"))
+
+	assert.Error(t, cmd.Args(cmd, nil))
+	assert.NoError(t, cmd.Args(cmd, []string{"trace.json"}))
+}
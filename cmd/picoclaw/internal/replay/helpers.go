@@ -0,0 +1,51 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/cmd/picoclaw/internal"
+	"github.com/sipeed/picoclaw/pkg/agent"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+func replayCmd(tracePath string, debug bool) error {
+	trace, err := agent.LoadTurnTrace(tracePath)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := internal.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	if debug {
+		logger.SetLevel(logger.DEBUG)
+	} else {
+		logger.SetLevel(logger.WARN)
+	}
+
+	fmt.Printf("%s Replaying turn %s (agent %s, session %s)\n",
+		internal.Logo, trace.TurnID, trace.AgentID, trace.SessionKey)
+	fmt.Printf("  Recorded: %d LLM calls, %d tool calls, status %s\n",
+		len(trace.LLMCalls), len(trace.ToolCalls), trace.Status)
+
+	result, err := agent.ReplayTurn(context.Background(), cfg, trace)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("  Replayed: %d LLM calls, %d tool calls, status %s\n",
+		result.LLMCalls, result.ToolCalls, result.Status)
+	fmt.Printf("\n%s\n\n", result.FinalContent)
+
+	if !result.Diverged() {
+		fmt.Println("✓ Replay matches the recorded turn")
+		return nil
+	}
+
+	fmt.Printf("✗ %d divergence(s):\n", len(result.Divergences))
+	for _, d := range result.Divergences {
+		fmt.Printf("  - %s\n", d)
+	}
+	return fmt.Errorf("replay diverged from %s", tracePath)
+}
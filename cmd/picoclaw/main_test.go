@@ -41,6 +41,7 @@ func TestNewPicoclawCommand(t *testing.T) {
 		"migrate",
 		"model",
 		"onboard",
+		"replay",
 		"skills",
 		"status",
 		"version",
@@ -0,0 +1,470 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	checkpointFileSuffix = ".checkpoint.json"
+
+	// TurnRecoveryRollback restores the session to its pre-turn state and
+	// tells the user the request was interrupted.
+	TurnRecoveryRollback = "rollback"
+	// TurnRecoveryResume repairs dangling tool calls and lets the agent
+	// continue the interrupted turn.
+	TurnRecoveryResume = "resume"
+
+	interruptedToolResult = "Tool execution was interrupted by a restart; the result is unknown. " +
+		"Check the current state before retrying."
+)
+
+// TurnCheckpoint is the durable snapshot of an in-flight turn. It is written
+// next to the session JSONL after every loop iteration and removed when the
+// turn ends, so a checkpoint that survives a restart marks an interrupted turn.
+type TurnCheckpoint struct {
+	TurnID      string    `json:"turn_id"`
+	AgentID     string    `json:"agent_id"`
+	SessionKey  string    `json:"session_key"`
+	Channel     string    `json:"channel,omitempty"`
+	ChatID      string    `json:"chat_id,omitempty"`
+	SenderID    string    `json:"sender_id,omitempty"`
+	UserMessage string    `json:"user_message,omitempty"`
+	Phase       TurnPhase `json:"phase"`
+	Iteration   int       `json:"iteration"`
+
+	// RestoreHistoryLen and RestoreSummary describe the session state to
+	// roll back to. They track the turn's restore point, so they are
+	// refreshed when compression rewrites history mid-turn.
+	RestoreHistoryLen int    `json:"restore_history_len"`
+	RestoreSummary    string `json:"restore_summary,omitempty"`
+
+	// PendingToolCalls are the tool calls of the current iteration and
+	// CompletedToolResults the results that finished before the snapshot.
+	// Resuming replays the finished results and only closes the rest.
+	PendingToolCalls     []providers.ToolCall `json:"pending_tool_calls,omitempty"`
+	CompletedToolResults []providers.Message  `json:"completed_tool_results,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// checkpointStore persists TurnCheckpoints as one JSON file per session.
+type checkpointStore struct {
+	dir string
+}
+
+func newCheckpointStore(dir string) *checkpointStore {
+	if dir == "" {
+		return nil
+	}
+	return &checkpointStore{dir: dir}
+}
+
+// sessionFileStem mirrors memory.sanitizeKey so per-session sidecar files
+// (checkpoints, plans) sit next to the session's .jsonl file.
+func sessionFileStem(sessionKey string) string {
+	s := strings.ReplaceAll(sessionKey, ":", "_")
+	s = strings.ReplaceAll(s, "/", "_")
+	s = strings.ReplaceAll(s, "\\", "_")
+	return s
+}
+
+func checkpointFileName(sessionKey string) string {
+	return sessionFileStem(sessionKey) + checkpointFileSuffix
+}
+
+func (s *checkpointStore) path(sessionKey string) string {
+	return filepath.Join(s.dir, checkpointFileName(sessionKey))
+}
+
+func (s *checkpointStore) Save(cp *TurnCheckpoint) error {
+	if s == nil || cp == nil {
+		return nil
+	}
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("checkpoint: encode: %w", err)
+	}
+	return fileutil.WriteFileAtomic(s.path(cp.SessionKey), data, 0o644)
+}
+
+func (s *checkpointStore) Remove(sessionKey string) error {
+	if s == nil {
+		return nil
+	}
+	err := os.Remove(s.path(sessionKey))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("checkpoint: remove: %w", err)
+	}
+	return nil
+}
+
+// List returns every checkpoint in the store, oldest first. Unreadable files
+// are logged and skipped so one corrupt file cannot block recovery.
+func (s *checkpointStore) List() ([]*TurnCheckpoint, error) {
+	if s == nil {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint: read dir: %w", err)
+	}
+
+	var checkpoints []*TurnCheckpoint
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), checkpointFileSuffix) {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		data, readErr := os.ReadFile(path)
+		if readErr != nil {
+			logger.WarnCF("agent", "Failed to read turn checkpoint",
+				map[string]any{"path": path, "error": readErr.Error()})
+			continue
+		}
+		var cp TurnCheckpoint
+		if decodeErr := json.Unmarshal(data, &cp); decodeErr != nil || cp.SessionKey == "" {
+			logger.WarnCF("agent", "Discarding corrupt turn checkpoint",
+				map[string]any{"path": path})
+			_ = os.Remove(path)
+			continue
+		}
+		checkpoints = append(checkpoints, &cp)
+	}
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].StartedAt.Before(checkpoints[j].StartedAt)
+	})
+	return checkpoints, nil
+}
+
+// checkpointEnabled reports whether this turn writes durable checkpoints.
+// Only root turns with persisted history are recoverable; sub-turns and
+// heartbeats run against ephemeral state.
+func (ts *turnState) checkpointEnabled() bool {
+	return ts.agent != nil && ts.agent.Checkpoints != nil && !ts.opts.NoHistory && ts.depth == 0
+}
+
+func (ts *turnState) setPendingToolCalls(calls []providers.ToolCall) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.pendingToolCalls = append([]providers.ToolCall(nil), calls...)
+	ts.completedToolResults = nil
+}
+
+func (ts *turnState) recordCompletedToolResult(msg providers.Message) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.completedToolResults = append(ts.completedToolResults, msg)
+}
+
+func (ts *turnState) buildCheckpoint() *TurnCheckpoint {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return &TurnCheckpoint{
+		TurnID:               ts.turnID,
+		AgentID:              ts.agentID,
+		SessionKey:           ts.sessionKey,
+		Channel:              ts.channel,
+		ChatID:               ts.chatID,
+		SenderID:             ts.opts.SenderID,
+		UserMessage:          ts.userMessage,
+		Phase:                ts.phase,
+		Iteration:            ts.iteration,
+		RestoreHistoryLen:    len(ts.restorePointHistory),
+		RestoreSummary:       ts.restorePointSummary,
+		PendingToolCalls:     cloneProviderToolCalls(ts.pendingToolCalls),
+		CompletedToolResults: cloneProviderMessages(ts.completedToolResults),
+		StartedAt:            ts.startedAt,
+		UpdatedAt:            time.Now(),
+	}
+}
+
+// saveTurnCheckpoint persists the current turn progress. Failures are logged
+// but never fail the turn: checkpoints are a recovery aid, not a requirement.
+func (al *AgentLoop) saveTurnCheckpoint(ts *turnState) {
+	if !ts.checkpointEnabled() {
+		return
+	}
+	if err := ts.agent.Checkpoints.Save(ts.buildCheckpoint()); err != nil {
+		logger.WarnCF("agent", "Failed to save turn checkpoint",
+			map[string]any{"turn_id": ts.turnID, "session_key": ts.sessionKey, "error": err.Error()})
+	}
+}
+
+func (al *AgentLoop) clearTurnCheckpoint(ts *turnState) {
+	if !ts.checkpointEnabled() {
+		return
+	}
+	if err := ts.agent.Checkpoints.Remove(ts.sessionKey); err != nil {
+		logger.WarnCF("agent", "Failed to remove turn checkpoint",
+			map[string]any{"turn_id": ts.turnID, "session_key": ts.sessionKey, "error": err.Error()})
+	}
+}
+
+// PendingCheckpoints returns the unfinished turn checkpoints of every agent.
+func (al *AgentLoop) PendingCheckpoints() []*TurnCheckpoint {
+	registry := al.GetRegistry()
+	var all []*TurnCheckpoint
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok || agent.Checkpoints == nil {
+			continue
+		}
+		checkpoints, err := agent.Checkpoints.List()
+		if err != nil {
+			logger.WarnCF("agent", "Failed to list turn checkpoints",
+				map[string]any{"agent_id": agentID, "error": err.Error()})
+			continue
+		}
+		all = append(all, checkpoints...)
+	}
+	return all
+}
+
+// scheduleInterruptedTurns queues the recovery of each checkpoint left behind
+// by a previous process as a task on its session, so a slow provider resuming
+// one session does not hold up the others or the start of the gateway.
+// Depending on agents.defaults.turn_recovery each session is either rolled
+// back to its pre-turn state or resumed from where it stopped.
+func (al *AgentLoop) scheduleInterruptedTurns(sched *turnScheduler) {
+	for _, cp := range al.PendingCheckpoints() {
+		sched.submitTask(cp.SessionKey, cp.Channel, priorityDirect, func(ctx context.Context) {
+			al.recoverInterruptedTurn(ctx, cp)
+		})
+	}
+}
+
+func (al *AgentLoop) recoverInterruptedTurn(ctx context.Context, cp *TurnCheckpoint) {
+	mode := al.GetConfig().Agents.Defaults.GetTurnRecovery()
+	var err error
+	if mode == TurnRecoveryResume {
+		err = al.ResumeCheckpoint(ctx, cp)
+	} else {
+		err = al.RollbackCheckpoint(ctx, cp)
+	}
+	if err != nil {
+		logger.WarnCF("agent", "Failed to recover interrupted turn",
+			map[string]any{
+				"turn_id":     cp.TurnID,
+				"session_key": cp.SessionKey,
+				"mode":        mode,
+				"error":       err.Error(),
+			})
+	}
+}
+
+// RollbackCheckpoint restores the session to the state it had before the
+// interrupted turn started and notifies the originating chat.
+func (al *AgentLoop) RollbackCheckpoint(ctx context.Context, cp *TurnCheckpoint) error {
+	agent, err := al.checkpointAgent(cp)
+	if err != nil {
+		return err
+	}
+
+	history := agent.Sessions.GetHistory(cp.SessionKey)
+	if cp.RestoreHistoryLen < len(history) {
+		history = history[:cp.RestoreHistoryLen]
+	}
+	agent.Sessions.SetHistory(cp.SessionKey, history)
+	agent.Sessions.SetSummary(cp.SessionKey, cp.RestoreSummary)
+	if err := agent.Sessions.Save(cp.SessionKey); err != nil {
+		return err
+	}
+	if err := agent.Checkpoints.Remove(cp.SessionKey); err != nil {
+		return err
+	}
+
+	logger.InfoCF("agent", "Rolled back interrupted turn",
+		map[string]any{"turn_id": cp.TurnID, "session_key": cp.SessionKey, "phase": cp.Phase})
+
+	notice := "Your previous request was interrupted by a restart and has been rolled back."
+	if cp.UserMessage != "" {
+		notice += fmt.Sprintf(" Please send it again if it is still needed:\n> %s", utils.Truncate(cp.UserMessage, 200))
+	}
+	al.notifyCheckpointOrigin(ctx, cp, notice)
+	return nil
+}
+
+// ResumeCheckpoint restores the tool results the interrupted turn finished,
+// closes the tool calls it left without a result and runs a continuation turn
+// so the agent can finish the job.
+func (al *AgentLoop) ResumeCheckpoint(ctx context.Context, cp *TurnCheckpoint) error {
+	agent, err := al.checkpointAgent(cp)
+	if err != nil {
+		return err
+	}
+
+	history := agent.Sessions.GetHistory(cp.SessionKey)
+	start := min(cp.RestoreHistoryLen, len(history))
+	repaired, replayed := replayToolResults(history, start, cp)
+	repaired, added := closeDanglingToolCalls(repaired, start)
+	if replayed+added > 0 {
+		agent.Sessions.SetHistory(cp.SessionKey, repaired)
+		if err := agent.Sessions.Save(cp.SessionKey); err != nil {
+			return err
+		}
+	}
+	if err := agent.Checkpoints.Remove(cp.SessionKey); err != nil {
+		return err
+	}
+
+	logger.InfoCF("agent", "Resuming interrupted turn",
+		map[string]any{
+			"turn_id":             cp.TurnID,
+			"session_key":         cp.SessionKey,
+			"phase":               cp.Phase,
+			"replayed_results":    replayed,
+			"interrupted_results": added,
+		})
+
+	al.notifyCheckpointOrigin(ctx, cp, "Resuming a request that was interrupted by a restart...")
+
+	// A turn that never reached the model still needs the user's message;
+	// otherwise the history already carries it.
+	userMessage := ""
+	if len(repaired) <= start {
+		userMessage = cp.UserMessage
+	}
+	_, err = al.runAgentLoop(ctx, agent, processOptions{
+		SessionKey:              cp.SessionKey,
+		Channel:                 cp.Channel,
+		ChatID:                  cp.ChatID,
+		SenderID:                cp.SenderID,
+		UserMessage:             userMessage,
+		DefaultResponse:         defaultResponse,
+		EnableSummary:           true,
+		SendResponse:            cp.Channel != "" && !constants.IsInternalChannel(cp.Channel),
+		SkipInitialSteeringPoll: true,
+	})
+	return err
+}
+
+func (al *AgentLoop) checkpointAgent(cp *TurnCheckpoint) (*AgentInstance, error) {
+	if cp == nil {
+		return nil, fmt.Errorf("checkpoint is nil")
+	}
+	agent, ok := al.GetRegistry().GetAgent(cp.AgentID)
+	if !ok || agent.Checkpoints == nil {
+		return nil, fmt.Errorf("no agent %q for checkpointed session %q", cp.AgentID, cp.SessionKey)
+	}
+	return agent, nil
+}
+
+func (al *AgentLoop) notifyCheckpointOrigin(ctx context.Context, cp *TurnCheckpoint, content string) {
+	al.notifyChat(ctx, cp.Channel, cp.ChatID, content)
+}
+
+// notifyChat posts a notice straight to a user-facing chat, outside of any
+// turn's response. Internal channels are skipped.
+func (al *AgentLoop) notifyChat(ctx context.Context, channel, chatID, content string) {
+	if al.bus == nil || channel == "" || chatID == "" || constants.IsInternalChannel(channel) {
+		return
+	}
+	pubCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := al.bus.PublishOutbound(pubCtx, bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: content,
+	}); err != nil {
+		logger.WarnCF("agent", "Failed to notify chat",
+			map[string]any{"channel": channel, "chat_id": chatID, "error": err.Error()})
+	}
+}
+
+// replayToolResults appends the checkpointed results of the interrupted
+// iteration that are missing from history, for example because the session
+// store only keeps them in memory until the turn ends. Results are only
+// replayed onto the assistant message that issued the checkpointed calls.
+func replayToolResults(history []providers.Message, start int, cp *TurnCheckpoint) ([]providers.Message, int) {
+	if len(cp.PendingToolCalls) == 0 || len(cp.CompletedToolResults) == 0 {
+		return history, 0
+	}
+	pending := make(map[string]bool, len(cp.PendingToolCalls))
+	for _, tc := range cp.PendingToolCalls {
+		pending[tc.ID] = true
+	}
+
+	last := -1
+	for i := len(history) - 1; i >= start; i-- {
+		if history[i].Role == "assistant" && len(history[i].ToolCalls) > 0 {
+			last = i
+			break
+		}
+	}
+	if last < 0 || !slices.ContainsFunc(history[last].ToolCalls, func(tc providers.ToolCall) bool {
+		return pending[tc.ID]
+	}) {
+		return history, 0
+	}
+
+	answered := make(map[string]bool)
+	for _, msg := range history[last+1:] {
+		if msg.Role == "tool" && msg.ToolCallID != "" {
+			answered[msg.ToolCallID] = true
+		}
+	}
+	replayed := 0
+	repaired := slices.Clone(history)
+	for _, msg := range cp.CompletedToolResults {
+		if !pending[msg.ToolCallID] || answered[msg.ToolCallID] {
+			continue
+		}
+		repaired = append(repaired, msg)
+		answered[msg.ToolCallID] = true
+		replayed++
+	}
+	return repaired, replayed
+}
+
+// closeDanglingToolCalls appends a synthetic tool result for every assistant
+// tool call at or after start that has no matching result. Providers reject
+// histories with unanswered tool calls, so this is required before resuming.
+func closeDanglingToolCalls(history []providers.Message, start int) ([]providers.Message, int) {
+	answered := make(map[string]bool)
+	for _, msg := range history[start:] {
+		if msg.Role == "tool" && msg.ToolCallID != "" {
+			answered[msg.ToolCallID] = true
+		}
+	}
+
+	repaired := append([]providers.Message(nil), history...)
+	added := 0
+	for i := len(history) - 1; i >= start; i-- {
+		msg := history[i]
+		if msg.Role != "assistant" || len(msg.ToolCalls) == 0 {
+			continue
+		}
+		for _, tc := range msg.ToolCalls {
+			if answered[tc.ID] {
+				continue
+			}
+			repaired = append(repaired, providers.Message{
+				Role:       "tool",
+				Content:    interruptedToolResult,
+				ToolCallID: tc.ID,
+			})
+			added++
+		}
+		break
+	}
+	return repaired, added
+}
@@ -0,0 +1,285 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// checkpointProbeTool records the checkpoint present on disk while it runs.
+type checkpointProbeTool struct {
+	store *checkpointStore
+	seen  []*TurnCheckpoint
+}
+
+func (t *checkpointProbeTool) Name() string        { return "checkpoint_probe" }
+func (t *checkpointProbeTool) Description() string { return "Probe checkpoint state" }
+func (t *checkpointProbeTool) Parameters() map[string]any {
+	return map[string]any{"type": "object", "properties": map[string]any{}}
+}
+
+func (t *checkpointProbeTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	checkpoints, _ := t.store.List()
+	t.seen = append(t.seen, checkpoints...)
+	return tools.SilentResult("probed")
+}
+
+type toolThenAnswerProvider struct {
+	calls int
+}
+
+func (p *toolThenAnswerProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	tools []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.calls++
+	if p.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{{
+				ID:        "call_probe",
+				Type:      "function",
+				Name:      "checkpoint_probe",
+				Arguments: map[string]any{},
+			}},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (p *toolThenAnswerProvider) GetDefaultModel() string { return "mock-model" }
+
+func newCheckpointTestLoop(t *testing.T, provider providers.LLMProvider) (*AgentLoop, *AgentInstance) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	agent := al.GetRegistry().GetDefaultAgent()
+	if agent == nil || agent.Checkpoints == nil {
+		t.Fatal("expected default agent with checkpoint store")
+	}
+	return al, agent
+}
+
+func TestRunTurn_WritesCheckpointDuringToolsAndClearsOnCompletion(t *testing.T) {
+	provider := &toolThenAnswerProvider{}
+	al, agent := newCheckpointTestLoop(t, provider)
+
+	const sessionKey = "agent:main:checkpoint"
+	probe := &checkpointProbeTool{store: agent.Checkpoints}
+	agent.Tools.Register(probe)
+
+	resp, err := al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:      sessionKey,
+		Channel:         "cli",
+		ChatID:          "direct",
+		UserMessage:     "probe please",
+		DefaultResponse: defaultResponse,
+	})
+	if err != nil {
+		t.Fatalf("runAgentLoop() error = %v", err)
+	}
+	if resp != "done" {
+		t.Fatalf("response = %q, want done", resp)
+	}
+
+	if len(probe.seen) != 1 {
+		t.Fatalf("probe saw %d checkpoints, want 1", len(probe.seen))
+	}
+	cp := probe.seen[0]
+	if cp.Phase != TurnPhaseTools {
+		t.Fatalf("checkpoint phase = %q, want %q", cp.Phase, TurnPhaseTools)
+	}
+	if len(cp.PendingToolCalls) != 1 || cp.PendingToolCalls[0].ID != "call_probe" {
+		t.Fatalf("pending tool calls = %+v, want call_probe", cp.PendingToolCalls)
+	}
+	if cp.UserMessage != "probe please" || cp.RestoreHistoryLen != 0 {
+		t.Fatalf("unexpected checkpoint contents: %+v", cp)
+	}
+
+	remaining, err := agent.Checkpoints.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(remaining) != 0 {
+		t.Fatalf("expected checkpoint to be removed after turn, found %d", len(remaining))
+	}
+}
+
+func interruptedToolTurn(agent *AgentInstance, sessionKey string) *TurnCheckpoint {
+	agent.Sessions.AddMessage(sessionKey, "user", "earlier question")
+	agent.Sessions.AddMessage(sessionKey, "assistant", "earlier answer")
+	agent.Sessions.AddMessage(sessionKey, "user", "run the build")
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{
+		Role: "assistant",
+		ToolCalls: []providers.ToolCall{
+			{ID: "call_a", Type: "function", Name: "exec", Function: &providers.FunctionCall{Name: "exec"}},
+			{ID: "call_b", Type: "function", Name: "exec", Function: &providers.FunctionCall{Name: "exec"}},
+		},
+	})
+	agent.Sessions.AddFullMessage(sessionKey, providers.Message{Role: "tool", Content: "ok", ToolCallID: "call_a"})
+
+	cp := &TurnCheckpoint{
+		TurnID:            "main-turn-1",
+		AgentID:           agent.ID,
+		SessionKey:        sessionKey,
+		Channel:           "telegram",
+		ChatID:            "42",
+		UserMessage:       "run the build",
+		Phase:             TurnPhaseTools,
+		Iteration:         1,
+		RestoreHistoryLen: 2,
+		StartedAt:         time.Now(),
+	}
+	return cp
+}
+
+func TestRollbackCheckpoint_RestoresPreTurnHistory(t *testing.T) {
+	al, agent := newCheckpointTestLoop(t, &mockProvider{})
+	const sessionKey = "agent:main:telegram:direct:42"
+
+	cp := interruptedToolTurn(agent, sessionKey)
+	if err := agent.Checkpoints.Save(cp); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := al.RollbackCheckpoint(context.Background(), cp); err != nil {
+		t.Fatalf("RollbackCheckpoint() error = %v", err)
+	}
+
+	history := agent.Sessions.GetHistory(sessionKey)
+	if len(history) != 2 || history[1].Content != "earlier answer" {
+		t.Fatalf("history after rollback = %+v, want the two pre-turn messages", history)
+	}
+	if _, err := os.Stat(agent.Checkpoints.path(sessionKey)); !os.IsNotExist(err) {
+		t.Fatalf("expected checkpoint file to be removed, stat err = %v", err)
+	}
+}
+
+func TestResumeCheckpoint_ClosesDanglingToolCallsAndContinues(t *testing.T) {
+	provider := &recordingProvider{}
+	al, agent := newCheckpointTestLoop(t, provider)
+	const sessionKey = "agent:main:telegram:direct:42"
+
+	cp := interruptedToolTurn(agent, sessionKey)
+	if err := agent.Checkpoints.Save(cp); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := al.ResumeCheckpoint(context.Background(), cp); err != nil {
+		t.Fatalf("ResumeCheckpoint() error = %v", err)
+	}
+
+	var interrupted *providers.Message
+	for i, msg := range provider.lastMessages {
+		if msg.Role == "tool" && msg.ToolCallID == "call_b" {
+			interrupted = &provider.lastMessages[i]
+		}
+	}
+	if interrupted == nil || interrupted.Content != interruptedToolResult {
+		t.Fatalf("expected synthetic result for call_b in resumed request, got %+v", provider.lastMessages)
+	}
+
+	history := agent.Sessions.GetHistory(sessionKey)
+	last := history[len(history)-1]
+	if last.Role != "assistant" || last.Content != "Mock response" {
+		t.Fatalf("last history message = %+v, want resumed assistant answer", last)
+	}
+	if pending := al.PendingCheckpoints(); len(pending) != 0 {
+		t.Fatalf("expected no pending checkpoints after resume, got %d", len(pending))
+	}
+}
+
+func TestResumeCheckpoint_ReplaysCompletedToolResults(t *testing.T) {
+	provider := &recordingProvider{}
+	al, agent := newCheckpointTestLoop(t, provider)
+	const sessionKey = "agent:main:telegram:direct:42"
+
+	cp := interruptedToolTurn(agent, sessionKey)
+	// The store lost call_a's result, but the checkpoint has it.
+	history := agent.Sessions.GetHistory(sessionKey)
+	agent.Sessions.SetHistory(sessionKey, history[:len(history)-1])
+	cp.PendingToolCalls = history[len(history)-2].ToolCalls
+	cp.CompletedToolResults = []providers.Message{{Role: "tool", Content: "ok", ToolCallID: "call_a"}}
+	if err := agent.Checkpoints.Save(cp); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if err := al.ResumeCheckpoint(context.Background(), cp); err != nil {
+		t.Fatalf("ResumeCheckpoint() error = %v", err)
+	}
+
+	results := make(map[string]string)
+	for _, msg := range provider.lastMessages {
+		if msg.Role == "tool" {
+			results[msg.ToolCallID] = msg.Content
+		}
+	}
+	if results["call_a"] != "ok" {
+		t.Fatalf("call_a result = %q, want the checkpointed result", results["call_a"])
+	}
+	if results["call_b"] != interruptedToolResult {
+		t.Fatalf("call_b result = %q, want the interrupted notice", results["call_b"])
+	}
+}
+
+func TestReplayToolResults_SkipsAnsweredAndForeignCalls(t *testing.T) {
+	history := []providers.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "a"}, {ID: "b"}}},
+		{Role: "tool", ToolCallID: "a", Content: "done"},
+	}
+	cp := &TurnCheckpoint{
+		PendingToolCalls: []providers.ToolCall{{ID: "a"}, {ID: "b"}},
+		CompletedToolResults: []providers.Message{
+			{Role: "tool", ToolCallID: "a", Content: "done"},
+			{Role: "tool", ToolCallID: "b", Content: "also done"},
+		},
+	}
+
+	repaired, replayed := replayToolResults(history, 0, cp)
+	if replayed != 1 || repaired[len(repaired)-1].Content != "also done" {
+		t.Fatalf("replayed = %d, last = %+v, want only b's result", replayed, repaired[len(repaired)-1])
+	}
+
+	cp.PendingToolCalls = []providers.ToolCall{{ID: "other"}}
+	if _, replayed := replayToolResults(history, 0, cp); replayed != 0 {
+		t.Fatalf("replayed %d results onto unrelated calls, want 0", replayed)
+	}
+}
+
+func TestCloseDanglingToolCalls_OnlyAddsMissingResults(t *testing.T) {
+	history := []providers.Message{
+		{Role: "user", Content: "hi"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "a"}, {ID: "b"}}},
+		{Role: "tool", ToolCallID: "a", Content: "done"},
+	}
+
+	repaired, added := closeDanglingToolCalls(history, 0)
+	if added != 1 {
+		t.Fatalf("added = %d, want 1", added)
+	}
+	if got := repaired[len(repaired)-1]; got.ToolCallID != "b" || got.Role != "tool" {
+		t.Fatalf("appended message = %+v, want tool result for b", got)
+	}
+
+	if _, added := closeDanglingToolCalls(repaired, 0); added != 0 {
+		t.Fatalf("second pass added %d results, want 0", added)
+	}
+}
@@ -0,0 +1,727 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+// Context compression strategies, selected per agent with
+// context_compression.
+const (
+	compressionSummarize        = "summarize"
+	compressionElideToolResults = "elide_tool_results"
+	compressionRollingSummary   = "rolling_summary"
+	compressionImportance       = "importance"
+)
+
+const compressionFileSuffix = ".compression.json"
+
+// CompressionRequest asks a ContextCompressor to shrink one session.
+type CompressionRequest struct {
+	Agent      *AgentInstance
+	SessionKey string
+	// Forced is set when the next LLM call does not fit the context window
+	// and space must be freed now. Otherwise the run follows a turn that
+	// crossed the summarization thresholds and happens in the background.
+	Forced bool
+}
+
+// CompressionResult describes what a compressor changed.
+type CompressionResult struct {
+	DroppedMessages    int // removed from history
+	RemainingMessages  int
+	SummarizedMessages int  // folded into the session summary
+	ElidedResults      int  // tool results replaced with re-fetchable stubs
+	OmittedOversized   bool // messages too large to summarize were skipped
+}
+
+// ContextCompressor is a strategy for keeping session history within the
+// context window. Compress rewrites the session's history and summary and
+// reports false when it left them unchanged.
+type ContextCompressor interface {
+	Name() string
+	Compress(ctx context.Context, req CompressionRequest) (CompressionResult, bool)
+}
+
+// newContextCompressor returns the named strategy. Unknown names fall back to
+// summarize, the original behavior.
+func newContextCompressor(al *AgentLoop, name string) ContextCompressor {
+	switch strings.TrimSpace(name) {
+	case "", compressionSummarize:
+		return &summarizeCompressor{al: al}
+	case compressionElideToolResults:
+		return &elisionCompressor{al: al}
+	case compressionRollingSummary:
+		return &rollingSummaryCompressor{al: al}
+	case compressionImportance:
+		return &importanceCompressor{al: al}
+	}
+	logger.WarnCF("agent", "Unknown context compression strategy; using summarize",
+		map[string]any{"strategy": name})
+	return &summarizeCompressor{al: al}
+}
+
+// compressContext runs the agent's compression strategy on the session and
+// reports the run, with token counts before and after, as a ContextCompress
+// event.
+func (al *AgentLoop) compressContext(
+	ctx context.Context,
+	agent *AgentInstance,
+	sessionKey string,
+	reason ContextCompressReason,
+	meta EventMeta,
+) (CompressionResult, bool) {
+	compressor := newContextCompressor(al, agent.ContextCompression)
+	before := al.sessionContextTokens(agent, sessionKey)
+	result, ok := compressor.Compress(ctx, CompressionRequest{
+		Agent:      agent,
+		SessionKey: sessionKey,
+		Forced:     reason != ContextCompressReasonThreshold,
+	})
+	if !ok {
+		return result, false
+	}
+	after := al.sessionContextTokens(agent, sessionKey)
+
+	logger.InfoCF("agent", "Context compressed", map[string]any{
+		"session_key":   sessionKey,
+		"strategy":      compressor.Name(),
+		"reason":        reason,
+		"tokens_before": before,
+		"tokens_after":  after,
+	})
+	al.emitEvent(EventKindContextCompress, meta, ContextCompressPayload{
+		Reason:            reason,
+		Strategy:          compressor.Name(),
+		DroppedMessages:   result.DroppedMessages,
+		RemainingMessages: result.RemainingMessages,
+		ElidedResults:     result.ElidedResults,
+		TokensBefore:      before,
+		TokensAfter:       after,
+	})
+	return result, true
+}
+
+// sessionContextTokens estimates what the session contributes to a request:
+// its history plus the summary injected into the system prompt.
+func (al *AgentLoop) sessionContextTokens(agent *AgentInstance, sessionKey string) int {
+	tokens := countTokens(agent.Tokenizer, agent.Sessions.GetHistory(sessionKey))
+	if summary := agent.Sessions.GetSummary(sessionKey); summary != "" {
+		tokens += countMessageTokens(agent.Tokenizer, providers.Message{Role: "system", Content: summary})
+	}
+	return tokens
+}
+
+// rewriteHistoryPrefix replaces snapshot, the history a compressor read, with
+// rewritten. Background runs overlap the session's next Turn, so messages
+// appended since the snapshot are kept after rewritten. It reports false and
+// changes nothing when the snapshot is no longer the start of the history,
+// for example after a reset or another compression.
+func rewriteHistoryPrefix(agent *AgentInstance, key string, snapshot, rewritten []providers.Message) bool {
+	current := agent.Sessions.GetHistory(key)
+	if len(current) < len(snapshot) || !reflect.DeepEqual(current[:len(snapshot)], snapshot) {
+		logger.InfoCF("agent", "Session history changed during compression; leaving it as is",
+			map[string]any{"session_key": key})
+		return false
+	}
+	history := append(append([]providers.Message(nil), rewritten...), current[len(snapshot):]...)
+	agent.Sessions.SetHistory(key, history)
+	return true
+}
+
+// summarizeThresholdTokens is the history size that triggers background
+// compression.
+func summarizeThresholdTokens(agent *AgentInstance) int {
+	return agent.ContextWindow * agent.SummarizeTokenPercent / 100
+}
+
+// summarizeCompressor is the default strategy: background runs summarize all
+// but the most recent messages, forced runs drop the oldest half of Turns.
+type summarizeCompressor struct {
+	al *AgentLoop
+}
+
+func (c *summarizeCompressor) Name() string {
+	return compressionSummarize
+}
+
+func (c *summarizeCompressor) Compress(ctx context.Context, req CompressionRequest) (CompressionResult, bool) {
+	if req.Forced {
+		return c.al.forceCompression(req.Agent, req.SessionKey)
+	}
+	return c.al.summarizeHistory(ctx, req.Agent, req.SessionKey)
+}
+
+// splitForForcedCompression divides history into the oldest ~50% of Turns,
+// which forced compression drops, and the rest, which it keeps. A Turn is
+// never split, except when the whole history is a single Turn: then only the
+// most recent user message is kept so the agent cannot get stuck in a
+// context-exceeded loop.
+func splitForForcedCompression(history []providers.Message) (dropped, kept []providers.Message) {
+	turns := parseTurnBoundaries(history)
+	var mid int
+	if len(turns) >= 2 {
+		mid = turns[len(turns)/2]
+	} else {
+		// Fewer than 2 Turns — fall back to message-level midpoint
+		// aligned to the nearest Turn boundary.
+		mid = findSafeBoundary(history, len(history)/2)
+	}
+	if mid > 0 {
+		return history[:mid], history[mid:]
+	}
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Role == "user" {
+			dropped = append(append(dropped, history[:i]...), history[i+1:]...)
+			return dropped, []providers.Message{history[i]}
+		}
+	}
+	return history, nil
+}
+
+// summarizableMessages returns the user and assistant messages worth passing
+// to the summarizer. Messages larger than half the context window are left
+// out and reported as omitted.
+func summarizableMessages(agent *AgentInstance, messages []providers.Message) ([]providers.Message, bool) {
+	maxMessageTokens := agent.ContextWindow / 2
+	valid := make([]providers.Message, 0, len(messages))
+	omitted := false
+	for _, m := range messages {
+		if m.Role != "user" && m.Role != "assistant" {
+			continue
+		}
+		tokens := len(m.Content) / 2
+		if !tokenizer.IsHeuristic(agent.Tokenizer) {
+			tokens = agent.Tokenizer.Count(m.Content)
+		}
+		if tokens > maxMessageTokens {
+			omitted = true
+			continue
+		}
+		valid = append(valid, m)
+	}
+	return valid, omitted
+}
+
+// compressionState is what the compression strategies keep per session next
+// to its history.
+type compressionState struct {
+	SessionKey string `json:"session_key"`
+	// Elided holds the original content of tool results replaced with stubs,
+	// keyed by tool call ID.
+	Elided map[string]string `json:"elided,omitempty"`
+	// Summaries are the rolling summary levels, oldest first.
+	Summaries []summaryBlock `json:"summaries,omitempty"`
+	UpdatedAt time.Time      `json:"updated_at"`
+}
+
+// summaryBlock summarizes a stretch of conversation. Level 0 blocks summarize
+// messages; a level n+1 block merges several level n blocks.
+type summaryBlock struct {
+	Level    int    `json:"level"`
+	Messages int    `json:"messages"`
+	Text     string `json:"text"`
+}
+
+// compressionStore persists compressionState as one JSON file per session.
+type compressionStore struct {
+	dir string
+}
+
+func newCompressionStore(dir string) *compressionStore {
+	if dir == "" {
+		return nil
+	}
+	return &compressionStore{dir: dir}
+}
+
+func (s *compressionStore) path(sessionKey string) string {
+	return filepath.Join(s.dir, sessionFileStem(sessionKey)+compressionFileSuffix)
+}
+
+// Load returns the session's state, empty when it has none.
+func (s *compressionStore) Load(sessionKey string) (*compressionState, error) {
+	state := &compressionState{SessionKey: sessionKey}
+	if s == nil {
+		return state, nil
+	}
+	data, err := os.ReadFile(s.path(sessionKey))
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("compression: read: %w", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("compression: decode: %w", err)
+	}
+	return state, nil
+}
+
+func (s *compressionStore) Save(state *compressionState) error {
+	if s == nil || state == nil {
+		return nil
+	}
+	state.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("compression: encode: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("compression: create dir: %w", err)
+	}
+	return fileutil.WriteFileAtomic(s.path(state.SessionKey), data, 0o644)
+}
+
+// Tool results shorter than this stay in history as they are.
+const elideMinChars = 1000
+
+// elisionCompressor keeps every tool call in history but replaces large tool
+// results with stubs. The originals are stored next to the session and the
+// model can read them again with recall_tool_result. When stubs alone do not
+// free enough space it falls back to the summarize strategy.
+type elisionCompressor struct {
+	al *AgentLoop
+}
+
+func (c *elisionCompressor) Name() string {
+	return compressionElideToolResults
+}
+
+func (c *elisionCompressor) Compress(ctx context.Context, req CompressionRequest) (CompressionResult, bool) {
+	agent, key := req.Agent, req.SessionKey
+	state, err := agent.CompressionState.Load(key)
+	if err != nil {
+		logger.WarnCF("agent", "Cannot load compression state; summarizing instead",
+			map[string]any{"session_key": key, "error": err.Error()})
+		return (&summarizeCompressor{al: c.al}).Compress(ctx, req)
+	}
+
+	// Results of the current Turn are left alone unless space must be freed
+	// and the older ones were not enough.
+	history := agent.Sessions.GetHistory(key)
+	snapshot := append([]providers.Message(nil), history...)
+	lastTurn := len(history)
+	if turns := parseTurnBoundaries(history); len(turns) > 0 {
+		lastTurn = turns[len(turns)-1]
+	}
+	target := summarizeThresholdTokens(agent)
+	if req.Forced {
+		target = agent.ContextWindow / 2
+	}
+	elided := elideToolResults(history, 0, lastTurn, state)
+	if req.Forced && countTokens(agent.Tokenizer, history) > target {
+		elided += elideToolResults(history, lastTurn, len(history), state)
+	}
+
+	var result CompressionResult
+	if elided > 0 {
+		pruneElided(state, history)
+		if err := agent.CompressionState.Save(state); err != nil {
+			logger.WarnCF("agent", "Cannot save elided tool results; keeping them in history",
+				map[string]any{"session_key": key, "error": err.Error()})
+			return (&summarizeCompressor{al: c.al}).Compress(ctx, req)
+		}
+		if !rewriteHistoryPrefix(agent, key, snapshot, history) {
+			return CompressionResult{}, false
+		}
+		agent.Sessions.Save(key)
+		result = CompressionResult{RemainingMessages: len(history), ElidedResults: elided}
+	}
+	// A forced run must free space even when the history looks small enough:
+	// the request did not fit.
+	if countTokens(agent.Tokenizer, history) <= target && (elided > 0 || !req.Forced) {
+		return result, elided > 0
+	}
+
+	fallback, ok := (&summarizeCompressor{al: c.al}).Compress(ctx, req)
+	if !ok {
+		return result, elided > 0
+	}
+	fallback.ElidedResults = elided
+	return fallback, true
+}
+
+// elideToolResults replaces large tool results in history[from:to] with stubs
+// and records the originals in state. It returns how many it replaced.
+func elideToolResults(history []providers.Message, from, to int, state *compressionState) int {
+	elided := 0
+	for i := from; i < to; i++ {
+		m := history[i]
+		if m.Role != "tool" || m.ToolCallID == "" || isElisionStub(m.Content) {
+			continue
+		}
+		chars := utf8.RuneCountInString(m.Content)
+		if chars < elideMinChars {
+			continue
+		}
+		if state.Elided == nil {
+			state.Elided = make(map[string]string)
+		}
+		state.Elided[m.ToolCallID] = m.Content
+		history[i].Content = elisionStub(m.ToolCallID, m.Content, chars)
+		elided++
+	}
+	return elided
+}
+
+const elisionStubPrefix = "[Tool result elided to save context: "
+
+func elisionStub(id, content string, chars int) string {
+	preview := strings.TrimSpace(content)
+	if line, _, found := strings.Cut(preview, "\n"); found {
+		preview = line
+	}
+	if runes := []rune(preview); len(runes) > 200 {
+		preview = string(runes[:200]) + "..."
+	}
+	return fmt.Sprintf(
+		"%s%d characters. Call recall_tool_result with id %q to read it again.]\nPreview: %s",
+		elisionStubPrefix, chars, id, preview,
+	)
+}
+
+func isElisionStub(content string) bool {
+	return strings.HasPrefix(content, elisionStubPrefix)
+}
+
+// pruneElided forgets originals whose stubs are no longer in history.
+func pruneElided(state *compressionState, history []providers.Message) {
+	live := make(map[string]bool)
+	for _, m := range history {
+		if m.Role == "tool" && isElisionStub(m.Content) {
+			live[m.ToolCallID] = true
+		}
+	}
+	for id := range state.Elided {
+		if !live[id] {
+			delete(state.Elided, id)
+		}
+	}
+}
+
+const (
+	// Messages a background rolling summary leaves in history.
+	rollingKeepMessages = 4
+	// Blocks of one level merged into a block of the next level.
+	rollingFanout = 4
+)
+
+// rollingSummaryCompressor summarizes the oldest stretch of history into a new
+// summary block instead of rewriting one ever-growing summary. Once
+// rollingFanout blocks of a level pile up they are merged into one block of
+// the next level, so recent history keeps more detail than old history.
+type rollingSummaryCompressor struct {
+	al *AgentLoop
+}
+
+func (c *rollingSummaryCompressor) Name() string {
+	return compressionRollingSummary
+}
+
+func (c *rollingSummaryCompressor) Compress(ctx context.Context, req CompressionRequest) (CompressionResult, bool) {
+	agent, key := req.Agent, req.SessionKey
+	history := agent.Sessions.GetHistory(key)
+
+	var dropped, kept []providers.Message
+	if req.Forced {
+		if len(history) <= 2 {
+			return CompressionResult{}, false
+		}
+		dropped, kept = splitForForcedCompression(history)
+	} else {
+		if len(history) <= rollingKeepMessages {
+			return CompressionResult{}, false
+		}
+		cut := findSafeBoundary(history, len(history)-rollingKeepMessages)
+		if cut <= 0 {
+			return CompressionResult{}, false
+		}
+		dropped, kept = history[:cut], history[cut:]
+	}
+
+	state, err := agent.CompressionState.Load(key)
+	if err != nil {
+		logger.WarnCF("agent", "Cannot load rolling summaries; starting over",
+			map[string]any{"session_key": key, "error": err.Error()})
+		state = &compressionState{SessionKey: key}
+	}
+	// The summary may have been cleared or rewritten since the last run, for
+	// example by a session reset. It wins over the stored blocks.
+	if summary := agent.Sessions.GetSummary(key); summary != renderSummaryBlocks(state.Summaries) {
+		state.Summaries = nil
+		if summary != "" {
+			state.Summaries = []summaryBlock{{Level: 1, Text: summary}}
+		}
+	}
+
+	valid, omitted := summarizableMessages(agent, dropped)
+	text := fmt.Sprintf("%d earlier messages were dropped without a summary.", len(dropped))
+	if len(valid) > 0 {
+		text, _ = c.al.summarizeBatch(ctx, agent, valid, "")
+	}
+	state.Summaries = append(state.Summaries, summaryBlock{Messages: len(dropped), Text: text})
+	state.Summaries = c.merge(ctx, agent, state.Summaries)
+
+	if !rewriteHistoryPrefix(agent, key, history, kept) {
+		return CompressionResult{}, false
+	}
+	if err := agent.CompressionState.Save(state); err != nil {
+		logger.WarnCF("agent", "Cannot save rolling summaries",
+			map[string]any{"session_key": key, "error": err.Error()})
+	}
+	agent.Sessions.SetSummary(key, renderSummaryBlocks(state.Summaries))
+	agent.Sessions.Save(key)
+	return CompressionResult{
+		DroppedMessages:    len(dropped),
+		RemainingMessages:  len(kept),
+		SummarizedMessages: len(valid),
+		OmittedOversized:   omitted,
+	}, true
+}
+
+// merge condenses blocks until no level holds rollingFanout of them. Levels
+// never increase from oldest to newest, so the blocks of a level are
+// contiguous and a merged block stays in chronological order. Only a merge
+// can fill the next level, so the first level with room ends the cascade.
+func (c *rollingSummaryCompressor) merge(
+	ctx context.Context,
+	agent *AgentInstance,
+	blocks []summaryBlock,
+) []summaryBlock {
+	for level := 0; ; level++ {
+		start, count := -1, 0
+		for i, b := range blocks {
+			if b.Level == level {
+				if start < 0 {
+					start = i
+				}
+				count++
+			}
+		}
+		if count < rollingFanout {
+			return blocks
+		}
+
+		group := blocks[start : start+rollingFanout]
+		merged := summaryBlock{Level: level + 1}
+		var prompt strings.Builder
+		prompt.WriteString("Merge these consecutive conversation summaries, oldest first, " +
+			"into one cohesive summary. Keep decisions, facts and open tasks; drop detail that no longer matters.\n")
+		texts := make([]string, 0, len(group))
+		for i, b := range group {
+			merged.Messages += b.Messages
+			texts = append(texts, b.Text)
+			fmt.Fprintf(&prompt, "\n%d: %s\n", i+1, b.Text)
+		}
+		if resp, err := c.al.retryLLMCall(ctx, agent, prompt.String(), 3); err == nil && resp.Content != "" {
+			merged.Text = strings.TrimSpace(resp.Content)
+		} else {
+			merged.Text = strings.Join(texts, " ")
+		}
+		rest := append([]summaryBlock{merged}, blocks[start+rollingFanout:]...)
+		blocks = append(blocks[:start:start], rest...)
+	}
+}
+
+// renderSummaryBlocks builds the session summary from the rolling blocks.
+func renderSummaryBlocks(blocks []summaryBlock) string {
+	if len(blocks) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("Summary of the earlier conversation, oldest part first:")
+	for _, b := range blocks {
+		label := "recent"
+		if b.Level > 0 {
+			label = "condensed"
+		}
+		if b.Messages > 0 {
+			fmt.Fprintf(&sb, "\n\n[%s, %d messages]\n%s", label, b.Messages, b.Text)
+		} else {
+			fmt.Fprintf(&sb, "\n\n[%s]\n%s", label, b.Text)
+		}
+	}
+	return sb.String()
+}
+
+// Turns at the end of history the importance strategy always keeps.
+const importanceKeepTurns = 2
+
+// importanceCompressor scores every older Turn and keeps the most important
+// ones that fit the budget, dropping the rest whole. It needs no LLM calls.
+type importanceCompressor struct {
+	al *AgentLoop
+}
+
+func (c *importanceCompressor) Name() string {
+	return compressionImportance
+}
+
+func (c *importanceCompressor) Compress(ctx context.Context, req CompressionRequest) (CompressionResult, bool) {
+	agent, key := req.Agent, req.SessionKey
+	history := agent.Sessions.GetHistory(key)
+
+	starts := parseTurnBoundaries(history)
+	if len(starts) <= importanceKeepTurns {
+		if req.Forced {
+			return c.al.forceCompression(agent, key)
+		}
+		return CompressionResult{}, false
+	}
+	// Anything before the first user message belongs to the first Turn.
+	starts[0] = 0
+	turns := make([][]providers.Message, len(starts))
+	for i, start := range starts {
+		end := len(history)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		turns[i] = history[start:end]
+	}
+
+	tokenBudget := summarizeThresholdTokens(agent) / 2
+	messageBudget := agent.SummarizeMessageThreshold / 2
+	if req.Forced {
+		tokenBudget = countTokens(agent.Tokenizer, history) / 2
+		messageBudget = len(history)
+	}
+
+	keep := make([]bool, len(turns))
+	tokens, messages := 0, 0
+	for i := len(turns) - importanceKeepTurns; i < len(turns); i++ {
+		keep[i] = true
+		tokens += countTokens(agent.Tokenizer, turns[i])
+		messages += len(turns[i])
+	}
+	older := make([]int, len(turns)-importanceKeepTurns)
+	for i := range older {
+		older[i] = i
+	}
+	sort.SliceStable(older, func(a, b int) bool {
+		return turnImportance(turns[older[a]], older[a], len(turns)) >
+			turnImportance(turns[older[b]], older[b], len(turns))
+	})
+	for _, i := range older {
+		t := countTokens(agent.Tokenizer, turns[i])
+		if tokens+t > tokenBudget || messages+len(turns[i]) > messageBudget {
+			continue
+		}
+		keep[i] = true
+		tokens += t
+		messages += len(turns[i])
+	}
+
+	var kept []providers.Message
+	var droppedRequests []string
+	for i, turn := range turns {
+		if keep[i] {
+			kept = append(kept, turn...)
+		} else if request := turnRequest(turn); request != "" {
+			droppedRequests = append(droppedRequests, request)
+		}
+	}
+	droppedCount := len(history) - len(kept)
+	if droppedCount == 0 {
+		if req.Forced {
+			return c.al.forceCompression(agent, key)
+		}
+		return CompressionResult{}, false
+	}
+
+	note := fmt.Sprintf("[Importance-based compression dropped %d lower-priority messages", droppedCount)
+	if len(droppedRequests) > 0 {
+		const maxListed = 10
+		if len(droppedRequests) > maxListed {
+			droppedRequests = droppedRequests[len(droppedRequests)-maxListed:]
+		}
+		note += ". Dropped requests included: " + strings.Join(droppedRequests, "; ")
+	}
+	note += "]"
+	if existing := agent.Sessions.GetSummary(key); existing != "" {
+		note = existing + "\n\n" + note
+	}
+	if !rewriteHistoryPrefix(agent, key, history, kept) {
+		return CompressionResult{}, false
+	}
+	agent.Sessions.SetSummary(key, note)
+	agent.Sessions.Save(key)
+
+	return CompressionResult{DroppedMessages: droppedCount, RemainingMessages: len(kept)}, true
+}
+
+// Words that mark a user message as an instruction or fact worth keeping.
+var importanceKeywords = []string{
+	"remember", "important", "always", "never", "must", "prefer", "don't", "do not", "my name",
+}
+
+// Tools whose calls change state the conversation may refer back to.
+var importanceSideEffectTools = map[string]bool{
+	"write_file":  true,
+	"edit_file":   true,
+	"append_file": true,
+	"exec":        true,
+	"cron":        true,
+	"spawn":       true,
+}
+
+// turnImportance scores the Turn at position out of total. Recent Turns score
+// higher; instructions and facts the user stated, and Turns that changed
+// something through tools, score higher still.
+func turnImportance(turn []providers.Message, position, total int) float64 {
+	score := float64(position+1) / float64(total)
+	for _, m := range turn {
+		switch m.Role {
+		case "user":
+			lower := strings.ToLower(m.Content)
+			for _, kw := range importanceKeywords {
+				if strings.Contains(lower, kw) {
+					score++
+					break
+				}
+			}
+		case "assistant":
+			for _, tc := range m.ToolCalls {
+				name := tc.Name
+				if name == "" && tc.Function != nil {
+					name = tc.Function.Name
+				}
+				if importanceSideEffectTools[name] {
+					score += 0.5
+					break
+				}
+			}
+		}
+	}
+	return score
+}
+
+// turnRequest returns a short quote of the user message that opened turn.
+func turnRequest(turn []providers.Message) string {
+	for _, m := range turn {
+		if m.Role != "user" {
+			continue
+		}
+		request := strings.Join(strings.Fields(m.Content), " ")
+		if runes := []rune(request); len(runes) > 80 {
+			request = string(runes[:80]) + "..."
+		}
+		if request != "" {
+			return fmt.Sprintf("%q", request)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,237 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func newCompressionTestLoop(t *testing.T, strategy string) (*AgentLoop, *AgentInstance) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:                 t.TempDir(),
+				ModelName:                 "test-model",
+				MaxTokens:                 4096,
+				MaxToolIterations:         10,
+				ContextWindow:             100000,
+				SummarizeMessageThreshold: 20,
+				SummarizeTokenPercent:     75,
+				ContextCompression:        strategy,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &simpleMockProvider{response: "summary text"})
+	t.Cleanup(al.Close)
+	return al, al.registry.GetDefaultAgent()
+}
+
+func toolTurn(request, callID, output string) []providers.Message {
+	return []providers.Message{
+		{Role: "user", Content: request},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: callID, Name: "read_file"}}},
+		{Role: "tool", ToolCallID: callID, Content: output},
+		{Role: "assistant", Content: "Done: " + request},
+	}
+}
+
+func TestElisionCompressor_StubsLargeToolResults(t *testing.T) {
+	al, agent := newCompressionTestLoop(t, compressionElideToolResults)
+	if _, ok := agent.Tools.Get("recall_tool_result"); !ok {
+		t.Fatal("recall_tool_result is not registered for elide_tool_results")
+	}
+	big := "line one\n" + strings.Repeat("x", 3000)
+	history := append(toolTurn("read a", "call-1", big), toolTurn("read b", "call-2", big)...)
+	agent.Sessions.SetHistory("s1", history)
+
+	sub := al.SubscribeEvents(16)
+	defer al.UnsubscribeEvents(sub.ID)
+	result, ok := al.compressContext(context.Background(), agent, "s1", ContextCompressReasonThreshold, EventMeta{})
+	if !ok || result.ElidedResults != 1 || result.DroppedMessages != 0 {
+		t.Fatalf("result = %+v, %v; want one elided result and nothing dropped", result, ok)
+	}
+
+	got := agent.Sessions.GetHistory("s1")
+	if len(got) != len(history) || !strings.Contains(got[2].Content, `recall_tool_result with id "call-1"`) ||
+		!strings.Contains(got[2].Content, "Preview: line one") {
+		t.Fatalf("old tool result = %q", got[2].Content)
+	}
+	if got[6].Content != big {
+		t.Fatal("the current turn's tool result was elided in a background run")
+	}
+
+	evt, ok := findEvent(collectEventStream(sub.C), EventKindContextCompress)
+	if !ok {
+		t.Fatal("expected context compress event")
+	}
+	payload := evt.Payload.(ContextCompressPayload)
+	if payload.Strategy != compressionElideToolResults || payload.ElidedResults != 1 ||
+		payload.TokensAfter >= payload.TokensBefore {
+		t.Fatalf("payload = %+v", payload)
+	}
+
+	ctx := withTurnState(context.Background(), &turnState{agent: agent, sessionKey: "s1"})
+	res := newRecallToolResultTool().Execute(ctx, map[string]any{"id": "call-1"})
+	if res.IsError || res.ForLLM != big {
+		t.Fatalf("recall = %+v", res)
+	}
+	if res := newRecallToolResultTool().Execute(ctx, map[string]any{"id": "call-9"}); !res.IsError {
+		t.Fatal("recalling an unknown id succeeded")
+	}
+}
+
+func TestRollingSummaryCompressor_MergesLevels(t *testing.T) {
+	al, agent := newCompressionTestLoop(t, compressionRollingSummary)
+
+	history := []providers.Message{
+		{Role: "user", Content: "hello"},
+		{Role: "assistant", Content: "hi"},
+		{Role: "user", Content: "ready?"},
+		{Role: "assistant", Content: "yes"},
+	}
+	for i := range rollingFanout {
+		history = append(history,
+			providers.Message{Role: "user", Content: "question " + string(rune('a'+i))},
+			providers.Message{Role: "assistant", Content: "answer"},
+			providers.Message{Role: "user", Content: "follow-up"},
+			providers.Message{Role: "assistant", Content: "answer"},
+		)
+		agent.Sessions.SetHistory("s1", history)
+		if _, ok := al.compressContext(
+			context.Background(), agent, "s1", ContextCompressReasonThreshold, EventMeta{},
+		); !ok {
+			t.Fatalf("run %d did not compress", i+1)
+		}
+		history = agent.Sessions.GetHistory("s1")
+		if len(history) != rollingKeepMessages {
+			t.Fatalf("run %d kept %d messages, want %d", i+1, len(history), rollingKeepMessages)
+		}
+	}
+
+	state, err := agent.CompressionState.Load("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Summaries) != 1 || state.Summaries[0].Level != 1 {
+		t.Fatalf("summaries = %+v, want the %d blocks merged into one", state.Summaries, rollingFanout)
+	}
+	if summary := agent.Sessions.GetSummary("s1"); summary != renderSummaryBlocks(state.Summaries) ||
+		!strings.Contains(summary, "[condensed, 16 messages]") {
+		t.Fatalf("summary = %q", summary)
+	}
+
+	// A cleared summary, e.g. after a session reset, starts the blocks over.
+	agent.Sessions.SetSummary("s1", "")
+	agent.Sessions.SetHistory("s1", append(history, history...))
+	al.compressContext(context.Background(), agent, "s1", ContextCompressReasonThreshold, EventMeta{})
+	if state, _ = agent.CompressionState.Load("s1"); len(state.Summaries) != 1 || state.Summaries[0].Level != 0 {
+		t.Fatalf("summaries after reset = %+v", state.Summaries)
+	}
+}
+
+func TestRollingSummaryCompressor_KeepsMessagesAppendedMeanwhile(t *testing.T) {
+	al, agent := newCompressionTestLoop(t, compressionRollingSummary)
+	var history []providers.Message
+	for range 3 {
+		history = append(history,
+			providers.Message{Role: "user", Content: "question"},
+			providers.Message{Role: "assistant", Content: "answer"},
+		)
+	}
+	agent.Sessions.SetHistory("s1", history)
+
+	// The next Turn appends while the background summary is being written.
+	appended := providers.Message{Role: "user", Content: "sent during compression"}
+	agent.Provider = &wrappingProvider{
+		inner: agent.Provider,
+		onChat: func([]providers.Message) {
+			agent.Sessions.AddFullMessage("s1", appended)
+		},
+	}
+	if _, ok := al.compressContext(
+		context.Background(), agent, "s1", ContextCompressReasonThreshold, EventMeta{},
+	); !ok {
+		t.Fatal("history was not compressed")
+	}
+
+	got := agent.Sessions.GetHistory("s1")
+	if len(got) != rollingKeepMessages+1 || got[len(got)-1].Content != appended.Content {
+		t.Fatalf("history = %+v, want the last %d messages and the appended one", got, rollingKeepMessages)
+	}
+	if agent.Sessions.GetSummary("s1") == "" {
+		t.Fatal("summary was not written")
+	}
+
+	// A history replaced meanwhile, e.g. by a reset, is left alone.
+	agent.Sessions.SetHistory("s1", history)
+	agent.Provider.(*wrappingProvider).onChat = func([]providers.Message) {
+		agent.Sessions.SetHistory("s1", nil)
+	}
+	if _, ok := al.compressContext(
+		context.Background(), agent, "s1", ContextCompressReasonThreshold, EventMeta{},
+	); ok {
+		t.Fatal("compression overwrote a history that was reset meanwhile")
+	}
+	if got := agent.Sessions.GetHistory("s1"); len(got) != 0 {
+		t.Fatalf("history after reset = %+v", got)
+	}
+}
+
+func TestImportanceCompressor_KeepsFlaggedTurns(t *testing.T) {
+	al, agent := newCompressionTestLoop(t, compressionImportance)
+	filler := strings.Repeat("lorem ipsum ", 50)
+	var history []providers.Message
+	for i := range 6 {
+		request := "chat " + string(rune('a'+i)) + " " + filler
+		if i == 1 {
+			request = "Remember that my name is Ada"
+		}
+		history = append(history,
+			providers.Message{Role: "user", Content: request},
+			providers.Message{Role: "assistant", Content: filler},
+		)
+	}
+	agent.Sessions.SetHistory("s1", history)
+
+	result, ok := al.compressContext(context.Background(), agent, "s1", ContextCompressReasonRetry, EventMeta{})
+	if !ok || result.DroppedMessages == 0 {
+		t.Fatalf("result = %+v, %v", result, ok)
+	}
+	kept := agent.Sessions.GetHistory("s1")
+	var requests []string
+	for _, m := range kept {
+		if m.Role == "user" {
+			requests = append(requests, strings.Fields(m.Content)[0]+" "+strings.Fields(m.Content)[1])
+		}
+	}
+	if got := strings.Join(requests, ","); got != "Remember that,chat e,chat f" {
+		t.Fatalf("kept turns = %s", got)
+	}
+	if summary := agent.Sessions.GetSummary("s1"); !strings.Contains(summary, "dropped 6 lower-priority messages") ||
+		!strings.Contains(summary, `"chat a lorem`) {
+		t.Fatalf("summary = %q", summary)
+	}
+}
+
+func TestSplitForForcedCompression(t *testing.T) {
+	single := []providers.Message{
+		{Role: "user", Content: "go"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "1"}}},
+		{Role: "tool", ToolCallID: "1", Content: "huge"},
+	}
+	dropped, kept := splitForForcedCompression(single)
+	if len(kept) != 1 || kept[0].Content != "go" || len(dropped) != 2 {
+		t.Fatalf("single turn: dropped %d, kept %+v", len(dropped), kept)
+	}
+
+	turns := append(toolTurn("a", "1", "x"), toolTurn("b", "2", "y")...)
+	dropped, kept = splitForForcedCompression(turns)
+	if len(dropped) != 4 || kept[0].Content != "b" {
+		t.Fatalf("two turns: dropped %d, kept %+v", len(dropped), kept)
+	}
+}
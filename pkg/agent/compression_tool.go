@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// recallToolResultTool returns a tool result the elide_tool_results strategy
+// replaced with a stub. It reads the session from the turn context, so one
+// instance serves every session of an agent.
+type recallToolResultTool struct{}
+
+func newRecallToolResultTool() *recallToolResultTool {
+	return &recallToolResultTool{}
+}
+
+func (t *recallToolResultTool) Name() string {
+	return "recall_tool_result"
+}
+
+func (t *recallToolResultTool) Description() string {
+	return "Read the full output of an earlier tool call that was elided from the conversation to save " +
+		"context. Pass the id quoted in the \"[Tool result elided ...]\" stub."
+}
+
+func (t *recallToolResultTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"id": map[string]any{
+				"type":        "string",
+				"description": "Tool call ID from the elided result's stub.",
+			},
+		},
+		"required": []string{"id"},
+	}
+}
+
+func (t *recallToolResultTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	ts := turnStateFromContext(ctx)
+	if ts == nil || ts.agent == nil || ts.agent.CompressionState == nil {
+		return tools.ErrorResult("recall_tool_result: no session is available in this context")
+	}
+	id, _ := args["id"].(string)
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return tools.ErrorResult("recall_tool_result: id is required")
+	}
+
+	state, err := ts.agent.CompressionState.Load(ts.sessionKey)
+	if err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+	content, ok := state.Elided[id]
+	if !ok {
+		return tools.ErrorResult(fmt.Sprintf("recall_tool_result: no elided result with id %q", id))
+	}
+	return tools.SilentResult(content)
+}
@@ -1,6 +1,7 @@
 package agent
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -24,9 +25,16 @@ type ContextBuilder struct {
 	workspace          string
 	skillsLoader       *skills.SkillsLoader
 	memory             *MemoryStore
+	memoryIndex        *MemoryIndex
+	memoryTopK         int // > 0 injects retrieved memory instead of the whole files
 	toolDiscoveryBM25  bool
 	toolDiscoveryRegex bool
 
+	// profileDir, when set, holds the bootstrap files of a workspace profile
+	// used in place of the workspace's own; skills narrows the skills summary.
+	profileDir string
+	skills     []string
+
 	// Cache for system prompt to avoid rebuilding on every call.
 	// This fixes issue #607: repeated reprocessing of the entire context.
 	// The cache auto-invalidates when workspace source files change (mtime check).
@@ -52,6 +60,48 @@ func (cb *ContextBuilder) WithToolDiscovery(useBM25, useRegex bool) *ContextBuil
 	return cb
 }
 
+// WithMemoryRetrieval makes the prompt carry the topK memory chunks most
+// relevant to the current message instead of all of MEMORY.md and the recent
+// daily notes.
+func (cb *ContextBuilder) WithMemoryRetrieval(index *MemoryIndex, topK int) *ContextBuilder {
+	if topK <= 0 {
+		topK = defaultMemoryTopK
+	}
+	cb.memoryIndex = index
+	cb.memoryTopK = topK
+	return cb
+}
+
+// MemoryStore returns the store behind the memory files of the workspace.
+func (cb *ContextBuilder) MemoryStore() *MemoryStore {
+	return cb.memory
+}
+
+// forProfile returns a builder sharing this one's workspace, memory and
+// skills but taking its bootstrap files from a profile directory and listing
+// only the given skills (all when empty). It keeps its own prompt cache.
+func (cb *ContextBuilder) forProfile(dir string, skills []string) *ContextBuilder {
+	return &ContextBuilder{
+		workspace:          cb.workspace,
+		skillsLoader:       cb.skillsLoader,
+		memory:             cb.memory,
+		memoryIndex:        cb.memoryIndex,
+		memoryTopK:         cb.memoryTopK,
+		toolDiscoveryBM25:  cb.toolDiscoveryBM25,
+		toolDiscoveryRegex: cb.toolDiscoveryRegex,
+		profileDir:         dir,
+		skills:             skills,
+	}
+}
+
+// definitionDir returns the directory the bootstrap files are read from.
+func (cb *ContextBuilder) definitionDir() string {
+	if cb.profileDir != "" {
+		return cb.profileDir
+	}
+	return cb.workspace
+}
+
 func getGlobalConfigDir() string {
 	if home := os.Getenv(config.EnvHome); home != "" {
 		return home
@@ -142,7 +192,7 @@ func (cb *ContextBuilder) BuildSystemPrompt() string {
 	}
 
 	// Skills - show summary, AI can read full content with read_file tool
-	skillsSummary := cb.skillsLoader.BuildSkillsSummary()
+	skillsSummary := cb.skillsLoader.BuildSkillsSummaryFor(cb.skills)
 	if skillsSummary != "" {
 		parts = append(parts, fmt.Sprintf(`# Skills
 
@@ -151,9 +201,12 @@ The following skills extend your capabilities. To use a skill, read its SKILL.md
 %s`, skillsSummary))
 	}
 
-	// Memory context
-	memoryContext := cb.memory.GetMemoryContext()
-	if memoryContext != "" {
+	// Memory context. With retrieval, relevant chunks are looked up once per
+	// turn and passed to BuildMessages so the cached prompt stays small and
+	// stable.
+	if cb.memoryIndex != nil {
+		parts = append(parts, memoryRetrievalNote)
+	} else if memoryContext := cb.memory.GetMemoryContext(); memoryContext != "" {
 		parts = append(parts, "# Memory\n\n"+memoryContext)
 	}
 
@@ -161,6 +214,30 @@ The following skills extend your capabilities. To use a skill, read its SKILL.md
 	return strings.Join(parts, "\n\n---\n\n")
 }
 
+const memoryRetrievalNote = `# Memory
+
+Long-term memory and daily notes are not loaded in full. Excerpts relevant to the current message are included below when there are any. Use the memory_search tool to look up anything else you may have saved, and memory_write to save facts worth remembering.`
+
+// RelevantMemory returns the memory chunks matching the current message,
+// formatted for the system prompt, or "" when retrieval is off or nothing
+// matches. The result is meant to be passed to BuildMessages.
+func (cb *ContextBuilder) RelevantMemory(ctx context.Context, currentMessage string) string {
+	if cb.memoryIndex == nil || strings.TrimSpace(currentMessage) == "" {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(ctx, memoryRetrievalTimeout)
+	defer cancel()
+	hits, err := cb.memoryIndex.Search(ctx, currentMessage, cb.memoryTopK)
+	if err != nil {
+		logger.WarnCF("agent", "Memory retrieval failed", map[string]any{"error": err.Error()})
+		return ""
+	}
+	if len(hits) == 0 {
+		return ""
+	}
+	return "## Relevant Memory\n\n" + formatMemoryHits(hits)
+}
+
 // BuildSystemPromptWithCache returns the cached system prompt if available
 // and source files haven't changed, otherwise builds and caches it.
 // Source file changes are detected via mtime checks (cheap stat calls).
@@ -224,7 +301,10 @@ func (cb *ContextBuilder) InvalidateCache() {
 // because they require both directory-level and recursive file-level checks.
 func (cb *ContextBuilder) sourcePaths() []string {
 	agentDefinition := cb.LoadAgentDefinition()
-	paths := agentDefinition.trackedPaths(cb.workspace)
+	paths := agentDefinition.trackedPaths(cb.definitionDir())
+	if cb.profileDir != "" {
+		paths = append(paths, filepath.Join(cb.workspace, "USER.md"))
+	}
 	paths = append(paths, filepath.Join(cb.workspace, "memory", "MEMORY.md"))
 	return uniquePaths(paths)
 }
@@ -453,7 +533,7 @@ func (cb *ContextBuilder) LoadBootstrapFiles() string {
 	}
 
 	if agentDefinition.Source != AgentDefinitionSourceAgent {
-		filePath := filepath.Join(cb.workspace, "IDENTITY.md")
+		filePath := filepath.Join(cb.definitionDir(), "IDENTITY.md")
 		if data, err := os.ReadFile(filePath); err == nil {
 			fmt.Fprintf(&sb, "## %s\n\n%s\n\n", "IDENTITY.md", data)
 		}
@@ -503,14 +583,27 @@ func (cb *ContextBuilder) buildDynamicContext(channel, chatID, senderID, senderD
 	return sb.String()
 }
 
+// BuildMessagesOptions holds the optional, per-request parts of the messages
+// BuildMessages assembles around the cached static system prompt.
+type BuildMessagesOptions struct {
+	Summary string // session summary from compression
+	Plan    string // rendered plan-mode task list
+	Memory  string // memory chunks retrieved for this turn
+	Media   []string
+
+	Channel           string
+	ChatID            string
+	SenderID          string
+	SenderDisplayName string
+}
+
 func (cb *ContextBuilder) BuildMessages(
 	history []providers.Message,
-	summary string,
 	currentMessage string,
-	media []string,
-	channel, chatID, senderID, senderDisplayName string,
+	opts BuildMessagesOptions,
 ) []providers.Message {
 	messages := []providers.Message{}
+	summary, plan, memory, media := opts.Summary, opts.Plan, opts.Memory, opts.Media
 
 	// The static part (identity, bootstrap, skills, memory) is cached locally to
 	// avoid repeated file I/O and string building on every call (fixes issue #607).
@@ -524,9 +617,10 @@ func (cb *ContextBuilder) BuildMessages(
 	staticPrompt := cb.BuildSystemPromptWithCache()
 
 	// Build short dynamic context (time, runtime, session) — changes per request
-	dynamicCtx := cb.buildDynamicContext(channel, chatID, senderID, senderDisplayName)
+	dynamicCtx := cb.buildDynamicContext(opts.Channel, opts.ChatID, opts.SenderID, opts.SenderDisplayName)
 
-	// Compose a single system message: static (cached) + dynamic + optional summary.
+	// Compose a single system message: static (cached) + dynamic + optional summary
+	// + optional plan.
 	// Keeping all system content in one message ensures every provider adapter can
 	// extract it correctly (Anthropic adapter -> top-level system param,
 	// Codex -> instructions field).
@@ -542,6 +636,11 @@ func (cb *ContextBuilder) BuildMessages(
 		{Type: "text", Text: dynamicCtx},
 	}
 
+	if memory != "" {
+		stringParts = append(stringParts, memory)
+		contentBlocks = append(contentBlocks, providers.ContentBlock{Type: "text", Text: memory})
+	}
+
 	if summary != "" {
 		summaryText := fmt.Sprintf(
 			"CONTEXT_SUMMARY: The following is an approximate summary of prior conversation "+
@@ -551,6 +650,13 @@ func (cb *ContextBuilder) BuildMessages(
 		contentBlocks = append(contentBlocks, providers.ContentBlock{Type: "text", Text: summaryText})
 	}
 
+	// The plan (plan mode) lives in the system prompt rather than in history,
+	// so summarization and forced compression never drop it.
+	if plan != "" {
+		stringParts = append(stringParts, plan)
+		contentBlocks = append(contentBlocks, providers.ContentBlock{Type: "text", Text: plan})
+	}
+
 	fullSystemPrompt := strings.Join(stringParts, "\n\n---\n\n")
 
 	// Log system prompt summary for debugging (debug mode only).
@@ -566,6 +672,7 @@ func (cb *ContextBuilder) BuildMessages(
 			"dynamic_chars": len(dynamicCtx),
 			"total_chars":   len(fullSystemPrompt),
 			"has_summary":   summary != "",
+			"has_plan":      plan != "",
 			"cached":        isCached,
 		})
 
@@ -10,6 +10,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 )
 
 // parseTurnBoundaries returns the starting index of each Turn in the history.
@@ -86,10 +87,44 @@ func findSafeBoundary(history []providers.Message, targetIndex int) int {
 	return 0
 }
 
+// Per-item overheads for role labels, JSON structure and separators, in
+// characters for the heuristic and in tokens for model tokenizers.
+const (
+	messageOverheadChars  = 12
+	messageOverheadTokens = 4
+	toolDefOverheadChars  = 20
+	toolDefOverheadTokens = 8
+)
+
+// mediaTokensPerItem is a fixed per-item estimate for media. Provider
+// adapters serialize media into multipart or image_url payloads whose actual
+// cost depends on resolution and provider-specific image tokenization.
+const mediaTokensPerItem = 256
+
 // estimateMessageTokens estimates the token count for a single message,
 // including Content, ReasoningContent, ToolCalls arguments, ToolCallID
 // metadata, and Media items. Uses a heuristic of 2.5 characters per token.
 func estimateMessageTokens(msg providers.Message) int {
+	return countMessageTokens(nil, msg)
+}
+
+// countMessageTokens counts the tokens of a single message with the model's
+// tokenizer, falling back to the 2.5 characters per token heuristic when tok
+// is nil or the heuristic itself.
+func countMessageTokens(tok tokenizer.Tokenizer, msg providers.Message) int {
+	if !tokenizer.IsHeuristic(tok) {
+		tokens := tok.Count(msg.Content) + tok.Count(msg.ReasoningContent) + tok.Count(msg.ToolCallID)
+		for _, tc := range msg.ToolCalls {
+			tokens += tok.Count(tc.ID)
+			if tc.Function != nil {
+				tokens += tok.Count(tc.Function.Name) + tok.Count(tc.Function.Arguments)
+			} else {
+				tokens += tok.Count(tc.Name)
+			}
+		}
+		return tokens + messageOverheadTokens + len(msg.Media)*mediaTokensPerItem
+	}
+
 	chars := utf8.RuneCountInString(msg.Content)
 
 	// ReasoningContent (extended thinking / chain-of-thought) can be
@@ -114,62 +149,74 @@ func estimateMessageTokens(msg providers.Message) int {
 		chars += len(msg.ToolCallID)
 	}
 
-	// Per-message overhead for role label, JSON structure, separators.
-	const messageOverhead = 12
-	chars += messageOverhead
+	chars += messageOverheadChars
 
 	tokens := chars * 2 / 5
 
-	// Media items (images, files) are serialized by provider adapters into
-	// multipart or image_url payloads. Add a fixed per-item token estimate
-	// directly (not through the chars heuristic) since actual cost depends
-	// on resolution and provider-specific image tokenization.
-	const mediaTokensPerItem = 256
+	// Media is added directly, not through the chars heuristic.
 	tokens += len(msg.Media) * mediaTokensPerItem
 
 	return tokens
 }
 
+// countTokens counts the tokens of a message list with the model's
+// tokenizer (see countMessageTokens).
+func countTokens(tok tokenizer.Tokenizer, messages []providers.Message) int {
+	total := 0
+	for _, m := range messages {
+		total += countMessageTokens(tok, m)
+	}
+	return total
+}
+
 // estimateToolDefsTokens estimates the total token cost of tool definitions
 // as they appear in the LLM request. Each tool's name, description, and
 // JSON schema parameters contribute to the context window budget.
 func estimateToolDefsTokens(defs []providers.ToolDefinition) int {
+	return countToolDefsTokens(nil, defs)
+}
+
+// countToolDefsTokens is estimateToolDefsTokens with the model's tokenizer.
+func countToolDefsTokens(tok tokenizer.Tokenizer, defs []providers.ToolDefinition) int {
 	if len(defs) == 0 {
 		return 0
 	}
 
-	totalChars := 0
+	heuristic := tokenizer.IsHeuristic(tok)
+	totalChars, totalTokens := 0, 0
 	for _, d := range defs {
-		totalChars += len(d.Function.Name) + len(d.Function.Description)
-
+		var params string
 		if d.Function.Parameters != nil {
 			if paramJSON, err := json.Marshal(d.Function.Parameters); err == nil {
-				totalChars += len(paramJSON)
+				params = string(paramJSON)
 			}
 		}
 
-		// Per-tool overhead: type field, JSON structure, separators.
-		totalChars += 20
+		if !heuristic {
+			totalTokens += tok.Count(d.Function.Name) + tok.Count(d.Function.Description) +
+				tok.Count(params) + toolDefOverheadTokens
+			continue
+		}
+		totalChars += len(d.Function.Name) + len(d.Function.Description) + len(params)
+		totalChars += toolDefOverheadChars
 	}
 
-	return totalChars * 2 / 5
+	return totalTokens + totalChars*2/5
 }
 
 // isOverContextBudget checks whether the assembled messages plus tool definitions
 // and output reserve would exceed the model's context window. This enables
 // proactive compression before calling the LLM, rather than reacting to 400 errors.
+// tok is the model's tokenizer; nil uses the heuristic.
 func isOverContextBudget(
+	tok tokenizer.Tokenizer,
 	contextWindow int,
 	messages []providers.Message,
 	toolDefs []providers.ToolDefinition,
 	maxTokens int,
 ) bool {
-	msgTokens := 0
-	for _, m := range messages {
-		msgTokens += estimateMessageTokens(m)
-	}
-
-	toolTokens := estimateToolDefsTokens(toolDefs)
+	msgTokens := countTokens(tok, messages)
+	toolTokens := countToolDefsTokens(tok, toolDefs)
 	total := msgTokens + toolTokens + maxTokens
 
 	return total > contextWindow
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 )
 
 // msgUser creates a user message.
@@ -676,9 +677,10 @@ func TestIsOverContextBudget(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := isOverContextBudget(tt.contextWindow, tt.messages, tt.toolDefs, tt.maxTokens)
+			got := isOverContextBudget(nil, tt.contextWindow, tt.messages, tt.toolDefs, tt.maxTokens)
 			if got != tt.want {
-				t.Errorf("isOverContextBudget() = %v, want %v", got, tt.want)
+				t.Errorf("isOverContextBudget(nil, %d, %d messages, %d tools, %d) = %v, want %v",
+					tt.contextWindow, len(tt.messages), len(tt.toolDefs), tt.maxTokens, got, tt.want)
 			}
 		})
 	}
@@ -815,12 +817,43 @@ func TestIsOverContextBudget_RealisticSession(t *testing.T) {
 	}
 
 	// With a large context window, should be within budget.
-	if isOverContextBudget(131072, messages, tools, 32768) {
+	if isOverContextBudget(nil, 131072, messages, tools, 32768) {
 		t.Error("realistic session should be within 131072 context window")
 	}
 
 	// With a tiny context window, should exceed budget.
-	if !isOverContextBudget(500, messages, tools, 32768) {
+	if !isOverContextBudget(nil, 500, messages, tools, 32768) {
 		t.Error("realistic session should exceed 500 context window")
 	}
 }
+
+func TestCountMessageTokens_UsesModelTokenizer(t *testing.T) {
+	tok, err := tokenizer.New(tokenizer.EncodingCL100k, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	english := msgUser(strings.Repeat("Please summarize the meeting notes from yesterday. ", 20))
+	chinese := msgUser(strings.Repeat("请总结一下昨天的会议记录。", 20))
+	if got, heuristic := countMessageTokens(tok, english), estimateMessageTokens(english); got >= heuristic {
+		t.Errorf("English: tokenizer %d >= heuristic %d", got, heuristic)
+	}
+	if got, heuristic := countMessageTokens(tok, chinese), estimateMessageTokens(chinese); got <= heuristic {
+		t.Errorf("Chinese: tokenizer %d <= heuristic %d", got, heuristic)
+	}
+
+	// The heuristic tokenizer keeps the character-based estimate.
+	if got, want := countMessageTokens(tokenizer.Heuristic, english), estimateMessageTokens(english); got != want {
+		t.Errorf("heuristic tokenizer = %d, want %d", got, want)
+	}
+
+	// Whether the history fits now depends on the model's tokenizer.
+	history := []providers.Message{chinese}
+	window := estimateMessageTokens(chinese) + 100
+	if isOverContextBudget(nil, window, history, nil, 50) {
+		t.Fatal("heuristic: history should fit")
+	}
+	if !isOverContextBudget(tok, window, history, nil, 50) {
+		t.Fatal("cl100k: CJK history should exceed the window")
+	}
+}
@@ -82,7 +82,11 @@ func TestSingleSystemMessage(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			msgs := cb.BuildMessages(tt.history, tt.summary, tt.message, nil, "test", "chat1", "", "")
+			msgs := cb.BuildMessages(tt.history, tt.message, BuildMessagesOptions{
+				Summary: tt.summary,
+				Channel: "test",
+				ChatID:  "chat1",
+			})
 
 			systemCount := 0
 			for _, m := range msgs {
@@ -168,7 +172,12 @@ func TestBuildMessages_CurrentSenderDynamicContext(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			msgs := cb.BuildMessages(nil, "", "hello", nil, "discord", "chat1", tt.senderID, tt.senderDisplayName)
+			msgs := cb.BuildMessages(nil, "hello", BuildMessagesOptions{
+				Channel:           "discord",
+				ChatID:            "chat1",
+				SenderID:          tt.senderID,
+				SenderDisplayName: tt.senderDisplayName,
+			})
 			sys := msgs[0].Content
 
 			if tt.wantSection {
@@ -638,7 +647,7 @@ func TestConcurrentBuildSystemPromptWithCache(t *testing.T) {
 				}
 
 				// Also exercise BuildMessages concurrently
-				msgs := cb.BuildMessages(nil, "", "hello", nil, "test", "chat", "", "")
+				msgs := cb.BuildMessages(nil, "hello", BuildMessagesOptions{Channel: "test", ChatID: "chat"})
 				if len(msgs) < 2 {
 					errs <- "BuildMessages returned fewer than 2 messages"
 					return
@@ -726,6 +735,10 @@ func BenchmarkBuildMessagesWithCache(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_ = cb.BuildMessages(history, "summary", "new message", nil, "cli", "test", "", "")
+		_ = cb.BuildMessages(history, "new message", BuildMessagesOptions{
+			Summary: "summary",
+			Channel: "cli",
+			ChatID:  "test",
+		})
 	}
 }
@@ -72,8 +72,15 @@ type AgentContextDefinition struct {
 // It prefers the new AGENT.md format and its paired SOUL.md file. When the
 // structured files are absent, it falls back to the legacy AGENTS.md layout so
 // the current runtime can transition incrementally.
+//
+// A profile's bootstrap files replace the workspace's, except that USER.md
+// falls back to the workspace's when the profile has none.
 func (cb *ContextBuilder) LoadAgentDefinition() AgentContextDefinition {
-	return loadAgentDefinition(cb.workspace)
+	definition := loadAgentDefinition(cb.definitionDir())
+	if definition.User == nil && cb.profileDir != "" {
+		definition.User = loadUserDefinition(cb.workspace)
+	}
+	return definition
 }
 
 func loadAgentDefinition(workspace string) AgentContextDefinition {
@@ -285,7 +285,7 @@ func TestAgentLoop_EmitsSteeringAndSkippedToolEvents(t *testing.T) {
 		t.Fatal("timeout waiting for tool_one to start")
 	}
 
-	if err := al.Steer(providers.Message{Role: "user", Content: "change course"}); err != nil {
+	if err := al.Steer(activeSessionKey(t, al), providers.Message{Role: "user", Content: "change course"}); err != nil {
 		t.Fatalf("Steer failed: %v", err)
 	}
 
@@ -430,6 +430,9 @@ func TestAgentLoop_EmitsContextCompressEventOnRetry(t *testing.T) {
 	if payload.DroppedMessages == 0 {
 		t.Fatal("expected dropped messages to be recorded")
 	}
+	if payload.Strategy != "summarize" || payload.TokensAfter >= payload.TokensBefore {
+		t.Fatalf("expected summarize strategy with fewer tokens after, got %+v", payload)
+	}
 }
 
 func TestAgentLoop_EmitsSessionSummarizeEvent(t *testing.T) {
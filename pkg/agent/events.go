@@ -21,7 +21,7 @@ const (
 	EventKindLLMResponse
 	// EventKindLLMRetry is emitted when an LLM request is retried.
 	EventKindLLMRetry
-	// EventKindContextCompress is emitted when session history is forcibly compressed.
+	// EventKindContextCompress is emitted when the context compressor shrinks session history.
 	EventKindContextCompress
 	// EventKindSessionSummarize is emitted when asynchronous summarization completes.
 	EventKindSessionSummarize
@@ -130,13 +130,23 @@ type TurnEndPayload struct {
 
 // LLMRequestPayload describes an outbound LLM request.
 type LLMRequestPayload struct {
-	Model         string
-	MessagesCount int
-	ToolsCount    int
-	MaxTokens     int
-	Temperature   float64
+	Model          string
+	MessagesCount  int
+	ToolsCount     int
+	MaxTokens      int
+	Temperature    float64
+	ThinkingLevel  string
+	ThinkingSource string  // ThinkingSourceModel, ThinkingSourceRouting or ThinkingSourceCommand
+	RoutingScore   float64 // complexity score of the turn's routing decision, 0 without routing
 }
 
+// Where the thinking level of an LLM request came from.
+const (
+	ThinkingSourceModel   = "model"   // model_list thinking_level
+	ThinkingSourceRouting = "routing" // routing tier for the message's score
+	ThinkingSourceCommand = "command" // /think override for the message
+)
+
 // LLMResponsePayload describes an inbound LLM response.
 type LLMResponsePayload struct {
 	ContentLen   int
@@ -159,7 +169,7 @@ type LLMRetryPayload struct {
 	Backoff    time.Duration
 }
 
-// ContextCompressReason identifies why emergency compression ran.
+// ContextCompressReason identifies why compression ran.
 type ContextCompressReason string
 
 const (
@@ -167,13 +177,21 @@ const (
 	ContextCompressReasonProactive ContextCompressReason = "proactive_budget"
 	// ContextCompressReasonRetry indicates compression during context-error retry handling.
 	ContextCompressReasonRetry ContextCompressReason = "llm_retry"
+	// ContextCompressReasonThreshold indicates background compression after a
+	// turn crossed the summarization thresholds.
+	ContextCompressReasonThreshold ContextCompressReason = "summarize_threshold"
 )
 
-// ContextCompressPayload describes a forced history compression.
+// ContextCompressPayload describes one run of the agent's context compressor.
+// Token counts are estimates of the session history plus its summary.
 type ContextCompressPayload struct {
 	Reason            ContextCompressReason
+	Strategy          string
 	DroppedMessages   int
 	RemainingMessages int
+	ElidedResults     int
+	TokensBefore      int
+	TokensAfter       int
 }
 
 // SessionSummarizePayload describes a completed async session summarization.
@@ -247,6 +265,7 @@ type SubTurnSpawnPayload struct {
 // SubTurnEndPayload describes the completion of a child turn.
 type SubTurnEndPayload struct {
 	AgentID string
+	Label   string
 	Status  string
 }
 
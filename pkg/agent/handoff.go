@@ -0,0 +1,150 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/routing"
+)
+
+// handoff binds a routed conversation to another agent until that agent
+// hands it back.
+type handoff struct {
+	Agent      string    `json:"agent"`       // agent answering the conversation
+	From       string    `json:"from"`        // agent that handed it over
+	SessionKey string    `json:"session_key"` // Agent's session for the conversation
+	Since      time.Time `json:"since"`
+}
+
+// handoffStore persists active handoffs keyed by the session key the router
+// assigns to the conversation, so a handoff survives restarts.
+type handoffStore struct {
+	mu     sync.Mutex
+	path   string
+	active map[string]handoff
+}
+
+func newHandoffStore(path string) *handoffStore {
+	s := &handoffStore{path: path, active: make(map[string]handoff)}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.WarnCF("agent", "Failed to read handoffs", map[string]any{"path": path, "error": err.Error()})
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.active); err != nil {
+		logger.WarnCF("agent", "Failed to decode handoffs", map[string]any{"path": path, "error": err.Error()})
+		s.active = make(map[string]handoff)
+	}
+	return s
+}
+
+// get returns the handoff of the conversation routed to routeKey.
+func (s *handoffStore) get(routeKey string) (handoff, bool) {
+	if s == nil {
+		return handoff{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h, ok := s.active[routeKey]
+	return h, ok
+}
+
+// conversation returns the routed key of the conversation that sessionKey
+// belongs to, and its handoff if one is active. A session that was never
+// handed over is its own routed key.
+func (s *handoffStore) conversation(sessionKey string) (string, handoff, bool) {
+	if s != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for routeKey, h := range s.active {
+			if h.SessionKey == sessionKey {
+				return routeKey, h, true
+			}
+		}
+	}
+	return sessionKey, handoff{}, false
+}
+
+func (s *handoffStore) set(routeKey string, h handoff) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.active[routeKey] = h
+	return s.save()
+}
+
+func (s *handoffStore) remove(routeKey string) error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.active[routeKey]; !ok {
+		return nil
+	}
+	delete(s.active, routeKey)
+	return s.save()
+}
+
+// save writes the store. The caller must hold s.mu.
+func (s *handoffStore) save() error {
+	data, err := json.MarshalIndent(s.active, "", "  ")
+	if err != nil {
+		return fmt.Errorf("handoff: encode: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("handoff: create dir: %w", err)
+	}
+	return fileutil.WriteFileAtomic(s.path, data, 0o644)
+}
+
+// handoffPath returns where the handoffs of a workspace are stored.
+func handoffPath(workspace string) string {
+	return filepath.Join(workspace, "state", "handoffs.json")
+}
+
+// handoffSessionKey returns the session key agentID uses for the
+// conversation routed to routeKey: the routed key with the agent swapped.
+func handoffSessionKey(routeKey, agentID string) string {
+	rest := routeKey
+	if parsed := routing.ParseAgentSessionKey(routeKey); parsed != nil {
+		rest = parsed.Rest
+	}
+	return fmt.Sprintf("agent:%s:%s", routing.NormalizeAgentID(agentID), rest)
+}
+
+// applyHandoff redirects a resolved route to the agent the conversation was
+// handed over to, if any. Handoffs to agents that no longer exist are
+// ignored.
+func (al *AgentLoop) applyHandoff(route routing.ResolvedRoute, agent *AgentInstance) (routing.ResolvedRoute, *AgentInstance) {
+	h, ok := al.handoffs.get(route.SessionKey)
+	if !ok {
+		return route, agent
+	}
+	target, ok := al.GetRegistry().GetAgent(h.Agent)
+	if !ok {
+		return route, agent
+	}
+	route.AgentID = target.ID
+	route.SessionKey = h.SessionKey
+	route.MatchedBy = "handoff"
+	return route, target
+}
+
+// agentDisplayName returns the agent's configured name, or its ID.
+func agentDisplayName(agent *AgentInstance) string {
+	if agent.Name != "" {
+		return agent.Name
+	}
+	return agent.ID
+}
@@ -0,0 +1,185 @@
+package agent
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// handoffProvider hands "refund" requests over to billing and "done"
+// messages back to main; anything else gets "answer". It records the system
+// prompt of every call.
+type handoffProvider struct {
+	mu      sync.Mutex
+	systems []string
+}
+
+func (p *handoffProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	p.systems = append(p.systems, messages[0].Content)
+	p.mu.Unlock()
+
+	last := messages[len(messages)-1]
+	handoffCall := func(agentID, summary string) *providers.LLMResponse {
+		return &providers.LLMResponse{ToolCalls: []providers.ToolCall{{
+			ID:        "call_handoff",
+			Type:      "function",
+			Name:      "handoff",
+			Arguments: map[string]any{"agent_id": agentID, "summary": summary, "reason": "billing question"},
+		}}}
+	}
+	switch {
+	case last.Role == "tool":
+		return &providers.LLMResponse{Content: "One moment."}, nil
+	case strings.Contains(last.Content, "refund"):
+		return handoffCall("billing", "User wants a refund for order 42."), nil
+	case strings.Contains(last.Content, "done"):
+		return handoffCall("main", "Refund for order 42 issued."), nil
+	}
+	return &providers.LLMResponse{Content: "answer"}, nil
+}
+
+func (p *handoffProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func (p *handoffProvider) lastSystem() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.systems[len(p.systems)-1]
+}
+
+func newHandoffTestLoop(t *testing.T, provider providers.LLMProvider) (*AgentLoop, *bus.MessageBus) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         filepath.Join(dir, "main"),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			List: []config.AgentConfig{
+				{
+					ID:        "main",
+					Default:   true,
+					Workspace: filepath.Join(dir, "main"),
+					Subagents: &config.SubagentsConfig{AllowAgents: []string{"billing"}},
+				},
+				{ID: "billing", Name: "Billing", Workspace: filepath.Join(dir, "billing")},
+				{ID: "sales", Workspace: filepath.Join(dir, "sales")},
+			},
+		},
+		Session: config.SessionConfig{DMScope: "per-peer"},
+		Tools:   config.ToolsConfig{Handoff: config.ToolConfig{Enabled: true}},
+	}
+	msgBus := bus.NewMessageBus()
+	al := NewAgentLoop(cfg, msgBus, provider)
+	t.Cleanup(al.Close)
+	return al, msgBus
+}
+
+func TestHandoff_RoutesConversationUntilHandedBack(t *testing.T) {
+	provider := &handoffProvider{}
+	al, msgBus := newHandoffTestLoop(t, provider)
+	send := func(content string) string {
+		t.Helper()
+		resp, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel:  "telegram",
+			SenderID: "u1",
+			ChatID:   "u1",
+			Content:  content,
+			Peer:     bus.Peer{Kind: "direct", ID: "u1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := send("I need a refund"); resp != "One moment." {
+		t.Fatalf("response = %q", resp)
+	}
+	select {
+	case out := <-msgBus.OutboundChan():
+		if out.ChatID != "u1" || out.Content != "main handed this conversation over to Billing (billing question)." {
+			t.Fatalf("announcement = %+v", out)
+		}
+	default:
+		t.Fatal("handoff was not announced in chat")
+	}
+
+	// Billing now answers, with the summary in its system prompt.
+	if resp := send("how long will it take?"); resp != "answer" {
+		t.Fatalf("response = %q", resp)
+	}
+	if !strings.Contains(provider.lastSystem(), "[Handoff from main] User wants a refund for order 42.") {
+		t.Fatalf("billing system prompt lacks the handoff summary:\n%s", provider.lastSystem())
+	}
+	billing, _ := al.GetRegistry().GetAgent("billing")
+	billingKey := "agent:billing:direct:u1"
+	if history := billing.Sessions.GetHistory(billingKey); len(history) != 2 ||
+		history[0].Content != "how long will it take?" {
+		t.Fatalf("billing history = %+v", history)
+	}
+
+	// The binding survives a restart.
+	main, _ := al.GetRegistry().GetAgent("main")
+	stored, ok := newHandoffStore(handoffPath(main.Workspace)).get("agent:main:direct:u1")
+	if !ok || stored.Agent != "billing" || stored.From != "main" || stored.SessionKey != billingKey {
+		t.Fatalf("stored handoff = %+v, %v", stored, ok)
+	}
+
+	// Billing may hand back to main even without its own allow_agents.
+	send("all done")
+	<-msgBus.OutboundChan()
+	if resp := send("hello again"); resp != "answer" {
+		t.Fatalf("response = %q", resp)
+	}
+	if !strings.Contains(provider.lastSystem(), "[Handoff from Billing] Refund for order 42 issued.") {
+		t.Fatalf("main system prompt lacks the hand-back summary:\n%s", provider.lastSystem())
+	}
+	history := main.Sessions.GetHistory("agent:main:direct:u1")
+	if last := history[len(history)-1]; last.Content != "answer" {
+		t.Fatalf("main history ends with %+v", last)
+	}
+	if _, ok := al.handoffs.get("agent:main:direct:u1"); ok {
+		t.Fatal("handoff still active after handing back")
+	}
+}
+
+func TestHandoffTool_RespectsAllowAgents(t *testing.T) {
+	al, _ := newHandoffTestLoop(t, &handoffProvider{})
+	main, _ := al.GetRegistry().GetAgent("main")
+	ts := &turnState{agent: main, sessionKey: "agent:main:direct:u1"}
+	ctx := WithAgentLoop(withTurnState(context.Background(), ts), al)
+	tool := newHandoffTool(handoffTargets(al.GetRegistry(), main.ID))
+
+	if !strings.Contains(tool.Description(), "Agents you can hand over to: billing.") {
+		t.Fatalf("description = %q", tool.Description())
+	}
+	res := tool.Execute(ctx, map[string]any{"agent_id": "sales", "summary": "x"})
+	if !res.IsError || !strings.Contains(res.ForLLM, "not in subagents.allow_agents") {
+		t.Fatalf("handoff to sales = %+v", res)
+	}
+	res = tool.Execute(ctx, map[string]any{"agent_id": "nobody", "summary": "x"})
+	if !res.IsError || !strings.Contains(res.ForLLM, "available: billing, main, sales") {
+		t.Fatalf("handoff to unknown agent = %+v", res)
+	}
+	if _, ok := al.handoffs.get("agent:main:direct:u1"); ok {
+		t.Fatal("refused handoff was recorded")
+	}
+}
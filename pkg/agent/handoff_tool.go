@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/routing"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// handoffTool moves the current conversation to another agent for good: the
+// router sends the chat's next messages to that agent until it hands the
+// conversation back. Unlike spawn, the calling agent does not wait for an
+// answer.
+type handoffTool struct {
+	targets []string // agents this agent may hand over to, for the description
+}
+
+func newHandoffTool(targets []string) *handoffTool {
+	return &handoffTool{targets: targets}
+}
+
+func (t *handoffTool) Name() string {
+	return "handoff"
+}
+
+func (t *handoffTool) Description() string {
+	desc := "Hand the current conversation over to another agent. The other agent answers every " +
+		"following message in this chat until it hands the conversation back. Pass a summary with " +
+		"everything it needs to continue; it does not see this conversation's history. " +
+		"You can always hand a conversation back to the agent that handed it to you."
+	if len(t.targets) > 0 {
+		desc += " Agents you can hand over to: " + strings.Join(t.targets, ", ") + "."
+	}
+	return desc
+}
+
+func (t *handoffTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"agent_id": map[string]any{
+				"type":        "string",
+				"description": "ID of the agent to hand the conversation over to.",
+			},
+			"summary": map[string]any{
+				"type":        "string",
+				"description": "Summary of the conversation so far: who the user is, what they want, what has been done and what is still open.",
+			},
+			"reason": map[string]any{
+				"type":        "string",
+				"description": "Optional short reason shown to the user, e.g. \"billing question\".",
+			},
+		},
+		"required": []string{"agent_id", "summary"},
+	}
+}
+
+func (t *handoffTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	ts := turnStateFromContext(ctx)
+	al := AgentLoopFromContext(ctx)
+	if ts == nil || ts.agent == nil || al == nil || ts.depth > 0 || ts.opts.NoHistory || ts.sessionKey == "" {
+		return tools.ErrorResult("handoff: only the agent answering a conversation can hand it over")
+	}
+	targetID, _ := args["agent_id"].(string)
+	summary, _ := args["summary"].(string)
+	reason, _ := args["reason"].(string)
+	summary = strings.TrimSpace(summary)
+	if summary == "" {
+		return tools.ErrorResult("handoff: summary is required")
+	}
+
+	registry := al.GetRegistry()
+	target, ok := registry.GetAgent(targetID)
+	if !ok {
+		return tools.ErrorResult(fmt.Sprintf("handoff: unknown agent %q (available: %s)",
+			targetID, strings.Join(slices.Sorted(slices.Values(registry.ListAgentIDs())), ", ")))
+	}
+	current := ts.agent
+	if target.ID == current.ID {
+		return tools.ErrorResult(fmt.Sprintf("handoff: %q already answers this conversation", target.ID))
+	}
+
+	routeKey, active, handedOver := al.handoffs.conversation(ts.sessionKey)
+	homeID := ""
+	if parsed := routing.ParseAgentSessionKey(routeKey); parsed != nil {
+		homeID = routing.NormalizeAgentID(parsed.AgentID)
+	}
+	handBack := target.ID == homeID || (handedOver && target.ID == active.From)
+	if !handBack && !registry.CanSpawnSubagent(current.ID, target.ID) {
+		return tools.ErrorResult(fmt.Sprintf(
+			"handoff: agent %q may not hand over to %q (not in subagents.allow_agents)", current.ID, target.ID))
+	}
+
+	targetKey := routeKey
+	if target.ID != homeID {
+		targetKey = handoffSessionKey(routeKey, target.ID)
+	}
+
+	// The summary reaches the target through its session summary, which is
+	// part of every system prompt it builds for the conversation.
+	note := fmt.Sprintf("[Handoff from %s] %s", agentDisplayName(current), summary)
+	if reason = strings.TrimSpace(reason); reason != "" {
+		note += "\nReason: " + reason
+	}
+	if existing := target.Sessions.GetSummary(targetKey); existing != "" {
+		note = existing + "\n\n" + note
+	}
+	target.Sessions.SetSummary(targetKey, note)
+	if err := target.Sessions.Save(targetKey); err != nil {
+		logger.WarnCF("agent", "Failed to save handoff summary",
+			map[string]any{"agent_id": target.ID, "session_key": targetKey, "error": err.Error()})
+	}
+
+	var err error
+	if target.ID == homeID {
+		err = al.handoffs.remove(routeKey)
+	} else {
+		err = al.handoffs.set(routeKey, handoff{
+			Agent:      target.ID,
+			From:       current.ID,
+			SessionKey: targetKey,
+			Since:      time.Now(),
+		})
+	}
+	if err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+
+	logger.InfoCF("agent", "Conversation handed over",
+		map[string]any{
+			"from":        current.ID,
+			"to":          target.ID,
+			"route_key":   routeKey,
+			"session_key": targetKey,
+		})
+
+	notice := fmt.Sprintf("%s handed this conversation over to %s.", agentDisplayName(current), agentDisplayName(target))
+	if reason != "" {
+		notice = fmt.Sprintf("%s handed this conversation over to %s (%s).",
+			agentDisplayName(current), agentDisplayName(target), reason)
+	}
+	al.notifyChat(ctx, ts.channel, ts.chatID, notice)
+
+	return tools.SilentResult(fmt.Sprintf(
+		"Handed the conversation over to %s; the user has been told. %s answers their next message. "+
+			"Stop working on the request and end your turn with at most one short sentence.",
+		target.ID, target.ID))
+}
+
+// handoffTargets lists the agents an agent may hand conversations over to.
+func handoffTargets(registry *AgentRegistry, agentID string) []string {
+	var targets []string
+	for _, id := range slices.Sorted(slices.Values(registry.ListAgentIDs())) {
+		if id != agentID && registry.CanSpawnSubagent(agentID, id) {
+			targets = append(targets, id)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,312 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/channels"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+// Tool approval policies understood by the built-in chat approver.
+const (
+	ToolApprovalAlways = "always"
+	ToolApprovalNever  = "never"
+	ToolApprovalAsk    = "ask"
+)
+
+const (
+	chatApprovalHookName       = "chat_approval"
+	defaultChatApprovalTimeout = 2 * time.Minute
+	// chatApprovalGrace keeps the HookManager deadline just past the
+	// approver's own, so an unanswered prompt is denied with a clear reason.
+	chatApprovalGrace      = 5 * time.Second
+	approvalSummaryMaxLen  = 200
+	approvalPromptQuestion = "approve? (yes/no)"
+)
+
+// approvalSummaryKeys are the argument names that best describe a call in a
+// one-line prompt, in order of preference.
+var approvalSummaryKeys = []string{"command", "path", "url", "query", "pattern"}
+
+// chatApprover is the built-in ToolApprover. For tools whose policy is "ask"
+// it posts a prompt to the originating chat, then blocks until the next reply
+// from the user whose message started the turn, the timeout (deny), or turn
+// cancellation. Other members of a group chat cannot answer it.
+//
+// It is owned by the AgentLoop rather than built by a BuiltinHookFactory,
+// because replies arrive on the inbound bus and must be routed back here.
+type chatApprover struct {
+	send func(ctx context.Context, channel, chatID, senderID, prompt string) error
+
+	mu            sync.Mutex
+	defaultPolicy string
+	policies      map[string]string
+	timeout       time.Duration
+	pending       map[string][]*pendingApproval
+}
+
+type pendingApproval struct {
+	senderID string
+	reply    chan string
+}
+
+func newChatApprover(send func(ctx context.Context, channel, chatID, senderID, prompt string) error) *chatApprover {
+	return &chatApprover{
+		send:          send,
+		defaultPolicy: ToolApprovalAlways,
+		timeout:       defaultChatApprovalTimeout,
+		pending:       make(map[string][]*pendingApproval),
+	}
+}
+
+func (a *chatApprover) configure(cfg config.ToolApprovalConfig) error {
+	defaultPolicy, err := normalizeToolApprovalPolicy(cfg.DefaultPolicy)
+	if err != nil {
+		return fmt.Errorf("default_policy: %w", err)
+	}
+
+	policies := make(map[string]string, len(cfg.Tools))
+	for tool, policy := range cfg.Tools {
+		normalized, err := normalizeToolApprovalPolicy(policy)
+		if err != nil {
+			return fmt.Errorf("tool %q: %w", tool, err)
+		}
+		policies[tool] = normalized
+	}
+
+	a.mu.Lock()
+	a.defaultPolicy = defaultPolicy
+	a.policies = policies
+	a.timeout = chatApprovalTimeout(cfg)
+	a.mu.Unlock()
+	return nil
+}
+
+func normalizeToolApprovalPolicy(policy string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(policy)) {
+	case "", ToolApprovalAlways:
+		return ToolApprovalAlways, nil
+	case ToolApprovalNever:
+		return ToolApprovalNever, nil
+	case ToolApprovalAsk:
+		return ToolApprovalAsk, nil
+	default:
+		return "", fmt.Errorf("unsupported approval policy %q", policy)
+	}
+}
+
+func chatApprovalTimeout(cfg config.ToolApprovalConfig) time.Duration {
+	if cfg.TimeoutSeconds <= 0 {
+		return defaultChatApprovalTimeout
+	}
+	return time.Duration(cfg.TimeoutSeconds) * time.Second
+}
+
+func (a *chatApprover) policyFor(tool string) (string, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if policy, ok := a.policies[tool]; ok {
+		return policy, a.timeout
+	}
+	return a.defaultPolicy, a.timeout
+}
+
+func (a *chatApprover) ApproveTool(ctx context.Context, req *ToolApprovalRequest) (ApprovalDecision, error) {
+	policy, timeout := a.policyFor(req.Tool)
+	switch policy {
+	case ToolApprovalAlways:
+		return ApprovalDecision{Approved: true}, nil
+	case ToolApprovalNever:
+		return ApprovalDecision{
+			Approved: false,
+			Reason:   fmt.Sprintf("tool %q is blocked by approval policy", req.Tool),
+		}, nil
+	}
+
+	if req.Channel == "" || req.ChatID == "" || constants.IsInternalChannel(req.Channel) {
+		return ApprovalDecision{
+			Approved: false,
+			Reason:   fmt.Sprintf("tool %q needs approval but there is no chat to ask", req.Tool),
+		}, nil
+	}
+	if req.SenderID == "" {
+		return ApprovalDecision{
+			Approved: false,
+			Reason:   fmt.Sprintf("tool %q needs approval but the turn has no user to ask", req.Tool),
+		}, nil
+	}
+
+	// Register before prompting so a fast reply cannot slip past.
+	key := approvalKey(req.Channel, req.ChatID)
+	pending := &pendingApproval{senderID: req.SenderID, reply: make(chan string, 1)}
+	a.enqueue(key, pending)
+	defer a.remove(key, pending)
+
+	if err := a.send(ctx, req.Channel, req.ChatID, req.SenderID, formatApprovalPrompt(req)); err != nil {
+		return ApprovalDecision{}, fmt.Errorf("send approval prompt: %w", err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case reply := <-pending.reply:
+		if isApprovalReply(reply) {
+			return ApprovalDecision{Approved: true}, nil
+		}
+		return ApprovalDecision{
+			Approved: false,
+			Reason:   fmt.Sprintf("user declined: %s", utils.Truncate(strings.TrimSpace(reply), 200)),
+		}, nil
+	case <-timer.C:
+		return ApprovalDecision{
+			Approved: false,
+			Reason:   fmt.Sprintf("no approval reply within %s", timeout),
+		}, nil
+	case <-ctx.Done():
+		return ApprovalDecision{
+			Approved: false,
+			Reason:   "approval canceled: " + ctx.Err().Error(),
+		}, nil
+	}
+}
+
+// resolveReply hands msg to the oldest approval its sender was asked for in
+// its chat. It reports false when nothing of that sender is waiting, so the
+// message is processed normally.
+func (a *chatApprover) resolveReply(msg bus.InboundMessage) bool {
+	if a == nil || msg.Channel == "" || msg.ChatID == "" || msg.SenderID == "" {
+		return false
+	}
+
+	key := approvalKey(msg.Channel, msg.ChatID)
+
+	a.mu.Lock()
+	var next *pendingApproval
+	for _, candidate := range a.pending[key] {
+		if candidate.senderID == msg.SenderID {
+			next = candidate
+			break
+		}
+	}
+	if next == nil {
+		a.mu.Unlock()
+		return false
+	}
+	a.removeLocked(key, next)
+	a.mu.Unlock()
+
+	next.reply <- msg.Content
+	logger.InfoCF("hooks", "Tool approval reply received", map[string]any{
+		"channel":   msg.Channel,
+		"chat_id":   msg.ChatID,
+		"sender_id": msg.SenderID,
+	})
+	return true
+}
+
+func (a *chatApprover) enqueue(key string, p *pendingApproval) {
+	a.mu.Lock()
+	a.pending[key] = append(a.pending[key], p)
+	a.mu.Unlock()
+}
+
+func (a *chatApprover) remove(key string, p *pendingApproval) {
+	a.mu.Lock()
+	a.removeLocked(key, p)
+	a.mu.Unlock()
+}
+
+func (a *chatApprover) removeLocked(key string, p *pendingApproval) {
+	queue := a.pending[key]
+	for i, candidate := range queue {
+		if candidate == p {
+			queue = append(queue[:i], queue[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(a.pending, key)
+		return
+	}
+	a.pending[key] = queue
+}
+
+func approvalKey(channel, chatID string) string {
+	return channel + "\x00" + chatID
+}
+
+func isApprovalReply(reply string) bool {
+	normalized := strings.ToLower(strings.Trim(strings.TrimSpace(reply), ".!"))
+	switch normalized {
+	case "yes", "y", "approve", "approved", "allow", "ok", "okay":
+		return true
+	default:
+		return false
+	}
+}
+
+// formatApprovalPrompt renders a one-line prompt such as
+// "exec `rm build/` — approve? (yes/no)".
+func formatApprovalPrompt(req *ToolApprovalRequest) string {
+	summary := approvalArgumentSummary(req.Arguments)
+	if summary == "" {
+		return fmt.Sprintf("%s — %s", req.Tool, approvalPromptQuestion)
+	}
+	return fmt.Sprintf("%s `%s` — %s", req.Tool, summary, approvalPromptQuestion)
+}
+
+func approvalArgumentSummary(args map[string]any) string {
+	if len(args) == 0 {
+		return ""
+	}
+	for _, key := range approvalSummaryKeys {
+		if value, ok := args[key].(string); ok && strings.TrimSpace(value) != "" {
+			return utils.Truncate(value, approvalSummaryMaxLen)
+		}
+	}
+	encoded, err := json.Marshal(args)
+	if err != nil {
+		return ""
+	}
+	return utils.Truncate(string(encoded), approvalSummaryMaxLen)
+}
+
+// sendApprovalPrompt posts prompt to the chat, using native buttons when the
+// channel supports them and falling back to a plain outbound message. Only
+// senderID may answer it.
+func (al *AgentLoop) sendApprovalPrompt(ctx context.Context, channel, chatID, senderID, prompt string) error {
+	if al.channelManager != nil {
+		if ch, ok := al.channelManager.GetChannel(channel); ok {
+			if prompter, ok := ch.(channels.ApprovalPromptCapable); ok {
+				err := prompter.SendApprovalPrompt(ctx, chatID, senderID, prompt)
+				if err == nil {
+					return nil
+				}
+				logger.WarnCF("hooks", "Approval buttons failed, falling back to text prompt", map[string]any{
+					"channel": channel,
+					"error":   err.Error(),
+				})
+			}
+		}
+	}
+
+	if al.bus == nil {
+		return fmt.Errorf("message bus is not available")
+	}
+	return al.bus.PublishOutbound(ctx, bus.OutboundMessage{
+		Channel: channel,
+		ChatID:  chatID,
+		Content: prompt,
+	})
+}
@@ -0,0 +1,254 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type capturedPrompt struct {
+	channel string
+	chatID  string
+	prompt  string
+}
+
+func newTestChatApprover(t *testing.T, cfg config.ToolApprovalConfig) (*chatApprover, chan capturedPrompt) {
+	t.Helper()
+
+	prompts := make(chan capturedPrompt, 4)
+	approver := newChatApprover(func(ctx context.Context, channel, chatID, senderID, prompt string) error {
+		prompts <- capturedPrompt{channel: channel, chatID: chatID, prompt: prompt}
+		return nil
+	})
+	if err := approver.configure(cfg); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+	return approver, prompts
+}
+
+func TestChatApprover_PoliciesWithoutPrompt(t *testing.T) {
+	approver, prompts := newTestChatApprover(t, config.ToolApprovalConfig{
+		Tools: map[string]string{"exec": "never"},
+	})
+
+	decision, err := approver.ApproveTool(context.Background(), &ToolApprovalRequest{
+		Tool:     "read_file",
+		Channel:  "telegram",
+		ChatID:   "42",
+		SenderID: "telegram:7",
+	})
+	if err != nil || !decision.Approved {
+		t.Fatalf("read_file decision = %+v, err = %v; want approved by default", decision, err)
+	}
+
+	decision, err = approver.ApproveTool(context.Background(), &ToolApprovalRequest{
+		Tool:     "exec",
+		Channel:  "telegram",
+		ChatID:   "42",
+		SenderID: "telegram:7",
+	})
+	if err != nil || decision.Approved {
+		t.Fatalf("exec decision = %+v, err = %v; want denied by policy", decision, err)
+	}
+
+	if len(prompts) != 0 {
+		t.Fatalf("expected no prompts, got %d", len(prompts))
+	}
+}
+
+func TestChatApprover_AskResolvesFromReply(t *testing.T) {
+	approver, prompts := newTestChatApprover(t, config.ToolApprovalConfig{
+		DefaultPolicy: "ask",
+	})
+
+	tests := []struct {
+		reply        string
+		wantApproved bool
+	}{
+		{reply: "Yes", wantApproved: true},
+		{reply: "no, use make clean", wantApproved: false},
+	}
+
+	for _, tt := range tests {
+		var (
+			wg       sync.WaitGroup
+			decision ApprovalDecision
+			err      error
+		)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			decision, err = approver.ApproveTool(context.Background(), &ToolApprovalRequest{
+				Tool:      "exec",
+				Arguments: map[string]any{"command": "rm build/"},
+				Channel:   "telegram",
+				ChatID:    "42",
+				SenderID:  "telegram:7",
+			})
+		}()
+
+		select {
+		case got := <-prompts:
+			if got.prompt != "exec `rm build/` — approve? (yes/no)" {
+				t.Fatalf("prompt = %q", got.prompt)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("timed out waiting for approval prompt")
+		}
+
+		if approver.resolveReply(bus.InboundMessage{
+			Channel: "telegram", ChatID: "other", SenderID: "telegram:7", Content: "yes",
+		}) {
+			t.Fatal("reply from another chat must not resolve the approval")
+		}
+		if approver.resolveReply(bus.InboundMessage{
+			Channel: "telegram", ChatID: "42", SenderID: "telegram:8", Content: "yes",
+		}) {
+			t.Fatal("reply from another group member must not resolve the approval")
+		}
+		if !approver.resolveReply(bus.InboundMessage{
+			Channel: "telegram", ChatID: "42", SenderID: "telegram:7", Content: tt.reply,
+		}) {
+			t.Fatalf("reply %q was not consumed", tt.reply)
+		}
+		wg.Wait()
+
+		if err != nil {
+			t.Fatalf("ApproveTool() error = %v", err)
+		}
+		if decision.Approved != tt.wantApproved {
+			t.Fatalf("reply %q: approved = %v, want %v", tt.reply, decision.Approved, tt.wantApproved)
+		}
+		if !tt.wantApproved && !strings.Contains(decision.Reason, tt.reply) {
+			t.Fatalf("deny reason %q should quote the reply", decision.Reason)
+		}
+	}
+
+	if approver.resolveReply(bus.InboundMessage{Channel: "telegram", ChatID: "42", SenderID: "telegram:7", Content: "yes"}) {
+		t.Fatal("expected no pending approvals once resolved")
+	}
+}
+
+func TestChatApprover_TimeoutDenies(t *testing.T) {
+	approver, _ := newTestChatApprover(t, config.ToolApprovalConfig{
+		Tools: map[string]string{"exec": "ask"},
+	})
+	approver.timeout = 20 * time.Millisecond
+
+	decision, err := approver.ApproveTool(context.Background(), &ToolApprovalRequest{
+		Tool:     "exec",
+		Channel:  "telegram",
+		ChatID:   "42",
+		SenderID: "telegram:7",
+	})
+	if err != nil {
+		t.Fatalf("ApproveTool() error = %v", err)
+	}
+	if decision.Approved || !strings.Contains(decision.Reason, "no approval reply") {
+		t.Fatalf("decision = %+v, want timeout denial", decision)
+	}
+}
+
+func TestChatApprover_InternalChannelDenies(t *testing.T) {
+	approver, prompts := newTestChatApprover(t, config.ToolApprovalConfig{DefaultPolicy: "ask"})
+
+	decision, err := approver.ApproveTool(context.Background(), &ToolApprovalRequest{
+		Tool:    "exec",
+		Channel: "cli",
+		ChatID:  "direct",
+	})
+	if err != nil || decision.Approved {
+		t.Fatalf("decision = %+v, err = %v; want denial without prompting", decision, err)
+	}
+	if len(prompts) != 0 {
+		t.Fatalf("expected no prompts, got %d", len(prompts))
+	}
+}
+
+func TestChatApprover_NoSenderDenies(t *testing.T) {
+	approver, prompts := newTestChatApprover(t, config.ToolApprovalConfig{DefaultPolicy: "ask"})
+
+	decision, err := approver.ApproveTool(context.Background(), &ToolApprovalRequest{
+		Tool:    "exec",
+		Channel: "telegram",
+		ChatID:  "42",
+	})
+	if err != nil || decision.Approved {
+		t.Fatalf("decision = %+v, err = %v; want denial without prompting", decision, err)
+	}
+	if len(prompts) != 0 {
+		t.Fatalf("expected no prompts, got %d", len(prompts))
+	}
+}
+
+func TestChatApprover_RejectsUnknownPolicy(t *testing.T) {
+	approver := newChatApprover(nil)
+	err := approver.configure(config.ToolApprovalConfig{Tools: map[string]string{"exec": "maybe"}})
+	if err == nil {
+		t.Fatal("expected error for unknown policy")
+	}
+}
+
+func TestAgentLoop_ChatApprovalPromptsOriginatingChat(t *testing.T) {
+	provider := &toolHookProvider{}
+	al, agent, cleanup := newHookTestLoop(t, provider)
+	defer cleanup()
+
+	al.RegisterTool(&echoTextTool{})
+	if err := al.approver.configure(config.ToolApprovalConfig{
+		Tools: map[string]string{"echo_text": "ask"},
+	}); err != nil {
+		t.Fatalf("configure() error = %v", err)
+	}
+	if err := al.MountHook(NamedHook(chatApprovalHookName, al.approver)); err != nil {
+		t.Fatalf("MountHook failed: %v", err)
+	}
+
+	go func() {
+		select {
+		case out := <-al.bus.OutboundChan():
+			if out.Channel == "telegram" && out.ChatID == "42" {
+				al.approver.resolveReply(bus.InboundMessage{
+					Channel: "telegram", ChatID: "42", SenderID: "telegram:7", Content: "yes",
+				})
+			}
+		case <-time.After(2 * time.Second):
+		}
+	}()
+
+	resp, err := al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:      "session-1",
+		Channel:         "telegram",
+		ChatID:          "42",
+		SenderID:        "telegram:7",
+		UserMessage:     "run tool",
+		DefaultResponse: defaultResponse,
+	})
+	if err != nil {
+		t.Fatalf("runAgentLoop failed: %v", err)
+	}
+	if resp != "original" {
+		t.Fatalf("expected approved tool result, got %q", resp)
+	}
+}
+
+func TestConfigureHookManager_ExtendsApprovalTimeoutForChatApproval(t *testing.T) {
+	hm := NewHookManager(nil)
+	defer hm.Close()
+
+	configureHookManagerFromConfig(hm, &config.Config{
+		Hooks: config.HooksConfig{
+			Defaults: config.HookDefaultsConfig{ApprovalTimeoutMS: 60000},
+			Approval: config.ToolApprovalConfig{Enabled: true, TimeoutSeconds: 300},
+		},
+	})
+
+	if want := 300*time.Second + chatApprovalGrace; hm.approvalTimeout != want {
+		t.Fatalf("approvalTimeout = %v, want %v", hm.approvalTimeout, want)
+	}
+}
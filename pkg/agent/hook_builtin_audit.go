@@ -0,0 +1,127 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type auditLogConfig struct {
+	// Path is the JSONL file to append to; "~" expands to the home directory.
+	Path string `json:"path"`
+	// Events limits logging to these event kinds (e.g. "tool_exec_end"); empty logs all.
+	Events []string `json:"events,omitempty"`
+}
+
+// auditLogRecord is one line of the audit log.
+type auditLogRecord struct {
+	Time         time.Time `json:"time"`
+	Kind         string    `json:"kind"`
+	AgentID      string    `json:"agent_id,omitempty"`
+	TurnID       string    `json:"turn_id,omitempty"`
+	ParentTurnID string    `json:"parent_turn_id,omitempty"`
+	SessionKey   string    `json:"session_key,omitempty"`
+	Iteration    int       `json:"iteration,omitempty"`
+	Source       string    `json:"source,omitempty"`
+	Payload      any       `json:"payload,omitempty"`
+}
+
+// auditLogger is an EventObserver that appends every agent event to a JSONL file.
+type auditLogger struct {
+	kinds map[string]struct{}
+
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func newAuditLogHook(ctx context.Context, spec config.BuiltinHookConfig) (any, error) {
+	var cfg auditLogConfig
+	if err := decodeBuiltinHookConfig(spec, &cfg); err != nil {
+		return nil, err
+	}
+	return newAuditLogger(cfg)
+}
+
+func newAuditLogger(cfg auditLogConfig) (*auditLogger, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	valid := validHookEventKinds()
+	var kinds map[string]struct{}
+	for _, kind := range cfg.Events {
+		if _, ok := valid[kind]; !ok {
+			return nil, fmt.Errorf("unsupported event %q", kind)
+		}
+		if kinds == nil {
+			kinds = make(map[string]struct{}, len(cfg.Events))
+		}
+		kinds[kind] = struct{}{}
+	}
+
+	path := expandHome(cfg.Path)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create audit log dir: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+
+	return &auditLogger{
+		kinds: kinds,
+		file:  file,
+		enc:   json.NewEncoder(file),
+	}, nil
+}
+
+func (a *auditLogger) OnEvent(ctx context.Context, evt Event) error {
+	kind := evt.Kind.String()
+	if a.kinds != nil {
+		if _, ok := a.kinds[kind]; !ok {
+			return nil
+		}
+	}
+
+	record := auditLogRecord{
+		Time:         evt.Time,
+		Kind:         kind,
+		AgentID:      evt.Meta.AgentID,
+		TurnID:       evt.Meta.TurnID,
+		ParentTurnID: evt.Meta.ParentTurnID,
+		SessionKey:   evt.Meta.SessionKey,
+		Iteration:    evt.Meta.Iteration,
+		Source:       evt.Meta.Source,
+		Payload:      evt.Payload,
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	if err := a.enc.Encode(record); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+	return nil
+}
+
+func (a *auditLogger) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+)
+
+const (
+	// tokenBudgetIdleTTL drops the counters of sessions and turns that have
+	// not called the model for this long.
+	tokenBudgetIdleTTL = 24 * time.Hour
+	// tokenBudgetSweepInterval is how often counters are swept at most.
+	tokenBudgetSweepInterval = 10 * time.Minute
+)
+
+type tokenBudgetConfig struct {
+	// MaxSessionTokens caps total tokens spent per session key.
+	MaxSessionTokens int `json:"max_session_tokens,omitempty"`
+	// MaxTurnTokens caps total tokens spent by a single turn.
+	MaxTurnTokens int `json:"max_turn_tokens,omitempty"`
+	// WindowMinutes resets a session's spend after this many minutes; 0 never resets.
+	WindowMinutes int `json:"window_minutes,omitempty"`
+}
+
+// tokenBudget aborts a turn before an LLM call that would push the session or
+// turn past its token budget. Spend is taken from provider usage when
+// reported, falling back to the agent's tokenizer, the same count the context
+// budget uses. Counters live in memory, reset on restart and are dropped once
+// their window expires or they sit idle for tokenBudgetIdleTTL.
+type tokenBudget struct {
+	passthroughLLM
+
+	maxSession int
+	maxTurn    int
+	window     time.Duration
+	now        func() time.Time
+
+	// tokenizerFor returns the tokenizer of an agent. Without it, or for an
+	// unknown agent, counts fall back to the heuristic estimate.
+	tokenizerFor func(agentID string) tokenizer.Tokenizer
+
+	mu        sync.Mutex
+	sessions  map[string]*tokenBudgetUsage
+	turns     map[string]*tokenBudgetUsage
+	lastSweep time.Time
+}
+
+type tokenBudgetUsage struct {
+	spent         int
+	pendingPrompt int
+	windowStart   time.Time
+	lastUsed      time.Time
+}
+
+// agentTokenizerUser is implemented by built-in hooks that count tokens the
+// way the agent does. The loop hands them a lookup when they are mounted.
+type agentTokenizerUser interface {
+	useAgentTokenizers(lookup func(agentID string) tokenizer.Tokenizer)
+}
+
+func (b *tokenBudget) useAgentTokenizers(lookup func(agentID string) tokenizer.Tokenizer) {
+	b.tokenizerFor = lookup
+}
+
+func (b *tokenBudget) tokenizer(agentID string) tokenizer.Tokenizer {
+	if b.tokenizerFor == nil || agentID == "" {
+		return nil
+	}
+	return b.tokenizerFor(agentID)
+}
+
+func newTokenBudgetHook(ctx context.Context, spec config.BuiltinHookConfig) (any, error) {
+	var cfg tokenBudgetConfig
+	if err := decodeBuiltinHookConfig(spec, &cfg); err != nil {
+		return nil, err
+	}
+	return newTokenBudget(cfg)
+}
+
+func newTokenBudget(cfg tokenBudgetConfig) (*tokenBudget, error) {
+	if cfg.MaxSessionTokens <= 0 && cfg.MaxTurnTokens <= 0 {
+		return nil, fmt.Errorf("max_session_tokens or max_turn_tokens is required")
+	}
+	return &tokenBudget{
+		maxSession: cfg.MaxSessionTokens,
+		maxTurn:    cfg.MaxTurnTokens,
+		window:     time.Duration(cfg.WindowMinutes) * time.Minute,
+		now:        time.Now,
+		sessions:   make(map[string]*tokenBudgetUsage),
+		turns:      make(map[string]*tokenBudgetUsage),
+	}, nil
+}
+
+func (b *tokenBudget) BeforeLLM(
+	ctx context.Context,
+	req *LLMHookRequest,
+) (*LLMHookRequest, HookDecision, error) {
+	if req == nil {
+		return req, HookDecision{Action: HookActionContinue}, nil
+	}
+
+	tok := b.tokenizer(req.Meta.AgentID)
+	prompt := countToolDefsTokens(tok, req.Tools) + countTokens(tok, req.Messages)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.sweepLocked(now)
+	session := b.usageLocked(b.sessions, req.Meta.SessionKey, now)
+	turn := b.usageLocked(b.turns, req.Meta.TurnID, now)
+
+	if b.maxSession > 0 && session != nil && session.spent+prompt >= b.maxSession {
+		return req, HookDecision{
+			Action: HookActionAbortTurn,
+			Reason: fmt.Sprintf("session token budget exhausted (%d used, next request ~%d, limit %d)",
+				session.spent, prompt, b.maxSession),
+		}, nil
+	}
+	if b.maxTurn > 0 && turn != nil && turn.spent+prompt >= b.maxTurn {
+		return req, HookDecision{
+			Action: HookActionAbortTurn,
+			Reason: fmt.Sprintf("turn token budget exhausted (%d used, next request ~%d, limit %d)",
+				turn.spent, prompt, b.maxTurn),
+		}, nil
+	}
+
+	if session != nil {
+		session.pendingPrompt = prompt
+	}
+	if turn != nil {
+		turn.pendingPrompt = prompt
+	}
+	return req, HookDecision{Action: HookActionContinue}, nil
+}
+
+func (b *tokenBudget) AfterLLM(
+	ctx context.Context,
+	resp *LLMHookResponse,
+) (*LLMHookResponse, HookDecision, error) {
+	if resp == nil || resp.Response == nil {
+		return resp, HookDecision{Action: HookActionContinue}, nil
+	}
+
+	tok := b.tokenizer(resp.Meta.AgentID)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	for _, usage := range []*tokenBudgetUsage{
+		b.usageLocked(b.sessions, resp.Meta.SessionKey, now),
+		b.usageLocked(b.turns, resp.Meta.TurnID, now),
+	} {
+		if usage == nil {
+			continue
+		}
+		usage.spent += spentTokens(tok, resp.Response, usage.pendingPrompt)
+		usage.pendingPrompt = 0
+	}
+	return resp, HookDecision{Action: HookActionContinue}, nil
+}
+
+// OnEvent drops per-turn counters once the turn ends.
+func (b *tokenBudget) OnEvent(ctx context.Context, evt Event) error {
+	if evt.Kind != EventKindTurnEnd || evt.Meta.TurnID == "" {
+		return nil
+	}
+	b.mu.Lock()
+	delete(b.turns, evt.Meta.TurnID)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *tokenBudget) usageLocked(m map[string]*tokenBudgetUsage, key string, now time.Time) *tokenBudgetUsage {
+	if key == "" {
+		return nil
+	}
+	usage, ok := m[key]
+	if !ok || b.expired(usage, now) {
+		usage = &tokenBudgetUsage{windowStart: now}
+		m[key] = usage
+	}
+	usage.lastUsed = now
+	return usage
+}
+
+func (b *tokenBudget) expired(usage *tokenBudgetUsage, now time.Time) bool {
+	return b.window > 0 && now.Sub(usage.windowStart) >= b.window
+}
+
+// sweepLocked drops counters whose window has expired or that have been
+// idle for tokenBudgetIdleTTL, so the maps do not grow with every session a
+// long-running gateway sees.
+func (b *tokenBudget) sweepLocked(now time.Time) {
+	if now.Sub(b.lastSweep) < tokenBudgetSweepInterval {
+		return
+	}
+	b.lastSweep = now
+	for _, m := range []map[string]*tokenBudgetUsage{b.sessions, b.turns} {
+		for key, usage := range m {
+			if b.expired(usage, now) || now.Sub(usage.lastUsed) >= tokenBudgetIdleTTL {
+				delete(m, key)
+			}
+		}
+	}
+}
+
+func spentTokens(tok tokenizer.Tokenizer, resp *providers.LLMResponse, countedPrompt int) int {
+	if resp.Usage != nil && resp.Usage.TotalTokens > 0 {
+		return resp.Usage.TotalTokens
+	}
+	return countedPrompt + countMessageTokens(tok, providers.Message{
+		Role:             "assistant",
+		Content:          resp.Content,
+		ReasoningContent: resp.ReasoningContent,
+		ToolCalls:        resp.ToolCalls,
+	})
+}
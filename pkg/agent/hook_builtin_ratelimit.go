@@ -0,0 +1,136 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type toolRateLimitConfig struct {
+	// Limits is keyed by tool name; "*" applies to tools without their own entry.
+	Limits map[string]toolRateLimit `json:"limits"`
+	// Scope is "session" (default) to count per session key, or "global".
+	Scope string `json:"scope,omitempty"`
+}
+
+type toolRateLimit struct {
+	MaxCalls      int `json:"max_calls"`
+	WindowSeconds int `json:"window_seconds"`
+}
+
+// toolRateLimiter denies tool calls that exceed a sliding-window call budget.
+type toolRateLimiter struct {
+	passthroughTool
+
+	limits    map[string]toolRateLimit
+	global    bool
+	now       func() time.Time
+	maxWindow time.Duration
+
+	mu        sync.Mutex
+	calls     map[string][]time.Time
+	lastSweep time.Time
+}
+
+func newToolRateLimitHook(ctx context.Context, spec config.BuiltinHookConfig) (any, error) {
+	var cfg toolRateLimitConfig
+	if err := decodeBuiltinHookConfig(spec, &cfg); err != nil {
+		return nil, err
+	}
+	return newToolRateLimiter(cfg)
+}
+
+func newToolRateLimiter(cfg toolRateLimitConfig) (*toolRateLimiter, error) {
+	if len(cfg.Limits) == 0 {
+		return nil, fmt.Errorf("limits is required")
+	}
+	var maxWindow time.Duration
+	for tool, limit := range cfg.Limits {
+		if limit.MaxCalls <= 0 || limit.WindowSeconds <= 0 {
+			return nil, fmt.Errorf("limit for %q needs positive max_calls and window_seconds", tool)
+		}
+		maxWindow = max(maxWindow, time.Duration(limit.WindowSeconds)*time.Second)
+	}
+
+	var global bool
+	switch cfg.Scope {
+	case "", "session":
+	case "global":
+		global = true
+	default:
+		return nil, fmt.Errorf("unsupported scope %q", cfg.Scope)
+	}
+
+	return &toolRateLimiter{
+		limits:    cfg.Limits,
+		global:    global,
+		now:       time.Now,
+		maxWindow: maxWindow,
+		calls:     make(map[string][]time.Time),
+	}, nil
+}
+
+func (l *toolRateLimiter) BeforeTool(
+	ctx context.Context,
+	call *ToolCallHookRequest,
+) (*ToolCallHookRequest, HookDecision, error) {
+	if call == nil {
+		return call, HookDecision{Action: HookActionContinue}, nil
+	}
+
+	limit, ok := l.limits[call.Tool]
+	if !ok {
+		limit, ok = l.limits["*"]
+	}
+	if !ok {
+		return call, HookDecision{Action: HookActionContinue}, nil
+	}
+
+	key := call.Tool
+	if !l.global {
+		key = call.Meta.SessionKey + "\x00" + call.Tool
+	}
+	window := time.Duration(limit.WindowSeconds) * time.Second
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweepLocked(now)
+	recent := l.calls[key]
+	kept := recent[:0]
+	for _, at := range recent {
+		if now.Sub(at) < window {
+			kept = append(kept, at)
+		}
+	}
+
+	if len(kept) >= limit.MaxCalls {
+		l.calls[key] = kept
+		return call, HookDecision{
+			Action: HookActionDenyTool,
+			Reason: fmt.Sprintf("rate limit for %q exceeded (%d calls per %s)", call.Tool, limit.MaxCalls, window),
+		}, nil
+	}
+
+	l.calls[key] = append(kept, now)
+	return call, HookDecision{Action: HookActionContinue}, nil
+}
+
+// sweepLocked drops the keys whose last call is older than the longest
+// window, at most once per window, so sessions that stop calling tools do not
+// keep an entry forever.
+func (l *toolRateLimiter) sweepLocked(now time.Time) {
+	if now.Sub(l.lastSweep) < l.maxWindow {
+		return
+	}
+	l.lastSweep = now
+	for key, calls := range l.calls {
+		if len(calls) == 0 || now.Sub(calls[len(calls)-1]) >= l.maxWindow {
+			delete(l.calls, key)
+		}
+	}
+}
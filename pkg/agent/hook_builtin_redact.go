@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+type secretRedactorConfig struct {
+	// Rules selects built-in rules by name; empty enables all of them.
+	Rules []string `json:"rules,omitempty"`
+	// Patterns adds custom rules as name -> regular expression.
+	Patterns map[string]string `json:"patterns,omitempty"`
+	// Replacement overrides the default "[REDACTED:<rule>]" marker.
+	Replacement string `json:"replacement,omitempty"`
+	// Stages limits redaction to "after_llm" and/or "after_tool"; empty means both.
+	Stages []string `json:"stages,omitempty"`
+}
+
+type redactionRule struct {
+	name  string
+	re    *regexp.Regexp
+	valid func(match string) bool
+}
+
+// builtinRedactionRules are ordered so that broader secrets (key blocks,
+// tokens) are replaced before narrower PII patterns can match inside them.
+var builtinRedactionRules = []redactionRule{
+	{
+		name: "private_key",
+		re:   regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`),
+	},
+	{
+		name: "jwt",
+		re:   regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}`),
+	},
+	{
+		name: "aws_access_key",
+		re:   regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	},
+	{
+		name: "api_key",
+		re: regexp.MustCompile(`\b(?:sk-(?:ant-|proj-)?[A-Za-z0-9_-]{20,}|ghp_[A-Za-z0-9]{36}|` +
+			`github_pat_[A-Za-z0-9_]{22,}|xox[abprs]-[A-Za-z0-9-]{10,}|AIza[0-9A-Za-z_-]{35}|glpat-[A-Za-z0-9_-]{20,})`),
+	},
+	{
+		name: "bearer_token",
+		re:   regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9._~+/-]{20,}=*`),
+	},
+	{
+		name: "email",
+		re:   regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`),
+	},
+	{
+		name:  "credit_card",
+		re:    regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+		valid: luhnValid,
+	},
+	{
+		name: "phone",
+		re:   regexp.MustCompile(`\+\d{1,3}[ .-]?\(?\d{1,4}\)?(?:[ .-]?\d{2,4}){2,4}\b`),
+	},
+}
+
+// secretRedactor scrubs secrets and PII from LLM output and tool results
+// before they reach the session history, the chat, or later LLM calls.
+type secretRedactor struct {
+	passthroughLLM
+	passthroughTool
+
+	rules       []redactionRule
+	replacement string
+	llm         bool
+	tool        bool
+}
+
+func newSecretRedactorHook(ctx context.Context, spec config.BuiltinHookConfig) (any, error) {
+	var cfg secretRedactorConfig
+	if err := decodeBuiltinHookConfig(spec, &cfg); err != nil {
+		return nil, err
+	}
+	return newSecretRedactor(cfg)
+}
+
+func newSecretRedactor(cfg secretRedactorConfig) (*secretRedactor, error) {
+	r := &secretRedactor{replacement: cfg.Replacement}
+
+	if len(cfg.Rules) == 0 {
+		r.rules = append(r.rules, builtinRedactionRules...)
+	} else {
+		for _, name := range cfg.Rules {
+			rule, ok := lookupRedactionRule(name)
+			if !ok {
+				return nil, fmt.Errorf("unknown redaction rule %q", name)
+			}
+			r.rules = append(r.rules, rule)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(cfg.Patterns)) {
+		re, err := regexp.Compile(cfg.Patterns[name])
+		if err != nil {
+			return nil, fmt.Errorf("compile pattern %q: %w", name, err)
+		}
+		r.rules = append(r.rules, redactionRule{name: name, re: re})
+	}
+
+	if len(cfg.Stages) == 0 {
+		r.llm, r.tool = true, true
+	}
+	for _, stage := range cfg.Stages {
+		switch stage {
+		case "after_llm":
+			r.llm = true
+		case "after_tool":
+			r.tool = true
+		default:
+			return nil, fmt.Errorf("unsupported redaction stage %q", stage)
+		}
+	}
+
+	return r, nil
+}
+
+func lookupRedactionRule(name string) (redactionRule, bool) {
+	for _, rule := range builtinRedactionRules {
+		if rule.name == name {
+			return rule, true
+		}
+	}
+	return redactionRule{}, false
+}
+
+func (r *secretRedactor) AfterLLM(
+	ctx context.Context,
+	resp *LLMHookResponse,
+) (*LLMHookResponse, HookDecision, error) {
+	if !r.llm || resp == nil || resp.Response == nil {
+		return resp, HookDecision{Action: HookActionContinue}, nil
+	}
+
+	changed := r.redactInPlace(&resp.Response.Content)
+	changed = r.redactInPlace(&resp.Response.ReasoningContent) || changed
+	changed = r.redactInPlace(&resp.Response.Reasoning) || changed
+	return resp, redactionDecision(changed), nil
+}
+
+func (r *secretRedactor) AfterTool(
+	ctx context.Context,
+	result *ToolResultHookResponse,
+) (*ToolResultHookResponse, HookDecision, error) {
+	if !r.tool || result == nil || result.Result == nil {
+		return result, HookDecision{Action: HookActionContinue}, nil
+	}
+
+	changed := r.redactInPlace(&result.Result.ForLLM)
+	changed = r.redactInPlace(&result.Result.ForUser) || changed
+	return result, redactionDecision(changed), nil
+}
+
+func redactionDecision(changed bool) HookDecision {
+	if changed {
+		return HookDecision{Action: HookActionModify}
+	}
+	return HookDecision{Action: HookActionContinue}
+}
+
+func (r *secretRedactor) redactInPlace(s *string) bool {
+	redacted := r.redact(*s)
+	if redacted == *s {
+		return false
+	}
+	*s = redacted
+	return true
+}
+
+func (r *secretRedactor) redact(s string) string {
+	if s == "" {
+		return s
+	}
+	for _, rule := range r.rules {
+		marker := r.replacement
+		if marker == "" {
+			marker = "[REDACTED:" + rule.name + "]"
+		}
+		if rule.valid == nil {
+			s = rule.re.ReplaceAllLiteralString(s, marker)
+			continue
+		}
+		s = rule.re.ReplaceAllStringFunc(s, func(match string) string {
+			if rule.valid(match) {
+				return marker
+			}
+			return match
+		})
+	}
+	return s
+}
+
+// luhnValid filters card-number candidates down to ones with a valid checksum.
+func luhnValid(candidate string) bool {
+	sum, digits := 0, 0
+	double := false
+	for i := len(candidate) - 1; i >= 0; i-- {
+		c := candidate[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+		double = !double
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
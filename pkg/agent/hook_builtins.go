@@ -0,0 +1,77 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// First-party hooks available under hooks.builtins.<name>.
+const (
+	builtinHookRedactSecrets = "redact_secrets"
+	builtinHookTokenBudget   = "token_budget"
+	builtinHookToolRateLimit = "tool_rate_limit"
+	builtinHookAuditLog      = "audit_log"
+)
+
+func init() {
+	builtins := []struct {
+		name    string
+		factory BuiltinHookFactory
+	}{
+		{builtinHookRedactSecrets, newSecretRedactorHook},
+		{builtinHookTokenBudget, newTokenBudgetHook},
+		{builtinHookToolRateLimit, newToolRateLimitHook},
+		{builtinHookAuditLog, newAuditLogHook},
+	}
+	for _, builtin := range builtins {
+		if err := RegisterBuiltinHook(builtin.name, builtin.factory); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// decodeBuiltinHookConfig strictly decodes spec.Config into out, so typos in
+// hook config surface at mount time instead of being silently ignored.
+func decodeBuiltinHookConfig(spec config.BuiltinHookConfig, out any) error {
+	if len(bytes.TrimSpace(spec.Config)) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(spec.Config))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("decode config: %w", err)
+	}
+	return nil
+}
+
+// passthroughLLM and passthroughTool let single-stage built-ins satisfy the
+// two-method interceptor interfaces.
+type passthroughLLM struct{}
+
+func (passthroughLLM) BeforeLLM(ctx context.Context, req *LLMHookRequest) (*LLMHookRequest, HookDecision, error) {
+	return req, HookDecision{Action: HookActionContinue}, nil
+}
+
+func (passthroughLLM) AfterLLM(ctx context.Context, resp *LLMHookResponse) (*LLMHookResponse, HookDecision, error) {
+	return resp, HookDecision{Action: HookActionContinue}, nil
+}
+
+type passthroughTool struct{}
+
+func (passthroughTool) BeforeTool(
+	ctx context.Context,
+	call *ToolCallHookRequest,
+) (*ToolCallHookRequest, HookDecision, error) {
+	return call, HookDecision{Action: HookActionContinue}, nil
+}
+
+func (passthroughTool) AfterTool(
+	ctx context.Context,
+	result *ToolResultHookResponse,
+) (*ToolResultHookResponse, HookDecision, error) {
+	return result, HookDecision{Action: HookActionContinue}, nil
+}
@@ -0,0 +1,350 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+func TestBuiltinHooks_Registered(t *testing.T) {
+	for _, name := range []string{
+		builtinHookRedactSecrets,
+		builtinHookTokenBudget,
+		builtinHookToolRateLimit,
+		builtinHookAuditLog,
+	} {
+		if _, ok := lookupBuiltinHook(name); !ok {
+			t.Errorf("builtin hook %q is not registered", name)
+		}
+	}
+}
+
+func TestBuiltinHooks_RejectUnknownConfigFields(t *testing.T) {
+	factory, _ := lookupBuiltinHook(builtinHookToolRateLimit)
+	_, err := factory(context.Background(), config.BuiltinHookConfig{
+		Config: json.RawMessage(`{"limit": {"exec": {"max_calls": 1, "window_seconds": 1}}}`),
+	})
+	if err == nil {
+		t.Fatal("expected error for misspelled config field")
+	}
+}
+
+func TestSecretRedactor_RedactsLLMAndToolOutput(t *testing.T) {
+	redactor, err := newSecretRedactor(secretRedactorConfig{})
+	if err != nil {
+		t.Fatalf("newSecretRedactor() error = %v", err)
+	}
+
+	resp, decision, err := redactor.AfterLLM(context.Background(), &LLMHookResponse{
+		Response: &providers.LLMResponse{
+			Content: "mail alice@example.com, key sk-abcdefghijklmnopqrstuvwxyz123456",
+		},
+	})
+	if err != nil {
+		t.Fatalf("AfterLLM() error = %v", err)
+	}
+	if decision.Action != HookActionModify {
+		t.Fatalf("decision = %q, want modify", decision.Action)
+	}
+	want := "mail [REDACTED:email], key [REDACTED:api_key]"
+	if resp.Response.Content != want {
+		t.Fatalf("content = %q, want %q", resp.Response.Content, want)
+	}
+
+	result, _, err := redactor.AfterTool(context.Background(), &ToolResultHookResponse{
+		Result: &tools.ToolResult{ForLLM: "card 4111 1111 1111 1111, order 1234 5678 9012 3456"},
+	})
+	if err != nil {
+		t.Fatalf("AfterTool() error = %v", err)
+	}
+	if got := result.Result.ForLLM; got != "card [REDACTED:credit_card], order 1234 5678 9012 3456" {
+		t.Fatalf("tool output = %q, want only the Luhn-valid number redacted", got)
+	}
+
+	_, decision, _ = redactor.AfterLLM(context.Background(), &LLMHookResponse{
+		Response: &providers.LLMResponse{Content: "nothing sensitive"},
+	})
+	if decision.Action != HookActionContinue {
+		t.Fatalf("decision = %q, want continue for clean content", decision.Action)
+	}
+}
+
+func TestSecretRedactor_CustomPatternAndStages(t *testing.T) {
+	redactor, err := newSecretRedactor(secretRedactorConfig{
+		Rules:       []string{"email"},
+		Patterns:    map[string]string{"ticket": `TICKET-\d+`},
+		Replacement: "***",
+		Stages:      []string{"after_tool"},
+	})
+	if err != nil {
+		t.Fatalf("newSecretRedactor() error = %v", err)
+	}
+
+	resp, _, _ := redactor.AfterLLM(context.Background(), &LLMHookResponse{
+		Response: &providers.LLMResponse{Content: "TICKET-42"},
+	})
+	if resp.Response.Content != "TICKET-42" {
+		t.Fatalf("after_llm should be untouched, got %q", resp.Response.Content)
+	}
+
+	result, _, _ := redactor.AfterTool(context.Background(), &ToolResultHookResponse{
+		Result: &tools.ToolResult{ForLLM: "TICKET-42 by bob@example.com"},
+	})
+	if result.Result.ForLLM != "*** by ***" {
+		t.Fatalf("tool output = %q", result.Result.ForLLM)
+	}
+
+	if _, err := newSecretRedactor(secretRedactorConfig{Rules: []string{"ssn"}}); err == nil {
+		t.Fatal("expected error for unknown rule")
+	}
+}
+
+func TestTokenBudget_AbortsWhenSessionBudgetSpent(t *testing.T) {
+	budget, err := newTokenBudget(tokenBudgetConfig{MaxSessionTokens: 1000})
+	if err != nil {
+		t.Fatalf("newTokenBudget() error = %v", err)
+	}
+
+	meta := EventMeta{SessionKey: "s1", TurnID: "t1"}
+	req := &LLMHookRequest{Meta: meta, Messages: []providers.Message{{Role: "user", Content: "hi"}}}
+
+	if _, decision, _ := budget.BeforeLLM(context.Background(), req); decision.Action != HookActionContinue {
+		t.Fatalf("first request decision = %q, want continue", decision.Action)
+	}
+	budget.AfterLLM(context.Background(), &LLMHookResponse{
+		Meta:     meta,
+		Response: &providers.LLMResponse{Usage: &providers.UsageInfo{TotalTokens: 999}},
+	})
+
+	_, decision, _ := budget.BeforeLLM(context.Background(), req)
+	if decision.Action != HookActionAbortTurn {
+		t.Fatalf("decision = %q, want abort_turn once budget is spent", decision.Action)
+	}
+	if !strings.Contains(decision.Reason, "session token budget") {
+		t.Fatalf("reason = %q", decision.Reason)
+	}
+
+	other := &LLMHookRequest{Meta: EventMeta{SessionKey: "s2", TurnID: "t2"}, Messages: req.Messages}
+	if _, decision, _ := budget.BeforeLLM(context.Background(), other); decision.Action != HookActionContinue {
+		t.Fatalf("other session decision = %q, want continue", decision.Action)
+	}
+}
+
+func TestTokenBudget_WindowResetsSpend(t *testing.T) {
+	budget, err := newTokenBudget(tokenBudgetConfig{MaxSessionTokens: 100, WindowMinutes: 1})
+	if err != nil {
+		t.Fatalf("newTokenBudget() error = %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	budget.now = func() time.Time { return now }
+
+	meta := EventMeta{SessionKey: "s1"}
+	budget.AfterLLM(context.Background(), &LLMHookResponse{
+		Meta:     meta,
+		Response: &providers.LLMResponse{Usage: &providers.UsageInfo{TotalTokens: 100}},
+	})
+	if _, decision, _ := budget.BeforeLLM(context.Background(), &LLMHookRequest{Meta: meta}); decision.Action != HookActionAbortTurn {
+		t.Fatalf("decision = %q, want abort_turn inside window", decision.Action)
+	}
+
+	now = now.Add(time.Minute)
+	if _, decision, _ := budget.BeforeLLM(context.Background(), &LLMHookRequest{Meta: meta}); decision.Action != HookActionContinue {
+		t.Fatalf("decision = %q, want continue after window reset", decision.Action)
+	}
+}
+
+// byteTokenizer counts one token per byte, far more than the heuristic.
+type byteTokenizer struct{}
+
+func (byteTokenizer) Name() string          { return "bytes" }
+func (byteTokenizer) Count(text string) int { return len(text) }
+
+func TestTokenBudget_CountsWithAgentTokenizer(t *testing.T) {
+	budget, err := newTokenBudget(tokenBudgetConfig{MaxTurnTokens: 80})
+	if err != nil {
+		t.Fatalf("newTokenBudget() error = %v", err)
+	}
+	req := &LLMHookRequest{
+		Meta:     EventMeta{AgentID: "main", SessionKey: "s1", TurnID: "t1"},
+		Messages: []providers.Message{{Role: "user", Content: strings.Repeat("x", 100)}},
+	}
+
+	if _, decision, _ := budget.BeforeLLM(context.Background(), req); decision.Action != HookActionContinue {
+		t.Fatalf("heuristic decision = %q, want continue", decision.Action)
+	}
+
+	budget.useAgentTokenizers(func(agentID string) tokenizer.Tokenizer {
+		if agentID == "main" {
+			return byteTokenizer{}
+		}
+		return nil
+	})
+	if _, decision, _ := budget.BeforeLLM(context.Background(), req); decision.Action != HookActionAbortTurn {
+		t.Fatalf("agent tokenizer decision = %q, want abort_turn", decision.Action)
+	}
+}
+
+func TestTokenBudget_DropsIdleAndExpiredCounters(t *testing.T) {
+	budget, err := newTokenBudget(tokenBudgetConfig{MaxSessionTokens: 100, WindowMinutes: 60})
+	if err != nil {
+		t.Fatalf("newTokenBudget() error = %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	budget.now = func() time.Time { return now }
+
+	for _, key := range []string{"s1", "s2"} {
+		budget.BeforeLLM(context.Background(), &LLMHookRequest{Meta: EventMeta{SessionKey: key, TurnID: key + "-turn"}})
+	}
+	now = now.Add(2 * time.Hour)
+	budget.BeforeLLM(context.Background(), &LLMHookRequest{Meta: EventMeta{SessionKey: "s3"}})
+
+	if len(budget.sessions) != 1 || budget.sessions["s3"] == nil {
+		t.Fatalf("sessions = %v, want only s3", budget.sessions)
+	}
+	if len(budget.turns) != 0 {
+		t.Fatalf("turns = %v, want expired turns dropped", budget.turns)
+	}
+}
+
+func TestToolRateLimiter_DeniesOverLimitPerSession(t *testing.T) {
+	limiter, err := newToolRateLimiter(toolRateLimitConfig{
+		Limits: map[string]toolRateLimit{"exec": {MaxCalls: 2, WindowSeconds: 60}},
+	})
+	if err != nil {
+		t.Fatalf("newToolRateLimiter() error = %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	limiter.now = func() time.Time { return now }
+
+	call := func(session, tool string) HookAction {
+		_, decision, _ := limiter.BeforeTool(context.Background(), &ToolCallHookRequest{
+			Meta: EventMeta{SessionKey: session},
+			Tool: tool,
+		})
+		return decision.Action
+	}
+
+	for i := 0; i < 2; i++ {
+		if got := call("s1", "exec"); got != HookActionContinue {
+			t.Fatalf("call %d = %q, want continue", i+1, got)
+		}
+	}
+	if got := call("s1", "exec"); got != HookActionDenyTool {
+		t.Fatalf("third call = %q, want deny_tool", got)
+	}
+	if got := call("s2", "exec"); got != HookActionContinue {
+		t.Fatalf("other session = %q, want continue", got)
+	}
+	if got := call("s1", "read_file"); got != HookActionContinue {
+		t.Fatalf("unlimited tool = %q, want continue", got)
+	}
+
+	now = now.Add(time.Minute)
+	if got := call("s1", "exec"); got != HookActionContinue {
+		t.Fatalf("after window = %q, want continue", got)
+	}
+}
+
+func TestToolRateLimiter_DropsIdleKeys(t *testing.T) {
+	limiter, err := newToolRateLimiter(toolRateLimitConfig{
+		Limits: map[string]toolRateLimit{"exec": {MaxCalls: 2, WindowSeconds: 60}},
+	})
+	if err != nil {
+		t.Fatalf("newToolRateLimiter() error = %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	limiter.now = func() time.Time { return now }
+
+	for _, session := range []string{"s1", "s2", "s3"} {
+		limiter.BeforeTool(context.Background(), &ToolCallHookRequest{Meta: EventMeta{SessionKey: session}, Tool: "exec"})
+	}
+	now = now.Add(2 * time.Minute)
+	limiter.BeforeTool(context.Background(), &ToolCallHookRequest{Meta: EventMeta{SessionKey: "s4"}, Tool: "exec"})
+
+	if len(limiter.calls) != 1 {
+		t.Fatalf("tracked keys = %d, want only the active session", len(limiter.calls))
+	}
+}
+
+func TestAuditLogger_WritesJSONL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit", "events.jsonl")
+	logger, err := newAuditLogger(auditLogConfig{Path: path, Events: []string{"tool_exec_end"}})
+	if err != nil {
+		t.Fatalf("newAuditLogger() error = %v", err)
+	}
+
+	meta := EventMeta{AgentID: "main", TurnID: "t1", SessionKey: "s1"}
+	_ = logger.OnEvent(context.Background(), Event{Kind: EventKindTurnStart, Meta: meta})
+	_ = logger.OnEvent(context.Background(), Event{
+		Kind:    EventKindToolExecEnd,
+		Time:    time.Unix(1_700_000_000, 0).UTC(),
+		Meta:    meta,
+		Payload: ToolExecEndPayload{Tool: "exec"},
+	})
+	if err := logger.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("open audit log: %v", err)
+	}
+	defer f.Close()
+
+	var records []auditLogRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec auditLogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("invalid JSONL line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, rec)
+	}
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1 (filtered by events)", len(records))
+	}
+	if records[0].Kind != "tool_exec_end" || records[0].TurnID != "t1" || records[0].SessionKey != "s1" {
+		t.Fatalf("unexpected record: %+v", records[0])
+	}
+}
+
+func TestAgentLoop_MountsConfiguredBuiltinLibraryHooks(t *testing.T) {
+	provider := &llmHookTestProvider{}
+	al := newConfiguredHookLoop(t, provider, config.HooksConfig{
+		Enabled: true,
+		Builtins: map[string]config.BuiltinHookConfig{
+			builtinHookRedactSecrets: {
+				Enabled: true,
+				Config:  json.RawMessage(`{"rules": ["email"]}`),
+			},
+			builtinHookAuditLog: {
+				Enabled: true,
+				Config:  json.RawMessage(`{"path": ` + jsonQuote(filepath.Join(t.TempDir(), "audit.jsonl")) + `}`),
+			},
+		},
+	})
+	defer al.Close()
+
+	if err := al.ensureHooksInitialized(context.Background()); err != nil {
+		t.Fatalf("ensureHooksInitialized() error = %v", err)
+	}
+	mounted := al.hooks.snapshotHooks()
+	if len(mounted) != 2 {
+		t.Fatalf("mounted %d hooks, want 2", len(mounted))
+	}
+}
+
+func jsonQuote(s string) string {
+	b, _ := json.Marshal(s)
+	return string(b)
+}
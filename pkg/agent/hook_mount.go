@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 )
 
 type hookRuntime struct {
@@ -96,10 +97,19 @@ func configureHookManagerFromConfig(hm *HookManager, cfg *config.Config) {
 	if hm == nil || cfg == nil {
 		return
 	}
+	approval := hookTimeoutFromMS(cfg.Hooks.Defaults.ApprovalTimeoutMS)
+	if cfg.Hooks.Approval.Enabled {
+		// A chat prompt waits on a human; never cut it short before the
+		// approver's own timeout has had a chance to deny it.
+		if approval <= 0 {
+			approval = defaultHookApprovalTimeout
+		}
+		approval = max(approval, chatApprovalTimeout(cfg.Hooks.Approval)+chatApprovalGrace)
+	}
 	hm.ConfigureTimeouts(
 		hookTimeoutFromMS(cfg.Hooks.Defaults.ObserverTimeoutMS),
 		hookTimeoutFromMS(cfg.Hooks.Defaults.InterceptorTimeoutMS),
-		hookTimeoutFromMS(cfg.Hooks.Defaults.ApprovalTimeoutMS),
+		approval,
 	)
 }
 
@@ -150,6 +160,9 @@ func (al *AgentLoop) loadConfiguredHooks(ctx context.Context) (err error) {
 		if factoryErr != nil {
 			return fmt.Errorf("build builtin hook %q: %w", name, factoryErr)
 		}
+		if user, ok := hook.(agentTokenizerUser); ok {
+			user.useAgentTokenizers(al.agentTokenizer)
+		}
 		if err := al.MountHook(HookRegistration{
 			Name:     name,
 			Priority: spec.Priority,
@@ -161,6 +174,21 @@ func (al *AgentLoop) loadConfiguredHooks(ctx context.Context) (err error) {
 		mounted = append(mounted, name)
 	}
 
+	if approvalCfg := al.cfg.Hooks.Approval; approvalCfg.Enabled && al.approver != nil {
+		if err := al.approver.configure(approvalCfg); err != nil {
+			return fmt.Errorf("configure tool approval: %w", err)
+		}
+		if err := al.MountHook(HookRegistration{
+			Name:     chatApprovalHookName,
+			Priority: approvalCfg.Priority,
+			Source:   HookSourceInProcess,
+			Hook:     al.approver,
+		}); err != nil {
+			return fmt.Errorf("mount tool approval hook: %w", err)
+		}
+		mounted = append(mounted, chatApprovalHookName)
+	}
+
 	processNames := enabledProcessHookNames(al.cfg.Hooks.Processes)
 	for _, name := range processNames {
 		spec := al.cfg.Hooks.Processes[name]
@@ -188,6 +216,16 @@ func (al *AgentLoop) loadConfiguredHooks(ctx context.Context) (err error) {
 	return nil
 }
 
+// agentTokenizer returns the tokenizer an agent uses for its context budget,
+// or nil for an unknown agent.
+func (al *AgentLoop) agentTokenizer(agentID string) tokenizer.Tokenizer {
+	agent, ok := al.GetRegistry().GetAgent(agentID)
+	if !ok {
+		return nil
+	}
+	return agent.Tokenizer
+}
+
 func enabledBuiltinHookNames(specs map[string]config.BuiltinHookConfig) []string {
 	if len(specs) == 0 {
 		return nil
@@ -223,17 +261,26 @@ func processHookOptionsFromConfig(spec config.ProcessHookConfig) (ProcessHookOpt
 	if transport == "" {
 		transport = "stdio"
 	}
-	if transport != "stdio" {
+	switch transport {
+	case "stdio":
+		if len(spec.Command) == 0 {
+			return ProcessHookOptions{}, fmt.Errorf("command is required")
+		}
+	case "unix", "http":
+		if spec.Address == "" {
+			return ProcessHookOptions{}, fmt.Errorf("address is required for %s transport", transport)
+		}
+	default:
 		return ProcessHookOptions{}, fmt.Errorf("unsupported transport %q", transport)
 	}
-	if len(spec.Command) == 0 {
-		return ProcessHookOptions{}, fmt.Errorf("command is required")
-	}
 
 	opts := ProcessHookOptions{
-		Command: append([]string(nil), spec.Command...),
-		Dir:     spec.Dir,
-		Env:     processHookEnvFromMap(spec.Env),
+		Transport: transport,
+		Address:   spec.Address,
+		Headers:   spec.Headers,
+		Command:   append([]string(nil), spec.Command...),
+		Dir:       spec.Dir,
+		Env:       processHookEnvFromMap(spec.Env),
 	}
 
 	observeKinds, observeEnabled, err := processHookObserveKindsFromConfig(spec.Observe)
@@ -1,30 +1,32 @@
 package agent
 
 import (
-	"bufio"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"os"
-	"os/exec"
-	"sync"
 	"sync/atomic"
 	"time"
-
-	"github.com/sipeed/picoclaw/pkg/logger"
 )
 
 const (
 	processHookJSONRPCVersion = "2.0"
 	processHookReadBufferSize = 1024 * 1024
 	processHookCloseTimeout   = 2 * time.Second
+	processHookHelloTimeout   = 5 * time.Second
 )
 
 type ProcessHookOptions struct {
-	Command       []string
-	Dir           string
-	Env           []string
+	// Transport is "stdio" (default), "unix" or "http".
+	Transport string
+	// Command, Dir and Env start the hook as a child process (stdio only).
+	Command []string
+	Dir     string
+	Env     []string
+	// Address is the socket path (unix) or endpoint URL (http) of an
+	// already-running hook server.
+	Address string
+	// Headers are sent with every request (http only).
+	Headers       map[string]string
 	Observe       bool
 	ObserveKinds  []string
 	InterceptLLM  bool
@@ -36,21 +38,11 @@ type ProcessHook struct {
 	name string
 	opts ProcessHookOptions
 
-	cmd          *exec.Cmd
-	stdin        io.WriteCloser
+	transport    processHookTransport
 	observeKinds map[string]struct{}
 
-	writeMu sync.Mutex
-
-	pendingMu sync.Mutex
-	pending   map[uint64]chan processHookRPCMessage
-	nextID    atomic.Uint64
-
-	closed    atomic.Bool
-	done      chan struct{}
-	closeErr  error
-	closeMu   sync.Mutex
-	closeOnce sync.Once
+	nextID atomic.Uint64
+	closed atomic.Bool
 }
 
 type processHookRPCMessage struct {
@@ -71,6 +63,9 @@ type processHookHelloParams struct {
 	Name    string   `json:"name"`
 	Version int      `json:"version"`
 	Modes   []string `json:"modes,omitempty"`
+	// Instance identifies this PicoClaw process, so one hook server can
+	// serve several instances.
+	Instance string `json:"instance,omitempty"`
 }
 
 type processHookDecisionResponse struct {
@@ -99,54 +94,42 @@ type processHookAfterToolResponse struct {
 }
 
 func NewProcessHook(ctx context.Context, name string, opts ProcessHookOptions) (*ProcessHook, error) {
-	if len(opts.Command) == 0 {
-		return nil, fmt.Errorf("process hook command is required")
-	}
-
-	cmd := exec.Command(opts.Command[0], opts.Command[1:]...)
-	cmd.Dir = opts.Dir
-	if len(opts.Env) > 0 {
-		cmd.Env = append(os.Environ(), opts.Env...)
-	}
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, fmt.Errorf("create process hook stdin: %w", err)
-	}
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		return nil, fmt.Errorf("create process hook stdout: %w", err)
-	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return nil, fmt.Errorf("create process hook stderr: %w", err)
-	}
-	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("start process hook: %w", err)
-	}
-
 	ph := &ProcessHook{
 		name:         name,
 		opts:         opts,
-		cmd:          cmd,
-		stdin:        stdin,
 		observeKinds: newProcessHookObserveKinds(opts.ObserveKinds),
-		pending:      make(map[uint64]chan processHookRPCMessage),
-		done:         make(chan struct{}),
 	}
 
-	go ph.readLoop(stdout)
-	go ph.readStderr(stderr)
-	go ph.waitLoop()
-
 	helloCtx := ctx
 	if helloCtx == nil {
 		var cancel context.CancelFunc
-		helloCtx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+		helloCtx, cancel = context.WithTimeout(context.Background(), processHookHelloTimeout)
 		defer cancel()
 	}
-	if err := ph.hello(helloCtx); err != nil {
-		_ = ph.Close()
-		return nil, err
+
+	var err error
+	switch opts.Transport {
+	case "", "stdio":
+		ph.transport, err = startProcessHookStdio(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		if err := ph.hello(helloCtx, ph.transport.roundTrip); err != nil {
+			_ = ph.Close()
+			return nil, err
+		}
+	case "unix":
+		ph.transport, err = dialProcessHookUnix(helloCtx, name, opts.Address, ph.hello)
+		if err != nil {
+			return nil, err
+		}
+	case "http":
+		ph.transport, err = newProcessHookHTTP(helloCtx, name, opts.Address, opts.Headers, ph.hello)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported process hook transport %q", opts.Transport)
 	}
 
 	return ph, nil
@@ -156,26 +139,11 @@ func (ph *ProcessHook) Close() error {
 	if ph == nil {
 		return nil
 	}
-
-	ph.closeOnce.Do(func() {
-		ph.closed.Store(true)
-		if ph.stdin != nil {
-			_ = ph.stdin.Close()
-		}
-
-		select {
-		case <-ph.done:
-		case <-time.After(processHookCloseTimeout):
-			if ph.cmd != nil && ph.cmd.Process != nil {
-				_ = ph.cmd.Process.Kill()
-			}
-			<-ph.done
-		}
-	})
-
-	ph.closeMu.Lock()
-	defer ph.closeMu.Unlock()
-	return ph.closeErr
+	ph.closed.Store(true)
+	if ph.transport == nil {
+		return nil
+	}
+	return ph.transport.Close()
 }
 
 func (ph *ProcessHook) OnEvent(ctx context.Context, evt Event) error {
@@ -274,7 +242,9 @@ func (ph *ProcessHook) ApproveTool(ctx context.Context, req *ToolApprovalRequest
 	return resp, nil
 }
 
-func (ph *ProcessHook) hello(ctx context.Context) error {
+// hello performs the handshake over rt. Connection-oriented transports call
+// it again after every reconnect.
+func (ph *ProcessHook) hello(ctx context.Context, rt processHookRoundTripFunc) error {
 	modes := make([]string, 0, 4)
 	if ph.opts.Observe {
 		modes = append(modes, "observe")
@@ -290,14 +260,19 @@ func (ph *ProcessHook) hello(ctx context.Context) error {
 	}
 
 	var result map[string]any
-	return ph.call(ctx, "hook.hello", processHookHelloParams{
-		Name:    ph.name,
-		Version: 1,
-		Modes:   modes,
+	return ph.invoke(ctx, rt, "hook.hello", processHookHelloParams{
+		Name:     ph.name,
+		Version:  1,
+		Modes:    modes,
+		Instance: processHookInstanceID(),
 	}, &result)
 }
 
 func (ph *ProcessHook) notify(ctx context.Context, method string, params any) error {
+	if ph.closed.Load() {
+		return fmt.Errorf("process hook %q is closed", ph.name)
+	}
+
 	msg := processHookRPCMessage{
 		JSONRPC: processHookJSONRPCVersion,
 		Method:  method,
@@ -309,168 +284,50 @@ func (ph *ProcessHook) notify(ctx context.Context, method string, params any) er
 		}
 		msg.Params = body
 	}
-	return ph.send(ctx, msg)
+	_, err := ph.transport.roundTrip(ctx, msg)
+	return err
 }
 
 func (ph *ProcessHook) call(ctx context.Context, method string, params any, out any) error {
 	if ph.closed.Load() {
 		return fmt.Errorf("process hook %q is closed", ph.name)
 	}
+	return ph.invoke(ctx, ph.transport.roundTrip, method, params, out)
+}
 
-	id := ph.nextID.Add(1)
-	respCh := make(chan processHookRPCMessage, 1)
-	ph.pendingMu.Lock()
-	ph.pending[id] = respCh
-	ph.pendingMu.Unlock()
-
+func (ph *ProcessHook) invoke(
+	ctx context.Context,
+	rt processHookRoundTripFunc,
+	method string,
+	params any,
+	out any,
+) error {
 	msg := processHookRPCMessage{
 		JSONRPC: processHookJSONRPCVersion,
-		ID:      id,
+		ID:      ph.nextID.Add(1),
 		Method:  method,
 	}
 	if params != nil {
 		body, err := json.Marshal(params)
 		if err != nil {
-			ph.removePending(id)
 			return err
 		}
 		msg.Params = body
 	}
 
-	if err := ph.send(ctx, msg); err != nil {
-		ph.removePending(id)
-		return err
-	}
-
-	select {
-	case resp, ok := <-respCh:
-		if !ok {
-			return fmt.Errorf("process hook %q closed while waiting for %s", ph.name, method)
-		}
-		if resp.Error != nil {
-			return fmt.Errorf("process hook %q %s failed: %s", ph.name, method, resp.Error.Message)
-		}
-		if out != nil && len(resp.Result) > 0 {
-			if err := json.Unmarshal(resp.Result, out); err != nil {
-				return fmt.Errorf("decode process hook %q %s result: %w", ph.name, method, err)
-			}
-		}
-		return nil
-	case <-ctx.Done():
-		ph.removePending(id)
-		return ctx.Err()
-	}
-}
-
-func (ph *ProcessHook) send(ctx context.Context, msg processHookRPCMessage) error {
-	body, err := json.Marshal(msg)
+	resp, err := rt(ctx, msg)
 	if err != nil {
-		return err
+		return fmt.Errorf("process hook %q %s: %w", ph.name, method, err)
 	}
-	body = append(body, '\n')
-
-	ph.writeMu.Lock()
-	defer ph.writeMu.Unlock()
-
-	if ph.closed.Load() {
-		return fmt.Errorf("process hook %q is closed", ph.name)
+	if resp.Error != nil {
+		return fmt.Errorf("process hook %q %s failed: %s", ph.name, method, resp.Error.Message)
 	}
-
-	done := make(chan error, 1)
-	go func() {
-		_, writeErr := ph.stdin.Write(body)
-		done <- writeErr
-	}()
-
-	select {
-	case err := <-done:
-		if err != nil {
-			return fmt.Errorf("write process hook %q message: %w", ph.name, err)
-		}
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
-	}
-}
-
-func (ph *ProcessHook) readLoop(stdout io.Reader) {
-	scanner := bufio.NewScanner(stdout)
-	scanner.Buffer(make([]byte, 0, 64*1024), processHookReadBufferSize)
-
-	for scanner.Scan() {
-		var msg processHookRPCMessage
-		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
-			logger.WarnCF("hooks", "Failed to decode process hook message", map[string]any{
-				"hook":  ph.name,
-				"error": err.Error(),
-			})
-			continue
-		}
-		if msg.ID == 0 {
-			continue
+	if out != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, out); err != nil {
+			return fmt.Errorf("decode process hook %q %s result: %w", ph.name, method, err)
 		}
-		ph.pendingMu.Lock()
-		respCh, ok := ph.pending[msg.ID]
-		if ok {
-			delete(ph.pending, msg.ID)
-		}
-		ph.pendingMu.Unlock()
-		if ok {
-			respCh <- msg
-			close(respCh)
-		}
-	}
-}
-
-func (ph *ProcessHook) readStderr(stderr io.Reader) {
-	scanner := bufio.NewScanner(stderr)
-	scanner.Buffer(make([]byte, 0, 16*1024), processHookReadBufferSize)
-	for scanner.Scan() {
-		logger.WarnCF("hooks", "Process hook stderr", map[string]any{
-			"hook":   ph.name,
-			"stderr": scanner.Text(),
-		})
-	}
-}
-
-func (ph *ProcessHook) waitLoop() {
-	err := ph.cmd.Wait()
-	ph.closeMu.Lock()
-	ph.closeErr = err
-	ph.closeMu.Unlock()
-	ph.failPending(err)
-	close(ph.done)
-}
-
-func (ph *ProcessHook) failPending(err error) {
-	ph.pendingMu.Lock()
-	defer ph.pendingMu.Unlock()
-
-	msg := processHookRPCMessage{
-		Error: &processHookRPCError{
-			Code:    -32000,
-			Message: "process exited",
-		},
-	}
-	if err != nil {
-		msg.Error.Message = err.Error()
-	}
-
-	for id, ch := range ph.pending {
-		delete(ph.pending, id)
-		ch <- msg
-		close(ch)
-	}
-}
-
-func (ph *ProcessHook) removePending(id uint64) {
-	ph.pendingMu.Lock()
-	defer ph.pendingMu.Unlock()
-
-	if ch, ok := ph.pending[id]; ok {
-		delete(ph.pending, id)
-		close(ch)
 	}
+	return nil
 }
 
 func (al *AgentLoop) MountProcessHook(ctx context.Context, name string, opts ProcessHookOptions) error {
@@ -0,0 +1,608 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	processHookDialTimeout       = 5 * time.Second
+	processHookReconnectMinDelay = 200 * time.Millisecond
+	processHookReconnectMaxDelay = 30 * time.Second
+	processHookHTTPMaxBody       = processHookReadBufferSize
+)
+
+var errProcessHookDisconnected = errors.New("hook connection lost")
+
+// processHookRoundTripFunc sends msg; for requests (ID != 0) it waits for the
+// matching response, for notifications it returns once msg is delivered.
+type processHookRoundTripFunc func(ctx context.Context, msg processHookRPCMessage) (processHookRPCMessage, error)
+
+// processHookTransport carries JSON-RPC messages between PicoClaw and a hook.
+type processHookTransport interface {
+	roundTrip(ctx context.Context, msg processHookRPCMessage) (processHookRPCMessage, error)
+	Close() error
+}
+
+var (
+	processHookInstanceOnce sync.Once
+	processHookInstance     string
+)
+
+// processHookInstanceID identifies this PicoClaw process to shared hook servers.
+func processHookInstanceID() string {
+	processHookInstanceOnce.Do(func() {
+		host, _ := os.Hostname()
+		if host == "" {
+			host = "picoclaw"
+		}
+		suffix := make([]byte, 4)
+		_, _ = rand.Read(suffix)
+		processHookInstance = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), hex.EncodeToString(suffix))
+	})
+	return processHookInstance
+}
+
+// processHookStream speaks newline-delimited JSON-RPC over a byte stream and
+// matches responses to pending requests by ID.
+type processHookStream struct {
+	name string
+	w    io.Writer
+
+	writeMu sync.Mutex
+
+	pendingMu sync.Mutex
+	pending   map[uint64]chan processHookRPCMessage
+	failed    error
+}
+
+func newProcessHookStream(name string, w io.Writer) *processHookStream {
+	return &processHookStream{
+		name:    name,
+		w:       w,
+		pending: make(map[uint64]chan processHookRPCMessage),
+	}
+}
+
+func (s *processHookStream) roundTrip(
+	ctx context.Context,
+	msg processHookRPCMessage,
+) (processHookRPCMessage, error) {
+	if msg.ID == 0 {
+		return processHookRPCMessage{}, s.write(ctx, msg)
+	}
+
+	respCh := make(chan processHookRPCMessage, 1)
+	s.pendingMu.Lock()
+	if s.failed != nil {
+		s.pendingMu.Unlock()
+		return processHookRPCMessage{}, s.failed
+	}
+	s.pending[msg.ID] = respCh
+	s.pendingMu.Unlock()
+
+	if err := s.write(ctx, msg); err != nil {
+		s.removePending(msg.ID)
+		return processHookRPCMessage{}, err
+	}
+
+	select {
+	case resp, ok := <-respCh:
+		if !ok {
+			return processHookRPCMessage{}, fmt.Errorf("closed while waiting for %s", msg.Method)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		s.removePending(msg.ID)
+		return processHookRPCMessage{}, ctx.Err()
+	}
+}
+
+func (s *processHookStream) write(ctx context.Context, msg processHookRPCMessage) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		_, writeErr := s.w.Write(body)
+		done <- writeErr
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("write process hook %q message: %w", s.name, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// readLoop dispatches responses until r is exhausted.
+func (s *processHookStream) readLoop(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), processHookReadBufferSize)
+
+	for scanner.Scan() {
+		var msg processHookRPCMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			logger.WarnCF("hooks", "Failed to decode process hook message", map[string]any{
+				"hook":  s.name,
+				"error": err.Error(),
+			})
+			continue
+		}
+		if msg.ID == 0 {
+			continue
+		}
+		s.pendingMu.Lock()
+		respCh, ok := s.pending[msg.ID]
+		if ok {
+			delete(s.pending, msg.ID)
+		}
+		s.pendingMu.Unlock()
+		if ok {
+			respCh <- msg
+			close(respCh)
+		}
+	}
+}
+
+// failPending answers every in-flight request with err and rejects new ones.
+func (s *processHookStream) failPending(err error) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	msg := processHookRPCMessage{
+		Error: &processHookRPCError{
+			Code:    -32000,
+			Message: "process exited",
+		},
+	}
+	if err != nil {
+		msg.Error.Message = err.Error()
+	}
+	if err == nil {
+		err = errors.New(msg.Error.Message)
+	}
+	s.failed = err
+
+	for id, ch := range s.pending {
+		delete(s.pending, id)
+		ch <- msg
+		close(ch)
+	}
+}
+
+func (s *processHookStream) removePending(id uint64) {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+
+	if ch, ok := s.pending[id]; ok {
+		delete(s.pending, id)
+		close(ch)
+	}
+}
+
+// processHookStdio runs the hook as a child process and talks over its stdio.
+type processHookStdio struct {
+	*processHookStream
+
+	name  string
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+
+	done      chan struct{}
+	closeErr  error
+	closeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+func startProcessHookStdio(name string, opts ProcessHookOptions) (*processHookStdio, error) {
+	if len(opts.Command) == 0 {
+		return nil, fmt.Errorf("process hook command is required")
+	}
+
+	cmd := exec.Command(opts.Command[0], opts.Command[1:]...)
+	cmd.Dir = opts.Dir
+	if len(opts.Env) > 0 {
+		cmd.Env = append(os.Environ(), opts.Env...)
+	}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create process hook stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create process hook stdout: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("create process hook stderr: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start process hook: %w", err)
+	}
+
+	t := &processHookStdio{
+		processHookStream: newProcessHookStream(name, stdin),
+		name:              name,
+		cmd:               cmd,
+		stdin:             stdin,
+		done:              make(chan struct{}),
+	}
+
+	go t.readLoop(stdout)
+	go t.readStderr(stderr)
+	go t.waitLoop()
+
+	return t, nil
+}
+
+func (t *processHookStdio) Close() error {
+	t.closeOnce.Do(func() {
+		_ = t.stdin.Close()
+
+		select {
+		case <-t.done:
+		case <-time.After(processHookCloseTimeout):
+			if t.cmd.Process != nil {
+				_ = t.cmd.Process.Kill()
+			}
+			<-t.done
+		}
+	})
+
+	t.closeMu.Lock()
+	defer t.closeMu.Unlock()
+	return t.closeErr
+}
+
+func (t *processHookStdio) readStderr(stderr io.Reader) {
+	scanner := bufio.NewScanner(stderr)
+	scanner.Buffer(make([]byte, 0, 16*1024), processHookReadBufferSize)
+	for scanner.Scan() {
+		logger.WarnCF("hooks", "Process hook stderr", map[string]any{
+			"hook":   t.name,
+			"stderr": scanner.Text(),
+		})
+	}
+}
+
+func (t *processHookStdio) waitLoop() {
+	err := t.cmd.Wait()
+	t.closeMu.Lock()
+	t.closeErr = err
+	t.closeMu.Unlock()
+	t.failPending(err)
+	close(t.done)
+}
+
+// processHookUnix connects to a long-lived hook server on a Unix socket. When
+// the connection drops it redials with exponential backoff and repeats the
+// handshake; calls made while disconnected fail fast.
+type processHookUnix struct {
+	name      string
+	address   string
+	handshake func(ctx context.Context, rt processHookRoundTripFunc) error
+
+	mu     sync.Mutex
+	conn   net.Conn
+	stream *processHookStream
+
+	closing   chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func dialProcessHookUnix(
+	ctx context.Context,
+	name, address string,
+	handshake func(ctx context.Context, rt processHookRoundTripFunc) error,
+) (*processHookUnix, error) {
+	if address == "" {
+		return nil, fmt.Errorf("process hook address is required")
+	}
+
+	t := &processHookUnix{
+		name:      name,
+		address:   address,
+		handshake: handshake,
+		closing:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+
+	conn, readDone, err := t.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	go t.supervise(conn, readDone)
+	return t, nil
+}
+
+// connect dials, starts the reader, and runs the handshake.
+func (t *processHookUnix) connect(ctx context.Context) (net.Conn, <-chan struct{}, error) {
+	dialer := net.Dialer{Timeout: processHookDialTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", t.address)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect process hook %q: %w", t.name, err)
+	}
+
+	stream := newProcessHookStream(t.name, conn)
+	readDone := make(chan struct{})
+	go func() {
+		stream.readLoop(conn)
+		stream.failPending(errProcessHookDisconnected)
+		close(readDone)
+	}()
+
+	t.mu.Lock()
+	t.conn, t.stream = conn, stream
+	t.mu.Unlock()
+
+	if err := t.handshake(ctx, stream.roundTrip); err != nil {
+		t.detach(conn)
+		_ = conn.Close()
+		<-readDone
+		return nil, nil, err
+	}
+	return conn, readDone, nil
+}
+
+func (t *processHookUnix) detach(conn net.Conn) {
+	t.mu.Lock()
+	if t.conn == conn {
+		t.conn, t.stream = nil, nil
+	}
+	t.mu.Unlock()
+}
+
+func (t *processHookUnix) supervise(conn net.Conn, readDone <-chan struct{}) {
+	defer close(t.done)
+
+	for {
+		select {
+		case <-readDone:
+		case <-t.closing:
+			return
+		}
+		t.detach(conn)
+
+		logger.WarnCF("hooks", "Process hook disconnected, reconnecting", map[string]any{
+			"hook":    t.name,
+			"address": t.address,
+		})
+
+		delay := processHookReconnectMinDelay
+		for {
+			select {
+			case <-t.closing:
+				return
+			case <-time.After(delay):
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), processHookHelloTimeout)
+			var err error
+			conn, readDone, err = t.connect(ctx)
+			cancel()
+			if err == nil {
+				logger.InfoCF("hooks", "Process hook reconnected", map[string]any{
+					"hook":    t.name,
+					"address": t.address,
+				})
+				break
+			}
+
+			logger.DebugCF("hooks", "Process hook reconnect failed", map[string]any{
+				"hook":     t.name,
+				"error":    err.Error(),
+				"retry_in": (delay * 2).String(),
+			})
+			delay = min(delay*2, processHookReconnectMaxDelay)
+		}
+	}
+}
+
+func (t *processHookUnix) roundTrip(
+	ctx context.Context,
+	msg processHookRPCMessage,
+) (processHookRPCMessage, error) {
+	t.mu.Lock()
+	stream := t.stream
+	t.mu.Unlock()
+
+	if stream == nil {
+		return processHookRPCMessage{}, fmt.Errorf("not connected to %s (reconnecting)", t.address)
+	}
+	return stream.roundTrip(ctx, msg)
+}
+
+func (t *processHookUnix) Close() error {
+	t.closeOnce.Do(func() {
+		close(t.closing)
+		t.mu.Lock()
+		conn := t.conn
+		t.conn, t.stream = nil, nil
+		t.mu.Unlock()
+		if conn != nil {
+			_ = conn.Close()
+		}
+		<-t.done
+	})
+	return nil
+}
+
+// processHookHTTP posts each JSON-RPC message to a hook server and reads the
+// response from the reply body. After a transport failure it stops sending
+// until a backoff delay has passed, then repeats the handshake before
+// resuming.
+type processHookHTTP struct {
+	name      string
+	endpoint  string
+	headers   map[string]string
+	client    *http.Client
+	handshake func(ctx context.Context, rt processHookRoundTripFunc) error
+
+	mu      sync.Mutex
+	healthy bool
+	delay   time.Duration
+	retryAt time.Time
+}
+
+func newProcessHookHTTP(
+	ctx context.Context,
+	name, address string,
+	headers map[string]string,
+	handshake func(ctx context.Context, rt processHookRoundTripFunc) error,
+) (*processHookHTTP, error) {
+	u, err := url.Parse(address)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("process hook address %q must be an http(s) URL", address)
+	}
+
+	t := &processHookHTTP{
+		name:      name,
+		endpoint:  address,
+		headers:   headers,
+		client:    &http.Client{},
+		handshake: handshake,
+	}
+	if err := t.handshake(ctx, t.post); err != nil {
+		return nil, err
+	}
+	t.healthy = true
+	return t, nil
+}
+
+func (t *processHookHTTP) roundTrip(
+	ctx context.Context,
+	msg processHookRPCMessage,
+) (processHookRPCMessage, error) {
+	if err := t.ensureHealthy(ctx); err != nil {
+		return processHookRPCMessage{}, err
+	}
+
+	resp, err := t.post(ctx, msg)
+	if err != nil && ctx.Err() == nil {
+		t.markUnhealthy()
+	}
+	return resp, err
+}
+
+func (t *processHookHTTP) ensureHealthy(ctx context.Context) error {
+	t.mu.Lock()
+	if t.healthy {
+		t.mu.Unlock()
+		return nil
+	}
+	if wait := time.Until(t.retryAt); wait > 0 {
+		t.mu.Unlock()
+		return fmt.Errorf("%s unavailable, retrying in %s", t.endpoint, wait.Round(time.Millisecond))
+	}
+	// Hold off concurrent callers while this one re-handshakes.
+	t.retryAt = time.Now().Add(processHookHelloTimeout)
+	t.mu.Unlock()
+
+	err := t.handshake(ctx, t.post)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err != nil {
+		t.delay = min(max(t.delay*2, processHookReconnectMinDelay), processHookReconnectMaxDelay)
+		t.retryAt = time.Now().Add(t.delay)
+		return err
+	}
+	t.healthy = true
+	t.delay = 0
+	logger.InfoCF("hooks", "Process hook reconnected", map[string]any{
+		"hook":    t.name,
+		"address": t.endpoint,
+	})
+	return nil
+}
+
+func (t *processHookHTTP) markUnhealthy() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.healthy {
+		return
+	}
+	t.healthy = false
+	t.delay = processHookReconnectMinDelay
+	t.retryAt = time.Now().Add(t.delay)
+	logger.WarnCF("hooks", "Process hook unreachable, backing off", map[string]any{
+		"hook":    t.name,
+		"address": t.endpoint,
+	})
+}
+
+func (t *processHookHTTP) post(ctx context.Context, msg processHookRPCMessage) (processHookRPCMessage, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return processHookRPCMessage{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return processHookRPCMessage{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-PicoClaw-Hook", t.name)
+	req.Header.Set("X-PicoClaw-Instance", processHookInstanceID())
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return processHookRPCMessage{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return processHookRPCMessage{}, fmt.Errorf("%s returned HTTP %d", t.endpoint, resp.StatusCode)
+	}
+	if msg.ID == 0 {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, processHookHTTPMaxBody))
+		return processHookRPCMessage{}, nil
+	}
+
+	var out processHookRPCMessage
+	if err := json.NewDecoder(io.LimitReader(resp.Body, processHookHTTPMaxBody)).Decode(&out); err != nil {
+		return processHookRPCMessage{}, fmt.Errorf("decode response: %w", err)
+	}
+	if out.ID != msg.ID {
+		return processHookRPCMessage{}, fmt.Errorf("response id %d does not match request id %d", out.ID, msg.ID)
+	}
+	return out, nil
+}
+
+func (t *processHookHTTP) Close() error {
+	t.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,251 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// processHookTestServer answers hook requests the same way the helper
+// process does and records every hello it receives.
+type processHookTestServer struct {
+	mode string
+
+	mu     sync.Mutex
+	hellos []processHookHelloParams
+	conns  []net.Conn
+}
+
+func (s *processHookTestServer) respond(msg processHookRPCMessage) processHookRPCMessage {
+	if msg.Method == "hook.hello" {
+		var hello processHookHelloParams
+		_ = json.Unmarshal(msg.Params, &hello)
+		s.mu.Lock()
+		s.hellos = append(s.hellos, hello)
+		s.mu.Unlock()
+	}
+
+	resp := processHookRPCMessage{JSONRPC: processHookJSONRPCVersion, ID: msg.ID}
+	result, rpcErr := handleProcessHookRequest(s.mode, msg)
+	if rpcErr != nil {
+		resp.Error = rpcErr
+	} else {
+		resp.Result, _ = json.Marshal(result)
+	}
+	return resp
+}
+
+func (s *processHookTestServer) helloCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.hellos)
+}
+
+func (s *processHookTestServer) serveUnix(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.mu.Unlock()
+
+		go func() {
+			defer conn.Close()
+			scanner := bufio.NewScanner(conn)
+			scanner.Buffer(make([]byte, 0, 64*1024), processHookReadBufferSize)
+			encoder := json.NewEncoder(conn)
+			for scanner.Scan() {
+				var msg processHookRPCMessage
+				if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil || msg.ID == 0 {
+					continue
+				}
+				if err := encoder.Encode(s.respond(msg)); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+func (s *processHookTestServer) dropConnections() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.conns = nil
+}
+
+func TestProcessHook_UnixTransportReconnects(t *testing.T) {
+	dir, err := os.MkdirTemp("", "phk")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "hook.sock")
+	ln, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer ln.Close()
+
+	server := &processHookTestServer{mode: "rewrite"}
+	go server.serveUnix(ln)
+
+	hook, err := NewProcessHook(context.Background(), "unix-hook", ProcessHookOptions{
+		Transport:    "unix",
+		Address:      socket,
+		InterceptLLM: true,
+	})
+	if err != nil {
+		t.Fatalf("NewProcessHook() error = %v", err)
+	}
+	defer hook.Close()
+
+	beforeLLM := func() (*LLMHookRequest, error) {
+		req, _, err := hook.BeforeLLM(context.Background(), &LLMHookRequest{Model: "original"})
+		return req, err
+	}
+
+	req, err := beforeLLM()
+	if err != nil {
+		t.Fatalf("BeforeLLM() error = %v", err)
+	}
+	if req.Model != "process-model" {
+		t.Fatalf("model = %q, want process-model", req.Model)
+	}
+
+	server.dropConnections()
+
+	deadline := time.Now().Add(3 * time.Second)
+	for server.helloCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := server.helloCount(); got < 2 {
+		t.Fatalf("hello count = %d, want reconnect handshake", got)
+	}
+
+	if _, err := beforeLLM(); err != nil {
+		t.Fatalf("BeforeLLM() after reconnect error = %v", err)
+	}
+
+	server.mu.Lock()
+	first := server.hellos[0]
+	server.mu.Unlock()
+	if first.Name != "unix-hook" || first.Instance == "" {
+		t.Fatalf("hello = %+v, want name and instance", first)
+	}
+}
+
+func TestProcessHook_HTTPTransportBacksOffWhenUnhealthy(t *testing.T) {
+	server := &processHookTestServer{mode: "rewrite"}
+	var failing atomic.Bool
+	var gotHeaders atomic.Value
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		gotHeaders.Store(r.Header.Clone())
+
+		var msg processHookRPCMessage
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if msg.ID == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(server.respond(msg))
+	}))
+	defer ts.Close()
+
+	hook, err := NewProcessHook(context.Background(), "http-hook", ProcessHookOptions{
+		Transport:    "http",
+		Address:      ts.URL,
+		Headers:      map[string]string{"Authorization": "Bearer test"},
+		InterceptLLM: true,
+	})
+	if err != nil {
+		t.Fatalf("NewProcessHook() error = %v", err)
+	}
+	defer hook.Close()
+
+	req, _, err := hook.BeforeLLM(context.Background(), &LLMHookRequest{Model: "original"})
+	if err != nil {
+		t.Fatalf("BeforeLLM() error = %v", err)
+	}
+	if req.Model != "process-model" {
+		t.Fatalf("model = %q, want process-model", req.Model)
+	}
+	headers := gotHeaders.Load().(http.Header)
+	if headers.Get("X-PicoClaw-Hook") != "http-hook" || headers.Get("X-PicoClaw-Instance") == "" {
+		t.Fatalf("missing identification headers: %v", headers)
+	}
+	if headers.Get("Authorization") != "Bearer test" {
+		t.Fatalf("Authorization = %q", headers.Get("Authorization"))
+	}
+
+	failing.Store(true)
+	if _, _, err := hook.BeforeLLM(context.Background(), &LLMHookRequest{}); err == nil {
+		t.Fatal("expected error from failing server")
+	}
+	failing.Store(false)
+	_, _, err = hook.BeforeLLM(context.Background(), &LLMHookRequest{})
+	if err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Fatalf("err = %v, want fail-fast while backing off", err)
+	}
+
+	hellos := server.helloCount()
+	time.Sleep(2 * processHookReconnectMinDelay)
+	if _, _, err := hook.BeforeLLM(context.Background(), &LLMHookRequest{}); err != nil {
+		t.Fatalf("BeforeLLM() after backoff error = %v", err)
+	}
+	if server.helloCount() != hellos+1 {
+		t.Fatalf("hello count = %d, want a fresh handshake after recovery", server.helloCount())
+	}
+}
+
+func TestProcessHookOptionsFromConfig_Transports(t *testing.T) {
+	opts, err := processHookOptionsFromConfig(config.ProcessHookConfig{
+		Transport: "http",
+		Address:   "http://127.0.0.1:9000/hook",
+		Headers:   map[string]string{"Authorization": "Bearer x"},
+		Intercept: []string{"before_llm"},
+	})
+	if err != nil {
+		t.Fatalf("processHookOptionsFromConfig() error = %v", err)
+	}
+	if opts.Transport != "http" || opts.Address != "http://127.0.0.1:9000/hook" || opts.Headers["Authorization"] == "" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	for _, spec := range []config.ProcessHookConfig{
+		{Transport: "unix", Intercept: []string{"before_llm"}},
+		{Transport: "http", Intercept: []string{"before_llm"}},
+		{Transport: "grpc", Address: "localhost:1", Intercept: []string{"before_llm"}},
+		{Transport: "stdio", Intercept: []string{"before_llm"}},
+	} {
+		if _, err := processHookOptionsFromConfig(spec); err == nil {
+			t.Errorf("expected error for %+v", spec)
+		}
+	}
+}
@@ -149,6 +149,7 @@ type ToolApprovalRequest struct {
 	Arguments map[string]any `json:"arguments,omitempty"`
 	Channel   string         `json:"channel,omitempty"`
 	ChatID    string         `json:"chat_id,omitempty"`
+	SenderID  string         `json:"sender_id,omitempty"`
 }
 
 func (r *ToolApprovalRequest) Clone() *ToolApprovalRequest {
@@ -3,6 +3,7 @@ package agent
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -15,6 +16,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/routing"
 	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 	"github.com/sipeed/picoclaw/pkg/tools"
 )
 
@@ -31,19 +33,31 @@ type AgentInstance struct {
 	Temperature               float64
 	ThinkingLevel             ThinkingLevel
 	ContextWindow             int
+	Tokenizer                 tokenizer.Tokenizer // counts tokens for the context budget
 	SummarizeMessageThreshold int
 	SummarizeTokenPercent     int
 	Provider                  providers.LLMProvider
 	Sessions                  session.SessionStore
+	Checkpoints               *checkpointStore
+	Plans                     *planStore
+	ContextCompression        string            // compression strategy, see newContextCompressor
+	CompressionState          *compressionStore // per-session state of the compression strategies
 	ContextBuilder            *ContextBuilder
+	Memory                    *MemoryIndex
 	Tools                     *tools.ToolRegistry
 	Subagents                 *config.SubagentsConfig
+	SubagentTasks             *tools.SubagentManager // Tracks spawned tasks; nil when spawn is disabled
 	SkillsFilter              []string
+	Profiles                  *profileSet
 	Candidates                []providers.FallbackCandidate
-
-	// Router is non-nil when model routing is configured and the light model
-	// was successfully resolved. It scores each incoming message and decides
-	// whether to route to LightCandidates or stay with Candidates.
+	// ResponseSchema is the JSON Schema final answers to direct calls must
+	// match when the caller does not pass one.
+	ResponseSchema *ResponseSchema
+
+	// Router is non-nil when routing is enabled and either the light model
+	// was successfully resolved or auto_thinking is on. It scores each
+	// incoming message and decides whether to route to LightCandidates or
+	// stay with Candidates, and with which thinking level and max_tokens.
 	Router *routing.Router
 	// LightCandidates holds the resolved provider candidates for the light model.
 	// Pre-computed at agent creation to avoid repeated model_list lookups at runtime.
@@ -71,6 +85,17 @@ func NewAgentInstance(
 	allowWritePaths := compilePatterns(cfg.Tools.AllowWritePaths)
 
 	toolsRegistry := tools.NewToolRegistry()
+	if agentCfg != nil && agentCfg.Tools != nil {
+		for _, patterns := range [][]string{agentCfg.Tools.Allow, agentCfg.Tools.Deny} {
+			if err := tools.ValidateToolPatterns(patterns); err != nil {
+				logger.WarnCF("agent", "Malformed tool pattern is matched literally",
+					map[string]any{"agent_id": agentCfg.ID, "error": err.Error()})
+			}
+		}
+		// Set before any registration so tools added later (shared tools,
+		// MCP servers) are filtered too.
+		toolsRegistry.SetFilter(tools.PolicyFilter(agentCfg.Tools))
+	}
 
 	if cfg.Tools.IsToolEnabled("read_file") {
 		maxReadFileSize := cfg.Tools.ReadFile.MaxReadFileSize
@@ -82,6 +107,12 @@ func NewAgentInstance(
 	if cfg.Tools.IsToolEnabled("list_dir") {
 		toolsRegistry.Register(tools.NewListDirTool(workspace, readRestrict, allowReadPaths))
 	}
+	if cfg.Tools.IsToolEnabled("grep") {
+		toolsRegistry.Register(tools.NewGrepTool(workspace, readRestrict, allowReadPaths))
+	}
+	if cfg.Tools.IsToolEnabled("glob") {
+		toolsRegistry.Register(tools.NewGlobTool(workspace, readRestrict, allowReadPaths))
+	}
 	if cfg.Tools.IsToolEnabled("exec") {
 		execTool, err := tools.NewExecToolWithConfig(workspace, restrict, cfg, allowReadPaths)
 		if err != nil {
@@ -89,12 +120,24 @@ func NewAgentInstance(
 				map[string]any{"error": err.Error()})
 		} else {
 			toolsRegistry.Register(execTool)
+			if cfg.Tools.IsToolEnabled("shell_session") {
+				toolsRegistry.Register(tools.NewShellSessionTool(execTool, cfg.Tools.ShellSession))
+			}
+			if cfg.Tools.Exec.AllowBackground {
+				toolsRegistry.Register(tools.NewJobStatusTool(execTool))
+				toolsRegistry.Register(tools.NewJobOutputTool(execTool))
+				toolsRegistry.Register(tools.NewJobKillTool(execTool))
+			}
 		}
 	}
 
 	if cfg.Tools.IsToolEnabled("edit_file") {
 		toolsRegistry.Register(tools.NewEditFileTool(workspace, restrict, allowWritePaths))
 	}
+	if cfg.Tools.IsToolEnabled("apply_patch") && cfg.Tools.IsToolEnabled("edit_file") &&
+		cfg.Tools.IsToolEnabled("write_file") {
+		toolsRegistry.Register(tools.NewApplyPatchTool(workspace, restrict, allowWritePaths))
+	}
 	if cfg.Tools.IsToolEnabled("append_file") {
 		toolsRegistry.Register(tools.NewAppendFileTool(workspace, restrict, allowWritePaths))
 	}
@@ -107,17 +150,25 @@ func NewAgentInstance(
 		mcpDiscoveryActive && cfg.Tools.MCP.Discovery.UseBM25,
 		mcpDiscoveryActive && cfg.Tools.MCP.Discovery.UseRegex,
 	)
+	memoryIndex := NewMemoryIndex(
+		contextBuilder.MemoryStore(), defaults.Memory.ChunkSize, resolveMemoryEmbedder(cfg, defaults.Memory),
+	)
+	if defaults.Memory.Retrieval {
+		contextBuilder.WithMemoryRetrieval(memoryIndex, defaults.Memory.TopK)
+	}
 
 	agentID := routing.DefaultAgentID
 	agentName := ""
 	var subagents *config.SubagentsConfig
 	var skillsFilter []string
+	var responseSchema *ResponseSchema
 
 	if agentCfg != nil {
 		agentID = routing.NormalizeAgentID(agentCfg.ID)
 		agentName = agentCfg.Name
 		subagents = agentCfg.Subagents
 		skillsFilter = agentCfg.Skills
+		responseSchema = responseSchemaFromConfig(agentCfg.ResponseSchema)
 	}
 
 	maxIter := defaults.MaxToolIterations
@@ -151,6 +202,7 @@ func NewAgentInstance(
 		thinkingLevelStr = mc.ThinkingLevel
 	}
 	thinkingLevel := parseThinkingLevel(thinkingLevelStr)
+	tok := resolveTokenizer(cfg, model)
 
 	summarizeMessageThreshold := defaults.SummarizeMessageThreshold
 	if summarizeMessageThreshold == 0 {
@@ -162,6 +214,11 @@ func NewAgentInstance(
 		summarizeTokenPercent = 75
 	}
 
+	contextCompression := defaults.ContextCompression
+	if agentCfg != nil && agentCfg.ContextCompression != "" {
+		contextCompression = agentCfg.ContextCompression
+	}
+
 	// Resolve fallback candidates
 	candidates := resolveModelCandidates(cfg, defaults.Provider, model, fallbacks)
 
@@ -169,17 +226,26 @@ func NewAgentInstance(
 	// to avoid repeated model_list lookups on every incoming message.
 	var router *routing.Router
 	var lightCandidates []providers.FallbackCandidate
-	if rc := defaults.Routing; rc != nil && rc.Enabled && rc.LightModel != "" {
-		resolved := resolveModelCandidates(cfg, defaults.Provider, rc.LightModel, nil)
-		if len(resolved) > 0 {
-			router = routing.New(routing.RouterConfig{
-				LightModel: rc.LightModel,
-				Threshold:  rc.Threshold,
-			})
-			lightCandidates = resolved
-		} else {
-			logger.WarnCF("agent", "Routing light model not found; routing disabled",
-				map[string]any{"light_model": rc.LightModel, "agent_id": agentID})
+	if rc := defaults.Routing; rc != nil && rc.Enabled {
+		routerCfg := routing.RouterConfig{
+			Threshold: rc.Threshold,
+			Tokenizer: tok,
+		}
+		if rc.LightModel != "" {
+			resolved := resolveModelCandidates(cfg, defaults.Provider, rc.LightModel, nil)
+			if len(resolved) > 0 {
+				routerCfg.LightModel = rc.LightModel
+				lightCandidates = resolved
+			} else {
+				logger.WarnCF("agent", "Routing light model not found; model routing disabled",
+					map[string]any{"light_model": rc.LightModel, "agent_id": agentID})
+			}
+		}
+		if rc.AutoThinking {
+			routerCfg.Tiers = routingTiers(rc.Tiers)
+		}
+		if routerCfg.LightModel != "" || len(routerCfg.Tiers) > 0 {
+			router = routing.New(routerCfg)
 		}
 	}
 
@@ -194,20 +260,81 @@ func NewAgentInstance(
 		Temperature:               temperature,
 		ThinkingLevel:             thinkingLevel,
 		ContextWindow:             contextWindow,
+		Tokenizer:                 tok,
 		SummarizeMessageThreshold: summarizeMessageThreshold,
 		SummarizeTokenPercent:     summarizeTokenPercent,
 		Provider:                  provider,
 		Sessions:                  sessions,
+		Checkpoints:               newCheckpointStore(sessionsDir),
+		Plans:                     newPlanStore(sessionsDir),
+		ContextCompression:        contextCompression,
+		CompressionState:          newCompressionStore(sessionsDir),
 		ContextBuilder:            contextBuilder,
+		Memory:                    memoryIndex,
 		Tools:                     toolsRegistry,
 		Subagents:                 subagents,
 		SkillsFilter:              skillsFilter,
+		Profiles:                  newProfileSet(workspace, contextBuilder),
 		Candidates:                candidates,
+		ResponseSchema:            responseSchema,
 		Router:                    router,
 		LightCandidates:           lightCandidates,
 	}
 }
 
+// routingTiers converts the configured routing tiers, falling back to the
+// built-in ones when none are set.
+func routingTiers(tiers []config.RoutingTier) []routing.Tier {
+	if len(tiers) == 0 {
+		return routing.DefaultTiers
+	}
+	out := make([]routing.Tier, len(tiers))
+	for i, t := range tiers {
+		out[i] = routing.Tier{MinScore: t.MinScore, ThinkingLevel: t.Thinking, MaxTokens: t.MaxTokens}
+	}
+	return out
+}
+
+// resolveTokenizer returns the tokenizer for a model name: the encoding and
+// rank table set in its model_list entry, or the family derived from the
+// model ID. A tokenizer that fails to load falls back to an estimate.
+func resolveTokenizer(cfg *config.Config, name string) tokenizer.Tokenizer {
+	var encoding, tableFile string
+	modelID := name
+	if cfg != nil {
+		if mc, err := cfg.GetModelConfig(name); err == nil {
+			encoding, tableFile = mc.Tokenizer, expandHome(mc.TokenizerFile)
+			modelID = mc.Model
+		}
+	}
+	tok, err := tokenizer.New(encoding, modelID, tableFile)
+	if err != nil {
+		logger.WarnCF("agent", "Tokenizer unavailable; estimating token counts",
+			map[string]any{"model": name, "tokenizer": tok.Name(), "error": err.Error()})
+	}
+	return tok
+}
+
+// resolveMemoryEmbedder returns the embeddings client configured for memory
+// search, or nil for keyword-only search.
+func resolveMemoryEmbedder(cfg *config.Config, mc config.MemoryConfig) MemoryEmbedder {
+	name := strings.TrimSpace(mc.EmbeddingModel)
+	if name == "" {
+		return nil
+	}
+	modelCfg, err := cfg.GetModelConfig(name)
+	if err == nil {
+		var client *providers.EmbeddingClient
+		client, err = providers.NewEmbeddingClientFromConfig(modelCfg)
+		if err == nil {
+			return client
+		}
+	}
+	logger.WarnCF("agent", "Memory embedding model unavailable; using keyword search only",
+		map[string]any{"embedding_model": name, "error": err.Error()})
+	return nil
+}
+
 // resolveAgentWorkspace determines the workspace directory for an agent.
 func resolveAgentWorkspace(agentCfg *config.AgentConfig, defaults *config.AgentDefaults) string {
 	if agentCfg != nil && strings.TrimSpace(agentCfg.Workspace) != "" {
@@ -273,8 +400,16 @@ func mediaTempDirPattern() string {
 	return "^" + regexp.QuoteMeta(filepath.Clean(media.TempDir())) + "(?:" + sep + "|$)"
 }
 
-// Close releases resources held by the agent's session store.
+// Close releases resources held by the agent's session store and by tools
+// that keep processes running, such as shell sessions and background jobs.
 func (a *AgentInstance) Close() error {
+	if a.Tools != nil {
+		for _, tool := range a.Tools.GetAll() {
+			if closer, ok := tool.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}
 	if a.Sessions != nil {
 		return a.Sessions.Close()
 	}
@@ -308,6 +443,17 @@ func initSessionStore(dir string) session.SessionStore {
 	return session.NewJSONLBackend(store)
 }
 
+// restrictTools returns a copy of the agent offering only the tools for
+// which keep returns true, or the agent itself when keep is nil.
+func restrictTools(agent *AgentInstance, keep func(name string) bool) *AgentInstance {
+	if keep == nil || agent.Tools == nil {
+		return agent
+	}
+	restricted := *agent // shallow copy
+	restricted.Tools = agent.Tools.CloneFiltered(keep)
+	return &restricted
+}
+
 func expandHome(path string) string {
 	if path == "" {
 		return path
@@ -7,8 +7,10 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/media"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 )
 
 func TestNewAgentInstance_UsesDefaultsTemperatureAndMaxTokens(t *testing.T) {
@@ -165,6 +167,41 @@ func TestNewAgentInstance_ResolveCandidatesFromModelListAlias(t *testing.T) {
 	}
 }
 
+func TestNewAgentInstance_SelectsTokenizerFromModelList(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		tokenizer string
+		want      string
+	}{
+		{"derived from model ID", "openai/gpt-4o", "", tokenizer.EncodingO200k},
+		{"explicit encoding", "openai/my-finetune", "llama3", tokenizer.EncodingLlama3},
+		{"unknown family", "anthropic/claude-sonnet-4.6", "", tokenizer.EncodingHeuristic},
+		{"invalid encoding falls back", "openai/gpt-4o", "gpt2", tokenizer.EncodingHeuristic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Agents: config.AgentsConfig{
+					Defaults: config.AgentDefaults{
+						Workspace: t.TempDir(),
+						ModelName: "main",
+					},
+				},
+				ModelList: []*config.ModelConfig{
+					{ModelName: "main", Model: tt.model, Tokenizer: tt.tokenizer},
+				},
+			}
+
+			agent := NewAgentInstance(nil, &cfg.Agents.Defaults, cfg, &mockProvider{})
+			if agent.Tokenizer == nil || agent.Tokenizer.Name() != tt.want {
+				t.Fatalf("Tokenizer = %v, want %s", agent.Tokenizer, tt.want)
+			}
+		})
+	}
+}
+
 func TestNewAgentInstance_AllowsMediaTempDirForReadListAndExec(t *testing.T) {
 	workspace := t.TempDir()
 	mediaDir := media.TempDir()
@@ -280,3 +317,74 @@ func TestNewAgentInstance_InvalidExecConfigDoesNotExit(t *testing.T) {
 		t.Fatal("read_file tool should still be registered")
 	}
 }
+
+func TestAgentToolPolicy_AgentAndBinding(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         filepath.Join(dir, "main"),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+			List: []config.AgentConfig{
+				{ID: "main", Default: true, Workspace: filepath.Join(dir, "main")},
+				{
+					ID:        "public",
+					Workspace: filepath.Join(dir, "public"),
+					Tools:     &config.ToolPolicy{Deny: []string{"write_*", "exec"}},
+				},
+			},
+		},
+		Bindings: []config.AgentBinding{
+			{
+				AgentID: "public",
+				Match:   config.BindingMatch{Channel: "discord", AccountID: "*"},
+				Tools:   &config.ToolPolicy{Allow: []string{"read_file", "mock_*"}},
+			},
+		},
+		Session: config.SessionConfig{DMScope: "per-peer"},
+		Tools: config.ToolsConfig{
+			ReadFile:  config.ReadFileToolConfig{Enabled: true},
+			WriteFile: config.ToolConfig{Enabled: true},
+		},
+	}
+	provider := &profileProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	t.Cleanup(al.Close)
+
+	public, _ := al.GetRegistry().GetAgent("public")
+	if _, ok := public.Tools.Get("write_file"); ok {
+		t.Fatal("denied write_file registered for the public agent")
+	}
+	public.Tools.Register(&echoTextTool{})
+	public.Tools.Register(&mockCustomTool{})
+	main, _ := al.GetRegistry().GetAgent("main")
+	if _, ok := main.Tools.Get("write_file"); !ok {
+		t.Fatal("main agent lacks write_file")
+	}
+
+	send := func(channel string) {
+		t.Helper()
+		_, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel:  channel,
+			SenderID: "u1",
+			ChatID:   "u1",
+			Content:  "hi",
+			Peer:     bus.Peer{Kind: "direct", ID: "u1"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The binding narrows the public agent further for Discord.
+	send("discord")
+	if got := strings.Join(provider.tools, ","); got != "mock_custom,read_file" {
+		t.Fatalf("discord tools = %q", got)
+	}
+	if _, ok := public.Tools.Get("echo_text"); !ok {
+		t.Fatal("binding policy changed the agent's own registry")
+	}
+}
@@ -30,6 +30,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/skills"
 	"github.com/sipeed/picoclaw/pkg/state"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/usage"
 	"github.com/sipeed/picoclaw/pkg/utils"
 	"github.com/sipeed/picoclaw/pkg/voice"
 )
@@ -40,10 +41,12 @@ type AgentLoop struct {
 	cfg      *config.Config
 	registry *AgentRegistry
 	state    *state.Manager
+	usage    *usage.Ledger
 
 	// Event system (from Incoming)
 	eventBus *EventBus
 	hooks    *HookManager
+	approver *chatApprover
 
 	// Runtime state
 	running        atomic.Bool
@@ -56,6 +59,7 @@ type AgentLoop struct {
 	mcp            mcpRuntime
 	hookRuntime    hookRuntime
 	steering       *steeringQueue
+	handoffs       *handoffStore
 	mu             sync.RWMutex
 
 	// Concurrent turn management (from HEAD)
@@ -85,6 +89,9 @@ type processOptions struct {
 	SendResponse            bool                // Whether to send response via bus
 	NoHistory               bool                // If true, don't load session history (for heartbeat)
 	SkipInitialSteeringPoll bool                // If true, skip the steering poll at loop start (used by Continue)
+	ResponseSchema          *ResponseSchema     // JSON Schema the final answer must match (direct calls)
+	ThinkingLevel           ThinkingLevel       // Overrides the routed or configured thinking level (/think)
+	ToolPolicy              *config.ToolPolicy  // Narrows the agent's tools (from the matched binding)
 }
 
 type continuationTarget struct {
@@ -118,8 +125,12 @@ func NewAgentLoop(
 	// Create state manager using default agent's workspace for channel recording
 	defaultAgent := registry.GetDefaultAgent()
 	var stateManager *state.Manager
+	var usageLedger *usage.Ledger
+	var handoffs *handoffStore
 	if defaultAgent != nil {
 		stateManager = state.NewManager(defaultAgent.Workspace)
+		usageLedger = usage.NewLedger(usage.Path(defaultAgent.Workspace))
+		handoffs = newHandoffStore(handoffPath(defaultAgent.Workspace))
 	}
 
 	eventBus := NewEventBus()
@@ -128,14 +139,17 @@ func NewAgentLoop(
 		cfg:         cfg,
 		registry:    registry,
 		state:       stateManager,
+		usage:       usageLedger,
 		eventBus:    eventBus,
 		summarizing: sync.Map{},
 		fallback:    fallbackChain,
 		cmdRegistry: commands.NewRegistry(commands.BuiltinDefinitions()),
 		steering:    newSteeringQueue(parseSteeringMode(cfg.Agents.Defaults.SteeringMode)),
+		handoffs:    handoffs,
 	}
 	al.hooks = NewHookManager(eventBus)
 	configureHookManagerFromConfig(al.hooks, cfg)
+	al.approver = newChatApprover(al.sendApprovalPrompt)
 
 	// Register shared tools to all agents (now that al is created)
 	registerSharedTools(al, cfg, msgBus, registry, provider)
@@ -248,6 +262,22 @@ func registerSharedTools(
 			agent.Tools.Register(sendFileTool)
 		}
 
+		// Memory tools: explicit search and updates of long-term memory
+		if cfg.Tools.IsToolEnabled("memory") && agent.Memory != nil {
+			agent.Tools.Register(newMemorySearchTool(agent.Memory))
+			agent.Tools.Register(newMemoryWriteTool(agent.ContextBuilder.MemoryStore(), agent.Memory))
+		}
+
+		// Plan tool: updates the per-session task list kept in plan mode
+		if cfg.Agents.Defaults.PlanMode {
+			agent.Tools.Register(newPlanTool())
+		}
+
+		// Recall tool: reads back tool results elided from history
+		if agent.ContextCompression == compressionElideToolResults {
+			agent.Tools.Register(newRecallToolResultTool())
+		}
+
 		// Skill discovery and installation tools
 		skills_enabled := cfg.Tools.IsToolEnabled("skills")
 		find_skills_enable := cfg.Tools.IsToolEnabled("find_skills")
@@ -289,6 +319,11 @@ func registerSharedTools(
 		if (spawnEnabled || spawnStatusEnabled) && cfg.Tools.IsToolEnabled("subagent") {
 			subagentManager := tools.NewSubagentManager(provider, agent.Model, agent.Workspace)
 			subagentManager.SetLLMOptions(agent.MaxTokens, agent.Temperature)
+			if err := subagentManager.EnablePersistence(filepath.Join(agent.Workspace, "subagents")); err != nil {
+				logger.WarnCF("agent", "Spawned tasks will not survive a restart",
+					map[string]any{"agent_id": agentID, "error": err.Error()})
+			}
+			agent.SubagentTasks = subagentManager
 
 			// Set the spawner that links into AgentLoop's turnState
 			subagentManager.SetSpawner(func(
@@ -307,6 +342,9 @@ func registerSharedTools(
 					parentTS = &turnState{
 						ctx:            ctx,
 						turnID:         "adhoc-root",
+						agent:          agent,
+						channel:        tools.ToolChannel(ctx),
+						chatID:         tools.ToolChatID(ctx),
 						depth:          0,
 						session:        nil, // Ephemeral session not needed for adhoc spawn
 						pendingResults: make(chan *tools.ToolResult, 16),
@@ -376,6 +414,22 @@ func registerSharedTools(
 		} else if (spawnEnabled || spawnStatusEnabled) && !cfg.Tools.IsToolEnabled("subagent") {
 			logger.WarnCF("agent", "spawn/spawn_status tools require subagent to be enabled", nil)
 		}
+
+		// Team tool: named sub-agents sharing one token budget
+		if cfg.Tools.IsToolEnabled("team") {
+			agent.Tools.Register(newTeamTool(cfg.Tools.Team))
+		}
+
+		// Evaluator-optimizer loop: worker and evaluator sub-turns
+		if cfg.Tools.IsToolEnabled("evaluate_and_refine") {
+			agent.Tools.Register(newRefineTool(cfg.Tools.Refine))
+		}
+
+		// Handoff tool: moves a conversation to another agent. Every agent of
+		// a multi-agent setup gets it so the receiving one can hand back.
+		if cfg.Tools.IsToolEnabled("handoff") && len(registry.ListAgentIDs()) > 1 {
+			agent.Tools.Register(newHandoffTool(handoffTargets(registry, agentID)))
+		}
 	}
 }
 
@@ -389,7 +443,31 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 		return err
 	}
 
+	// Turns for different sessions run concurrently; the scheduler keeps each
+	// session to one turn at a time and picks the most urgent one next.
+	sched := newTurnScheduler(al.GetConfig().Agents.Defaults.GetMaxConcurrentTurns())
+	var workers sync.WaitGroup
+	defer workers.Wait()
+
+	// Turns cut short by a crash or power loss left a checkpoint behind. Their
+	// recovery runs as the first turn of each session, so new messages for
+	// the session wait for it but other sessions do not.
+	al.scheduleInterruptedTurns(sched)
+	al.ResumeSubagentTasks(ctx)
+
 	for al.running.Load() {
+		for {
+			sess, msg, ok := sched.next()
+			if !ok {
+				break
+			}
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				al.runScheduledSession(ctx, sched, sess, msg)
+			}()
+		}
+
 		select {
 		case <-ctx.Done():
 			return nil
@@ -397,222 +475,183 @@ func (al *AgentLoop) Run(ctx context.Context) error {
 			if !ok {
 				return nil
 			}
+			al.scheduleInbound(ctx, sched, msg)
+		case <-sched.wake:
+		}
+	}
 
-			// Start a goroutine that drains the bus while processMessage is
-			// running. Only messages that resolve to the active turn scope are
-			// redirected into steering; other inbound messages are requeued.
-			drainCancel := func() {}
-			if activeScope, activeAgentID, ok := al.resolveSteeringTarget(msg); ok {
-				drainCtx, cancel := context.WithCancel(ctx)
-				drainCancel = cancel
-				go al.drainBusToSteering(drainCtx, activeScope, activeAgentID)
-			}
-
-			// Process message
-			func() {
-				defer func() {
-					if al.channelManager != nil {
-						al.channelManager.InvokeTypingStop(msg.Channel, msg.ChatID)
-					}
-				}()
-				// TODO: Re-enable media cleanup after inbound media is properly consumed by the agent.
-				// Currently disabled because files are deleted before the LLM can access their content.
-				// defer func() {
-				// 	if al.mediaStore != nil && msg.MediaScope != "" {
-				// 		if releaseErr := al.mediaStore.ReleaseAll(msg.MediaScope); releaseErr != nil {
-				// 			logger.WarnCF("agent", "Failed to release media", map[string]any{
-				// 				"scope": msg.MediaScope,
-				// 				"error": releaseErr.Error(),
-				// 			})
-				// 		}
-				// 	}
-				// }()
-
-				drainCanceled := false
-				cancelDrain := func() {
-					if drainCanceled {
-						return
-					}
-					drainCancel()
-					drainCanceled = true
-				}
-				defer cancelDrain()
-
-				response, err := al.processMessage(ctx, msg)
-				if err != nil {
-					response = fmt.Sprintf("Error processing message: %v", err)
-				}
-				finalResponse := response
-
-				target, targetErr := al.buildContinuationTarget(msg)
-				if targetErr != nil {
-					logger.WarnCF("agent", "Failed to build steering continuation target",
-						map[string]any{
-							"channel": msg.Channel,
-							"error":   targetErr.Error(),
-						})
-					return
-				}
-				if target == nil {
-					cancelDrain()
-					if finalResponse != "" {
-						al.publishResponseIfNeeded(ctx, msg.Channel, msg.ChatID, finalResponse)
-					}
-					return
-				}
-
-				for al.pendingSteeringCountForScope(target.SessionKey) > 0 {
-					logger.InfoCF("agent", "Continuing queued steering after turn end",
-						map[string]any{
-							"channel":     target.Channel,
-							"chat_id":     target.ChatID,
-							"session_key": target.SessionKey,
-							"queue_depth": al.pendingSteeringCountForScope(target.SessionKey),
-						})
-
-					continued, continueErr := al.Continue(ctx, target.SessionKey, target.Channel, target.ChatID)
-					if continueErr != nil {
-						logger.WarnCF("agent", "Failed to continue queued steering",
-							map[string]any{
-								"channel": target.Channel,
-								"chat_id": target.ChatID,
-								"error":   continueErr.Error(),
-							})
-						return
-					}
-					if continued == "" {
-						return
-					}
+	return nil
+}
 
-					finalResponse = continued
-				}
+// scheduleInbound hands an inbound message to the scheduler. Messages for a
+// session whose turn is running are redirected into that turn's steering
+// queue; everything else waits for its session's next turn.
+func (al *AgentLoop) scheduleInbound(ctx context.Context, sched *turnScheduler, msg bus.InboundMessage) {
+	// Replies to a pending tool approval prompt belong to the approver, not
+	// to a new turn.
+	if al.approver.resolveReply(msg) {
+		return
+	}
 
-				cancelDrain()
+	key, agentID, steerable := al.scheduleKey(msg)
+	if steerable && sched.isRunning(key) {
+		// Transcribe audio before steering, so the agent sees text.
+		msg, _ = al.transcribeAudioInMessage(ctx, msg)
+	}
 
-				for al.pendingSteeringCountForScope(target.SessionKey) > 0 {
-					logger.InfoCF("agent", "Draining steering queued during turn shutdown",
-						map[string]any{
-							"channel":     target.Channel,
-							"chat_id":     target.ChatID,
-							"session_key": target.SessionKey,
-							"queue_depth": al.pendingSteeringCountForScope(target.SessionKey),
-						})
+	var steer func() bool
+	if steerable {
+		steer = func() bool {
+			logger.InfoCF("agent", "Redirecting inbound message to steering queue",
+				map[string]any{
+					"channel":     msg.Channel,
+					"sender_id":   msg.SenderID,
+					"content_len": len(msg.Content),
+					"scope":       key,
+				})
+			if err := al.enqueueSteeringMessage(key, agentID, providers.Message{
+				Role:    "user",
+				Content: msg.Content,
+				Media:   append([]string(nil), msg.Media...),
+			}); err != nil {
+				logger.WarnCF("agent", "Failed to steer message, queuing it as a new turn",
+					map[string]any{
+						"error":   err.Error(),
+						"channel": msg.Channel,
+					})
+				return false
+			}
+			return true
+		}
+	}
+	sched.submit(key, al.messagePriority(msg), msg, steer)
+}
 
-					continued, continueErr := al.Continue(ctx, target.SessionKey, target.Channel, target.ChatID)
-					if continueErr != nil {
-						logger.WarnCF("agent", "Failed to continue queued steering after shutdown drain",
-							map[string]any{
-								"channel": target.Channel,
-								"chat_id": target.ChatID,
-								"error":   continueErr.Error(),
-							})
-						return
-					}
-					if continued == "" {
-						break
-					}
+// runScheduledSession runs the turn for msg and then releases the session.
+// Steering that reached the session after the turn's last check is continued
+// before the session is released.
+func (al *AgentLoop) runScheduledSession(
+	ctx context.Context,
+	sched *turnScheduler,
+	sess *scheduledSession,
+	msg bus.InboundMessage,
+) {
+	if task := sess.task; task != nil {
+		task(ctx)
+		sched.finish(sess, func() bool { return false })
+		return
+	}
 
-					finalResponse = continued
-				}
+	al.handleInboundMessage(ctx, msg)
 
-				if finalResponse != "" {
-					al.publishResponseIfNeeded(ctx, target.Channel, target.ChatID, finalResponse)
-				}
-			}()
-		default:
-			time.Sleep(time.Microsecond * 200)
+	target, err := al.buildContinuationTarget(msg)
+	lateSteering := func() bool {
+		return err == nil && target != nil && al.pendingSteeringCountForScope(target.SessionKey) > 0
+	}
+	for sched.finish(sess, lateSteering) {
+		if !al.continueAndPublish(ctx, msg, "") {
+			// Continuing failed; release the session rather than retry.
+			sched.finish(sess, func() bool { return false })
+			return
 		}
 	}
-
-	return nil
 }
 
-// drainBusToSteering consumes inbound messages and redirects messages from the
-// active scope into the steering queue. Messages from other scopes are requeued
-// so they can be processed normally after the active turn. It drains all
-// immediately available messages, blocking for the first one until ctx is done.
-func (al *AgentLoop) drainBusToSteering(ctx context.Context, activeScope, activeAgentID string) {
-	blocking := true
-	for {
-		var msg bus.InboundMessage
-
-		if blocking {
-			// Block waiting for the first available message or ctx cancellation.
-			select {
-			case <-ctx.Done():
-				return
-			case m, ok := <-al.bus.InboundChan():
-				if !ok {
-					return
-				}
-				msg = m
-			}
-		} else {
-			// Non-blocking: drain any remaining queued messages, return when empty.
-			select {
-			case m, ok := <-al.bus.InboundChan():
-				if !ok {
-					return
-				}
-				msg = m
-			default:
-				return
-			}
+// handleInboundMessage processes one inbound message, continues with any
+// steering queued for its session meanwhile, and publishes the response.
+func (al *AgentLoop) handleInboundMessage(ctx context.Context, msg bus.InboundMessage) {
+	defer func() {
+		if al.channelManager != nil {
+			al.channelManager.InvokeTypingStop(msg.Channel, msg.ChatID)
 		}
-		blocking = false
+	}()
+	// TODO: Re-enable media cleanup after inbound media is properly consumed by the agent.
+	// Currently disabled because files are deleted before the LLM can access their content.
+	// defer func() {
+	// 	if al.mediaStore != nil && msg.MediaScope != "" {
+	// 		if releaseErr := al.mediaStore.ReleaseAll(msg.MediaScope); releaseErr != nil {
+	// 			logger.WarnCF("agent", "Failed to release media", map[string]any{
+	// 				"scope": msg.MediaScope,
+	// 				"error": releaseErr.Error(),
+	// 			})
+	// 		}
+	// 	}
+	// }()
+
+	response, err := al.processMessage(ctx, msg)
+	if err != nil {
+		response = fmt.Sprintf("Error processing message: %v", err)
+	}
+	al.continueAndPublish(ctx, msg, response)
+}
 
-		msgScope, _, scopeOK := al.resolveSteeringTarget(msg)
-		if !scopeOK || msgScope != activeScope {
-			if err := al.requeueInboundMessage(msg); err != nil {
-				logger.WarnCF("agent", "Failed to requeue non-steering inbound message", map[string]any{
-					"error":     err.Error(),
-					"channel":   msg.Channel,
-					"sender_id": msg.SenderID,
-				})
-			}
-			continue
+// continueAndPublish runs continuation turns while steering is queued for the
+// message's session and publishes the last response. It reports false when a
+// continuation could not be run.
+func (al *AgentLoop) continueAndPublish(ctx context.Context, msg bus.InboundMessage, finalResponse string) bool {
+	target, targetErr := al.buildContinuationTarget(msg)
+	if targetErr != nil {
+		logger.WarnCF("agent", "Failed to build steering continuation target",
+			map[string]any{
+				"channel": msg.Channel,
+				"error":   targetErr.Error(),
+			})
+		return false
+	}
+	if target == nil {
+		if finalResponse != "" {
+			sessionKey, _, _ := al.scheduleKey(msg)
+			al.publishResponseIfNeeded(ctx, sessionKey, msg.Channel, msg.ChatID, finalResponse)
 		}
+		return true
+	}
 
-		// Transcribe audio if needed before steering, so the agent sees text.
-		msg, _ = al.transcribeAudioInMessage(ctx, msg)
-
-		logger.InfoCF("agent", "Redirecting inbound message to steering queue",
+	for al.pendingSteeringCountForScope(target.SessionKey) > 0 {
+		logger.InfoCF("agent", "Continuing queued steering after turn end",
 			map[string]any{
-				"channel":     msg.Channel,
-				"sender_id":   msg.SenderID,
-				"content_len": len(msg.Content),
-				"scope":       activeScope,
+				"channel":     target.Channel,
+				"chat_id":     target.ChatID,
+				"session_key": target.SessionKey,
+				"queue_depth": al.pendingSteeringCountForScope(target.SessionKey),
 			})
 
-		if err := al.enqueueSteeringMessage(activeScope, activeAgentID, providers.Message{
-			Role:    "user",
-			Content: msg.Content,
-			Media:   append([]string(nil), msg.Media...),
-		}); err != nil {
-			logger.WarnCF("agent", "Failed to steer message, will be lost",
+		continued, continueErr := al.Continue(ctx, target.SessionKey, target.Channel, target.ChatID)
+		if continueErr != nil {
+			logger.WarnCF("agent", "Failed to continue queued steering",
 				map[string]any{
-					"error":   err.Error(),
-					"channel": msg.Channel,
+					"channel": target.Channel,
+					"chat_id": target.ChatID,
+					"error":   continueErr.Error(),
 				})
+			return false
+		}
+		if continued == "" {
+			return true
 		}
+
+		finalResponse = continued
+	}
+
+	if finalResponse != "" {
+		al.publishResponseIfNeeded(ctx, target.SessionKey, target.Channel, target.ChatID, finalResponse)
 	}
+	return true
 }
 
 func (al *AgentLoop) Stop() {
 	al.running.Store(false)
 }
 
-func (al *AgentLoop) publishResponseIfNeeded(ctx context.Context, channel, chatID, response string) {
+func (al *AgentLoop) publishResponseIfNeeded(ctx context.Context, sessionKey, channel, chatID, response string) {
 	if response == "" {
 		return
 	}
 
 	alreadySent := false
-	defaultAgent := al.GetRegistry().GetDefaultAgent()
-	if defaultAgent != nil {
-		if tool, ok := defaultAgent.Tools.Get("message"); ok {
+	if agent := al.agentForSession(sessionKey); agent != nil {
+		if tool, ok := agent.Tools.Get("message"); ok {
 			if mt, ok := tool.(*tools.MessageTool); ok {
-				alreadySent = mt.HasSentInRound()
+				alreadySent = mt.HasSentInRound(sessionKey)
 			}
 		}
 	}
@@ -670,6 +709,9 @@ func (al *AgentLoop) Close() {
 	}
 
 	al.GetRegistry().Close()
+	if err := al.usage.Flush(); err != nil {
+		logger.WarnCF("agent", "Failed to save usage", map[string]any{"error": err.Error()})
+	}
 	if al.hooks != nil {
 		al.hooks.Close()
 	}
@@ -831,6 +873,8 @@ func (al *AgentLoop) logEvent(evt Event) {
 		fields["messages"] = payload.MessagesCount
 		fields["tools"] = payload.ToolsCount
 		fields["max_tokens"] = payload.MaxTokens
+		fields["thinking_level"] = payload.ThinkingLevel
+		fields["thinking_source"] = payload.ThinkingSource
 	case LLMDeltaPayload:
 		fields["content_delta_len"] = payload.ContentDeltaLen
 		fields["reasoning_delta_len"] = payload.ReasoningDeltaLen
@@ -846,8 +890,12 @@ func (al *AgentLoop) logEvent(evt Event) {
 		fields["backoff_ms"] = payload.Backoff.Milliseconds()
 	case ContextCompressPayload:
 		fields["reason"] = payload.Reason
+		fields["strategy"] = payload.Strategy
 		fields["dropped_messages"] = payload.DroppedMessages
 		fields["remaining_messages"] = payload.RemainingMessages
+		fields["elided_results"] = payload.ElidedResults
+		fields["tokens_before"] = payload.TokensBefore
+		fields["tokens_after"] = payload.TokensAfter
 	case SessionSummarizePayload:
 		fields["summarized_messages"] = payload.SummarizedMessages
 		fields["kept_messages"] = payload.KeptMessages
@@ -885,6 +933,7 @@ func (al *AgentLoop) logEvent(evt Event) {
 		fields["label"] = payload.Label
 	case SubTurnEndPayload:
 		fields["child_agent_id"] = payload.AgentID
+		fields["label"] = payload.Label
 		fields["status"] = payload.Status
 	case SubTurnResultDeliveredPayload:
 		fields["target_channel"] = payload.TargetChannel
@@ -1202,6 +1251,19 @@ func (al *AgentLoop) ProcessDirect(
 func (al *AgentLoop) ProcessDirectWithChannel(
 	ctx context.Context,
 	content, sessionKey, channel, chatID string,
+) (string, error) {
+	return al.ProcessDirectWithSchema(ctx, content, sessionKey, channel, chatID, nil)
+}
+
+// ProcessDirectWithSchema is ProcessDirectWithChannel for callers that need
+// machine-readable output: the final answer must match schema, or the
+// routed agent's configured response_schema when schema is nil. The
+// returned content is the validated JSON document. When the model keeps
+// answering with invalid output, the error is a *StructuredOutputError.
+func (al *AgentLoop) ProcessDirectWithSchema(
+	ctx context.Context,
+	content, sessionKey, channel, chatID string,
+	schema *ResponseSchema,
 ) (string, error) {
 	if err := al.ensureHooksInitialized(ctx); err != nil {
 		return "", err
@@ -1218,7 +1280,7 @@ func (al *AgentLoop) ProcessDirectWithChannel(
 		SessionKey: sessionKey,
 	}
 
-	return al.processMessage(ctx, msg)
+	return al.processInbound(ctx, msg, &directCall{responseSchema: schema})
 }
 
 // ProcessHeartbeat processes a heartbeat request without session history.
@@ -1250,7 +1312,18 @@ func (al *AgentLoop) ProcessHeartbeat(
 	})
 }
 
+// directCall carries the options of a ProcessDirect* call.
+type directCall struct {
+	responseSchema *ResponseSchema
+}
+
 func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage) (string, error) {
+	return al.processInbound(ctx, msg, nil)
+}
+
+// processInbound processes one inbound message. direct is non-nil for
+// ProcessDirect* calls.
+func (al *AgentLoop) processInbound(ctx context.Context, msg bus.InboundMessage, direct *directCall) (string, error) {
 	// Add message preview to log (show full content for error messages)
 	var logContent string
 	if strings.Contains(msg.Content, "Error:") || strings.Contains(msg.Content, "error") {
@@ -1288,17 +1361,17 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		return "", routeErr
 	}
 
+	// Resolve session key from route, while preserving explicit agent-scoped keys.
+	scopeKey := resolveScopeKey(route, msg.SessionKey)
+	sessionKey := scopeKey
+
 	// Reset message-tool state for this round so we don't skip publishing due to a previous round.
 	if tool, ok := agent.Tools.Get("message"); ok {
-		if resetter, ok := tool.(interface{ ResetSentInRound() }); ok {
-			resetter.ResetSentInRound()
+		if resetter, ok := tool.(interface{ ResetSentInRound(string) }); ok {
+			resetter.ResetSentInRound(sessionKey)
 		}
 	}
 
-	// Resolve session key from route, while preserving explicit agent-scoped keys.
-	scopeKey := resolveScopeKey(route, msg.SessionKey)
-	sessionKey := scopeKey
-
 	logger.InfoCF("agent", "Routed message",
 		map[string]any{
 			"agent_id":      agent.ID,
@@ -1320,6 +1393,13 @@ func (al *AgentLoop) processMessage(ctx context.Context, msg bus.InboundMessage)
 		DefaultResponse:   defaultResponse,
 		EnableSummary:     true,
 		SendResponse:      false,
+		ToolPolicy:        route.Tools,
+	}
+	if direct != nil {
+		opts.ResponseSchema = direct.responseSchema
+		if opts.ResponseSchema == nil {
+			opts.ResponseSchema = agent.ResponseSchema
+		}
 	}
 
 	// context-dependent commands check their own Runtime fields and report
@@ -1350,6 +1430,7 @@ func (al *AgentLoop) resolveMessageRoute(msg bus.InboundMessage) (routing.Resolv
 		return routing.ResolvedRoute{}, nil, fmt.Errorf("no agent available for route (agent_id=%s)", route.AgentID)
 	}
 
+	route, agent = al.applyHandoff(route, agent)
 	return route, agent, nil
 }
 
@@ -1373,19 +1454,6 @@ func (al *AgentLoop) resolveSteeringTarget(msg bus.InboundMessage) (string, stri
 	return resolveScopeKey(route, msg.SessionKey), agent.ID, true
 }
 
-func (al *AgentLoop) requeueInboundMessage(msg bus.InboundMessage) error {
-	if al.bus == nil {
-		return nil
-	}
-	pubCtx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	return al.bus.PublishOutbound(pubCtx, bus.OutboundMessage{
-		Channel: msg.Channel,
-		ChatID:  msg.ChatID,
-		Content: msg.Content,
-	})
-}
-
 func (al *AgentLoop) processSystemMessage(
 	ctx context.Context,
 	msg bus.InboundMessage,
@@ -1470,6 +1538,8 @@ func (al *AgentLoop) runAgentLoop(
 		}
 	}
 
+	agent = al.applyProfile(agent, opts.SessionKey)
+	agent = restrictTools(agent, tools.PolicyFilter(opts.ToolPolicy))
 	ts := newTurnState(agent, opts, al.newTurnEventScope(agent.ID, opts.SessionKey))
 	result, err := al.runTurn(ctx, ts)
 	if err != nil {
@@ -1567,6 +1637,20 @@ func (al *AgentLoop) handleReasoning(
 	}
 }
 
+// buildMessagesOptions collects the per-request prompt parts of a turn.
+func (al *AgentLoop) buildMessagesOptions(ts *turnState, summary string) BuildMessagesOptions {
+	return BuildMessagesOptions{
+		Summary:           summary,
+		Plan:              al.currentPlanPrompt(ts),
+		Memory:            ts.relevantMemory,
+		Media:             ts.media,
+		Channel:           ts.channel,
+		ChatID:            ts.chatID,
+		SenderID:          ts.opts.SenderID,
+		SenderDisplayName: ts.opts.SenderDisplayName,
+	}
+}
+
 func (al *AgentLoop) runTurn(ctx context.Context, ts *turnState) (turnResult, error) {
 	turnCtx, turnCancel := context.WithCancel(ctx)
 	defer turnCancel()
@@ -1578,9 +1662,11 @@ func (al *AgentLoop) runTurn(ctx context.Context, ts *turnState) (turnResult, er
 
 	al.registerActiveTurn(ts)
 	defer al.clearActiveTurn(ts)
+	defer al.clearTurnCheckpoint(ts)
 
 	turnStatus := TurnEndStatusCompleted
 	defer func() {
+		al.finishTurnTrace(ts, turnStatus)
 		al.emitEvent(
 			EventKindTurnEnd,
 			ts.eventMeta("runTurn", "turn.end"),
@@ -1604,6 +1690,22 @@ func (al *AgentLoop) runTurn(ctx context.Context, ts *turnState) (turnResult, er
 		},
 	)
 
+	var validator *responseValidator
+	var nativeStructured bool
+	if ts.opts.ResponseSchema != nil {
+		v, err := newResponseValidator(ts.opts.ResponseSchema)
+		if err != nil {
+			turnStatus = TurnEndStatusError
+			return turnResult{}, err
+		}
+		validator = v
+		if sc, ok := ts.agent.Provider.(providers.StructuredOutputCapable); ok {
+			nativeStructured = sc.SupportsStructuredOutput()
+		}
+	}
+	structuredAttempts := 0
+	var structuredErr error
+
 	var history []providers.Message
 	var summary string
 	if !ts.opts.NoHistory {
@@ -1611,17 +1713,11 @@ func (al *AgentLoop) runTurn(ctx context.Context, ts *turnState) (turnResult, er
 		summary = ts.agent.Sessions.GetSummary(ts.sessionKey)
 	}
 	ts.captureRestorePoint(history, summary)
+	al.startTurnTrace(ts, history, summary)
+	al.ensureTurnPlan(turnCtx, ts, history, summary)
+	ts.relevantMemory = ts.agent.ContextBuilder.RelevantMemory(turnCtx, ts.userMessage)
 
-	messages := ts.agent.ContextBuilder.BuildMessages(
-		history,
-		summary,
-		ts.userMessage,
-		ts.media,
-		ts.channel,
-		ts.chatID,
-		ts.opts.SenderID,
-		ts.opts.SenderDisplayName,
-	)
+	messages := ts.agent.ContextBuilder.BuildMessages(history, ts.userMessage, al.buildMessagesOptions(ts, summary))
 
 	cfg := al.GetConfig()
 	maxMediaSize := cfg.Agents.Defaults.GetMaxMediaSize()
@@ -1629,27 +1725,19 @@ func (al *AgentLoop) runTurn(ctx context.Context, ts *turnState) (turnResult, er
 
 	if !ts.opts.NoHistory {
 		toolDefs := ts.agent.Tools.ToProviderDefs()
-		if isOverContextBudget(ts.agent.ContextWindow, messages, toolDefs, ts.agent.MaxTokens) {
+		if isOverContextBudget(ts.agent.Tokenizer, ts.agent.ContextWindow, messages, toolDefs, ts.agent.MaxTokens) {
 			logger.WarnCF("agent", "Proactive compression: context budget exceeded before LLM call",
 				map[string]any{"session_key": ts.sessionKey})
-			if compression, ok := al.forceCompression(ts.agent, ts.sessionKey); ok {
-				al.emitEvent(
-					EventKindContextCompress,
-					ts.eventMeta("runTurn", "turn.context.compress"),
-					ContextCompressPayload{
-						Reason:            ContextCompressReasonProactive,
-						DroppedMessages:   compression.DroppedMessages,
-						RemainingMessages: compression.RemainingMessages,
-					},
-				)
+			if _, ok := al.compressContext(
+				ctx, ts.agent, ts.sessionKey, ContextCompressReasonProactive,
+				ts.eventMeta("runTurn", "turn.context.compress"),
+			); ok {
 				ts.refreshRestorePointFromSession(ts.agent)
 			}
 			newHistory := ts.agent.Sessions.GetHistory(ts.sessionKey)
 			newSummary := ts.agent.Sessions.GetSummary(ts.sessionKey)
 			messages = ts.agent.ContextBuilder.BuildMessages(
-				newHistory, newSummary, ts.userMessage,
-				ts.media, ts.channel, ts.chatID,
-				ts.opts.SenderID, ts.opts.SenderDisplayName,
+				newHistory, ts.userMessage, al.buildMessagesOptions(ts, newSummary),
 			)
 			messages = resolveMediaRefs(messages, al.mediaStore, maxMediaSize)
 		}
@@ -1669,8 +1757,14 @@ func (al *AgentLoop) runTurn(ctx context.Context, ts *turnState) (turnResult, er
 		}
 		ts.recordPersistedMessage(rootMsg)
 	}
+	al.saveTurnCheckpoint(ts)
 
-	activeCandidates, activeModel := al.selectCandidates(ts.agent, ts.userMessage, messages)
+	route := al.selectRoute(ts.agent, ts.userMessage, messages)
+	if ts.opts.ThinkingLevel != "" {
+		route.thinking = ts.opts.ThinkingLevel
+		route.thinkingSource = ThinkingSourceCommand
+	}
+	activeCandidates, activeModel := route.candidates, route.model
 	pendingMessages := append([]providers.Message(nil), ts.opts.InitialSteeringMessages...)
 	var finalContent string
 
@@ -1757,6 +1851,7 @@ turnLoop:
 			)
 			pendingMessages = nil
 		}
+		al.saveTurnCheckpoint(ts)
 
 		logger.DebugCF("agent", "LLM iteration",
 			map[string]any{
@@ -1765,6 +1860,9 @@ turnLoop:
 				"max":       ts.agent.MaxIterations,
 			})
 
+		if graceful, _ := ts.gracefulInterruptRequested(); !graceful && ts.tokenBudgetExhausted() {
+			ts.requestGracefulInterrupt("The token budget for this task is spent. Report what you have so far.")
+		}
 		gracefulTerminal, _ := ts.gracefulInterruptRequested()
 		providerToolDefs := ts.agent.Tools.ToProviderDefs()
 
@@ -1792,29 +1890,62 @@ turnLoop:
 		}
 
 		callMessages := messages
+		if ts.truncateContext != nil {
+			callMessages = ts.truncateContext(messages)
+		}
 		if gracefulTerminal {
-			callMessages = append(append([]providers.Message(nil), messages...), ts.interruptHintMessage())
+			callMessages = append(append([]providers.Message(nil), callMessages...), ts.interruptHintMessage())
 			providerToolDefs = nil
 			ts.markGracefulTerminalUsed()
 		}
 
 		llmOpts := map[string]any{
-			"max_tokens":       ts.agent.MaxTokens,
+			"max_tokens":       route.maxTokens,
 			"temperature":      ts.agent.Temperature,
 			"prompt_cache_key": ts.agent.ID,
 		}
 		if useNativeSearch {
 			llmOpts["native_search"] = true
 		}
-		if ts.agent.ThinkingLevel != ThinkingOff {
+		if route.thinking != ThinkingOff {
 			if tc, ok := ts.agent.Provider.(providers.ThinkingCapable); ok && tc.SupportsThinking() {
-				llmOpts["thinking_level"] = string(ts.agent.ThinkingLevel)
+				llmOpts["thinking_level"] = string(route.thinking)
 			} else {
 				logger.WarnCF("agent", "thinking_level is set but current provider does not support it, ignoring",
-					map[string]any{"agent_id": ts.agent.ID, "thinking_level": string(ts.agent.ThinkingLevel)})
+					map[string]any{"agent_id": ts.agent.ID, "thinking_level": string(route.thinking)})
+			}
+		}
+		if validator != nil {
+			if nativeStructured {
+				llmOpts["response_format"] = validator.responseFormat()
+			} else {
+				callMessages = validator.withInstruction(callMessages)
 			}
 		}
 
+		if limitErr := al.checkUsageLimit(ts.sessionKey); limitErr != nil {
+			candidates, model := al.downgradeCandidates()
+			if len(candidates) == 0 {
+				turnStatus = TurnEndStatusError
+				al.emitEvent(
+					EventKindError,
+					ts.eventMeta("runTurn", "turn.error"),
+					ErrorPayload{
+						Stage:   "usage_limit",
+						Message: limitErr.Error(),
+					},
+				)
+				logger.WarnCF("agent", "Spending cap reached, refusing request",
+					map[string]any{"agent_id": ts.agent.ID, "session_key": ts.sessionKey, "error": limitErr.Error()})
+				return turnResult{}, limitErr
+			}
+			if model != activeModel {
+				logger.InfoCF("agent", "Spending cap reached, downgrading model",
+					map[string]any{"agent_id": ts.agent.ID, "from": activeModel, "to": model})
+			}
+			activeCandidates, activeModel = candidates, model
+		}
+
 		llmModel := activeModel
 		if al.hooks != nil {
 			llmReq, decision := al.hooks.BeforeLLM(turnCtx, &LLMHookRequest{
@@ -1849,11 +1980,14 @@ turnLoop:
 			EventKindLLMRequest,
 			ts.eventMeta("runTurn", "turn.llm.request"),
 			LLMRequestPayload{
-				Model:         llmModel,
-				MessagesCount: len(callMessages),
-				ToolsCount:    len(providerToolDefs),
-				MaxTokens:     ts.agent.MaxTokens,
-				Temperature:   ts.agent.Temperature,
+				Model:          llmModel,
+				MessagesCount:  len(callMessages),
+				ToolsCount:     len(providerToolDefs),
+				MaxTokens:      route.maxTokens,
+				Temperature:    ts.agent.Temperature,
+				ThinkingLevel:  string(route.thinking),
+				ThinkingSource: route.thinkingSource,
+				RoutingScore:   route.score,
 			},
 		)
 
@@ -1864,7 +1998,8 @@ turnLoop:
 				"model":             llmModel,
 				"messages_count":    len(callMessages),
 				"tools_count":       len(providerToolDefs),
-				"max_tokens":        ts.agent.MaxTokens,
+				"max_tokens":        route.maxTokens,
+				"thinking_level":    string(route.thinking),
 				"temperature":       ts.agent.Temperature,
 				"system_prompt_len": len(callMessages[0].Content),
 			})
@@ -1875,6 +2010,9 @@ turnLoop:
 				"tools_json":    formatToolsForLog(providerToolDefs),
 			})
 
+		// callModel is the model that produced the response, which differs
+		// from llmModel when a fallback candidate answered.
+		callModel := llmModel
 		callLLM := func(messagesForCall []providers.Message, toolDefsForCall []providers.ToolDefinition) (*providers.LLMResponse, error) {
 			providerCtx, providerCancel := context.WithCancel(turnCtx)
 			ts.setProviderCancel(providerCancel)
@@ -1897,6 +2035,9 @@ turnLoop:
 				if fbErr != nil {
 					return nil, fbErr
 				}
+				if fbResult.Model != "" {
+					callModel = fbResult.Model
+				}
 				if fbResult.Provider != "" && len(fbResult.Attempts) > 0 {
 					logger.InfoCF(
 						"agent",
@@ -1997,29 +2138,29 @@ turnLoop:
 					})
 				}
 
-				if compression, ok := al.forceCompression(ts.agent, ts.sessionKey); ok {
-					al.emitEvent(
-						EventKindContextCompress,
-						ts.eventMeta("runTurn", "turn.context.compress"),
-						ContextCompressPayload{
-							Reason:            ContextCompressReasonRetry,
-							DroppedMessages:   compression.DroppedMessages,
-							RemainingMessages: compression.RemainingMessages,
-						},
-					)
+				if _, ok := al.compressContext(
+					ctx, ts.agent, ts.sessionKey, ContextCompressReasonRetry,
+					ts.eventMeta("runTurn", "turn.context.compress"),
+				); ok {
 					ts.refreshRestorePointFromSession(ts.agent)
 				}
 
 				newHistory := ts.agent.Sessions.GetHistory(ts.sessionKey)
 				newSummary := ts.agent.Sessions.GetSummary(ts.sessionKey)
-				messages = ts.agent.ContextBuilder.BuildMessages(
-					newHistory, newSummary, "",
-					nil, ts.channel, ts.chatID,
-					"", "", // Empty SenderID and SenderDisplayName for retry
-				)
+				// The retry leaves out the user message, its media and the sender.
+				messages = ts.agent.ContextBuilder.BuildMessages(newHistory, "", BuildMessagesOptions{
+					Summary: newSummary,
+					Plan:    al.currentPlanPrompt(ts),
+					Memory:  ts.relevantMemory,
+					Channel: ts.channel,
+					ChatID:  ts.chatID,
+				})
 				callMessages = messages
 				if gracefulTerminal {
-					callMessages = append(append([]providers.Message(nil), messages...), ts.interruptHintMessage())
+					callMessages = append(append([]providers.Message(nil), callMessages...), ts.interruptHintMessage())
+				}
+				if validator != nil && !nativeStructured {
+					callMessages = validator.withInstruction(callMessages)
 				}
 				continue
 			}
@@ -2046,6 +2187,13 @@ turnLoop:
 			return turnResult{}, fmt.Errorf("LLM call failed after retries: %w", err)
 		}
 
+		ts.traceLLMCall(iteration, llmModel, callMessages, providerToolDefs, response)
+		al.recordUsage(ts.agent, ts.sessionKey, ts.channel, callModel, response.Usage)
+		ts.spendTokenBudget(response.Usage, callMessages, response.Content)
+		if ts.onProgress != nil && strings.TrimSpace(response.Content) != "" {
+			ts.onProgress(response.Content)
+		}
+
 		if al.hooks != nil {
 			llmResp, decision := al.hooks.AfterLLM(turnCtx, &LLMHookResponse{
 				Meta:     ts.eventMeta("runTurn", "turn.llm.response"),
@@ -2120,6 +2268,29 @@ turnLoop:
 				pendingMessages = append(pendingMessages, steerMsgs...)
 				continue
 			}
+			if validator != nil {
+				validated, verr := validator.Validate(responseContent)
+				structuredAttempts++
+				structuredErr = verr
+				if verr == nil {
+					responseContent = validated
+				} else if !gracefulTerminal && structuredAttempts <= maxStructuredOutputRepairs {
+					// The repair exchange stays out of the session; only the
+					// final, valid answer is persisted.
+					logger.WarnCF("agent", "Response does not match schema, asking the model to repair it",
+						map[string]any{
+							"agent_id":  ts.agent.ID,
+							"iteration": iteration,
+							"attempt":   structuredAttempts,
+							"error":     verr.Error(),
+						})
+					messages = append(messages,
+						providers.Message{Role: "assistant", Content: responseContent},
+						validator.repairMessage(verr),
+					)
+					continue
+				}
+			}
 			finalContent = responseContent
 			logger.InfoCF("agent", "LLM response without tool calls (direct answer)",
 				map[string]any{
@@ -2179,287 +2350,254 @@ turnLoop:
 		}
 
 		ts.setPhase(TurnPhaseTools)
-		for i, tc := range normalizedToolCalls {
-			if ts.hardAbortRequested() {
-				turnStatus = TurnEndStatusAborted
-				return al.abortTurn(ts)
-			}
-
-			toolName := tc.Name
-			toolArgs := cloneStringAnyMap(tc.Arguments)
-
-			if al.hooks != nil {
-				toolReq, decision := al.hooks.BeforeTool(turnCtx, &ToolCallHookRequest{
-					Meta:      ts.eventMeta("runTurn", "turn.tool.before"),
-					Tool:      toolName,
-					Arguments: toolArgs,
-					Channel:   ts.channel,
-					ChatID:    ts.chatID,
-				})
-				switch decision.normalizedAction() {
-				case HookActionContinue, HookActionModify:
-					if toolReq != nil {
-						toolName = toolReq.Tool
-						toolArgs = toolReq.Arguments
-					}
-				case HookActionDenyTool:
-					denyContent := hookDeniedToolContent("Tool execution denied by hook", decision.Reason)
-					al.emitEvent(
-						EventKindToolExecSkipped,
-						ts.eventMeta("runTurn", "turn.tool.skipped"),
-						ToolExecSkippedPayload{
-							Tool:   toolName,
-							Reason: denyContent,
-						},
-					)
-					deniedMsg := providers.Message{
-						Role:       "tool",
-						Content:    denyContent,
-						ToolCallID: tc.ID,
-					}
-					messages = append(messages, deniedMsg)
-					if !ts.opts.NoHistory {
-						ts.agent.Sessions.AddFullMessage(ts.sessionKey, deniedMsg)
-						ts.recordPersistedMessage(deniedMsg)
-					}
-					continue
-				case HookActionAbortTurn:
-					turnStatus = TurnEndStatusError
-					return turnResult{}, al.hookAbortError(ts, "before_tool", decision)
-				case HookActionHardAbort:
-					_ = ts.requestHardAbort()
+		ts.setPendingToolCalls(assistantMsg.ToolCalls)
+		al.saveTurnCheckpoint(ts)
+		maxParallelTools := al.cfg.Agents.Defaults.GetMaxParallelTools()
+		for i := 0; i < len(normalizedToolCalls); {
+			batchEnd := toolBatchEnd(ts.agent.Tools, normalizedToolCalls, i, maxParallelTools)
+			runs := make([]*toolCallRun, 0, batchEnd-i)
+
+			for _, tc := range normalizedToolCalls[i:batchEnd] {
+				if ts.hardAbortRequested() {
 					turnStatus = TurnEndStatusAborted
 					return al.abortTurn(ts)
 				}
-			}
 
-			if al.hooks != nil {
-				approval := al.hooks.ApproveTool(turnCtx, &ToolApprovalRequest{
-					Meta:      ts.eventMeta("runTurn", "turn.tool.approve"),
-					Tool:      toolName,
-					Arguments: toolArgs,
-					Channel:   ts.channel,
-					ChatID:    ts.chatID,
-				})
-				if !approval.Approved {
-					denyContent := hookDeniedToolContent("Tool execution denied by approval hook", approval.Reason)
-					al.emitEvent(
-						EventKindToolExecSkipped,
-						ts.eventMeta("runTurn", "turn.tool.skipped"),
-						ToolExecSkippedPayload{
-							Tool:   toolName,
-							Reason: denyContent,
-						},
-					)
-					deniedMsg := providers.Message{
-						Role:       "tool",
-						Content:    denyContent,
-						ToolCallID: tc.ID,
-					}
-					messages = append(messages, deniedMsg)
-					if !ts.opts.NoHistory {
-						ts.agent.Sessions.AddFullMessage(ts.sessionKey, deniedMsg)
-						ts.recordPersistedMessage(deniedMsg)
-					}
-					continue
+				run := &toolCallRun{
+					tc:   tc,
+					name: tc.Name,
+					args: cloneStringAnyMap(tc.Arguments),
 				}
-			}
-
-			argsJSON, _ := json.Marshal(toolArgs)
-			argsPreview := utils.Truncate(string(argsJSON), 200)
-			logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", toolName, argsPreview),
-				map[string]any{
-					"agent_id":  ts.agent.ID,
-					"tool":      toolName,
-					"iteration": iteration,
-				})
-			al.emitEvent(
-				EventKindToolExecStart,
-				ts.eventMeta("runTurn", "turn.tool.start"),
-				ToolExecStartPayload{
-					Tool:      toolName,
-					Arguments: cloneEventArguments(toolArgs),
-				},
-			)
-
-			// Send tool feedback to chat channel if enabled (from HEAD)
-			if al.cfg.Agents.Defaults.IsToolFeedbackEnabled() && ts.channel != "" {
-				feedbackPreview := utils.Truncate(
-					string(argsJSON),
-					al.cfg.Agents.Defaults.GetToolFeedbackMaxArgsLength(),
-				)
-				feedbackMsg := fmt.Sprintf("\U0001f527 `%s`\n```\n%s\n```", tc.Name, feedbackPreview)
-				fbCtx, fbCancel := context.WithTimeout(turnCtx, 3*time.Second)
-				_ = al.bus.PublishOutbound(fbCtx, bus.OutboundMessage{
-					Channel: ts.channel,
-					ChatID:  ts.chatID,
-					Content: feedbackMsg,
-				})
-				fbCancel()
-			}
-
-			toolCallID := tc.ID
-			toolIteration := iteration
-			asyncToolName := toolName
-			asyncCallback := func(_ context.Context, result *tools.ToolResult) {
-				// Send ForUser content directly to the user (immediate feedback),
-				// mirroring the synchronous tool execution path.
-				if !result.Silent && result.ForUser != "" {
-					outCtx, outCancel := context.WithTimeout(context.Background(), 5*time.Second)
-					defer outCancel()
-					_ = al.bus.PublishOutbound(outCtx, bus.OutboundMessage{
-						Channel: ts.channel,
-						ChatID:  ts.chatID,
-						Content: result.ForUser,
+				runs = append(runs, run)
+
+				if al.hooks != nil {
+					toolReq, decision := al.hooks.BeforeTool(turnCtx, &ToolCallHookRequest{
+						Meta:      ts.eventMeta("runTurn", "turn.tool.before"),
+						Tool:      run.name,
+						Arguments: run.args,
+						Channel:   ts.channel,
+						ChatID:    ts.chatID,
 					})
+					switch decision.normalizedAction() {
+					case HookActionContinue, HookActionModify:
+						if toolReq != nil {
+							run.name = toolReq.Tool
+							run.args = toolReq.Arguments
+						}
+					case HookActionDenyTool:
+						denyContent := hookDeniedToolContent("Tool execution denied by hook", decision.Reason)
+						al.emitEvent(
+							EventKindToolExecSkipped,
+							ts.eventMeta("runTurn", "turn.tool.skipped"),
+							ToolExecSkippedPayload{
+								Tool:   run.name,
+								Reason: denyContent,
+							},
+						)
+						run.denied = &providers.Message{
+							Role:       "tool",
+							Content:    denyContent,
+							ToolCallID: tc.ID,
+						}
+						continue
+					case HookActionAbortTurn:
+						turnStatus = TurnEndStatusError
+						return turnResult{}, al.hookAbortError(ts, "before_tool", decision)
+					case HookActionHardAbort:
+						_ = ts.requestHardAbort()
+						turnStatus = TurnEndStatusAborted
+						return al.abortTurn(ts)
+					}
 				}
 
-				// Determine content for the agent loop (ForLLM or error).
-				content := result.ForLLM
-				if content == "" && result.Err != nil {
-					content = result.Err.Error()
-				}
-				if content == "" {
-					return
+				if al.hooks != nil {
+					approval := al.hooks.ApproveTool(turnCtx, &ToolApprovalRequest{
+						Meta:      ts.eventMeta("runTurn", "turn.tool.approve"),
+						Tool:      run.name,
+						Arguments: run.args,
+						Channel:   ts.channel,
+						ChatID:    ts.chatID,
+						SenderID:  ts.opts.SenderID,
+					})
+					if !approval.Approved {
+						denyContent := hookDeniedToolContent("Tool execution denied by approval hook", approval.Reason)
+						al.emitEvent(
+							EventKindToolExecSkipped,
+							ts.eventMeta("runTurn", "turn.tool.skipped"),
+							ToolExecSkippedPayload{
+								Tool:   run.name,
+								Reason: denyContent,
+							},
+						)
+						run.denied = &providers.Message{
+							Role:       "tool",
+							Content:    denyContent,
+							ToolCallID: tc.ID,
+						}
+						continue
+					}
 				}
 
-				logger.InfoCF("agent", "Async tool completed, publishing result",
+				argsJSON, _ := json.Marshal(run.args)
+				argsPreview := utils.Truncate(string(argsJSON), 200)
+				logger.InfoCF("agent", fmt.Sprintf("Tool call: %s(%s)", run.name, argsPreview),
 					map[string]any{
-						"tool":        asyncToolName,
-						"content_len": len(content),
-						"channel":     ts.channel,
+						"agent_id":  ts.agent.ID,
+						"tool":      run.name,
+						"iteration": iteration,
 					})
 				al.emitEvent(
-					EventKindFollowUpQueued,
-					ts.scope.meta(toolIteration, "runTurn", "turn.follow_up.queued"),
-					FollowUpQueuedPayload{
-						SourceTool: asyncToolName,
-						Channel:    ts.channel,
-						ChatID:     ts.chatID,
-						ContentLen: len(content),
+					EventKindToolExecStart,
+					ts.eventMeta("runTurn", "turn.tool.start"),
+					ToolExecStartPayload{
+						Tool:      run.name,
+						Arguments: cloneEventArguments(run.args),
 					},
 				)
 
-				pubCtx, pubCancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer pubCancel()
-				_ = al.bus.PublishInbound(pubCtx, bus.InboundMessage{
-					Channel:  "system",
-					SenderID: fmt.Sprintf("async:%s", asyncToolName),
-					ChatID:   fmt.Sprintf("%s:%s", ts.channel, ts.chatID),
-					Content:  content,
-				})
-			}
-
-			toolStart := time.Now()
-			toolResult := ts.agent.Tools.ExecuteWithContext(
-				turnCtx,
-				toolName,
-				toolArgs,
-				ts.channel,
-				ts.chatID,
-				asyncCallback,
-			)
-			toolDuration := time.Since(toolStart)
+				// Send tool feedback to chat channel if enabled (from HEAD)
+				if al.cfg.Agents.Defaults.IsToolFeedbackEnabled() && ts.channel != "" {
+					feedbackPreview := utils.Truncate(
+						string(argsJSON),
+						al.cfg.Agents.Defaults.GetToolFeedbackMaxArgsLength(),
+					)
+					feedbackMsg := fmt.Sprintf("\U0001f527 `%s`\n```\n%s\n```", tc.Name, feedbackPreview)
+					fbCtx, fbCancel := context.WithTimeout(turnCtx, 3*time.Second)
+					_ = al.bus.PublishOutbound(fbCtx, bus.OutboundMessage{
+						Channel: ts.channel,
+						ChatID:  ts.chatID,
+						Content: feedbackMsg,
+					})
+					fbCancel()
+				}
 
-			if ts.hardAbortRequested() {
-				turnStatus = TurnEndStatusAborted
-				return al.abortTurn(ts)
+				run.callback = al.newAsyncToolCallback(ts, run.name, iteration)
 			}
 
-			if al.hooks != nil {
-				toolResp, decision := al.hooks.AfterTool(turnCtx, &ToolResultHookResponse{
-					Meta:      ts.eventMeta("runTurn", "turn.tool.after"),
-					Tool:      toolName,
-					Arguments: toolArgs,
-					Result:    toolResult,
-					Duration:  toolDuration,
-					Channel:   ts.channel,
-					ChatID:    ts.chatID,
-				})
-				switch decision.normalizedAction() {
-				case HookActionContinue, HookActionModify:
-					if toolResp != nil {
-						if toolResp.Tool != "" {
-							toolName = toolResp.Tool
-						}
-						if toolResp.Result != nil {
-							toolResult = toolResp.Result
-						}
+			al.executeToolRuns(turnCtx, ts, runs, maxParallelTools)
+
+			// Results go into history in call order, however execution interleaved.
+			for _, run := range runs {
+				if run.denied != nil {
+					deniedMsg := *run.denied
+					messages = append(messages, deniedMsg)
+					if !ts.opts.NoHistory {
+						ts.agent.Sessions.AddFullMessage(ts.sessionKey, deniedMsg)
+						ts.recordPersistedMessage(deniedMsg)
 					}
-				case HookActionAbortTurn:
-					turnStatus = TurnEndStatusError
-					return turnResult{}, al.hookAbortError(ts, "after_tool", decision)
-				case HookActionHardAbort:
-					_ = ts.requestHardAbort()
+					ts.recordCompletedToolResult(deniedMsg)
+					al.saveTurnCheckpoint(ts)
+					continue
+				}
+
+				toolName := run.name
+				toolResult := run.result
+				toolDuration := run.duration
+				ts.traceToolCall(iteration, run.tc.ID, toolName, run.args, toolResult)
+
+				if ts.hardAbortRequested() {
 					turnStatus = TurnEndStatusAborted
 					return al.abortTurn(ts)
 				}
-			}
 
-			if toolResult == nil {
-				toolResult = tools.ErrorResult("hook returned nil tool result")
-			}
+				if al.hooks != nil {
+					toolResp, decision := al.hooks.AfterTool(turnCtx, &ToolResultHookResponse{
+						Meta:      ts.eventMeta("runTurn", "turn.tool.after"),
+						Tool:      toolName,
+						Arguments: run.args,
+						Result:    toolResult,
+						Duration:  toolDuration,
+						Channel:   ts.channel,
+						ChatID:    ts.chatID,
+					})
+					switch decision.normalizedAction() {
+					case HookActionContinue, HookActionModify:
+						if toolResp != nil {
+							if toolResp.Tool != "" {
+								toolName = toolResp.Tool
+							}
+							if toolResp.Result != nil {
+								toolResult = toolResp.Result
+							}
+						}
+					case HookActionAbortTurn:
+						turnStatus = TurnEndStatusError
+						return turnResult{}, al.hookAbortError(ts, "after_tool", decision)
+					case HookActionHardAbort:
+						_ = ts.requestHardAbort()
+						turnStatus = TurnEndStatusAborted
+						return al.abortTurn(ts)
+					}
+				}
 
-			if !toolResult.Silent && toolResult.ForUser != "" && ts.opts.SendResponse {
-				al.bus.PublishOutbound(ctx, bus.OutboundMessage{
-					Channel: ts.channel,
-					ChatID:  ts.chatID,
-					Content: toolResult.ForUser,
-				})
-				logger.DebugCF("agent", "Sent tool result to user",
-					map[string]any{
-						"tool":        toolName,
-						"content_len": len(toolResult.ForUser),
+				if toolResult == nil {
+					toolResult = tools.ErrorResult("hook returned nil tool result")
+				}
+
+				if !toolResult.Silent && toolResult.ForUser != "" && ts.opts.SendResponse {
+					al.bus.PublishOutbound(ctx, bus.OutboundMessage{
+						Channel: ts.channel,
+						ChatID:  ts.chatID,
+						Content: toolResult.ForUser,
 					})
-			}
+					logger.DebugCF("agent", "Sent tool result to user",
+						map[string]any{
+							"tool":        toolName,
+							"content_len": len(toolResult.ForUser),
+						})
+				}
 
-			if len(toolResult.Media) > 0 {
-				parts := make([]bus.MediaPart, 0, len(toolResult.Media))
-				for _, ref := range toolResult.Media {
-					part := bus.MediaPart{Ref: ref}
-					if al.mediaStore != nil {
-						if _, meta, err := al.mediaStore.ResolveWithMeta(ref); err == nil {
-							part.Filename = meta.Filename
-							part.ContentType = meta.ContentType
-							part.Type = inferMediaType(meta.Filename, meta.ContentType)
+				if len(toolResult.Media) > 0 {
+					parts := make([]bus.MediaPart, 0, len(toolResult.Media))
+					for _, ref := range toolResult.Media {
+						part := bus.MediaPart{Ref: ref}
+						if al.mediaStore != nil {
+							if _, meta, err := al.mediaStore.ResolveWithMeta(ref); err == nil {
+								part.Filename = meta.Filename
+								part.ContentType = meta.ContentType
+								part.Type = inferMediaType(meta.Filename, meta.ContentType)
+							}
 						}
+						parts = append(parts, part)
 					}
-					parts = append(parts, part)
+					al.bus.PublishOutboundMedia(ctx, bus.OutboundMediaMessage{
+						Channel: ts.channel,
+						ChatID:  ts.chatID,
+						Parts:   parts,
+					})
 				}
-				al.bus.PublishOutboundMedia(ctx, bus.OutboundMediaMessage{
-					Channel: ts.channel,
-					ChatID:  ts.chatID,
-					Parts:   parts,
-				})
-			}
 
-			contentForLLM := toolResult.ForLLM
-			if contentForLLM == "" && toolResult.Err != nil {
-				contentForLLM = toolResult.Err.Error()
-			}
+				contentForLLM := toolResult.ForLLM
+				if contentForLLM == "" && toolResult.Err != nil {
+					contentForLLM = toolResult.Err.Error()
+				}
 
-			toolResultMsg := providers.Message{
-				Role:       "tool",
-				Content:    contentForLLM,
-				ToolCallID: toolCallID,
-			}
-			al.emitEvent(
-				EventKindToolExecEnd,
-				ts.eventMeta("runTurn", "turn.tool.end"),
-				ToolExecEndPayload{
-					Tool:       toolName,
-					Duration:   toolDuration,
-					ForLLMLen:  len(contentForLLM),
-					ForUserLen: len(toolResult.ForUser),
-					IsError:    toolResult.IsError,
-					Async:      toolResult.Async,
-				},
-			)
-			messages = append(messages, toolResultMsg)
-			if !ts.opts.NoHistory {
-				ts.agent.Sessions.AddFullMessage(ts.sessionKey, toolResultMsg)
-				ts.recordPersistedMessage(toolResultMsg)
+				toolResultMsg := providers.Message{
+					Role:       "tool",
+					Content:    contentForLLM,
+					ToolCallID: run.tc.ID,
+				}
+				al.emitEvent(
+					EventKindToolExecEnd,
+					ts.eventMeta("runTurn", "turn.tool.end"),
+					ToolExecEndPayload{
+						Tool:       toolName,
+						Duration:   toolDuration,
+						ForLLMLen:  len(contentForLLM),
+						ForUserLen: len(toolResult.ForUser),
+						IsError:    toolResult.IsError,
+						Async:      toolResult.Async,
+					},
+				)
+				messages = append(messages, toolResultMsg)
+				if !ts.opts.NoHistory {
+					ts.agent.Sessions.AddFullMessage(ts.sessionKey, toolResultMsg)
+					ts.recordPersistedMessage(toolResultMsg)
+				}
+				ts.recordCompletedToolResult(toolResultMsg)
+				al.saveTurnCheckpoint(ts)
 			}
+			i = batchEnd
 
 			if steerMsgs := al.dequeueSteeringMessagesForScope(ts.sessionKey); len(steerMsgs) > 0 {
 				pendingMessages = append(pendingMessages, steerMsgs...)
@@ -2476,16 +2614,16 @@ turnLoop:
 			}
 
 			if skipReason != "" {
-				remaining := len(normalizedToolCalls) - i - 1
+				remaining := len(normalizedToolCalls) - i
 				if remaining > 0 {
 					logger.InfoCF("agent", "Turn checkpoint: skipping remaining tools",
 						map[string]any{
 							"agent_id":  ts.agent.ID,
-							"completed": i + 1,
+							"completed": i,
 							"skipped":   remaining,
 							"reason":    skipReason,
 						})
-					for j := i + 1; j < len(normalizedToolCalls); j++ {
+					for j := i; j < len(normalizedToolCalls); j++ {
 						skippedTC := normalizedToolCalls[j]
 						al.emitEvent(
 							EventKindToolExecSkipped,
@@ -2505,7 +2643,9 @@ turnLoop:
 							ts.agent.Sessions.AddFullMessage(ts.sessionKey, skippedMsg)
 							ts.recordPersistedMessage(skippedMsg)
 						}
+						ts.recordCompletedToolResult(skippedMsg)
 					}
+					al.saveTurnCheckpoint(ts)
 				}
 				break
 			}
@@ -2548,6 +2688,28 @@ turnLoop:
 		return al.abortTurn(ts)
 	}
 
+	if validator != nil && (structuredErr != nil || finalContent == "") {
+		if structuredErr == nil {
+			structuredErr = errors.New("no final answer")
+		}
+		soErr := &StructuredOutputError{
+			Schema:   validator.schema.name(),
+			Attempts: structuredAttempts,
+			Content:  finalContent,
+			Err:      structuredErr,
+		}
+		turnStatus = TurnEndStatusError
+		al.emitEvent(
+			EventKindError,
+			ts.eventMeta("runTurn", "turn.error"),
+			ErrorPayload{
+				Stage:   "structured_output",
+				Message: soErr.Error(),
+			},
+		)
+		return turnResult{}, soErr
+	}
+
 	if finalContent == "" {
 		if ts.currentIteration() >= ts.agent.MaxIterations && ts.agent.MaxIterations > 0 {
 			finalContent = toolLimitResponse
@@ -2581,10 +2743,16 @@ turnLoop:
 	}
 
 	ts.setPhase(TurnPhaseCompleted)
+	transcript := messages
+	if len(transcript) > 0 && transcript[0].Role == "system" {
+		transcript = transcript[1:]
+	}
 	return turnResult{
 		finalContent: finalContent,
 		status:       turnStatus,
 		followUps:    append([]bus.InboundMessage(nil), ts.followUps...),
+		messages: append(append([]providers.Message(nil), transcript...),
+			providers.Message{Role: "assistant", Content: finalContent}),
 	}, nil
 }
 
@@ -2618,48 +2786,74 @@ func sleepWithContext(ctx context.Context, d time.Duration) error {
 	}
 }
 
-// selectCandidates returns the model candidates and resolved model name to use
-// for a conversation turn. When model routing is configured and the incoming
-// message scores below the complexity threshold, it returns the light model
-// candidates instead of the primary ones.
+// turnRoute is the model, thinking level and output budget used for all LLM
+// calls of a turn.
+type turnRoute struct {
+	candidates     []providers.FallbackCandidate
+	model          string
+	thinking       ThinkingLevel
+	thinkingSource string // ThinkingSource* constant
+	maxTokens      int
+	score          float64 // routing score; 0 without a router
+}
+
+// selectRoute decides how a conversation turn calls the model. When model
+// routing is configured and the incoming message scores below the complexity
+// threshold, it returns the light model candidates instead of the primary
+// ones. With routing tiers the same score sets the thinking level and
+// max_tokens; otherwise the model's and agent's configuration apply.
 //
-// The returned (candidates, model) pair is used for all LLM calls within one
-// turn — tool follow-up iterations use the same tier as the initial call so
-// that a multi-step tool chain doesn't switch models mid-way.
-func (al *AgentLoop) selectCandidates(
+// The returned route is used for all LLM calls within one turn — tool
+// follow-up iterations use the same tier as the initial call so that a
+// multi-step tool chain doesn't switch models mid-way.
+func (al *AgentLoop) selectRoute(
 	agent *AgentInstance,
 	userMsg string,
 	history []providers.Message,
-) (candidates []providers.FallbackCandidate, model string) {
-	if agent.Router == nil || len(agent.LightCandidates) == 0 {
-		return agent.Candidates, resolvedCandidateModel(agent.Candidates, agent.Model)
+) turnRoute {
+	route := turnRoute{
+		candidates:     agent.Candidates,
+		model:          resolvedCandidateModel(agent.Candidates, agent.Model),
+		thinking:       agent.ThinkingLevel,
+		thinkingSource: ThinkingSourceModel,
+		maxTokens:      agent.MaxTokens,
+	}
+	if agent.Router == nil {
+		return route
 	}
 
-	_, usedLight, score := agent.Router.SelectModel(userMsg, history, agent.Model)
-	if !usedLight {
-		logger.DebugCF("agent", "Model routing: primary model selected",
-			map[string]any{
-				"agent_id":  agent.ID,
-				"score":     score,
-				"threshold": agent.Router.Threshold(),
-			})
-		return agent.Candidates, resolvedCandidateModel(agent.Candidates, agent.Model)
+	d := agent.Router.Decide(userMsg, history, agent.Model)
+	route.score = d.Score
+	if d.ThinkingLevel != "" {
+		route.thinking = parseThinkingLevel(d.ThinkingLevel)
+		route.thinkingSource = ThinkingSourceRouting
+	}
+	if d.MaxTokens > 0 {
+		route.maxTokens = d.MaxTokens
+	}
+	fields := map[string]any{
+		"agent_id":       agent.ID,
+		"score":          d.Score,
+		"threshold":      agent.Router.Threshold(),
+		"thinking_level": string(route.thinking),
+		"max_tokens":     route.maxTokens,
+	}
+	if !d.UsedLight || len(agent.LightCandidates) == 0 {
+		logger.DebugCF("agent", "Model routing: primary model selected", fields)
+		return route
 	}
 
-	logger.InfoCF("agent", "Model routing: light model selected",
-		map[string]any{
-			"agent_id":    agent.ID,
-			"light_model": agent.Router.LightModel(),
-			"score":       score,
-			"threshold":   agent.Router.Threshold(),
-		})
-	return agent.LightCandidates, resolvedCandidateModel(agent.LightCandidates, agent.Router.LightModel())
+	fields["light_model"] = agent.Router.LightModel()
+	logger.InfoCF("agent", "Model routing: light model selected", fields)
+	route.candidates = agent.LightCandidates
+	route.model = resolvedCandidateModel(agent.LightCandidates, agent.Router.LightModel())
+	return route
 }
 
 // maybeSummarize triggers summarization if the session history exceeds thresholds.
 func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey string, turnScope turnEventScope) {
 	newHistory := agent.Sessions.GetHistory(sessionKey)
-	tokenEstimate := al.estimateTokens(newHistory)
+	tokenEstimate := countTokens(agent.Tokenizer, newHistory)
 	threshold := agent.ContextWindow * agent.SummarizeTokenPercent / 100
 
 	if len(newHistory) > agent.SummarizeMessageThreshold || tokenEstimate > threshold {
@@ -2674,12 +2868,8 @@ func (al *AgentLoop) maybeSummarize(agent *AgentInstance, sessionKey string, tur
 	}
 }
 
-type compressionResult struct {
-	DroppedMessages   int
-	RemainingMessages int
-}
-
-// forceCompression aggressively reduces context when the limit is hit.
+// forceCompression aggressively reduces context when the limit is hit. It is
+// the summarize strategy's forced run and the last resort of the others.
 // It drops the oldest ~50% of Turns (a Turn is a complete user→LLM→response
 // cycle, as defined in #1316), so tool-call sequences are never split.
 //
@@ -2691,41 +2881,13 @@ type compressionResult struct {
 // prompt is built dynamically by BuildMessages and is NOT stored here.
 // The compression note is recorded in the session summary so that
 // BuildMessages can include it in the next system prompt.
-func (al *AgentLoop) forceCompression(agent *AgentInstance, sessionKey string) (compressionResult, bool) {
+func (al *AgentLoop) forceCompression(agent *AgentInstance, sessionKey string) (CompressionResult, bool) {
 	history := agent.Sessions.GetHistory(sessionKey)
 	if len(history) <= 2 {
-		return compressionResult{}, false
-	}
-
-	// Split at a Turn boundary so no tool-call sequence is torn apart.
-	// parseTurnBoundaries gives us the start of each Turn; we drop the
-	// oldest half of Turns and keep the most recent ones.
-	turns := parseTurnBoundaries(history)
-	var mid int
-	if len(turns) >= 2 {
-		mid = turns[len(turns)/2]
-	} else {
-		// Fewer than 2 Turns — fall back to message-level midpoint
-		// aligned to the nearest Turn boundary.
-		mid = findSafeBoundary(history, len(history)/2)
-	}
-	var keptHistory []providers.Message
-	if mid <= 0 {
-		// No safe Turn boundary — the entire history is a single Turn
-		// (e.g. one user message followed by a massive tool response).
-		// Keeping everything would leave the agent stuck in a context-
-		// exceeded loop, so fall back to keeping only the most recent
-		// user message. This breaks Turn atomicity as a last resort.
-		for i := len(history) - 1; i >= 0; i-- {
-			if history[i].Role == "user" {
-				keptHistory = []providers.Message{history[i]}
-				break
-			}
-		}
-	} else {
-		keptHistory = history[mid:]
+		return CompressionResult{}, false
 	}
 
+	_, keptHistory := splitForForcedCompression(history)
 	droppedCount := len(history) - len(keptHistory)
 
 	// Record compression in the session summary so BuildMessages includes it
@@ -2749,7 +2911,7 @@ func (al *AgentLoop) forceCompression(agent *AgentInstance, sessionKey string) (
 		"new_count":    len(keptHistory),
 	})
 
-	return compressionResult{
+	return CompressionResult{
 		DroppedMessages:   droppedCount,
 		RemainingMessages: len(keptHistory),
 	}, true
@@ -2843,46 +3005,58 @@ func formatToolsForLog(toolDefs []providers.ToolDefinition) string {
 	return sb.String()
 }
 
-// summarizeSession summarizes the conversation history for a session.
+// summarizeSession runs the agent's compression strategy in the background
+// once a turn has crossed the summarization thresholds.
 func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string, turnScope turnEventScope) {
 	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
 	defer cancel()
 
+	result, ok := al.compressContext(
+		ctx, agent, sessionKey, ContextCompressReasonThreshold,
+		turnScope.meta(0, "summarizeSession", "turn.context.compress"),
+	)
+	if !ok || result.SummarizedMessages == 0 {
+		return
+	}
+	al.emitEvent(
+		EventKindSessionSummarize,
+		turnScope.meta(0, "summarizeSession", "turn.session.summarize"),
+		SessionSummarizePayload{
+			SummarizedMessages: result.SummarizedMessages,
+			KeptMessages:       result.RemainingMessages,
+			SummaryLen:         len(agent.Sessions.GetSummary(sessionKey)),
+			OmittedOversized:   result.OmittedOversized,
+		},
+	)
+}
+
+// summarizeHistory is the summarize strategy's background run: it folds all
+// but the most recent messages into the session summary.
+func (al *AgentLoop) summarizeHistory(
+	ctx context.Context,
+	agent *AgentInstance,
+	sessionKey string,
+) (CompressionResult, bool) {
 	history := agent.Sessions.GetHistory(sessionKey)
 	summary := agent.Sessions.GetSummary(sessionKey)
 
 	// Keep the most recent Turns for continuity, aligned to a Turn boundary
 	// so that no tool-call sequence is split.
 	if len(history) <= 4 {
-		return
+		return CompressionResult{}, false
 	}
 
 	safeCut := findSafeBoundary(history, len(history)-4)
 	if safeCut <= 0 {
-		return
+		return CompressionResult{}, false
 	}
 	keepCount := len(history) - safeCut
 	toSummarize := history[:safeCut]
 
 	// Oversized Message Guard
-	maxMessageTokens := agent.ContextWindow / 2
-	validMessages := make([]providers.Message, 0)
-	omitted := false
-
-	for _, m := range toSummarize {
-		if m.Role != "user" && m.Role != "assistant" {
-			continue
-		}
-		msgTokens := len(m.Content) / 2
-		if msgTokens > maxMessageTokens {
-			omitted = true
-			continue
-		}
-		validMessages = append(validMessages, m)
-	}
-
+	validMessages, omitted := summarizableMessages(agent, toSummarize)
 	if len(validMessages) == 0 {
-		return
+		return CompressionResult{}, false
 	}
 
 	const (
@@ -2925,21 +3099,18 @@ func (al *AgentLoop) summarizeSession(agent *AgentInstance, sessionKey string, t
 		finalSummary += "\n[Note: Some oversized messages were omitted from this summary for efficiency.]"
 	}
 
-	if finalSummary != "" {
-		agent.Sessions.SetSummary(sessionKey, finalSummary)
-		agent.Sessions.TruncateHistory(sessionKey, keepCount)
-		agent.Sessions.Save(sessionKey)
-		al.emitEvent(
-			EventKindSessionSummarize,
-			turnScope.meta(0, "summarizeSession", "turn.session.summarize"),
-			SessionSummarizePayload{
-				SummarizedMessages: len(validMessages),
-				KeptMessages:       keepCount,
-				SummaryLen:         len(finalSummary),
-				OmittedOversized:   omitted,
-			},
-		)
+	if finalSummary == "" {
+		return CompressionResult{}, false
 	}
+	agent.Sessions.SetSummary(sessionKey, finalSummary)
+	agent.Sessions.TruncateHistory(sessionKey, keepCount)
+	agent.Sessions.Save(sessionKey)
+	return CompressionResult{
+		DroppedMessages:    safeCut,
+		RemainingMessages:  keepCount,
+		SummarizedMessages: len(validMessages),
+		OmittedOversized:   omitted,
+	}, true
 }
 
 // findNearestUserMessage finds the nearest user message to the given index.
@@ -2998,6 +3169,9 @@ func (al *AgentLoop) retryLLMCall(
 			)
 		}()
 
+		if err == nil && resp != nil {
+			al.recordUsage(agent, "", "", agent.Model, resp.Usage)
+		}
 		if err == nil && resp != nil && resp.Content != "" {
 			return resp, nil
 		}
@@ -3074,17 +3248,6 @@ func (al *AgentLoop) summarizeBatch(
 	return fallback.String(), nil
 }
 
-// estimateTokens estimates the number of tokens in a message list.
-// Counts Content, ToolCalls arguments, and ToolCallID metadata so that
-// tool-heavy conversations are not systematically undercounted.
-func (al *AgentLoop) estimateTokens(messages []providers.Message) int {
-	total := 0
-	for _, m := range messages {
-		total += estimateMessageTokens(m)
-	}
-	return total
-}
-
 func (al *AgentLoop) handleCommand(
 	ctx context.Context,
 	msg bus.InboundMessage,
@@ -3142,7 +3305,10 @@ func (al *AgentLoop) buildCommandsRuntime(agent *AgentInstance, opts *processOpt
 			return al.channelManager.GetEnabledChannels()
 		},
 		GetActiveTurn: func() any {
-			info := al.GetActiveTurn()
+			if opts == nil {
+				return nil
+			}
+			info := al.GetActiveTurnBySession(opts.SessionKey)
 			if info == nil {
 				return nil
 			}
@@ -3164,6 +3330,16 @@ func (al *AgentLoop) buildCommandsRuntime(agent *AgentInstance, opts *processOpt
 		}
 		return al.reloadFunc()
 	}
+	rt.GetUsage = func() (string, error) {
+		if al.usage == nil {
+			return "", fmt.Errorf("usage accounting not available")
+		}
+		sessionKey := ""
+		if opts != nil {
+			sessionKey = opts.SessionKey
+		}
+		return formatUsageReport(al.usage, cfg.Usage, sessionKey), nil
+	}
 	if agent != nil {
 		rt.GetModelInfo = func() (string, string) {
 			return agent.Model, resolvedCandidateProvider(agent.Candidates, cfg.Agents.Defaults.Provider)
@@ -3191,6 +3367,7 @@ func (al *AgentLoop) buildCommandsRuntime(agent *AgentInstance, opts *processOpt
 			agent.Provider = nextProvider
 			agent.Candidates = nextCandidates
 			agent.ThinkingLevel = parseThinkingLevel(modelCfg.ThinkingLevel)
+			agent.Tokenizer = resolveTokenizer(cfg, value)
 
 			if oldProvider != nil && oldProvider != nextProvider {
 				if stateful, ok := oldProvider.(providers.StatefulProvider); ok {
@@ -3211,7 +3388,50 @@ func (al *AgentLoop) buildCommandsRuntime(agent *AgentInstance, opts *processOpt
 			agent.Sessions.SetHistory(opts.SessionKey, make([]providers.Message, 0))
 			agent.Sessions.SetSummary(opts.SessionKey, "")
 			agent.Sessions.Save(opts.SessionKey)
-			return nil
+			return agent.Plans.Remove(opts.SessionKey)
+		}
+
+		rt.GetPlan = func() (string, error) {
+			if opts == nil {
+				return "", fmt.Errorf("process options not available")
+			}
+			plan, err := agent.Plans.Load(opts.SessionKey)
+			if err != nil || plan == nil {
+				return "", err
+			}
+			return plan.Render(), nil
+		}
+
+		rt.GetProfile = func() (string, []commands.ProfileInfo, error) {
+			if opts == nil {
+				return "", nil, fmt.Errorf("process options not available")
+			}
+			var available []commands.ProfileInfo
+			for _, p := range agent.Profiles.List() {
+				available = append(available, commands.ProfileInfo{Name: p.Name, Description: p.Description})
+			}
+			return agent.Profiles.Selected(opts.SessionKey), available, nil
+		}
+
+		rt.SwitchProfile = func(name string) error {
+			if opts == nil {
+				return fmt.Errorf("process options not available")
+			}
+			return agent.Profiles.Select(opts.SessionKey, name)
+		}
+
+		rt.RunWithThinking = func(ctx context.Context, value, message string) (string, error) {
+			if opts == nil {
+				return "", fmt.Errorf("process options not available")
+			}
+			level := parseThinkingLevel(value)
+			if level == ThinkingOff && !strings.EqualFold(strings.TrimSpace(value), string(ThinkingOff)) {
+				return "", fmt.Errorf("unknown thinking level %q, use off, low, medium, high, xhigh or adaptive", value)
+			}
+			thinkOpts := *opts
+			thinkOpts.UserMessage = message
+			thinkOpts.ThinkingLevel = level
+			return al.runAgentLoop(ctx, agent, thinkOpts)
 		}
 	}
 	return rt
@@ -0,0 +1,431 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	defaultMemoryTopK      = 5
+	defaultMemoryChunkSize = 800
+
+	// memoryRRFConstant dampens the reciprocal rank fusion of the BM25 and
+	// embedding rankings; 60 is the value from the original RRF paper.
+	memoryRRFConstant = 60
+
+	// memoryEmbedBatch caps the number of chunks embedded per request.
+	memoryEmbedBatch = 64
+
+	// memoryRetrievalTimeout bounds the per-turn memory search, which may
+	// call the embeddings endpoint.
+	memoryRetrievalTimeout = 15 * time.Second
+)
+
+// MemoryEmbedder turns texts into vectors for semantic memory search.
+type MemoryEmbedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// MemoryChunk is a piece of a memory file small enough to inject on its own.
+type MemoryChunk struct {
+	Source  string // path relative to the workspace, e.g. memory/MEMORY.md
+	Heading string // nearest markdown heading above the chunk, if any
+	Text    string
+}
+
+// MemoryHit is a chunk returned by a memory search, best first.
+type MemoryHit struct {
+	MemoryChunk
+	Score float64
+}
+
+type memoryFileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// MemoryIndex splits the memory files of a MemoryStore into chunks and ranks
+// them against a query with BM25 and, when an embedder is set, embedding
+// similarity. Chunks are rebuilt when a memory file changes; embeddings are
+// cached by chunk content for the life of the index.
+type MemoryIndex struct {
+	store     *MemoryStore
+	chunkSize int
+	embedder  MemoryEmbedder
+
+	mu      sync.Mutex
+	stamps  map[string]memoryFileStamp
+	chunks  []MemoryChunk
+	vectors map[string][]float32
+}
+
+// NewMemoryIndex creates an index over the files of store. chunkSize is in
+// characters; embedder may be nil for BM25-only ranking.
+func NewMemoryIndex(store *MemoryStore, chunkSize int, embedder MemoryEmbedder) *MemoryIndex {
+	if chunkSize <= 0 {
+		chunkSize = defaultMemoryChunkSize
+	}
+	return &MemoryIndex{
+		store:     store,
+		chunkSize: chunkSize,
+		embedder:  embedder,
+		vectors:   make(map[string][]float32),
+	}
+}
+
+// Search returns up to topK chunks relevant to query.
+func (ix *MemoryIndex) Search(ctx context.Context, query string, topK int) ([]MemoryHit, error) {
+	query = strings.TrimSpace(query)
+	if query == "" || topK <= 0 {
+		return nil, nil
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	if err := ix.refreshLocked(); err != nil {
+		return nil, err
+	}
+	if len(ix.chunks) == 0 {
+		return nil, nil
+	}
+
+	ranks := make([]map[int]int, 0, 2)
+	engine := utils.NewBM25Engine(ix.indices(), func(i int) string {
+		return ix.chunks[i].Heading + " " + ix.chunks[i].Text
+	})
+	bm25 := make(map[int]int)
+	for rank, r := range engine.Search(query, len(ix.chunks)) {
+		bm25[r.Document] = rank
+	}
+	ranks = append(ranks, bm25)
+
+	if ix.embedder != nil {
+		semantic, err := ix.semanticRanksLocked(ctx, query)
+		if err != nil {
+			logger.WarnCF("agent", "Memory embeddings unavailable; using keyword search only",
+				map[string]any{"error": err.Error()})
+		} else {
+			ranks = append(ranks, semantic)
+		}
+	}
+
+	scores := make(map[int]float64)
+	for _, ranking := range ranks {
+		for i, rank := range ranking {
+			scores[i] += 1 / float64(memoryRRFConstant+rank+1)
+		}
+	}
+	hits := make([]MemoryHit, 0, len(scores))
+	for i, score := range scores {
+		hits = append(hits, MemoryHit{MemoryChunk: ix.chunks[i], Score: score})
+	}
+	sort.SliceStable(hits, func(a, b int) bool {
+		if hits[a].Score != hits[b].Score {
+			return hits[a].Score > hits[b].Score
+		}
+		if hits[a].Source != hits[b].Source {
+			return hits[a].Source < hits[b].Source
+		}
+		return hits[a].Text < hits[b].Text
+	})
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	return hits, nil
+}
+
+// Invalidate forces the chunks to be rebuilt on the next search.
+func (ix *MemoryIndex) Invalidate() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.stamps = nil
+}
+
+func (ix *MemoryIndex) indices() []int {
+	out := make([]int, len(ix.chunks))
+	for i := range out {
+		out[i] = i
+	}
+	return out
+}
+
+// semanticRanksLocked ranks every chunk by cosine similarity to the query.
+// Only chunks without a cached vector are sent to the embedder.
+func (ix *MemoryIndex) semanticRanksLocked(ctx context.Context, query string) (map[int]int, error) {
+	var missing []MemoryChunk
+	seen := make(map[string]bool)
+	for _, c := range ix.chunks {
+		key := chunkKey(c)
+		if _, ok := ix.vectors[key]; !ok && !seen[key] {
+			seen[key] = true
+			missing = append(missing, c)
+		}
+	}
+	for start := 0; start < len(missing); start += memoryEmbedBatch {
+		batch := missing[start:min(start+memoryEmbedBatch, len(missing))]
+		inputs := make([]string, len(batch))
+		for i, c := range batch {
+			inputs[i] = chunkEmbeddingText(c)
+		}
+		vectors, err := ix.embedder.Embed(ctx, inputs)
+		if err != nil {
+			return nil, err
+		}
+		if len(vectors) != len(batch) {
+			return nil, fmt.Errorf("memory: got %d vectors for %d chunks", len(vectors), len(batch))
+		}
+		for i, c := range batch {
+			ix.vectors[chunkKey(c)] = vectors[i]
+		}
+	}
+
+	queryVec, err := ix.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	if len(queryVec) != 1 {
+		return nil, fmt.Errorf("memory: got %d query vectors", len(queryVec))
+	}
+
+	type scored struct {
+		index int
+		sim   float64
+	}
+	all := make([]scored, len(ix.chunks))
+	for i, c := range ix.chunks {
+		all[i] = scored{index: i, sim: cosineSimilarity(queryVec[0], ix.vectors[chunkKey(c)])}
+	}
+	sort.SliceStable(all, func(a, b int) bool { return all[a].sim > all[b].sim })
+	ranks := make(map[int]int, len(all))
+	for rank, s := range all {
+		ranks[s.index] = rank
+	}
+	return ranks, nil
+}
+
+// refreshLocked rebuilds the chunks when a memory file was added, removed or
+// modified since the last build.
+func (ix *MemoryIndex) refreshLocked() error {
+	stamps, err := ix.scanFiles()
+	if err != nil {
+		return err
+	}
+	if ix.stamps != nil && sameStamps(ix.stamps, stamps) {
+		return nil
+	}
+
+	paths := make([]string, 0, len(stamps))
+	for path := range stamps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var chunks []MemoryChunk
+	live := make(map[string]bool)
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return fmt.Errorf("memory: read %s: %w", path, err)
+		}
+		source := relativeWorkspacePath(ix.store.workspace, path)
+		for _, c := range chunkMemoryFile(source, string(data), ix.chunkSize) {
+			chunks = append(chunks, c)
+			live[chunkKey(c)] = true
+		}
+	}
+	for key := range ix.vectors {
+		if !live[key] {
+			delete(ix.vectors, key)
+		}
+	}
+	ix.chunks = chunks
+	ix.stamps = stamps
+	return nil
+}
+
+// scanFiles stats every markdown file under the memory directory.
+func (ix *MemoryIndex) scanFiles() (map[string]memoryFileStamp, error) {
+	stamps := make(map[string]memoryFileStamp)
+	err := filepath.WalkDir(ix.store.memoryDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || !strings.EqualFold(filepath.Ext(path), ".md") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		stamps[path] = memoryFileStamp{modTime: info.ModTime(), size: info.Size()}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("memory: scan %s: %w", ix.store.memoryDir, err)
+	}
+	return stamps, nil
+}
+
+func sameStamps(a, b map[string]memoryFileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		other, ok := b[path]
+		if !ok || !other.modTime.Equal(stamp.modTime) || other.size != stamp.size {
+			return false
+		}
+	}
+	return true
+}
+
+// chunkMemoryFile splits a markdown file into chunks of at most size
+// characters. Chunks never span headings, and paragraphs are kept whole when
+// they fit.
+func chunkMemoryFile(source, content string, size int) []MemoryChunk {
+	var chunks []MemoryChunk
+	heading := ""
+	var buf []string
+	bufLen := 0
+
+	flush := func() {
+		if text := strings.TrimSpace(strings.Join(buf, "\n\n")); text != "" {
+			chunks = append(chunks, MemoryChunk{Source: source, Heading: heading, Text: text})
+		}
+		buf, bufLen = nil, 0
+	}
+	add := func(paragraph string) {
+		for _, piece := range splitLongParagraph(paragraph, size) {
+			if bufLen > 0 && bufLen+len(piece)+2 > size {
+				flush()
+			}
+			buf = append(buf, piece)
+			bufLen += len(piece) + 2
+		}
+	}
+
+	var paragraph []string
+	endParagraph := func() {
+		if p := strings.TrimSpace(strings.Join(paragraph, "\n")); p != "" {
+			add(p)
+		}
+		paragraph = nil
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			endParagraph()
+			flush()
+			heading = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+		case trimmed == "":
+			endParagraph()
+		default:
+			paragraph = append(paragraph, line)
+		}
+	}
+	endParagraph()
+	flush()
+	return chunks
+}
+
+// splitLongParagraph cuts a paragraph longer than size at line breaks, and
+// lines longer than size at the last space before the limit.
+func splitLongParagraph(paragraph string, size int) []string {
+	if len(paragraph) <= size {
+		return []string{paragraph}
+	}
+	var out []string
+	var cur strings.Builder
+	for _, line := range strings.Split(paragraph, "\n") {
+		for len(line) > size {
+			cut := strings.LastIndex(line[:size], " ")
+			if cut <= 0 {
+				cut = size
+			}
+			if cur.Len() > 0 {
+				out = append(out, cur.String())
+				cur.Reset()
+			}
+			out = append(out, strings.TrimSpace(line[:cut]))
+			line = strings.TrimSpace(line[cut:])
+		}
+		if cur.Len() > 0 && cur.Len()+1+len(line) > size {
+			out = append(out, cur.String())
+			cur.Reset()
+		}
+		if cur.Len() > 0 {
+			cur.WriteByte('\n')
+		}
+		cur.WriteString(line)
+	}
+	if cur.Len() > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
+
+func chunkEmbeddingText(c MemoryChunk) string {
+	if c.Heading == "" {
+		return c.Text
+	}
+	return c.Heading + "\n\n" + c.Text
+}
+
+func chunkKey(c MemoryChunk) string {
+	sum := sha256.Sum256([]byte(chunkEmbeddingText(c)))
+	return hex.EncodeToString(sum[:])
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// formatMemoryHits renders search hits for the prompt and the memory_search
+// tool.
+func formatMemoryHits(hits []MemoryHit) string {
+	var sb strings.Builder
+	for i, hit := range hits {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString("### " + hit.Source)
+		if hit.Heading != "" {
+			sb.WriteString(" — " + hit.Heading)
+		}
+		sb.WriteString("\n" + hit.Text)
+	}
+	return sb.String()
+}
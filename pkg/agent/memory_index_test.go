@@ -0,0 +1,158 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeMemoryFile(t *testing.T, workspace, rel, content string) {
+	t.Helper()
+	path := filepath.Join(workspace, "memory", rel)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const testLongTermMemory = `# Memory
+
+## Preferences
+The user prefers Go over Python and likes terse answers.
+
+## Home
+The user lives in Lisbon and has a cat named Miso.
+
+## Work
+The user maintains an embedded Linux board fleet.
+`
+
+func TestChunkMemoryFile(t *testing.T) {
+	chunks := chunkMemoryFile("memory/MEMORY.md", testLongTermMemory, 800)
+	if len(chunks) != 3 {
+		t.Fatalf("chunks = %d, want one per section: %+v", len(chunks), chunks)
+	}
+	if chunks[1].Heading != "Home" || !strings.Contains(chunks[1].Text, "Miso") {
+		t.Fatalf("chunk[1] = %+v", chunks[1])
+	}
+
+	long := strings.Repeat("word ", 100)
+	for _, c := range chunkMemoryFile("memory/x.md", long+"\n\n"+long, 120) {
+		if len(c.Text) > 120 {
+			t.Fatalf("chunk of %d chars exceeds the size", len(c.Text))
+		}
+	}
+}
+
+func TestMemoryIndex_SearchRefreshesOnChange(t *testing.T) {
+	workspace := t.TempDir()
+	writeMemoryFile(t, workspace, "MEMORY.md", testLongTermMemory)
+	index := NewMemoryIndex(NewMemoryStore(workspace), 0, nil)
+
+	hits, err := index.Search(context.Background(), "what is my cat called?", 2)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(hits) == 0 || hits[0].Heading != "Home" || hits[0].Source != "memory/MEMORY.md" {
+		t.Fatalf("hits = %+v, want the Home section first", hits)
+	}
+
+	writeMemoryFile(t, workspace, "202610/20261017.md", "# 2026-10-17\n\nBooked a flight to Tokyo.")
+	hits, err = index.Search(context.Background(), "tokyo flight", 1)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(hits) != 1 || hits[0].Source != "memory/202610/20261017.md" {
+		t.Fatalf("hits = %+v, want the new daily note", hits)
+	}
+}
+
+// fakeEmbedder maps texts to two-dimensional vectors: texts mentioning a pet
+// point one way, everything else the other.
+type fakeEmbedder struct {
+	inputs int
+	err    error
+}
+
+func (e *fakeEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.inputs += len(texts)
+	if e.err != nil {
+		return nil, e.err
+	}
+	out := make([][]float32, len(texts))
+	for i, text := range texts {
+		lower := strings.ToLower(text)
+		if strings.Contains(lower, "cat") || strings.Contains(lower, "pet") {
+			out[i] = []float32{1, 0}
+		} else {
+			out[i] = []float32{0, 1}
+		}
+	}
+	return out, nil
+}
+
+func TestMemoryIndex_EmbeddingsFindSemanticMatches(t *testing.T) {
+	workspace := t.TempDir()
+	writeMemoryFile(t, workspace, "MEMORY.md", testLongTermMemory)
+	embedder := &fakeEmbedder{}
+	index := NewMemoryIndex(NewMemoryStore(workspace), 0, embedder)
+
+	// No keyword overlaps with the Home section; only the embeddings link
+	// "pet" to the cat.
+	hits, err := index.Search(context.Background(), "pet", 1)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(hits) != 1 || hits[0].Heading != "Home" {
+		t.Fatalf("hits = %+v, want the Home section", hits)
+	}
+
+	// Chunk vectors are cached; only the query is embedded again.
+	chunkInputs := embedder.inputs - 1
+	if _, err := index.Search(context.Background(), "pet", 1); err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if embedder.inputs != chunkInputs+2 {
+		t.Fatalf("embedded %d texts on the second search, want only the query", embedder.inputs-chunkInputs-1)
+	}
+}
+
+func TestMemoryIndex_FallsBackToKeywordsWhenEmbeddingsFail(t *testing.T) {
+	workspace := t.TempDir()
+	writeMemoryFile(t, workspace, "MEMORY.md", testLongTermMemory)
+	index := NewMemoryIndex(NewMemoryStore(workspace), 0, &fakeEmbedder{err: errors.New("offline")})
+
+	hits, err := index.Search(context.Background(), "lisbon", 3)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	if len(hits) != 1 || hits[0].Heading != "Home" {
+		t.Fatalf("hits = %+v, want only the keyword match", hits)
+	}
+}
+
+func TestBuildMessages_InjectsRelevantMemoryOnly(t *testing.T) {
+	workspace := t.TempDir()
+	writeMemoryFile(t, workspace, "MEMORY.md", testLongTermMemory)
+	cb := NewContextBuilder(workspace)
+	cb.WithMemoryRetrieval(NewMemoryIndex(cb.MemoryStore(), 0, nil), 1)
+
+	message := "Should this be written in Python?"
+	memory := cb.RelevantMemory(context.Background(), message)
+	messages := cb.BuildMessages(nil, message, BuildMessagesOptions{Memory: memory, Channel: "cli", ChatID: "direct"})
+	system := messages[0].Content
+	if !strings.Contains(system, "## Relevant Memory") || !strings.Contains(system, "prefers Go") {
+		t.Fatalf("relevant memory missing from system prompt:\n%s", system)
+	}
+	if strings.Contains(system, "Miso") || strings.Contains(system, "## Long-term Memory") {
+		t.Fatalf("unrelated memory injected:\n%s", system)
+	}
+	if !strings.Contains(cb.BuildSystemPromptWithCache(), "memory_search") {
+		t.Fatal("static prompt should point the model at memory_search")
+	}
+}
@@ -0,0 +1,207 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const maxMemorySearchResults = 20
+
+// memorySearchTool searches the agent's long-term memory and daily notes.
+type memorySearchTool struct {
+	index *MemoryIndex
+}
+
+func newMemorySearchTool(index *MemoryIndex) *memorySearchTool {
+	return &memorySearchTool{index: index}
+}
+
+func (t *memorySearchTool) Name() string {
+	return "memory_search"
+}
+
+func (t *memorySearchTool) Description() string {
+	return "Search your long-term memory (MEMORY.md) and daily notes for saved facts, preferences and past " +
+		"events. Returns the most relevant excerpts with the file they come from."
+}
+
+func (t *memorySearchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"query": map[string]any{
+				"type":        "string",
+				"description": "What to look for, in natural language or keywords.",
+			},
+			"limit": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum number of excerpts (default %d, max %d).", defaultMemoryTopK, maxMemorySearchResults),
+			},
+		},
+		"required": []string{"query"},
+	}
+}
+
+func (t *memorySearchTool) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *memorySearchTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	query, _ := args["query"].(string)
+	if strings.TrimSpace(query) == "" {
+		return tools.ErrorResult("memory_search: query is required")
+	}
+	limit := defaultMemoryTopK
+	if n, ok := intArg(args["limit"]); ok && n > 0 {
+		limit = min(n, maxMemorySearchResults)
+	}
+
+	hits, err := t.index.Search(ctx, query, limit)
+	if err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+	if len(hits) == 0 {
+		return tools.SilentResult("No memory matches the query.")
+	}
+	return tools.SilentResult(formatMemoryHits(hits))
+}
+
+// memoryWriteTool saves to long-term memory or today's daily note.
+type memoryWriteTool struct {
+	store *MemoryStore
+	index *MemoryIndex
+}
+
+func newMemoryWriteTool(store *MemoryStore, index *MemoryIndex) *memoryWriteTool {
+	return &memoryWriteTool{store: store, index: index}
+}
+
+func (t *memoryWriteTool) Name() string {
+	return "memory_write"
+}
+
+func (t *memoryWriteTool) Description() string {
+	return "Save something worth remembering. target \"long_term\" (default) adds to MEMORY.md, optionally " +
+		"under a section heading; \"daily\" appends to today's note. To correct or forget a long-term fact, " +
+		"pass its current text as \"replace\" and the new text (or an empty string) as \"content\"."
+}
+
+func (t *memoryWriteTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"content": map[string]any{
+				"type":        "string",
+				"description": "Text to save, as concise markdown.",
+			},
+			"target": map[string]any{
+				"type":        "string",
+				"enum":        []string{"long_term", "daily"},
+				"description": "Where to save it (default long_term).",
+			},
+			"section": map[string]any{
+				"type":        "string",
+				"description": "Heading in MEMORY.md to add the content under, e.g. \"Preferences\" (long_term only).",
+			},
+			"replace": map[string]any{
+				"type":        "string",
+				"description": "Existing text in MEMORY.md to replace with content (long_term only).",
+			},
+		},
+		"required": []string{"content"},
+	}
+}
+
+func (t *memoryWriteTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	content, _ := args["content"].(string)
+	content = strings.TrimSpace(content)
+	target, _ := args["target"].(string)
+	section, _ := args["section"].(string)
+	replace, _ := args["replace"].(string)
+
+	var (
+		msg string
+		err error
+	)
+	switch target {
+	case "", "long_term":
+		msg, err = t.writeLongTerm(content, strings.TrimSpace(section), replace)
+	case "daily":
+		if content == "" {
+			return tools.ErrorResult("memory_write: content is required")
+		}
+		err = t.store.AppendToday(content)
+		msg = "Saved to today's note."
+	default:
+		return tools.ErrorResult(fmt.Sprintf("memory_write: unknown target %q", target))
+	}
+	if err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+	t.index.Invalidate()
+	return tools.SilentResult(msg)
+}
+
+func (t *memoryWriteTool) writeLongTerm(content, section, replace string) (string, error) {
+	doc := t.store.ReadLongTerm()
+	switch {
+	case replace != "":
+		if !strings.Contains(doc, replace) {
+			return "", fmt.Errorf("memory_write: the text to replace was not found in MEMORY.md")
+		}
+		doc = strings.Replace(doc, replace, content, 1)
+	case content == "":
+		return "", fmt.Errorf("memory_write: content is required")
+	default:
+		doc = appendToSection(doc, section, content)
+	}
+	if err := t.store.WriteLongTerm(doc); err != nil {
+		return "", err
+	}
+	if replace != "" {
+		return "Updated MEMORY.md.", nil
+	}
+	return "Saved to MEMORY.md.", nil
+}
+
+// appendToSection adds content at the end of the "## section" part of a
+// markdown document, creating the heading when it does not exist. An empty
+// section appends to the end of the document.
+func appendToSection(doc, section, content string) string {
+	doc = strings.TrimRight(doc, "\n")
+	join := func(parts ...string) string {
+		out := strings.Join(parts, "\n\n")
+		return strings.TrimLeft(out, "\n") + "\n"
+	}
+	if section == "" {
+		return join(doc, content)
+	}
+
+	lines := strings.Split(doc, "\n")
+	start := -1
+	for i, line := range lines {
+		if strings.HasPrefix(line, "#") && strings.EqualFold(strings.TrimSpace(strings.TrimLeft(line, "#")), section) {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return join(doc, "## "+section, content)
+	}
+	end := len(lines)
+	for i := start + 1; i < len(lines); i++ {
+		if strings.HasPrefix(lines[i], "#") {
+			end = i
+			break
+		}
+	}
+	before := strings.TrimRight(strings.Join(lines[:end], "\n"), "\n")
+	after := strings.Join(lines[end:], "\n")
+	if after == "" {
+		return join(before, content)
+	}
+	return join(before, content, after)
+}
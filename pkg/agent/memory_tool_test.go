@@ -0,0 +1,64 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestMemoryTools_WriteThenSearch(t *testing.T) {
+	store := NewMemoryStore(t.TempDir())
+	index := NewMemoryIndex(store, 0, nil)
+	write := newMemoryWriteTool(store, index)
+	search := newMemorySearchTool(index)
+	ctx := context.Background()
+
+	if res := write.Execute(ctx, map[string]any{
+		"content": "- Allergic to peanuts", "section": "Health",
+	}); res.IsError {
+		t.Fatalf("write result = %+v", res)
+	}
+	res := search.Execute(ctx, map[string]any{"query": "peanuts"})
+	if res.IsError || !strings.Contains(res.ForLLM, "memory/MEMORY.md — Health") ||
+		!strings.Contains(res.ForLLM, "Allergic to peanuts") {
+		t.Fatalf("search result = %+v", res)
+	}
+
+	if res := write.Execute(ctx, map[string]any{
+		"content": "- Allergic to shellfish", "replace": "- Allergic to peanuts",
+	}); res.IsError {
+		t.Fatalf("replace result = %+v", res)
+	}
+	if res := search.Execute(ctx, map[string]any{"query": "peanuts"}); !strings.Contains(res.ForLLM, "No memory") {
+		t.Fatalf("replaced fact still found: %+v", res)
+	}
+	if res := write.Execute(ctx, map[string]any{"content": "x", "replace": "not there"}); !res.IsError {
+		t.Fatal("replacing missing text should fail")
+	}
+
+	if res := write.Execute(ctx, map[string]any{"content": "Met Ana for lunch", "target": "daily"}); res.IsError {
+		t.Fatalf("daily result = %+v", res)
+	}
+	if !strings.Contains(store.ReadToday(), "Met Ana for lunch") {
+		t.Fatalf("daily note = %q", store.ReadToday())
+	}
+}
+
+func TestAppendToSection(t *testing.T) {
+	doc := "# Memory\n\n## Preferences\n- Go\n\n## Work\n- Boards\n"
+
+	got := appendToSection(doc, "preferences", "- Terse answers")
+	want := "# Memory\n\n## Preferences\n- Go\n\n- Terse answers\n\n## Work\n- Boards\n"
+	if got != want {
+		t.Fatalf("existing section:\n%q\nwant\n%q", got, want)
+	}
+
+	got = appendToSection(doc, "Home", "- Lisbon")
+	if !strings.HasSuffix(got, "- Boards\n\n## Home\n\n- Lisbon\n") {
+		t.Fatalf("new section:\n%q", got)
+	}
+
+	if got := appendToSection("", "", "first"); got != "first\n" {
+		t.Fatalf("empty doc = %q", got)
+	}
+}
@@ -0,0 +1,380 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
+)
+
+const (
+	planFileSuffix = ".plan.json"
+
+	// planPromptHeader starts the plan block of the system prompt.
+	planPromptHeader = "## Current Plan"
+
+	maxPlanSteps          = 12
+	planContextMessages   = 6
+	planContextMaxChars   = 500
+	planDraftTemperature  = 0.2
+	planDraftSystemPrompt = `You plan how an assistant with tools will complete a user's request.
+Break the request into a short, ordered list of concrete steps (at most %d).
+If the request can be answered directly without several steps, return an empty list.
+Reply with a single JSON object and nothing else:
+{"goal": "<one sentence>", "steps": ["<step>", "<step>"]}`
+)
+
+// PlanStepStatus is the progress state of one plan step.
+type PlanStepStatus string
+
+const (
+	PlanStepPending    PlanStepStatus = "pending"
+	PlanStepInProgress PlanStepStatus = "in_progress"
+	PlanStepCompleted  PlanStepStatus = "completed"
+	PlanStepSkipped    PlanStepStatus = "skipped"
+	PlanStepFailed     PlanStepStatus = "failed"
+)
+
+var planStepStatuses = []PlanStepStatus{
+	PlanStepPending,
+	PlanStepInProgress,
+	PlanStepCompleted,
+	PlanStepSkipped,
+	PlanStepFailed,
+}
+
+func parsePlanStepStatus(s string) (PlanStepStatus, bool) {
+	for _, status := range planStepStatuses {
+		if string(status) == s {
+			return status, true
+		}
+	}
+	return "", false
+}
+
+// PlanStep is one step of a SessionPlan. IDs start at 1 and stay stable
+// when steps are added.
+type PlanStep struct {
+	ID     int            `json:"id"`
+	Title  string         `json:"title"`
+	Status PlanStepStatus `json:"status"`
+	Note   string         `json:"note,omitempty"`
+}
+
+// SessionPlan is the task list of a session in plan mode. It is stored next
+// to the session JSONL and injected into every system prompt while it has
+// open steps, so it survives summarization and forced compression.
+type SessionPlan struct {
+	SessionKey string     `json:"session_key"`
+	Goal       string     `json:"goal,omitempty"`
+	Steps      []PlanStep `json:"steps"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+func newSessionPlan(sessionKey, goal string, steps []string) *SessionPlan {
+	now := time.Now()
+	plan := &SessionPlan{
+		SessionKey: sessionKey,
+		Goal:       strings.TrimSpace(goal),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	for _, title := range steps {
+		plan.addStep(title)
+	}
+	return plan
+}
+
+// Finished reports whether no step is pending or in progress.
+func (p *SessionPlan) Finished() bool {
+	for _, step := range p.Steps {
+		if step.Status == PlanStepPending || step.Status == PlanStepInProgress {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *SessionPlan) step(id int) *PlanStep {
+	for i := range p.Steps {
+		if p.Steps[i].ID == id {
+			return &p.Steps[i]
+		}
+	}
+	return nil
+}
+
+func (p *SessionPlan) addStep(title string) *PlanStep {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return nil
+	}
+	id := 1
+	for _, step := range p.Steps {
+		id = max(id, step.ID+1)
+	}
+	p.Steps = append(p.Steps, PlanStep{ID: id, Title: title, Status: PlanStepPending})
+	return &p.Steps[len(p.Steps)-1]
+}
+
+// Render formats the plan as a checklist.
+func (p *SessionPlan) Render() string {
+	var sb strings.Builder
+	if p.Goal != "" {
+		fmt.Fprintf(&sb, "Goal: %s\n", p.Goal)
+	}
+	for _, step := range p.Steps {
+		fmt.Fprintf(&sb, "%d. %s %s", step.ID, planStepMarker(step.Status), step.Title)
+		if step.Note != "" {
+			fmt.Fprintf(&sb, " — %s", step.Note)
+		}
+		sb.WriteString("\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func planStepMarker(status PlanStepStatus) string {
+	switch status {
+	case PlanStepCompleted:
+		return "[x]"
+	case PlanStepInProgress:
+		return "[>]"
+	case PlanStepSkipped:
+		return "[-]"
+	case PlanStepFailed:
+		return "[!]"
+	default:
+		return "[ ]"
+	}
+}
+
+// planStore persists SessionPlans as one JSON file per session.
+type planStore struct {
+	dir string
+}
+
+func newPlanStore(dir string) *planStore {
+	if dir == "" {
+		return nil
+	}
+	return &planStore{dir: dir}
+}
+
+func (s *planStore) path(sessionKey string) string {
+	return filepath.Join(s.dir, sessionFileStem(sessionKey)+planFileSuffix)
+}
+
+// Load returns the session's plan, or nil when it has none.
+func (s *planStore) Load(sessionKey string) (*SessionPlan, error) {
+	if s == nil {
+		return nil, nil
+	}
+	data, err := os.ReadFile(s.path(sessionKey))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("plan: read: %w", err)
+	}
+	var plan SessionPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("plan: decode: %w", err)
+	}
+	return &plan, nil
+}
+
+func (s *planStore) Save(plan *SessionPlan) error {
+	if s == nil || plan == nil {
+		return nil
+	}
+	plan.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return fmt.Errorf("plan: encode: %w", err)
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("plan: create dir: %w", err)
+	}
+	return fileutil.WriteFileAtomic(s.path(plan.SessionKey), data, 0o644)
+}
+
+func (s *planStore) Remove(sessionKey string) error {
+	if s == nil {
+		return nil
+	}
+	err := os.Remove(s.path(sessionKey))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("plan: remove: %w", err)
+	}
+	return nil
+}
+
+// planModeEnabled reports whether this turn plans and tracks a task list.
+// Only root turns with a session take part; sub-turns report to their parent.
+func (al *AgentLoop) planModeEnabled(ts *turnState) bool {
+	return ts.agent != nil && ts.agent.Plans != nil && ts.depth == 0 && !ts.opts.NoHistory &&
+		al.GetConfig().Agents.Defaults.PlanMode
+}
+
+// currentPlanPrompt returns the plan block for the system prompt, or "" when
+// plan mode is off or the session has no open plan.
+func (al *AgentLoop) currentPlanPrompt(ts *turnState) string {
+	if !al.planModeEnabled(ts) {
+		return ""
+	}
+	plan, err := ts.agent.Plans.Load(ts.sessionKey)
+	if err != nil {
+		logger.WarnCF("agent", "Failed to load plan",
+			map[string]any{"session_key": ts.sessionKey, "error": err.Error()})
+		return ""
+	}
+	if plan == nil || plan.Finished() {
+		return ""
+	}
+	return planPromptHeader + "\n" +
+		"Work through this plan in order. Use the `plan` tool to mark a step in_progress when you " +
+		"start it and completed, skipped or failed (with a note) when you are done with it. " +
+		"If the user changes the request, replace the plan with action \"set\".\n\n" +
+		plan.Render()
+}
+
+// ensureTurnPlan makes the first LLM call of a plan-mode turn: when the
+// session has no open plan, the model is asked to break the request into
+// steps, and the result is stored for the rest of the job. A request the
+// model considers simple gets no plan. Failures are logged and the turn
+// continues without a plan.
+func (al *AgentLoop) ensureTurnPlan(
+	ctx context.Context,
+	ts *turnState,
+	history []providers.Message,
+	summary string,
+) {
+	if !al.planModeEnabled(ts) || strings.TrimSpace(ts.userMessage) == "" {
+		return
+	}
+	existing, err := ts.agent.Plans.Load(ts.sessionKey)
+	if err != nil {
+		logger.WarnCF("agent", "Failed to load plan",
+			map[string]any{"session_key": ts.sessionKey, "error": err.Error()})
+		return
+	}
+	if existing != nil && !existing.Finished() {
+		return
+	}
+
+	goal, steps, err := al.draftPlan(ctx, ts, history, summary)
+	if err != nil {
+		logger.WarnCF("agent", "Plan generation failed, continuing without a plan",
+			map[string]any{"session_key": ts.sessionKey, "error": err.Error()})
+		return
+	}
+	if len(steps) == 0 {
+		if existing != nil {
+			_ = ts.agent.Plans.Remove(ts.sessionKey)
+		}
+		logger.DebugCF("agent", "No plan needed for request",
+			map[string]any{"session_key": ts.sessionKey})
+		return
+	}
+
+	plan := newSessionPlan(ts.sessionKey, goal, steps)
+	if err := ts.agent.Plans.Save(plan); err != nil {
+		logger.WarnCF("agent", "Failed to save plan",
+			map[string]any{"session_key": ts.sessionKey, "error": err.Error()})
+		return
+	}
+	logger.InfoCF("agent", "Plan created",
+		map[string]any{
+			"agent_id":    ts.agent.ID,
+			"session_key": ts.sessionKey,
+			"steps":       len(plan.Steps),
+		})
+}
+
+func (al *AgentLoop) draftPlan(
+	ctx context.Context,
+	ts *turnState,
+	history []providers.Message,
+	summary string,
+) (string, []string, error) {
+	agent := ts.agent
+	var sb strings.Builder
+	if summary != "" {
+		fmt.Fprintf(&sb, "Conversation summary:\n%s\n\n", summary)
+	}
+	recent := history[max(0, len(history)-planContextMessages):]
+	if len(recent) > 0 {
+		sb.WriteString("Recent conversation:\n")
+		for _, msg := range recent {
+			if (msg.Role == "user" || msg.Role == "assistant") && strings.TrimSpace(msg.Content) != "" {
+				fmt.Fprintf(&sb, "%s: %s\n", msg.Role, utils.Truncate(msg.Content, planContextMaxChars))
+			}
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "Request:\n%s", ts.userMessage)
+
+	al.activeRequests.Add(1)
+	resp, err := func() (*providers.LLMResponse, error) {
+		defer al.activeRequests.Done()
+		return agent.Provider.Chat(
+			ctx,
+			[]providers.Message{
+				{Role: "system", Content: fmt.Sprintf(planDraftSystemPrompt, maxPlanSteps)},
+				{Role: "user", Content: sb.String()},
+			},
+			nil,
+			agent.Model,
+			map[string]any{
+				"max_tokens":       agent.MaxTokens,
+				"temperature":      planDraftTemperature,
+				"prompt_cache_key": agent.ID,
+			},
+		)
+	}()
+	if err != nil {
+		return "", nil, err
+	}
+	if resp == nil {
+		return "", nil, fmt.Errorf("plan: empty response")
+	}
+	al.recordUsage(agent, ts.sessionKey, ts.channel, agent.Model, resp.Usage)
+	return parsePlanDraft(resp.Content)
+}
+
+// parsePlanDraft extracts the goal and step titles from the planner's reply.
+// Models often wrap JSON in prose or code fences, so the outermost object is
+// decoded.
+func parsePlanDraft(content string) (string, []string, error) {
+	start := strings.Index(content, "{")
+	end := strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return "", nil, fmt.Errorf("plan: no JSON object in response")
+	}
+	var draft struct {
+		Goal  string   `json:"goal"`
+		Steps []string `json:"steps"`
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), &draft); err != nil {
+		return "", nil, fmt.Errorf("plan: decode response: %w", err)
+	}
+	steps := make([]string, 0, len(draft.Steps))
+	for _, step := range draft.Steps {
+		if step = strings.TrimSpace(step); step != "" {
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) > maxPlanSteps {
+		steps = steps[:maxPlanSteps]
+	}
+	return strings.TrimSpace(draft.Goal), steps, nil
+}
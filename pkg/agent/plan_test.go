@@ -0,0 +1,178 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// planModeProvider answers the planning call with a two-step plan, then
+// completes step 1 through the plan tool and finishes.
+type planModeProvider struct {
+	mu            sync.Mutex
+	calls         int
+	planRequests  int
+	systemPrompts []string
+}
+
+func (p *planModeProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if strings.HasPrefix(messages[0].Content, "You plan how an assistant") {
+		p.planRequests++
+		return &providers.LLMResponse{
+			Content: "```json\n{\"goal\": \"Ship it\", \"steps\": [\"Build\", \"Deploy\"]}\n```",
+		}, nil
+	}
+
+	p.calls++
+	p.systemPrompts = append(p.systemPrompts, messages[0].Content)
+	if p.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{{
+				ID:        "call-1",
+				Name:      "plan",
+				Arguments: map[string]any{"action": "update", "step": float64(1), "status": "completed"},
+			}},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "built"}, nil
+}
+
+func (p *planModeProvider) GetDefaultModel() string {
+	return "plan-mode-provider"
+}
+
+func newPlanModeLoop(t *testing.T, provider providers.LLMProvider) (*AgentLoop, *AgentInstance) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				PlanMode:          true,
+			},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	t.Cleanup(al.Close)
+	return al, al.registry.GetDefaultAgent()
+}
+
+func TestRunTurn_PlanModeCreatesAndTracksPlan(t *testing.T) {
+	provider := &planModeProvider{}
+	al, agent := newPlanModeLoop(t, provider)
+
+	resp, err := al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:      "session-1",
+		Channel:         "cli",
+		ChatID:          "direct",
+		UserMessage:     "build and deploy",
+		DefaultResponse: defaultResponse,
+	})
+	if err != nil {
+		t.Fatalf("runAgentLoop() error = %v", err)
+	}
+	if resp != "built" {
+		t.Fatalf("response = %q, want built", resp)
+	}
+	if provider.planRequests != 1 {
+		t.Fatalf("planning calls = %d, want 1", provider.planRequests)
+	}
+	if !strings.Contains(provider.systemPrompts[0], planPromptHeader+"\n") ||
+		!strings.Contains(provider.systemPrompts[0], "1. [ ] Build") {
+		t.Fatalf("plan not injected into system prompt:\n%s", provider.systemPrompts[0])
+	}
+
+	plan, err := agent.Plans.Load("session-1")
+	if err != nil || plan == nil {
+		t.Fatalf("Load() = %v, %v", plan, err)
+	}
+	if plan.Goal != "Ship it" || len(plan.Steps) != 2 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	if plan.Steps[0].Status != PlanStepCompleted || plan.Steps[1].Status != PlanStepPending {
+		t.Fatalf("step statuses = %q, %q", plan.Steps[0].Status, plan.Steps[1].Status)
+	}
+
+	// The next message continues the open plan instead of planning again,
+	// and the system prompt reflects the progress so far.
+	if _, err := al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:      "session-1",
+		Channel:         "cli",
+		ChatID:          "direct",
+		UserMessage:     "continue",
+		DefaultResponse: defaultResponse,
+	}); err != nil {
+		t.Fatalf("second runAgentLoop() error = %v", err)
+	}
+	if provider.planRequests != 1 {
+		t.Fatalf("planning calls = %d, want the open plan reused", provider.planRequests)
+	}
+	if last := provider.systemPrompts[len(provider.systemPrompts)-1]; !strings.Contains(last, "1. [x] Build") {
+		t.Fatalf("updated plan not injected:\n%s", last)
+	}
+}
+
+func TestPlanTool_Actions(t *testing.T) {
+	_, agent := newPlanModeLoop(t, &planModeProvider{})
+	ts := &turnState{agent: agent, sessionKey: "session-1"}
+	ctx := withTurnState(context.Background(), ts)
+	tool := newPlanTool()
+
+	if res := tool.Execute(ctx, map[string]any{"action": "update", "step": float64(1)}); !res.IsError {
+		t.Fatal("update without a plan should fail")
+	}
+
+	res := tool.Execute(ctx, map[string]any{"action": "set", "goal": "g", "steps": []any{"a", "b"}})
+	if res.IsError || res.ForLLM != "Goal: g\n1. [ ] a\n2. [ ] b" {
+		t.Fatalf("set result = %+v", res)
+	}
+	res = tool.Execute(ctx, map[string]any{"action": "add", "title": "c"})
+	if res.IsError || !strings.HasSuffix(res.ForLLM, "3. [ ] c") {
+		t.Fatalf("add result = %+v", res)
+	}
+	res = tool.Execute(ctx, map[string]any{
+		"action": "update", "step": float64(2), "status": "failed", "note": "no access",
+	})
+	if res.IsError || !strings.Contains(res.ForLLM, "2. [!] b — no access") {
+		t.Fatalf("update result = %+v", res)
+	}
+	if res := tool.Execute(ctx, map[string]any{"action": "update", "step": float64(2), "status": "bogus"}); !res.IsError {
+		t.Fatal("unknown status should fail")
+	}
+	if res := tool.Execute(ctx, map[string]any{"action": "clear"}); res.IsError {
+		t.Fatalf("clear result = %+v", res)
+	}
+	if plan, _ := agent.Plans.Load("session-1"); plan != nil {
+		t.Fatalf("plan still stored after clear: %+v", plan)
+	}
+}
+
+func TestParsePlanDraft(t *testing.T) {
+	goal, steps, err := parsePlanDraft("Here you go:\n{\"goal\": \" g \", \"steps\": [\"a\", \" \", \"b\"]}")
+	if err != nil {
+		t.Fatalf("parsePlanDraft() error = %v", err)
+	}
+	if goal != "g" || len(steps) != 2 || steps[0] != "a" || steps[1] != "b" {
+		t.Fatalf("goal = %q, steps = %q", goal, steps)
+	}
+
+	if _, _, err := parsePlanDraft("no plan here"); err == nil {
+		t.Fatal("expected error for reply without JSON")
+	}
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// planTool lets the model update the session plan created in plan mode. It
+// reads the session from the turn context, so one instance serves every
+// session of an agent.
+type planTool struct{}
+
+func newPlanTool() *planTool {
+	return &planTool{}
+}
+
+func (t *planTool) Name() string {
+	return "plan"
+}
+
+func (t *planTool) Description() string {
+	return "Track progress on the current task plan. Actions: \"update\" sets a step's status " +
+		"(pending, in_progress, completed, skipped, failed) with an optional note; \"add\" appends a step; " +
+		"\"set\" replaces the plan with a new goal and steps; \"clear\" removes the plan; " +
+		"\"show\" returns it unchanged. Always returns the resulting plan."
+}
+
+func (t *planTool) Parameters() map[string]any {
+	statuses := make([]string, 0, len(planStepStatuses))
+	for _, status := range planStepStatuses {
+		statuses = append(statuses, string(status))
+	}
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []string{"update", "add", "set", "clear", "show"},
+				"description": "What to do with the plan.",
+			},
+			"step": map[string]any{
+				"type":        "integer",
+				"description": "Step number to update (for \"update\").",
+			},
+			"status": map[string]any{
+				"type":        "string",
+				"enum":        statuses,
+				"description": "New status of the step (for \"update\").",
+			},
+			"note": map[string]any{
+				"type":        "string",
+				"description": "Optional short note, e.g. the outcome or why a step failed (for \"update\").",
+			},
+			"title": map[string]any{
+				"type":        "string",
+				"description": "Title of the new step (for \"add\").",
+			},
+			"goal": map[string]any{
+				"type":        "string",
+				"description": "Goal of the new plan (for \"set\").",
+			},
+			"steps": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Step titles of the new plan, in order (for \"set\").",
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *planTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	ts := turnStateFromContext(ctx)
+	if ts == nil || ts.agent == nil || ts.agent.Plans == nil {
+		return tools.ErrorResult("plan: no session plan is available in this context")
+	}
+	store, sessionKey := ts.agent.Plans, ts.sessionKey
+
+	action, _ := args["action"].(string)
+	if action == "set" {
+		goal, _ := args["goal"].(string)
+		plan := newSessionPlan(sessionKey, goal, stringSliceArg(args["steps"]))
+		if len(plan.Steps) == 0 {
+			return tools.ErrorResult("plan: \"set\" requires at least one step")
+		}
+		return t.save(store, plan)
+	}
+
+	plan, err := store.Load(sessionKey)
+	if err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+	if plan == nil {
+		return tools.ErrorResult("plan: there is no plan for this session; use action \"set\" to create one")
+	}
+
+	switch action {
+	case "show":
+		return tools.SilentResult(plan.Render())
+	case "clear":
+		if err := store.Remove(sessionKey); err != nil {
+			return tools.ErrorResult(err.Error()).WithError(err)
+		}
+		return tools.SilentResult("Plan cleared.")
+	case "add":
+		title, _ := args["title"].(string)
+		if plan.addStep(title) == nil {
+			return tools.ErrorResult("plan: \"add\" requires a title")
+		}
+		return t.save(store, plan)
+	case "update":
+		id, ok := intArg(args["step"])
+		if !ok {
+			return tools.ErrorResult("plan: \"update\" requires a step number")
+		}
+		step := plan.step(id)
+		if step == nil {
+			return tools.ErrorResult(fmt.Sprintf("plan: step %d does not exist", id))
+		}
+		if raw, ok := args["status"].(string); ok && raw != "" {
+			status, valid := parsePlanStepStatus(raw)
+			if !valid {
+				return tools.ErrorResult(fmt.Sprintf("plan: unknown status %q", raw))
+			}
+			step.Status = status
+		}
+		if note, ok := args["note"].(string); ok {
+			step.Note = strings.TrimSpace(note)
+		}
+		return t.save(store, plan)
+	default:
+		return tools.ErrorResult(fmt.Sprintf("plan: unknown action %q", action))
+	}
+}
+
+func (t *planTool) save(store *planStore, plan *SessionPlan) *tools.ToolResult {
+	if err := store.Save(plan); err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+	return tools.SilentResult(plan.Render())
+}
+
+func stringSliceArg(v any) []string {
+	raw, _ := v.([]any)
+	out := make([]string, 0, len(raw))
+	for _, item := range raw {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func intArg(v any) (int, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	}
+	return 0, false
+}
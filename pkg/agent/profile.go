@@ -0,0 +1,192 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// profilesDirName is the workspace directory holding one subdirectory per
+// profile.
+const profilesDirName = "profiles"
+
+// Profile is a named persona inside an agent's workspace. Its directory holds
+// its own bootstrap files (AGENT.md, SOUL.md, USER.md, ...) which replace the
+// workspace's. The AGENT.md frontmatter may narrow the agent's tools and
+// skills and pick another model from model_list.
+type Profile struct {
+	Name        string
+	Description string
+	Dir         string
+	Model       string
+	Tools       []string
+	Skills      []string
+}
+
+// profileSet finds the profiles of a workspace and remembers which one each
+// session key uses. One set serves every session of an agent.
+type profileSet struct {
+	workspace string
+	base      *ContextBuilder
+	path      string // persisted selections
+
+	mu       sync.Mutex
+	selected map[string]string // session key -> profile name
+	builders map[string]*ContextBuilder
+}
+
+func newProfileSet(workspace string, base *ContextBuilder) *profileSet {
+	s := &profileSet{
+		workspace: workspace,
+		base:      base,
+		path:      filepath.Join(workspace, "state", "profiles.json"),
+		selected:  make(map[string]string),
+		builders:  make(map[string]*ContextBuilder),
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.WarnCF("agent", "Failed to read profile selections", map[string]any{"path": s.path, "error": err.Error()})
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.selected); err != nil {
+		logger.WarnCF("agent", "Failed to decode profile selections", map[string]any{"path": s.path, "error": err.Error()})
+		s.selected = make(map[string]string)
+	}
+	return s
+}
+
+// List returns the workspace's profiles sorted by name.
+func (s *profileSet) List() []*Profile {
+	if s == nil {
+		return nil
+	}
+	entries, err := os.ReadDir(filepath.Join(s.workspace, profilesDirName))
+	if err != nil {
+		return nil
+	}
+	var profiles []*Profile
+	for _, entry := range entries {
+		if entry.IsDir() {
+			profiles = append(profiles, loadProfile(filepath.Join(s.workspace, profilesDirName, entry.Name())))
+		}
+	}
+	return profiles
+}
+
+// Load returns the named profile.
+func (s *profileSet) Load(name string) (*Profile, error) {
+	if s == nil {
+		return nil, fmt.Errorf("profile %q not found", name)
+	}
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, fmt.Errorf("invalid profile name %q", name)
+	}
+	dir := filepath.Join(s.workspace, profilesDirName, name)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("profile %q not found in %s", name, filepath.Join(s.workspace, profilesDirName))
+	}
+	return loadProfile(dir), nil
+}
+
+func loadProfile(dir string) *Profile {
+	p := &Profile{Name: filepath.Base(dir), Dir: dir}
+	if def := loadAgentDefinition(dir); def.Agent != nil {
+		fm := def.Agent.Frontmatter
+		p.Description = fm.Description
+		p.Model = fm.Model
+		p.Tools = fm.Tools
+		p.Skills = fm.Skills
+	}
+	return p
+}
+
+// Selected returns the profile chosen for a session, or "" for none.
+func (s *profileSet) Selected(sessionKey string) string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.selected[sessionKey]
+}
+
+// Select sets the session's profile; an empty name goes back to the
+// workspace's own files.
+func (s *profileSet) Select(sessionKey, name string) error {
+	if s == nil {
+		return fmt.Errorf("profiles are not available")
+	}
+	if name != "" {
+		if _, err := s.Load(name); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if name == "" {
+		delete(s.selected, sessionKey)
+	} else {
+		s.selected[sessionKey] = name
+	}
+	data, err := json.MarshalIndent(s.selected, "", "  ")
+	if err != nil {
+		return fmt.Errorf("profile: encode: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return fmt.Errorf("profile: create dir: %w", err)
+	}
+	return fileutil.WriteFileAtomic(s.path, data, 0o644)
+}
+
+// contextBuilder returns the builder for a profile. Builders are kept per
+// profile and skill list so each keeps its system prompt cache.
+func (s *profileSet) contextBuilder(p *Profile) *ContextBuilder {
+	key := p.Name + "\x00" + strings.Join(p.Skills, ",")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cb, ok := s.builders[key]
+	if !ok {
+		cb = s.base.forProfile(p.Dir, p.Skills)
+		s.builders[key] = cb
+	}
+	return cb
+}
+
+// applyProfile returns the agent as the session's profile shapes it: a copy
+// with the profile's bootstrap files, tools and model, or the agent itself
+// when the session uses none.
+func (al *AgentLoop) applyProfile(agent *AgentInstance, sessionKey string) *AgentInstance {
+	name := agent.Profiles.Selected(sessionKey)
+	if name == "" {
+		return agent
+	}
+	p, err := agent.Profiles.Load(name)
+	if err != nil {
+		logger.WarnCF("agent", "Session profile unavailable; using the workspace files",
+			map[string]any{"agent_id": agent.ID, "session_key": sessionKey, "error": err.Error()})
+		return agent
+	}
+
+	profiled := *restrictTools(agent, tools.PolicyFilter(&config.ToolPolicy{Allow: p.Tools}))
+	profiled.ContextBuilder = agent.Profiles.contextBuilder(p)
+	if len(p.Skills) > 0 {
+		profiled.SkillsFilter = p.Skills
+	}
+	if p.Model != "" && p.Model != agent.Model {
+		if !switchAgentModel(al.GetConfig(), &profiled, p.Model) {
+			logger.WarnCF("agent", "Profile model not resolved; using the agent's model",
+				map[string]any{"profile": p.Name, "model": p.Model, "agent_model": agent.Model})
+		}
+	}
+	return &profiled
+}
@@ -0,0 +1,137 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// profileProvider records the system prompt, tools and model of each call.
+type profileProvider struct {
+	mu     sync.Mutex
+	system string
+	tools  []string
+	model  string
+}
+
+func (p *profileProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.system = messages[0].Content
+	p.model = model
+	p.tools = nil
+	for _, def := range defs {
+		p.tools = append(p.tools, def.Function.Name)
+	}
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *profileProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProfile_SwitchedPerSession(t *testing.T) {
+	workspace := t.TempDir()
+	writeTestFile(t, filepath.Join(workspace, "AGENT.md"), "You are a generalist.")
+	writeTestFile(t, filepath.Join(workspace, "USER.md"), "The user likes tea.")
+	writeTestFile(t, filepath.Join(workspace, "skills", "golang", "SKILL.md"),
+		"---\nname: golang\ndescription: Go tips\n---\nUse gofmt.")
+	writeTestFile(t, filepath.Join(workspace, "skills", "cooking", "SKILL.md"),
+		"---\nname: cooking\ndescription: Recipes\n---\nBoil water.")
+	writeTestFile(t, filepath.Join(workspace, "profiles", "coder", "AGENT.md"),
+		"---\ndescription: Coding helper\nmodel: cheap-model\ntools: [echo_text]\nskills: [golang]\n---\nYou write code.")
+
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         workspace,
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		ModelList: []*config.ModelConfig{
+			{ModelName: "test-model", Model: "openai/test-model"},
+			{ModelName: "cheap-model", Model: "openai/cheap-model"},
+		},
+		Session: config.SessionConfig{DMScope: "per-peer"},
+	}
+	provider := &profileProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	t.Cleanup(al.Close)
+	agent := al.GetRegistry().GetDefaultAgent()
+	agent.Tools.Register(&echoTextTool{})
+	agent.Tools.Register(&mockCustomTool{})
+
+	send := func(peer, content string) string {
+		t.Helper()
+		resp, err := al.processMessage(context.Background(), bus.InboundMessage{
+			Channel:  "telegram",
+			SenderID: peer,
+			ChatID:   peer,
+			Content:  content,
+			Peer:     bus.Peer{Kind: "direct", ID: peer},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	if resp := send("group1", "/profile coder"); resp != "Switched to profile coder" {
+		t.Fatalf("/profile coder = %q", resp)
+	}
+	send("group1", "hi")
+	if !strings.Contains(provider.system, "You write code.") || strings.Contains(provider.system, "generalist") {
+		t.Fatalf("profile system prompt:\n%s", provider.system)
+	}
+	if !strings.Contains(provider.system, "The user likes tea.") {
+		t.Fatal("profile without USER.md should use the workspace's")
+	}
+	if !strings.Contains(provider.system, "<name>golang</name>") || strings.Contains(provider.system, "<name>cooking</name>") {
+		t.Fatalf("profile skills not narrowed:\n%s", provider.system)
+	}
+	if strings.Join(provider.tools, ",") != "echo_text" || provider.model != "cheap-model" {
+		t.Fatalf("tools = %v, model = %q", provider.tools, provider.model)
+	}
+
+	// Another chat keeps the agent's own files, tools and model.
+	send("group2", "hi")
+	if !strings.Contains(provider.system, "You are a generalist.") || !strings.Contains(provider.system, "<name>cooking</name>") {
+		t.Fatalf("default system prompt:\n%s", provider.system)
+	}
+	if len(provider.tools) < 2 || provider.model != "test-model" {
+		t.Fatalf("tools = %v, model = %q", provider.tools, provider.model)
+	}
+
+	// The choice is persisted per session key.
+	if got := newProfileSet(workspace, nil).Selected("agent:main:direct:group1"); got != "coder" {
+		t.Fatalf("persisted profile = %q", got)
+	}
+	if resp := send("group1", "/profile nope"); !strings.Contains(resp, `profile "nope" not found`) {
+		t.Fatalf("/profile nope = %q", resp)
+	}
+}
@@ -0,0 +1,257 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const (
+	defaultRefinePassScore     = 8
+	defaultRefineMaxIterations = 3
+	maxRefineScore             = 10
+)
+
+var refineScorePattern = regexp.MustCompile(`(?i)score\W{0,5}(\d+(?:\.\d+)?)`)
+
+// refineRound records one worker draft and its evaluation.
+type refineRound struct {
+	Draft    string
+	Score    float64
+	Feedback string
+}
+
+// refineTool runs the evaluator-optimizer loop: a worker sub-turn drafts, an
+// evaluator sub-turn scores the draft against the criteria, and the worker
+// revises with the feedback until the draft passes or iterations run out.
+// The worker keeps its own conversation between iterations.
+type refineTool struct {
+	cfg config.RefineToolConfig
+}
+
+func newRefineTool(cfg config.RefineToolConfig) *refineTool {
+	return &refineTool{cfg: cfg}
+}
+
+func (t *refineTool) Name() string {
+	return "evaluate_and_refine"
+}
+
+func (t *refineTool) Description() string {
+	return "Produce a high-quality result through draft and review. A worker subagent drafts the result, an " +
+		"evaluator subagent scores it from 0 to 10 against your criteria, and the worker revises with the " +
+		"evaluator's feedback until the score reaches the pass score or the iterations run out. Returns the " +
+		"best draft and the score history."
+}
+
+func (t *refineTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"task": map[string]any{
+				"type":        "string",
+				"description": "What the worker must produce, with all the context it needs.",
+			},
+			"criteria": map[string]any{
+				"type":        "string",
+				"description": "What the evaluator checks, e.g. correctness, completeness, tone, length.",
+			},
+			"pass_score": map[string]any{
+				"type":        "number",
+				"description": fmt.Sprintf("Score from 0 to 10 that ends the loop (default %g).", t.passScore()),
+			},
+			"max_iterations": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Maximum draft/evaluate rounds (default and max %d).", t.maxIterations()),
+			},
+			"worker_model": map[string]any{
+				"type":        "string",
+				"description": "Model name from the model list for the worker (default: your own model).",
+			},
+			"evaluator_model": map[string]any{
+				"type":        "string",
+				"description": "Model name from the model list for the evaluator.",
+			},
+			"worker_tools": map[string]any{
+				"type":        "array",
+				"items":       map[string]any{"type": "string"},
+				"description": "Names of the tools the worker may use (default: all of yours).",
+			},
+		},
+		"required": []string{"task", "criteria"},
+	}
+}
+
+func (t *refineTool) passScore() float64 {
+	if t.cfg.PassScore > 0 {
+		return t.cfg.PassScore
+	}
+	return defaultRefinePassScore
+}
+
+func (t *refineTool) maxIterations() int {
+	if t.cfg.MaxIterations > 0 {
+		return t.cfg.MaxIterations
+	}
+	return defaultRefineMaxIterations
+}
+
+func (t *refineTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	ts := turnStateFromContext(ctx)
+	if ts == nil || ts.agent == nil || AgentLoopFromContext(ctx) == nil {
+		return tools.ErrorResult("evaluate_and_refine: must be called from within an agent turn")
+	}
+
+	task, _ := args["task"].(string)
+	criteria, _ := args["criteria"].(string)
+	task, criteria = strings.TrimSpace(task), strings.TrimSpace(criteria)
+	if task == "" || criteria == "" {
+		return tools.ErrorResult("evaluate_and_refine: task and criteria are required")
+	}
+	passScore := t.passScore()
+	if v, ok := args["pass_score"].(float64); ok && v > 0 {
+		passScore = min(v, maxRefineScore)
+	}
+	iterations := t.maxIterations()
+	if n, ok := intArg(args["max_iterations"]); ok && n > 0 {
+		iterations = min(n, iterations)
+	}
+	workerModel := stringArgOr(args["worker_model"], ts.agent.Model)
+	evaluatorModel := stringArgOr(args["evaluator_model"], stringArgOr(t.cfg.EvaluatorModel, ts.agent.Model))
+	workerTools, err := lookupTools(ts.agent.Tools, stringSliceArg(args["worker_tools"]))
+	if err != nil {
+		err = fmt.Errorf("evaluate_and_refine: %w", err)
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+
+	workerBrief := "Produce the result for the task below. It will be scored against the criteria, so " +
+		"check it against them yourself before answering. Reply with the complete result only.\n\n" +
+		"Task: " + task + "\n\nCriteria: " + criteria
+
+	var rounds []refineRound
+	var transcript []providers.Message
+	for i := 1; i <= iterations; i++ {
+		worker := SubTurnConfig{
+			Model:        workerModel,
+			Tools:        workerTools,
+			SystemPrompt: workerBrief,
+			Label:        fmt.Sprintf("refine worker %d/%d", i, iterations),
+		}
+		if i > 1 {
+			// Resume the worker's own conversation after its task message.
+			prev := rounds[len(rounds)-1]
+			worker.InitialMessages = append(append([]providers.Message(nil), transcript[1:]...), providers.Message{
+				Role: "user",
+				Content: fmt.Sprintf("Your result scored %g/%d; it needs %g to pass. Evaluator feedback:\n\n%s\n\n"+
+					"Revise the result to address the feedback and reply with the complete new version.",
+					prev.Score, maxRefineScore, passScore, prev.Feedback),
+			})
+		}
+		res, err := SpawnSubTurn(ctx, worker)
+		if err != nil {
+			if len(rounds) == 0 {
+				err = fmt.Errorf("evaluate_and_refine: worker failed: %w", err)
+				return tools.ErrorResult(err.Error()).WithError(err)
+			}
+			break
+		}
+		transcript = res.Messages
+		if len(transcript) == 0 || transcript[0].Role != "user" {
+			// Without the worker's conversation the next round starts over.
+			transcript = []providers.Message{{Role: "user"}, {Role: "assistant", Content: res.ForLLM}}
+		}
+		round := refineRound{Draft: strings.TrimSpace(res.ForLLM)}
+
+		eval, err := SpawnSubTurn(ctx, SubTurnConfig{
+			Model: evaluatorModel,
+			SystemPrompt: fmt.Sprintf("Evaluate the result below strictly against the criteria. Reply with JSON only: "+
+				`{"score": <0-%d>, "feedback": "<what must change to pass; empty if nothing>"}.`+
+				" A score of %g or more passes.\n\nTask: %s\n\nCriteria: %s\n\nResult:\n\n%s",
+				maxRefineScore, passScore, task, criteria, round.Draft),
+			Label: fmt.Sprintf("refine evaluator %d/%d", i, iterations),
+		})
+		if err != nil {
+			round.Feedback = fmt.Sprintf("(evaluation failed: %v)", err)
+			rounds = append(rounds, round)
+			break
+		}
+		round.Score, round.Feedback = parseEvaluation(eval.ForLLM)
+		rounds = append(rounds, round)
+		if round.Score >= passScore {
+			break
+		}
+	}
+
+	return &tools.ToolResult{ForLLM: formatRefineResult(rounds, passScore), ForUser: refineSummary(rounds, passScore)}
+}
+
+// parseEvaluation reads the score and feedback from an evaluator reply. It
+// accepts the requested JSON, JSON wrapped in prose or code fences, and
+// falls back to a "score: N" phrase. Unreadable replies score 0.
+func parseEvaluation(reply string) (float64, string) {
+	reply = strings.TrimSpace(reply)
+	if start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}"); start >= 0 && end > start {
+		var eval struct {
+			Score    float64 `json:"score"`
+			Feedback string  `json:"feedback"`
+		}
+		if err := json.Unmarshal([]byte(reply[start:end+1]), &eval); err == nil {
+			return max(0, min(eval.Score, maxRefineScore)), strings.TrimSpace(eval.Feedback)
+		}
+	}
+	if m := refineScorePattern.FindStringSubmatch(reply); m != nil {
+		score, _ := strconv.ParseFloat(m[1], 64)
+		return max(0, min(score, maxRefineScore)), reply
+	}
+	return 0, reply
+}
+
+func bestRefineRound(rounds []refineRound) refineRound {
+	best := rounds[0]
+	for _, r := range rounds[1:] {
+		if r.Score >= best.Score {
+			best = r
+		}
+	}
+	return best
+}
+
+func refineSummary(rounds []refineRound, passScore float64) string {
+	last := rounds[len(rounds)-1]
+	if last.Score >= passScore {
+		return fmt.Sprintf("Passed with a score of %g/%d after %d iteration(s).", last.Score, maxRefineScore, len(rounds))
+	}
+	return fmt.Sprintf("Did not reach the pass score of %g in %d iteration(s); best score %g/%d.",
+		passScore, len(rounds), bestRefineRound(rounds).Score, maxRefineScore)
+}
+
+func formatRefineResult(rounds []refineRound, passScore float64) string {
+	var sb strings.Builder
+	sb.WriteString(refineSummary(rounds, passScore))
+	sb.WriteString("\n\n## Result\n\n")
+	sb.WriteString(bestRefineRound(rounds).Draft)
+	sb.WriteString("\n\n## Iterations\n")
+	for i, r := range rounds {
+		feedback := r.Feedback
+		if feedback == "" {
+			feedback = "(no feedback)"
+		}
+		fmt.Fprintf(&sb, "\n%d. Score %g/%d: %s", i+1, r.Score, maxRefineScore, feedback)
+	}
+	return sb.String()
+}
+
+// stringArgOr returns v trimmed when it is a non-empty string, else def.
+func stringArgOr(v any, def string) string {
+	if s, ok := v.(string); ok && strings.TrimSpace(s) != "" {
+		return strings.TrimSpace(s)
+	}
+	return def
+}
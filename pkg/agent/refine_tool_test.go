@@ -0,0 +1,115 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// refineProvider plays both roles: the worker answers "draft v1" and then
+// "draft v2" once it has seen feedback; the evaluator fails v1 and passes v2.
+type refineProvider struct {
+	mu      sync.Mutex
+	workers [][]providers.Message
+	models  map[string]string
+}
+
+func (p *refineProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var all strings.Builder
+	for _, m := range messages[1:] {
+		all.WriteString(m.Content + "\n")
+	}
+	if strings.Contains(all.String(), "Evaluate the result") {
+		p.models["evaluator"] = model
+		if strings.Contains(all.String(), "draft v2") {
+			return &providers.LLMResponse{Content: `{"score": 9, "feedback": ""}`}, nil
+		}
+		return &providers.LLMResponse{Content: "```json\n{\"score\": 4, \"feedback\": \"Add an example.\"}\n```"}, nil
+	}
+	p.models["worker"] = model
+	p.workers = append(p.workers, messages)
+	if strings.Contains(all.String(), "Evaluator feedback") {
+		return &providers.LLMResponse{Content: "draft v2"}, nil
+	}
+	return &providers.LLMResponse{Content: "draft v1"}, nil
+}
+
+func (p *refineProvider) GetDefaultModel() string {
+	return "refine-provider"
+}
+
+func TestRefineTool_RevisesUntilPassScore(t *testing.T) {
+	provider := &refineProvider{models: map[string]string{}}
+	ctx, parent := newTeamTestContext(t, provider)
+	sub := AgentLoopFromContext(ctx).SubscribeEvents(256)
+	defer AgentLoopFromContext(ctx).UnsubscribeEvents(sub.ID)
+
+	res := newRefineTool(config.RefineToolConfig{EvaluatorModel: "cheap-model"}).Execute(ctx, map[string]any{
+		"task":     "Write a haiku about boards",
+		"criteria": "Has an example",
+	})
+	if res.IsError || !strings.Contains(res.ForLLM, "Passed with a score of 9/10 after 2 iteration(s)") ||
+		!strings.Contains(res.ForLLM, "## Result\n\ndraft v2") ||
+		!strings.Contains(res.ForLLM, "1. Score 4/10: Add an example.") {
+		t.Fatalf("result = %+v", res)
+	}
+	if provider.models["evaluator"] != "cheap-model" || provider.models["worker"] != parent.agent.Model {
+		t.Fatalf("models = %v", provider.models)
+	}
+
+	// The second worker run resumes its own conversation: the task, its
+	// first draft, then the feedback.
+	second := provider.workers[1]
+	if len(second) != 4 || second[1].Role != "user" || second[2].Content != "draft v1" ||
+		!strings.Contains(second[3].Content, "Add an example.") {
+		t.Fatalf("second worker messages = %+v", second)
+	}
+
+	var labels []string
+	for len(labels) < 4 {
+		select {
+		case evt := <-sub.C:
+			if p, ok := evt.Payload.(SubTurnSpawnPayload); ok {
+				labels = append(labels, p.Label)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("spawn events = %v, want four", labels)
+		}
+	}
+	want := "refine worker 1/3,refine evaluator 1/3,refine worker 2/3,refine evaluator 2/3"
+	if got := strings.Join(labels, ","); got != want {
+		t.Fatalf("spawn labels = %s, want %s", got, want)
+	}
+}
+
+func TestParseEvaluation(t *testing.T) {
+	tests := []struct {
+		reply    string
+		score    float64
+		feedback string
+	}{
+		{`{"score": 7.5, "feedback": "Shorter."}`, 7.5, "Shorter."},
+		{"Here you go:\n```json\n{\"score\": 12}\n```", 10, ""},
+		{"Score: 6 - needs tests", 6, "Score: 6 - needs tests"},
+		{"looks fine", 0, "looks fine"},
+	}
+	for _, tt := range tests {
+		score, feedback := parseEvaluation(tt.reply)
+		if score != tt.score || feedback != tt.feedback {
+			t.Errorf("parseEvaluation(%q) = %g, %q; want %g, %q", tt.reply, score, feedback, tt.score, tt.feedback)
+		}
+	}
+}
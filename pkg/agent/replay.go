@@ -0,0 +1,344 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/session"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// TurnReplayResult reports how a replayed turn compares to its trace.
+type TurnReplayResult struct {
+	Status       TurnEndStatus
+	FinalContent string
+	LLMCalls     int
+	ToolCalls    int
+	// Divergences lists every point where the replay did not match the
+	// recording, in the order they were found.
+	Divergences []string
+}
+
+// Diverged reports whether the replay differed from the recorded turn.
+func (r *TurnReplayResult) Diverged() bool {
+	return len(r.Divergences) > 0
+}
+
+// ReplayTurn re-runs a recorded turn through runTurn using the current
+// config and workspace prompt, but with a provider and tools that return
+// the recorded responses. Nothing is sent to a model, no real tool runs,
+// and the session store is an in-memory copy of the recorded history.
+//
+// Hooks, turn tracing, tool feedback and plan mode are disabled for the
+// replay, and the plan block of the system prompt is not compared. Any
+// difference in the requests sent to the provider, the tool calls made or
+// the final answer is reported as a divergence.
+func ReplayTurn(ctx context.Context, cfg *config.Config, trace *TurnTrace) (*TurnReplayResult, error) {
+	if trace == nil {
+		return nil, fmt.Errorf("replay: trace is required")
+	}
+
+	replayCfg := *cfg
+	replayCfg.Hooks.Enabled = false
+	replayCfg.Agents.Defaults.TurnTrace.Enabled = false
+	replayCfg.Agents.Defaults.ToolFeedback.Enabled = false
+	replayCfg.Agents.Defaults.PlanMode = false
+
+	rec := &replayRecorder{}
+	provider := &replayProvider{trace: trace, rec: rec}
+
+	msgBus := bus.NewMessageBus()
+	defer msgBus.Close()
+	al := NewAgentLoop(&replayCfg, msgBus, provider)
+	defer al.Close()
+
+	agent, ok := al.GetRegistry().GetAgent(trace.AgentID)
+	if !ok {
+		return nil, fmt.Errorf("replay: agent %q from trace is not configured", trace.AgentID)
+	}
+
+	sessions := session.NewSessionManager("")
+	sessions.SetHistory(trace.SessionKey, cloneProviderMessages(trace.History))
+	if trace.Summary != "" {
+		sessions.SetSummary(trace.SessionKey, trace.Summary)
+	}
+	if agent.Sessions != nil {
+		_ = agent.Sessions.Close()
+	}
+	agent.Sessions = sessions
+	agent.Checkpoints = nil
+	agent.Provider = provider
+	agent.Tools = newReplayToolRegistry(trace, rec)
+
+	opts := processOptions{
+		SessionKey:        trace.SessionKey,
+		Channel:           trace.Channel,
+		ChatID:            trace.ChatID,
+		SenderID:          trace.SenderID,
+		SenderDisplayName: trace.SenderName,
+		UserMessage:       trace.UserMessage,
+		Media:             append([]string(nil), trace.Media...),
+		DefaultResponse:   defaultResponse,
+	}
+	ts := newTurnState(agent, opts, al.newTurnEventScope(agent.ID, opts.SessionKey))
+	result, runErr := al.runTurn(ctx, ts)
+
+	res := &TurnReplayResult{
+		Status:       result.status,
+		FinalContent: result.finalContent,
+		LLMCalls:     provider.calls,
+		ToolCalls:    rec.toolCalls,
+		Divergences:  rec.divergences,
+	}
+	if runErr != nil {
+		res.Status = TurnEndStatusError
+		res.add("turn failed: %v", runErr)
+	}
+	if res.LLMCalls != len(trace.LLMCalls) {
+		res.add("made %d LLM calls, trace has %d", res.LLMCalls, len(trace.LLMCalls))
+	}
+	if res.ToolCalls != len(trace.ToolCalls) {
+		res.add("made %d tool calls, trace has %d", res.ToolCalls, len(trace.ToolCalls))
+	}
+	if runErr == nil && res.FinalContent != trace.FinalContent {
+		res.add("final content differs:\n  recorded: %q\n  replayed: %q", trace.FinalContent, res.FinalContent)
+	}
+	return res, nil
+}
+
+func (r *TurnReplayResult) add(format string, args ...any) {
+	r.Divergences = append(r.Divergences, fmt.Sprintf(format, args...))
+}
+
+// replayRecorder collects divergences from the stub provider and tools.
+type replayRecorder struct {
+	mu          sync.Mutex
+	toolCalls   int
+	used        []bool
+	divergences []string
+}
+
+func (r *replayRecorder) diverge(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.divergences = append(r.divergences, fmt.Sprintf(format, args...))
+}
+
+// replayProvider answers each Chat call with the next recorded response.
+type replayProvider struct {
+	trace *TurnTrace
+	rec   *replayRecorder
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *replayProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	toolDefs []providers.ToolDefinition,
+	model string,
+	options map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	idx := p.calls
+	p.calls++
+	p.mu.Unlock()
+
+	if idx >= len(p.trace.LLMCalls) {
+		return nil, fmt.Errorf("replay: no recorded response for LLM call %d", idx+1)
+	}
+	recorded := p.trace.LLMCalls[idx]
+	if diff := diffTraceMessages(recorded.Messages, messages); diff != "" {
+		p.rec.diverge("LLM call %d: %s", idx+1, diff)
+	}
+	if diff := diffTraceToolDefs(recorded.Tools, toolDefs); diff != "" {
+		p.rec.diverge("LLM call %d: %s", idx+1, diff)
+	}
+	return cloneLLMResponse(recorded.Response), nil
+}
+
+func (p *replayProvider) GetDefaultModel() string {
+	if len(p.trace.LLMCalls) > 0 {
+		return p.trace.LLMCalls[0].Model
+	}
+	return ""
+}
+
+// replayTool stands in for a recorded tool. Calls are matched to the
+// recording in order per tool name.
+type replayTool struct {
+	def   providers.ToolDefinition
+	trace *TurnTrace
+	rec   *replayRecorder
+}
+
+func newReplayToolRegistry(trace *TurnTrace, rec *replayRecorder) *tools.ToolRegistry {
+	rec.used = make([]bool, len(trace.ToolCalls))
+
+	registry := tools.NewToolRegistry()
+	seen := make(map[string]bool)
+	for _, def := range trace.Tools {
+		seen[def.Function.Name] = true
+		registry.Register(&replayTool{def: def, trace: trace, rec: rec})
+	}
+	// Tools that were hidden from the model at turn start still need a stub.
+	for _, call := range trace.ToolCalls {
+		if seen[call.Tool] {
+			continue
+		}
+		seen[call.Tool] = true
+		registry.Register(&replayTool{
+			def: providers.ToolDefinition{
+				Type:     "function",
+				Function: providers.ToolFunctionDefinition{Name: call.Tool},
+			},
+			trace: trace,
+			rec:   rec,
+		})
+	}
+	return registry
+}
+
+func (t *replayTool) Name() string {
+	return t.def.Function.Name
+}
+
+func (t *replayTool) Description() string {
+	return t.def.Function.Description
+}
+
+func (t *replayTool) Parameters() map[string]any {
+	if t.def.Function.Parameters == nil {
+		return map[string]any{"type": "object", "properties": map[string]any{}}
+	}
+	return t.def.Function.Parameters
+}
+
+func (t *replayTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	name := t.Name()
+
+	t.rec.mu.Lock()
+	t.rec.toolCalls++
+	callNum := t.rec.toolCalls
+	idx := -1
+	for i, call := range t.trace.ToolCalls {
+		if !t.rec.used[i] && call.Tool == name {
+			idx = i
+			t.rec.used[i] = true
+			break
+		}
+	}
+	t.rec.mu.Unlock()
+
+	if idx < 0 {
+		t.rec.diverge("tool call %d: %s was not called in the trace", callNum, name)
+		return tools.ErrorResult(fmt.Sprintf("replay: no recorded result for %s", name))
+	}
+
+	recorded := t.trace.ToolCalls[idx]
+	if idx != callNum-1 {
+		t.rec.diverge("tool call %d: %s was call %d in the trace", callNum, name, idx+1)
+	}
+	if !reflect.DeepEqual(normalizeTraceArgs(recorded.Arguments), normalizeTraceArgs(args)) {
+		t.rec.diverge("tool call %d: %s arguments differ:\n  recorded: %v\n  replayed: %v",
+			callNum, name, recorded.Arguments, args)
+	}
+
+	result := cloneToolResult(recorded.Result)
+	if result == nil {
+		result = &tools.ToolResult{}
+	}
+	if recorded.Error != "" {
+		result.Err = errors.New(recorded.Error)
+	}
+	return result
+}
+
+// normalizeTraceArgs maps nil and empty argument maps to the same value,
+// since JSON decoding of a recorded {} yields nil.
+func normalizeTraceArgs(args map[string]any) map[string]any {
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// diffTraceMessages describes the first difference between a recorded and a
+// replayed request, or returns "". The per-request part of the system
+// prompt (current time, runtime) and the session plan are ignored.
+func diffTraceMessages(recorded, replayed []providers.Message) string {
+	n := min(len(recorded), len(replayed))
+	for i := 0; i < n; i++ {
+		want, got := recorded[i], replayed[i]
+		switch {
+		case want.Role != got.Role:
+			return fmt.Sprintf("message %d role is %q, trace has %q", i, got.Role, want.Role)
+		case want.Role == "system":
+			if stableSystemPrompt(want) != stableSystemPrompt(got) {
+				return fmt.Sprintf("message %d: system prompt differs", i)
+			}
+		case want.Content != got.Content:
+			return fmt.Sprintf("message %d (%s): content differs:\n  recorded: %q\n  replayed: %q",
+				i, want.Role, want.Content, got.Content)
+		case want.ToolCallID != got.ToolCallID:
+			return fmt.Sprintf("message %d (%s): tool_call_id is %q, trace has %q",
+				i, want.Role, got.ToolCallID, want.ToolCallID)
+		case !sameTraceToolCalls(want.ToolCalls, got.ToolCalls):
+			return fmt.Sprintf("message %d (%s): tool calls differ", i, want.Role)
+		}
+	}
+	if len(recorded) != len(replayed) {
+		return fmt.Sprintf("request has %d messages, trace has %d", len(replayed), len(recorded))
+	}
+	return ""
+}
+
+func stableSystemPrompt(msg providers.Message) string {
+	if len(msg.SystemParts) == 0 {
+		return msg.Content
+	}
+	parts := make([]string, 0, len(msg.SystemParts))
+	for _, part := range msg.SystemParts {
+		if strings.HasPrefix(part.Text, "## Current Time") || strings.HasPrefix(part.Text, planPromptHeader) {
+			continue
+		}
+		parts = append(parts, part.Text)
+	}
+	return strings.Join(parts, "\n")
+}
+
+func sameTraceToolCalls(a, b []providers.ToolCall) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := providers.NormalizeToolCall(a[i]), providers.NormalizeToolCall(b[i])
+		if x.ID != y.ID || x.Name != y.Name || !reflect.DeepEqual(x.Arguments, y.Arguments) {
+			return false
+		}
+	}
+	return true
+}
+
+func diffTraceToolDefs(recorded, replayed []providers.ToolDefinition) string {
+	names := func(defs []providers.ToolDefinition) []string {
+		out := make([]string, 0, len(defs))
+		for _, def := range defs {
+			out = append(out, def.Function.Name)
+		}
+		return out
+	}
+	want, got := names(recorded), names(replayed)
+	if !reflect.DeepEqual(want, got) {
+		return fmt.Sprintf("tools offered %v, trace has %v", got, want)
+	}
+	return ""
+}
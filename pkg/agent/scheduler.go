@@ -0,0 +1,268 @@
+package agent
+
+import (
+	"context"
+	"sync"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/routing"
+)
+
+// Message priorities, highest first.
+const (
+	priorityOwner = iota
+	priorityDirect
+	priorityGroup
+	numPriorities
+)
+
+// queuedMessage is an inbound message, or a task such as the recovery of an
+// interrupted turn, waiting for its session's turn.
+type queuedMessage struct {
+	msg      bus.InboundMessage
+	task     func(context.Context)
+	priority int
+}
+
+// scheduledSession is the queue of inbound messages for one session key.
+type scheduledSession struct {
+	key     string
+	channel string
+	pending []queuedMessage
+	running bool // a worker is running this session's turn
+	// task is set while the running turn is a submitted task rather than a
+	// message. Messages arriving meanwhile queue instead of steering.
+	task    func(context.Context)
+	waiting bool // queued in turnScheduler.waiting at level
+	level   int
+}
+
+// turnScheduler decides which inbound message starts a turn next. Sessions
+// run concurrently up to limit, but each session runs one turn at a time.
+// Waiting sessions are served by priority, and within a priority round-robin
+// across channels so one busy channel cannot starve the others.
+type turnScheduler struct {
+	mu       sync.Mutex
+	limit    int
+	active   int
+	sessions map[string]*scheduledSession
+
+	// For each priority: channels with waiting sessions in round-robin
+	// order, and each channel's waiting sessions in arrival order.
+	channels [numPriorities][]string
+	waiting  [numPriorities]map[string][]*scheduledSession
+
+	// wake is signaled when a slot is freed or a task is queued, so the
+	// dispatcher can call next again without polling.
+	wake chan struct{}
+}
+
+func newTurnScheduler(limit int) *turnScheduler {
+	s := &turnScheduler{
+		limit:    max(limit, 1),
+		sessions: make(map[string]*scheduledSession),
+		wake:     make(chan struct{}, 1),
+	}
+	for i := range s.waiting {
+		s.waiting[i] = make(map[string][]*scheduledSession)
+	}
+	return s
+}
+
+// submit queues msg for the session key. When the session is running a turn,
+// steer is tried first; if it reports true the message joined the running
+// turn and is not queued. steer runs under the scheduler lock, so it cannot
+// race with the worker deciding the session is done.
+func (s *turnScheduler) submit(key string, priority int, msg bus.InboundMessage, steer func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess := s.session(key, msg.Channel)
+	if sess.running && sess.task == nil && steer != nil && steer() {
+		return
+	}
+	s.enqueue(sess, queuedMessage{msg: msg, priority: priority})
+}
+
+// submitTask queues task to run as a turn of the session key, serialized with
+// the session's messages like any other turn.
+func (s *turnScheduler) submitTask(key, channel string, priority int, task func(context.Context)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enqueue(s.session(key, channel), queuedMessage{task: task, priority: priority})
+	s.notify()
+}
+
+// session returns the scheduled session for key, creating it if needed. The
+// caller must hold s.mu.
+func (s *turnScheduler) session(key, channel string) *scheduledSession {
+	sess := s.sessions[key]
+	if sess == nil {
+		sess = &scheduledSession{key: key, channel: channel}
+		s.sessions[key] = sess
+	}
+	return sess
+}
+
+// enqueue appends q to the session's pending list and makes the session wait
+// for a slot unless it is running. The caller must hold s.mu.
+func (s *turnScheduler) enqueue(sess *scheduledSession, q queuedMessage) {
+	priority := q.priority
+	sess.pending = append(sess.pending, q)
+	if sess.running {
+		return
+	}
+	if sess.waiting && priority < sess.level {
+		// A more urgent message moves the whole session up.
+		s.unwait(sess)
+	}
+	if !sess.waiting {
+		s.wait(sess, priority)
+	}
+}
+
+// isRunning reports whether the session key has a turn in progress.
+func (s *turnScheduler) isRunning(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[key]
+	return sess != nil && sess.running
+}
+
+// next claims the most urgent waiting session and returns its first message.
+// When the first entry is a task, the message is empty and sess.task is set.
+// It returns false when nothing waits or every slot is busy.
+func (s *turnScheduler) next() (*scheduledSession, bus.InboundMessage, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active >= s.limit {
+		return nil, bus.InboundMessage{}, false
+	}
+	for level := range s.channels {
+		if len(s.channels[level]) == 0 {
+			continue
+		}
+		channel := s.channels[level][0]
+		queue := s.waiting[level][channel]
+		sess := queue[0]
+		s.unwait(sess)
+
+		next := sess.pending[0]
+		sess.pending = sess.pending[1:]
+		sess.running = true
+		sess.task = next.task
+		s.active++
+		return sess, next.msg, true
+	}
+	return nil, bus.InboundMessage{}, false
+}
+
+// finish is called by the worker when the session's turn is over. If
+// steering arrived after the turn's last check, hasSteering reports it and
+// the worker keeps the session to continue with it; finish returns true.
+// Otherwise the slot is freed and the session's next message, if any, waits
+// for its turn again.
+func (s *turnScheduler) finish(sess *scheduledSession, hasSteering func() bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if hasSteering() {
+		return true
+	}
+	sess.running = false
+	sess.task = nil
+	s.active--
+	s.notify()
+	if len(sess.pending) == 0 {
+		delete(s.sessions, sess.key)
+		return false
+	}
+	level := numPriorities - 1
+	for _, queued := range sess.pending {
+		level = min(level, queued.priority)
+	}
+	s.wait(sess, level)
+	return false
+}
+
+// notify signals wake without blocking; one pending signal is enough.
+func (s *turnScheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// wait appends the session to the waiting queue of its channel at level. The
+// caller must hold s.mu.
+func (s *turnScheduler) wait(sess *scheduledSession, level int) {
+	queue := s.waiting[level][sess.channel]
+	if len(queue) == 0 {
+		s.channels[level] = append(s.channels[level], sess.channel)
+	}
+	s.waiting[level][sess.channel] = append(queue, sess)
+	sess.waiting = true
+	sess.level = level
+}
+
+// unwait removes the session from the waiting queues. A channel that still
+// has waiting sessions moves to the back of the round-robin order. The caller
+// must hold s.mu.
+func (s *turnScheduler) unwait(sess *scheduledSession) {
+	level, channel := sess.level, sess.channel
+	queue := s.waiting[level][channel]
+	for i, queued := range queue {
+		if queued == sess {
+			queue = append(queue[:i:i], queue[i+1:]...)
+			break
+		}
+	}
+	order := s.channels[level]
+	for i, ch := range order {
+		if ch == channel {
+			order = append(order[:i:i], order[i+1:]...)
+			break
+		}
+	}
+	if len(queue) == 0 {
+		delete(s.waiting[level], channel)
+	} else {
+		s.waiting[level][channel] = queue
+		order = append(order, channel)
+	}
+	s.channels[level] = order
+	sess.waiting = false
+}
+
+// messagePriority ranks an inbound message: configured owners first, then
+// direct messages (and system follow-ups), then group and channel chatter.
+func (al *AgentLoop) messagePriority(msg bus.InboundMessage) int {
+	for _, owner := range al.GetConfig().Agents.Defaults.Scheduler.Owners {
+		if owner == msg.SenderID || identity.MatchAllowed(msg.Sender, owner) {
+			return priorityOwner
+		}
+	}
+	switch msg.Peer.Kind {
+	case "group", "channel":
+		return priorityGroup
+	}
+	return priorityDirect
+}
+
+// scheduleKey returns the key that serializes msg with the other turns on the
+// same session, and whether the message may steer a running turn there.
+func (al *AgentLoop) scheduleKey(msg bus.InboundMessage) (key, agentID string, steerable bool) {
+	if key, agentID, ok := al.resolveSteeringTarget(msg); ok {
+		return key, agentID, true
+	}
+	if msg.Channel == "system" {
+		// System follow-ups run on the default agent's main session.
+		if agent := al.GetRegistry().GetDefaultAgent(); agent != nil {
+			return routing.BuildAgentMainSessionKey(agent.ID), "", false
+		}
+	}
+	return "unrouted:" + msg.Channel + ":" + msg.ChatID, "", false
+}
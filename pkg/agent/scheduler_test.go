@@ -0,0 +1,215 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+func TestTurnScheduler_OrdersByPriorityThenChannel(t *testing.T) {
+	s := newTurnScheduler(10)
+	submit := func(key, channel string, priority int) {
+		s.submit(key, priority, bus.InboundMessage{Channel: channel, Content: key}, nil)
+	}
+	submit("g1", "telegram", priorityGroup)
+	submit("g2", "telegram", priorityGroup)
+	submit("g3", "telegram", priorityGroup)
+	submit("g4", "discord", priorityGroup)
+	submit("dm", "telegram", priorityDirect)
+	submit("boss", "slack", priorityOwner)
+
+	var order []string
+	for {
+		_, msg, ok := s.next()
+		if !ok {
+			break
+		}
+		order = append(order, msg.Content)
+	}
+	// Owner, then DM, then group chats alternating between channels.
+	if got, want := strings.Join(order, ","), "boss,dm,g1,g4,g2,g3"; got != want {
+		t.Fatalf("order = %s, want %s", got, want)
+	}
+}
+
+func TestTurnScheduler_SerializesSessionAndHonorsLimit(t *testing.T) {
+	s := newTurnScheduler(2)
+	s.submit("a", priorityDirect, bus.InboundMessage{Channel: "c", Content: "a1"}, nil)
+	s.submit("a", priorityDirect, bus.InboundMessage{Channel: "c", Content: "a2"}, nil)
+	s.submit("b", priorityDirect, bus.InboundMessage{Channel: "c", Content: "b1"}, nil)
+	s.submit("c", priorityDirect, bus.InboundMessage{Channel: "c", Content: "c1"}, nil)
+
+	sessA, msg, _ := s.next()
+	if msg.Content != "a1" {
+		t.Fatalf("first = %q, want a1", msg.Content)
+	}
+	if _, msg, _ = s.next(); msg.Content != "b1" {
+		t.Fatalf("second = %q, want b1 while a1 runs", msg.Content)
+	}
+	if _, _, ok := s.next(); ok {
+		t.Fatal("next() claimed a third session past the limit of 2")
+	}
+
+	// A message for a running session steers when it can.
+	steered := false
+	s.submit("a", priorityDirect, bus.InboundMessage{Channel: "c", Content: "a3"}, func() bool {
+		steered = true
+		return true
+	})
+	if !steered {
+		t.Fatal("message for the running session was not steered")
+	}
+
+	if s.finish(sessA, func() bool { return false }) {
+		t.Fatal("finish() kept the session without pending steering")
+	}
+	if _, msg, _ = s.next(); msg.Content != "c1" {
+		t.Fatalf("third = %q, want c1 (a2 queues behind it)", msg.Content)
+	}
+}
+
+func TestTurnScheduler_FinishWakesDispatcher(t *testing.T) {
+	s := newTurnScheduler(1)
+	s.submit("a", priorityDirect, bus.InboundMessage{Channel: "c", Content: "a1"}, nil)
+	s.submit("b", priorityDirect, bus.InboundMessage{Channel: "c", Content: "b1"}, nil)
+
+	sessA, _, _ := s.next()
+	select {
+	case <-s.wake:
+		t.Fatal("wake signaled before a slot was freed")
+	default:
+	}
+	s.finish(sessA, func() bool { return false })
+	select {
+	case <-s.wake:
+	default:
+		t.Fatal("finish() did not signal wake")
+	}
+	if _, msg, _ := s.next(); msg.Content != "b1" {
+		t.Fatalf("next = %q, want b1", msg.Content)
+	}
+}
+
+func TestTurnScheduler_TaskRunsAsSessionTurn(t *testing.T) {
+	s := newTurnScheduler(2)
+	ran := false
+	s.submitTask("a", "c", priorityDirect, func(context.Context) { ran = true })
+
+	sessA, _, ok := s.next()
+	if !ok || sessA.task == nil {
+		t.Fatal("next() did not claim the task")
+	}
+	sessA.task(context.Background())
+	if !ran {
+		t.Fatal("task did not run")
+	}
+
+	// A message for the session waits for the task instead of steering it.
+	s.submit("a", priorityDirect, bus.InboundMessage{Channel: "c", Content: "a1"}, func() bool {
+		t.Fatal("message steered into a running task")
+		return true
+	})
+	if _, _, ok := s.next(); ok {
+		t.Fatal("next() claimed the session while its task runs")
+	}
+	s.finish(sessA, func() bool { return false })
+	sess, msg, _ := s.next()
+	if msg.Content != "a1" || sess.task != nil {
+		t.Fatalf("after the task: msg = %q, task set = %v", msg.Content, sess.task != nil)
+	}
+}
+
+// sessionProvider answers "reply to <message>" and holds messages containing
+// "slow" until released.
+type sessionProvider struct {
+	release chan struct{}
+}
+
+func (p *sessionProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	last := messages[len(messages)-1].Content
+	if strings.Contains(last, "slow") {
+		select {
+		case <-p.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return &providers.LLMResponse{Content: "reply to " + last}, nil
+}
+
+func (p *sessionProvider) GetDefaultModel() string {
+	return "test-model"
+}
+
+func TestAgentLoop_Run_SlowSessionDoesNotBlockOthers(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		Session: config.SessionConfig{DMScope: "per-peer"},
+	}
+	msgBus := bus.NewMessageBus()
+	provider := &sessionProvider{release: make(chan struct{})}
+	al := NewAgentLoop(cfg, msgBus, provider)
+
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	runDone := make(chan struct{})
+	go func() {
+		defer close(runDone)
+		_ = al.Run(runCtx)
+	}()
+	defer func() {
+		cancelRun()
+		<-runDone
+	}()
+
+	publish := func(sender, content string) {
+		t.Helper()
+		if err := msgBus.PublishInbound(context.Background(), bus.InboundMessage{
+			Channel:  "test",
+			SenderID: sender,
+			ChatID:   sender,
+			Content:  content,
+			Peer:     bus.Peer{Kind: "direct", ID: sender},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	receive := func() bus.OutboundMessage {
+		t.Helper()
+		select {
+		case out := <-msgBus.OutboundChan():
+			return out
+		case <-time.After(3 * time.Second):
+			t.Fatal("timeout waiting for a response")
+			return bus.OutboundMessage{}
+		}
+	}
+
+	publish("user1", "slow question")
+	publish("user2", "quick question")
+	if out := receive(); out.ChatID != "user2" || out.Content != "reply to quick question" {
+		t.Fatalf("first response = %+v, want user2's answer while user1's turn runs", out)
+	}
+
+	close(provider.release)
+	if out := receive(); out.ChatID != "user1" || out.Content != "reply to slow question" {
+		t.Fatalf("second response = %+v", out)
+	}
+}
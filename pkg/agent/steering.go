@@ -167,17 +167,16 @@ func (sq *steeringQueue) getMode() SteeringMode {
 	return sq.mode
 }
 
-// Steer enqueues a user message to be injected into the currently running
-// agent loop. The message will be picked up after the current tool finishes
+// Steer enqueues a user message to be injected into the turn running on
+// sessionKey. The message will be picked up after the current tool finishes
 // executing, causing any remaining tool calls in the batch to be skipped.
-func (al *AgentLoop) Steer(msg providers.Message) error {
-	scope := ""
+// With an empty sessionKey the message goes to the legacy fallback queue.
+func (al *AgentLoop) Steer(sessionKey string, msg providers.Message) error {
 	agentID := ""
-	if ts := al.getAnyActiveTurnState(); ts != nil {
-		scope = ts.sessionKey
+	if ts := al.getActiveTurnState(sessionKey); ts != nil {
 		agentID = ts.agentID
 	}
-	return al.enqueueSteeringMessage(scope, agentID, msg)
+	return al.enqueueSteeringMessage(sessionKey, agentID, msg)
 }
 
 func (al *AgentLoop) enqueueSteeringMessage(scope, agentID string, msg providers.Message) error {
@@ -207,7 +206,7 @@ func (al *AgentLoop) enqueueSteeringMessage(scope, agentID string, msg providers
 		Source:    "Steer",
 		TracePath: "turn.interrupt.received",
 	}
-	if ts := al.getAnyActiveTurnState(); ts != nil {
+	if ts := al.getActiveTurnState(scope); ts != nil {
 		meta = ts.eventMeta("Steer", "turn.interrupt.received")
 	} else {
 		if strings.TrimSpace(agentID) != "" {
@@ -326,7 +325,7 @@ func (al *AgentLoop) agentForSession(sessionKey string) *AgentInstance {
 //
 // If no steering messages are pending, it returns an empty string.
 func (al *AgentLoop) Continue(ctx context.Context, sessionKey, channel, chatID string) (string, error) {
-	if active := al.GetActiveTurn(); active != nil {
+	if active := al.GetActiveTurnBySession(sessionKey); active != nil {
 		return "", fmt.Errorf("turn %s is still active", active.TurnID)
 	}
 	if err := al.ensureHooksInitialized(ctx); err != nil {
@@ -347,16 +346,18 @@ func (al *AgentLoop) Continue(ctx context.Context, sessionKey, channel, chatID s
 	}
 
 	if tool, ok := agent.Tools.Get("message"); ok {
-		if resetter, ok := tool.(interface{ ResetSentInRound() }); ok {
-			resetter.ResetSentInRound()
+		if resetter, ok := tool.(interface{ ResetSentInRound(string) }); ok {
+			resetter.ResetSentInRound(sessionKey)
 		}
 	}
 
 	return al.continueWithSteeringMessages(ctx, agent, sessionKey, channel, chatID, steeringMsgs)
 }
 
-func (al *AgentLoop) InterruptGraceful(hint string) error {
-	ts := al.getAnyActiveTurnState()
+// InterruptGraceful asks the turn running on sessionKey to wrap up, with hint
+// as guidance for its final answer.
+func (al *AgentLoop) InterruptGraceful(sessionKey, hint string) error {
+	ts := al.getActiveTurnState(sessionKey)
 	if ts == nil {
 		return fmt.Errorf("no active turn")
 	}
@@ -376,8 +377,9 @@ func (al *AgentLoop) InterruptGraceful(hint string) error {
 	return nil
 }
 
-func (al *AgentLoop) InterruptHard() error {
-	ts := al.getAnyActiveTurnState()
+// InterruptHard aborts the turn running on sessionKey.
+func (al *AgentLoop) InterruptHard(sessionKey string) error {
+	ts := al.getActiveTurnState(sessionKey)
 	if ts == nil {
 		return fmt.Errorf("no active turn")
 	}
@@ -483,7 +485,7 @@ func (al *AgentLoop) HardAbort(sessionKey string) error {
 // - Scheduled follow-up actions
 //
 // The message will be processed via Continue() when the agent becomes idle.
-func (al *AgentLoop) InjectFollowUp(msg providers.Message) error {
+func (al *AgentLoop) InjectFollowUp(sessionKey string, msg providers.Message) error {
 	// InjectFollowUp uses the same steering queue mechanism as Steer(),
 	// but the semantic difference is in when it's called:
 	// - Steer() is called during active execution to interrupt
@@ -491,13 +493,13 @@ func (al *AgentLoop) InjectFollowUp(msg providers.Message) error {
 	//
 	// Both end up in the same queue and are processed by Continue()
 	// when the agent is idle.
-	return al.Steer(msg)
+	return al.Steer(sessionKey, msg)
 }
 
 // ====================== API Aliases for Design Document Compatibility ======================
 
 // InjectSteering is an alias for Steer() to match the design document naming.
 // It injects a steering message into the currently running agent loop.
-func (al *AgentLoop) InjectSteering(msg providers.Message) error {
-	return al.Steer(msg)
+func (al *AgentLoop) InjectSteering(sessionKey string, msg providers.Message) error {
+	return al.Steer(sessionKey, msg)
 }
@@ -220,7 +220,7 @@ func TestAgentLoop_Steer_Enqueues(t *testing.T) {
 		t.Fatal("expected provider to be initialized")
 	}
 
-	al.Steer(providers.Message{Role: "user", Content: "interrupt me"})
+	al.Steer("", providers.Message{Role: "user", Content: "interrupt me"})
 
 	if al.steering.len() != 1 {
 		t.Fatalf("expected 1 steering message, got %d", al.steering.len())
@@ -329,7 +329,7 @@ func TestAgentLoop_Continue_WithMessages(t *testing.T) {
 	provider := &simpleMockProvider{response: "continued response"}
 	al := NewAgentLoop(cfg, msgBus, provider)
 
-	al.Steer(providers.Message{Role: "user", Content: "new direction"})
+	al.Steer("", providers.Message{Role: "user", Content: "new direction"})
 
 	resp, err := al.Continue(context.Background(), "test-session", "test", "chat1")
 	if err != nil {
@@ -340,97 +340,6 @@ func TestAgentLoop_Continue_WithMessages(t *testing.T) {
 	}
 }
 
-func TestDrainBusToSteering_RequeuesDifferentScopeMessage(t *testing.T) {
-	tmpDir, err := os.MkdirTemp("", "agent-test-*")
-	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
-	}
-	defer os.RemoveAll(tmpDir)
-
-	cfg := &config.Config{
-		Agents: config.AgentsConfig{
-			Defaults: config.AgentDefaults{
-				Workspace:         tmpDir,
-				ModelName:         "test-model",
-				MaxTokens:         4096,
-				MaxToolIterations: 10,
-			},
-		},
-		Session: config.SessionConfig{
-			DMScope: "per-peer",
-		},
-	}
-
-	msgBus := bus.NewMessageBus()
-	al := NewAgentLoop(cfg, msgBus, &mockProvider{})
-
-	activeMsg := bus.InboundMessage{
-		Channel:  "telegram",
-		SenderID: "user1",
-		ChatID:   "chat1",
-		Content:  "active turn",
-		Peer: bus.Peer{
-			Kind: "direct",
-			ID:   "user1",
-		},
-	}
-	activeScope, activeAgentID, ok := al.resolveSteeringTarget(activeMsg)
-	if !ok {
-		t.Fatal("expected active message to resolve to a steering scope")
-	}
-
-	otherMsg := bus.InboundMessage{
-		Channel:  "telegram",
-		SenderID: "user2",
-		ChatID:   "chat2",
-		Content:  "other session",
-		Peer: bus.Peer{
-			Kind: "direct",
-			ID:   "user2",
-		},
-	}
-	otherScope, _, ok := al.resolveSteeringTarget(otherMsg)
-	if !ok {
-		t.Fatal("expected other message to resolve to a steering scope")
-	}
-	if otherScope == activeScope {
-		t.Fatalf("expected different steering scopes, got same scope %q", activeScope)
-	}
-
-	if err := msgBus.PublishInbound(context.Background(), otherMsg); err != nil {
-		t.Fatalf("PublishInbound failed: %v", err)
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	done := make(chan struct{})
-	go func() {
-		al.drainBusToSteering(ctx, activeScope, activeAgentID)
-		close(done)
-	}()
-
-	select {
-	case <-done:
-	case <-time.After(2 * time.Second):
-		t.Fatal("timeout waiting for drainBusToSteering to stop")
-	}
-
-	if msgs := al.dequeueSteeringMessagesForScope(activeScope); len(msgs) != 0 {
-		t.Fatalf("expected no steering messages for active scope, got %v", msgs)
-	}
-
-	select {
-	case <-ctx.Done():
-		t.Fatalf("timeout waiting for requeued message on outbound bus")
-	case requeued := <-msgBus.OutboundChan():
-		if requeued.Channel != otherMsg.Channel || requeued.ChatID != otherMsg.ChatID ||
-			requeued.Content != otherMsg.Content {
-			t.Fatalf("requeued message mismatch: got %+v want %+v", requeued, otherMsg)
-		}
-	}
-}
-
 // slowTool simulates a tool that takes some time to execute.
 type slowTool struct {
 	name     string
@@ -714,7 +623,7 @@ func TestAgentLoop_Steering_SkipsRemainingTools(t *testing.T) {
 		t.Fatal("timeout waiting for tool_one to start")
 	}
 
-	al.Steer(providers.Message{Role: "user", Content: "change course"})
+	al.Steer(activeSessionKey(t, al), providers.Message{Role: "user", Content: "change course"})
 
 	// Get the result
 	select {
@@ -775,7 +684,7 @@ func TestAgentLoop_Steering_InitialPoll(t *testing.T) {
 	al := NewAgentLoop(cfg, msgBus, provider)
 
 	// Enqueue a steering message before processing starts
-	al.Steer(providers.Message{Role: "user", Content: "pre-enqueued steering"})
+	al.Steer("", providers.Message{Role: "user", Content: "pre-enqueued steering"})
 
 	// Process a normal message - the initial steering poll should inject the steering message
 	_, err = al.ProcessDirectWithChannel(
@@ -877,6 +786,16 @@ func TestAgentLoop_Run_AutoContinuesLateSteeringMessage(t *testing.T) {
 		t.Fatalf("publish late inbound: %v", err)
 	}
 
+	// Let Run steer the late message into the running turn before it ends.
+	sessionKey := activeSessionKey(t, al)
+	deadline := time.Now().Add(2 * time.Second)
+	for al.pendingSteeringCountForScope(sessionKey) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timeout waiting for the late message to be steered")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
 	close(provider.releaseFirstCall)
 
 	subCtx, subCancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -984,7 +903,7 @@ func TestAgentLoop_Steering_DirectResponseContinuesWithQueuedMessage(t *testing.
 		t.Fatal("timeout waiting for first LLM call to start")
 	}
 
-	if err := al.Steer(providers.Message{Role: "user", Content: "follow-up instruction"}); err != nil {
+	if err := al.Steer(sessionKey, providers.Message{Role: "user", Content: "follow-up instruction"}); err != nil {
 		t.Fatalf("Steer failed: %v", err)
 	}
 	close(provider.releaseFirst)
@@ -1065,7 +984,7 @@ func TestAgentLoop_Continue_PreservesSteeringMedia(t *testing.T) {
 	al := NewAgentLoop(cfg, msgBus, provider)
 	al.SetMediaStore(store)
 
-	if err = al.Steer(providers.Message{
+	if err = al.Steer(sessionKey, providers.Message{
 		Role:    "user",
 		Content: "describe this image",
 		Media:   []string{ref},
@@ -1206,7 +1125,7 @@ func TestAgentLoop_InterruptGraceful_UsesTerminalNoToolCall(t *testing.T) {
 		t.Fatalf("unexpected active turn target: %#v", active)
 	}
 
-	if err := al.InterruptGraceful("wrap it up"); err != nil {
+	if err := al.InterruptGraceful(sessionKey, "wrap it up"); err != nil {
 		t.Fatalf("InterruptGraceful failed: %v", err)
 	}
 
@@ -1364,7 +1283,7 @@ func TestAgentLoop_InterruptHard_RestoresSession(t *testing.T) {
 		t.Fatal("expected active turn before hard abort")
 	}
 
-	if err := al.InterruptHard(); err != nil {
+	if err := al.InterruptHard(sessionKey); err != nil {
 		t.Fatalf("InterruptHard failed: %v", err)
 	}
 
@@ -1524,7 +1443,7 @@ func TestAgentLoop_Steering_SkippedToolsHaveErrorResults(t *testing.T) {
 	}()
 
 	<-execCh
-	al.Steer(providers.Message{Role: "user", Content: "interrupt!"})
+	al.Steer(activeSessionKey(t, al), providers.Message{Role: "user", Content: "interrupt!"})
 
 	select {
 	case <-resultCh:
@@ -1589,3 +1508,13 @@ func init() {
 	// with the proper argument serialization.
 	_ = json.Marshal
 }
+
+// activeSessionKey returns the session key of the turn running in al.
+func activeSessionKey(t *testing.T, al *AgentLoop) string {
+	t.Helper()
+	active := al.GetActiveTurn()
+	if active == nil {
+		t.Fatal("expected an active turn")
+	}
+	return active.SessionKey
+}
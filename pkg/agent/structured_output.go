@@ -0,0 +1,164 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/jsonschema-go/jsonschema"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+const (
+	defaultResponseSchemaName = "response"
+
+	// maxStructuredOutputRepairs is how many times the model is asked to fix
+	// a final answer that does not match the response schema.
+	maxStructuredOutputRepairs = 2
+)
+
+// ResponseSchema is a JSON Schema the final answer of a turn must match.
+// Providers that implement providers.StructuredOutputCapable receive it as
+// response_format; for the others the schema is described in the prompt.
+// Either way the answer is validated and, when it does not match, the model
+// is asked to repair it.
+type ResponseSchema struct {
+	Name   string
+	Schema map[string]any
+	// Strict is forwarded to providers that support strict schema
+	// adherence.
+	Strict bool
+}
+
+func responseSchemaFromConfig(cfg *config.ResponseSchemaConfig) *ResponseSchema {
+	if cfg == nil || len(cfg.Schema) == 0 {
+		return nil
+	}
+	return &ResponseSchema{Name: cfg.Name, Schema: cfg.Schema, Strict: cfg.Strict}
+}
+
+func (s *ResponseSchema) name() string {
+	if name := strings.TrimSpace(s.Name); name != "" {
+		return name
+	}
+	return defaultResponseSchemaName
+}
+
+// StructuredOutputError is returned when the final answer still does not
+// match the response schema after all repair attempts.
+type StructuredOutputError struct {
+	Schema   string // name of the response schema
+	Attempts int    // number of answers that were validated
+	Content  string // the last answer
+	Err      error  // why the last answer was rejected
+}
+
+func (e *StructuredOutputError) Error() string {
+	return fmt.Sprintf("structured output: response does not match schema %q after %d attempt(s): %v",
+		e.Schema, e.Attempts, e.Err)
+}
+
+func (e *StructuredOutputError) Unwrap() error {
+	return e.Err
+}
+
+// responseValidator checks final answers against a compiled ResponseSchema.
+type responseValidator struct {
+	schema   *ResponseSchema
+	resolved *jsonschema.Resolved
+}
+
+func newResponseValidator(schema *ResponseSchema) (*responseValidator, error) {
+	data, err := json.Marshal(schema.Schema)
+	if err != nil {
+		return nil, fmt.Errorf("structured output: encode schema %q: %w", schema.name(), err)
+	}
+	var js jsonschema.Schema
+	if err := json.Unmarshal(data, &js); err != nil {
+		return nil, fmt.Errorf("structured output: decode schema %q: %w", schema.name(), err)
+	}
+	resolved, err := js.Resolve(nil)
+	if err != nil {
+		return nil, fmt.Errorf("structured output: invalid schema %q: %w", schema.name(), err)
+	}
+	return &responseValidator{schema: schema, resolved: resolved}, nil
+}
+
+// Validate returns the JSON document in content, compacted, if it matches
+// the schema. Code fences and prose around a single object or array are
+// tolerated, since models often add them.
+func (v *responseValidator) Validate(content string) (string, error) {
+	raw := extractJSONDocument(content)
+	if raw == "" {
+		return "", errors.New("response is not JSON")
+	}
+	var instance any
+	if err := json.Unmarshal([]byte(raw), &instance); err != nil {
+		return "", fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	if err := v.resolved.Validate(instance); err != nil {
+		return "", err
+	}
+	normalized, err := json.Marshal(instance)
+	if err != nil {
+		return "", err
+	}
+	return string(normalized), nil
+}
+
+// responseFormat is the OpenAI-style response_format option for the schema.
+func (v *responseValidator) responseFormat() map[string]any {
+	return map[string]any{
+		"type": "json_schema",
+		"json_schema": map[string]any{
+			"name":   v.schema.name(),
+			"schema": v.schema.Schema,
+			"strict": v.schema.Strict,
+		},
+	}
+}
+
+// withInstruction returns a copy of messages that ends with a description
+// of the schema, for providers without native structured output. The
+// instruction is part of the request only, not the session.
+func (v *responseValidator) withInstruction(messages []providers.Message) []providers.Message {
+	schema, _ := json.MarshalIndent(v.schema.Schema, "", "  ")
+	return append(append([]providers.Message(nil), messages...), providers.Message{
+		Role: "user",
+		Content: "When you give your final answer, reply with a single JSON document that matches this " +
+			"JSON Schema and nothing else (no prose, no code fences):\n" + string(schema),
+	})
+}
+
+func (v *responseValidator) repairMessage(err error) providers.Message {
+	return providers.Message{
+		Role: "user",
+		Content: fmt.Sprintf("Your answer does not match the required JSON Schema %q: %v\n"+
+			"Reply again with only a corrected JSON document.", v.schema.name(), err),
+	}
+}
+
+// extractJSONDocument returns the outermost JSON object or array in content,
+// or "" when there is none.
+func extractJSONDocument(content string) string {
+	content = strings.TrimSpace(content)
+	if json.Valid([]byte(content)) {
+		return content
+	}
+	start := strings.IndexAny(content, "{[")
+	if start < 0 {
+		return ""
+	}
+	closer := "}"
+	if content[start] == '[' {
+		closer = "]"
+	}
+	end := strings.LastIndex(content, closer)
+	if end < start {
+		return ""
+	}
+	return content[start : end+1]
+}
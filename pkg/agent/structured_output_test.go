@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// structuredProvider answers with the scripted replies in order, repeating
+// the last one, and records the options and messages of every call.
+type structuredProvider struct {
+	mu       sync.Mutex
+	replies  []string
+	native   bool
+	options  []map[string]any
+	messages [][]providers.Message
+}
+
+func (p *structuredProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.options = append(p.options, opts)
+	p.messages = append(p.messages, messages)
+	reply := p.replies[min(len(p.options), len(p.replies))-1]
+	return &providers.LLMResponse{Content: reply}, nil
+}
+
+func (p *structuredProvider) GetDefaultModel() string {
+	return "structured-provider"
+}
+
+func (p *structuredProvider) SupportsStructuredOutput() bool {
+	return p.native
+}
+
+var testResponseSchema = &ResponseSchema{
+	Name: "weather",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"city":    map[string]any{"type": "string"},
+			"celsius": map[string]any{"type": "number"},
+		},
+		"required": []any{"city", "celsius"},
+	},
+}
+
+func TestProcessDirectWithSchema_RepairsInvalidAnswer(t *testing.T) {
+	provider := &structuredProvider{replies: []string{
+		"It is 21 degrees in Paris.",
+		"```json\n{\"city\": \"Paris\", \"celsius\": 21}\n```",
+	}}
+	al, agent, cleanup := newHookTestLoop(t, provider)
+	defer cleanup()
+
+	resp, err := al.ProcessDirectWithSchema(
+		context.Background(), "weather in Paris?", "agent:main:schema", "cli", "direct", testResponseSchema,
+	)
+	if err != nil {
+		t.Fatalf("ProcessDirectWithSchema() error = %v", err)
+	}
+	if resp != `{"celsius":21,"city":"Paris"}` {
+		t.Fatalf("response = %q, want the validated JSON", resp)
+	}
+	if len(provider.options) != 2 {
+		t.Fatalf("LLM calls = %d, want 2", len(provider.options))
+	}
+	if _, ok := provider.options[0]["response_format"]; ok {
+		t.Fatal("response_format sent to a provider without structured output")
+	}
+	first := provider.messages[0]
+	if last := first[len(first)-1]; !strings.Contains(last.Content, `"celsius"`) {
+		t.Fatalf("schema instruction missing from request, last message = %q", last.Content)
+	}
+	second := provider.messages[1]
+	if last := second[len(second)-2]; !strings.Contains(last.Content, `does not match the required JSON Schema "weather"`) {
+		t.Fatalf("repair message missing, got %q", last.Content)
+	}
+
+	// Only the user message and the valid answer are kept in the session.
+	history := agent.Sessions.GetHistory("agent:main:schema")
+	if len(history) != 2 || history[1].Content != resp {
+		t.Fatalf("history = %+v", history)
+	}
+}
+
+func TestProcessDirectWithSchema_ReturnsTypedErrorWhenRepairsFail(t *testing.T) {
+	provider := &structuredProvider{native: true, replies: []string{`{"city": "Paris"}`}}
+	al, _, cleanup := newHookTestLoop(t, provider)
+	defer cleanup()
+
+	_, err := al.ProcessDirectWithSchema(
+		context.Background(), "weather in Paris?", "agent:main:schema", "cli", "direct", testResponseSchema,
+	)
+	var soErr *StructuredOutputError
+	if !errors.As(err, &soErr) {
+		t.Fatalf("error = %v, want *StructuredOutputError", err)
+	}
+	if soErr.Schema != "weather" || soErr.Attempts != maxStructuredOutputRepairs+1 {
+		t.Fatalf("error = %+v", soErr)
+	}
+	if soErr.Content != `{"city": "Paris"}` {
+		t.Fatalf("Content = %q, want the last answer", soErr.Content)
+	}
+	format, ok := provider.options[0]["response_format"].(map[string]any)
+	if !ok || format["type"] != "json_schema" {
+		t.Fatalf("response_format = %v, want json_schema", provider.options[0]["response_format"])
+	}
+}
+
+func TestProcessDirect_UsesAgentResponseSchema(t *testing.T) {
+	provider := &structuredProvider{replies: []string{`{"city": "Oslo", "celsius": -3}`}}
+	al, agent, cleanup := newHookTestLoop(t, provider)
+	defer cleanup()
+	agent.ResponseSchema = testResponseSchema
+
+	resp, err := al.ProcessDirect(context.Background(), "weather in Oslo?", "agent:main:schema")
+	if err != nil {
+		t.Fatalf("ProcessDirect() error = %v", err)
+	}
+	if resp != `{"celsius":-3,"city":"Oslo"}` {
+		t.Fatalf("response = %q", resp)
+	}
+}
+
+func TestExtractJSONDocument(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"a": 1}`, `{"a": 1}`},
+		{"```json\n[1, 2]\n```", `[1, 2]`},
+		{`Sure: {"a": {"b": 2}} hope that helps`, `{"a": {"b": 2}}`},
+		{"no json here", ""},
+	}
+	for _, tt := range tests {
+		if got := extractJSONDocument(tt.in); got != tt.want {
+			t.Errorf("extractJSONDocument(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/constants"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// ResumeSubagentTasks re-runs the spawned tasks a previous process left
+// unfinished. Their results go straight to the chat that spawned them, since
+// the turn that was waiting for them is gone.
+func (al *AgentLoop) ResumeSubagentTasks(ctx context.Context) {
+	registry := al.GetRegistry()
+	for _, agentID := range registry.ListAgentIDs() {
+		agent, ok := registry.GetAgent(agentID)
+		if !ok || agent.SubagentTasks == nil {
+			continue
+		}
+		if n := agent.SubagentTasks.Resume(ctx, al.deliverSubagentResult); n > 0 {
+			logger.InfoCF("agent", "Resumed spawned tasks interrupted by a restart",
+				map[string]any{"agent_id": agentID, "tasks": n})
+		}
+	}
+}
+
+// deliverSubagentResult reports a resumed task's result the way the spawn
+// tool's async callback does: the user sees it right away and the agent gets
+// it as a system message for the origin chat, whatever session is active now.
+func (al *AgentLoop) deliverSubagentResult(task tools.SubagentTask, result *tools.ToolResult) {
+	if al.bus == nil || result == nil || task.OriginChannel == "" || task.OriginChatID == "" {
+		return
+	}
+	if !result.Silent && result.ForUser != "" && !constants.IsInternalChannel(task.OriginChannel) {
+		outCtx, outCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer outCancel()
+		_ = al.bus.PublishOutbound(outCtx, bus.OutboundMessage{
+			Channel: task.OriginChannel,
+			ChatID:  task.OriginChatID,
+			Content: result.ForUser,
+		})
+	}
+
+	content := result.ForLLM
+	if content == "" && result.Err != nil {
+		content = result.Err.Error()
+	}
+	if content == "" {
+		return
+	}
+
+	logger.InfoCF("agent", "Resumed spawned task finished, publishing result",
+		map[string]any{"task_id": task.ID, "status": task.Status, "channel": task.OriginChannel})
+	pubCtx, pubCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer pubCancel()
+	_ = al.bus.PublishInbound(pubCtx, bus.InboundMessage{
+		Channel:  "system",
+		SenderID: "async:spawn",
+		ChatID:   fmt.Sprintf("%s:%s", task.OriginChannel, task.OriginChatID),
+		Content:  fmt.Sprintf("Spawned task %s (resumed after a restart) finished:\n\n%s", task.ID, content),
+	})
+}
@@ -8,9 +8,11 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 // ====================== Config & Constants ======================
@@ -149,7 +151,7 @@ type SubTurnConfig struct {
 	// This prevents context window overflow by truncating message history before LLM calls.
 	//
 	// Values:
-	//   0  = Auto-calculate based on model's ContextWindow * 0.75 (default, recommended)
+	//   0  = Auto: 75% of the model's ContextWindow, counted in the model's tokens (default, recommended)
 	//   -1 = No limit (disable soft truncation, rely only on hard context errors)
 	//   >0 = Use specified rune limit
 	//
@@ -172,6 +174,14 @@ type SubTurnConfig struct {
 	// Used by team tool to enforce token limits across all team members.
 	InitialTokenBudget *atomic.Int64
 
+	// Label names the sub-turn in its SubTurnSpawn and SubTurnEnd events, e.g.
+	// "refine worker 2/3". Defaults to the child turn ID.
+	Label string
+
+	// OnProgress, when set, receives the text of each model reply as the
+	// sub-turn runs, so callers can record partial output.
+	OnProgress func(text string)
+
 	// Can be extended with temperature, topP, etc.
 }
 
@@ -225,6 +235,8 @@ func (s *AgentLoopSpawner) SpawnSubTurn(
 		ActualSystemPrompt: cfg.ActualSystemPrompt,
 		InitialMessages:    cfg.InitialMessages,
 		InitialTokenBudget: cfg.InitialTokenBudget,
+		Label:              cfg.Label,
+		OnProgress:         cfg.OnProgress,
 		MaxTokens:          cfg.MaxTokens,
 		Async:              cfg.Async,
 		Critical:           cfg.Critical,
@@ -330,6 +342,10 @@ func spawnSubTurn(
 	defer cancel()
 
 	childID := al.generateSubTurnID()
+	label := cfg.Label
+	if label == "" {
+		label = childID
+	}
 
 	// Get the agent instance from parent, falling back to the default agent.
 	// Wrap it in a shallow copy that uses an ephemeral (in-memory only) session store
@@ -349,6 +365,19 @@ func spawnSubTurn(
 	if baseAgent.Tools != nil {
 		agent.Tools = baseAgent.Tools.Clone()
 	}
+	// An explicit tool list restricts the child to exactly those tools.
+	if len(cfg.Tools) > 0 {
+		agent.Tools = tools.NewToolRegistry()
+		for _, t := range cfg.Tools {
+			agent.Tools.Register(t)
+		}
+	}
+	if cfg.MaxTokens > 0 {
+		agent.MaxTokens = cfg.MaxTokens
+	}
+	if cfg.Model != baseAgent.Model {
+		applySubTurnModel(al.GetConfig(), &agent, cfg.Model)
+	}
 
 	// Create processOptions for the child turn
 	opts := processOptions{
@@ -377,6 +406,8 @@ func spawnSubTurn(
 	// Set SubTurn-specific fields
 	childTS.cancelFunc = cancel
 	childTS.critical = cfg.Critical
+	childTS.onProgress = cfg.OnProgress
+	childTS.truncateContext = subTurnContextLimiter(&agent, cfg.MaxContextRunes)
 	childTS.depth = parentTS.depth + 1
 	childTS.parentTurnID = parentTS.turnID
 	childTS.parentTurnState = parentTS
@@ -419,7 +450,7 @@ func spawnSubTurn(
 		childTS.eventMeta("spawnSubTurn", "subturn.spawn"),
 		SubTurnSpawnPayload{
 			AgentID:      childTS.agentID,
-			Label:        childID,
+			Label:        label,
 			ParentTurnID: parentTS.turnID,
 		},
 	)
@@ -449,6 +480,7 @@ func spawnSubTurn(
 			childTS.eventMeta("spawnSubTurn", "subturn.end"),
 			SubTurnEndPayload{
 				AgentID: childTS.agentID,
+				Label:   label,
 				Status:  status,
 			},
 		)
@@ -477,14 +509,69 @@ func spawnSubTurn(
 		}
 	} else {
 		result = &tools.ToolResult{
-			ForLLM:  turnRes.finalContent,
-			ForUser: turnRes.finalContent,
+			ForLLM:   turnRes.finalContent,
+			ForUser:  turnRes.finalContent,
+			Messages: turnRes.messages,
 		}
 	}
 
 	return result, err
 }
 
+// applySubTurnModel points a child agent copy at another model from the
+// model list. Routing to the light model is disabled so the child sticks to
+// the model it was asked to use.
+func applySubTurnModel(cfg *config.Config, agent *AgentInstance, model string) {
+	if cfg == nil {
+		return
+	}
+	if !switchAgentModel(cfg, agent, model) {
+		logger.WarnCF("subturn", "Sub-turn model not resolved; using the parent's model",
+			map[string]any{"model": model, "parent_model": agent.Model})
+	}
+}
+
+// switchAgentModel points an agent copy at another model from the model
+// list, without fallbacks or routing. It reports false and leaves the agent
+// unchanged when the model does not resolve.
+func switchAgentModel(cfg *config.Config, agent *AgentInstance, model string) bool {
+	candidates := resolveModelCandidates(cfg, cfg.Agents.Defaults.Provider, model, nil)
+	if len(candidates) == 0 {
+		return false
+	}
+	agent.Model = model
+	agent.Fallbacks = nil
+	agent.Candidates = candidates
+	agent.Tokenizer = resolveTokenizer(cfg, model)
+	agent.Router = nil
+	agent.LightCandidates = nil
+	return true
+}
+
+// subTurnContextLimiter returns how a sub-turn trims its messages before each
+// LLM call according to SubTurnConfig.MaxContextRunes, or nil for no limit.
+func subTurnContextLimiter(agent *AgentInstance, maxContextRunes int) func([]providers.Message) []providers.Message {
+	switch {
+	case maxContextRunes < 0:
+		return nil
+	case maxContextRunes > 0:
+		return func(messages []providers.Message) []providers.Message {
+			return utils.TruncateContextSmart(messages, maxContextRunes)
+		}
+	}
+	limit := agent.ContextWindow * 3 / 4
+	if limit <= 0 {
+		return nil
+	}
+	tok := agent.Tokenizer
+	measure := func(msg providers.Message) int {
+		return countMessageTokens(tok, msg)
+	}
+	return func(messages []providers.Message) []providers.Message {
+		return utils.TruncateContext(messages, limit, measure)
+	}
+}
+
 // ====================== Result Delivery ======================
 
 // deliverSubTurnResult delivers a sub-turn result to the parent turn's pendingResults channel.
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -11,7 +12,9 @@ import (
 	"github.com/sipeed/picoclaw/pkg/bus"
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 	"github.com/sipeed/picoclaw/pkg/tools"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 // Test constants (use defaults from subturn.go)
@@ -1090,7 +1093,7 @@ func TestInjectFollowUp(t *testing.T) {
 		Content: "Follow-up task",
 	}
 
-	err := al.InjectFollowUp(msg)
+	err := al.InjectFollowUp("", msg)
 	if err != nil {
 		t.Fatalf("InjectFollowUp failed: %v", err)
 	}
@@ -1120,16 +1123,16 @@ func TestAPIAliases(t *testing.T) {
 	}
 
 	// Test InterruptGraceful: requires active turn, so error is expected here
-	_ = al.InterruptGraceful(msg.Content)
+	_ = al.InterruptGraceful("", msg.Content)
 
 	// Test InjectSteering (enqueues a steering message)
-	err := al.InjectSteering(msg)
+	err := al.InjectSteering("", msg)
 	if err != nil {
 		t.Errorf("InjectSteering failed: %v", err)
 	}
 
 	// Also enqueue via Steer to verify second message
-	err = al.Steer(msg)
+	err = al.Steer("", msg)
 	if err != nil {
 		t.Errorf("Steer failed: %v", err)
 	}
@@ -1167,7 +1170,7 @@ func TestInterruptHard_Alias(t *testing.T) {
 	al.activeTurnStates.Store(sessionKey, rootTS)
 
 	// Test InterruptHard (alias for HardAbort)
-	err := al.InterruptHard()
+	err := al.InterruptHard(sessionKey)
 	if err != nil {
 		t.Errorf("InterruptHard failed: %v", err)
 	}
@@ -2065,3 +2068,62 @@ func TestSubTurn_IndependentContext(t *testing.T) {
 		t.Log("✓ SubTurn completed successfully (independent context)")
 	}
 }
+
+func TestSubTurn_OnProgressReceivesReplies(t *testing.T) {
+	ctx, _ := newTeamTestContext(t, &teamProvider{})
+
+	var replies []string
+	res, err := SpawnSubTurn(ctx, SubTurnConfig{
+		Model:        "test-model",
+		SystemPrompt: `You are "scout".`,
+		OnProgress:   func(text string) { replies = append(replies, text) },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 1 || replies[0] != "notes from scout" || res.ForLLM != "notes from scout" {
+		t.Fatalf("replies = %q, result = %+v", replies, res)
+	}
+}
+
+func TestSubTurnContextLimiter(t *testing.T) {
+	tok, err := tokenizer.New(tokenizer.EncodingCL100k, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	agent := &AgentInstance{ContextWindow: 400, Tokenizer: tok}
+
+	var messages []providers.Message
+	messages = append(messages, providers.Message{Role: "system", Content: "You are a helper."})
+	for i := range 20 {
+		messages = append(messages,
+			providers.Message{Role: "user", Content: fmt.Sprintf("question %d: %s", i, strings.Repeat("词", 20))},
+			providers.Message{Role: "assistant", Content: fmt.Sprintf("answer %d", i)},
+		)
+	}
+
+	if subTurnContextLimiter(agent, -1) != nil {
+		t.Fatal("MaxContextRunes -1 should disable truncation")
+	}
+
+	// Auto: 75% of the context window in the model's tokens.
+	auto := subTurnContextLimiter(agent, 0)(messages)
+	if len(auto) >= len(messages) || !strings.Contains(auto[1].Content, "Context truncated") {
+		t.Fatalf("auto limit kept %d of %d messages", len(auto), len(messages))
+	}
+	if got := countTokens(tok, auto); got > 300 {
+		t.Fatalf("auto limit kept %d tokens, want <= 300", got)
+	}
+	if last := auto[len(auto)-1].Content; last != "answer 19" {
+		t.Fatalf("last message = %q, want the newest", last)
+	}
+
+	// An explicit limit counts runes.
+	runes := subTurnContextLimiter(agent, 2000)(messages)
+	if got := utils.MeasureContextRunes(runes); got > 2000 {
+		t.Fatalf("rune limit kept %d runes", got)
+	}
+	if len(runes) <= len(auto) {
+		t.Fatalf("rune limit kept %d messages, auto %d", len(runes), len(auto))
+	}
+}
@@ -0,0 +1,468 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const (
+	teamModeParallel = "parallel"
+	teamModeFanout   = "fanout"
+	teamModeReview   = "review"
+
+	defaultTeamMaxMembers = 5
+	defaultTeamMaxRounds  = 3
+
+	// teamApproval is how a reviewer signs off on a draft in review mode.
+	teamApproval = "APPROVED"
+)
+
+// teamMember is one named sub-agent of a team.
+type teamMember struct {
+	Name  string
+	Role  string
+	Model string
+	Tools []tools.Tool
+}
+
+// teamTool runs several named sub-turns against one task and merges their
+// results. All members draw from one shared token budget.
+type teamTool struct {
+	cfg config.TeamToolConfig
+}
+
+func newTeamTool(cfg config.TeamToolConfig) *teamTool {
+	return &teamTool{cfg: cfg}
+}
+
+func (t *teamTool) Name() string {
+	return "team"
+}
+
+func (t *teamTool) Description() string {
+	return "Run a team of named subagents on one task, each with its own role, model and tools, under a " +
+		"shared token budget. Modes: \"parallel\" (everyone works on the task, all results are returned), " +
+		"\"fanout\" (the members work in parallel, then the lead merges their results into one answer) and " +
+		"\"review\" (the first member drafts, the others review, and the draft is revised until every " +
+		"reviewer approves or the rounds run out)."
+}
+
+func (t *teamTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"task": map[string]any{
+				"type":        "string",
+				"description": "The task the team works on, with all the context the members need.",
+			},
+			"mode": map[string]any{
+				"type":        "string",
+				"enum":        []string{teamModeParallel, teamModeFanout, teamModeReview},
+				"description": "How the members cooperate (default parallel).",
+			},
+			"members": map[string]any{
+				"type":        "array",
+				"description": fmt.Sprintf("The team, at most %d members.", t.maxMembers()),
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name": map[string]any{
+							"type":        "string",
+							"description": "Unique member name, e.g. \"researcher\".",
+						},
+						"role": map[string]any{
+							"type":        "string",
+							"description": "Instructions that define the member: expertise, focus, output format.",
+						},
+						"model": map[string]any{
+							"type":        "string",
+							"description": "Model name from the model list (default: your own model).",
+						},
+						"tools": map[string]any{
+							"type":        "array",
+							"items":       map[string]any{"type": "string"},
+							"description": "Names of the tools the member may use (default: all of yours).",
+						},
+					},
+					"required": []string{"name"},
+				},
+			},
+			"lead": map[string]any{
+				"type":        "string",
+				"description": "fanout mode: the member that merges the others' results (default: the last member).",
+			},
+			"max_rounds": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("review mode: maximum draft/review rounds (default and max %d).", t.maxRounds()),
+			},
+			"token_budget": map[string]any{
+				"type":        "integer",
+				"description": "Total tokens the whole team may spend. Members wrap up once it is spent.",
+			},
+		},
+		"required": []string{"task", "members"},
+	}
+}
+
+func (t *teamTool) maxMembers() int {
+	if t.cfg.MaxMembers > 0 {
+		return t.cfg.MaxMembers
+	}
+	return defaultTeamMaxMembers
+}
+
+func (t *teamTool) maxRounds() int {
+	if t.cfg.MaxRounds > 0 {
+		return t.cfg.MaxRounds
+	}
+	return defaultTeamMaxRounds
+}
+
+func (t *teamTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	ts := turnStateFromContext(ctx)
+	al := AgentLoopFromContext(ctx)
+	if ts == nil || ts.agent == nil || al == nil {
+		return tools.ErrorResult("team: must be called from within an agent turn")
+	}
+
+	task, _ := args["task"].(string)
+	task = strings.TrimSpace(task)
+	if task == "" {
+		return tools.ErrorResult("team: task is required")
+	}
+	mode, _ := args["mode"].(string)
+	if mode == "" {
+		mode = teamModeParallel
+	}
+	members, err := t.parseMembers(ts.agent, args["members"])
+	if err != nil {
+		return tools.ErrorResult(err.Error()).WithError(err)
+	}
+
+	var run func(context.Context, *atomic.Int64) (string, error)
+	switch mode {
+	case teamModeParallel:
+		run = func(ctx context.Context, budget *atomic.Int64) (string, error) {
+			return runTeamParallel(ctx, members, task, budget)
+		}
+	case teamModeFanout:
+		if len(members) < 2 {
+			return tools.ErrorResult("team: fanout mode needs at least two members")
+		}
+		lead, _ := args["lead"].(string)
+		workers, leader, err := splitTeamLead(members, lead)
+		if err != nil {
+			return tools.ErrorResult(err.Error()).WithError(err)
+		}
+		run = func(ctx context.Context, budget *atomic.Int64) (string, error) {
+			return runTeamFanout(ctx, workers, leader, task, budget)
+		}
+	case teamModeReview:
+		if len(members) < 2 {
+			return tools.ErrorResult("team: review mode needs an author and at least one reviewer")
+		}
+		rounds := t.maxRounds()
+		if n, ok := intArg(args["max_rounds"]); ok && n > 0 {
+			rounds = min(n, rounds)
+		}
+		run = func(ctx context.Context, budget *atomic.Int64) (string, error) {
+			return runTeamReview(ctx, members[0], members[1:], task, rounds, budget)
+		}
+	default:
+		return tools.ErrorResult(fmt.Sprintf("team: unknown mode %q", mode))
+	}
+
+	requested, _ := intArg(args["token_budget"])
+	budget, limit := t.teamBudget(al, ts, requested)
+
+	content, err := run(ctx, budget)
+	if err != nil {
+		return tools.ErrorResult(fmt.Sprintf("team: %v", err)).WithError(err)
+	}
+
+	header := fmt.Sprintf("Team finished (%s mode, %d members", mode, len(members))
+	if budget != nil {
+		spent := limit - budget.Load()
+		if budget != ts.tokenBudget && ts.tokenBudget != nil {
+			ts.tokenBudget.Add(-spent)
+		}
+		header += fmt.Sprintf(", %d of %d budget tokens used", spent, limit)
+	}
+	header += ")."
+	return &tools.ToolResult{
+		ForLLM:  header + "\n\n" + content,
+		ForUser: header,
+	}
+}
+
+// teamBudget picks the shared budget for a run: the requested amount, then
+// the configured one, then the sub-turn default. A turn that already runs
+// under a budget caps the team at what it has left, and without any limit
+// the team shares the turn's own budget (nil when there is none).
+func (t *teamTool) teamBudget(al *AgentLoop, ts *turnState, requested int) (*atomic.Int64, int64) {
+	limit := int64(requested)
+	if limit <= 0 {
+		limit = int64(t.cfg.TokenBudget)
+	}
+	if limit <= 0 && ts.tokenBudget == nil {
+		limit = int64(al.getSubTurnConfig().defaultTokenBudget)
+	}
+	if ts.tokenBudget != nil {
+		remaining := ts.tokenBudget.Load()
+		if limit <= 0 || limit > remaining {
+			return ts.tokenBudget, remaining
+		}
+	}
+	if limit <= 0 {
+		return nil, 0
+	}
+	budget := &atomic.Int64{}
+	budget.Store(limit)
+	return budget, limit
+}
+
+func (t *teamTool) parseMembers(agent *AgentInstance, raw any) ([]teamMember, error) {
+	items, _ := raw.([]any)
+	if len(items) == 0 {
+		return nil, errors.New("team: members is required")
+	}
+	if len(items) > t.maxMembers() {
+		return nil, fmt.Errorf("team: at most %d members are allowed", t.maxMembers())
+	}
+
+	members := make([]teamMember, 0, len(items))
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		obj, _ := item.(map[string]any)
+		name, _ := obj["name"].(string)
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("team: member %d has no name", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("team: duplicate member name %q", name)
+		}
+		seen[name] = true
+
+		role, _ := obj["role"].(string)
+		model, _ := obj["model"].(string)
+		model = strings.TrimSpace(model)
+		if model == "" {
+			model = agent.Model
+		}
+		memberTools, err := lookupTools(agent.Tools, stringSliceArg(obj["tools"]))
+		if err != nil {
+			return nil, fmt.Errorf("team: member %q: %w", name, err)
+		}
+		members = append(members, teamMember{Name: name, Role: strings.TrimSpace(role), Model: model, Tools: memberTools})
+	}
+	return members, nil
+}
+
+// lookupTools resolves tool names against a registry. Empty names yield a
+// nil slice, which lets a sub-turn inherit every tool.
+func lookupTools(registry *tools.ToolRegistry, names []string) ([]tools.Tool, error) {
+	var out []tools.Tool
+	for _, name := range names {
+		tool, ok := registry.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		out = append(out, tool)
+	}
+	return out, nil
+}
+
+// splitTeamLead separates the fanout lead, by default the last member, from
+// the workers.
+func splitTeamLead(members []teamMember, lead string) ([]teamMember, teamMember, error) {
+	idx := len(members) - 1
+	if lead = strings.TrimSpace(lead); lead != "" {
+		idx = -1
+		for i, m := range members {
+			if m.Name == lead {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, teamMember{}, fmt.Errorf("team: lead %q is not a member", lead)
+		}
+	}
+	workers := append(append([]teamMember(nil), members[:idx]...), members[idx+1:]...)
+	return workers, members[idx], nil
+}
+
+// teamOutput is what one member returned.
+type teamOutput struct {
+	Name    string
+	Content string
+	Err     error
+}
+
+// runTeamMember runs one member as a synchronous sub-turn. The member's role
+// and the brief are sent as its first message, the same way subagents get
+// their task.
+func runTeamMember(ctx context.Context, m teamMember, brief string, budget *atomic.Int64) teamOutput {
+	prompt := fmt.Sprintf("You are %q, one member of a team of agents working on a shared task.\n", m.Name)
+	if m.Role != "" {
+		prompt += "\n" + m.Role + "\n"
+	}
+	prompt += "\n" + brief
+
+	res, err := SpawnSubTurn(ctx, SubTurnConfig{
+		Model:              m.Model,
+		Tools:              m.Tools,
+		SystemPrompt:       prompt,
+		InitialTokenBudget: budget,
+		Label:              "team " + m.Name,
+	})
+	if err != nil {
+		return teamOutput{Name: m.Name, Err: err}
+	}
+	return teamOutput{Name: m.Name, Content: strings.TrimSpace(res.ForLLM)}
+}
+
+// runTeamMembers runs members concurrently; brief returns each member's
+// brief. Outputs keep the order of members.
+func runTeamMembers(
+	ctx context.Context,
+	members []teamMember,
+	brief func(teamMember) string,
+	budget *atomic.Int64,
+) []teamOutput {
+	outputs := make([]teamOutput, len(members))
+	var wg sync.WaitGroup
+	for i, m := range members {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outputs[i] = runTeamMember(ctx, m, brief(m), budget)
+		}()
+	}
+	wg.Wait()
+	return outputs
+}
+
+func runTeamParallel(ctx context.Context, members []teamMember, task string, budget *atomic.Int64) (string, error) {
+	outputs := runTeamMembers(ctx, members, func(teamMember) string {
+		return "Task: " + task
+	}, budget)
+	if err := allTeamMembersFailed(outputs); err != nil {
+		return "", err
+	}
+	return formatTeamOutputs(outputs), nil
+}
+
+func runTeamFanout(
+	ctx context.Context,
+	workers []teamMember,
+	lead teamMember,
+	task string,
+	budget *atomic.Int64,
+) (string, error) {
+	outputs := runTeamMembers(ctx, workers, func(teamMember) string {
+		return "Task: " + task + "\n\nYour result will be merged with the other members' by the team lead, " + lead.Name + "."
+	}, budget)
+	if err := allTeamMembersFailed(outputs); err != nil {
+		return "", err
+	}
+
+	brief := "You lead the team. Merge your members' results into one complete answer to the task. " +
+		"Resolve contradictions and point out gaps.\n\nTask: " + task +
+		"\n\nMember results:\n\n" + formatTeamOutputs(outputs)
+	final := runTeamMember(ctx, lead, brief, budget)
+	if final.Err != nil {
+		return "", fmt.Errorf("lead %q failed: %w", lead.Name, final.Err)
+	}
+	return "## " + lead.Name + " (lead)\n\n" + final.Content +
+		"\n\n# Member results\n\n" + formatTeamOutputs(outputs), nil
+}
+
+func runTeamReview(
+	ctx context.Context,
+	author teamMember,
+	reviewers []teamMember,
+	task string,
+	rounds int,
+	budget *atomic.Int64,
+) (string, error) {
+	var draft string
+	var reviews []teamOutput
+	for round := 1; round <= rounds; round++ {
+		brief := "Task: " + task
+		if round > 1 {
+			brief += "\n\nYour previous draft:\n\n" + draft +
+				"\n\nReviewer feedback:\n\n" + formatTeamOutputs(reviews) +
+				"\n\nRevise the draft to address the feedback and reply with the complete new version."
+		}
+		out := runTeamMember(ctx, author, brief, budget)
+		if out.Err != nil {
+			if draft == "" {
+				return "", fmt.Errorf("author %q failed: %w", author.Name, out.Err)
+			}
+			break
+		}
+		draft = out.Content
+
+		reviews = runTeamMembers(ctx, reviewers, func(teamMember) string {
+			return "Review this draft by " + author.Name + " for the task below. If it needs no changes, " +
+				"reply with " + teamApproval + " on the first line. Otherwise list the concrete changes needed." +
+				"\n\nTask: " + task + "\n\nDraft:\n\n" + draft
+		}, budget)
+		if teamApproved(reviews) {
+			return fmt.Sprintf("Approved after %d round(s).\n\n## %s (final draft)\n\n%s", round, author.Name, draft), nil
+		}
+		if budget != nil && budget.Load() <= 0 {
+			break
+		}
+	}
+	return fmt.Sprintf("Not approved by every reviewer; returning the last draft.\n\n## %s (last draft)\n\n%s"+
+		"\n\n# Last reviews\n\n%s", author.Name, draft, formatTeamOutputs(reviews)), nil
+}
+
+// teamApproved reports whether every reviewer that answered approved the
+// draft. Reviewers that failed do not block approval unless all failed.
+func teamApproved(reviews []teamOutput) bool {
+	approved := false
+	for _, r := range reviews {
+		if r.Err != nil {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToUpper(r.Content), teamApproval) {
+			return false
+		}
+		approved = true
+	}
+	return approved
+}
+
+func allTeamMembersFailed(outputs []teamOutput) error {
+	for _, o := range outputs {
+		if o.Err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("every member failed, first error: %w", outputs[0].Err)
+}
+
+func formatTeamOutputs(outputs []teamOutput) string {
+	parts := make([]string, 0, len(outputs))
+	for _, o := range outputs {
+		content := o.Content
+		if o.Err != nil {
+			content = fmt.Sprintf("(failed: %v)", o.Err)
+		} else if content == "" {
+			content = "(no answer)"
+		}
+		parts = append(parts, "## "+o.Name+"\n\n"+content)
+	}
+	return strings.Join(parts, "\n\n")
+}
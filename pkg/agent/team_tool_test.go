@@ -0,0 +1,245 @@
+package agent
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+type teamCall struct {
+	model string
+	brief string
+	tools []string
+}
+
+// teamProvider plays every team member. It answers from the member's brief
+// and charges a fixed number of tokens per call. With loopTools set it keeps
+// calling echo_text for as long as tools are offered.
+type teamProvider struct {
+	mu        sync.Mutex
+	calls     []teamCall
+	tokens    int
+	loopTools bool
+}
+
+func (p *teamProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	var brief string
+	for _, m := range messages {
+		if m.Role == "user" {
+			brief = m.Content
+			break
+		}
+	}
+	call := teamCall{model: model, brief: brief}
+	for _, d := range defs {
+		call.tools = append(call.tools, d.Function.Name)
+	}
+	p.mu.Lock()
+	p.calls = append(p.calls, call)
+	p.mu.Unlock()
+
+	resp := &providers.LLMResponse{Usage: &providers.UsageInfo{TotalTokens: p.tokens}}
+	switch {
+	case p.loopTools && len(defs) > 0:
+		resp.ToolCalls = []providers.ToolCall{{ID: "call-1", Name: "echo_text", Arguments: map[string]any{"text": "x"}}}
+	case p.loopTools:
+		resp.Content = "wrapped up"
+	case strings.Contains(brief, "Review this draft"):
+		if strings.Contains(brief, "draft v2") {
+			resp.Content = "APPROVED"
+		} else {
+			resp.Content = "Add an example."
+		}
+	case strings.Contains(brief, "Your previous draft"):
+		resp.Content = "draft v2"
+	case strings.Contains(brief, "You lead the team"):
+		resp.Content = "merged answer"
+	case strings.Contains(brief, `"writer"`):
+		resp.Content = "draft v1"
+	default:
+		resp.Content = "notes from " + strings.SplitN(strings.SplitN(brief, `"`, 3)[1], `"`, 2)[0]
+	}
+	return resp, nil
+}
+
+func (p *teamProvider) GetDefaultModel() string {
+	return "team-provider"
+}
+
+func (p *teamProvider) callsFor(name string) []teamCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []teamCall
+	for _, c := range p.calls {
+		if strings.Contains(c.brief, `You are "`+name+`"`) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func newTeamTestContext(t *testing.T, provider providers.LLMProvider) (context.Context, *turnState) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		ModelList: []*config.ModelConfig{
+			{ModelName: "test-model", Model: "openai/test-model"},
+			{ModelName: "cheap-model", Model: "openai/cheap-model"},
+		},
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	t.Cleanup(al.Close)
+	agent := al.registry.GetDefaultAgent()
+	agent.Tools.Register(&echoTextTool{})
+
+	parent := &turnState{
+		ctx:            context.Background(),
+		turnID:         "parent-1",
+		pendingResults: make(chan *tools.ToolResult, 10),
+		concurrencySem: make(chan struct{}, 5),
+		session:        &ephemeralSessionStore{},
+		agent:          agent,
+	}
+	ctx := WithAgentLoop(withTurnState(context.Background(), parent), al)
+	return ctx, parent
+}
+
+func TestTeamTool_ParallelUsesMemberModelsAndTools(t *testing.T) {
+	provider := &teamProvider{tokens: 10}
+	ctx, parent := newTeamTestContext(t, provider)
+	parent.agent.Tools.Register(&mockCustomTool{})
+
+	res := newTeamTool(config.TeamToolConfig{}).Execute(ctx, map[string]any{
+		"task": "Compare two boards",
+		"members": []any{
+			map[string]any{"name": "alice", "role": "You check prices.", "model": "cheap-model", "tools": []any{"echo_text"}},
+			map[string]any{"name": "bob"},
+		},
+	})
+	if res.IsError {
+		t.Fatalf("result = %+v", res)
+	}
+	for _, want := range []string{"## alice\n\nnotes from alice", "## bob\n\nnotes from bob", "parallel mode, 2 members"} {
+		if !strings.Contains(res.ForLLM, want) {
+			t.Fatalf("ForLLM missing %q:\n%s", want, res.ForLLM)
+		}
+	}
+
+	alice := provider.callsFor("alice")
+	if len(alice) != 1 || alice[0].model != "cheap-model" || strings.Join(alice[0].tools, ",") != "echo_text" {
+		t.Fatalf("alice calls = %+v, want cheap-model with only echo_text", alice)
+	}
+	if !strings.Contains(alice[0].brief, "You check prices.") {
+		t.Fatalf("alice brief lacks the role: %q", alice[0].brief)
+	}
+	bob := provider.callsFor("bob")
+	if len(bob) != 1 || bob[0].model != "test-model" || len(bob[0].tools) != parent.agent.Tools.Count() {
+		t.Fatalf("bob calls = %+v, want the parent's model and tools", bob)
+	}
+}
+
+func TestTeamTool_FanoutLeadMergesResults(t *testing.T) {
+	provider := &teamProvider{}
+	ctx, _ := newTeamTestContext(t, provider)
+
+	res := newTeamTool(config.TeamToolConfig{}).Execute(ctx, map[string]any{
+		"task": "Plan a trip",
+		"mode": "fanout",
+		"lead": "chief",
+		"members": []any{
+			map[string]any{"name": "chief"},
+			map[string]any{"name": "flights"},
+			map[string]any{"name": "hotels"},
+		},
+	})
+	if res.IsError || !strings.Contains(res.ForLLM, "## chief (lead)\n\nmerged answer") {
+		t.Fatalf("result = %+v", res)
+	}
+	lead := provider.callsFor("chief")
+	if len(lead) != 1 || !strings.Contains(lead[0].brief, "notes from flights") ||
+		!strings.Contains(lead[0].brief, "notes from hotels") {
+		t.Fatalf("lead calls = %+v, want both member results in the brief", lead)
+	}
+}
+
+func TestTeamTool_ReviewLoopRevisesUntilApproved(t *testing.T) {
+	provider := &teamProvider{}
+	ctx, _ := newTeamTestContext(t, provider)
+
+	res := newTeamTool(config.TeamToolConfig{}).Execute(ctx, map[string]any{
+		"task": "Write release notes",
+		"mode": "review",
+		"members": []any{
+			map[string]any{"name": "writer"},
+			map[string]any{"name": "editor"},
+		},
+	})
+	if res.IsError || !strings.Contains(res.ForLLM, "Approved after 2 round(s)") ||
+		!strings.Contains(res.ForLLM, "draft v2") {
+		t.Fatalf("result = %+v", res)
+	}
+	writer := provider.callsFor("writer")
+	if len(writer) != 2 || !strings.Contains(writer[1].brief, "Add an example.") {
+		t.Fatalf("writer calls = %+v, want a revision with the feedback", writer)
+	}
+}
+
+func TestTeamTool_SharedBudgetStopsMembers(t *testing.T) {
+	provider := &teamProvider{tokens: 1000, loopTools: true}
+	ctx, parent := newTeamTestContext(t, provider)
+	parentBudget := &atomic.Int64{}
+	parentBudget.Store(100_000)
+	parent.tokenBudget = parentBudget
+
+	res := newTeamTool(config.TeamToolConfig{}).Execute(ctx, map[string]any{
+		"task":         "Dig forever",
+		"token_budget": 1500,
+		"members": []any{
+			map[string]any{"name": "digger", "tools": []any{"echo_text"}},
+		},
+	})
+	if res.IsError || !strings.Contains(res.ForLLM, "wrapped up") ||
+		!strings.Contains(res.ForLLM, "3000 of 1500 budget tokens used") {
+		t.Fatalf("result = %+v", res)
+	}
+	// Two tool rounds spend the budget; the third call is the tool-less wrap-up.
+	calls := provider.callsFor("digger")
+	if len(calls) != 3 || len(calls[2].tools) != 0 {
+		t.Fatalf("calls = %+v, want two tool rounds and a final call without tools", calls)
+	}
+	if got := parentBudget.Load(); got != 97_000 {
+		t.Fatalf("parent budget = %d, want the team's spend deducted", got)
+	}
+}
+
+func TestTeamTool_RejectsUnknownTools(t *testing.T) {
+	ctx, _ := newTeamTestContext(t, &teamProvider{})
+
+	res := newTeamTool(config.TeamToolConfig{}).Execute(ctx, map[string]any{
+		"task":    "x",
+		"members": []any{map[string]any{"name": "a", "tools": []any{"rm_rf"}}},
+	})
+	if !res.IsError || !strings.Contains(res.ForLLM, `unknown tool "rm_rf"`) {
+		t.Fatalf("result = %+v", res)
+	}
+}
@@ -1,6 +1,13 @@
 package agent
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
 
 func TestParseThinkingLevel(t *testing.T) {
 	tests := []struct {
@@ -33,3 +40,109 @@ func TestParseThinkingLevel(t *testing.T) {
 		})
 	}
 }
+
+// thinkingProvider records the options of each call and supports thinking.
+type thinkingProvider struct {
+	opts []map[string]any
+	msgs [][]providers.Message
+}
+
+func (p *thinkingProvider) Chat(
+	_ context.Context,
+	messages []providers.Message,
+	_ []providers.ToolDefinition,
+	_ string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.opts = append(p.opts, opts)
+	p.msgs = append(p.msgs, messages)
+	return &providers.LLMResponse{Content: "ok"}, nil
+}
+
+func (p *thinkingProvider) GetDefaultModel() string { return "test-model" }
+
+func (p *thinkingProvider) SupportsThinking() bool { return true }
+
+func TestAgentLoop_RoutingTiersSetThinkingAndMaxTokens(t *testing.T) {
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				Routing: &config.RoutingConfig{
+					Enabled:      true,
+					AutoThinking: true,
+					Tiers: []config.RoutingTier{
+						{MinScore: 0, Thinking: "off", MaxTokens: 1024},
+						{MinScore: 0.4, Thinking: "high"},
+					},
+				},
+			},
+		},
+		ModelList: []*config.ModelConfig{
+			{ModelName: "test-model", Model: "openai/test-model", ThinkingLevel: "medium"},
+		},
+	}
+	provider := &thinkingProvider{}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	t.Cleanup(al.Close)
+	sub := al.SubscribeEvents(64)
+	defer al.UnsubscribeEvents(sub.ID)
+
+	ctx := context.Background()
+	for _, msg := range []string{"hi", "review this:\n```go\nfmt.Println()\n```", "/think xhigh hi again"} {
+		if _, err := al.ProcessDirectWithChannel(ctx, msg, "thinking-session", "cli", "direct"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(provider.opts) != 3 {
+		t.Fatalf("calls = %d, want 3", len(provider.opts))
+	}
+	tests := []struct {
+		thinking  any
+		maxTokens int
+	}{
+		{nil, 1024},     // trivial message: thinking off and a small output budget
+		{"high", 4096},  // code: high, the agent's max_tokens
+		{"xhigh", 1024}, // /think overrides the tier's level only
+	}
+	for i, tt := range tests {
+		if got := provider.opts[i]["thinking_level"]; got != tt.thinking {
+			t.Errorf("call %d: thinking_level = %v, want %v", i, got, tt.thinking)
+		}
+		if got := provider.opts[i]["max_tokens"]; got != tt.maxTokens {
+			t.Errorf("call %d: max_tokens = %v, want %d", i, got, tt.maxTokens)
+		}
+	}
+	last := provider.msgs[2][len(provider.msgs[2])-1]
+	if last.Content != "hi again" {
+		t.Errorf("/think sent %q, want the message without the command", last.Content)
+	}
+
+	var payloads []LLMRequestPayload
+	for _, evt := range collectEventStream(sub.C) {
+		if p, ok := evt.Payload.(LLMRequestPayload); ok {
+			payloads = append(payloads, p)
+		}
+	}
+	if len(payloads) != 3 {
+		t.Fatalf("LLM request events = %d, want 3", len(payloads))
+	}
+	want := []struct{ level, source string }{
+		{"off", ThinkingSourceRouting},
+		{"high", ThinkingSourceRouting},
+		{"xhigh", ThinkingSourceCommand},
+	}
+	for i, w := range want {
+		if payloads[i].ThinkingLevel != w.level || payloads[i].ThinkingSource != w.source {
+			t.Errorf("event %d: thinking %s from %s, want %s from %s",
+				i, payloads[i].ThinkingLevel, payloads[i].ThinkingSource, w.level, w.source)
+		}
+	}
+	if payloads[1].RoutingScore < 0.4 {
+		t.Errorf("event 1: routing score %v, want >= 0.4", payloads[1].RoutingScore)
+	}
+}
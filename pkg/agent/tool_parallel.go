@@ -0,0 +1,160 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// toolCallRun is one tool call from an LLM response as runTurn moves it
+// through three steps: prepare (before_tool hooks and approval, in call
+// order), execute (possibly concurrently with its batch) and finalize
+// (after_tool hooks and history, in call order).
+type toolCallRun struct {
+	tc   providers.ToolCall
+	name string
+	args map[string]any
+
+	// denied is the tool message for a call refused by a hook or the
+	// approver. Denied calls are never executed.
+	denied *providers.Message
+
+	callback tools.AsyncCallback
+	result   *tools.ToolResult
+	duration time.Duration
+}
+
+// toolBatchEnd returns the exclusive end of the batch starting at start.
+// A batch is either the single call at start or, when parallel execution is
+// allowed, the longest run of consecutive concurrency-safe calls. Batches
+// never reorder calls, so a write between two reads still runs between them.
+func toolBatchEnd(registry *tools.ToolRegistry, calls []providers.ToolCall, start, maxParallel int) int {
+	end := start + 1
+	if maxParallel <= 1 || !registry.IsConcurrencySafe(calls[start].Name) {
+		return end
+	}
+	for end < len(calls) && registry.IsConcurrencySafe(calls[end].Name) {
+		end++
+	}
+	return end
+}
+
+// executeToolRuns executes every non-denied run in the batch. Runs execute
+// concurrently, at most maxParallel at a time, only when every one of them
+// targets a concurrency-safe tool; otherwise they run one after another in
+// call order. Results are stored on each run, so callers read them back in
+// call order regardless of completion order.
+func (al *AgentLoop) executeToolRuns(ctx context.Context, ts *turnState, runs []*toolCallRun, maxParallel int) {
+	pending := make([]*toolCallRun, 0, len(runs))
+	parallel := maxParallel > 1
+	for _, run := range runs {
+		if run.denied != nil {
+			continue
+		}
+		pending = append(pending, run)
+		// A before_tool hook may have redirected the call to another tool.
+		if !ts.agent.Tools.IsConcurrencySafe(run.name) {
+			parallel = false
+		}
+	}
+
+	if !parallel || len(pending) < 2 {
+		for _, run := range pending {
+			al.executeToolRun(ctx, ts, run)
+		}
+		return
+	}
+
+	logger.DebugCF("agent", "Running tool calls concurrently",
+		map[string]any{
+			"agent_id": ts.agent.ID,
+			"count":    len(pending),
+			"limit":    maxParallel,
+		})
+
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for _, run := range pending {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			al.executeToolRun(ctx, ts, run)
+		}()
+	}
+	wg.Wait()
+}
+
+func (al *AgentLoop) executeToolRun(ctx context.Context, ts *turnState, run *toolCallRun) {
+	start := time.Now()
+	run.result = ts.agent.Tools.ExecuteWithContext(
+		tools.WithToolSessionKey(ctx, ts.sessionKey),
+		run.name,
+		run.args,
+		ts.channel,
+		ts.chatID,
+		run.callback,
+	)
+	run.duration = time.Since(start)
+}
+
+// newAsyncToolCallback builds the completion callback handed to async tools.
+// The result is shown to the user right away and queued back to the agent
+// as a system inbound message.
+func (al *AgentLoop) newAsyncToolCallback(ts *turnState, toolName string, iteration int) tools.AsyncCallback {
+	return func(_ context.Context, result *tools.ToolResult) {
+		// Send ForUser content directly to the user (immediate feedback),
+		// mirroring the synchronous tool execution path.
+		if !result.Silent && result.ForUser != "" {
+			outCtx, outCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer outCancel()
+			_ = al.bus.PublishOutbound(outCtx, bus.OutboundMessage{
+				Channel: ts.channel,
+				ChatID:  ts.chatID,
+				Content: result.ForUser,
+			})
+		}
+
+		// Determine content for the agent loop (ForLLM or error).
+		content := result.ForLLM
+		if content == "" && result.Err != nil {
+			content = result.Err.Error()
+		}
+		if content == "" {
+			return
+		}
+
+		logger.InfoCF("agent", "Async tool completed, publishing result",
+			map[string]any{
+				"tool":        toolName,
+				"content_len": len(content),
+				"channel":     ts.channel,
+			})
+		al.emitEvent(
+			EventKindFollowUpQueued,
+			ts.scope.meta(iteration, "runTurn", "turn.follow_up.queued"),
+			FollowUpQueuedPayload{
+				SourceTool: toolName,
+				Channel:    ts.channel,
+				ChatID:     ts.chatID,
+				ContentLen: len(content),
+			},
+		)
+
+		pubCtx, pubCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer pubCancel()
+		_ = al.bus.PublishInbound(pubCtx, bus.InboundMessage{
+			Channel:  "system",
+			SenderID: fmt.Sprintf("async:%s", toolName),
+			ChatID:   fmt.Sprintf("%s:%s", ts.channel, ts.chatID),
+			Content:  content,
+		})
+	}
+}
@@ -0,0 +1,180 @@
+package agent
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+// parallelToolProvider asks for read_a, read_b, write, read_c in a single
+// response, then finishes.
+type parallelToolProvider struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *parallelToolProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.calls == 1 {
+		return &providers.LLMResponse{
+			ToolCalls: []providers.ToolCall{
+				{ID: "call-1", Name: "read_a", Arguments: map[string]any{}},
+				{ID: "call-2", Name: "read_b", Arguments: map[string]any{}},
+				{ID: "call-3", Name: "write", Arguments: map[string]any{}},
+				{ID: "call-4", Name: "read_c", Arguments: map[string]any{}},
+			},
+		}, nil
+	}
+	return &providers.LLMResponse{Content: "done"}, nil
+}
+
+func (p *parallelToolProvider) GetDefaultModel() string {
+	return "parallel-tool-provider"
+}
+
+// orderTool records when it starts and finishes. Tools sharing a barrier
+// wait until all of them have started, so they only complete when they run
+// concurrently.
+type orderTool struct {
+	name    string
+	safe    bool
+	barrier *sync.WaitGroup
+	events  *orderEvents
+}
+
+type orderEvents struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (e *orderEvents) add(event string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.log = append(e.log, event)
+}
+
+func (t *orderTool) Name() string               { return t.name }
+func (t *orderTool) Description() string        { return "records execution order" }
+func (t *orderTool) Parameters() map[string]any { return map[string]any{"type": "object"} }
+func (t *orderTool) ConcurrencySafe() bool      { return t.safe }
+
+func (t *orderTool) Execute(ctx context.Context, args map[string]any) *tools.ToolResult {
+	t.events.add("start " + t.name)
+	defer t.events.add("end " + t.name)
+
+	if t.barrier != nil {
+		t.barrier.Done()
+		done := make(chan struct{})
+		go func() {
+			t.barrier.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * time.Second):
+			return tools.ErrorResult(t.name + " did not run concurrently")
+		}
+	}
+	return tools.SilentResult(t.name + " result")
+}
+
+func TestRunTurn_RunsConcurrencySafeToolsInParallel(t *testing.T) {
+	al, agent, cleanup := newHookTestLoop(t, &parallelToolProvider{})
+	defer cleanup()
+
+	events := &orderEvents{}
+	barrier := &sync.WaitGroup{}
+	barrier.Add(2)
+	al.RegisterTool(&orderTool{name: "read_a", safe: true, barrier: barrier, events: events})
+	al.RegisterTool(&orderTool{name: "read_b", safe: true, barrier: barrier, events: events})
+	al.RegisterTool(&orderTool{name: "write", events: events})
+	al.RegisterTool(&orderTool{name: "read_c", safe: true, events: events})
+
+	resp, err := al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:      "session-1",
+		Channel:         "cli",
+		ChatID:          "direct",
+		UserMessage:     "read and write",
+		DefaultResponse: defaultResponse,
+	})
+	if err != nil {
+		t.Fatalf("runAgentLoop() error = %v", err)
+	}
+	if resp != "done" {
+		t.Fatalf("response = %q, want done", resp)
+	}
+
+	// The unsafe write must run alone, after both reads and before read_c.
+	events.mu.Lock()
+	log := append([]string(nil), events.log...)
+	events.mu.Unlock()
+	if len(log) != 8 {
+		t.Fatalf("events = %v", log)
+	}
+	want := []string{"start write", "end write", "start read_c", "end read_c"}
+	for i, event := range want {
+		if log[4+i] != event {
+			t.Fatalf("events = %v, want %v after the parallel reads", log, want)
+		}
+	}
+
+	var results []providers.Message
+	for _, msg := range agent.Sessions.GetHistory("session-1") {
+		if msg.Role == "tool" {
+			results = append(results, msg)
+		}
+	}
+	wantResults := []struct{ id, content string }{
+		{"call-1", "read_a result"},
+		{"call-2", "read_b result"},
+		{"call-3", "write result"},
+		{"call-4", "read_c result"},
+	}
+	if len(results) != len(wantResults) {
+		t.Fatalf("tool results = %+v", results)
+	}
+	for i, w := range wantResults {
+		if results[i].ToolCallID != w.id || results[i].Content != w.content {
+			t.Fatalf("result %d = (%q, %q), want (%q, %q)",
+				i, results[i].ToolCallID, results[i].Content, w.id, w.content)
+		}
+	}
+}
+
+func TestToolBatchEnd(t *testing.T) {
+	registry := tools.NewToolRegistry()
+	events := &orderEvents{}
+	registry.Register(&orderTool{name: "read", safe: true, events: events})
+	registry.Register(&orderTool{name: "write", events: events})
+
+	calls := []providers.ToolCall{
+		{Name: "read"}, {Name: "read"}, {Name: "write"}, {Name: "read"}, {Name: "missing"},
+	}
+	tests := []struct {
+		start, maxParallel, want int
+	}{
+		{0, 4, 2},
+		{0, 1, 1},
+		{2, 4, 3},
+		{3, 4, 4},
+		{4, 4, 5},
+	}
+	for _, tt := range tests {
+		if got := toolBatchEnd(registry, calls, tt.start, tt.maxParallel); got != tt.want {
+			t.Errorf("toolBatchEnd(start=%d, max=%d) = %d, want %d", tt.start, tt.maxParallel, got, tt.want)
+		}
+	}
+}
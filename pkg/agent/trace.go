@@ -0,0 +1,247 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tools"
+)
+
+const (
+	turnTraceVersion    = 1
+	turnTraceFileSuffix = ".trace.json"
+	turnTraceDirName    = "traces"
+
+	defaultTurnTraceMaxFiles = 100
+)
+
+var turnTraceNameReplacer = strings.NewReplacer(":", "_", "/", "_", "\\", "_")
+
+// TurnTrace is a complete recording of one root turn: the session state it
+// started from, every provider request and raw response, and every raw tool
+// result. It holds everything `picoclaw replay` needs to re-run the turn
+// without a network or real tools.
+//
+// Responses and results are captured before after_llm / after_tool hooks run,
+// so a replay with hooks disabled reproduces what the model and tools actually
+// returned.
+type TurnTrace struct {
+	Version     int      `json:"version"`
+	TurnID      string   `json:"turn_id"`
+	AgentID     string   `json:"agent_id"`
+	SessionKey  string   `json:"session_key"`
+	Channel     string   `json:"channel,omitempty"`
+	ChatID      string   `json:"chat_id,omitempty"`
+	SenderID    string   `json:"sender_id,omitempty"`
+	SenderName  string   `json:"sender_name,omitempty"`
+	UserMessage string   `json:"user_message"`
+	Media       []string `json:"media,omitempty"`
+
+	History []providers.Message        `json:"history,omitempty"`
+	Summary string                     `json:"summary,omitempty"`
+	Tools   []providers.ToolDefinition `json:"tools,omitempty"`
+
+	LLMCalls  []TraceLLMCall  `json:"llm_calls"`
+	ToolCalls []TraceToolCall `json:"tool_calls,omitempty"`
+
+	Status       TurnEndStatus `json:"status"`
+	FinalContent string        `json:"final_content"`
+	StartedAt    time.Time     `json:"started_at"`
+	EndedAt      time.Time     `json:"ended_at"`
+}
+
+// TraceLLMCall is one successful provider call within a traced turn.
+type TraceLLMCall struct {
+	Iteration int                        `json:"iteration"`
+	Model     string                     `json:"model"`
+	Messages  []providers.Message        `json:"messages"`
+	Tools     []providers.ToolDefinition `json:"tools,omitempty"`
+	Response  *providers.LLMResponse     `json:"response"`
+}
+
+// TraceToolCall is one executed tool call within a traced turn.
+type TraceToolCall struct {
+	Iteration  int               `json:"iteration"`
+	ToolCallID string            `json:"tool_call_id,omitempty"`
+	Tool       string            `json:"tool"`
+	Arguments  map[string]any    `json:"arguments,omitempty"`
+	Result     *tools.ToolResult `json:"result"`
+	// Error preserves ToolResult.Err, which is not JSON-serialized.
+	Error string `json:"error,omitempty"`
+}
+
+// LoadTurnTrace reads a trace file written by the recorder.
+func LoadTurnTrace(path string) (*TurnTrace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("trace: read: %w", err)
+	}
+	var trace TurnTrace
+	if err := json.Unmarshal(data, &trace); err != nil {
+		return nil, fmt.Errorf("trace: decode %s: %w", path, err)
+	}
+	if trace.Version != turnTraceVersion {
+		return nil, fmt.Errorf("trace: unsupported version %d", trace.Version)
+	}
+	return &trace, nil
+}
+
+// traceEnabled reports whether this turn is recorded. Like checkpoints,
+// only root turns are traced; sub-turn output reaches the parent as a tool
+// result and is replayed from there.
+func (al *AgentLoop) traceEnabled(ts *turnState) bool {
+	return ts.agent != nil && ts.depth == 0 && al.GetConfig().Agents.Defaults.TurnTrace.Enabled
+}
+
+// startTurnTrace begins recording once the turn's starting history is known.
+func (al *AgentLoop) startTurnTrace(ts *turnState, history []providers.Message, summary string) {
+	if !al.traceEnabled(ts) {
+		return
+	}
+	ts.trace = &TurnTrace{
+		Version:     turnTraceVersion,
+		TurnID:      ts.turnID,
+		AgentID:     ts.agentID,
+		SessionKey:  ts.sessionKey,
+		Channel:     ts.channel,
+		ChatID:      ts.chatID,
+		SenderID:    ts.opts.SenderID,
+		SenderName:  ts.opts.SenderDisplayName,
+		UserMessage: ts.userMessage,
+		Media:       append([]string(nil), ts.media...),
+		History:     cloneProviderMessages(history),
+		Summary:     summary,
+		Tools:       ts.agent.Tools.ToProviderDefs(),
+		StartedAt:   ts.startedAt,
+	}
+}
+
+func (ts *turnState) traceLLMCall(
+	iteration int,
+	model string,
+	messages []providers.Message,
+	toolDefs []providers.ToolDefinition,
+	resp *providers.LLMResponse,
+) {
+	if ts.trace == nil {
+		return
+	}
+	recorded := cloneLLMResponse(resp)
+	for i, tc := range recorded.ToolCalls {
+		// Name and Arguments are not serialized; make sure Function carries them.
+		recorded.ToolCalls[i] = providers.NormalizeToolCall(tc)
+	}
+	ts.trace.LLMCalls = append(ts.trace.LLMCalls, TraceLLMCall{
+		Iteration: iteration,
+		Model:     model,
+		Messages:  cloneProviderMessages(messages),
+		Tools:     append([]providers.ToolDefinition(nil), toolDefs...),
+		Response:  recorded,
+	})
+}
+
+func (ts *turnState) traceToolCall(
+	iteration int,
+	toolCallID, tool string,
+	args map[string]any,
+	result *tools.ToolResult,
+) {
+	if ts.trace == nil {
+		return
+	}
+	call := TraceToolCall{
+		Iteration:  iteration,
+		ToolCallID: toolCallID,
+		Tool:       tool,
+		Arguments:  cloneStringAnyMap(args),
+		Result:     cloneToolResult(result),
+	}
+	if result != nil && result.Err != nil {
+		call.Error = result.Err.Error()
+	}
+	ts.trace.ToolCalls = append(ts.trace.ToolCalls, call)
+}
+
+// finishTurnTrace writes the trace to disk. Failures are logged but never
+// fail the turn.
+func (al *AgentLoop) finishTurnTrace(ts *turnState, status TurnEndStatus) {
+	if ts.trace == nil {
+		return
+	}
+	trace := ts.trace
+	ts.trace = nil
+
+	ts.mu.RLock()
+	trace.FinalContent = ts.finalContent
+	ts.mu.RUnlock()
+	trace.Status = status
+	trace.EndedAt = time.Now()
+
+	cfg := al.GetConfig().Agents.Defaults.TurnTrace
+	dir := cfg.Dir
+	if dir == "" {
+		dir = filepath.Join(ts.agent.Workspace, turnTraceDirName)
+	}
+	path, err := writeTurnTrace(expandHome(dir), trace)
+	if err != nil {
+		logger.WarnCF("agent", "Failed to write turn trace",
+			map[string]any{"turn_id": ts.turnID, "error": err.Error()})
+		return
+	}
+	logger.DebugCF("agent", "Turn trace written",
+		map[string]any{"turn_id": ts.turnID, "path": path})
+
+	maxFiles := cfg.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = defaultTurnTraceMaxFiles
+	}
+	pruneTurnTraces(expandHome(dir), maxFiles)
+}
+
+func writeTurnTrace(dir string, trace *TurnTrace) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", fmt.Errorf("trace: create dir: %w", err)
+	}
+	data, err := json.MarshalIndent(trace, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("trace: encode: %w", err)
+	}
+	// Timestamp first so lexical order is chronological; turn IDs restart
+	// with the process.
+	name := trace.StartedAt.UTC().Format("20060102-150405.000") + "-" +
+		turnTraceNameReplacer.Replace(trace.TurnID) + turnTraceFileSuffix
+	path := filepath.Join(dir, name)
+	if err := fileutil.WriteFileAtomic(path, data, 0o600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// pruneTurnTraces keeps only the newest maxFiles traces in dir.
+func pruneTurnTraces(dir string, maxFiles int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), turnTraceFileSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) <= maxFiles {
+		return
+	}
+	sort.Strings(names)
+	for _, name := range names[:len(names)-maxFiles] {
+		_ = os.Remove(filepath.Join(dir, name))
+	}
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTraceTestConfig(t *testing.T) *config.Config {
+	t.Helper()
+	return &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+				TurnTrace: config.TurnTraceConfig{
+					Enabled: true,
+					Dir:     filepath.Join(t.TempDir(), "traces"),
+				},
+			},
+		},
+	}
+}
+
+// recordTestTrace runs one tool-calling turn with tracing on and loads the
+// resulting trace file.
+func recordTestTrace(t *testing.T, cfg *config.Config) *TurnTrace {
+	t.Helper()
+
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), &toolHookProvider{})
+	defer al.Close()
+	al.RegisterTool(&echoTextTool{})
+	agent := al.registry.GetDefaultAgent()
+
+	resp, err := al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:      "session-1",
+		Channel:         "cli",
+		ChatID:          "direct",
+		UserMessage:     "run the tool",
+		DefaultResponse: defaultResponse,
+	})
+	if err != nil {
+		t.Fatalf("runAgentLoop() error = %v", err)
+	}
+	if resp != "original" {
+		t.Fatalf("response = %q, want original", resp)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(cfg.Agents.Defaults.TurnTrace.Dir, "*"+turnTraceFileSuffix))
+	if len(paths) != 1 {
+		t.Fatalf("found %d trace files, want 1", len(paths))
+	}
+	trace, err := LoadTurnTrace(paths[0])
+	if err != nil {
+		t.Fatalf("LoadTurnTrace() error = %v", err)
+	}
+	return trace
+}
+
+func TestRunTurn_WritesTurnTrace(t *testing.T) {
+	cfg := newTraceTestConfig(t)
+	trace := recordTestTrace(t, cfg)
+
+	if trace.SessionKey != "session-1" || trace.UserMessage != "run the tool" {
+		t.Fatalf("unexpected trace header: %+v", trace)
+	}
+	if len(trace.LLMCalls) != 2 {
+		t.Fatalf("recorded %d LLM calls, want 2", len(trace.LLMCalls))
+	}
+	first := trace.LLMCalls[0].Response
+	if len(first.ToolCalls) != 1 || first.ToolCalls[0].Function == nil ||
+		first.ToolCalls[0].Function.Name != "echo_text" {
+		t.Fatalf("tool call not recorded with its function: %+v", first.ToolCalls)
+	}
+	if len(trace.ToolCalls) != 1 || trace.ToolCalls[0].Result.ForLLM != "original" {
+		t.Fatalf("unexpected tool calls: %+v", trace.ToolCalls)
+	}
+	if trace.Status != TurnEndStatusCompleted || trace.FinalContent != "original" {
+		t.Fatalf("status = %q, final = %q", trace.Status, trace.FinalContent)
+	}
+}
+
+func TestReplayTurn_ReproducesRecordedTurn(t *testing.T) {
+	cfg := newTraceTestConfig(t)
+	trace := recordTestTrace(t, cfg)
+
+	res, err := ReplayTurn(context.Background(), cfg, trace)
+	if err != nil {
+		t.Fatalf("ReplayTurn() error = %v", err)
+	}
+	if res.Diverged() {
+		t.Fatalf("unexpected divergences: %v", res.Divergences)
+	}
+	if res.FinalContent != "original" || res.LLMCalls != 2 || res.ToolCalls != 1 {
+		t.Fatalf("unexpected replay result: %+v", res)
+	}
+
+	// The replay itself must not be traced.
+	paths, _ := filepath.Glob(filepath.Join(cfg.Agents.Defaults.TurnTrace.Dir, "*"+turnTraceFileSuffix))
+	if len(paths) != 1 {
+		t.Fatalf("replay wrote a trace: %v", paths)
+	}
+}
+
+func TestReplayTurn_ReportsDivergence(t *testing.T) {
+	cfg := newTraceTestConfig(t)
+	trace := recordTestTrace(t, cfg)
+
+	// Pretend the tool now returns something else: the follow-up request no
+	// longer matches what the model saw.
+	trace.ToolCalls[0].Result.ForLLM = "changed"
+
+	res, err := ReplayTurn(context.Background(), cfg, trace)
+	if err != nil {
+		t.Fatalf("ReplayTurn() error = %v", err)
+	}
+	if !res.Diverged() {
+		t.Fatal("expected divergences")
+	}
+	joined := strings.Join(res.Divergences, "\n")
+	if !strings.Contains(joined, "LLM call 2: message 3 (tool): content differs") {
+		t.Fatalf("divergences = %q", joined)
+	}
+}
+
+func TestPruneTurnTraces_KeepsNewest(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"20260101-000000.000-a", "20260102-000000.000-b", "20260103-000000.000-c"} {
+		if err := os.WriteFile(filepath.Join(dir, name+turnTraceFileSuffix), []byte("{}"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruneTurnTraces(dir, 2)
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*"+turnTraceFileSuffix))
+	if len(paths) != 2 || strings.Contains(strings.Join(paths, ","), "-a.") {
+		t.Fatalf("remaining traces = %v", paths)
+	}
+}
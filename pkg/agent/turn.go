@@ -43,6 +43,9 @@ type turnResult struct {
 	finalContent string
 	status       TurnEndStatus
 	followUps    []bus.InboundMessage
+	// messages is the turn's conversation without the system prompt, ending
+	// with the final answer.
+	messages []providers.Message
 }
 
 type turnState struct {
@@ -79,6 +82,16 @@ type turnState struct {
 	restorePointSummary string
 	persistedMessages   []providers.Message
 
+	// Durable checkpoint progress (see checkpoint.go)
+	pendingToolCalls     []providers.ToolCall
+	completedToolResults []providers.Message
+
+	// Replay trace, nil unless turn tracing is enabled (see trace.go)
+	trace *TurnTrace
+
+	// Memory chunks retrieved for userMessage, looked up once per turn
+	relevantMemory string
+
 	// SubTurn support (from HEAD)
 	depth                int                    // SubTurn depth (0 for root turn)
 	parentTurnID         string                 // Parent turn ID (empty for root turn)
@@ -93,11 +106,16 @@ type turnState struct {
 	ctx             context.Context    // Context for this turn
 	cancelFunc      context.CancelFunc // Cancel function for this turn's context
 	critical        bool               // Whether this SubTurn should continue after parent ends
+	onProgress      func(string)       // Receives each model reply (SubTurns only)
 	parentTurnState *turnState         // Reference to parent turnState
 	parentEnded     atomic.Bool        // Whether parent has ended
 	closeOnce       sync.Once          // Ensures pendingResults channel is closed once
 	finishedChan    chan struct{}      // Closed when turn finishes
 
+	// truncateContext trims the messages of each LLM call to the SubTurn's
+	// MaxContextRunes; nil leaves them whole.
+	truncateContext func([]providers.Message) []providers.Message
+
 	// Token budget tracking
 	tokenBudget      *atomic.Int64        // Shared token budget counter
 	lastFinishReason string               // Last LLM finish_reason
@@ -147,16 +165,6 @@ func (al *AgentLoop) getActiveTurnState(sessionKey string) *turnState {
 	return nil
 }
 
-// getAnyActiveTurnState returns any active turn state (for backward compatibility)
-func (al *AgentLoop) getAnyActiveTurnState() *turnState {
-	var firstTS *turnState
-	al.activeTurnStates.Range(func(key, value any) bool {
-		firstTS = value.(*turnState)
-		return false // stop after first
-	})
-	return firstTS
-}
-
 func (al *AgentLoop) GetActiveTurn() *ActiveTurnInfo {
 	// For backward compatibility, return the first active turn found
 	// In the new architecture, there can be multiple concurrent turns
@@ -266,6 +274,32 @@ func (ts *turnState) gracefulInterruptRequested() (bool, string) {
 	return ts.gracefulInterrupt && !ts.gracefulTerminalUsed, ts.gracefulInterruptHint
 }
 
+// tokenBudgetExhausted reports whether the turn runs under a token budget
+// that has been used up.
+func (ts *turnState) tokenBudgetExhausted() bool {
+	return ts.tokenBudget != nil && ts.tokenBudget.Load() <= 0
+}
+
+// spendTokenBudget deducts one LLM call from the turn's token budget. Calls
+// whose provider reports no usage are charged an estimate of their messages.
+func (ts *turnState) spendTokenBudget(u *providers.UsageInfo, messages []providers.Message, reply string) {
+	if ts.tokenBudget == nil {
+		return
+	}
+	spent := 0
+	if u != nil {
+		spent = u.TotalTokens
+		if spent == 0 {
+			spent = u.PromptTokens + u.CompletionTokens
+		}
+	}
+	if spent == 0 {
+		spent = countTokens(ts.agent.Tokenizer, messages)
+		spent += countMessageTokens(ts.agent.Tokenizer, providers.Message{Role: "assistant", Content: reply})
+	}
+	ts.tokenBudget.Add(-int64(spent))
+}
+
 func (ts *turnState) markGracefulTerminalUsed() {
 	ts.mu.Lock()
 	defer ts.mu.Unlock()
@@ -0,0 +1,157 @@
+package agent
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+// usageReportDays is the range of the "recent" part of the /usage report.
+const usageReportDays = 30
+
+// UsageLimitError is returned when a daily spending cap refuses a request.
+type UsageLimitError struct {
+	Scope string  // "daily" for the global cap, "session" for the per-session cap
+	Limit float64 // the cap in USD
+	Spent float64 // what was spent today in that scope
+}
+
+func (e *UsageLimitError) Error() string {
+	return fmt.Sprintf("usage: %s spending cap of $%.2f reached ($%.4f spent today)", e.Scope, e.Limit, e.Spent)
+}
+
+// lookupModelConfig finds the model_list entry a call was sent to. Calls
+// name models either by model_name or by the model ID, with or without the
+// protocol prefix.
+func (al *AgentLoop) lookupModelConfig(model string) *config.ModelConfig {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return nil
+	}
+	cfg := al.GetConfig()
+	for _, mc := range cfg.ModelList {
+		if mc != nil && mc.ModelName == model {
+			return mc
+		}
+	}
+	for _, mc := range cfg.ModelList {
+		if mc == nil {
+			continue
+		}
+		if _, id := providers.ExtractProtocol(mc.Model); mc.Model == model || id == model {
+			return mc
+		}
+	}
+	return nil
+}
+
+// recordUsage books the tokens and cost of one LLM call. sessionKey and
+// channel may be empty for calls that do not belong to a session.
+func (al *AgentLoop) recordUsage(
+	agent *AgentInstance,
+	sessionKey, channel, model string,
+	u *providers.UsageInfo,
+) {
+	if al.usage == nil || agent == nil || u == nil {
+		return
+	}
+	var pricing *config.ModelPricing
+	if mc := al.lookupModelConfig(model); mc != nil {
+		model = mc.ModelName
+		pricing = mc.Pricing
+	}
+	al.usage.Add(usage.Record{
+		SessionKey:       sessionKey,
+		AgentID:          agent.ID,
+		Channel:          channel,
+		Model:            model,
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		CachedTokens:     u.CachedTokens,
+		CacheWriteTokens: u.CacheWriteTokens,
+		Cost:             pricing.Cost(u.PromptTokens, u.CompletionTokens, u.CachedTokens, u.CacheWriteTokens),
+	})
+}
+
+// checkUsageLimit returns a *UsageLimitError when today's spending has
+// reached a configured cap for the session.
+func (al *AgentLoop) checkUsageLimit(sessionKey string) error {
+	limits := al.GetConfig().Usage
+	if al.usage == nil || (limits.DailyCostLimit <= 0 && limits.SessionDailyCostLimit <= 0) {
+		return nil
+	}
+	total, session := al.usage.TodayCost(sessionKey)
+	if limits.DailyCostLimit > 0 && total >= limits.DailyCostLimit {
+		return &UsageLimitError{Scope: "daily", Limit: limits.DailyCostLimit, Spent: total}
+	}
+	if limits.SessionDailyCostLimit > 0 && session >= limits.SessionDailyCostLimit {
+		return &UsageLimitError{Scope: "session", Limit: limits.SessionDailyCostLimit, Spent: session}
+	}
+	return nil
+}
+
+// downgradeCandidates returns the candidates of the model to switch to once
+// a spending cap is reached, or nil when the cap refuses requests instead.
+func (al *AgentLoop) downgradeCandidates() ([]providers.FallbackCandidate, string) {
+	cfg := al.GetConfig()
+	limits := cfg.Usage
+	if limits.OnLimit != config.UsageOnLimitDowngrade || strings.TrimSpace(limits.DowngradeModel) == "" {
+		return nil, ""
+	}
+	candidates := resolveModelCandidates(cfg, cfg.Agents.Defaults.Provider, limits.DowngradeModel, nil)
+	if len(candidates) == 0 {
+		logger.WarnCF("agent", "Usage downgrade model not found; refusing requests over the cap",
+			map[string]any{"downgrade_model": limits.DowngradeModel})
+		return nil, ""
+	}
+	return candidates, resolvedCandidateModel(candidates, limits.DowngradeModel)
+}
+
+// formatUsageReport renders the /usage reply for a session.
+func formatUsageReport(ledger *usage.Ledger, limits config.UsageConfig, sessionKey string) string {
+	today := ledger.Report(1)
+	recent := ledger.Report(usageReportDays)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Today (%s): %s\n", today.Until, formatUsageTotals(today.Total))
+	if t, ok := today.Sessions[sessionKey]; ok {
+		fmt.Fprintf(&sb, "This session today: %s\n", formatUsageTotals(t))
+	}
+	fmt.Fprintf(&sb, "Last %d days: %s\n", usageReportDays, formatUsageTotals(recent.Total))
+	if t, ok := recent.Sessions[sessionKey]; ok {
+		fmt.Fprintf(&sb, "This session, last %d days: %s\n", usageReportDays, formatUsageTotals(t))
+	}
+	if len(today.Models) > 0 {
+		sb.WriteString("\nBy model today:\n")
+		for _, model := range usage.SortedKeys(today.Models) {
+			fmt.Fprintf(&sb, "- %s: %s\n", model, formatUsageTotals(today.Models[model]))
+		}
+	}
+	if limits.DailyCostLimit > 0 || limits.SessionDailyCostLimit > 0 {
+		sb.WriteString("\nDaily caps:")
+		if limits.DailyCostLimit > 0 {
+			fmt.Fprintf(&sb, " total $%.2f", limits.DailyCostLimit)
+		}
+		if limits.SessionDailyCostLimit > 0 {
+			fmt.Fprintf(&sb, " per session $%.2f", limits.SessionDailyCostLimit)
+		}
+		onLimit := limits.OnLimit
+		if onLimit == "" {
+			onLimit = config.UsageOnLimitRefuse
+		}
+		fmt.Fprintf(&sb, " (%s)\n", onLimit)
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func formatUsageTotals(t usage.Totals) string {
+	s := fmt.Sprintf("%d requests, %d prompt + %d completion tokens", t.Requests, t.PromptTokens, t.CompletionTokens)
+	if t.CachedTokens > 0 {
+		s += fmt.Sprintf(" (%d cached)", t.CachedTokens)
+	}
+	return s + fmt.Sprintf(", $%.4f", t.Cost)
+}
@@ -0,0 +1,147 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers"
+)
+
+// usageProvider answers every call with fixed token usage and records the
+// model each call was sent to.
+type usageProvider struct {
+	mu     sync.Mutex
+	models []string
+}
+
+func (p *usageProvider) Chat(
+	ctx context.Context,
+	messages []providers.Message,
+	defs []providers.ToolDefinition,
+	model string,
+	opts map[string]any,
+) (*providers.LLMResponse, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.models = append(p.models, model)
+	return &providers.LLMResponse{
+		Content: "ok",
+		Usage: &providers.UsageInfo{
+			PromptTokens:     1_000_000,
+			CompletionTokens: 100_000,
+			TotalTokens:      1_100_000,
+			CachedTokens:     500_000,
+		},
+	}, nil
+}
+
+func (p *usageProvider) GetDefaultModel() string {
+	return "usage-provider"
+}
+
+func newUsageTestLoop(t *testing.T, provider providers.LLMProvider, limits config.UsageConfig) (*AgentLoop, *AgentInstance) {
+	t.Helper()
+	cfg := &config.Config{
+		Agents: config.AgentsConfig{
+			Defaults: config.AgentDefaults{
+				Workspace:         t.TempDir(),
+				ModelName:         "test-model",
+				MaxTokens:         4096,
+				MaxToolIterations: 10,
+			},
+		},
+		ModelList: []*config.ModelConfig{
+			{
+				ModelName: "test-model",
+				Model:     "openai/test-model",
+				Pricing:   &config.ModelPricing{Input: 2, Output: 10, CachedInput: 1},
+			},
+			{ModelName: "cheap-model", Model: "openai/cheap-model"},
+		},
+		Usage: limits,
+	}
+	al := NewAgentLoop(cfg, bus.NewMessageBus(), provider)
+	t.Cleanup(al.Close)
+	return al, al.registry.GetDefaultAgent()
+}
+
+func runUsageTurn(al *AgentLoop, agent *AgentInstance) (string, error) {
+	return al.runAgentLoop(context.Background(), agent, processOptions{
+		SessionKey:      "session-1",
+		Channel:         "telegram",
+		ChatID:          "chat-1",
+		UserMessage:     "hello",
+		DefaultResponse: defaultResponse,
+	})
+}
+
+func TestRunTurn_RecordsUsageAndCost(t *testing.T) {
+	al, agent := newUsageTestLoop(t, &usageProvider{}, config.UsageConfig{})
+
+	if _, err := runUsageTurn(al, agent); err != nil {
+		t.Fatalf("runAgentLoop() error = %v", err)
+	}
+
+	// 500k uncached input at $2/M + 500k cached at $1/M + 100k output at $10/M.
+	const wantCost = 1.0 + 0.5 + 1.0
+	report := al.usage.Report(1)
+	got := report.Sessions["session-1"]
+	if got.Requests != 1 || got.PromptTokens != 1_000_000 || got.CachedTokens != 500_000 {
+		t.Fatalf("session totals = %+v", got)
+	}
+	if math.Abs(got.Cost-wantCost) > 1e-9 {
+		t.Fatalf("cost = %v, want %v", got.Cost, wantCost)
+	}
+	if report.Models["test-model"].Requests != 1 || report.Agents[agent.ID].Requests != 1 ||
+		report.Channels["telegram"].Requests != 1 {
+		t.Fatalf("breakdown = %+v", report)
+	}
+
+	text := formatUsageReport(al.usage, al.GetConfig().Usage, "session-1")
+	if !strings.Contains(text, "This session today: 1 requests") || !strings.Contains(text, "- test-model:") {
+		t.Fatalf("report:\n%s", text)
+	}
+}
+
+func TestRunTurn_RefusesOverDailyCap(t *testing.T) {
+	al, agent := newUsageTestLoop(t, &usageProvider{}, config.UsageConfig{DailyCostLimit: 1})
+
+	if _, err := runUsageTurn(al, agent); err != nil {
+		t.Fatalf("first runAgentLoop() error = %v", err)
+	}
+	_, err := runUsageTurn(al, agent)
+	var limitErr *UsageLimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("error = %v, want *UsageLimitError", err)
+	}
+	if limitErr.Scope != "daily" || limitErr.Limit != 1 {
+		t.Fatalf("error = %+v", limitErr)
+	}
+}
+
+func TestRunTurn_DowngradesOverSessionCap(t *testing.T) {
+	provider := &usageProvider{}
+	al, agent := newUsageTestLoop(t, provider, config.UsageConfig{
+		SessionDailyCostLimit: 1,
+		OnLimit:               config.UsageOnLimitDowngrade,
+		DowngradeModel:        "cheap-model",
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, err := runUsageTurn(al, agent); err != nil {
+			t.Fatalf("runAgentLoop() #%d error = %v", i+1, err)
+		}
+	}
+	if len(provider.models) != 2 || provider.models[0] != "test-model" || provider.models[1] != "cheap-model" {
+		t.Fatalf("models = %v, want test-model then cheap-model", provider.models)
+	}
+	if got := al.usage.Report(1).Models["cheap-model"]; got.Requests != 1 || got.Cost != 0 {
+		t.Fatalf("cheap-model totals = %+v", got)
+	}
+}
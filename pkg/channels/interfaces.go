@@ -62,6 +62,16 @@ type PlaceholderRecorder interface {
 	RecordReactionUndo(channel, chatID string, undo func())
 }
 
+// ApprovalPromptCapable — channels that can render a tool approval prompt with
+// native approve/deny buttons. A button press MUST be delivered back through
+// HandleMessage on the same chatID with content "yes" or "no", so it resolves
+// the pending approval exactly like a typed reply. Presses by anyone but
+// senderID (the bus SenderID of the user who started the turn) MUST be
+// ignored.
+type ApprovalPromptCapable interface {
+	SendApprovalPrompt(ctx context.Context, chatID, senderID, prompt string) error
+}
+
 // CommandRegistrarCapable is implemented by channels that can register
 // command menus with their upstream platform (e.g. Telegram BotCommand).
 // Channels that do not support platform-level command menus can ignore it.
@@ -0,0 +1,109 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/mymmrac/telego"
+	tu "github.com/mymmrac/telego/telegoutil"
+
+	"github.com/sipeed/picoclaw/pkg/bus"
+	"github.com/sipeed/picoclaw/pkg/identity"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const approvalCallbackPrefix = "picoclaw_approval:"
+
+// SendApprovalPrompt implements channels.ApprovalPromptCapable.
+// The prompt carries inline Approve/Deny buttons; presses are routed back
+// through handleApprovalCallback as a "yes" or "no" reply. The button data
+// names senderID, so presses by other members of a group are rejected.
+func (c *TelegramChannel) SendApprovalPrompt(ctx context.Context, chatID, senderID, prompt string) error {
+	cid, threadID, err := parseTelegramChatID(chatID)
+	if err != nil {
+		return err
+	}
+
+	msg := tu.Message(tu.ID(cid), prompt).WithReplyMarkup(tu.InlineKeyboard(tu.InlineKeyboardRow(
+		tu.InlineKeyboardButton("Approve").WithCallbackData(approvalCallbackPrefix+"yes:"+senderID),
+		tu.InlineKeyboardButton("Deny").WithCallbackData(approvalCallbackPrefix+"no:"+senderID),
+	)))
+	msg.MessageThreadID = threadID
+
+	_, err = c.bot.SendMessage(ctx, msg)
+	return err
+}
+
+func (c *TelegramChannel) handleApprovalCallback(ctx context.Context, query *telego.CallbackQuery) error {
+	if query == nil {
+		return nil
+	}
+
+	platformID := fmt.Sprintf("%d", query.From.ID)
+	sender := bus.SenderInfo{
+		Platform:    "telegram",
+		PlatformID:  platformID,
+		CanonicalID: identity.BuildCanonicalID("telegram", platformID),
+		Username:    query.From.Username,
+		DisplayName: query.From.FirstName,
+	}
+	answer, requester, _ := strings.Cut(strings.TrimPrefix(query.Data, approvalCallbackPrefix), ":")
+	if requester != sender.CanonicalID && requester != platformID {
+		// Leave the buttons in place for the user who was asked.
+		if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID).
+			WithText("Only the user who made the request can answer this.")); err != nil {
+			logger.DebugCF("telegram", "Failed to answer approval callback", map[string]any{
+				"error": err.Error(),
+			})
+		}
+		return nil
+	}
+	if err := c.bot.AnswerCallbackQuery(ctx, tu.CallbackQuery(query.ID)); err != nil {
+		logger.DebugCF("telegram", "Failed to answer approval callback", map[string]any{
+			"error": err.Error(),
+		})
+	}
+	if query.Message == nil || !c.IsAllowedSender(sender) {
+		return nil
+	}
+
+	chat := query.Message.GetChat()
+	compositeChatID := fmt.Sprintf("%d", chat.ID)
+	if prompt := query.Message.Message(); prompt != nil {
+		if chat.IsForum && prompt.MessageThreadID != 0 {
+			compositeChatID = fmt.Sprintf("%d/%d", chat.ID, prompt.MessageThreadID)
+		}
+		// Drop the buttons so the same prompt cannot be answered twice.
+		if _, err := c.bot.EditMessageReplyMarkup(ctx, &telego.EditMessageReplyMarkupParams{
+			ChatID:    tu.ID(chat.ID),
+			MessageID: prompt.MessageID,
+		}); err != nil {
+			logger.DebugCF("telegram", "Failed to clear approval buttons", map[string]any{
+				"error": err.Error(),
+			})
+		}
+	}
+
+	peer := bus.Peer{Kind: "direct", ID: platformID}
+	if chat.Type != "private" {
+		peer = bus.Peer{Kind: "group", ID: compositeChatID}
+	}
+
+	c.HandleMessage(c.ctx,
+		peer,
+		query.ID,
+		platformID,
+		compositeChatID,
+		answer,
+		nil,
+		map[string]string{
+			"user_id":    platformID,
+			"username":   query.From.Username,
+			"first_name": query.From.FirstName,
+			"is_group":   fmt.Sprintf("%t", chat.Type != "private"),
+		},
+		sender,
+	)
+	return nil
+}
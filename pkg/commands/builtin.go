@@ -13,6 +13,9 @@ func BuiltinDefinitions() []Definition {
 		switchCommand(),
 		checkCommand(),
 		clearCommand(),
+		usageCommand(),
+		thinkCommand(),
+		profileCommand(),
 		subagentsCommand(),
 		reloadCommand(),
 	}
@@ -0,0 +1,59 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+func profileCommand() Definition {
+	return Definition{
+		Name:        "profile",
+		Description: "Show or switch this chat's profile",
+		Usage:       "/profile [<name>|default]",
+		Handler: func(_ context.Context, req Request, rt *Runtime) error {
+			if rt == nil || rt.GetProfile == nil || rt.SwitchProfile == nil {
+				return req.Reply(unavailableMsg)
+			}
+			name := nthToken(req.Text, 1)
+			if name == "" {
+				current, available, err := rt.GetProfile()
+				if err != nil {
+					return req.Reply(err.Error())
+				}
+				return req.Reply(formatProfiles(current, available))
+			}
+			if name == "default" {
+				if err := rt.SwitchProfile(""); err != nil {
+					return req.Reply(err.Error())
+				}
+				return req.Reply("Switched to the default profile")
+			}
+			if err := rt.SwitchProfile(name); err != nil {
+				return req.Reply(err.Error())
+			}
+			return req.Reply(fmt.Sprintf("Switched to profile %s", name))
+		},
+	}
+}
+
+func formatProfiles(current string, available []ProfileInfo) string {
+	if current == "" {
+		current = "default"
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Current profile: %s", current)
+	if len(available) == 0 {
+		sb.WriteString("\nNo profiles found in the workspace's profiles/ directory.")
+		return sb.String()
+	}
+	sb.WriteString("\n\nAvailable profiles:")
+	for _, p := range available {
+		fmt.Fprintf(&sb, "\n- %s", p.Name)
+		if p.Description != "" {
+			fmt.Fprintf(&sb, ": %s", p.Description)
+		}
+	}
+	sb.WriteString("\n\nUse /profile <name> to switch, /profile default to go back.")
+	return sb.String()
+}
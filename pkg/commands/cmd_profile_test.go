@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestProfile_ShowAndSwitch(t *testing.T) {
+	current := ""
+	rt := &Runtime{
+		GetProfile: func() (string, []ProfileInfo, error) {
+			return current, []ProfileInfo{
+				{Name: "coder", Description: "Coding helper"},
+				{Name: "home"},
+			}, nil
+		},
+		SwitchProfile: func(name string) error {
+			if name == "missing" {
+				return errors.New(`profile "missing" not found`)
+			}
+			current = name
+			return nil
+		},
+	}
+	ex := NewExecutor(NewRegistry(BuiltinDefinitions()), rt)
+	run := func(text string) string {
+		t.Helper()
+		var reply string
+		res := ex.Execute(context.Background(), Request{
+			Text: text,
+			Reply: func(s string) error {
+				reply = s
+				return nil
+			},
+		})
+		if res.Outcome != OutcomeHandled || res.Err != nil {
+			t.Fatalf("%s: result = %+v", text, res)
+		}
+		return reply
+	}
+
+	want := "Current profile: default\n\nAvailable profiles:\n- coder: Coding helper\n- home\n\n" +
+		"Use /profile <name> to switch, /profile default to go back."
+	if got := run("/profile"); got != want {
+		t.Fatalf("/profile = %q", got)
+	}
+	if got := run("/profile coder"); got != "Switched to profile coder" || current != "coder" {
+		t.Fatalf("/profile coder = %q, current %q", got, current)
+	}
+	if got := run("/profile missing"); got != `profile "missing" not found` || current != "coder" {
+		t.Fatalf("/profile missing = %q, current %q", got, current)
+	}
+	if got := run("/profile default"); got != "Switched to the default profile" || current != "" {
+		t.Fatalf("/profile default = %q, current %q", got, current)
+	}
+}
@@ -33,6 +33,23 @@ func showCommand() Definition {
 				Description: "Registered agents",
 				Handler:     agentsHandler(),
 			},
+			{
+				Name:        "plan",
+				Description: "Task plan of this session",
+				Handler: func(_ context.Context, req Request, rt *Runtime) error {
+					if rt == nil || rt.GetPlan == nil {
+						return req.Reply(unavailableMsg)
+					}
+					plan, err := rt.GetPlan()
+					if err != nil {
+						return err
+					}
+					if plan == "" {
+						return req.Reply("No plan for this session.")
+					}
+					return req.Reply(plan)
+				},
+			},
 		},
 	}
 }
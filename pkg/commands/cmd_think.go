@@ -0,0 +1,26 @@
+package commands
+
+import "context"
+
+func thinkCommand() Definition {
+	return Definition{
+		Name:        "think",
+		Description: "Answer one message with a given thinking level",
+		Usage:       "/think <off|low|medium|high|xhigh|adaptive> <message>",
+		Handler: func(ctx context.Context, req Request, rt *Runtime) error {
+			if rt == nil || rt.RunWithThinking == nil {
+				return req.Reply(unavailableMsg)
+			}
+			level := nthToken(req.Text, 1)
+			message := textAfterTokens(req.Text, 2)
+			if level == "" || message == "" {
+				return req.Reply("Usage: /think <off|low|medium|high|xhigh|adaptive> <message>")
+			}
+			reply, err := rt.RunWithThinking(ctx, level, message)
+			if err != nil {
+				return req.Reply(err.Error())
+			}
+			return req.Reply(reply)
+		},
+	}
+}
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestThink_RunsMessageWithLevel(t *testing.T) {
+	var gotLevel, gotMessage string
+	rt := &Runtime{
+		RunWithThinking: func(_ context.Context, level, message string) (string, error) {
+			gotLevel, gotMessage = level, message
+			return "answer", nil
+		},
+	}
+	ex := NewExecutor(NewRegistry(BuiltinDefinitions()), rt)
+
+	var reply string
+	res := ex.Execute(context.Background(), Request{
+		Text: "/think high  why is the sky\nblue?",
+		Reply: func(text string) error {
+			reply = text
+			return nil
+		},
+	})
+	if res.Outcome != OutcomeHandled || res.Err != nil {
+		t.Fatalf("result = %+v", res)
+	}
+	if gotLevel != "high" || gotMessage != "why is the sky\nblue?" {
+		t.Fatalf("RunWithThinking(%q, %q)", gotLevel, gotMessage)
+	}
+	if reply != "answer" {
+		t.Fatalf("reply = %q, want the agent's answer", reply)
+	}
+}
+
+func TestThink_UsageAndErrors(t *testing.T) {
+	rt := &Runtime{
+		RunWithThinking: func(_ context.Context, level, message string) (string, error) {
+			return "", errors.New(`unknown thinking level "huge"`)
+		},
+	}
+	ex := NewExecutor(NewRegistry(BuiltinDefinitions()), rt)
+
+	cases := map[string]string{
+		"/think":            "Usage: /think <off|low|medium|high|xhigh|adaptive> <message>",
+		"/think high":       "Usage: /think <off|low|medium|high|xhigh|adaptive> <message>",
+		"/think huge hello": `unknown thinking level "huge"`,
+	}
+	for text, want := range cases {
+		var reply string
+		ex.Execute(context.Background(), Request{
+			Text: text,
+			Reply: func(text string) error {
+				reply = text
+				return nil
+			},
+		})
+		if reply != want {
+			t.Errorf("%s: reply = %q, want %q", text, reply, want)
+		}
+	}
+}
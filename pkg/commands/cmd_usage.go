@@ -0,0 +1,21 @@
+package commands
+
+import "context"
+
+func usageCommand() Definition {
+	return Definition{
+		Name:        "usage",
+		Description: "Show token usage and cost",
+		Usage:       "/usage",
+		Handler: func(_ context.Context, req Request, rt *Runtime) error {
+			if rt == nil || rt.GetUsage == nil {
+				return req.Reply(unavailableMsg)
+			}
+			report, err := rt.GetUsage()
+			if err != nil {
+				return req.Reply("Failed to read usage: " + err.Error())
+			}
+			return req.Reply(report)
+		},
+	}
+}
@@ -3,6 +3,7 @@ package commands
 import (
 	"context"
 	"strings"
+	"unicode"
 )
 
 type Handler func(ctx context.Context, req Request, rt *Runtime) error
@@ -70,6 +71,20 @@ func nthToken(input string, n int) string {
 	return parts[n]
 }
 
+// textAfterTokens returns input without its first n tokens, keeping the
+// spacing and line breaks of the rest.
+func textAfterTokens(input string, n int) string {
+	rest := strings.TrimSpace(input)
+	for range n {
+		i := strings.IndexFunc(rest, unicode.IsSpace)
+		if i < 0 {
+			return ""
+		}
+		rest = strings.TrimLeftFunc(rest[i:], unicode.IsSpace)
+	}
+	return rest
+}
+
 func normalizeCommandName(name string) string {
 	return strings.ToLower(strings.TrimSpace(name))
 }
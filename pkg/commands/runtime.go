@@ -1,6 +1,10 @@
 package commands
 
-import "github.com/sipeed/picoclaw/pkg/config"
+import (
+	"context"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
 
 // Runtime provides runtime dependencies to command handlers. It is constructed
 // per-request by the agent loop so that per-request state (like session scope)
@@ -15,5 +19,16 @@ type Runtime struct {
 	SwitchModel        func(value string) (oldModel string, err error)
 	SwitchChannel      func(value string) error
 	ClearHistory       func() error
+	GetPlan            func() (string, error)
+	GetUsage           func() (string, error)
+	RunWithThinking    func(ctx context.Context, level, message string) (string, error)
+	GetProfile         func() (current string, available []ProfileInfo, err error)
+	SwitchProfile      func(name string) error
 	ReloadConfig       func() error
 }
+
+// ProfileInfo describes a workspace profile for /profile.
+type ProfileInfo struct {
+	Name        string
+	Description string
+}
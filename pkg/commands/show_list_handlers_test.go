@@ -83,3 +83,37 @@ func TestShowListHandlers_ListHandledOnAllChannels(t *testing.T) {
 		t.Fatalf("whatsapp /list reply=%q, expected enabled channels content", reply)
 	}
 }
+
+func TestShowPlan(t *testing.T) {
+	plan := ""
+	rt := &Runtime{
+		GetPlan: func() (string, error) {
+			return plan, nil
+		},
+	}
+	ex := NewExecutor(NewRegistry(BuiltinDefinitions()), rt)
+
+	show := func() string {
+		var reply string
+		res := ex.Execute(context.Background(), Request{
+			Channel: "telegram",
+			Text:    "/show plan",
+			Reply: func(text string) error {
+				reply = text
+				return nil
+			},
+		})
+		if res.Outcome != OutcomeHandled || res.Err != nil {
+			t.Fatalf("/show plan outcome=%v err=%v", res.Outcome, res.Err)
+		}
+		return reply
+	}
+
+	if reply := show(); reply != "No plan for this session." {
+		t.Fatalf("/show plan reply=%q without a plan", reply)
+	}
+	plan = "Goal: g\n1. [x] a"
+	if reply := show(); reply != plan {
+		t.Fatalf("/show plan reply=%q, want %q", reply, plan)
+	}
+}
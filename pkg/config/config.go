@@ -95,6 +95,7 @@ type Config struct {
 	Heartbeat HeartbeatConfig `json:"heartbeat"`
 	Devices   DevicesConfig   `json:"devices"`
 	Voice     VoiceConfig     `json:"voice"`
+	Usage     UsageConfig     `json:"usage,omitempty"`
 	// BuildInfo contains build-time version information
 	BuildInfo BuildInfo `json:"build_info,omitempty"`
 
@@ -119,6 +120,7 @@ type HooksConfig struct {
 	Defaults  HookDefaultsConfig           `json:"defaults,omitempty"`
 	Builtins  map[string]BuiltinHookConfig `json:"builtins,omitempty"`
 	Processes map[string]ProcessHookConfig `json:"processes,omitempty"`
+	Approval  ToolApprovalConfig           `json:"approval,omitempty"`
 }
 
 type HookDefaultsConfig struct {
@@ -133,6 +135,16 @@ type BuiltinHookConfig struct {
 	Config   json.RawMessage `json:"config,omitempty"`
 }
 
+// ToolApprovalConfig configures the built-in chat approver, which asks the
+// originating chat before running tools whose policy is "ask".
+type ToolApprovalConfig struct {
+	Enabled        bool              `json:"enabled"`
+	Priority       int               `json:"priority,omitempty"`
+	DefaultPolicy  string            `json:"default_policy,omitempty"`  // "always" (default), "never" or "ask"
+	Tools          map[string]string `json:"tools,omitempty"`           // per-tool policy, keyed by tool name
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty"` // unanswered prompts are denied (default 120)
+}
+
 type ProcessHookConfig struct {
 	Enabled   bool              `json:"enabled"`
 	Priority  int               `json:"priority,omitempty"`
@@ -140,6 +152,8 @@ type ProcessHookConfig struct {
 	Command   []string          `json:"command,omitempty"`
 	Dir       string            `json:"dir,omitempty"`
 	Env       map[string]string `json:"env,omitempty"`
+	Address   string            `json:"address,omitempty"`
+	Headers   map[string]string `json:"headers,omitempty"`
 	Observe   []string          `json:"observe,omitempty"`
 	Intercept []string          `json:"intercept,omitempty"`
 }
@@ -223,6 +237,28 @@ type AgentConfig struct {
 	Model     *AgentModelConfig `json:"model,omitempty"`
 	Skills    []string          `json:"skills,omitempty"`
 	Subagents *SubagentsConfig  `json:"subagents,omitempty"`
+	// ResponseSchema constrains the agent's final answer on direct calls
+	// (ProcessDirect, cron jobs) to a JSON Schema.
+	ResponseSchema *ResponseSchemaConfig `json:"response_schema,omitempty"`
+	// ContextCompression overrides agents.defaults.context_compression.
+	ContextCompression string `json:"context_compression,omitempty"`
+	// Tools narrows the tools the agent gets.
+	Tools *ToolPolicy `json:"tools,omitempty"`
+}
+
+// ToolPolicy narrows a set of tools. Entries are glob patterns matched
+// against tool names, e.g. "exec" or "mcp_github_*". When Allow is set only
+// matching tools are kept; Deny removes matching tools and wins over Allow.
+type ToolPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+// ResponseSchemaConfig is a JSON Schema a final answer must match.
+type ResponseSchemaConfig struct {
+	Name   string         `json:"name,omitempty"`
+	Schema map[string]any `json:"schema"`
+	Strict bool           `json:"strict,omitempty"`
 }
 
 type SubagentsConfig struct {
@@ -246,6 +282,9 @@ type BindingMatch struct {
 type AgentBinding struct {
 	AgentID string       `json:"agent_id"`
 	Match   BindingMatch `json:"match"`
+	// Tools further narrows the agent's tools for messages routed by this
+	// binding.
+	Tools *ToolPolicy `json:"tools,omitempty"`
 }
 
 type SessionConfig struct {
@@ -259,10 +298,23 @@ type SessionConfig struct {
 // Messages scoring below Threshold are sent to LightModel; all others use the
 // agent's primary model. This reduces cost and latency for simple tasks without
 // requiring any keyword matching — all scoring is language-agnostic.
+//
+// With AutoThinking the same score also picks the thinking level and
+// max_tokens of the turn from Tiers (built-in tiers when empty).
 type RoutingConfig struct {
-	Enabled    bool    `json:"enabled"`
-	LightModel string  `json:"light_model"` // model_name from model_list to use for simple tasks
-	Threshold  float64 `json:"threshold"`   // complexity score in [0,1]; score >= threshold → primary model
+	Enabled      bool          `json:"enabled"`
+	LightModel   string        `json:"light_model"`             // model_name from model_list to use for simple tasks
+	Threshold    float64       `json:"threshold"`               // complexity score in [0,1]; score >= threshold → primary model
+	AutoThinking bool          `json:"auto_thinking,omitempty"` // derive thinking level and max_tokens from the score
+	Tiers        []RoutingTier `json:"tiers,omitempty"`
+}
+
+// RoutingTier applies to messages scoring at least MinScore, up to the next
+// tier's MinScore.
+type RoutingTier struct {
+	MinScore  float64 `json:"min_score"`
+	Thinking  string  `json:"thinking,omitempty"`   // off|low|medium|high|xhigh|adaptive; empty keeps the model's level
+	MaxTokens int     `json:"max_tokens,omitempty"` // 0 keeps the agent's max_tokens
 }
 
 // SubTurnConfig configures the SubTurn execution system.
@@ -279,6 +331,32 @@ type ToolFeedbackConfig struct {
 	MaxArgsLength int  `json:"max_args_length" env:"PICOCLAW_AGENTS_DEFAULTS_TOOL_FEEDBACK_MAX_ARGS_LENGTH"`
 }
 
+// TurnTraceConfig controls recording of full turn traces for offline replay.
+type TurnTraceConfig struct {
+	Enabled  bool   `json:"enabled"             env:"PICOCLAW_AGENTS_DEFAULTS_TURN_TRACE_ENABLED"`
+	Dir      string `json:"dir,omitempty"       env:"PICOCLAW_AGENTS_DEFAULTS_TURN_TRACE_DIR"`       // default: <workspace>/traces
+	MaxFiles int    `json:"max_files,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_TURN_TRACE_MAX_FILES"` // default: 100
+}
+
+// MemoryConfig controls how long-term memory (memory/MEMORY.md and the daily
+// notes) reaches the prompt. With Retrieval on, only the chunks relevant to
+// the current message are injected instead of the whole files. It is off by
+// default so that existing agents keep seeing all of their memory.
+type MemoryConfig struct {
+	Retrieval      bool   `json:"retrieval"                 env:"PICOCLAW_AGENTS_DEFAULTS_MEMORY_RETRIEVAL"`
+	TopK           int    `json:"top_k,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_MEMORY_TOP_K"`           // default: 5
+	ChunkSize      int    `json:"chunk_size,omitempty"      env:"PICOCLAW_AGENTS_DEFAULTS_MEMORY_CHUNK_SIZE"`      // default: 800 characters
+	EmbeddingModel string `json:"embedding_model,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_MEMORY_EMBEDDING_MODEL"` // model_name of an OpenAI-compatible embeddings model
+}
+
+// SchedulerConfig controls how the gateway schedules turns. Turns for
+// different sessions run concurrently up to MaxConcurrentTurns; turns for the
+// same session always run one after another.
+type SchedulerConfig struct {
+	MaxConcurrentTurns int                 `json:"max_concurrent_turns,omitempty" env:"PICOCLAW_AGENTS_DEFAULTS_SCHEDULER_MAX_CONCURRENT_TURNS"` // default: 4
+	Owners             FlexibleStringSlice `json:"owners,omitempty"               env:"PICOCLAW_AGENTS_DEFAULTS_SCHEDULER_OWNERS"`               // senders whose messages go first, same format as allow_from
+}
+
 type AgentDefaults struct {
 	Workspace                 string             `json:"workspace"                       env:"PICOCLAW_AGENTS_DEFAULTS_WORKSPACE"`
 	RestrictToWorkspace       bool               `json:"restrict_to_workspace"           env:"PICOCLAW_AGENTS_DEFAULTS_RESTRICT_TO_WORKSPACE"`
@@ -292,17 +370,26 @@ type AgentDefaults struct {
 	ContextWindow             int                `json:"context_window,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_WINDOW"`
 	Temperature               *float64           `json:"temperature,omitempty"           env:"PICOCLAW_AGENTS_DEFAULTS_TEMPERATURE"`
 	MaxToolIterations         int                `json:"max_tool_iterations"             env:"PICOCLAW_AGENTS_DEFAULTS_MAX_TOOL_ITERATIONS"`
+	MaxParallelTools          int                `json:"max_parallel_tools,omitempty"    env:"PICOCLAW_AGENTS_DEFAULTS_MAX_PARALLEL_TOOLS"`
 	SummarizeMessageThreshold int                `json:"summarize_message_threshold"     env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZE_MESSAGE_THRESHOLD"`
 	SummarizeTokenPercent     int                `json:"summarize_token_percent"         env:"PICOCLAW_AGENTS_DEFAULTS_SUMMARIZE_TOKEN_PERCENT"`
+	ContextCompression        string             `json:"context_compression,omitempty"   env:"PICOCLAW_AGENTS_DEFAULTS_CONTEXT_COMPRESSION"` // "summarize" (default), "elide_tool_results", "rolling_summary" or "importance"
 	MaxMediaSize              int                `json:"max_media_size,omitempty"        env:"PICOCLAW_AGENTS_DEFAULTS_MAX_MEDIA_SIZE"`
 	Routing                   *RoutingConfig     `json:"routing,omitempty"`
 	SteeringMode              string             `json:"steering_mode,omitempty"         env:"PICOCLAW_AGENTS_DEFAULTS_STEERING_MODE"` // "one-at-a-time" (default) or "all"
 	SubTurn                   SubTurnConfig      `json:"subturn"                                                                                     envPrefix:"PICOCLAW_AGENTS_DEFAULTS_SUBTURN_"`
 	ToolFeedback              ToolFeedbackConfig `json:"tool_feedback,omitempty"`
+	TurnRecovery              string             `json:"turn_recovery,omitempty"         env:"PICOCLAW_AGENTS_DEFAULTS_TURN_RECOVERY"` // "rollback" (default) or "resume"
+	TurnTrace                 TurnTraceConfig    `json:"turn_trace,omitempty"`
+	PlanMode                  bool               `json:"plan_mode,omitempty"             env:"PICOCLAW_AGENTS_DEFAULTS_PLAN_MODE"`
+	Memory                    MemoryConfig       `json:"memory"`
+	Scheduler                 SchedulerConfig    `json:"scheduler,omitempty"`
 }
 
 const (
 	DefaultMaxMediaSize                = 20 * 1024 * 1024 // 20 MB
+	DefaultMaxParallelTools            = 4
+	DefaultMaxConcurrentTurns          = 4
 	DefaultWeComAIBotProcessingMessage = "⏳ Processing, please wait. The results will be sent shortly."
 )
 
@@ -326,6 +413,32 @@ func (d *AgentDefaults) IsToolFeedbackEnabled() bool {
 	return d.ToolFeedback.Enabled
 }
 
+// GetMaxParallelTools returns how many concurrency-safe tool calls from one
+// LLM response may run at once. 1 runs every tool call sequentially.
+func (d *AgentDefaults) GetMaxParallelTools() int {
+	if d.MaxParallelTools > 0 {
+		return d.MaxParallelTools
+	}
+	return DefaultMaxParallelTools
+}
+
+// GetMaxConcurrentTurns returns how many sessions may run a turn at once.
+func (d *AgentDefaults) GetMaxConcurrentTurns() int {
+	if d.Scheduler.MaxConcurrentTurns > 0 {
+		return d.Scheduler.MaxConcurrentTurns
+	}
+	return DefaultMaxConcurrentTurns
+}
+
+// GetTurnRecovery returns how turns interrupted by a crash or restart are
+// recovered on startup: "rollback" (default) or "resume".
+func (d *AgentDefaults) GetTurnRecovery() string {
+	if strings.EqualFold(strings.TrimSpace(d.TurnRecovery), "resume") {
+		return "resume"
+	}
+	return "rollback"
+}
+
 // GetModelName returns the effective model name for the agent defaults.
 // It prefers the new "model_name" field but falls back to "model" for backward compatibility.
 func (d *AgentDefaults) GetModelName() string {
@@ -903,6 +1016,26 @@ type HeartbeatConfig struct {
 	Interval int  `json:"interval" env:"PICOCLAW_HEARTBEAT_INTERVAL"` // minutes, min 5
 }
 
+// UsageConfig controls spending caps. Costs come from the pricing of each
+// model in model_list; calls to models without pricing cost nothing.
+type UsageConfig struct {
+	// DailyCostLimit caps the cost in USD of all LLM calls per day; 0 disables it.
+	DailyCostLimit float64 `json:"daily_cost_limit,omitempty" env:"PICOCLAW_USAGE_DAILY_COST_LIMIT"`
+	// SessionDailyCostLimit caps the cost in USD per session per day; 0 disables it.
+	SessionDailyCostLimit float64 `json:"session_daily_cost_limit,omitempty" env:"PICOCLAW_USAGE_SESSION_DAILY_COST_LIMIT"`
+	// OnLimit is what happens once a cap is reached: "refuse" (default)
+	// answers with a notice instead of calling the model, "downgrade"
+	// switches to DowngradeModel.
+	OnLimit string `json:"on_limit,omitempty" env:"PICOCLAW_USAGE_ON_LIMIT"`
+	// DowngradeModel is the model_name used with on_limit "downgrade".
+	DowngradeModel string `json:"downgrade_model,omitempty" env:"PICOCLAW_USAGE_DOWNGRADE_MODEL"`
+}
+
+const (
+	UsageOnLimitRefuse    = "refuse"
+	UsageOnLimitDowngrade = "downgrade"
+)
+
 type DevicesConfig struct {
 	Enabled    bool `json:"enabled"     env:"PICOCLAW_DEVICES_ENABLED"`
 	MonitorUSB bool `json:"monitor_usb" env:"PICOCLAW_DEVICES_MONITOR_USB"`
@@ -941,12 +1074,52 @@ type ModelConfig struct {
 	RequestTimeout int    `json:"request_timeout,omitempty"`
 	ThinkingLevel  string `json:"thinking_level,omitempty"` // Extended thinking: off|low|medium|high|xhigh|adaptive
 
+	// Accounting
+	Pricing *ModelPricing `json:"pricing,omitempty"` // Token prices used for cost accounting and spending caps
+
+	// Token counting for context budgets
+	Tokenizer     string `json:"tokenizer,omitempty"`      // auto|cl100k|o200k|llama3|llama|heuristic (default: auto from model)
+	TokenizerFile string `json:"tokenizer_file,omitempty"` // BPE rank table in tiktoken format for exact counts
+
 	// from security
 	secModelName string
 	apiKeys      []string
 	secDirty     bool
 }
 
+// ModelPricing is the price of a model in USD per million tokens.
+// CachedInput applies to prompt tokens read from the provider's prompt
+// cache, CacheWrite to prompt tokens written to it; when either is zero
+// those tokens are billed at the Input price.
+type ModelPricing struct {
+	Input       float64 `json:"input"`
+	Output      float64 `json:"output"`
+	CachedInput float64 `json:"cached_input,omitempty"`
+	CacheWrite  float64 `json:"cache_write,omitempty"`
+}
+
+// Cost returns the price in USD of a call with the given token counts.
+// cached is the part of prompt read from the cache, cacheWrite the part
+// written to it.
+func (p *ModelPricing) Cost(prompt, completion, cached, cacheWrite int) float64 {
+	if p == nil {
+		return 0
+	}
+	cached = min(max(cached, 0), prompt)
+	cacheWrite = min(max(cacheWrite, 0), prompt-cached)
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	writePrice := p.CacheWrite
+	if writePrice == 0 {
+		writePrice = p.Input
+	}
+	uncached := prompt - cached - cacheWrite
+	return (float64(uncached)*p.Input + float64(cached)*cachedPrice + float64(cacheWrite)*writePrice +
+		float64(completion)*p.Output) / 1e6
+}
+
 // APIKey returns the first API key from apiKeys
 func (c *ModelConfig) APIKey() string {
 	if len(c.apiKeys) > 0 {
@@ -1171,6 +1344,26 @@ type CronToolsConfig struct {
 	AllowCommand       bool `                                 env:"PICOCLAW_TOOLS_CRON_ALLOW_COMMAND"        json:"allow_command"`
 }
 
+type TeamToolConfig struct {
+	ToolConfig  `    envPrefix:"PICOCLAW_TOOLS_TEAM_"`
+	TokenBudget int `                                 env:"PICOCLAW_TOOLS_TEAM_TOKEN_BUDGET" json:"token_budget"` // 0 falls back to the sub-turn default
+	MaxMembers  int `                                 env:"PICOCLAW_TOOLS_TEAM_MAX_MEMBERS"  json:"max_members"`
+	MaxRounds   int `                                 env:"PICOCLAW_TOOLS_TEAM_MAX_ROUNDS"   json:"max_rounds"`
+}
+
+type ShellSessionConfig struct {
+	ToolConfig         `    envPrefix:"PICOCLAW_TOOLS_SHELL_SESSION_"`
+	IdleTimeoutSeconds int `                                          env:"PICOCLAW_TOOLS_SHELL_SESSION_IDLE_TIMEOUT_SECONDS" json:"idle_timeout_seconds"` // 0 means use default (600s)
+	MaxSessions        int `                                          env:"PICOCLAW_TOOLS_SHELL_SESSION_MAX_SESSIONS"         json:"max_sessions"`         // per conversation; 0 means use default (4)
+}
+
+type RefineToolConfig struct {
+	ToolConfig     `       envPrefix:"PICOCLAW_TOOLS_EVALUATE_AND_REFINE_"`
+	EvaluatorModel string  `                                                env:"PICOCLAW_TOOLS_EVALUATE_AND_REFINE_EVALUATOR_MODEL" json:"evaluator_model,omitempty"`
+	PassScore      float64 `                                                env:"PICOCLAW_TOOLS_EVALUATE_AND_REFINE_PASS_SCORE"      json:"pass_score"`
+	MaxIterations  int     `                                                env:"PICOCLAW_TOOLS_EVALUATE_AND_REFINE_MAX_ITERATIONS"  json:"max_iterations"`
+}
+
 type ExecConfig struct {
 	ToolConfig          `         envPrefix:"PICOCLAW_TOOLS_EXEC_"`
 	EnableDenyPatterns  bool     `                                 env:"PICOCLAW_TOOLS_EXEC_ENABLE_DENY_PATTERNS"  json:"enable_deny_patterns"`
@@ -1178,6 +1371,26 @@ type ExecConfig struct {
 	CustomDenyPatterns  []string `                                 env:"PICOCLAW_TOOLS_EXEC_CUSTOM_DENY_PATTERNS"  json:"custom_deny_patterns"`
 	CustomAllowPatterns []string `                                 env:"PICOCLAW_TOOLS_EXEC_CUSTOM_ALLOW_PATTERNS" json:"custom_allow_patterns"`
 	TimeoutSeconds      int      `                                 env:"PICOCLAW_TOOLS_EXEC_TIMEOUT_SECONDS"       json:"timeout_seconds"` // 0 means use default (60s)
+	// Sandbox selects how commands are isolated: "none" (default) relies on
+	// the deny patterns, "namespaces" runs each command in Linux namespaces.
+	Sandbox        string            `env:"PICOCLAW_TOOLS_EXEC_SANDBOX" json:"sandbox,omitempty"`
+	SandboxOptions ExecSandboxConfig `                                  json:"sandbox_options"`
+	// Background jobs started with exec's background argument run without
+	// TimeoutSeconds and are managed with the job_* tools.
+	AllowBackground          bool `env:"PICOCLAW_TOOLS_EXEC_ALLOW_BACKGROUND"           json:"allow_background"`
+	MaxBackgroundJobs        int  `env:"PICOCLAW_TOOLS_EXEC_MAX_BACKGROUND_JOBS"        json:"max_background_jobs"`        // running at once; 0 means use default (4)
+	BackgroundTimeoutSeconds int  `env:"PICOCLAW_TOOLS_EXEC_BACKGROUND_TIMEOUT_SECONDS" json:"background_timeout_seconds"` // 0 means no limit
+}
+
+// ExecSandboxConfig tunes the "namespaces" exec sandbox. Zero limits mean no
+// limit.
+type ExecSandboxConfig struct {
+	NoNetwork     bool     `json:"no_network"      env:"PICOCLAW_TOOLS_EXEC_SANDBOX_NO_NETWORK"`
+	CPUSeconds    int      `json:"cpu_seconds"     env:"PICOCLAW_TOOLS_EXEC_SANDBOX_CPU_SECONDS"`
+	MemoryMB      int      `json:"memory_mb"       env:"PICOCLAW_TOOLS_EXEC_SANDBOX_MEMORY_MB"`
+	MaxProcesses  int      `json:"max_processes"   env:"PICOCLAW_TOOLS_EXEC_SANDBOX_MAX_PROCESSES"`
+	ReadOnlyPaths []string `json:"read_only_paths" env:"PICOCLAW_TOOLS_EXEC_SANDBOX_READ_ONLY_PATHS"`
+	WritablePaths []string `json:"writable_paths"  env:"PICOCLAW_TOOLS_EXEC_SANDBOX_WRITABLE_PATHS"`
 }
 
 type SkillsToolsConfig struct {
@@ -1209,18 +1422,26 @@ type ToolsConfig struct {
 	MediaCleanup    MediaCleanupConfig `json:"media_cleanup"`
 	MCP             MCPConfig          `json:"mcp"`
 	AppendFile      ToolConfig         `json:"append_file"                                              envPrefix:"PICOCLAW_TOOLS_APPEND_FILE_"`
+	ApplyPatch      ToolConfig         `json:"apply_patch"                                              envPrefix:"PICOCLAW_TOOLS_APPLY_PATCH_"`
 	EditFile        ToolConfig         `json:"edit_file"                                                envPrefix:"PICOCLAW_TOOLS_EDIT_FILE_"`
 	FindSkills      ToolConfig         `json:"find_skills"                                              envPrefix:"PICOCLAW_TOOLS_FIND_SKILLS_"`
+	Glob            ToolConfig         `json:"glob"                                                     envPrefix:"PICOCLAW_TOOLS_GLOB_"`
+	Grep            ToolConfig         `json:"grep"                                                     envPrefix:"PICOCLAW_TOOLS_GREP_"`
+	Handoff         ToolConfig         `json:"handoff"                                                  envPrefix:"PICOCLAW_TOOLS_HANDOFF_"`
 	I2C             ToolConfig         `json:"i2c"                                                      envPrefix:"PICOCLAW_TOOLS_I2C_"`
 	InstallSkill    ToolConfig         `json:"install_skill"                                            envPrefix:"PICOCLAW_TOOLS_INSTALL_SKILL_"`
 	ListDir         ToolConfig         `json:"list_dir"                                                 envPrefix:"PICOCLAW_TOOLS_LIST_DIR_"`
+	Memory          ToolConfig         `json:"memory"                                                   envPrefix:"PICOCLAW_TOOLS_MEMORY_"`
 	Message         ToolConfig         `json:"message"                                                  envPrefix:"PICOCLAW_TOOLS_MESSAGE_"`
 	ReadFile        ReadFileToolConfig `json:"read_file"                                                envPrefix:"PICOCLAW_TOOLS_READ_FILE_"`
+	Refine          RefineToolConfig   `json:"evaluate_and_refine"`
 	SendFile        ToolConfig         `json:"send_file"                                                envPrefix:"PICOCLAW_TOOLS_SEND_FILE_"`
+	ShellSession    ShellSessionConfig `json:"shell_session"`
 	Spawn           ToolConfig         `json:"spawn"                                                    envPrefix:"PICOCLAW_TOOLS_SPAWN_"`
 	SpawnStatus     ToolConfig         `json:"spawn_status"                                             envPrefix:"PICOCLAW_TOOLS_SPAWN_STATUS_"`
 	SPI             ToolConfig         `json:"spi"                                                      envPrefix:"PICOCLAW_TOOLS_SPI_"`
 	Subagent        ToolConfig         `json:"subagent"                                                 envPrefix:"PICOCLAW_TOOLS_SUBAGENT_"`
+	Team            TeamToolConfig     `json:"team"`
 	WebFetch        ToolConfig         `json:"web_fetch"                                                envPrefix:"PICOCLAW_TOOLS_WEB_FETCH_"`
 	WriteFile       ToolConfig         `json:"write_file"                                               envPrefix:"PICOCLAW_TOOLS_WRITE_FILE_"`
 }
@@ -2079,6 +2300,7 @@ func expandMultiKeyModels(models []*ModelConfig) []*ModelConfig {
 				MaxTokensField: m.MaxTokensField,
 				RequestTimeout: m.RequestTimeout,
 				ThinkingLevel:  m.ThinkingLevel,
+				Pricing:        m.Pricing,
 			}
 			expanded = append(expanded, additionalEntry)
 			fallbackNames = append(fallbackNames, expandedName)
@@ -2097,6 +2319,7 @@ func expandMultiKeyModels(models []*ModelConfig) []*ModelConfig {
 			MaxTokensField: m.MaxTokensField,
 			RequestTimeout: m.RequestTimeout,
 			ThinkingLevel:  m.ThinkingLevel,
+			Pricing:        m.Pricing,
 			apiKeys:        []string{keys[0]},
 		}
 
@@ -2127,20 +2350,32 @@ func (t *ToolsConfig) IsToolEnabled(name string) bool {
 		return t.MediaCleanup.Enabled
 	case "append_file":
 		return t.AppendFile.Enabled
+	case "apply_patch":
+		return t.ApplyPatch.Enabled
 	case "edit_file":
 		return t.EditFile.Enabled
 	case "find_skills":
 		return t.FindSkills.Enabled
+	case "glob":
+		return t.Glob.Enabled
+	case "grep":
+		return t.Grep.Enabled
+	case "handoff":
+		return t.Handoff.Enabled
 	case "i2c":
 		return t.I2C.Enabled
 	case "install_skill":
 		return t.InstallSkill.Enabled
 	case "list_dir":
 		return t.ListDir.Enabled
+	case "memory":
+		return t.Memory.Enabled
 	case "message":
 		return t.Message.Enabled
 	case "read_file":
 		return t.ReadFile.Enabled
+	case "evaluate_and_refine":
+		return t.Refine.Enabled
 	case "spawn":
 		return t.Spawn.Enabled
 	case "spawn_status":
@@ -2149,8 +2384,12 @@ func (t *ToolsConfig) IsToolEnabled(name string) bool {
 		return t.SPI.Enabled
 	case "subagent":
 		return t.Subagent.Enabled
+	case "team":
+		return t.Team.Enabled
 	case "web_fetch":
 		return t.WebFetch.Enabled
+	case "shell_session":
+		return t.ShellSession.Enabled
 	case "send_file":
 		return t.SendFile.Enabled
 	case "write_file":
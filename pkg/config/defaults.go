@@ -37,6 +37,7 @@ func DefaultConfig() *Config {
 				MaxToolIterations:         50,
 				SummarizeMessageThreshold: 20,
 				SummarizeTokenPercent:     75,
+				ContextCompression:        "summarize",
 				SteeringMode:              "one-at-a-time",
 				ToolFeedback: ToolFeedbackConfig{
 					Enabled:       true,
@@ -439,6 +440,14 @@ func DefaultConfig() *Config {
 				EnableDenyPatterns: true,
 				AllowRemote:        true,
 				TimeoutSeconds:     60,
+				Sandbox:            "none",
+				SandboxOptions: ExecSandboxConfig{
+					CPUSeconds: 300,
+					MemoryMB:   1024,
+				},
+				AllowBackground:          true,
+				MaxBackgroundJobs:        4,
+				BackgroundTimeoutSeconds: 7200,
 			},
 			Skills: SkillsToolsConfig{
 				ToolConfig: ToolConfig{
@@ -475,12 +484,24 @@ func DefaultConfig() *Config {
 			AppendFile: ToolConfig{
 				Enabled: true,
 			},
+			ApplyPatch: ToolConfig{
+				Enabled: false,
+			},
 			EditFile: ToolConfig{
 				Enabled: true,
 			},
 			FindSkills: ToolConfig{
 				Enabled: true,
 			},
+			Glob: ToolConfig{
+				Enabled: true,
+			},
+			Grep: ToolConfig{
+				Enabled: true,
+			},
+			Handoff: ToolConfig{
+				Enabled: true,
+			},
 			I2C: ToolConfig{
 				Enabled: false, // Hardware tool - Linux only
 			},
@@ -490,6 +511,9 @@ func DefaultConfig() *Config {
 			ListDir: ToolConfig{
 				Enabled: true,
 			},
+			Memory: ToolConfig{
+				Enabled: true,
+			},
 			Message: ToolConfig{
 				Enabled: true,
 			},
@@ -497,6 +521,13 @@ func DefaultConfig() *Config {
 				Enabled:         true,
 				MaxReadFileSize: 64 * 1024, // 64KB
 			},
+			Refine: RefineToolConfig{
+				ToolConfig: ToolConfig{
+					Enabled: true,
+				},
+				PassScore:     8,
+				MaxIterations: 3,
+			},
 			Spawn: ToolConfig{
 				Enabled: true,
 			},
@@ -509,6 +540,20 @@ func DefaultConfig() *Config {
 			Subagent: ToolConfig{
 				Enabled: true,
 			},
+			ShellSession: ShellSessionConfig{
+				ToolConfig: ToolConfig{
+					Enabled: false,
+				},
+				IdleTimeoutSeconds: 600,
+				MaxSessions:        4,
+			},
+			Team: TeamToolConfig{
+				ToolConfig: ToolConfig{
+					Enabled: true,
+				},
+				MaxMembers: 5,
+				MaxRounds:  3,
+			},
 			WebFetch: ToolConfig{
 				Enabled: true,
 			},
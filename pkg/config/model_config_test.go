@@ -7,6 +7,7 @@ package config
 
 import (
 	"encoding/json"
+	"math"
 	"strings"
 	"sync"
 	"testing"
@@ -356,3 +357,21 @@ func TestModelConfig_RequestTimeoutDefaultZeroValue(t *testing.T) {
 		t.Fatalf("RequestTimeout = %d, want 0", cfg.RequestTimeout)
 	}
 }
+
+func TestModelPricing_Cost(t *testing.T) {
+	p := &ModelPricing{Input: 3, Output: 15, CachedInput: 0.3, CacheWrite: 3.75}
+	// 1M prompt tokens: 200k cache reads, 300k cache writes, 500k plain input.
+	want := (500_000*3 + 200_000*0.3 + 300_000*3.75 + 100_000*15) / 1e6
+	if got := p.Cost(1_000_000, 100_000, 200_000, 300_000); math.Abs(got-want) > 1e-9 {
+		t.Errorf("Cost() = %v, want %v", got, want)
+	}
+
+	// Without cache prices, cached and written tokens cost the input price.
+	plain := &ModelPricing{Input: 3, Output: 15}
+	if got, want := plain.Cost(1_000_000, 0, 200_000, 300_000), 3.0; math.Abs(got-want) > 1e-9 {
+		t.Errorf("Cost() without cache prices = %v, want %v", got, want)
+	}
+	if got := (*ModelPricing)(nil).Cost(1000, 1000, 0, 0); got != 0 {
+		t.Errorf("nil pricing Cost() = %v, want 0", got)
+	}
+}
@@ -54,6 +54,12 @@ func MigrateFromJSON(
 		if strings.HasSuffix(name, ".meta.json") {
 			continue
 		}
+		// Skip turn checkpoints, plans and compression state the agent keeps
+		// next to sessions. They are live state, not legacy session snapshots.
+		if strings.HasSuffix(name, ".checkpoint.json") || strings.HasSuffix(name, ".plan.json") ||
+			strings.HasSuffix(name, ".compression.json") {
+			continue
+		}
 		// Skip already-migrated files.
 		if strings.HasSuffix(name, ".migrated") {
 			continue
@@ -434,3 +434,27 @@ func TestMigrateFromJSON_SkipsMetaJSONFiles(t *testing.T) {
 		t.Fatalf("meta file should not be renamed, stat err = %v", statErr)
 	}
 }
+
+func TestMigrateFromJSON_SkipsCheckpointFiles(t *testing.T) {
+	sessionsDir := t.TempDir()
+	store, err := NewJSONLStore(sessionsDir)
+	if err != nil {
+		t.Fatalf("NewJSONLStore: %v", err)
+	}
+
+	cpPath := filepath.Join(sessionsDir, "agent_main_main.checkpoint.json")
+	if writeErr := os.WriteFile(cpPath, []byte(`{"turn_id":"t1","session_key":"agent:main:main"}`), 0o644); writeErr != nil {
+		t.Fatalf("write checkpoint: %v", writeErr)
+	}
+
+	count, err := MigrateFromJSON(context.Background(), sessionsDir, store)
+	if err != nil {
+		t.Fatalf("MigrateFromJSON: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("expected 0 migrated, got %d", count)
+	}
+	if _, statErr := os.Stat(cpPath); statErr != nil {
+		t.Fatalf("checkpoint should remain in place: %v", statErr)
+	}
+}
@@ -378,11 +378,21 @@ func parseResponse(resp *anthropic.Message) *LLMResponse {
 		Reasoning:    reasoning.String(),
 		ToolCalls:    toolCalls,
 		FinishReason: finishReason,
-		Usage: &UsageInfo{
-			PromptTokens:     int(resp.Usage.InputTokens),
-			CompletionTokens: int(resp.Usage.OutputTokens),
-			TotalTokens:      int(resp.Usage.InputTokens + resp.Usage.OutputTokens),
-		},
+		Usage:        anthropicUsage(resp.Usage),
+	}
+}
+
+// anthropicUsage converts the API usage. Anthropic reports cache reads and
+// writes separately from input_tokens; they are folded into PromptTokens so
+// it counts the whole prompt, as with other providers.
+func anthropicUsage(u anthropic.Usage) *UsageInfo {
+	prompt := int(u.InputTokens + u.CacheReadInputTokens + u.CacheCreationInputTokens)
+	return &UsageInfo{
+		PromptTokens:     prompt,
+		CompletionTokens: int(u.OutputTokens),
+		TotalTokens:      prompt + int(u.OutputTokens),
+		CachedTokens:     int(u.CacheReadInputTokens),
+		CacheWriteTokens: int(u.CacheCreationInputTokens),
 	}
 }
 
@@ -223,6 +223,18 @@ func TestParseResponse_WithUsage(t *testing.T) {
 	}
 }
 
+func TestParseResponse_WithCachedTokens(t *testing.T) {
+	body := `{"choices":[{"message":{"content":"ok"},"finish_reason":"stop"}],` +
+		`"usage":{"prompt_tokens":100,"completion_tokens":5,"total_tokens":105,"prompt_tokens_details":{"cached_tokens":80}}}`
+	out, err := ParseResponse(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("ParseResponse() error = %v", err)
+	}
+	if out.Usage == nil || out.Usage.PromptTokens != 100 || out.Usage.CachedTokens != 80 {
+		t.Fatalf("Usage = %+v, want 100 prompt tokens with 80 cached", out.Usage)
+	}
+}
+
 func TestParseResponse_WithReasoningContent(t *testing.T) {
 	body := `{"choices":[{"message":{"content":"2","reasoning_content":"Let me think... 1+1=2"},"finish_reason":"stop"}]}`
 	out, err := ParseResponse(strings.NewReader(body))
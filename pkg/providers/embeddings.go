@@ -0,0 +1,115 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/providers/common"
+)
+
+const defaultEmbeddingTimeout = 30 * time.Second
+
+// EmbeddingClient calls the /embeddings endpoint of an OpenAI-compatible API.
+type EmbeddingClient struct {
+	apiKey     string
+	apiBase    string
+	model      string
+	httpClient *http.Client
+}
+
+// NewEmbeddingClientFromConfig creates an EmbeddingClient for a model_list
+// entry. Only OpenAI-compatible protocols are supported.
+func NewEmbeddingClientFromConfig(cfg *config.ModelConfig) (*EmbeddingClient, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("config is nil")
+	}
+	protocol, modelID := ExtractProtocol(cfg.Model)
+	switch protocol {
+	case "anthropic", "anthropic-messages", "antigravity", "claude-cli", "codex-cli", "github-copilot":
+		return nil, fmt.Errorf("protocol %q does not serve embeddings", protocol)
+	}
+	apiBase := cfg.APIBase
+	if apiBase == "" {
+		apiBase = getDefaultAPIBase(protocol)
+	}
+	if apiBase == "" {
+		return nil, fmt.Errorf("api_base is required for embeddings with protocol %q", protocol)
+	}
+
+	client := common.NewHTTPClient(cfg.Proxy)
+	client.Timeout = defaultEmbeddingTimeout
+	if cfg.RequestTimeout > 0 {
+		client.Timeout = time.Duration(cfg.RequestTimeout) * time.Second
+	}
+	return &EmbeddingClient{
+		apiKey:     cfg.APIKey(),
+		apiBase:    strings.TrimRight(apiBase, "/"),
+		model:      modelID,
+		httpClient: client,
+	}, nil
+}
+
+// Model returns the embeddings model ID sent to the API.
+func (c *EmbeddingClient) Model() string {
+	return c.model
+}
+
+// Embed returns one vector per input text, in order.
+func (c *EmbeddingClient) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	body, err := json.Marshal(map[string]any{"model": c.model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: encode request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.apiBase+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings: %w", common.HandleErrorResponse(resp, c.apiBase))
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, fmt.Errorf("embeddings: read response: %w", err)
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil, fmt.Errorf("embeddings: decode response: %w", err)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embeddings: got %d vectors for %d inputs", len(parsed.Data), len(texts))
+	}
+	vectors := make([][]float32, len(texts))
+	for _, d := range parsed.Data {
+		if d.Index < 0 || d.Index >= len(texts) || vectors[d.Index] != nil {
+			return nil, fmt.Errorf("embeddings: unexpected index %d in response", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, nil
+}
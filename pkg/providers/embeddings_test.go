@@ -0,0 +1,80 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestEmbeddingClient_Embed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("path = %q", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer sk-test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.Model != "text-embedding-3-small" || len(req.Input) != 2 {
+			t.Errorf("request = %+v", req)
+		}
+		// Out of order on purpose: vectors are matched by index.
+		w.Write([]byte(`{"data": [
+			{"index": 1, "embedding": [0, 1]},
+			{"index": 0, "embedding": [1, 0]}
+		]}`))
+	}))
+	defer server.Close()
+
+	mc := &config.ModelConfig{
+		ModelName: "embed",
+		Model:     "openai/text-embedding-3-small",
+		APIBase:   server.URL + "/v1/",
+	}
+	mc.SetAPIKey("sk-test")
+	client, err := NewEmbeddingClientFromConfig(mc)
+	if err != nil {
+		t.Fatalf("NewEmbeddingClientFromConfig() error = %v", err)
+	}
+
+	vectors, err := client.Embed(context.Background(), []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Embed() error = %v", err)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Fatalf("vectors = %v", vectors)
+	}
+}
+
+func TestEmbeddingClient_ErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error": "bad key"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	client, err := NewEmbeddingClientFromConfig(&config.ModelConfig{Model: "openai/e", APIBase: server.URL})
+	if err != nil {
+		t.Fatalf("NewEmbeddingClientFromConfig() error = %v", err)
+	}
+	if _, err := client.Embed(context.Background(), []string{"a"}); err == nil ||
+		!strings.Contains(err.Error(), "401") {
+		t.Fatalf("Embed() error = %v, want the 401 status", err)
+	}
+}
+
+func TestNewEmbeddingClientFromConfig_RejectsNonOpenAIProtocols(t *testing.T) {
+	if _, err := NewEmbeddingClientFromConfig(&config.ModelConfig{Model: "anthropic/claude"}); err == nil {
+		t.Fatal("expected an error for the anthropic protocol")
+	}
+}
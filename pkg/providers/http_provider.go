@@ -72,3 +72,7 @@ func (p *HTTPProvider) GetDefaultModel() string {
 func (p *HTTPProvider) SupportsNativeSearch() bool {
 	return p.delegate.SupportsNativeSearch()
 }
+
+func (p *HTTPProvider) SupportsStructuredOutput() bool {
+	return p.delegate.SupportsStructuredOutput()
+}
@@ -140,6 +140,15 @@ func (p *Provider) buildRequestBody(
 		}
 	}
 
+	// Structured output: a JSON Schema response_format is only sent to
+	// endpoints known to accept it. The agent loop validates the answer
+	// for everyone else.
+	if format, ok := options["response_format"].(map[string]any); ok && len(format) > 0 {
+		if supportsResponseFormat(p.apiBase) {
+			requestBody["response_format"] = format
+		}
+	}
+
 	return requestBody
 }
 
@@ -411,6 +420,12 @@ func (p *Provider) SupportsNativeSearch() bool {
 	return isNativeSearchHost(p.apiBase)
 }
 
+// SupportsStructuredOutput reports whether the response_format option is
+// forwarded to this endpoint.
+func (p *Provider) SupportsStructuredOutput() bool {
+	return supportsResponseFormat(p.apiBase)
+}
+
 func isNativeSearchHost(apiBase string) bool {
 	u, err := url.Parse(apiBase)
 	if err != nil {
@@ -432,3 +447,10 @@ func supportsPromptCacheKey(apiBase string) bool {
 	host := u.Hostname()
 	return host == "api.openai.com" || strings.HasSuffix(host, ".openai.azure.com")
 }
+
+// supportsResponseFormat reports whether the given API base accepts a
+// json_schema response_format. Like prompt_cache_key, this is limited to
+// OpenAI's own API and Azure OpenAI.
+func supportsResponseFormat(apiBase string) bool {
+	return supportsPromptCacheKey(apiBase)
+}
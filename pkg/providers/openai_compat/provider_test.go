@@ -1089,3 +1089,29 @@ func TestSerializeMessages_StripsSystemParts(t *testing.T) {
 		t.Fatal("system_parts should not appear in serialized output")
 	}
 }
+
+func TestBuildRequestBody_ResponseFormat(t *testing.T) {
+	format := map[string]any{
+		"type":        "json_schema",
+		"json_schema": map[string]any{"name": "reply", "schema": map[string]any{"type": "object"}},
+	}
+	options := map[string]any{"response_format": format}
+
+	p := NewProvider("key", "https://api.openai.com/v1", "")
+	if !p.SupportsStructuredOutput() {
+		t.Fatal("SupportsStructuredOutput() = false for OpenAI")
+	}
+	body := p.buildRequestBody([]Message{{Role: "user", Content: "hi"}}, nil, "gpt-4o", options)
+	if got, ok := body["response_format"].(map[string]any); !ok || got["type"] != "json_schema" {
+		t.Fatalf("response_format = %v, want the json_schema format", body["response_format"])
+	}
+
+	p = NewProvider("key", "https://api.deepseek.com/v1", "")
+	if p.SupportsStructuredOutput() {
+		t.Fatal("SupportsStructuredOutput() = true for DeepSeek")
+	}
+	body = p.buildRequestBody([]Message{{Role: "user", Content: "hi"}}, nil, "deepseek-chat", options)
+	if _, exists := body["response_format"]; exists {
+		t.Fatal("response_format should not be sent to DeepSeek")
+	}
+}
@@ -1,5 +1,7 @@
 package protocoltypes
 
+import "encoding/json"
+
 type ToolCall struct {
 	ID               string         `json:"id"`
 	Type             string         `json:"type,omitempty"`
@@ -45,6 +47,32 @@ type UsageInfo struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+	// CachedTokens is the part of PromptTokens read from the provider's
+	// prompt cache. Zero when the provider does not report it.
+	CachedTokens int `json:"cached_tokens,omitempty"`
+	// CacheWriteTokens is the part of PromptTokens written to the prompt
+	// cache, which some providers bill above the input price.
+	CacheWriteTokens int `json:"cache_write_tokens,omitempty"`
+}
+
+// UnmarshalJSON also accepts the OpenAI layout, which reports cached prompt
+// tokens as prompt_tokens_details.cached_tokens.
+func (u *UsageInfo) UnmarshalJSON(data []byte) error {
+	type plain UsageInfo
+	var raw struct {
+		plain
+		PromptTokensDetails *struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"prompt_tokens_details"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*u = UsageInfo(raw.plain)
+	if u.CachedTokens == 0 && raw.PromptTokensDetails != nil {
+		u.CachedTokens = raw.PromptTokensDetails.CachedTokens
+	}
+	return nil
 }
 
 // CacheControl marks a content block for LLM-side prefix caching.
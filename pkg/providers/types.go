@@ -67,6 +67,14 @@ type NativeSearchCapable interface {
 	SupportsNativeSearch() bool
 }
 
+// StructuredOutputCapable is an optional interface for providers that can
+// constrain the response to a JSON Schema passed as the "response_format"
+// option. The agent loop validates structured answers either way; for other
+// providers it describes the schema in the prompt instead.
+type StructuredOutputCapable interface {
+	SupportsStructuredOutput() bool
+}
+
 // FailoverReason classifies why an LLM request failed for fallback decisions.
 type FailoverReason string
 
@@ -24,6 +24,9 @@ type ResolvedRoute struct {
 	SessionKey     string
 	MainSessionKey string
 	MatchedBy      string // "binding.peer", "binding.peer.parent", "binding.guild", "binding.team", "binding.account", "binding.channel", "default"
+
+	// Tools is the tool policy of the matched binding, if any.
+	Tools *config.ToolPolicy
 }
 
 // RouteResolver determines which agent handles a message based on config bindings.
@@ -72,11 +75,16 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 			MatchedBy:      matchedBy,
 		}
 	}
+	chooseBinding := func(match *config.AgentBinding, matchedBy string) ResolvedRoute {
+		route := choose(match.AgentID, matchedBy)
+		route.Tools = match.Tools
+		return route
+	}
 
 	// Priority 1: Peer binding
 	if peer != nil && strings.TrimSpace(peer.ID) != "" {
 		if match := r.findPeerMatch(bindings, peer); match != nil {
-			return choose(match.AgentID, "binding.peer")
+			return chooseBinding(match, "binding.peer")
 		}
 	}
 
@@ -84,7 +92,7 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 	parentPeer := input.ParentPeer
 	if parentPeer != nil && strings.TrimSpace(parentPeer.ID) != "" {
 		if match := r.findPeerMatch(bindings, parentPeer); match != nil {
-			return choose(match.AgentID, "binding.peer.parent")
+			return chooseBinding(match, "binding.peer.parent")
 		}
 	}
 
@@ -92,7 +100,7 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 	guildID := strings.TrimSpace(input.GuildID)
 	if guildID != "" {
 		if match := r.findGuildMatch(bindings, guildID); match != nil {
-			return choose(match.AgentID, "binding.guild")
+			return chooseBinding(match, "binding.guild")
 		}
 	}
 
@@ -100,18 +108,18 @@ func (r *RouteResolver) ResolveRoute(input RouteInput) ResolvedRoute {
 	teamID := strings.TrimSpace(input.TeamID)
 	if teamID != "" {
 		if match := r.findTeamMatch(bindings, teamID); match != nil {
-			return choose(match.AgentID, "binding.team")
+			return chooseBinding(match, "binding.team")
 		}
 	}
 
 	// Priority 5: Account binding
 	if match := r.findAccountMatch(bindings); match != nil {
-		return choose(match.AgentID, "binding.account")
+		return chooseBinding(match, "binding.account")
 	}
 
 	// Priority 6: Channel wildcard binding
 	if match := r.findChannelWildcardMatch(bindings); match != nil {
-		return choose(match.AgentID, "binding.channel")
+		return chooseBinding(match, "binding.channel")
 	}
 
 	// Priority 7: Default agent
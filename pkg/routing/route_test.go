@@ -295,3 +295,39 @@ func TestResolveRoute_NoDefaultUsesFirst(t *testing.T) {
 		t.Errorf("AgentID = %q, want 'alpha' (first in list)", route.AgentID)
 	}
 }
+
+func TestResolveRoute_BindingToolPolicy(t *testing.T) {
+	agents := []config.AgentConfig{
+		{ID: "main", Default: true},
+		{ID: "public"},
+	}
+	policy := &config.ToolPolicy{Deny: []string{"exec", "write_file"}}
+	bindings := []config.AgentBinding{
+		{
+			AgentID: "public",
+			Match: config.BindingMatch{
+				Channel:   "discord",
+				AccountID: "*",
+			},
+			Tools: policy,
+		},
+	}
+	cfg := testConfig(agents, bindings)
+	r := NewRouteResolver(cfg)
+
+	route := r.ResolveRoute(RouteInput{
+		Channel: "discord",
+		Peer:    &RoutePeer{Kind: "channel", ID: "general"},
+	})
+	if route.AgentID != "public" || route.Tools != policy {
+		t.Errorf("route = %+v, want agent 'public' with the binding's tool policy", route)
+	}
+
+	route = r.ResolveRoute(RouteInput{
+		Channel: "telegram",
+		Peer:    &RoutePeer{Kind: "direct", ID: "user1"},
+	})
+	if route.MatchedBy != "default" || route.Tools != nil {
+		t.Errorf("default route = %+v, want no tool policy", route)
+	}
+}
@@ -1,7 +1,11 @@
 package routing
 
 import (
+	"cmp"
+	"slices"
+
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 )
 
 // defaultThreshold is used when the config threshold is zero or negative.
@@ -14,12 +18,49 @@ const defaultThreshold = 0.35
 // dependency graph simple: pkg/agent resolves config → routing, not the reverse.
 type RouterConfig struct {
 	// LightModel is the model_name (from model_list) used for simple tasks.
+	// Empty means every message stays on the primary model.
 	LightModel string
 
 	// Threshold is the complexity score cutoff in [0, 1].
 	// score >= Threshold → primary (heavy) model.
 	// score <  Threshold → light model.
 	Threshold float64
+
+	// Tokenizer, when set to a model-specific tokenizer, replaces the
+	// rune-based TokenEstimate with the primary model's token count.
+	Tokenizer tokenizer.Tokenizer
+
+	// Tiers derive the thinking level and max_tokens of a turn from the same
+	// score. Empty leaves both to the model and agent configuration.
+	Tiers []Tier
+}
+
+// Tier sets the reasoning effort and output budget for messages scoring at
+// least MinScore. The tier with the highest MinScore not above the score
+// applies.
+type Tier struct {
+	MinScore      float64
+	ThinkingLevel string // off|low|medium|high|xhigh|adaptive; empty keeps the model's level
+	MaxTokens     int    // 0 keeps the agent's max_tokens
+}
+
+// DefaultTiers scale thinking with the RuleClassifier score: trivial
+// messages get none, medium prose low, code medium, and code in a dense
+// tool workflow high.
+var DefaultTiers = []Tier{
+	{MinScore: 0, ThinkingLevel: "off"},
+	{MinScore: 0.15, ThinkingLevel: "low"},
+	{MinScore: 0.35, ThinkingLevel: "medium"},
+	{MinScore: 0.6, ThinkingLevel: "high"},
+}
+
+// Decision is the router's choice for one conversation turn.
+type Decision struct {
+	Model         string
+	UsedLight     bool
+	Score         float64
+	ThinkingLevel string // empty when no tier applies
+	MaxTokens     int    // 0 when no tier sets it
 }
 
 // Router selects the appropriate model tier for each incoming message.
@@ -32,13 +73,7 @@ type Router struct {
 // New creates a Router with the given config and the default RuleClassifier.
 // If cfg.Threshold is zero or negative, defaultThreshold (0.35) is used.
 func New(cfg RouterConfig) *Router {
-	if cfg.Threshold <= 0 {
-		cfg.Threshold = defaultThreshold
-	}
-	return &Router{
-		cfg:        cfg,
-		classifier: &RuleClassifier{},
-	}
+	return newWithClassifier(cfg, &RuleClassifier{})
 }
 
 // newWithClassifier creates a Router with a custom Classifier.
@@ -47,6 +82,10 @@ func newWithClassifier(cfg RouterConfig, c Classifier) *Router {
 	if cfg.Threshold <= 0 {
 		cfg.Threshold = defaultThreshold
 	}
+	cfg.Tiers = slices.Clone(cfg.Tiers)
+	slices.SortStableFunc(cfg.Tiers, func(a, b Tier) int {
+		return cmp.Compare(a.MinScore, b.MinScore)
+	})
 	return &Router{cfg: cfg, classifier: c}
 }
 
@@ -63,12 +102,29 @@ func (r *Router) SelectModel(
 	history []providers.Message,
 	primaryModel string,
 ) (model string, usedLight bool, score float64) {
+	d := r.Decide(msg, history, primaryModel)
+	return d.Model, d.UsedLight, d.Score
+}
+
+// Decide scores the message once and derives the whole decision from the
+// score: the model as in SelectModel, plus the thinking level and max_tokens
+// of the matching tier.
+func (r *Router) Decide(msg string, history []providers.Message, primaryModel string) Decision {
 	features := ExtractFeatures(msg, history)
-	score = r.classifier.Score(features)
-	if score < r.cfg.Threshold {
-		return r.cfg.LightModel, true, score
+	if !tokenizer.IsHeuristic(r.cfg.Tokenizer) {
+		features.TokenEstimate = r.cfg.Tokenizer.Count(msg)
+	}
+	d := Decision{Model: primaryModel, Score: r.classifier.Score(features)}
+	if r.cfg.LightModel != "" && d.Score < r.cfg.Threshold {
+		d.Model, d.UsedLight = r.cfg.LightModel, true
+	}
+	for _, tier := range r.cfg.Tiers {
+		if tier.MinScore > d.Score {
+			break
+		}
+		d.ThinkingLevel, d.MaxTokens = tier.ThinkingLevel, tier.MaxTokens
 	}
-	return primaryModel, false, score
+	return d
 }
 
 // LightModel returns the configured light model name.
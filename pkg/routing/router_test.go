@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/tokenizer"
 )
 
 // ── ExtractFeatures ──────────────────────────────────────────────────────────
@@ -402,6 +403,32 @@ func TestRouter_CustomClassifier_ExactThreshold_SelectsPrimary(t *testing.T) {
 	}
 }
 
+type recordingClassifier struct{ features Features }
+
+func (c *recordingClassifier) Score(f Features) float64 {
+	c.features = f
+	return 0
+}
+
+func TestRouter_SelectModel_UsesModelTokenizer(t *testing.T) {
+	msg := "The quick brown fox jumps over the lazy dog."
+	tok, err := tokenizer.New(tokenizer.EncodingCL100k, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &recordingClassifier{}
+	newWithClassifier(RouterConfig{LightModel: "light", Tokenizer: tok}, c).SelectModel(msg, nil, "heavy")
+	if c.features.TokenEstimate != tok.Count(msg) {
+		t.Errorf("TokenEstimate = %d, want the tokenizer's %d", c.features.TokenEstimate, tok.Count(msg))
+	}
+
+	newWithClassifier(RouterConfig{LightModel: "light", Tokenizer: tokenizer.Heuristic}, c).SelectModel(msg, nil, "heavy")
+	if c.features.TokenEstimate != estimateTokens(msg) {
+		t.Errorf("heuristic TokenEstimate = %d, want %d", c.features.TokenEstimate, estimateTokens(msg))
+	}
+}
+
 func TestRouter_SelectModel_ReturnsScore(t *testing.T) {
 	r := newWithClassifier(
 		RouterConfig{LightModel: "light", Threshold: 0.5},
@@ -412,3 +439,53 @@ func TestRouter_SelectModel_ReturnsScore(t *testing.T) {
 		t.Errorf("score: got %f, want 0.42", score)
 	}
 }
+
+// ── Decide ────────────────────────────────────────────────────────────────────
+
+func TestRouter_Decide_DefaultTiersScaleThinking(t *testing.T) {
+	r := New(RouterConfig{LightModel: "light", Tiers: DefaultTiers})
+	toolHistory := []providers.Message{
+		{Role: "assistant", ToolCalls: []providers.ToolCall{
+			{Name: "read_file"}, {Name: "edit_file"}, {Name: "exec"}, {Name: "exec"},
+		}},
+	}
+	tests := []struct {
+		name      string
+		msg       string
+		history   []providers.Message
+		wantModel string
+		wantLevel string
+	}{
+		{"trivial", "thanks!", nil, "light", "off"},
+		{"medium prose", strings.Repeat("word ", 55), nil, "light", "low"},
+		{"code", "```go\nfmt.Println()\n```", nil, "heavy", "medium"},
+		{"code in a tool workflow", "fix this:\n```go\nfmt.Println()\n```", toolHistory, "heavy", "high"},
+	}
+	for _, tt := range tests {
+		d := r.Decide(tt.msg, tt.history, "heavy")
+		if d.Model != tt.wantModel || d.ThinkingLevel != tt.wantLevel {
+			t.Errorf("%s: Decide() = %+v, want model %s thinking %s", tt.name, d, tt.wantModel, tt.wantLevel)
+		}
+	}
+}
+
+func TestRouter_Decide_TiersWithoutLightModel(t *testing.T) {
+	// Tiers are matched whatever their order in the config.
+	r := newWithClassifier(RouterConfig{Tiers: []Tier{
+		{MinScore: 0.5, ThinkingLevel: "high", MaxTokens: 16000},
+		{MinScore: 0, ThinkingLevel: "off", MaxTokens: 1024},
+	}}, &fixedScoreClassifier{score: 0.2})
+
+	d := r.Decide("anything", nil, "heavy")
+	if d.Model != "heavy" || d.UsedLight {
+		t.Fatalf("without a light model the primary must stay: %+v", d)
+	}
+	if d.ThinkingLevel != "off" || d.MaxTokens != 1024 {
+		t.Fatalf("Decide() = %+v, want the score-0 tier", d)
+	}
+
+	r = newWithClassifier(RouterConfig{LightModel: "light"}, &fixedScoreClassifier{score: 0.9})
+	if d := r.Decide("anything", nil, "heavy"); d.ThinkingLevel != "" || d.MaxTokens != 0 {
+		t.Fatalf("no tiers: Decide() = %+v, want no thinking or max_tokens", d)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/gomarkdown/markdown"
@@ -192,7 +193,18 @@ func (sl *SkillsLoader) LoadSkillsForContext(skillNames []string) string {
 }
 
 func (sl *SkillsLoader) BuildSkillsSummary() string {
+	return sl.BuildSkillsSummaryFor(nil)
+}
+
+// BuildSkillsSummaryFor is like BuildSkillsSummary but lists only the named
+// skills. An empty list means all skills.
+func (sl *SkillsLoader) BuildSkillsSummaryFor(names []string) string {
 	allSkills := sl.ListSkills()
+	if len(names) > 0 {
+		allSkills = slices.DeleteFunc(allSkills, func(s SkillInfo) bool {
+			return !slices.Contains(names, s.Name)
+		})
+	}
 	if len(allSkills) == 0 {
 		return ""
 	}
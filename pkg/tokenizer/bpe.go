@@ -0,0 +1,133 @@
+package tokenizer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// BPE encodes text exactly with a byte-pair rank table, as tiktoken does.
+type BPE struct {
+	profile *profile
+	ranks   map[string]int
+}
+
+func newBPE(p *profile, ranks map[string]int) *BPE {
+	return &BPE{profile: p, ranks: ranks}
+}
+
+// NewBPE returns a BPE tokenizer for encoding with the given ranks, as read
+// by LoadRanks.
+func NewBPE(encoding string, ranks map[string]int) (*BPE, error) {
+	p, ok := profiles[encoding]
+	if !ok || !p.tiktoken {
+		return nil, fmt.Errorf("tokenizer: no tiktoken rank tables for encoding %q", encoding)
+	}
+	return newBPE(p, ranks), nil
+}
+
+func (b *BPE) Name() string {
+	return b.profile.name
+}
+
+func (b *BPE) Count(text string) int {
+	total := 0
+	eachPiece(text, b.profile.caseSplit, func(piece string) {
+		b.encodePiece(piece, func(int) { total++ })
+	})
+	return total
+}
+
+// Encode returns the token ranks of text. Bytes missing from the table are
+// encoded as -1.
+func (b *BPE) Encode(text string) []int {
+	var tokens []int
+	eachPiece(text, b.profile.caseSplit, func(piece string) {
+		b.encodePiece(piece, func(rank int) { tokens = append(tokens, rank) })
+	})
+	return tokens
+}
+
+// encodePiece merges the bytes of piece pairwise, lowest rank first, until
+// no adjacent pair is in the table.
+func (b *BPE) encodePiece(piece string, emit func(rank int)) {
+	if rank, ok := b.ranks[piece]; ok {
+		emit(rank)
+		return
+	}
+	// bounds[i] is where the i-th part starts; the last entry is the end.
+	bounds := make([]int, len(piece)+1)
+	for i := range bounds {
+		bounds[i] = i
+	}
+	for len(bounds) > 2 {
+		best, bestRank := -1, math.MaxInt
+		for i := 0; i+2 < len(bounds); i++ {
+			if rank, ok := b.ranks[piece[bounds[i]:bounds[i+2]]]; ok && rank < bestRank {
+				best, bestRank = i, rank
+			}
+		}
+		if best < 0 {
+			break
+		}
+		bounds = append(bounds[:best+1], bounds[best+2:]...)
+	}
+	for i := 0; i+1 < len(bounds); i++ {
+		rank, ok := b.ranks[piece[bounds[i]:bounds[i+1]]]
+		if !ok {
+			rank = -1
+		}
+		emit(rank)
+	}
+}
+
+// LoadRanks reads a rank table in tiktoken format: one base64-encoded token
+// and its rank per line.
+func LoadRanks(r io.Reader) (map[string]int, error) {
+	ranks := make(map[string]int)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		encoded, rankStr, ok := strings.Cut(text, " ")
+		if !ok {
+			return nil, fmt.Errorf("tokenizer: line %d: want \"<base64 token> <rank>\"", line)
+		}
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer: line %d: %w", line, err)
+		}
+		rank, err := strconv.Atoi(strings.TrimSpace(rankStr))
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer: line %d: %w", line, err)
+		}
+		ranks[string(token)] = rank
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("tokenizer: read ranks: %w", err)
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("tokenizer: rank table is empty")
+	}
+	return ranks, nil
+}
+
+// LoadRanksFile reads a tiktoken rank table from path.
+func LoadRanksFile(path string) (map[string]int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: %w", err)
+	}
+	defer f.Close()
+	return LoadRanks(f)
+}
@@ -0,0 +1,104 @@
+package tokenizer
+
+import (
+	"math"
+	"unicode"
+	"unicode/utf8"
+)
+
+// profile describes how an encoding's BPE tends to merge each kind of
+// pre-token. The numbers approximate the real vocabularies on English prose,
+// code and CJK text.
+type profile struct {
+	name      string
+	caseSplit bool // o200k-style pre-tokenizer
+	tiktoken  bool // rank tables exist in tiktoken format
+
+	wordRunes   int     // ASCII letters one token usually covers
+	wordExtra   float64 // ASCII letters per extra token in longer words
+	letterRunes float64 // runes per token in other alphabetic scripts
+	cjk         float64 // tokens per CJK rune
+	digits      int     // digits per token
+	symbol      float64 // tokens per non-ASCII symbol such as an emoji
+}
+
+var profiles = map[string]*profile{
+	EncodingCL100k: {
+		name: EncodingCL100k, tiktoken: true,
+		wordRunes: 7, wordExtra: 5, letterRunes: 2.5, cjk: 1.1, digits: 3, symbol: 2,
+	},
+	EncodingO200k: {
+		name: EncodingO200k, caseSplit: true, tiktoken: true,
+		wordRunes: 8, wordExtra: 5, letterRunes: 3.5, cjk: 0.8, digits: 3, symbol: 1.5,
+	},
+	EncodingLlama3: {
+		name: EncodingLlama3, tiktoken: true,
+		wordRunes: 8, wordExtra: 5, letterRunes: 3, cjk: 0.9, digits: 3, symbol: 2,
+	},
+	EncodingLlama: {
+		name:      EncodingLlama,
+		wordRunes: 5, wordExtra: 4, letterRunes: 2, cjk: 1.4, digits: 1, symbol: 3,
+	},
+}
+
+// estimator counts tokens without a rank table: it runs the family's
+// pre-tokenizer and estimates how many tokens BPE makes of each piece.
+type estimator struct {
+	profile *profile
+}
+
+func (e *estimator) Name() string {
+	return e.profile.name
+}
+
+func (e *estimator) Count(text string) int {
+	total := 0
+	eachPiece(text, e.profile.caseSplit, func(piece string) {
+		total += e.countPiece(piece)
+	})
+	return total
+}
+
+func (e *estimator) countPiece(piece string) int {
+	p := e.profile
+	var ascii, cjk, other, digits, punct, symbols int
+	for _, r := range piece {
+		switch {
+		case r < utf8.RuneSelf && unicode.IsLetter(r):
+			ascii++
+		case isCJK(r):
+			cjk++
+		case unicode.IsLetter(r) || unicode.Is(unicode.M, r):
+			other++
+		case unicode.IsNumber(r):
+			digits++
+		case unicode.IsSpace(r):
+		case r < utf8.RuneSelf:
+			punct++
+		default:
+			symbols++
+		}
+	}
+
+	tokens := 0.0
+	if ascii > 0 {
+		tokens++
+		if ascii > p.wordRunes {
+			tokens += math.Ceil(float64(ascii-p.wordRunes) / p.wordExtra)
+		}
+	}
+	tokens += float64(cjk) * p.cjk
+	tokens += float64(other) / p.letterRunes
+	tokens += math.Ceil(float64(digits) / float64(p.digits))
+	// Common punctuation pairs ("()", "==", "://") are single tokens.
+	tokens += math.Ceil(float64(punct) / 2)
+	tokens += float64(symbols) * p.symbol
+
+	// Whitespace-only pieces are one token.
+	return max(int(math.Round(tokens)), 1)
+}
+
+// isCJK reports whether r is a Chinese, Japanese or Korean character.
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
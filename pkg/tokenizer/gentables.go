@@ -0,0 +1,86 @@
+//go:build ignore
+
+// gentables converts a tiktoken rank table into the compact form embedded in
+// package tokenizer: every token in rank order as a uvarint length followed
+// by its bytes, gzip-compressed. Ranks must run from 0 without gaps. The
+// inputs are the files tiktoken downloads from
+// https://openaipublic.blob.core.windows.net/encodings/.
+//
+//	go run gentables.go cl100k_base.tiktoken tables/cl100k.bin.gz
+//	go run gentables.go o200k_base.tiktoken tables/o200k.bin.gz
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) != 3 {
+		fmt.Fprintln(os.Stderr, "usage: go run gentables.go <input.tiktoken> <output.bin.gz>")
+		os.Exit(2)
+	}
+	if err := convert(os.Args[1], os.Args[2]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func convert(inPath, outPath string) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zw, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(in)
+	next := 0
+	for scanner.Scan() {
+		encoded, rankStr, ok := strings.Cut(strings.TrimSpace(scanner.Text()), " ")
+		if !ok {
+			continue
+		}
+		rank, err := strconv.Atoi(rankStr)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", next+1, err)
+		}
+		if rank != next {
+			return fmt.Errorf("line %d: rank %d, want %d", next+1, rank, next)
+		}
+		token, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", next+1, err)
+		}
+		if _, err := zw.Write(binary.AppendUvarint(nil, uint64(len(token)))); err != nil {
+			return err
+		}
+		if _, err := zw.Write(token); err != nil {
+			return err
+		}
+		next++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("%s: %d tokens\n", outPath, next)
+	return out.Close()
+}
@@ -0,0 +1,178 @@
+package tokenizer
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// eachPiece splits text the way the tiktoken pre-tokenizer regex of the
+// cl100k family does, and with caseSplit the o200k variant, calling fn for
+// every piece. BPE merges never cross a piece boundary.
+//
+// cl100k:
+//
+//	(?i:'s|'t|'re|'ve|'m|'ll|'d)|[^\r\n\p{L}\p{N}]?\p{L}+|\p{N}{1,3}|
+//	 ?[^\s\p{L}\p{N}]+[\r\n]*|\s*[\r\n]+|\s+(?!\S)|\s+
+//
+// o200k splits letter runs at lower-to-upper case changes, attaches
+// contractions to the preceding word and lets "/" follow punctuation.
+// Go's regexp has no lookahead, hence the hand-written scanner.
+func eachPiece(text string, caseSplit bool, fn func(piece string)) {
+	for i := 0; i < len(text); {
+		n := nextPiece(text[i:], caseSplit)
+		fn(text[i : i+n])
+		i += n
+	}
+}
+
+func nextPiece(t string, caseSplit bool) int {
+	r, size := utf8.DecodeRuneInString(t)
+
+	if !caseSplit && r == '\'' {
+		if n := contraction(t[size:]); n > 0 {
+			return size + n
+		}
+	}
+
+	// [^\r\n\p{L}\p{N}]?\p{L}+
+	if isLetter(r) {
+		return letterRun(t, caseSplit)
+	}
+	if r != '\r' && r != '\n' && !unicode.IsNumber(r) {
+		if next, _ := utf8.DecodeRuneInString(t[size:]); isLetter(next) {
+			return size + letterRun(t[size:], caseSplit)
+		}
+	}
+
+	// \p{N}{1,3}
+	if unicode.IsNumber(r) {
+		n := size
+		for digits := 1; digits < 3 && n < len(t); digits++ {
+			next, s := utf8.DecodeRuneInString(t[n:])
+			if !unicode.IsNumber(next) {
+				break
+			}
+			n += s
+		}
+		return n
+	}
+
+	//  ?[^\s\p{L}\p{N}]+[\r\n]*   (o200k: [\r\n/]*)
+	start := 0
+	if r == ' ' {
+		start = size
+	}
+	if n := punctRun(t[start:]); n > 0 {
+		n += start
+		for n < len(t) && (t[n] == '\r' || t[n] == '\n' || (caseSplit && t[n] == '/')) {
+			n++
+		}
+		return n
+	}
+
+	// Whitespace: \s*[\r\n]+ | \s+(?!\S) | \s+
+	run, lastNewline := 0, -1
+	for run < len(t) {
+		next, s := utf8.DecodeRuneInString(t[run:])
+		if !unicode.IsSpace(next) {
+			break
+		}
+		if next == '\r' || next == '\n' {
+			lastNewline = run + s
+		}
+		run += s
+	}
+	if lastNewline > 0 {
+		return lastNewline
+	}
+	if run == len(t) {
+		return run
+	}
+	// Leave the last space to prefix the next word.
+	_, last := utf8.DecodeLastRuneInString(t[:run])
+	if run > last {
+		return run - last
+	}
+	return run
+}
+
+// contraction returns the length of a contraction suffix after an
+// apostrophe, or 0.
+func contraction(t string) int {
+	lower := strings.ToLower(t[:min(len(t), 2)])
+	switch {
+	case strings.HasPrefix(lower, "re"), strings.HasPrefix(lower, "ve"), strings.HasPrefix(lower, "ll"):
+		return 2
+	case strings.HasPrefix(lower, "s"), strings.HasPrefix(lower, "t"),
+		strings.HasPrefix(lower, "m"), strings.HasPrefix(lower, "d"):
+		return 1
+	}
+	return 0
+}
+
+// letterRun returns the length of the letter run at the start of t. With
+// caseSplit it follows o200k: upper-case letters, then lower-case ones, then
+// an optional contraction.
+func letterRun(t string, caseSplit bool) int {
+	n := 0
+	if !caseSplit {
+		for n < len(t) {
+			r, s := utf8.DecodeRuneInString(t[n:])
+			if !isLetter(r) {
+				break
+			}
+			n += s
+		}
+		return n
+	}
+	for n < len(t) {
+		r, s := utf8.DecodeRuneInString(t[n:])
+		if !isUpperClass(r) {
+			break
+		}
+		n += s
+	}
+	for n < len(t) {
+		r, s := utf8.DecodeRuneInString(t[n:])
+		if !isLowerClass(r) {
+			break
+		}
+		n += s
+	}
+	if n < len(t) && t[n] == '\'' {
+		if c := contraction(t[n+1:]); c > 0 {
+			n += 1 + c
+		}
+	}
+	return n
+}
+
+// punctRun returns the length of the run of runes that are neither space,
+// letter nor number at the start of t.
+func punctRun(t string) int {
+	n := 0
+	for n < len(t) {
+		r, s := utf8.DecodeRuneInString(t[n:])
+		if unicode.IsSpace(r) || isLetter(r) || unicode.IsNumber(r) {
+			break
+		}
+		n += s
+	}
+	return n
+}
+
+// isLetter matches \p{L}.
+func isLetter(r rune) bool {
+	return unicode.IsLetter(r)
+}
+
+// isUpperClass matches o200k's [\p{Lu}\p{Lt}\p{Lm}\p{Lo}\p{M}].
+func isUpperClass(r rune) bool {
+	return unicode.IsUpper(r) || unicode.IsTitle(r) || unicode.In(r, unicode.Lm, unicode.Lo, unicode.M)
+}
+
+// isLowerClass matches o200k's [\p{Ll}\p{Lm}\p{Lo}\p{M}].
+func isLowerClass(r rune) bool {
+	return unicode.IsLower(r) || unicode.In(r, unicode.Lm, unicode.Lo, unicode.M)
+}
@@ -0,0 +1,51 @@
+package tokenizer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// HasEmbeddedTable reports whether the binary ships the rank table of an
+// encoding, so that its counts are exact without a tokenizer_file.
+func HasEmbeddedTable(encoding string) bool {
+	return len(embeddedTables[encoding]) > 0
+}
+
+// decodeTable reads a table written by gentables.go: gzip over every token in
+// rank order, each as a uvarint length followed by its bytes.
+func decodeTable(data []byte) (map[string]int, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("tokenizer: embedded table: %w", err)
+	}
+	defer zr.Close()
+
+	r := bufio.NewReader(zr)
+	ranks := make(map[string]int, 1<<17)
+	var buf []byte
+	for rank := 0; ; rank++ {
+		n, err := binary.ReadUvarint(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("tokenizer: embedded table: token %d: %w", rank, err)
+		}
+		if uint64(cap(buf)) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, fmt.Errorf("tokenizer: embedded table: token %d: %w", rank, err)
+		}
+		ranks[string(buf)] = rank
+	}
+	if len(ranks) == 0 {
+		return nil, fmt.Errorf("tokenizer: embedded table is empty")
+	}
+	return ranks, nil
+}
@@ -0,0 +1,19 @@
+//go:build !notokentables
+
+package tokenizer
+
+import _ "embed"
+
+var (
+	//go:embed tables/cl100k.bin.gz
+	cl100kTable []byte
+	//go:embed tables/o200k.bin.gz
+	o200kTable []byte
+)
+
+// embeddedTables holds the compressed rank tables shipped in the binary,
+// about 1.5 MB together. Build with -tags notokentables to leave them out.
+var embeddedTables = map[string][]byte{
+	EncodingCL100k: cl100kTable,
+	EncodingO200k:  o200kTable,
+}
@@ -0,0 +1,7 @@
+//go:build notokentables
+
+package tokenizer
+
+// embeddedTables is empty in builds without rank tables; every encoding is
+// then estimated unless a tokenizer_file is configured.
+var embeddedTables = map[string][]byte{}
@@ -0,0 +1,183 @@
+// Package tokenizer counts tokens the way a model family's tokenizer splits
+// text, so context budgets hold for English and CJK alike.
+//
+// The rank tables of the OpenAI encodings (cl100k and o200k) are embedded, so
+// their counts are exact out of the box. Builds tagged notokentables leave
+// them out to save about 1.5 MB. Other families, and OpenAI ones in such
+// builds, run the family's pure-Go pre-tokenizer and estimate each pre-token
+// from its typical merge behavior, which is still far closer than a flat
+// runes-per-token ratio. A rank table (tiktoken format) loaded from
+// model_list[].tokenizer_file makes them exact too. Unknown models fall back
+// to that ratio.
+package tokenizer
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Encoding names accepted in model_list[].tokenizer.
+const (
+	EncodingCL100k    = "cl100k"    // GPT-4, GPT-3.5, text-embedding-3
+	EncodingO200k     = "o200k"     // GPT-4o, GPT-4.1, GPT-5, o-series
+	EncodingLlama3    = "llama3"    // Llama 3 and 4, Qwen, DeepSeek (tiktoken-style BPE)
+	EncodingLlama     = "llama"     // Llama 2, Mistral, Mixtral (SentencePiece BPE)
+	EncodingHeuristic = "heuristic" // runes-per-token ratio
+)
+
+// Tokenizer counts the tokens of a text.
+type Tokenizer interface {
+	// Name returns the encoding name.
+	Name() string
+	Count(text string) int
+}
+
+// Heuristic is the fallback for models of unknown family: about 2.5 runes
+// per token.
+var Heuristic Tokenizer = heuristic{}
+
+type heuristic struct{}
+
+func (heuristic) Name() string {
+	return EncodingHeuristic
+}
+
+func (heuristic) Count(text string) int {
+	return utf8.RuneCountInString(text) * 2 / 5
+}
+
+// IsHeuristic reports whether tok only applies the runes-per-token ratio.
+func IsHeuristic(tok Tokenizer) bool {
+	return tok == nil || tok == Heuristic
+}
+
+// modelFamilies maps model ID prefixes to encodings. Longer prefixes are
+// listed before shorter ones sharing their start.
+var modelFamilies = []struct {
+	prefix   string
+	encoding string
+}{
+	{"gpt-4o", EncodingO200k},
+	{"chatgpt-4o", EncodingO200k},
+	{"gpt-4.1", EncodingO200k},
+	{"gpt-4.5", EncodingO200k},
+	{"gpt-5", EncodingO200k},
+	{"gpt-oss", EncodingO200k},
+	{"o1", EncodingO200k},
+	{"o3", EncodingO200k},
+	{"o4", EncodingO200k},
+	{"gpt-4", EncodingCL100k},
+	{"gpt-3.5", EncodingCL100k},
+	{"text-embedding-3", EncodingCL100k},
+	{"text-embedding-ada", EncodingCL100k},
+	{"llama-3", EncodingLlama3},
+	{"llama3", EncodingLlama3},
+	{"llama-4", EncodingLlama3},
+	{"llama4", EncodingLlama3},
+	{"meta-llama-3", EncodingLlama3},
+	{"qwen", EncodingLlama3},
+	{"deepseek", EncodingLlama3},
+	{"llama", EncodingLlama},
+	{"codellama", EncodingLlama},
+	{"meta-llama", EncodingLlama},
+	{"mistral", EncodingLlama},
+	{"mixtral", EncodingLlama},
+}
+
+// EncodingForModel returns the encoding of a model ID such as
+// "openai/gpt-4o" or "ollama/llama3.1:8b", or EncodingHeuristic when the
+// family is unknown.
+func EncodingForModel(model string) string {
+	id := strings.ToLower(strings.TrimSpace(model))
+	if i := strings.LastIndex(id, "/"); i >= 0 {
+		id = id[i+1:]
+	}
+	for _, f := range modelFamilies {
+		if strings.HasPrefix(id, f.prefix) {
+			return f.encoding
+		}
+	}
+	return EncodingHeuristic
+}
+
+// New returns the tokenizer for a model. encoding names one explicitly; when
+// empty or "auto" it is derived from the model ID. tableFile, when set, is a
+// BPE rank table in tiktoken format that makes counts exact; without it the
+// embedded table of the encoding is used, if there is one. On error New
+// still returns a usable tokenizer (the estimate for the encoding, or
+// Heuristic) alongside the error.
+func New(encoding, model, tableFile string) (Tokenizer, error) {
+	name := strings.ToLower(strings.TrimSpace(encoding))
+	if name == "" || name == "auto" {
+		name = EncodingForModel(model)
+	}
+	if name == EncodingHeuristic {
+		return Heuristic, nil
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return Heuristic, fmt.Errorf("tokenizer: unknown encoding %q", encoding)
+	}
+	est := &estimator{profile: p}
+	if tableFile == "" {
+		if !HasEmbeddedTable(name) {
+			return est, nil
+		}
+		bpe, err := loadEmbeddedBPE(p)
+		if err != nil {
+			return est, err
+		}
+		return bpe, nil
+	}
+	bpe, err := loadBPE(tableFile, p)
+	if err != nil {
+		return est, err
+	}
+	return bpe, nil
+}
+
+var (
+	bpeCacheMu sync.Mutex
+	bpeCache   = map[string]*BPE{}
+)
+
+// loadBPE loads a rank table once per file and encoding; agents using the
+// same model share it.
+func loadBPE(path string, p *profile) (*BPE, error) {
+	key := p.name + "\x00" + path
+	bpeCacheMu.Lock()
+	defer bpeCacheMu.Unlock()
+	if bpe, ok := bpeCache[key]; ok {
+		return bpe, nil
+	}
+	if !p.tiktoken {
+		return nil, fmt.Errorf("tokenizer: no tiktoken rank tables for encoding %q", p.name)
+	}
+	ranks, err := LoadRanksFile(path)
+	if err != nil {
+		return nil, err
+	}
+	bpe := newBPE(p, ranks)
+	bpeCache[key] = bpe
+	return bpe, nil
+}
+
+// loadEmbeddedBPE decompresses the embedded table of an encoding on first
+// use and shares it like loadBPE.
+func loadEmbeddedBPE(p *profile) (*BPE, error) {
+	key := p.name + "\x00"
+	bpeCacheMu.Lock()
+	defer bpeCacheMu.Unlock()
+	if bpe, ok := bpeCache[key]; ok {
+		return bpe, nil
+	}
+	ranks, err := decodeTable(embeddedTables[p.name])
+	if err != nil {
+		return nil, err
+	}
+	bpe := newBPE(p, ranks)
+	bpeCache[key] = bpe
+	return bpe, nil
+}
@@ -0,0 +1,196 @@
+package tokenizer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func pieces(text string, caseSplit bool) []string {
+	var out []string
+	eachPiece(text, caseSplit, func(p string) { out = append(out, p) })
+	return out
+}
+
+func TestEachPiece(t *testing.T) {
+	tests := []struct {
+		text      string
+		caseSplit bool
+		want      []string
+	}{
+		{
+			"Hello, world! It's 12345 apples.\n\n  indented",
+			false,
+			[]string{"Hello", ",", " world", "!", " It", "'s", " ", "123", "45", " apples", ".\n\n", " ", " indented"},
+		},
+		{"x := (a+b)\n", false, []string{"x", " :=", " (", "a", "+b", ")\n"}},
+		{"trailing   ", false, []string{"trailing", "   "}},
+		{"line\r\n  next", false, []string{"line", "\r\n", " ", " next"}},
+		{"我们去公园, ok", false, []string{"我们去公园", ",", " ok"}},
+		{"helloWorld HTMLParser don't", true, []string{"hello", "World", " HTMLParser", " don't"}},
+		{"helloWorld don't", false, []string{"helloWorld", " don", "'t"}},
+		{"a.b/c", true, []string{"a", ".b", "/c"}},
+	}
+	for _, tt := range tests {
+		if got := pieces(tt.text, tt.caseSplit); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("pieces(%q, %v) = %q, want %q", tt.text, tt.caseSplit, got, tt.want)
+		}
+	}
+}
+
+func TestEstimator_CountsLikeTheFamily(t *testing.T) {
+	cl100k := &estimator{profile: profiles[EncodingCL100k]}
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"Hello, world!", 4},
+		{"The quick brown fox jumps over the lazy dog.", 10},
+		{"getUserNameFromDatabase()", 6},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := cl100k.Count(tt.text); got != tt.want {
+			t.Errorf("cl100k.Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+
+	// The flat ratio overcounts English and undercounts CJK.
+	english := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 10)
+	chinese := strings.Repeat("我们今天下午一起去公园散步吧。", 10)
+	if cl100k.Count(english) >= Heuristic.Count(english) {
+		t.Errorf("English: estimate %d, heuristic %d", cl100k.Count(english), Heuristic.Count(english))
+	}
+	if cl100k.Count(chinese) <= Heuristic.Count(chinese) {
+		t.Errorf("Chinese: estimate %d, heuristic %d", cl100k.Count(chinese), Heuristic.Count(chinese))
+	}
+
+	// Newer vocabularies are denser for CJK.
+	o200k := &estimator{profile: profiles[EncodingO200k]}
+	if o200k.Count(chinese) >= cl100k.Count(chinese) {
+		t.Errorf("o200k %d >= cl100k %d for Chinese", o200k.Count(chinese), cl100k.Count(chinese))
+	}
+}
+
+func TestNew_SelectsEncoding(t *testing.T) {
+	tests := []struct {
+		encoding, model, want string
+	}{
+		{"", "openai/gpt-4o-mini", EncodingO200k},
+		{"auto", "openai/gpt-4-turbo", EncodingCL100k},
+		{"", "ollama/llama3.1:8b", EncodingLlama3},
+		{"", "meta-llama/Llama-2-7b-chat", EncodingLlama},
+		{"", "openrouter/mistralai/mistral-small", EncodingLlama},
+		{"", "anthropic/claude-sonnet-4.6", EncodingHeuristic},
+		{"CL100K", "anthropic/claude-sonnet-4.6", EncodingCL100k},
+		{"heuristic", "openai/gpt-4o", EncodingHeuristic},
+	}
+	for _, tt := range tests {
+		tok, err := New(tt.encoding, tt.model, "")
+		if err != nil || tok.Name() != tt.want {
+			t.Errorf("New(%q, %q) = %v, %v; want %s", tt.encoding, tt.model, tok.Name(), err, tt.want)
+		}
+	}
+
+	tok, err := New("gpt2", "", "")
+	if err == nil || !IsHeuristic(tok) {
+		t.Fatalf("unknown encoding: %v, %v", tok.Name(), err)
+	}
+}
+
+func TestNew_UsesEmbeddedTables(t *testing.T) {
+	tests := []struct {
+		encoding string
+		text     string
+		want     []int
+	}{
+		{EncodingCL100k, "hello world", []int{15339, 1917}},
+		{EncodingCL100k, "tiktoken is great!", []int{83, 1609, 5963, 374, 2294, 0}},
+		{EncodingO200k, "hello world", []int{24912, 2375}},
+		{EncodingO200k, "tiktoken is great!", []int{83, 8251, 2488, 382, 2212, 0}},
+	}
+	for _, tt := range tests {
+		if !HasEmbeddedTable(tt.encoding) {
+			t.Skipf("built without the %s table", tt.encoding)
+		}
+		tok, err := New(tt.encoding, "", "")
+		if err != nil {
+			t.Fatalf("New(%q) error = %v", tt.encoding, err)
+		}
+		bpe, ok := tok.(*BPE)
+		if !ok {
+			t.Fatalf("New(%q) = %T, want the embedded BPE", tt.encoding, tok)
+		}
+		if got := bpe.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s Encode(%q) = %v, want %v", tt.encoding, tt.text, got, tt.want)
+		}
+	}
+
+	// Encodings without an embedded table keep the estimate.
+	if tok, _ := New(EncodingLlama3, "", ""); tok.Name() != EncodingLlama3 {
+		t.Fatalf("llama3 = %v", tok.Name())
+	} else if _, ok := tok.(*estimator); !ok {
+		t.Fatalf("llama3 tokenizer = %T, want the estimate", tok)
+	}
+}
+
+func writeRanks(t *testing.T, tokens ...string) string {
+	t.Helper()
+	var sb strings.Builder
+	for rank, tok := range tokens {
+		fmt.Fprintf(&sb, "%s %d\n", base64.StdEncoding.EncodeToString([]byte(tok)), rank)
+	}
+	path := filepath.Join(t.TempDir(), "test.tiktoken")
+	if err := os.WriteFile(path, []byte(sb.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBPE_MergesByRank(t *testing.T) {
+	path := writeRanks(t, "a", "b", "c", " ", "ab", "bc", "abc", " abc")
+	tok, err := New(EncodingCL100k, "", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bpe := tok.(*BPE)
+
+	tests := []struct {
+		text string
+		want []int
+	}{
+		{"abc abc", []int{6, 7}},
+		{"abab", []int{4, 4}},
+		{"cab", []int{2, 4}},
+		{"abd", []int{4, -1}},
+	}
+	for _, tt := range tests {
+		if got := bpe.Encode(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Encode(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+		if got := bpe.Count(tt.text); got != len(tt.want) {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, len(tt.want))
+		}
+	}
+
+	// SentencePiece vocabularies have no tiktoken tables; the estimate stays.
+	tok, err = New(EncodingLlama, "", path)
+	if err == nil || tok.Name() != EncodingLlama {
+		t.Fatalf("llama with a rank table: %v, %v", tok.Name(), err)
+	}
+	if _, ok := tok.(*estimator); !ok {
+		t.Fatalf("llama tokenizer = %T, want the estimate", tok)
+	}
+}
+
+func TestLoadRanks_RejectsMalformedLines(t *testing.T) {
+	for _, input := range []string{"", "YQ==\n", "!!! 1\n", "YQ== x\n"} {
+		if _, err := LoadRanks(strings.NewReader(input)); err == nil {
+			t.Errorf("LoadRanks(%q) succeeded", input)
+		}
+	}
+}
@@ -21,8 +21,9 @@ type Tool interface {
 type toolCtxKey struct{ name string }
 
 var (
-	ctxKeyChannel = &toolCtxKey{"channel"}
-	ctxKeyChatID  = &toolCtxKey{"chatID"}
+	ctxKeyChannel    = &toolCtxKey{"channel"}
+	ctxKeyChatID     = &toolCtxKey{"chatID"}
+	ctxKeySessionKey = &toolCtxKey{"sessionKey"}
 )
 
 // WithToolContext returns a child context carrying channel and chatID.
@@ -44,6 +45,18 @@ func ToolChatID(ctx context.Context) string {
 	return v
 }
 
+// WithToolSessionKey returns a child context carrying the session key of the
+// conversation the tool call belongs to.
+func WithToolSessionKey(ctx context.Context, sessionKey string) context.Context {
+	return context.WithValue(ctx, ctxKeySessionKey, sessionKey)
+}
+
+// ToolSessionKey extracts the session key from ctx, or "" if unset.
+func ToolSessionKey(ctx context.Context) string {
+	v, _ := ctx.Value(ctxKeySessionKey).(string)
+	return v
+}
+
 // AsyncCallback is a function type that async tools use to notify completion.
 // When an async tool finishes its work, it calls this callback with the result.
 //
@@ -81,6 +94,25 @@ type AsyncExecutor interface {
 	ExecuteAsync(ctx context.Context, args map[string]any, cb AsyncCallback) *ToolResult
 }
 
+// ConcurrencySafeTool is an optional interface for tools that can run at
+// the same time as other concurrency-safe calls from the same LLM response.
+//
+// A tool should only report true when concurrent calls cannot observe each
+// other's side effects — typically because it only reads (read_file,
+// list_dir, web_fetch, web_search). Tools that do not implement this
+// interface, or return false, always run on their own, in call order.
+type ConcurrencySafeTool interface {
+	Tool
+	// ConcurrencySafe reports whether this tool may run concurrently.
+	ConcurrencySafe() bool
+}
+
+// IsConcurrencySafe reports whether tool declares itself concurrency-safe.
+func IsConcurrencySafe(tool Tool) bool {
+	safe, ok := tool.(ConcurrencySafeTool)
+	return ok && safe.ConcurrencySafe()
+}
+
 func ToolToSchema(tool Tool) map[string]any {
 	return map[string]any{
 		"type": "function",
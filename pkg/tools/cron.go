@@ -2,6 +2,7 @@ package tools
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -10,6 +11,7 @@ import (
 	"github.com/sipeed/picoclaw/pkg/config"
 	"github.com/sipeed/picoclaw/pkg/constants"
 	"github.com/sipeed/picoclaw/pkg/cron"
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
@@ -45,7 +47,11 @@ func NewCronTool(
 	if execEnabled {
 		var err error
 		execTool, err = NewExecToolWithConfig(workspace, restrict, config)
-		if err != nil {
+		if errors.Is(err, ErrExecSandboxUnavailable) {
+			// Reminders keep working; scheduled commands are refused.
+			logger.WarnCF("tools", "Scheduled commands disabled",
+				map[string]any{"error": err.Error()})
+		} else if err != nil {
 			return nil, fmt.Errorf("unable to configure exec tool: %w", err)
 		}
 	}
@@ -0,0 +1,245 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	defaultJobOutputBytes = 10000
+	maxJobOutputBytes     = 50000
+	defaultJobTailLines   = 50
+)
+
+// JobStatusTool lists the exec tool's background jobs or describes one.
+type JobStatusTool struct {
+	exec *ExecTool
+}
+
+// JobOutputTool reads a background job's output by offset or from the end.
+type JobOutputTool struct {
+	exec *ExecTool
+}
+
+// JobKillTool stops a running background job.
+type JobKillTool struct {
+	exec *ExecTool
+}
+
+func NewJobStatusTool(execTool *ExecTool) *JobStatusTool {
+	return &JobStatusTool{exec: execTool}
+}
+
+func NewJobOutputTool(execTool *ExecTool) *JobOutputTool {
+	return &JobOutputTool{exec: execTool}
+}
+
+func NewJobKillTool(execTool *ExecTool) *JobKillTool {
+	return &JobKillTool{exec: execTool}
+}
+
+// lookupJob resolves the job_id argument to a job of the calling conversation.
+func lookupJob(ctx context.Context, execTool *ExecTool, args map[string]any) (*execJob, *ToolResult) {
+	if execTool.jobs == nil {
+		return nil, ErrorResult("background jobs are disabled (tools.exec.allow_background)")
+	}
+	id, _ := args["job_id"].(string)
+	id = strings.TrimSpace(id)
+	if id == "" {
+		return nil, ErrorResult("job_id is required")
+	}
+	job, ok := execTool.jobs.get(ctx, id)
+	if !ok {
+		return nil, ErrorResult(fmt.Sprintf("No background job found with job ID: %s", id))
+	}
+	return job, nil
+}
+
+func (t *JobStatusTool) Name() string {
+	return "job_status"
+}
+
+func (t *JobStatusTool) Description() string {
+	return "Get the status of background jobs started with exec background=true: whether each is " +
+		"running or how it ended, its runtime and how much output it produced. Pass job_id for " +
+		"details and the last lines of output of one job."
+}
+
+func (t *JobStatusTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"job_id": map[string]any{
+				"type":        "string",
+				"description": "Optional job ID (e.g. \"job-1\"). When omitted, all jobs of this conversation are listed.",
+			},
+		},
+		"required": []string{},
+	}
+}
+
+func (t *JobStatusTool) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *JobStatusTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	if id, _ := args["job_id"].(string); strings.TrimSpace(id) != "" {
+		job, errResult := lookupJob(ctx, t.exec, args)
+		if errResult != nil {
+			return errResult
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "Job: %s\nCommand: %s\nDirectory: %s\nState: %s\nStarted: %s\nRuntime: %s\nOutput: %d bytes\n",
+			job.id, job.command, job.dir, job.state(), job.started.Format("2006-01-02 15:04:05"),
+			job.duration(), job.output.size())
+		if path := job.output.path(); path != "" {
+			fmt.Fprintf(&sb, "Log file: %s\n", path)
+		}
+		if tail, _ := job.output.tail(10, defaultJobOutputBytes); len(tail) > 0 {
+			sb.WriteString("\nLast output:\n")
+			sb.WriteString(cleanTerminalOutput(tail))
+		}
+		return SilentResult(sb.String())
+	}
+
+	if t.exec.jobs == nil {
+		return ErrorResult("background jobs are disabled (tools.exec.allow_background)")
+	}
+	jobs := t.exec.jobs.list(ctx)
+	if len(jobs) == 0 {
+		return SilentResult("No background jobs.")
+	}
+	var sb strings.Builder
+	sb.WriteString("Background jobs:\n")
+	for _, job := range jobs {
+		fmt.Fprintf(&sb, "- %s: %s, %s, %d bytes of output: %s\n",
+			job.id, job.state(), job.duration(), job.output.size(), job.command)
+	}
+	return SilentResult(sb.String())
+}
+
+func (t *JobOutputTool) Name() string {
+	return "job_output"
+}
+
+func (t *JobOutputTool) Description() string {
+	return "Read the combined stdout and stderr of a background job, while it runs or after it " +
+		"ended. Without offset it returns the last tail_lines lines. With offset it returns output " +
+		"from that byte offset on; pass the next_offset of the previous call to read only new output."
+}
+
+func (t *JobOutputTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"job_id": map[string]any{
+				"type":        "string",
+				"description": "Job ID returned by exec, e.g. \"job-1\".",
+			},
+			"offset": map[string]any{
+				"type":        "integer",
+				"description": "Byte offset to read from. Omit to read the end of the output.",
+			},
+			"tail_lines": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Lines to return from the end when offset is omitted (default %d).", defaultJobTailLines),
+			},
+			"max_bytes": map[string]any{
+				"type": "integer",
+				"description": fmt.Sprintf("Most bytes to return (default %d, max %d).",
+					defaultJobOutputBytes, maxJobOutputBytes),
+			},
+		},
+		"required": []string{"job_id"},
+	}
+}
+
+func (t *JobOutputTool) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *JobOutputTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	job, errResult := lookupJob(ctx, t.exec, args)
+	if errResult != nil {
+		return errResult
+	}
+	limit := defaultJobOutputBytes
+	if n, ok := args["max_bytes"].(float64); ok && n > 0 {
+		limit = min(int(n), maxJobOutputBytes)
+	}
+
+	total := job.output.size()
+	var data []byte
+	var from int64
+	offset, byOffset := args["offset"].(float64)
+	if byOffset {
+		data, from = job.output.read(int64(offset), limit)
+	} else {
+		lines := defaultJobTailLines
+		if n, ok := args["tail_lines"].(float64); ok && n > 0 {
+			lines = int(n)
+		}
+		data, from = job.output.tail(lines, limit)
+	}
+	next := from + int64(len(data))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[%s %s; %d bytes of output", job.id, job.state(), total)
+	if len(data) > 0 {
+		fmt.Fprintf(&sb, "; showing bytes %d-%d", from, next)
+	}
+	sb.WriteString("]\n")
+	if byOffset && from > int64(offset) {
+		fmt.Fprintf(&sb, "[output before byte %d is no longer available]\n", from)
+	}
+	if len(data) == 0 {
+		sb.WriteString("(no new output)\n")
+	} else {
+		sb.WriteString(cleanTerminalOutput(data))
+		if !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&sb, "[next_offset: %d]", next)
+	return SilentResult(sb.String())
+}
+
+func (t *JobKillTool) Name() string {
+	return "job_kill"
+}
+
+func (t *JobKillTool) Description() string {
+	return "Stop a running background job and the processes it started."
+}
+
+func (t *JobKillTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"job_id": map[string]any{
+				"type":        "string",
+				"description": "Job ID returned by exec, e.g. \"job-1\".",
+			},
+		},
+		"required": []string{"job_id"},
+	}
+}
+
+func (t *JobKillTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	if blocked := t.exec.checkChannel(ctx, args); blocked != nil {
+		return blocked
+	}
+	job, errResult := lookupJob(ctx, t.exec, args)
+	if errResult != nil {
+		return errResult
+	}
+	if !t.exec.jobs.kill(job) {
+		return ErrorResult(fmt.Sprintf("Job %s already %s", job.id, job.state()))
+	}
+	msg := fmt.Sprintf("Job %s %s after %s.", job.id, job.state(), job.duration())
+	if tail, _ := job.output.tail(10, defaultJobOutputBytes); len(tail) > 0 {
+		msg += "\n\nLast output:\n" + cleanTerminalOutput(tail)
+	}
+	return SilentResult(msg)
+}
@@ -0,0 +1,460 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultMaxBackgroundJobs = 4
+	defaultBackgroundTimeout = 2 * time.Hour
+
+	jobRingSize     = 256 << 10 // most recent output kept in memory per job
+	maxFinishedJobs = 32        // finished jobs remembered before the oldest is forgotten
+	jobNoticeTail   = 2000      // bytes of output quoted in the completion notice
+)
+
+// execJobs runs the exec tool's background jobs. A job's output goes to a
+// ring buffer for quick tails and to a log file for the full history.
+type execJobs struct {
+	logDir     string
+	maxRunning int
+	timeout    time.Duration // 0 means no limit
+
+	mu     sync.Mutex
+	nextID int
+	jobs   map[string]*execJob
+	order  []string // job IDs, oldest first
+}
+
+// execJob is one background command.
+type execJob struct {
+	id      string
+	command string
+	dir     string
+	channel string
+	chatID  string
+	started time.Time
+	output  *jobOutput
+	cancel  context.CancelFunc
+	done    chan struct{} // closed once the job has ended and the fields below are final
+
+	mu       sync.Mutex
+	ended    time.Time
+	exitErr  error
+	killed   bool
+	timedOut bool
+}
+
+func newExecJobs(workingDir string, maxRunning int, timeout time.Duration) *execJobs {
+	logDir := filepath.Join(os.TempDir(), "picoclaw-jobs")
+	if workingDir != "" {
+		logDir = filepath.Join(workingDir, "state", "jobs")
+	}
+	return &execJobs{
+		logDir:     logDir,
+		maxRunning: maxRunning,
+		timeout:    timeout,
+		jobs:       make(map[string]*execJob),
+	}
+}
+
+// start launches command in cwd as a background job. cb, when set, receives
+// the completion notice unless the job is killed with job_kill.
+func (m *execJobs) start(ctx context.Context, t *ExecTool, command, cwd string, cb AsyncCallback) *ToolResult {
+	m.mu.Lock()
+	running := 0
+	for _, job := range m.jobs {
+		if !job.finished() {
+			running++
+		}
+	}
+	if running >= m.maxRunning {
+		m.mu.Unlock()
+		return ErrorResult(fmt.Sprintf(
+			"%d background jobs are already running; wait for one to finish or stop one with job_kill", running))
+	}
+	m.nextID++
+	id := "job-" + strconv.Itoa(m.nextID)
+	m.mu.Unlock()
+
+	// The job outlives the call, so it must not inherit the turn's context.
+	var jobCtx context.Context
+	var cancel context.CancelFunc
+	if m.timeout > 0 {
+		jobCtx, cancel = context.WithTimeout(context.Background(), m.timeout)
+	} else {
+		jobCtx, cancel = context.WithCancel(context.Background())
+	}
+	cmd, cleanup, err := t.command(jobCtx, command, cwd)
+	if err != nil {
+		cancel()
+		return ErrorResult(fmt.Sprintf("failed to start background job: %v", err)).WithError(err)
+	}
+	cmd.Cancel = func() error { return terminateProcessTree(cmd) }
+	// Processes the job leaves behind may keep its output open.
+	cmd.WaitDelay = 5 * time.Second
+
+	output := newJobOutput(filepath.Join(m.logDir, id+".log"))
+	cmd.Stdout = output
+	cmd.Stderr = output
+	if err := cmd.Start(); err != nil {
+		cancel()
+		cleanup()
+		output.close()
+		return ErrorResult(fmt.Sprintf("failed to start background job: %v", err)).WithError(err)
+	}
+
+	job := &execJob{
+		id:      id,
+		command: command,
+		dir:     cwd,
+		channel: ToolChannel(ctx),
+		chatID:  ToolChatID(ctx),
+		started: time.Now(),
+		output:  output,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.jobs[id] = job
+	m.order = append(m.order, id)
+	m.mu.Unlock()
+
+	logger.InfoCF("tools", "Background job started",
+		map[string]any{"job_id": id, "command": command, "dir": cwd, "pid": cmd.Process.Pid})
+
+	go func() {
+		err := cmd.Wait()
+		cleanup()
+		job.mu.Lock()
+		job.ended = time.Now()
+		job.exitErr = err
+		job.timedOut = !job.killed && errors.Is(jobCtx.Err(), context.DeadlineExceeded)
+		killed := job.killed
+		job.mu.Unlock()
+		cancel()
+		output.close()
+		close(job.done)
+
+		logger.InfoCF("tools", "Background job finished",
+			map[string]any{"job_id": id, "state": job.state(), "duration": job.duration().String()})
+		m.prune()
+		if cb != nil && !killed {
+			cb(ctx, job.notice())
+		}
+	}()
+
+	msg := fmt.Sprintf("Started background job %s: %s\n", id, command)
+	if cb != nil {
+		msg += "You will be notified when it finishes. "
+	}
+	msg += fmt.Sprintf("Use job_status, job_output or job_kill with job_id %q to check on it.", id)
+	return AsyncResult(msg)
+}
+
+// get returns the job if the calling conversation may see it.
+func (m *execJobs) get(ctx context.Context, id string) (*execJob, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok || !job.visibleTo(ctx) {
+		return nil, false
+	}
+	return job, true
+}
+
+// list returns the jobs the calling conversation may see, oldest first.
+func (m *execJobs) list(ctx context.Context) []*execJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var jobs []*execJob
+	for _, id := range m.order {
+		if job := m.jobs[id]; job.visibleTo(ctx) {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// prune forgets the oldest finished jobs beyond maxFinishedJobs and removes
+// their logs.
+func (m *execJobs) prune() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	finished := 0
+	for _, id := range m.order {
+		if m.jobs[id].finished() {
+			finished++
+		}
+	}
+	kept := m.order[:0]
+	for _, id := range m.order {
+		job := m.jobs[id]
+		if finished > maxFinishedJobs && job.finished() {
+			finished--
+			delete(m.jobs, id)
+			if path := job.output.path(); path != "" {
+				os.Remove(path)
+			}
+			continue
+		}
+		kept = append(kept, id)
+	}
+	m.order = kept
+}
+
+// kill stops a running job and waits briefly for it to end. It reports
+// false when the job had already finished.
+func (m *execJobs) kill(job *execJob) bool {
+	job.mu.Lock()
+	if job.finished() {
+		job.mu.Unlock()
+		return false
+	}
+	job.killed = true
+	job.mu.Unlock()
+	job.cancel()
+	select {
+	case <-job.done:
+	case <-time.After(10 * time.Second):
+	}
+	return true
+}
+
+// killAll stops every running job without waiting for them.
+func (m *execJobs) killAll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range m.jobs {
+		job.mu.Lock()
+		if !job.finished() {
+			job.killed = true
+			job.cancel()
+		}
+		job.mu.Unlock()
+	}
+}
+
+func (j *execJob) visibleTo(ctx context.Context) bool {
+	channel, chatID := ToolChannel(ctx), ToolChatID(ctx)
+	if channel == "" || j.channel == "" {
+		return true
+	}
+	return j.channel == channel && j.chatID == chatID
+}
+
+func (j *execJob) finished() bool {
+	select {
+	case <-j.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// state describes whether and how the job ended.
+func (j *execJob) state() string {
+	if !j.finished() {
+		return "running"
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var exitErr *exec.ExitError
+	switch {
+	case j.killed:
+		return "killed"
+	case j.timedOut:
+		return "timed out"
+	case j.exitErr == nil:
+		return "exited with code 0"
+	case errors.As(j.exitErr, &exitErr) && exitErr.ExitCode() >= 0:
+		return fmt.Sprintf("exited with code %d", exitErr.ExitCode())
+	default:
+		return fmt.Sprintf("failed (%v)", j.exitErr)
+	}
+}
+
+func (j *execJob) duration() time.Duration {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	end := j.ended
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return end.Sub(j.started).Round(time.Second)
+}
+
+// notice is the result handed to the async callback when the job ends.
+func (j *execJob) notice() *ToolResult {
+	state := j.state()
+	summary := fmt.Sprintf("Background job %s %s after %s: %s", j.id, state, j.duration(), j.command)
+
+	var sb strings.Builder
+	sb.WriteString(summary)
+	tail, from := j.output.tail(0, jobNoticeTail)
+	if len(tail) == 0 {
+		sb.WriteString("\n\n(no output)")
+	} else {
+		sb.WriteString("\n\nLast output:\n")
+		sb.WriteString(cleanTerminalOutput(tail))
+	}
+	if from > 0 {
+		fmt.Fprintf(&sb, "\n\n[%d bytes of output in total; use job_output with job_id %q for more]",
+			j.output.size(), j.id)
+	}
+
+	result := &ToolResult{ForLLM: sb.String(), ForUser: summary}
+	if state != "exited with code 0" {
+		result.IsError = true
+	}
+	return result
+}
+
+// jobOutput collects a job's combined stdout and stderr. The last
+// jobRingSize bytes stay in memory; everything also goes to the log file
+// when one could be created.
+type jobOutput struct {
+	logPath string
+
+	mu    sync.Mutex
+	ring  []byte
+	total int64
+	log   *os.File
+}
+
+func newJobOutput(logPath string) *jobOutput {
+	o := &jobOutput{}
+	if err := os.MkdirAll(filepath.Dir(logPath), 0o755); err == nil {
+		if f, err := os.Create(logPath); err == nil {
+			o.log = f
+			o.logPath = logPath
+		}
+	}
+	if o.log == nil {
+		logger.WarnCF("tools", "Background job log unavailable; keeping recent output only",
+			map[string]any{"path": logPath})
+	}
+	return o
+}
+
+func (o *jobOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.log != nil {
+		if _, err := o.log.Write(p); err != nil {
+			logger.WarnCF("tools", "Background job log write failed; keeping recent output only",
+				map[string]any{"path": o.logPath, "error": err.Error()})
+			o.log.Close()
+			o.log = nil
+			o.logPath = ""
+		}
+	}
+	o.ring = append(o.ring, p...)
+	if excess := len(o.ring) - jobRingSize; excess > 0 {
+		o.ring = append(o.ring[:0], o.ring[excess:]...)
+	}
+	o.total += int64(len(p))
+	return len(p), nil
+}
+
+func (o *jobOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.log != nil {
+		o.log.Close()
+		o.log = nil
+	}
+}
+
+// path returns the log file, or "" when there is none.
+func (o *jobOutput) path() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.logPath
+}
+
+func (o *jobOutput) size() int64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.total
+}
+
+// read returns up to limit bytes starting at offset, cut at a line end where
+// possible, and the offset the data actually starts at. That is later than
+// offset when the log is unavailable and the ring no longer holds it.
+func (o *jobOutput) read(offset int64, limit int) ([]byte, int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	offset = max(offset, 0)
+	if offset >= o.total {
+		return nil, o.total
+	}
+	ringStart := o.total - int64(len(o.ring))
+	var data []byte
+	switch {
+	case offset >= ringStart:
+		data = o.ring[offset-ringStart:]
+	case o.logPath != "":
+		if f, err := os.Open(o.logPath); err == nil {
+			data = make([]byte, min(int64(limit), o.total-offset))
+			n, err := f.ReadAt(data, offset)
+			f.Close()
+			data = data[:n]
+			if err != nil && !errors.Is(err, io.EOF) {
+				data = nil
+			}
+		}
+		if len(data) == 0 {
+			offset, data = ringStart, o.ring
+		}
+	default:
+		offset, data = ringStart, o.ring
+	}
+	if len(data) > limit {
+		data = data[:limit]
+		if cut := bytes.LastIndexByte(data, '\n'); cut > 0 {
+			data = data[:cut+1]
+		}
+	}
+	return bytes.Clone(data), offset
+}
+
+// tail returns the last lines of output (all that fit when lines is 0),
+// at most limit bytes, and the offset they start at.
+func (o *jobOutput) tail(lines, limit int) ([]byte, int64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	data := o.ring
+	if len(data) > limit {
+		data = data[len(data)-limit:]
+		if cut := bytes.IndexByte(data, '\n'); cut >= 0 && cut < len(data)-1 {
+			data = data[cut+1:]
+		}
+	}
+	if lines > 0 {
+		end := len(bytes.TrimRight(data, "\n"))
+		for i := end - 1; i >= 0; i-- {
+			if data[i] == '\n' {
+				lines--
+				if lines == 0 {
+					data = data[i+1:]
+					break
+				}
+			}
+		}
+	}
+	return bytes.Clone(data), o.total - int64(len(data))
+}
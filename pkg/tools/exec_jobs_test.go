@@ -0,0 +1,181 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+var jobIDPattern = regexp.MustCompile(`job-\d+`)
+
+func startTestJob(t *testing.T, tool *ExecTool, ctx context.Context, command string, cb AsyncCallback) string {
+	t.Helper()
+	result := tool.ExecuteAsync(ctx, map[string]any{"command": command, "background": true}, cb)
+	if result.IsError || !result.Async {
+		t.Fatalf("background exec failed: %+v", result)
+	}
+	id := jobIDPattern.FindString(result.ForLLM)
+	if id == "" {
+		t.Fatalf("no job ID in result: %s", result.ForLLM)
+	}
+	return id
+}
+
+func TestExecTool_BackgroundJobNotifiesOnCompletion(t *testing.T) {
+	tool, err := NewExecTool(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("NewExecTool() error: %v", err)
+	}
+	tool.SetTimeout(100 * time.Millisecond) // background jobs are not bound by it
+
+	done := make(chan *ToolResult, 1)
+	id := startTestJob(t, tool, context.Background(), "sleep 0.5; echo built; exit 2",
+		func(_ context.Context, result *ToolResult) { done <- result })
+
+	select {
+	case result := <-done:
+		if !strings.Contains(result.ForLLM, id+" exited with code 2") || !strings.Contains(result.ForLLM, "built") {
+			t.Errorf("unexpected completion notice: %s", result.ForLLM)
+		}
+		if !result.IsError {
+			t.Error("expected a failing job to be reported as an error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("completion callback not called")
+	}
+
+	status := NewJobStatusTool(tool).Execute(context.Background(), map[string]any{})
+	if !strings.Contains(status.ForLLM, id+": exited with code 2") {
+		t.Errorf("job_status did not list the job: %s", status.ForLLM)
+	}
+}
+
+func TestJobOutputTool_OffsetAndTail(t *testing.T) {
+	tool, err := NewExecTool(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("NewExecTool() error: %v", err)
+	}
+	done := make(chan struct{})
+	id := startTestJob(t, tool, context.Background(), "for i in 1 2 3 4 5; do echo line$i; done",
+		func(context.Context, *ToolResult) { close(done) })
+	<-done
+
+	out := NewJobOutputTool(tool)
+	tail := out.Execute(context.Background(), map[string]any{"job_id": id, "tail_lines": float64(2)})
+	if !strings.Contains(tail.ForLLM, "line4\nline5") || strings.Contains(tail.ForLLM, "line3") {
+		t.Errorf("unexpected tail: %s", tail.ForLLM)
+	}
+
+	first := out.Execute(context.Background(), map[string]any{"job_id": id, "offset": float64(0), "max_bytes": float64(12)})
+	if !strings.Contains(first.ForLLM, "line1\nline2\n") || strings.Contains(first.ForLLM, "line3") {
+		t.Errorf("unexpected first page: %s", first.ForLLM)
+	}
+	if !strings.Contains(first.ForLLM, "[next_offset: 12]") {
+		t.Errorf("expected next offset 12: %s", first.ForLLM)
+	}
+	rest := out.Execute(context.Background(), map[string]any{"job_id": id, "offset": float64(12)})
+	if !strings.Contains(rest.ForLLM, "line3\nline4\nline5") || strings.Contains(rest.ForLLM, "line2") {
+		t.Errorf("unexpected second page: %s", rest.ForLLM)
+	}
+}
+
+func TestJobOutput_ReadsOldOutputFromLog(t *testing.T) {
+	output := newJobOutput(t.TempDir() + "/job.log")
+	chunk := strings.Repeat("x", 1023) + "\n"
+	for range jobRingSize/len(chunk) + 4 {
+		output.Write([]byte(chunk))
+	}
+	output.Write([]byte("end\n"))
+	output.close()
+
+	data, from := output.read(0, 2048)
+	if from != 0 || string(data) != chunk+chunk {
+		t.Errorf("read(0) = %d bytes from %d, want two chunks from 0", len(data), from)
+	}
+	tail, _ := output.tail(1, 100)
+	if string(tail) != "end\n" {
+		t.Errorf("tail = %q, want %q", tail, "end\n")
+	}
+	os.Remove(output.path())
+	if data, from := output.read(0, 2048); from == 0 || len(data) == 0 {
+		t.Errorf("expected read to fall back to the ring once the log is gone, got %d bytes from %d", len(data), from)
+	}
+}
+
+func TestJobKillTool_StopsJobWithoutNotice(t *testing.T) {
+	tool, err := NewExecTool(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("NewExecTool() error: %v", err)
+	}
+	notified := make(chan struct{}, 1)
+	id := startTestJob(t, tool, context.Background(), "sleep 30 & wait",
+		func(context.Context, *ToolResult) { notified <- struct{}{} })
+
+	start := time.Now()
+	result := NewJobKillTool(tool).Execute(context.Background(), map[string]any{"job_id": id})
+	if result.IsError || !strings.Contains(result.ForLLM, "killed") {
+		t.Fatalf("job_kill failed: %s", result.ForLLM)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("job_kill took %s", time.Since(start))
+	}
+	select {
+	case <-notified:
+		t.Error("killed job should not send a completion notice")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	again := NewJobKillTool(tool).Execute(context.Background(), map[string]any{"job_id": id})
+	if !again.IsError {
+		t.Errorf("expected error killing a finished job, got: %s", again.ForLLM)
+	}
+}
+
+func TestExecJobs_LimitsAndScope(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.MaxBackgroundJobs = 1
+	tool, err := NewExecToolWithConfig(t.TempDir(), false, cfg)
+	if err != nil {
+		t.Fatalf("NewExecToolWithConfig() error: %v", err)
+	}
+	t.Cleanup(func() { tool.Close() })
+
+	ctx := WithToolContext(context.Background(), "cli", "chat-1")
+	id := startTestJob(t, tool, ctx, "sleep 30", nil)
+
+	result := tool.Execute(ctx, map[string]any{"command": "sleep 30", "background": true})
+	if !result.IsError || !strings.Contains(result.ForLLM, "already running") {
+		t.Errorf("expected job limit error, got: %s", result.ForLLM)
+	}
+
+	other := WithToolContext(context.Background(), "cli", "chat-2")
+	if r := NewJobOutputTool(tool).Execute(other, map[string]any{"job_id": id}); !r.IsError {
+		t.Errorf("expected another chat not to see the job, got: %s", r.ForLLM)
+	}
+	if r := NewJobStatusTool(tool).Execute(other, map[string]any{}); strings.Contains(r.ForLLM, id) {
+		t.Errorf("job_status leaked a job of another chat: %s", r.ForLLM)
+	}
+}
+
+func TestExecTool_BackgroundDisabled(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.AllowBackground = false
+	tool, err := NewExecToolWithConfig(t.TempDir(), false, cfg)
+	if err != nil {
+		t.Fatalf("NewExecToolWithConfig() error: %v", err)
+	}
+	if _, ok := tool.Parameters()["properties"].(map[string]any)["background"]; ok {
+		t.Error("background parameter offered while disabled")
+	}
+	result := tool.Execute(context.Background(), map[string]any{"command": "echo hi", "background": true})
+	if !result.IsError {
+		t.Errorf("expected background exec to fail while disabled, got: %s", result.ForLLM)
+	}
+}
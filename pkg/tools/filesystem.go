@@ -279,6 +279,11 @@ func (t *ReadFileTool) Name() string {
 	return "read_file"
 }
 
+// ConcurrencySafe reports true: read_file only reads.
+func (t *ReadFileTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *ReadFileTool) Description() string {
 	return "Read the contents of a file. Supports pagination via `offset` and `length`."
 }
@@ -563,6 +568,11 @@ func (t *ListDirTool) Name() string {
 	return "list_dir"
 }
 
+// ConcurrencySafe reports true: list_dir only reads.
+func (t *ListDirTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *ListDirTool) Description() string {
 	return "List files and directories in a path"
 }
@@ -612,6 +622,11 @@ type fileSystem interface {
 	WriteFile(path string, data []byte) error
 	ReadDir(path string) ([]os.DirEntry, error)
 	Open(path string) (fs.File, error)
+	Remove(path string) error
+	// WriteTemp writes data to a new temporary file next to path and
+	// returns its path, for Rename to move over path later.
+	WriteTemp(path string, data []byte) (string, error)
+	Rename(oldpath, newpath string) error
 }
 
 // hostFs is an unrestricted fileReadWriter that operates directly on the host filesystem.
@@ -655,6 +670,52 @@ func (h *hostFs) Open(path string) (fs.File, error) {
 	return f, nil
 }
 
+func (h *hostFs) Remove(path string) error {
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove file: %w", err)
+	}
+	return nil
+}
+
+func (h *hostFs) WriteTemp(path string, data []byte) (string, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create parent directories: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(dir, ".tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp file: %w", err)
+	}
+	if err := writeAndSync(tmpFile, data); err != nil {
+		os.Remove(tmpFile.Name())
+		return "", err
+	}
+	return tmpFile.Name(), nil
+}
+
+func (h *hostFs) Rename(oldpath, newpath string) error {
+	if err := os.Rename(oldpath, newpath); err != nil {
+		return fmt.Errorf("failed to rename file: %w", err)
+	}
+	return nil
+}
+
+// writeAndSync writes data to f, flushes it to storage and closes f.
+func writeAndSync(f *os.File, data []byte) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write temp file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync temp file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close temp file: %w", err)
+	}
+	return nil
+}
+
 // sandboxFs is a sandboxed fileSystem that operates within a strictly defined workspace using os.Root.
 type sandboxFs struct {
 	workspace string
@@ -786,6 +847,53 @@ func (r *sandboxFs) Open(path string) (fs.File, error) {
 	return f, err
 }
 
+func (r *sandboxFs) Remove(path string) error {
+	return r.execute(path, func(root *os.Root, relPath string) error {
+		if err := root.Remove(relPath); err != nil {
+			return fmt.Errorf("failed to remove file: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *sandboxFs) WriteTemp(path string, data []byte) (string, error) {
+	var tmpPath string
+	err := r.execute(path, func(root *os.Root, relPath string) error {
+		dir := filepath.Dir(relPath)
+		if dir != "." {
+			if err := root.MkdirAll(dir, 0o755); err != nil {
+				return fmt.Errorf("failed to create parent directories: %w", err)
+			}
+		}
+		tmpRelPath := filepath.Join(dir,
+			fmt.Sprintf(".tmp-%s-%d-%d", filepath.Base(relPath), os.Getpid(), time.Now().UnixNano()))
+		tmpFile, err := root.OpenFile(tmpRelPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open temp file: %w", err)
+		}
+		if err := writeAndSync(tmpFile, data); err != nil {
+			root.Remove(tmpRelPath)
+			return err
+		}
+		tmpPath = filepath.Join(r.workspace, tmpRelPath)
+		return nil
+	})
+	return tmpPath, err
+}
+
+func (r *sandboxFs) Rename(oldpath, newpath string) error {
+	oldRel, err := getSafeRelPath(r.workspace, oldpath)
+	if err != nil {
+		return err
+	}
+	return r.execute(newpath, func(root *os.Root, newRel string) error {
+		if err := root.Rename(oldRel, newRel); err != nil {
+			return fmt.Errorf("failed to rename file: %w", err)
+		}
+		return nil
+	})
+}
+
 // whitelistFs wraps a sandboxFs and allows access to specific paths outside
 // the workspace when they match any of the provided patterns.
 type whitelistFs struct {
@@ -826,6 +934,29 @@ func (w *whitelistFs) Open(path string) (fs.File, error) {
 	return w.sandbox.Open(path)
 }
 
+func (w *whitelistFs) Remove(path string) error {
+	if w.matches(path) {
+		return w.host.Remove(path)
+	}
+	return w.sandbox.Remove(path)
+}
+
+// WriteTemp and Rename follow the target path, so a file allowed outside the
+// workspace is staged next to it on the host.
+func (w *whitelistFs) WriteTemp(path string, data []byte) (string, error) {
+	if w.matches(path) {
+		return w.host.WriteTemp(path, data)
+	}
+	return w.sandbox.WriteTemp(path, data)
+}
+
+func (w *whitelistFs) Rename(oldpath, newpath string) error {
+	if w.matches(newpath) {
+		return w.host.Rename(oldpath, newpath)
+	}
+	return w.sandbox.Rename(oldpath, newpath)
+}
+
 // buildFs returns the appropriate fileSystem implementation based on restriction
 // settings and optional path whitelist patterns.
 func buildFs(workspace string, restrict bool, patterns []*regexp.Regexp) fileSystem {
@@ -0,0 +1,185 @@
+package tools
+
+import (
+	"path"
+	"strings"
+)
+
+// ignoreRule is one line of a .gitignore file.
+type ignoreRule struct {
+	base     string   // directory of the .gitignore, slash-separated and relative to the walk root; "" for the root
+	segments []string // pattern split at "/"
+	negate   bool     // "!pattern" re-includes
+	dirOnly  bool     // "pattern/" only matches directories
+	anchored bool     // the pattern contains a "/", so it matches from base rather than any level
+}
+
+// ignoreRules holds the rules in effect for a directory, outermost first.
+type ignoreRules []ignoreRule
+
+// parseGitignore parses the content of the .gitignore in directory base.
+func parseGitignore(base string, data []byte) ignoreRules {
+	var rules ignoreRules
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " \t")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if strings.Contains(line, "/") {
+			rule.anchored = true
+			line = strings.TrimPrefix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignored reports whether rel, a slash-separated path relative to the walk
+// root, is ignored. The last matching rule wins, as in git.
+func (rs ignoreRules) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range rs {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			sub = rel[len(rule.base)+1:]
+		}
+		var matched bool
+		if rule.anchored {
+			matched = matchPathSegments(rule.segments, strings.Split(sub, "/"))
+		} else {
+			matched = matchPathSegments(rule.segments, []string{path.Base(sub)})
+		}
+		if matched {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchPathSegments matches path segments against a glob split at "/",
+// where a "**" segment matches any number of segments.
+func matchPathSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if matchPathSegments(pattern[1:], segments) {
+			return true
+		}
+		return len(segments) > 0 && matchPathSegments(pattern, segments[1:])
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchPathSegments(pattern[1:], segments[1:])
+}
+
+// expandBraces expands "{a,b}" alternatives in a glob, which path.Match
+// does not support: "*.{ts,tsx}" becomes "*.ts" and "*.tsx".
+func expandBraces(pattern string) []string {
+	open := strings.IndexByte(pattern, '{')
+	if open < 0 {
+		return []string{pattern}
+	}
+	depth := 0
+	for i := open; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			var out []string
+			for _, alt := range splitBraceAlternatives(pattern[open+1 : i]) {
+				out = append(out, expandBraces(pattern[:open]+alt+pattern[i+1:])...)
+			}
+			return out
+		}
+	}
+	return []string{pattern} // unbalanced: taken literally
+}
+
+// splitBraceAlternatives splits the inside of a brace group at top-level
+// commas.
+func splitBraceAlternatives(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// pathGlob matches slash-separated relative paths. A pattern without a "/"
+// matches the file name at any depth; one with a "/" matches the whole path.
+type pathGlob struct {
+	patterns [][]string
+	baseOnly bool
+}
+
+func compilePathGlob(pattern string) (*pathGlob, error) {
+	pattern = strings.TrimPrefix(strings.TrimSpace(pattern), "./")
+	g := &pathGlob{baseOnly: !strings.Contains(pattern, "/")}
+	for _, p := range expandBraces(pattern) {
+		segments := strings.Split(p, "/")
+		for _, seg := range segments {
+			if _, err := path.Match(seg, ""); err != nil {
+				return nil, err
+			}
+		}
+		g.patterns = append(g.patterns, segments)
+	}
+	return g, nil
+}
+
+func (g *pathGlob) match(rel string) bool {
+	segments := strings.Split(rel, "/")
+	if g.baseOnly {
+		segments = segments[len(segments)-1:]
+	}
+	for _, p := range g.patterns {
+		if matchPathSegments(p, segments) {
+			return true
+		}
+	}
+	return false
+}
@@ -124,6 +124,11 @@ func (t *MCPTool) Name() string {
 	return base + "_" + suffix
 }
 
+// ConcurrencySafe reports whether the server marked the tool read-only.
+func (t *MCPTool) ConcurrencySafe() bool {
+	return t.tool.Annotations != nil && t.tool.Annotations.ReadOnlyHint
+}
+
 // Description returns the tool description
 func (t *MCPTool) Description() string {
 	desc := t.tool.Description
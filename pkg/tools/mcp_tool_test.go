@@ -58,6 +58,24 @@ func TestNewMCPTool(t *testing.T) {
 	}
 }
 
+// TestMCPTool_ConcurrencySafe verifies only read-only MCP tools run in parallel
+func TestMCPTool_ConcurrencySafe(t *testing.T) {
+	manager := &MockMCPManager{}
+
+	plain := NewMCPTool(manager, "server", &mcp.Tool{Name: "write"})
+	if IsConcurrencySafe(plain) {
+		t.Error("tool without annotations should not be concurrency-safe")
+	}
+
+	readOnly := NewMCPTool(manager, "server", &mcp.Tool{
+		Name:        "read",
+		Annotations: &mcp.ToolAnnotations{ReadOnlyHint: true},
+	})
+	if !IsConcurrencySafe(readOnly) {
+		t.Error("read-only tool should be concurrency-safe")
+	}
+}
+
 // TestMCPTool_Name verifies tool name with server prefix
 func TestMCPTool_Name(t *testing.T) {
 	tests := []struct {
@@ -3,14 +3,14 @@ package tools
 import (
 	"context"
 	"fmt"
-	"sync/atomic"
+	"sync"
 )
 
 type SendCallback func(channel, chatID, content string) error
 
 type MessageTool struct {
 	sendCallback SendCallback
-	sentInRound  atomic.Bool // Tracks whether a message was sent in the current processing round
+	sentInRound  sync.Map // Session keys whose current processing round already sent a message
 }
 
 func NewMessageTool() *MessageTool {
@@ -46,15 +46,18 @@ func (t *MessageTool) Parameters() map[string]any {
 	}
 }
 
-// ResetSentInRound resets the per-round send tracker.
+// ResetSentInRound resets the send tracker of the session's round.
 // Called by the agent loop at the start of each inbound message processing round.
-func (t *MessageTool) ResetSentInRound() {
-	t.sentInRound.Store(false)
+func (t *MessageTool) ResetSentInRound(sessionKey string) {
+	t.sentInRound.Delete(sessionKey)
 }
 
-// HasSentInRound returns true if the message tool sent a message during the current round.
-func (t *MessageTool) HasSentInRound() bool {
-	return t.sentInRound.Load()
+// HasSentInRound returns true if the message tool sent a message during the
+// session's current round. Sessions running concurrently do not see each
+// other's sends.
+func (t *MessageTool) HasSentInRound(sessionKey string) bool {
+	_, sent := t.sentInRound.Load(sessionKey)
+	return sent
 }
 
 func (t *MessageTool) SetSendCallback(callback SendCallback) {
@@ -93,7 +96,7 @@ func (t *MessageTool) Execute(ctx context.Context, args map[string]any) *ToolRes
 		}
 	}
 
-	t.sentInRound.Store(true)
+	t.sentInRound.Store(ToolSessionKey(ctx), struct{}{})
 	// Silent: user already received the message directly
 	return &ToolResult{
 		ForLLM: fmt.Sprintf("Message sent to %s:%s", channel, chatID),
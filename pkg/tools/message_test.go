@@ -57,6 +57,25 @@ func TestMessageTool_Execute_Success(t *testing.T) {
 	}
 }
 
+func TestMessageTool_SentInRoundPerSession(t *testing.T) {
+	tool := NewMessageTool()
+	tool.SetSendCallback(func(channel, chatID, content string) error { return nil })
+
+	ctx := WithToolSessionKey(WithToolContext(context.Background(), "telegram", "1"), "session-a")
+	tool.Execute(ctx, map[string]any{"content": "hi"})
+
+	if !tool.HasSentInRound("session-a") {
+		t.Error("send was not tracked for session-a")
+	}
+	if tool.HasSentInRound("session-b") {
+		t.Error("send in session-a leaked into session-b")
+	}
+	tool.ResetSentInRound("session-a")
+	if tool.HasSentInRound("session-a") {
+		t.Error("ResetSentInRound did not clear session-a")
+	}
+}
+
 func TestMessageTool_Execute_WithCustomChannel(t *testing.T) {
 	tool := NewMessageTool()
 
@@ -0,0 +1,784 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ApplyPatchTool changes several files in one call, from either a unified
+// diff or a list of old_text/new_text edits. Every change is checked before
+// anything is written, so a patch that does not fit leaves all files as they
+// were.
+type ApplyPatchTool struct {
+	fs        fileSystem
+	workspace string
+}
+
+// NewApplyPatchTool creates an ApplyPatchTool with the same directory
+// restriction as edit_file.
+func NewApplyPatchTool(workspace string, restrict bool, allowPaths ...[]*regexp.Regexp) *ApplyPatchTool {
+	var patterns []*regexp.Regexp
+	if len(allowPaths) > 0 {
+		patterns = allowPaths[0]
+	}
+	return &ApplyPatchTool{fs: buildFs(workspace, restrict, patterns), workspace: workspace}
+}
+
+func (t *ApplyPatchTool) Name() string {
+	return "apply_patch"
+}
+
+func (t *ApplyPatchTool) Description() string {
+	return "Apply several file changes at once, all or nothing. Pass either 'patch', a unified diff " +
+		"(as produced by diff -u or git diff; /dev/null as the old path creates a file, as the new " +
+		"path deletes it), or 'edits', a list of {path, old_text, new_text} replacements applied in " +
+		"order (an empty old_text on a missing file creates it, delete=true removes the file). " +
+		"Hunks and edits that do not match exactly are retried ignoring whitespace; if one still " +
+		"does not match, nothing is written and the closest lines of the file are shown."
+}
+
+func (t *ApplyPatchTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"patch": map[string]any{
+				"type":        "string",
+				"description": "Unified diff touching one or more files. Paths are relative to the workspace; a/ and b/ prefixes are accepted.",
+			},
+			"edits": map[string]any{
+				"type":        "array",
+				"description": "Replacements applied in order, as an alternative to patch.",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"path": map[string]any{
+							"type":        "string",
+							"description": "The file to change",
+						},
+						"old_text": map[string]any{
+							"type":        "string",
+							"description": "The text to find; it must occur once. Empty to create a new file.",
+						},
+						"new_text": map[string]any{
+							"type":        "string",
+							"description": "The text to replace it with, or the content of a new file",
+						},
+						"delete": map[string]any{
+							"type":        "boolean",
+							"description": "Delete the file instead",
+						},
+					},
+					"required": []string{"path"},
+				},
+			},
+		},
+	}
+}
+
+func (t *ApplyPatchTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	patch, _ := args["patch"].(string)
+	edits, _ := args["edits"].([]any)
+	if (strings.TrimSpace(patch) == "") == (len(edits) == 0) {
+		return ErrorResult("pass either patch or edits")
+	}
+
+	plan := &patchPlan{fs: t.fs, workspace: t.workspace, files: make(map[string]*fileChange)}
+	if patch != "" {
+		files, err := parseUnifiedDiff(patch)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid patch: %v", err))
+		}
+		for _, fp := range files {
+			plan.applyFilePatch(fp)
+		}
+	} else {
+		for i, raw := range edits {
+			edit, ok := raw.(map[string]any)
+			if !ok {
+				return ErrorResult(fmt.Sprintf("edits[%d] must be an object", i))
+			}
+			plan.applyEdit(i, edit)
+		}
+	}
+
+	if len(plan.conflicts) > 0 {
+		return ErrorResult("Patch not applied; no files were changed.\n\n" + strings.Join(plan.conflicts, "\n\n"))
+	}
+	if err := plan.commit(); err != nil {
+		return ErrorResult(err.Error())
+	}
+	return SilentResult(plan.summary())
+}
+
+// fileChange is the planned state of one file.
+type fileChange struct {
+	path     string // as given in the patch
+	original []byte
+	existed  bool
+	content  []byte
+	exists   bool
+	notes    []string
+}
+
+func (c *fileChange) status() string {
+	switch {
+	case !c.existed && c.exists:
+		return "A"
+	case c.existed && !c.exists:
+		return "D"
+	default:
+		return "M"
+	}
+}
+
+// patchPlan collects the changes of one call in memory before any is
+// written.
+type patchPlan struct {
+	fs        fileSystem
+	workspace string
+	files     map[string]*fileChange // resolved path -> change
+	order     []string
+	conflicts []string
+}
+
+func (p *patchPlan) resolve(path string) string {
+	path = filepath.FromSlash(strings.TrimSpace(path))
+	if !filepath.IsAbs(path) && p.workspace != "" {
+		path = filepath.Join(p.workspace, path)
+	}
+	return filepath.Clean(path)
+}
+
+// file returns the planned state of path, reading it on first use.
+func (p *patchPlan) file(path string) (*fileChange, error) {
+	resolved := p.resolve(path)
+	if c, ok := p.files[resolved]; ok {
+		return c, nil
+	}
+	c := &fileChange{path: path}
+	content, err := p.fs.ReadFile(resolved)
+	switch {
+	case err == nil:
+		c.original, c.existed = content, true
+		c.content, c.exists = content, true
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+	p.files[resolved] = c
+	p.order = append(p.order, resolved)
+	return c, nil
+}
+
+func (p *patchPlan) conflict(format string, args ...any) {
+	p.conflicts = append(p.conflicts, fmt.Sprintf(format, args...))
+}
+
+func (p *patchPlan) applyFilePatch(fp filePatch) {
+	path := fp.newPath
+	if path == "" {
+		path = fp.oldPath
+	}
+	c, err := p.file(path)
+	if err != nil {
+		p.conflict("%s: %v", path, err)
+		return
+	}
+	switch {
+	case fp.oldPath == "": // create
+		if c.exists {
+			p.conflict("%s: the patch creates this file but it already exists", path)
+			return
+		}
+		var text textLines
+		text.finalNewline = true
+		for _, h := range fp.hunks {
+			for _, l := range h.lines {
+				if l.kind == '+' {
+					text.lines = append(text.lines, l.text)
+				}
+			}
+			if h.newNoEOL {
+				text.finalNewline = false
+			}
+		}
+		text.eol = "\n"
+		c.content, c.exists = text.bytes(), true
+	case fp.newPath == "": // delete
+		if !c.exists {
+			p.conflict("%s: the patch deletes this file but it does not exist", path)
+			return
+		}
+		c.content, c.exists = nil, false
+	default:
+		if !c.exists {
+			p.conflict("%s: file not found", path)
+			return
+		}
+		text := splitText(c.content)
+		pos := 0
+		offset := 0
+		for i, h := range fp.hunks {
+			old, _ := h.sides()
+			expected := max(h.oldStart-1+offset, pos)
+			if h.oldStart == 0 && len(old) > 0 {
+				expected = -1
+			}
+			at, fuzz, ok := findLines(text.lines, old, pos, expected)
+			if !ok {
+				p.conflict("%s", hunkConflict(path, i+1, h, text.lines, pos, expected))
+				return
+			}
+			if fuzz != "" {
+				c.notes = append(c.notes, fmt.Sprintf("hunk %d matched at line %d %s", i+1, at+1, fuzz))
+			}
+			replacement := h.replacement(text.lines[at : at+len(old)])
+			if at+len(old) == len(text.lines) {
+				switch {
+				case h.newNoEOL:
+					text.finalNewline = false
+				case h.oldNoEOL:
+					text.finalNewline = true
+				}
+			}
+			text.lines = append(text.lines[:at:at], append(replacement, text.lines[at+len(old):]...)...)
+			pos = at + len(replacement)
+			if h.oldStart > 0 {
+				offset = pos - (h.oldStart - 1 + len(old))
+			}
+		}
+		c.content = text.bytes()
+	}
+}
+
+func (p *patchPlan) applyEdit(i int, edit map[string]any) {
+	path, _ := edit["path"].(string)
+	if strings.TrimSpace(path) == "" {
+		p.conflict("edits[%d]: path is required", i)
+		return
+	}
+	c, err := p.file(path)
+	if err != nil {
+		p.conflict("edits[%d] %s: %v", i, path, err)
+		return
+	}
+	if del, _ := edit["delete"].(bool); del {
+		if !c.exists {
+			p.conflict("edits[%d] %s: cannot delete, the file does not exist", i, path)
+			return
+		}
+		c.content, c.exists = nil, false
+		return
+	}
+
+	oldText, _ := edit["old_text"].(string)
+	newText, ok := edit["new_text"].(string)
+	if !ok {
+		p.conflict("edits[%d] %s: new_text is required", i, path)
+		return
+	}
+	if !c.exists {
+		if oldText != "" {
+			p.conflict("edits[%d] %s: file not found", i, path)
+			return
+		}
+		c.content, c.exists = []byte(newText), true
+		return
+	}
+	if oldText == "" {
+		p.conflict("edits[%d] %s: old_text is empty but the file exists; give the text to replace", i, path)
+		return
+	}
+
+	content := string(c.content)
+	switch n := strings.Count(content, oldText); {
+	case n == 1:
+		c.content = []byte(strings.Replace(content, oldText, newText, 1))
+		return
+	case n > 1:
+		p.conflict("edits[%d] %s: old_text appears %d times. Please provide more context to make it unique",
+			i, path, n)
+		return
+	}
+
+	// Retry line by line, ignoring whitespace differences.
+	text := splitText(c.content)
+	old := splitText([]byte(oldText)).lines
+	at, fuzz, ok := findUniqueLines(text.lines, old)
+	if !ok {
+		p.conflict("%s", editConflict(i, path, text.lines, old, at))
+		return
+	}
+	replacement := splitText([]byte(newText)).lines
+	text.lines = append(text.lines[:at:at], append(replacement, text.lines[at+len(old):]...)...)
+	c.content = text.bytes()
+	c.notes = append(c.notes, fmt.Sprintf("edits[%d] matched at line %d %s", i, at+1, fuzz))
+}
+
+// commit writes the planned changes. Every new content is first written to a
+// temporary file, so a failed write changes nothing; the temporary files then
+// replace their targets. When a rename or removal fails, the files already
+// changed are restored.
+func (p *patchPlan) commit() error {
+	staged := make(map[string]string) // resolved path -> temporary file
+	removeStaged := func() {
+		for _, tmp := range staged {
+			_ = p.fs.Remove(tmp)
+		}
+	}
+	for _, resolved := range p.order {
+		c := p.files[resolved]
+		if !c.exists || (c.existed && string(c.content) == string(c.original)) {
+			continue
+		}
+		tmp, err := p.fs.WriteTemp(resolved, c.content)
+		if err != nil {
+			removeStaged()
+			return fmt.Errorf("failed to write %s: %v; no files were changed", c.path, err)
+		}
+		staged[resolved] = tmp
+	}
+
+	var done []string
+	for _, resolved := range p.order {
+		c := p.files[resolved]
+		var err error
+		if tmp, ok := staged[resolved]; ok {
+			err = p.fs.Rename(tmp, resolved)
+			if err == nil {
+				delete(staged, resolved)
+			}
+		} else if !c.exists && c.existed {
+			err = p.fs.Remove(resolved)
+		} else {
+			continue
+		}
+		if err != nil {
+			removeStaged()
+			for _, prev := range done {
+				pc := p.files[prev]
+				if pc.existed {
+					_ = p.fs.WriteFile(prev, pc.original)
+				} else {
+					_ = p.fs.Remove(prev)
+				}
+			}
+			return fmt.Errorf("failed to write %s: %v; earlier changes were rolled back", c.path, err)
+		}
+		done = append(done, resolved)
+	}
+	return nil
+}
+
+func (p *patchPlan) summary() string {
+	var sb strings.Builder
+	changed := 0
+	for _, resolved := range p.order {
+		c := p.files[resolved]
+		if c.exists == c.existed && string(c.content) == string(c.original) {
+			fmt.Fprintf(&sb, "  = %s (unchanged)\n", c.path)
+			continue
+		}
+		changed++
+		fmt.Fprintf(&sb, "  %s %s\n", c.status(), c.path)
+		for _, note := range c.notes {
+			fmt.Fprintf(&sb, "      %s\n", note)
+		}
+	}
+	return fmt.Sprintf("Patch applied: %d file(s) changed\n", changed) + sb.String()
+}
+
+// textLines is a file split into lines, remembering its line ending and
+// whether the last line ends with one.
+type textLines struct {
+	lines        []string
+	eol          string
+	finalNewline bool
+}
+
+func splitText(content []byte) textLines {
+	s := string(content)
+	t := textLines{eol: "\n"}
+	if strings.Contains(s, "\r\n") {
+		t.eol = "\r\n"
+		s = strings.ReplaceAll(s, "\r\n", "\n")
+	}
+	if s == "" {
+		return t
+	}
+	t.finalNewline = strings.HasSuffix(s, "\n")
+	t.lines = strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	return t
+}
+
+func (t textLines) bytes() []byte {
+	if len(t.lines) == 0 {
+		return []byte{}
+	}
+	s := strings.Join(t.lines, t.eol)
+	if t.finalNewline {
+		s += t.eol
+	}
+	return []byte(s)
+}
+
+// lineMatchers compare a patch line with a file line, strictest first.
+var lineMatchers = []struct {
+	fuzz  string
+	equal func(a, b string) bool
+}{
+	{"", func(a, b string) bool { return a == b }},
+	{"ignoring trailing whitespace", func(a, b string) bool {
+		return strings.TrimRight(a, " \t") == strings.TrimRight(b, " \t")
+	}},
+	{"ignoring whitespace", func(a, b string) bool {
+		return strings.Join(strings.Fields(a), " ") == strings.Join(strings.Fields(b), " ")
+	}},
+}
+
+func linesMatch(lines, want []string, at int, equal func(a, b string) bool) bool {
+	if at < 0 || at+len(want) > len(lines) {
+		return false
+	}
+	for i, w := range want {
+		if !equal(lines[at+i], w) {
+			return false
+		}
+	}
+	return true
+}
+
+// findLines finds want in lines at or after from, taking the match nearest
+// to expected (any match when expected is negative), with the strictest
+// matcher that finds one. It returns the index and a note on the fuzz used.
+func findLines(lines, want []string, from, expected int) (int, string, bool) {
+	if len(want) == 0 {
+		if expected < 0 {
+			return len(lines), "", true
+		}
+		return min(max(expected, from), len(lines)), "", true
+	}
+	for _, m := range lineMatchers {
+		best := -1
+		for at := from; at+len(want) <= len(lines); at++ {
+			if !linesMatch(lines, want, at, m.equal) {
+				continue
+			}
+			if best < 0 || abs(at-expected) < abs(best-expected) {
+				best = at
+			}
+			if expected < 0 || at >= expected {
+				break
+			}
+		}
+		if best >= 0 {
+			fuzz := m.fuzz
+			if expected >= 0 && best != expected {
+				if fuzz != "" {
+					fuzz = ", " + fuzz
+				}
+				fuzz = fmt.Sprintf("(offset %+d lines%s)", best-expected, fuzz)
+			} else if fuzz != "" {
+				fuzz = "(" + fuzz + ")"
+			}
+			return best, fuzz, true
+		}
+	}
+	return -1, "", false
+}
+
+// findUniqueLines finds the single place where want matches lines with a
+// whitespace-tolerant matcher. On failure it returns the number of matches
+// of the first matcher that found several, or -1.
+func findUniqueLines(lines, want []string) (int, string, bool) {
+	if len(want) == 0 {
+		return -1, "", false
+	}
+	for _, m := range lineMatchers[1:] {
+		found := -1
+		count := 0
+		for at := 0; at+len(want) <= len(lines); at++ {
+			if linesMatch(lines, want, at, m.equal) {
+				found = at
+				count++
+			}
+		}
+		switch {
+		case count == 1:
+			return found, "(" + m.fuzz + ")", true
+		case count > 1:
+			return count, "", false
+		}
+	}
+	return -1, "", false
+}
+
+// closestLines returns where the most lines of want match lines in order,
+// ignoring whitespace, and how many match.
+func closestLines(lines, want []string) (int, int) {
+	bestAt, bestScore := -1, 0
+	if len(want) == 0 || len(lines)*len(want) > 5_000_000 {
+		return bestAt, bestScore
+	}
+	equal := lineMatchers[len(lineMatchers)-1].equal
+	for at := 0; at < len(lines); at++ {
+		score := 0
+		for i, w := range want {
+			if at+i < len(lines) && strings.TrimSpace(w) != "" && equal(lines[at+i], w) {
+				score++
+			}
+		}
+		if score > bestScore {
+			bestAt, bestScore = at, score
+		}
+	}
+	return bestAt, bestScore
+}
+
+// excerpt shows lines[from:to] with 1-based line numbers.
+func excerpt(lines []string, from, to int) string {
+	from, to = max(from, 0), min(to, len(lines))
+	var sb strings.Builder
+	for i := from; i < to; i++ {
+		fmt.Fprintf(&sb, "%6d  %s\n", i+1, lines[i])
+	}
+	return sb.String()
+}
+
+func describeClosest(lines, want []string) string {
+	at, score := closestLines(lines, want)
+	if at < 0 {
+		return "No similar lines found in the file."
+	}
+	return fmt.Sprintf("Closest match at line %d (%d of %d lines match); the file has:\n%s",
+		at+1, score, len(want), excerpt(lines, at-2, at+len(want)+2))
+}
+
+func hunkConflict(path string, n int, h hunk, lines []string, from, expected int) string {
+	old, _ := h.sides()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s: hunk %d (%s) does not match the file", path, n, h.header)
+	if from > 0 {
+		fmt.Fprintf(&sb, " after line %d", from)
+	}
+	sb.WriteString(".\nThe hunk expects:\n")
+	for _, l := range old {
+		fmt.Fprintf(&sb, "        %s\n", l)
+	}
+	if closest, _ := closestLines(lines, old); expected >= 0 && expected < len(lines) && closest != expected {
+		fmt.Fprintf(&sb, "At line %d the file has:\n%s", expected+1,
+			excerpt(lines, expected, expected+len(old)))
+	}
+	sb.WriteString(describeClosest(lines, old))
+	return strings.TrimRight(sb.String(), "\n")
+}
+
+func editConflict(i int, path string, lines, old []string, matches int) string {
+	if matches > 1 {
+		return fmt.Sprintf("edits[%d] %s: old_text matches %d places when ignoring whitespace. "+
+			"Please provide more context to make it unique", i, path, matches)
+	}
+	return strings.TrimRight(fmt.Sprintf("edits[%d] %s: old_text not found in file.\n%s",
+		i, path, describeClosest(lines, old)), "\n")
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// filePatch is the part of a unified diff for one file. An empty oldPath
+// creates the file, an empty newPath deletes it.
+type filePatch struct {
+	oldPath string
+	newPath string
+	hunks   []hunk
+}
+
+type hunk struct {
+	header   string
+	oldStart int // 1-based; 0 when the header has no position
+	lines    []hunkLine
+	oldNoEOL bool // the old side's last line has no newline
+	newNoEOL bool // the new side's last line has no newline
+
+	// Lines the header's counts still expect on each side.
+	oldLeft, newLeft int
+}
+
+type hunkLine struct {
+	kind byte // ' ', '-' or '+'
+	text string
+}
+
+func (h *hunk) add(l hunkLine) {
+	h.lines = append(h.lines, l)
+	if l.kind != '+' {
+		h.oldLeft--
+	}
+	if l.kind != '-' {
+		h.newLeft--
+	}
+}
+
+// counting reports whether the header's line counts are not used up yet,
+// so a line such as "--- x" still belongs to the hunk.
+func (h *hunk) counting() bool {
+	return h.oldLeft > 0 || h.newLeft > 0
+}
+
+// sides returns the lines the hunk expects and the lines it leaves.
+func (h hunk) sides() (oldLines, newLines []string) {
+	for _, l := range h.lines {
+		if l.kind != '+' {
+			oldLines = append(oldLines, l.text)
+		}
+		if l.kind != '-' {
+			newLines = append(newLines, l.text)
+		}
+	}
+	return oldLines, newLines
+}
+
+// replacement returns the hunk's new lines, keeping the file's own version
+// of context lines that matched only loosely.
+func (h hunk) replacement(matched []string) []string {
+	var out []string
+	i := 0
+	for _, l := range h.lines {
+		switch l.kind {
+		case ' ':
+			out = append(out, matched[i])
+			i++
+		case '-':
+			i++
+		case '+':
+			out = append(out, l.text)
+		}
+	}
+	return out
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// parseUnifiedDiff splits a unified diff into per-file patches. It is
+// lenient about what models produce: a hunk may run past its line counts, a
+// blank line inside a hunk is an empty context line, and lines outside
+// hunks (diff --git, index, mode lines) are skipped. The counts are only used
+// to tell a removed or added line starting with "-- " or "++ " from the
+// next file header.
+func parseUnifiedDiff(patch string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(patch, "\r\n", "\n"), "\n")
+	var files []filePatch
+	var cur *filePatch
+	var h *hunk
+
+	endHunk := func() {
+		if h == nil {
+			return
+		}
+		for len(h.lines) > 0 && h.lines[len(h.lines)-1] == (hunkLine{kind: ' '}) {
+			h.lines = h.lines[:len(h.lines)-1]
+		}
+		cur.hunks = append(cur.hunks, *h)
+		h = nil
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case (h == nil || !h.counting()) && strings.HasPrefix(line, "--- ") &&
+			i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur != nil {
+				endHunk()
+				files = append(files, *cur)
+			}
+			cur = &filePatch{oldPath: diffPath(line[4:]), newPath: diffPath(lines[i+1][4:])}
+			if cur.oldPath == "" && cur.newPath == "" {
+				return nil, fmt.Errorf("line %d: both paths are /dev/null", i+1)
+			}
+			i++
+		case strings.HasPrefix(line, "@@"):
+			if cur == nil {
+				return nil, fmt.Errorf("line %d: hunk before any --- / +++ file header", i+1)
+			}
+			endHunk()
+			h = &hunk{header: strings.TrimSpace(line)}
+			if m := hunkHeaderPattern.FindStringSubmatch(line); m != nil {
+				h.oldStart, _ = strconv.Atoi(m[1])
+				if h.oldStart == 0 {
+					h.oldStart = 1 // an empty old side starts before line 1
+				}
+				h.oldLeft, h.newLeft = hunkCount(m[2]), hunkCount(m[3])
+			} else if line != "@@" && !strings.HasPrefix(line, "@@ ") {
+				return nil, fmt.Errorf("line %d: malformed hunk header %q", i+1, line)
+			}
+		case h != nil && strings.HasPrefix(line, `\`):
+			if n := len(h.lines); n > 0 {
+				switch h.lines[n-1].kind {
+				case '-':
+					h.oldNoEOL = true
+				case '+':
+					h.newNoEOL = true
+				default:
+					h.oldNoEOL, h.newNoEOL = true, true
+				}
+			}
+		case h != nil && line == "":
+			h.add(hunkLine{kind: ' '})
+		case h != nil && (line[0] == ' ' || line[0] == '-' || line[0] == '+'):
+			h.add(hunkLine{kind: line[0], text: line[1:]})
+		default:
+			// Headers such as "diff --git" or "index" end the hunk.
+			endHunk()
+		}
+	}
+	if cur != nil {
+		endHunk()
+		files = append(files, *cur)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no file headers (--- a/path, +++ b/path) found")
+	}
+	for _, f := range files {
+		if f.oldPath != "" && f.newPath != "" && filepath.Clean(f.oldPath) != filepath.Clean(f.newPath) {
+			return nil, fmt.Errorf("renaming %s to %s is not supported; delete and create the file instead",
+				f.oldPath, f.newPath)
+		}
+		if f.oldPath != "" && f.newPath != "" && len(f.hunks) == 0 {
+			return nil, fmt.Errorf("%s: no hunks", f.newPath)
+		}
+	}
+	return files, nil
+}
+
+// hunkCount returns a line count of a hunk header; an omitted count is 1.
+func hunkCount(s string) int {
+	if s == "" {
+		return 1
+	}
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// diffPath returns the path of a ---/+++ header, "" for /dev/null.
+func diffPath(s string) string {
+	if i := strings.IndexByte(s, '\t'); i >= 0 {
+		s = s[:i] // timestamp
+	}
+	s = strings.TrimSpace(s)
+	if s == "/dev/null" {
+		return ""
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s
+}
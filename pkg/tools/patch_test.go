@@ -0,0 +1,257 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestApplyPatchTool_UnifiedDiffCreatesModifiesAndDeletes(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"main.go": "package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n\nfunc unused() {}\n",
+		"old.txt": "bye\n",
+	})
+	tool := NewApplyPatchTool(dir, true)
+
+	patch := `diff --git a/main.go b/main.go
+index 1111111..2222222 100644
+--- a/main.go
++++ b/main.go
+@@ -2,4 +2,4 @@
+
+ func main() {
+-	println("hi")
++	println("hello")
+ }
+@@ -6,2 +6,1 @@
+
+-func unused() {}
+--- /dev/null
++++ b/pkg/new.go
+@@ -0,0 +1,2 @@
++package pkg
++// new
+--- a/old.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+`
+	result := tool.Execute(context.Background(), map[string]any{"patch": patch})
+	if result.IsError {
+		t.Fatalf("apply_patch failed: %s", result.ForLLM)
+	}
+	if got, want := readTestFile(t, filepath.Join(dir, "main.go")),
+		"package main\n\nfunc main() {\n\tprintln(\"hello\")\n}\n\n"; got != want {
+		t.Errorf("main.go = %q, want %q", got, want)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "pkg", "new.go")); got != "package pkg\n// new\n" {
+		t.Errorf("new.go = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("old.txt should be deleted, stat err = %v", err)
+	}
+	for _, want := range []string{"3 file(s) changed", "M main.go", "A pkg/new.go", "D old.txt"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("summary missing %q: %s", want, result.ForLLM)
+		}
+	}
+}
+
+func TestApplyPatchTool_FuzzyHunkMatch(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"a.py": "# header\n# more\ndef f():\n    x = 1   \n    return x\n",
+	})
+	tool := NewApplyPatchTool(dir, true)
+
+	// Wrong line numbers and missing trailing whitespace on a context line.
+	patch := "--- a/a.py\n+++ b/a.py\n@@ -10,3 +10,3 @@\n def f():\n     x = 1\n-    return x\n+    return x + 1\n"
+	result := tool.Execute(context.Background(), map[string]any{"patch": patch})
+	if result.IsError {
+		t.Fatalf("apply_patch failed: %s", result.ForLLM)
+	}
+	if got, want := readTestFile(t, filepath.Join(dir, "a.py")),
+		"# header\n# more\ndef f():\n    x = 1   \n    return x + 1\n"; got != want {
+		t.Errorf("a.py = %q, want %q", got, want)
+	}
+	if !strings.Contains(result.ForLLM, "matched at line 3") {
+		t.Errorf("expected fuzz note, got: %s", result.ForLLM)
+	}
+}
+
+func TestApplyPatchTool_ConflictChangesNothing(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"a.txt": "one\ntwo\nthree\n",
+		"b.txt": "alpha\nbeta\ngamma\n",
+	})
+	tool := NewApplyPatchTool(dir, true)
+
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n one\n-two\n+TWO\n" +
+		"--- a/b.txt\n+++ b/b.txt\n@@ -1,3 +1,3 @@\n alpha\n-delta\n+DELTA\n gamma\n"
+	result := tool.Execute(context.Background(), map[string]any{"patch": patch})
+	if !result.IsError {
+		t.Fatalf("expected conflict, got: %s", result.ForLLM)
+	}
+	for _, want := range []string{"no files were changed", "b.txt: hunk 1", "Closest match at line 1 (2 of 3 lines match)", "     2  beta"} {
+		if !strings.Contains(result.ForLLM, want) {
+			t.Errorf("conflict report missing %q: %s", want, result.ForLLM)
+		}
+	}
+	if got := readTestFile(t, filepath.Join(dir, "a.txt")); got != "one\ntwo\nthree\n" {
+		t.Errorf("a.txt changed despite the conflict: %q", got)
+	}
+}
+
+func TestApplyPatchTool_Edits(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"a.txt":    "one\ntwo\nthree\n",
+		"gone.txt": "x\n",
+	})
+	tool := NewApplyPatchTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{"edits": []any{
+		map[string]any{"path": "a.txt", "old_text": "one", "new_text": "1"},
+		map[string]any{"path": "a.txt", "old_text": "  two  \n  three", "new_text": "2\n3"},
+		map[string]any{"path": "new.txt", "old_text": "", "new_text": "created\n"},
+		map[string]any{"path": "gone.txt", "delete": true},
+	}})
+	if result.IsError {
+		t.Fatalf("apply_patch failed: %s", result.ForLLM)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "a.txt")); got != "1\n2\n3\n" {
+		t.Errorf("a.txt = %q", got)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "new.txt")); got != "created\n" {
+		t.Errorf("new.txt = %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.txt")); !os.IsNotExist(err) {
+		t.Errorf("gone.txt should be deleted, stat err = %v", err)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{"edits": []any{
+		map[string]any{"path": "a.txt", "old_text": "1", "new_text": "one"},
+		map[string]any{"path": "a.txt", "old_text": "missing", "new_text": "x"},
+	}})
+	if !result.IsError || !strings.Contains(result.ForLLM, "edits[1] a.txt: old_text not found") {
+		t.Errorf("expected not-found conflict, got: %s", result.ForLLM)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "a.txt")); got != "1\n2\n3\n" {
+		t.Errorf("a.txt changed despite the conflict: %q", got)
+	}
+}
+
+func TestApplyPatchTool_RestrictedToWorkspace(t *testing.T) {
+	dir := t.TempDir()
+	tool := NewApplyPatchTool(dir, true)
+
+	patch := "--- /dev/null\n+++ b/../escape.txt\n@@ -0,0 +1 @@\n+x\n"
+	result := tool.Execute(context.Background(), map[string]any{"patch": patch})
+	if !result.IsError {
+		t.Fatalf("expected escape to be rejected, got: %s", result.ForLLM)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the workspace, stat err = %v", err)
+	}
+}
+
+func TestParseUnifiedDiff_NoNewlineMarkers(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"a.txt": "a\nb"})
+	tool := NewApplyPatchTool(dir, true)
+
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n"
+	result := tool.Execute(context.Background(), map[string]any{"patch": patch})
+	if result.IsError {
+		t.Fatalf("apply_patch failed: %s", result.ForLLM)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "a.txt")); got != "a\nc\n" {
+		t.Errorf("a.txt = %q, want %q", got, "a\nc\n")
+	}
+
+	if _, err := parseUnifiedDiff("--- a/x\n+++ b/y\n@@ -1 +1 @@\n-a\n+b\n"); err == nil {
+		t.Error("expected renames to be rejected")
+	}
+	if _, err := parseUnifiedDiff("just text"); err == nil {
+		t.Error("expected an error for a patch without file headers")
+	}
+}
+
+func TestParseUnifiedDiff_HeaderLikeLinesInsideHunk(t *testing.T) {
+	// Removing "-- old" and adding "++ new" gives lines that look like a
+	// file header; the hunk's counts say they still belong to it.
+	patch := "--- a/notes.md\n+++ b/notes.md\n@@ -1,2 +1,2 @@\n--- old\n+++ new\n keep\n" +
+		"--- a/other.md\n+++ b/other.md\n@@ -1 +1 @@\n-x\n+y\n"
+	files, err := parseUnifiedDiff(patch)
+	if err != nil {
+		t.Fatalf("parseUnifiedDiff() error = %v", err)
+	}
+	if len(files) != 2 || files[1].newPath != "other.md" {
+		t.Fatalf("files = %+v, want notes.md and other.md", files)
+	}
+	oldLines, newLines := files[0].hunks[0].sides()
+	if strings.Join(oldLines, "|") != "-- old|keep" || strings.Join(newLines, "|") != "++ new|keep" {
+		t.Errorf("notes.md sides = %q, %q", oldLines, newLines)
+	}
+}
+
+// failingWriteFs fails to stage the given file.
+type failingWriteFs struct {
+	fileSystem
+	fail string
+}
+
+func (f *failingWriteFs) WriteTemp(path string, data []byte) (string, error) {
+	if filepath.Base(path) == f.fail {
+		return "", os.ErrPermission
+	}
+	return f.fileSystem.WriteTemp(path, data)
+}
+
+func TestApplyPatchTool_FailedWriteChangesNothing(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{"a.txt": "one\n", "b.txt": "two\n"})
+	tool := NewApplyPatchTool(dir, true)
+	tool.fs = &failingWriteFs{fileSystem: tool.fs, fail: "b.txt"}
+
+	result := tool.Execute(context.Background(), map[string]any{"edits": []any{
+		map[string]any{"path": "a.txt", "old_text": "one", "new_text": "1"},
+		map[string]any{"path": "b.txt", "old_text": "two", "new_text": "2"},
+	}})
+	if !result.IsError || !strings.Contains(result.ForLLM, "no files were changed") {
+		t.Fatalf("expected write failure, got: %s", result.ForLLM)
+	}
+	if got := readTestFile(t, filepath.Join(dir, "a.txt")); got != "one\n" {
+		t.Errorf("a.txt changed despite the failed write: %q", got)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 2 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"fmt"
+	"path"
+	"slices"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+// derivedTools maps tools to the tools whose power they combine. A derived
+// tool is only kept while all its base tools are, so denying exec also
+// removes shell_session and the background job tools.
+var derivedTools = map[string][]string{
+	"shell_session": {"exec"},
+	"job_status":    {"exec"},
+	"job_output":    {"exec"},
+	"job_kill":      {"exec"},
+	"apply_patch":   {"edit_file", "write_file"},
+	"grep":          {"read_file"},
+	"glob":          {"list_dir"},
+}
+
+// PolicyFilter returns the registry filter for a tool policy: a tool is kept
+// when it matches an allow pattern, or no allow list is set, and matches no
+// deny pattern. Derived tools must also keep their base tools. An empty policy
+// returns nil, which keeps every tool.
+func PolicyFilter(policy *config.ToolPolicy) func(name string) bool {
+	if policy == nil || (len(policy.Allow) == 0 && len(policy.Deny) == 0) {
+		return nil
+	}
+	allow := slices.Clone(policy.Allow)
+	deny := slices.Clone(policy.Deny)
+	var keep func(name string) bool
+	keep = func(name string) bool {
+		if len(allow) > 0 && !matchesAnyToolPattern(allow, name) {
+			return false
+		}
+		if matchesAnyToolPattern(deny, name) {
+			return false
+		}
+		for _, base := range derivedTools[name] {
+			if !keep(base) {
+				return false
+			}
+		}
+		return true
+	}
+	return keep
+}
+
+// MatchToolPattern reports whether a tool name matches a pattern. Patterns
+// use path.Match syntax, so "mcp_github_*" matches every tool of the github
+// MCP server. A malformed pattern only matches the identical name.
+func MatchToolPattern(pattern, name string) bool {
+	matched, err := path.Match(pattern, name)
+	if err != nil {
+		return pattern == name
+	}
+	return matched
+}
+
+// ValidateToolPatterns returns an error for the first malformed pattern.
+func ValidateToolPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid tool pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+func matchesAnyToolPattern(patterns []string, name string) bool {
+	return slices.ContainsFunc(patterns, func(pattern string) bool {
+		return MatchToolPattern(pattern, name)
+	})
+}
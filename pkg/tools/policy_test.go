@@ -0,0 +1,124 @@
+package tools
+
+import (
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func TestPolicyFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *config.ToolPolicy
+		keep   []string
+		drop   []string
+	}{
+		{
+			name:   "allow globs",
+			policy: &config.ToolPolicy{Allow: []string{"read_file", "mcp_github_*"}},
+			keep:   []string{"read_file", "mcp_github_create_issue"},
+			drop:   []string{"exec", "write_file", "mcp_slack_post"},
+		},
+		{
+			name:   "deny only",
+			policy: &config.ToolPolicy{Deny: []string{"exec", "write_*"}},
+			keep:   []string{"read_file", "web_search"},
+			drop:   []string{"exec", "write_file"},
+		},
+		{
+			name: "deny wins over allow",
+			policy: &config.ToolPolicy{
+				Allow: []string{"mcp_github_*"},
+				Deny:  []string{"mcp_github_delete_*"},
+			},
+			keep: []string{"mcp_github_list_issues"},
+			drop: []string{"mcp_github_delete_repo"},
+		},
+		{
+			name:   "malformed pattern matches literally",
+			policy: &config.ToolPolicy{Deny: []string{"exec["}},
+			keep:   []string{"exec"},
+			drop:   []string{"exec["},
+		},
+		{
+			name:   "denying exec removes shell_session",
+			policy: &config.ToolPolicy{Deny: []string{"exec"}},
+			keep:   []string{"read_file"},
+			drop:   []string{"exec", "shell_session", "job_status", "job_output", "job_kill"},
+		},
+		{
+			name:   "allowing the job tools alone is not enough",
+			policy: &config.ToolPolicy{Allow: []string{"read_file", "job_*"}},
+			keep:   []string{"read_file"},
+			drop:   []string{"job_status", "job_output", "job_kill"},
+		},
+		{
+			name:   "allowing shell_session alone is not enough",
+			policy: &config.ToolPolicy{Allow: []string{"read_file", "shell_session"}},
+			keep:   []string{"read_file"},
+			drop:   []string{"shell_session"},
+		},
+		{
+			name:   "denying edit_file removes apply_patch",
+			policy: &config.ToolPolicy{Deny: []string{"write_file", "edit_file"}},
+			keep:   []string{"read_file"},
+			drop:   []string{"edit_file", "apply_patch"},
+		},
+		{
+			name:   "denying write_file removes apply_patch",
+			policy: &config.ToolPolicy{Deny: []string{"write_file"}},
+			keep:   []string{"edit_file"},
+			drop:   []string{"write_file", "apply_patch"},
+		},
+		{
+			name:   "apply_patch follows both file tools",
+			policy: &config.ToolPolicy{Allow: []string{"edit_file", "write_file", "apply_patch"}},
+			keep:   []string{"edit_file", "write_file", "apply_patch"},
+		},
+		{
+			name:   "denying read_file and list_dir removes grep and glob",
+			policy: &config.ToolPolicy{Deny: []string{"read_file", "list_dir"}},
+			keep:   []string{"web_search"},
+			drop:   []string{"read_file", "list_dir", "grep", "glob"},
+		},
+		{
+			name:   "shell_session can be denied on its own",
+			policy: &config.ToolPolicy{Deny: []string{"shell_session"}},
+			keep:   []string{"exec"},
+			drop:   []string{"shell_session"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keep := PolicyFilter(tt.policy)
+			for _, name := range tt.keep {
+				if !keep(name) {
+					t.Errorf("expected %q to be kept", name)
+				}
+			}
+			for _, name := range tt.drop {
+				if keep(name) {
+					t.Errorf("expected %q to be dropped", name)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyFilter_EmptyPolicyKeepsEverything(t *testing.T) {
+	if PolicyFilter(nil) != nil {
+		t.Error("expected nil filter for a nil policy")
+	}
+	if PolicyFilter(&config.ToolPolicy{}) != nil {
+		t.Error("expected nil filter for an empty policy")
+	}
+}
+
+func TestValidateToolPatterns(t *testing.T) {
+	if err := ValidateToolPatterns([]string{"exec", "mcp_*", "read_?ile"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ValidateToolPatterns([]string{"exec", "mcp_[github"}); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
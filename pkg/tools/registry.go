@@ -20,6 +20,7 @@ type ToolEntry struct {
 
 type ToolRegistry struct {
 	tools   map[string]*ToolEntry
+	filter  func(name string) bool // nil keeps every tool; see SetFilter
 	mu      sync.RWMutex
 	version atomic.Uint64 // incremented on Register/RegisterHidden for cache invalidation
 }
@@ -34,6 +35,10 @@ func (r *ToolRegistry) Register(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	name := tool.Name()
+	if r.filter != nil && !r.filter(name) {
+		logger.DebugCF("tools", "Tool filtered out by policy", map[string]any{"name": name})
+		return
+	}
 	if _, exists := r.tools[name]; exists {
 		logger.WarnCF("tools", "Tool registration overwrites existing tool",
 			map[string]any{"name": name})
@@ -52,6 +57,10 @@ func (r *ToolRegistry) RegisterHidden(tool Tool) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	name := tool.Name()
+	if r.filter != nil && !r.filter(name) {
+		logger.DebugCF("tools", "Tool filtered out by policy", map[string]any{"name": name})
+		return
+	}
 	if _, exists := r.tools[name]; exists {
 		logger.WarnCF("tools", "Hidden tool registration overwrites existing tool",
 			map[string]any{"name": name})
@@ -65,6 +74,24 @@ func (r *ToolRegistry) RegisterHidden(tool Tool) {
 	logger.DebugCF("tools", "Registered hidden tool", map[string]any{"name": name})
 }
 
+// SetFilter restricts the registry to the tools for which keep returns true.
+// Registered tools that fail it are removed and later registrations of such
+// tools are ignored. Clones inherit the filter. A nil keep lifts it.
+func (r *ToolRegistry) SetFilter(keep func(name string) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.filter = keep
+	if keep == nil {
+		return
+	}
+	for name := range r.tools {
+		if !keep(name) {
+			delete(r.tools, name)
+		}
+	}
+	r.version.Add(1)
+}
+
 // PromoteTools atomically sets the TTL for multiple non-core tools.
 // This prevents a concurrent TickTTL from decrementing between promotions.
 func (r *ToolRegistry) PromoteTools(names []string, ttl int) {
@@ -150,6 +177,13 @@ func (r *ToolRegistry) Get(name string) (Tool, bool) {
 	return entry.Tool, true
 }
 
+// IsConcurrencySafe reports whether the named tool is callable and declares
+// itself safe to run concurrently with other such calls.
+func (r *ToolRegistry) IsConcurrencySafe(name string) bool {
+	tool, ok := r.Get(name)
+	return ok && IsConcurrencySafe(tool)
+}
+
 func (r *ToolRegistry) Execute(ctx context.Context, name string, args map[string]any) *ToolResult {
 	return r.ExecuteWithContext(ctx, name, args, "", "", nil)
 }
@@ -343,12 +377,22 @@ func (r *ToolRegistry) List() []string {
 // will NOT be visible to the clone, preventing recursive subagent spawning.
 // The version counter is reset to 0 in the clone as it's a new independent registry.
 func (r *ToolRegistry) Clone() *ToolRegistry {
+	return r.CloneFiltered(nil)
+}
+
+// CloneFiltered is like Clone but keeps only the tools for which keep
+// returns true. A nil keep keeps every tool.
+func (r *ToolRegistry) CloneFiltered(keep func(name string) bool) *ToolRegistry {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	clone := &ToolRegistry{
-		tools: make(map[string]*ToolEntry, len(r.tools)),
+		tools:  make(map[string]*ToolEntry, len(r.tools)),
+		filter: r.filter,
 	}
 	for name, entry := range r.tools {
+		if keep != nil && !keep(name) {
+			continue
+		}
 		clone.tools[name] = &ToolEntry{
 			Tool:   entry.Tool,
 			IsCore: entry.IsCore,
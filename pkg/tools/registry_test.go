@@ -376,6 +376,57 @@ func TestToolRegistry_Clone(t *testing.T) {
 	}
 }
 
+func TestToolRegistry_CloneFiltered(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(newMockTool("read_file", "reads files"))
+	r.Register(newMockTool("exec", "runs commands"))
+	r.RegisterHidden(newMockTool("mcp_tool", "dynamic MCP tool"))
+
+	clone := r.CloneFiltered(func(name string) bool { return name != "exec" })
+	if _, ok := clone.Get("exec"); ok {
+		t.Error("expected filtered clone NOT to have 'exec'")
+	}
+	if _, ok := clone.Get("read_file"); !ok {
+		t.Error("expected filtered clone to have 'read_file'")
+	}
+	clone.PromoteTools([]string{"mcp_tool"}, 1)
+	if _, ok := clone.Get("mcp_tool"); !ok {
+		t.Error("expected filtered clone to keep the hidden tool")
+	}
+	if r.Count() != 3 {
+		t.Errorf("expected parent to keep 3 tools, got %d", r.Count())
+	}
+}
+
+func TestToolRegistry_SetFilter(t *testing.T) {
+	r := NewToolRegistry()
+	r.Register(newMockTool("read_file", "reads files"))
+	r.Register(newMockTool("exec", "runs commands"))
+	before := r.Version()
+
+	r.SetFilter(func(name string) bool { return name != "exec" })
+	if _, ok := r.Get("exec"); ok {
+		t.Error("expected SetFilter to remove 'exec'")
+	}
+	if r.Version() == before {
+		t.Error("expected SetFilter to bump the version")
+	}
+
+	r.Register(newMockTool("exec", "runs commands"))
+	r.RegisterHidden(newMockTool("exec", "runs commands"))
+	if _, ok := r.Get("exec"); ok {
+		t.Error("expected filtered registration to be ignored")
+	}
+	if _, ok := r.Clone().Get("read_file"); !ok {
+		t.Error("expected clone to keep 'read_file'")
+	}
+	clone := r.Clone()
+	clone.Register(newMockTool("exec", "runs commands"))
+	if _, ok := clone.Get("exec"); ok {
+		t.Error("expected clone to inherit the filter")
+	}
+}
+
 func TestToolRegistry_Clone_Empty(t *testing.T) {
 	r := NewToolRegistry()
 	clone := r.Clone()
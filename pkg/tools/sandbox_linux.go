@@ -0,0 +1,485 @@
+//go:build linux
+
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+	"github.com/sipeed/picoclaw/pkg/media"
+)
+
+// The namespaces sandbox re-executes the running binary as the sandbox init
+// process inside new user, mount, PID, IPC and UTS namespaces (and a network
+// namespace in no-network mode). The init process builds a fresh root from
+// bind mounts, applies rlimits and a seccomp filter and then executes the
+// shell. It is recognised by its argv[0] and the spec in sandboxSpecEnv.
+const (
+	sandboxArgv0   = "picoclaw-sandbox"
+	sandboxSpecEnv = "PICOCLAW_EXEC_SANDBOX_SPEC"
+
+	// sandboxInitFailed is the exit code of an init process that could not
+	// set the sandbox up.
+	sandboxInitFailed = 125
+)
+
+// defaultSandboxReadOnlyPaths are the host directories a sandboxed command
+// sees read-only. Missing ones are skipped.
+var defaultSandboxReadOnlyPaths = []string{
+	"/bin", "/etc", "/lib", "/lib32", "/lib64", "/libx32", "/opt", "/sbin", "/usr",
+}
+
+// sandboxEnvKeep are the host environment variables a sandboxed command
+// inherits, besides LC_*. Everything else, such as provider API keys, is
+// dropped.
+var sandboxEnvKeep = []string{"PATH", "LANG", "LANGUAGE", "TERM", "COLORTERM", "TZ"}
+
+func init() {
+	if len(os.Args) > 0 && os.Args[0] == sandboxArgv0 {
+		if spec, ok := os.LookupEnv(sandboxSpecEnv); ok {
+			runSandboxInit(spec)
+		}
+	}
+}
+
+// sandboxSpec is what the init process needs to build the sandbox.
+type sandboxSpec struct {
+	Root         string   `json:"root"` // empty host directory the new root is mounted on
+	Dir          string   `json:"dir"`
+	ReadOnly     []string `json:"read_only"`
+	Writable     []string `json:"writable"`
+	Network      bool     `json:"network"`
+	CPUSeconds   uint64   `json:"cpu_seconds,omitempty"`
+	MemoryBytes  uint64   `json:"memory_bytes,omitempty"`
+	MaxProcesses uint64   `json:"max_processes,omitempty"`
+	Seccomp      bool     `json:"seccomp"`
+}
+
+// namespaceSandbox runs exec commands isolated in Linux namespaces.
+type namespaceSandbox struct {
+	spec sandboxSpec // template; Root and Dir are set per command
+}
+
+var (
+	sandboxProbeOnce sync.Once
+	sandboxProbeErr  error
+)
+
+func newNamespaceSandbox(workspace string, opts config.ExecSandboxConfig) (*namespaceSandbox, error) {
+	spec := sandboxSpec{
+		Network:      !opts.NoNetwork,
+		CPUSeconds:   uint64(max(opts.CPUSeconds, 0)),
+		MemoryBytes:  uint64(max(opts.MemoryMB, 0)) << 20,
+		MaxProcesses: uint64(max(opts.MaxProcesses, 0)),
+	}
+	if _, ok := seccompAuditArch(); ok {
+		spec.Seccomp = true
+	} else {
+		logger.WarnCF("tools", "Exec sandbox has no seccomp filter on this architecture",
+			map[string]any{"arch": runtime.GOARCH})
+	}
+
+	readOnly, err := sandboxPaths(defaultSandboxReadOnlyPaths, opts.ReadOnlyPaths)
+	if err != nil {
+		return nil, err
+	}
+	writable := opts.WritablePaths
+	if workspace != "" {
+		writable = append([]string{workspace}, writable...)
+	}
+	// Attachments live in the media temp dir; commands may need to read them.
+	if err := os.MkdirAll(media.TempDir(), 0o700); err == nil {
+		writable = append(writable, media.TempDir())
+	}
+	if writable, err = sandboxPaths(nil, writable); err != nil {
+		return nil, err
+	}
+	spec.ReadOnly = readOnly
+	spec.Writable = writable
+
+	sandboxProbeOnce.Do(func() {
+		probe := &namespaceSandbox{spec: sandboxSpec{ReadOnly: defaultSandboxReadOnlyPaths, Seccomp: spec.Seccomp}}
+		sandboxProbeErr = probe.probe()
+	})
+	if sandboxProbeErr != nil {
+		return nil, sandboxProbeErr
+	}
+	return &namespaceSandbox{spec: spec}, nil
+}
+
+// sandboxPaths returns base plus extra as clean absolute paths. A path that
+// is a symlink is followed too, so it resolves inside the sandbox.
+func sandboxPaths(base, extra []string) ([]string, error) {
+	paths := slices.Clone(base)
+	for _, p := range extra {
+		if !filepath.IsAbs(p) {
+			abs, err := filepath.Abs(p)
+			if err != nil {
+				return nil, fmt.Errorf("sandbox path %q: %w", p, err)
+			}
+			p = abs
+		}
+		p = filepath.Clean(p)
+		paths = append(paths, p)
+		if resolved, err := filepath.EvalSymlinks(p); err == nil && resolved != p {
+			paths = append(paths, resolved)
+		}
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), nil
+}
+
+// probe checks that the kernel lets this process create the sandbox.
+func (s *namespaceSandbox) probe() error {
+	cmd, cleanup, err := s.command(context.Background(), "true", "/")
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("namespaces sandbox unavailable: %s", msg)
+		}
+		return fmt.Errorf("namespaces sandbox unavailable: %w", err)
+	}
+	return nil
+}
+
+// command returns the command running the shell command in the sandbox with
+// dir as working directory, and a cleanup func to call once it has exited.
+func (s *namespaceSandbox) command(ctx context.Context, command, dir string) (*exec.Cmd, func(), error) {
+	root, err := os.MkdirTemp("", "picoclaw-sandbox-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("sandbox root: %w", err)
+	}
+	cleanup := func() { _ = os.Remove(root) }
+
+	spec := s.spec
+	spec.Root = root
+	spec.Dir = dir
+	data, err := json.Marshal(spec)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("sandbox spec: %w", err)
+	}
+
+	cloneflags := uintptr(unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID |
+		unix.CLONE_NEWIPC | unix.CLONE_NEWUTS)
+	if !spec.Network {
+		cloneflags |= unix.CLONE_NEWNET
+	}
+	cmd := exec.CommandContext(ctx, "/proc/self/exe", "sh", "-c", command)
+	cmd.Args[0] = sandboxArgv0
+	cmd.Env = append(sandboxEnv(os.Environ()), sandboxSpecEnv+"="+string(data))
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: cloneflags,
+		// The command runs as root of its user namespace, which is the
+		// calling user outside of it.
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+	return cmd, cleanup, nil
+}
+
+// sandboxEnv returns the entries of env a sandboxed command may see.
+func sandboxEnv(env []string) []string {
+	var kept []string
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		if strings.HasPrefix(name, "LC_") || slices.Contains(sandboxEnvKeep, name) {
+			kept = append(kept, kv)
+		}
+	}
+	return kept
+}
+
+// runSandboxInit sets the sandbox up and executes the command in os.Args.
+// It never returns.
+func runSandboxInit(data string) {
+	// no_new_privs and the seccomp filter apply to the calling thread, which
+	// must be the one executing the command.
+	runtime.LockOSThread()
+	os.Unsetenv(sandboxSpecEnv)
+
+	fail := func(err error) {
+		fmt.Fprintf(os.Stderr, "sandbox: %v\n", err)
+		os.Exit(sandboxInitFailed)
+	}
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(data), &spec); err != nil {
+		fail(fmt.Errorf("decode spec: %w", err))
+	}
+	if len(os.Args) < 2 {
+		fail(errors.New("no command"))
+	}
+	if err := spec.enter(); err != nil {
+		fail(err)
+	}
+	path, err := exec.LookPath(os.Args[1])
+	if err != nil {
+		fail(err)
+	}
+	// The host's home directory is not mounted.
+	os.Setenv("HOME", "/tmp")
+	env := os.Environ()
+	if err := spec.restrict(); err != nil {
+		fail(err)
+	}
+	fail(syscall.Exec(path, os.Args[1:], env))
+}
+
+// enter builds the sandbox root, switches to it and changes to the working
+// directory.
+func (s *sandboxSpec) enter() error {
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	if err := unix.Mount("tmpfs", s.Root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mount root: %w", err)
+	}
+	if err := mountTmpfs(filepath.Join(s.Root, "tmp"), unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return err
+	}
+	if err := s.mountDev(); err != nil {
+		return err
+	}
+
+	type bind struct {
+		path     string
+		readOnly bool
+	}
+	var binds []bind
+	for _, p := range s.ReadOnly {
+		binds = append(binds, bind{p, true})
+	}
+	for _, p := range s.Writable {
+		binds = append(binds, bind{p, false})
+	}
+	// Parents first, so a writable workspace below a read-only directory
+	// ends up on top of it.
+	slices.SortStableFunc(binds, func(a, b bind) int { return strings.Compare(a.path, b.path) })
+	for _, b := range binds {
+		if err := bindMount(s.Root, b.path, b.readOnly); err != nil {
+			if b.readOnly && errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+	}
+
+	// Mounting proc fails where the host's /proc is itself restricted, as in
+	// some containers; commands then run without it.
+	procDir := filepath.Join(s.Root, "proc")
+	if err := os.MkdirAll(procDir, 0o555); err == nil {
+		_ = unix.Mount("proc", procDir, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "")
+	}
+
+	if err := unix.Chdir(s.Root); err != nil {
+		return fmt.Errorf("chdir to root: %w", err)
+	}
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("detach old root: %w", err)
+	}
+	_ = unix.Sethostname([]byte(sandboxArgv0))
+
+	if !s.Network {
+		// Local servers still work without network access.
+		_ = loopbackUp()
+	}
+
+	dir := s.Dir
+	if dir == "" {
+		dir = "/"
+	}
+	if err := unix.Chdir(dir); err != nil {
+		return fmt.Errorf("working directory %s is not mounted in the sandbox: %w", dir, err)
+	}
+	return nil
+}
+
+// restrict applies the rlimits and the seccomp filter. Everything after it
+// runs with them.
+func (s *sandboxSpec) restrict() error {
+	limits := []struct {
+		resource int
+		value    uint64
+		name     string
+	}{
+		{unix.RLIMIT_CPU, s.CPUSeconds, "cpu"},
+		// RLIMIT_DATA counts memory a process actually maps for data, not
+		// address space reserved up front as Go and JVM runtimes do.
+		{unix.RLIMIT_DATA, s.MemoryBytes, "memory"},
+		{unix.RLIMIT_NPROC, s.MaxProcesses, "processes"},
+	}
+	for _, l := range limits {
+		if l.value == 0 {
+			continue
+		}
+		if err := unix.Setrlimit(l.resource, &unix.Rlimit{Cur: l.value, Max: l.value}); err != nil {
+			return fmt.Errorf("set %s limit: %w", l.name, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	if s.Seccomp {
+		if err := installSeccompFilter(); err != nil {
+			return fmt.Errorf("install seccomp filter: %w", err)
+		}
+	}
+	return nil
+}
+
+// mountDev gives the sandbox a minimal /dev with the harmless devices.
+func (s *sandboxSpec) mountDev() error {
+	dev := filepath.Join(s.Root, "dev")
+	if err := mountTmpfs(dev, unix.MS_NOSUID|unix.MS_NOEXEC, "mode=0755"); err != nil {
+		return err
+	}
+	for _, name := range []string{"null", "zero", "full", "random", "urandom", "tty"} {
+		if err := bindMount(s.Root, "/dev/"+name, false); err != nil && name == "null" {
+			return err
+		}
+	}
+	links := map[string]string{
+		"fd":     "/proc/self/fd",
+		"stdin":  "/proc/self/fd/0",
+		"stdout": "/proc/self/fd/1",
+		"stderr": "/proc/self/fd/2",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(dev, name)); err != nil {
+			return fmt.Errorf("create /dev/%s: %w", name, err)
+		}
+	}
+	return mountTmpfs(filepath.Join(dev, "shm"), unix.MS_NOSUID|unix.MS_NODEV, "mode=1777")
+}
+
+func mountTmpfs(dir string, flags uintptr, data string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("create %s: %w", dir, err)
+	}
+	if err := unix.Mount("tmpfs", dir, "tmpfs", flags, data); err != nil {
+		return fmt.Errorf("mount tmpfs on %s: %w", dir, err)
+	}
+	return nil
+}
+
+// bindMount makes the host path visible at the same path below root. A
+// symlink is recreated instead, so it resolves within the sandbox.
+func bindMount(root, path string, readOnly bool) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(root, path)
+	if info.Mode()&os.ModeSymlink != 0 {
+		if _, err := os.Lstat(target); err == nil {
+			return nil // already visible through a parent mount
+		}
+		link, err := os.Readlink(path)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return fmt.Errorf("create %s: %w", filepath.Dir(target), err)
+		}
+		return os.Symlink(link, target)
+	}
+
+	if info.IsDir() {
+		err = os.MkdirAll(target, 0o755)
+	} else if err = os.MkdirAll(filepath.Dir(target), 0o755); err == nil {
+		var f *os.File
+		if f, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY, 0o644); err == nil {
+			f.Close()
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("create mount point for %s: %w", path, err)
+	}
+	if err := unix.Mount(path, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", path, err)
+	}
+	if !readOnly {
+		return nil
+	}
+	// A remount inside a user namespace must keep the flags the mount was
+	// locked with.
+	var st unix.Statfs_t
+	if err := unix.Statfs(target, &st); err != nil {
+		return fmt.Errorf("statfs %s: %w", path, err)
+	}
+	flags := uintptr(unix.MS_BIND|unix.MS_REMOUNT|unix.MS_RDONLY) | lockedMountFlags(uint64(st.Flags))
+	if err := unix.Mount("", target, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s read-only: %w", path, err)
+	}
+	return nil
+}
+
+// statfs f_flags bits (ST_* in <sys/statvfs.h>).
+const (
+	stNoSuid     = 0x2
+	stNoDev      = 0x4
+	stNoExec     = 0x8
+	stNoAtime    = 0x400
+	stNoDirAtime = 0x800
+	stRelAtime   = 0x1000
+)
+
+func lockedMountFlags(statfsFlags uint64) uintptr {
+	var flags uintptr
+	for st, ms := range map[uint64]uintptr{
+		stNoSuid:     unix.MS_NOSUID,
+		stNoDev:      unix.MS_NODEV,
+		stNoExec:     unix.MS_NOEXEC,
+		stNoAtime:    unix.MS_NOATIME,
+		stNoDirAtime: unix.MS_NODIRATIME,
+		stRelAtime:   unix.MS_RELATIME,
+	} {
+		if statfsFlags&st != 0 {
+			flags |= ms
+		}
+	}
+	return flags
+}
+
+// loopbackUp brings up lo in a fresh network namespace.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
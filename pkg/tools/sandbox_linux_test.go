@@ -0,0 +1,148 @@
+//go:build linux
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newSandboxedExecTool(t *testing.T, workspace string, opts config.ExecSandboxConfig) *ExecTool {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.Sandbox = ExecSandboxNamespaces
+	cfg.Tools.Exec.SandboxOptions = opts
+	tool, err := NewExecToolWithConfig(workspace, true, cfg)
+	if errors.Is(err, ErrExecSandboxUnavailable) {
+		t.Skipf("namespaces sandbox unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatalf("NewExecToolWithConfig() error = %v", err)
+	}
+	return tool
+}
+
+func runSandboxed(t *testing.T, tool *ExecTool, command string) *ToolResult {
+	t.Helper()
+	return tool.Execute(context.Background(), map[string]any{"command": command, "__channel": "cli"})
+}
+
+func TestExecTool_NamespaceSandbox_Filesystem(t *testing.T) {
+	workspace := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tool := newSandboxedExecTool(t, workspace, config.ExecSandboxConfig{})
+
+	result := runSandboxed(t, tool, "echo hi > note.txt && pwd")
+	if result.IsError || strings.TrimSpace(result.ForLLM) != workspace {
+		t.Fatalf("workspace command = %+v", result)
+	}
+	if data, err := os.ReadFile(filepath.Join(workspace, "note.txt")); err != nil || string(data) != "hi\n" {
+		t.Fatalf("workspace write not visible on the host: %q, %v", data, err)
+	}
+
+	result = runSandboxed(t, tool, "cat "+outside)
+	if !result.IsError || !strings.Contains(result.ForLLM, "No such file") {
+		t.Errorf("file outside the workspace readable: %+v", result)
+	}
+	result = runSandboxed(t, tool, "touch /etc/picoclaw-sandbox-test")
+	if !result.IsError || !strings.Contains(result.ForLLM, "Read-only file system") {
+		t.Errorf("/etc writable: %+v", result)
+	}
+}
+
+func TestExecTool_NamespaceSandbox_SkipsDenyPatterns(t *testing.T) {
+	tool := newSandboxedExecTool(t, t.TempDir(), config.ExecSandboxConfig{})
+
+	// kill and heredocs are blocked by the regex guard but harmless here:
+	// the shell is PID 1 of its own PID namespace.
+	result := runSandboxed(t, tool, "cat <<EOF\nhi\nEOF\nkill -0 $$ && echo pid $$")
+	if result.IsError || result.ForLLM != "hi\npid 1\n" {
+		t.Fatalf("result = %+v", result)
+	}
+}
+
+func TestExecTool_NamespaceSandbox_Limits(t *testing.T) {
+	tool := newSandboxedExecTool(t, t.TempDir(), config.ExecSandboxConfig{
+		NoNetwork:  true,
+		CPUSeconds: 7,
+		MemoryMB:   512,
+	})
+
+	result := runSandboxed(t, tool, "ulimit -t; ulimit -d")
+	if result.IsError || result.ForLLM != "7\n524288\n" {
+		t.Errorf("rlimits = %+v", result)
+	}
+
+	if _, err := exec.LookPath("unshare"); err == nil {
+		result = runSandboxed(t, tool, "unshare -r true")
+		if !result.IsError || !strings.Contains(result.ForLLM, "Operation not permitted") {
+			t.Errorf("unshare allowed: %+v", result)
+		}
+	}
+
+	result = runSandboxed(t, tool, "cat /proc/net/dev")
+	if !result.IsError && strings.Count(result.ForLLM, ":") != 1 {
+		t.Errorf("network interfaces besides lo:\n%s", result.ForLLM)
+	}
+}
+
+func TestNewExecToolWithConfig_SandboxUnavailable(t *testing.T) {
+	newNamespaceSandbox("", config.ExecSandboxConfig{}) // run the real probe first
+	saved := sandboxProbeErr
+	sandboxProbeErr = errors.New("user namespaces disabled")
+	t.Cleanup(func() { sandboxProbeErr = saved })
+
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.Sandbox = ExecSandboxNamespaces
+	tool, err := NewExecToolWithConfig(t.TempDir(), true, cfg)
+	if !errors.Is(err, ErrExecSandboxUnavailable) || tool != nil {
+		t.Fatalf("NewExecToolWithConfig() = %v, %v; want ErrExecSandboxUnavailable", tool, err)
+	}
+}
+
+func TestSandboxEnv_DropsSecrets(t *testing.T) {
+	got := sandboxEnv([]string{
+		"PATH=/usr/bin", "LC_ALL=C.UTF-8", "OPENAI_API_KEY=sk-test", "PICOCLAW_CHANNELS_TELEGRAM_TOKEN=t",
+		"HOME=/home/me", "TERM=xterm",
+	})
+	if want := "PATH=/usr/bin,LC_ALL=C.UTF-8,TERM=xterm"; strings.Join(got, ",") != want {
+		t.Fatalf("sandboxEnv() = %q, want %q", got, want)
+	}
+}
+
+func TestExecTool_NamespaceSandbox_Environment(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "sk-test")
+	tool := newSandboxedExecTool(t, t.TempDir(), config.ExecSandboxConfig{})
+
+	result := runSandboxed(t, tool, "env")
+	if result.IsError || strings.Contains(result.ForLLM, "sk-test") || strings.Contains(result.ForLLM, sandboxSpecEnv) {
+		t.Fatalf("sandbox environment = %+v", result)
+	}
+	if !strings.Contains(result.ForLLM, "HOME=/tmp") {
+		t.Errorf("HOME not set to /tmp:\n%s", result.ForLLM)
+	}
+}
+
+func TestSeccompFilter_EndsWithAllow(t *testing.T) {
+	arch, ok := seccompAuditArch()
+	if !ok {
+		t.Skip("no seccomp filter on this architecture")
+	}
+	filter := seccompFilter(arch)
+	if last := filter[len(filter)-1]; last.K != 0x7fff0000 {
+		t.Errorf("last instruction = %+v, want RET ALLOW", last)
+	}
+	if len(filter) > 4096 {
+		t.Errorf("filter has %d instructions, the kernel allows 4096", len(filter))
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+var errSandboxUnsupported = errors.New("the namespaces sandbox is only available on Linux")
+
+// namespaceSandbox is unavailable outside Linux.
+type namespaceSandbox struct{}
+
+func newNamespaceSandbox(string, config.ExecSandboxConfig) (*namespaceSandbox, error) {
+	return nil, errSandboxUnsupported
+}
+
+func (s *namespaceSandbox) command(context.Context, string, string) (*exec.Cmd, func(), error) {
+	return nil, nil, errSandboxUnsupported
+}
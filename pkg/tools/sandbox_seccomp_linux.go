@@ -0,0 +1,151 @@
+//go:build linux
+
+package tools
+
+import (
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/cpu"
+	"golang.org/x/sys/unix"
+)
+
+// seccompDeniedSyscalls fail with EPERM in the sandbox. None of them is
+// needed to run ordinary programs; they would let a command reshape or leave
+// the sandbox, inspect other processes or reach into the kernel.
+var seccompDeniedSyscalls = []uint32{
+	unix.SYS_ACCT,
+	unix.SYS_ADD_KEY,
+	unix.SYS_ADJTIMEX,
+	unix.SYS_BPF,
+	unix.SYS_CHROOT,
+	unix.SYS_CLOCK_SETTIME,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_FSCONFIG,
+	unix.SYS_FSMOUNT,
+	unix.SYS_FSOPEN,
+	unix.SYS_FSPICK,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_KEYCTL,
+	unix.SYS_MOUNT,
+	unix.SYS_MOVE_MOUNT,
+	unix.SYS_NAME_TO_HANDLE_AT,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_OPEN_TREE,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_PTRACE,
+	unix.SYS_QUOTACTL,
+	unix.SYS_REBOOT,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_SETNS,
+	unix.SYS_SETTIMEOFDAY,
+	unix.SYS_SWAPOFF,
+	unix.SYS_SWAPON,
+	unix.SYS_SYSLOG,
+	unix.SYS_UMOUNT2,
+	unix.SYS_UNSHARE,
+	unix.SYS_USERFAULTFD,
+}
+
+// seccompNamespaceFlags are the clone flags that create namespaces.
+const seccompNamespaceFlags = unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID |
+	unix.CLONE_NEWNET | unix.CLONE_NEWUTS | unix.CLONE_NEWIPC | unix.CLONE_NEWCGROUP
+
+// seccomp_data field offsets.
+const (
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+)
+
+// seccompAuditArch returns the audit architecture the filter checks for, and
+// false where clone's flags are not its first argument or the architecture is
+// not known.
+func seccompAuditArch() (uint32, bool) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, true
+	case "386":
+		return unix.AUDIT_ARCH_I386, true
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, true
+	case "arm":
+		return unix.AUDIT_ARCH_ARM, true
+	case "riscv64":
+		return unix.AUDIT_ARCH_RISCV64, true
+	case "loong64":
+		return unix.AUDIT_ARCH_LOONGARCH64, true
+	case "mipsle":
+		return unix.AUDIT_ARCH_MIPSEL, true
+	}
+	return 0, false
+}
+
+// seccompFilter builds the BPF program: syscalls of another architecture
+// kill the process, denied syscalls and clone with namespace flags fail with
+// EPERM, and clone3 fails with ENOSYS so libc falls back to clone, whose
+// flags the filter can inspect.
+func seccompFilter(arch uint32) []unix.SockFilter {
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+	const (
+		load  = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jeq   = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jge   = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		jset  = unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K
+		ret   = unix.BPF_RET | unix.BPF_K
+		eperm = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+	)
+
+	filter := []unix.SockFilter{
+		stmt(load, seccompDataArch),
+		jump(jeq, arch, 1, 0),
+		stmt(ret, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(load, seccompDataNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		// x32 syscalls share the x86_64 audit arch.
+		filter = append(filter,
+			jump(jge, 0x40000000, 0, 1),
+			stmt(ret, eperm))
+	}
+	for _, nr := range seccompDeniedSyscalls {
+		filter = append(filter,
+			jump(jeq, nr, 0, 1),
+			stmt(ret, eperm))
+	}
+	arg0 := uint32(seccompDataArg0)
+	if cpu.IsBigEndian {
+		arg0 += 4 // low half of the 64-bit argument
+	}
+	return append(filter,
+		jump(jeq, unix.SYS_CLONE3, 0, 1),
+		stmt(ret, unix.SECCOMP_RET_ERRNO|uint32(unix.ENOSYS)),
+		jump(jeq, unix.SYS_CLONE, 0, 3),
+		stmt(load, arg0),
+		jump(jset, seccompNamespaceFlags, 0, 1),
+		stmt(ret, eperm),
+		stmt(ret, unix.SECCOMP_RET_ALLOW),
+	)
+}
+
+// installSeccompFilter installs the filter on the calling thread. The
+// caller must have set no_new_privs.
+func installSeccompFilter() error {
+	arch, ok := seccompAuditArch()
+	if !ok {
+		return nil
+	}
+	filter := seccompFilter(arch)
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	return unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0)
+}
@@ -0,0 +1,663 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultSearchLimit = 100
+	maxSearchLimit     = 1000
+	maxSearchContext   = 20
+	// maxSearchEntries bounds how many files and directories one search visits.
+	maxSearchEntries = 50000
+	// maxGrepFileSize skips files that are too large to be source code.
+	maxGrepFileSize   = 4 * 1024 * 1024
+	maxGrepLineLength = 300
+	binarySniffLength = 8000
+)
+
+// searchFileTypes maps the grep "type" argument to file extensions.
+var searchFileTypes = map[string][]string{
+	"c":      {".c", ".h"},
+	"cpp":    {".cpp", ".cc", ".cxx", ".hpp", ".hh", ".hxx", ".h"},
+	"cs":     {".cs"},
+	"css":    {".css", ".scss", ".sass", ".less"},
+	"go":     {".go"},
+	"html":   {".html", ".htm"},
+	"java":   {".java"},
+	"js":     {".js", ".jsx", ".mjs", ".cjs"},
+	"json":   {".json"},
+	"kotlin": {".kt", ".kts"},
+	"lua":    {".lua"},
+	"md":     {".md", ".markdown"},
+	"php":    {".php"},
+	"proto":  {".proto"},
+	"py":     {".py", ".pyi"},
+	"rb":     {".rb"},
+	"rust":   {".rs"},
+	"sh":     {".sh", ".bash", ".zsh"},
+	"sql":    {".sql"},
+	"swift":  {".swift"},
+	"toml":   {".toml"},
+	"ts":     {".ts", ".tsx", ".mts", ".cts"},
+	"txt":    {".txt"},
+	"yaml":   {".yaml", ".yml"},
+}
+
+// searchFile is a file found by searchWalker.
+type searchFile struct {
+	path    string // absolute path, passed to the fileSystem
+	display string // workspace-relative path when inside the workspace, absolute otherwise
+	rel     string // slash-separated path relative to the search root, for glob matching
+	entry   os.DirEntry
+}
+
+// searchWalker lists the files below a directory through a fileSystem, so
+// grep and glob see exactly what read_file and list_dir may see. It skips
+// .git, hidden entries unless asked for, and whatever .gitignore files ignore.
+type searchWalker struct {
+	fs        fileSystem
+	workspace string
+	hidden    bool
+	noIgnore  bool
+
+	visited   int
+	truncated bool
+}
+
+// walk calls fn for each file below root, in lexical order, until fn
+// returns false. root may also be a single file.
+func (w *searchWalker) walk(ctx context.Context, root string, fn func(searchFile) bool) error {
+	root = w.resolve(root)
+	top := root
+	if w.workspace != "" && isWithinWorkspace(root, w.workspace) {
+		top = filepath.Clean(w.workspace)
+	}
+	rootRel := ""
+	if root != top {
+		rel, err := filepath.Rel(top, root)
+		if err != nil {
+			return err
+		}
+		rootRel = filepath.ToSlash(rel)
+	}
+
+	f, err := w.fs.Open(root)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	f.Close()
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		fn(searchFile{
+			path:    root,
+			display: w.display(top, rootRel),
+			rel:     filepath.Base(root),
+			entry:   fs.FileInfoToDirEntry(info),
+		})
+		return nil
+	}
+
+	// .gitignore files between the workspace and the search root apply too.
+	var rules ignoreRules
+	if !w.noIgnore && rootRel != "" {
+		dir, rel := top, ""
+		for _, name := range strings.Split(rootRel, "/") {
+			rules = w.loadIgnore(dir, rel, rules)
+			dir, rel = filepath.Join(dir, name), path.Join(rel, name)
+		}
+	}
+
+	_, err = w.walkDir(ctx, top, root, rootRel, rootRel, rules, fn)
+	return err
+}
+
+func (w *searchWalker) walkDir(
+	ctx context.Context,
+	top, dir, rel, rootRel string,
+	rules ignoreRules,
+	fn func(searchFile) bool,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	entries, err := w.fs.ReadDir(dir)
+	if err != nil {
+		if rel == rootRel {
+			return false, err
+		}
+		return true, nil // unreadable subdirectory: skip it
+	}
+	if !w.noIgnore {
+		rules = w.loadIgnore(dir, rel, rules)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == ".git" || (!w.hidden && strings.HasPrefix(name, ".")) {
+			continue
+		}
+		// Symlinks are reported as files and never followed as directories,
+		// which keeps walks finite.
+		isDir := entry.IsDir()
+		childRel := path.Join(rel, name)
+		if !w.noIgnore && rules.ignored(childRel, isDir) {
+			continue
+		}
+
+		w.visited++
+		if w.visited > maxSearchEntries {
+			w.truncated = true
+			return false, nil
+		}
+
+		childPath := filepath.Join(dir, name)
+		if isDir {
+			cont, err := w.walkDir(ctx, top, childPath, childRel, rootRel, rules, fn)
+			if !cont || err != nil {
+				return false, err
+			}
+			continue
+		}
+		matchRel := childRel
+		if rootRel != "" {
+			matchRel = strings.TrimPrefix(childRel, rootRel+"/")
+		}
+		if !fn(searchFile{path: childPath, display: w.display(top, childRel), rel: matchRel, entry: entry}) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// loadIgnore appends the rules of dir's .gitignore, if any. The result never
+// shares its tail with rules, so sibling directories do not see each other's
+// rules.
+func (w *searchWalker) loadIgnore(dir, rel string, rules ignoreRules) ignoreRules {
+	data, err := w.fs.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return rules
+	}
+	return append(slices.Clip(rules), parseGitignore(rel, data)...)
+}
+
+func (w *searchWalker) resolve(p string) string {
+	if p == "" {
+		p = "."
+	}
+	if !filepath.IsAbs(p) && w.workspace != "" {
+		p = filepath.Join(w.workspace, p)
+	}
+	return filepath.Clean(p)
+}
+
+func (w *searchWalker) display(top, rel string) string {
+	if top == filepath.Clean(w.workspace) {
+		if rel == "" {
+			return "."
+		}
+		return rel
+	}
+	return filepath.Join(top, filepath.FromSlash(rel))
+}
+
+// searchPaging reads the limit and offset arguments shared by grep and glob.
+func searchPaging(args map[string]any) (limit, offset int, err error) {
+	l, err := getInt64Arg(args, "limit", defaultSearchLimit)
+	if err != nil {
+		return 0, 0, err
+	}
+	o, err := getInt64Arg(args, "offset", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	if l <= 0 {
+		l = defaultSearchLimit
+	}
+	return int(min(l, maxSearchLimit)), int(max(o, 0)), nil
+}
+
+func searchWalkerArgs(args map[string]any) (hidden, noIgnore bool) {
+	hidden, _ = args["hidden"].(bool)
+	noIgnore, _ = args["no_ignore"].(bool)
+	return hidden, noIgnore
+}
+
+var searchCommonParameters = map[string]any{
+	"limit": map[string]any{
+		"type":        "integer",
+		"description": fmt.Sprintf("Maximum number of results to return (default %d, max %d).", defaultSearchLimit, maxSearchLimit),
+	},
+	"offset": map[string]any{
+		"type":        "integer",
+		"description": "Number of results to skip, for paging through long result lists.",
+	},
+	"hidden": map[string]any{
+		"type":        "boolean",
+		"description": "Include files and directories whose name starts with a dot. .git is always skipped.",
+	},
+	"no_ignore": map[string]any{
+		"type":        "boolean",
+		"description": "Do not skip files matched by .gitignore.",
+	},
+}
+
+func searchParameters(properties map[string]any, required ...string) map[string]any {
+	for name, schema := range searchCommonParameters {
+		properties[name] = schema
+	}
+	return map[string]any{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// searchFooter describes truncation so the model knows how to page on.
+func searchFooter(offset, shown int, more, truncated bool) string {
+	var notes []string
+	if more {
+		notes = append(notes, fmt.Sprintf("[Showing results %d-%d. More results available; use offset=%d to continue.]",
+			offset+1, offset+shown, offset+shown))
+	}
+	if truncated {
+		notes = append(notes, fmt.Sprintf("[Search stopped after %d entries; narrow the path or pattern.]", maxSearchEntries))
+	}
+	if len(notes) == 0 {
+		return ""
+	}
+	return "\n\n" + strings.Join(notes, "\n")
+}
+
+// GlobTool finds files by name pattern.
+type GlobTool struct {
+	fs        fileSystem
+	workspace string
+}
+
+func NewGlobTool(workspace string, restrict bool, allowPaths ...[]*regexp.Regexp) *GlobTool {
+	var patterns []*regexp.Regexp
+	if len(allowPaths) > 0 {
+		patterns = allowPaths[0]
+	}
+	return &GlobTool{fs: buildFs(workspace, restrict, patterns), workspace: workspace}
+}
+
+func (t *GlobTool) Name() string {
+	return "glob"
+}
+
+// ConcurrencySafe reports true: glob only reads.
+func (t *GlobTool) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *GlobTool) Description() string {
+	return "Find files by name pattern, e.g. `**/*.go` or `src/**/*.{ts,tsx}`. " +
+		"Skips .git, hidden files and anything ignored by .gitignore. Results are sorted by path and paged with `limit` and `offset`."
+}
+
+func (t *GlobTool) Parameters() map[string]any {
+	return searchParameters(map[string]any{
+		"pattern": map[string]any{
+			"type": "string",
+			"description": "Glob matched against paths relative to `path`. `*` and `?` stay within a directory, `**` spans directories, " +
+				"`{a,b}` gives alternatives. A pattern without `/` matches file names at any depth.",
+		},
+		"path": map[string]any{
+			"type":        "string",
+			"description": "Directory to search in (default: the workspace).",
+		},
+	}, "pattern")
+}
+
+func (t *GlobTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	pattern, _ := args["pattern"].(string)
+	if strings.TrimSpace(pattern) == "" {
+		return ErrorResult("pattern is required")
+	}
+	glob, err := compilePathGlob(pattern)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("invalid pattern: %v", err))
+	}
+	limit, offset, err := searchPaging(args)
+	if err != nil {
+		return ErrorResult(err.Error())
+	}
+	root, _ := args["path"].(string)
+	hidden, noIgnore := searchWalkerArgs(args)
+
+	walker := &searchWalker{fs: t.fs, workspace: t.workspace, hidden: hidden, noIgnore: noIgnore}
+	var matches []string
+	more := false
+	err = walker.walk(ctx, root, func(f searchFile) bool {
+		if !glob.match(f.rel) {
+			return true
+		}
+		if len(matches) == offset+limit {
+			more = true
+			return false
+		}
+		matches = append(matches, f.display)
+		return true
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("glob failed: %v", err)).WithError(err)
+	}
+
+	if len(matches) <= offset {
+		if offset > 0 && len(matches) > 0 {
+			return NewToolResult(fmt.Sprintf("No files matched %q beyond offset %d (%d in total).", pattern, offset, len(matches)))
+		}
+		return NewToolResult(fmt.Sprintf("No files matched %q.", pattern) + searchFooter(0, 0, false, walker.truncated))
+	}
+	page := matches[offset:]
+	return NewToolResult(strings.Join(page, "\n") + searchFooter(offset, len(page), more, walker.truncated))
+}
+
+// GrepTool searches file contents with a regular expression.
+type GrepTool struct {
+	fs        fileSystem
+	workspace string
+}
+
+func NewGrepTool(workspace string, restrict bool, allowPaths ...[]*regexp.Regexp) *GrepTool {
+	var patterns []*regexp.Regexp
+	if len(allowPaths) > 0 {
+		patterns = allowPaths[0]
+	}
+	return &GrepTool{fs: buildFs(workspace, restrict, patterns), workspace: workspace}
+}
+
+func (t *GrepTool) Name() string {
+	return "grep"
+}
+
+// ConcurrencySafe reports true: grep only reads.
+func (t *GrepTool) ConcurrencySafe() bool {
+	return true
+}
+
+func (t *GrepTool) Description() string {
+	return "Search file contents with a regular expression (RE2 syntax). Shows matching lines as path:line:text " +
+		"with optional context lines, or only file names or counts. Skips .git, hidden, binary and .gitignore'd files. " +
+		"Narrow the search with `glob` or `type`; page with `limit` and `offset`."
+}
+
+func (t *GrepTool) Parameters() map[string]any {
+	types := make([]string, 0, len(searchFileTypes))
+	for name := range searchFileTypes {
+		types = append(types, name)
+	}
+	slices.Sort(types)
+
+	return searchParameters(map[string]any{
+		"pattern": map[string]any{
+			"type":        "string",
+			"description": "Regular expression to search for (RE2 syntax, matched per line).",
+		},
+		"path": map[string]any{
+			"type":        "string",
+			"description": "File or directory to search in (default: the workspace).",
+		},
+		"glob": map[string]any{
+			"type":        "string",
+			"description": "Only search files matching this glob, e.g. `*.go` or `cmd/**/*.{js,ts}`.",
+		},
+		"type": map[string]any{
+			"type":        "string",
+			"description": "Only search files of this type.",
+			"enum":        types,
+		},
+		"ignore_case": map[string]any{
+			"type":        "boolean",
+			"description": "Match case-insensitively.",
+		},
+		"fixed_strings": map[string]any{
+			"type":        "boolean",
+			"description": "Treat pattern as a literal string instead of a regular expression.",
+		},
+		"context": map[string]any{
+			"type":        "integer",
+			"description": fmt.Sprintf("Lines of context before and after each match (max %d).", maxSearchContext),
+		},
+		"before": map[string]any{
+			"type":        "integer",
+			"description": "Lines of context before each match; overrides context.",
+		},
+		"after": map[string]any{
+			"type":        "integer",
+			"description": "Lines of context after each match; overrides context.",
+		},
+		"output_mode": map[string]any{
+			"type": "string",
+			"description": "content: matching lines (default; limit counts matches). files: paths of matching files. " +
+				"count: matches per file. For files and count, limit counts files.",
+			"enum": []string{"content", "files", "count"},
+		},
+	}, "pattern")
+}
+
+type grepOptions struct {
+	re            *regexp.Regexp
+	glob          *pathGlob
+	exts          []string
+	before, after int
+	mode          string
+	limit, offset int
+}
+
+func (t *GrepTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	opts, errResult := parseGrepOptions(args)
+	if errResult != nil {
+		return errResult
+	}
+	root, _ := args["path"].(string)
+	hidden, noIgnore := searchWalkerArgs(args)
+	walker := &searchWalker{fs: t.fs, workspace: t.workspace, hidden: hidden, noIgnore: noIgnore}
+
+	var (
+		out       strings.Builder
+		results   int // matches (content) or files (files, count) seen so far
+		more      bool
+		skipped   int
+		readError error
+	)
+	pageEnd := opts.offset + opts.limit
+	err := walker.walk(ctx, root, func(f searchFile) bool {
+		if opts.glob != nil && !opts.glob.match(f.rel) {
+			return true
+		}
+		if len(opts.exts) > 0 && !slices.Contains(opts.exts, strings.ToLower(path.Ext(f.rel))) {
+			return true
+		}
+		if info, err := f.entry.Info(); err == nil && info.Size() > maxGrepFileSize {
+			skipped++
+			return true
+		}
+		data, err := t.fs.ReadFile(f.path)
+		if err != nil {
+			readError = err
+			return true
+		}
+		if bytes.IndexByte(data[:min(len(data), binarySniffLength)], 0) >= 0 {
+			return true
+		}
+
+		lines := strings.Split(string(data), "\n")
+		if len(lines) > 0 && lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		var hits []int
+		for i, line := range lines {
+			if opts.re.MatchString(strings.TrimSuffix(line, "\r")) {
+				hits = append(hits, i)
+			}
+		}
+		if len(hits) == 0 {
+			return true
+		}
+
+		if opts.mode != "content" {
+			results++
+			if results <= opts.offset {
+				return true
+			}
+			if results > pageEnd {
+				more = true
+				return false
+			}
+			if opts.mode == "count" {
+				fmt.Fprintf(&out, "%s:%d\n", f.display, len(hits))
+			} else {
+				out.WriteString(f.display + "\n")
+			}
+			return true
+		}
+
+		// Keep the matches that fall into the requested page.
+		first := max(opts.offset-results, 0)
+		last := min(len(hits), pageEnd-results)
+		results += len(hits)
+		if first < last {
+			writeGrepMatches(&out, f.display, lines, hits[first:last], opts.before, opts.after)
+		}
+		if results > pageEnd {
+			more = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("grep failed: %v", err)).WithError(err)
+	}
+
+	if out.Len() == 0 {
+		msg := fmt.Sprintf("No matches found for %q.", args["pattern"])
+		if results > 0 {
+			msg = fmt.Sprintf("No matches for %q beyond offset %d (%d in total).", args["pattern"], opts.offset, results)
+		} else if readError != nil {
+			msg += fmt.Sprintf(" Some files could not be read: %v", readError)
+		}
+		return NewToolResult(msg + searchFooter(0, 0, false, walker.truncated))
+	}
+	result := strings.TrimSuffix(out.String(), "\n")
+	shown := min(results, pageEnd) - opts.offset
+	result += searchFooter(opts.offset, shown, more, walker.truncated)
+	if skipped > 0 {
+		result += fmt.Sprintf("\n[%d file(s) larger than %d MB were not searched.]", skipped, maxGrepFileSize/(1024*1024))
+	}
+	return NewToolResult(result)
+}
+
+func parseGrepOptions(args map[string]any) (*grepOptions, *ToolResult) {
+	pattern, _ := args["pattern"].(string)
+	if pattern == "" {
+		return nil, ErrorResult("pattern is required")
+	}
+	if fixed, _ := args["fixed_strings"].(bool); fixed {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if ignoreCase, _ := args["ignore_case"].(bool); ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, ErrorResult(fmt.Sprintf("invalid pattern: %v", err))
+	}
+	opts := &grepOptions{re: re, mode: "content"}
+
+	if g, _ := args["glob"].(string); strings.TrimSpace(g) != "" {
+		if opts.glob, err = compilePathGlob(g); err != nil {
+			return nil, ErrorResult(fmt.Sprintf("invalid glob: %v", err))
+		}
+	}
+	if typ, _ := args["type"].(string); typ != "" {
+		exts, ok := searchFileTypes[strings.ToLower(typ)]
+		if !ok {
+			return nil, ErrorResult(fmt.Sprintf("unknown file type %q", typ))
+		}
+		opts.exts = exts
+	}
+	if mode, _ := args["output_mode"].(string); mode != "" {
+		if mode != "content" && mode != "files" && mode != "count" {
+			return nil, ErrorResult(fmt.Sprintf("unknown output_mode %q (expected content, files or count)", mode))
+		}
+		opts.mode = mode
+	}
+
+	contextLines, err := getInt64Arg(args, "context", 0)
+	if err != nil {
+		return nil, ErrorResult(err.Error())
+	}
+	before, err := getInt64Arg(args, "before", contextLines)
+	if err != nil {
+		return nil, ErrorResult(err.Error())
+	}
+	after, err := getInt64Arg(args, "after", contextLines)
+	if err != nil {
+		return nil, ErrorResult(err.Error())
+	}
+	opts.before = int(min(max(before, 0), maxSearchContext))
+	opts.after = int(min(max(after, 0), maxSearchContext))
+
+	if opts.limit, opts.offset, err = searchPaging(args); err != nil {
+		return nil, ErrorResult(err.Error())
+	}
+	return opts, nil
+}
+
+// writeGrepMatches writes matching lines as "path:N:text" and context lines
+// as "path-N-text", with "--" between groups that are not adjacent, like
+// grep and ripgrep do.
+func writeGrepMatches(out *strings.Builder, name string, lines []string, hits []int, before, after int) {
+	isHit := make(map[int]bool, len(hits))
+	var shown []int
+	for _, hit := range hits {
+		isHit[hit] = true
+		for i := max(hit-before, 0); i <= min(hit+after, len(lines)-1); i++ {
+			if len(shown) == 0 || i > shown[len(shown)-1] {
+				shown = append(shown, i)
+			}
+		}
+	}
+	withContext := before > 0 || after > 0
+	if withContext && out.Len() > 0 {
+		out.WriteString("--\n")
+	}
+	for n, i := range shown {
+		if withContext && n > 0 && i > shown[n-1]+1 {
+			out.WriteString("--\n")
+		}
+		sep := "-"
+		if isHit[i] {
+			sep = ":"
+		}
+		fmt.Fprintf(out, "%s%s%d%s%s\n", name, sep, i+1, sep, truncateGrepLine(lines[i]))
+	}
+}
+
+func truncateGrepLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	if len(line) <= maxGrepLineLength {
+		return line
+	}
+	cut := maxGrepLineLength
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + " [...]"
+}
@@ -0,0 +1,217 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func searchTestWorkspace(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		".gitignore":           "build/\n*.log\n!keep.log\n/root-only.txt\n",
+		"main.go":              "package main\n\nfunc main() {\n\tHandleRequest()\n}\n",
+		"pkg/handler.go":       "package pkg\n\n// HandleRequest serves one request.\nfunc HandleRequest() {}\n",
+		"pkg/handler_test.go":  "package pkg\n\nfunc TestHandleRequest() {}\n",
+		"pkg/.gitignore":       "generated.go\n",
+		"pkg/generated.go":     "package pkg\n\nfunc HandleRequestGenerated() {}\n",
+		"pkg/root-only.txt":    "HandleRequest in a nested dir\n",
+		"root-only.txt":        "HandleRequest at the root\n",
+		"build/out.go":         "package build // HandleRequest\n",
+		"debug.log":            "HandleRequest failed\n",
+		"keep.log":             "HandleRequest kept\n",
+		".hidden/notes.md":     "HandleRequest notes\n",
+		".git/config":          "HandleRequest\n",
+		"web/app.ts":           "export function handleRequest() {}\n",
+		"web/bin.dat":          "HandleRequest\x00\x01",
+		"docs/guide.md":        "# Guide\n\nCall HandleRequest.\n",
+		"docs/nested/deep.txt": "nothing here\n",
+	})
+	return dir
+}
+
+func TestGlobTool_MatchesAndIgnores(t *testing.T) {
+	dir := searchTestWorkspace(t)
+	tool := NewGlobTool(dir, true)
+
+	tests := []struct {
+		args map[string]any
+		want []string
+	}{
+		{map[string]any{"pattern": "*.go"}, []string{"main.go", "pkg/handler.go", "pkg/handler_test.go"}},
+		{map[string]any{"pattern": "pkg/*.go"}, []string{"pkg/handler.go", "pkg/handler_test.go"}},
+		{map[string]any{"pattern": "**/*.{md,ts}"}, []string{"docs/guide.md", "web/app.ts"}},
+		{map[string]any{"pattern": "*.go", "path": "pkg"}, []string{"pkg/handler.go", "pkg/handler_test.go"}},
+		{map[string]any{"pattern": "*.txt"}, []string{"docs/nested/deep.txt", "pkg/root-only.txt"}},
+		{map[string]any{"pattern": "*.log"}, []string{"keep.log"}},
+		{map[string]any{"pattern": "*.md", "hidden": true}, []string{".hidden/notes.md", "docs/guide.md"}},
+		{
+			map[string]any{"pattern": "*.go", "no_ignore": true},
+			[]string{"build/out.go", "main.go", "pkg/generated.go", "pkg/handler.go", "pkg/handler_test.go"},
+		},
+	}
+	for _, tt := range tests {
+		result := tool.Execute(context.Background(), tt.args)
+		if result.IsError {
+			t.Fatalf("glob %v failed: %s", tt.args, result.ForLLM)
+		}
+		got := strings.Split(result.ForLLM, "\n")
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("glob %v = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestGlobTool_Paging(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := range 5 {
+		files[fmt.Sprintf("f%d.txt", i)] = "x\n"
+	}
+	writeTestFiles(t, dir, files)
+	tool := NewGlobTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{"pattern": "*.txt", "limit": 2.0, "offset": 2.0})
+	if !strings.HasPrefix(result.ForLLM, "f2.txt\nf3.txt\n") || !strings.Contains(result.ForLLM, "use offset=4") {
+		t.Errorf("unexpected page: %s", result.ForLLM)
+	}
+	result = tool.Execute(context.Background(), map[string]any{"pattern": "*.txt", "limit": 2.0, "offset": 4.0})
+	if result.ForLLM != "f4.txt" {
+		t.Errorf("last page = %q, want %q", result.ForLLM, "f4.txt")
+	}
+}
+
+func TestGrepTool_Content(t *testing.T) {
+	dir := searchTestWorkspace(t)
+	tool := NewGrepTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{"pattern": `\bHandleRequest\(`})
+	if result.IsError {
+		t.Fatalf("grep failed: %s", result.ForLLM)
+	}
+	want := "main.go:4:\tHandleRequest()\npkg/handler.go:4:func HandleRequest() {}"
+	if result.ForLLM != want {
+		t.Errorf("grep = %q, want %q", result.ForLLM, want)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{
+		"pattern": "handlerequest", "ignore_case": true, "type": "go", "context": 1.0, "path": "pkg",
+	})
+	want = "pkg/handler.go-2-\npkg/handler.go:3:// HandleRequest serves one request.\npkg/handler.go:4:func HandleRequest() {}\n" +
+		"--\npkg/handler_test.go-2-\npkg/handler_test.go:3:func TestHandleRequest() {}"
+	if result.ForLLM != want {
+		t.Errorf("grep with context = %q, want %q", result.ForLLM, want)
+	}
+}
+
+func TestGrepTool_OutputModesAndFilters(t *testing.T) {
+	dir := searchTestWorkspace(t)
+	tool := NewGrepTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{"pattern": "HandleRequest", "output_mode": "files"})
+	want := "docs/guide.md\nkeep.log\nmain.go\npkg/handler.go\npkg/handler_test.go\npkg/root-only.txt"
+	if result.ForLLM != want {
+		t.Errorf("files = %q, want %q", result.ForLLM, want)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{
+		"pattern": "Handle", "output_mode": "count", "glob": "*.go", "no_ignore": true,
+	})
+	want = "build/out.go:1\nmain.go:1\npkg/generated.go:1\npkg/handler.go:2\npkg/handler_test.go:1"
+	if result.ForLLM != want {
+		t.Errorf("count = %q, want %q", result.ForLLM, want)
+	}
+
+	result = tool.Execute(context.Background(), map[string]any{"pattern": "a.b", "fixed_strings": true})
+	if !strings.HasPrefix(result.ForLLM, "No matches found") {
+		t.Errorf("fixed string should not match as a regex: %s", result.ForLLM)
+	}
+
+	for _, args := range []map[string]any{
+		{"pattern": "("},
+		{"pattern": "x", "type": "cobol"},
+		{"pattern": "x", "output_mode": "lines"},
+	} {
+		if result := tool.Execute(context.Background(), args); !result.IsError {
+			t.Errorf("grep %v should fail, got: %s", args, result.ForLLM)
+		}
+	}
+}
+
+func TestGrepTool_Paging(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"a.txt": "hit 1\nhit 2\nmiss\nhit 3\n",
+		"b.txt": "hit 4\nhit 5\n",
+	})
+	tool := NewGrepTool(dir, true)
+
+	result := tool.Execute(context.Background(), map[string]any{"pattern": "hit", "limit": 2.0, "offset": 2.0})
+	if !strings.HasPrefix(result.ForLLM, "a.txt:4:hit 3\nb.txt:1:hit 4\n") ||
+		!strings.Contains(result.ForLLM, "Showing results 3-4") || !strings.Contains(result.ForLLM, "use offset=4") {
+		t.Errorf("unexpected page: %s", result.ForLLM)
+	}
+	result = tool.Execute(context.Background(), map[string]any{"pattern": "hit", "limit": 2.0, "offset": 4.0})
+	if result.ForLLM != "b.txt:2:hit 5" {
+		t.Errorf("last page = %q", result.ForLLM)
+	}
+}
+
+func TestSearchTools_RestrictedToWorkspace(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "workspace")
+	writeTestFiles(t, parent, map[string]string{
+		"workspace/in.txt": "secret-in\n",
+		"outside.txt":      "secret-out\n",
+		"allowed/ok.txt":   "secret-allowed\n",
+	})
+
+	grep := NewGrepTool(dir, true)
+	if result := grep.Execute(context.Background(), map[string]any{"pattern": "secret", "path": ".."}); !result.IsError {
+		t.Errorf("grep outside the workspace should fail, got: %s", result.ForLLM)
+	}
+	if result := NewGlobTool(dir, true).Execute(
+		context.Background(), map[string]any{"pattern": "*", "path": parent},
+	); !result.IsError {
+		t.Errorf("glob outside the workspace should fail, got: %s", result.ForLLM)
+	}
+
+	allowed := filepath.Join(parent, "allowed")
+	grep = NewGrepTool(dir, true, []*regexp.Regexp{regexp.MustCompile("^" + regexp.QuoteMeta(allowed))})
+	result := grep.Execute(context.Background(), map[string]any{"pattern": "secret", "path": allowed})
+	if want := filepath.Join(allowed, "ok.txt") + ":1:secret-allowed"; result.ForLLM != want {
+		t.Errorf("grep in allowed path = %q, want %q", result.ForLLM, want)
+	}
+}
+
+func TestIgnoreRules(t *testing.T) {
+	rules := parseGitignore("", []byte("# comment\n*.o\n/dist\ndocs/**/draft.md\ntmp/\n!important.o\n"))
+	rules = append(rules, parseGitignore("sub", []byte("local.txt\n"))...)
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"a.o", false, true},
+		{"src/b.o", false, true},
+		{"important.o", false, false},
+		{"dist", true, true},
+		{"src/dist", true, false},
+		{"docs/draft.md", false, true},
+		{"docs/a/b/draft.md", false, true},
+		{"tmp", true, true},
+		{"tmp", false, false},
+		{"sub/local.txt", false, true},
+		{"local.txt", false, false},
+	}
+	for _, tt := range tests {
+		if got := rules.ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("ignored(%q, dir=%v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
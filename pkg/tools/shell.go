@@ -17,6 +17,17 @@ import (
 	"github.com/sipeed/picoclaw/pkg/constants"
 )
 
+// Exec sandbox modes (tools.exec.sandbox).
+const (
+	ExecSandboxNone       = "none"
+	ExecSandboxNamespaces = "namespaces"
+)
+
+// ErrExecSandboxUnavailable is returned when the configured sandbox cannot
+// be created on this host. Commands are then refused rather than run on the
+// host with only the deny patterns.
+var ErrExecSandboxUnavailable = errors.New("exec sandbox unavailable")
+
 type ExecTool struct {
 	workingDir          string
 	timeout             time.Duration
@@ -26,8 +37,13 @@ type ExecTool struct {
 	allowedPathPatterns []*regexp.Regexp
 	restrictToWorkspace bool
 	allowRemote         bool
+	sandbox             *namespaceSandbox // nil runs commands on the host, guarded by the deny patterns
+	jobs                *execJobs         // nil when background jobs are disabled
 }
 
+// Compile-time check: ExecTool implements AsyncExecutor for background jobs.
+var _ AsyncExecutor = (*ExecTool)(nil)
+
 var (
 	defaultDenyPatterns = []*regexp.Regexp{
 		regexp.MustCompile(`\brm\s+-[rf]{1,2}\b`),
@@ -150,6 +166,35 @@ func NewExecToolWithConfig(
 		timeout = time.Duration(config.Tools.Exec.TimeoutSeconds) * time.Second
 	}
 
+	var sandbox *namespaceSandbox
+	if config != nil {
+		switch mode := config.Tools.Exec.Sandbox; mode {
+		case "", ExecSandboxNone:
+		case ExecSandboxNamespaces:
+			sb, err := newNamespaceSandbox(workingDir, config.Tools.Exec.SandboxOptions)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrExecSandboxUnavailable, err)
+			}
+			sandbox = sb
+		default:
+			return nil, fmt.Errorf("invalid exec sandbox %q (want %q or %q)", mode, ExecSandboxNone, ExecSandboxNamespaces)
+		}
+	}
+
+	jobs := newExecJobs(workingDir, defaultMaxBackgroundJobs, defaultBackgroundTimeout)
+	if config != nil {
+		if config.Tools.Exec.AllowBackground {
+			maxJobs := defaultMaxBackgroundJobs
+			if config.Tools.Exec.MaxBackgroundJobs > 0 {
+				maxJobs = config.Tools.Exec.MaxBackgroundJobs
+			}
+			jobs = newExecJobs(workingDir, maxJobs,
+				time.Duration(config.Tools.Exec.BackgroundTimeoutSeconds)*time.Second)
+		} else {
+			jobs = nil
+		}
+	}
+
 	return &ExecTool{
 		workingDir:          workingDir,
 		timeout:             timeout,
@@ -159,6 +204,8 @@ func NewExecToolWithConfig(
 		allowedPathPatterns: allowedPathPatterns,
 		restrictToWorkspace: restrict,
 		allowRemote:         allowRemote,
+		sandbox:             sandbox,
+		jobs:                jobs,
 	}, nil
 }
 
@@ -167,11 +214,17 @@ func (t *ExecTool) Name() string {
 }
 
 func (t *ExecTool) Description() string {
-	return "Execute a shell command and return its output. Use with caution."
+	desc := "Execute a shell command and return its output. Use with caution."
+	if t.jobs != nil {
+		desc += " Set background=true for commands that run longer than the timeout (builds, flashing, " +
+			"long tests): the call returns a job ID at once, you are notified when the job finishes, " +
+			"and job_status, job_output and job_kill manage it meanwhile."
+	}
+	return desc
 }
 
 func (t *ExecTool) Parameters() map[string]any {
-	return map[string]any{
+	params := map[string]any{
 		"type": "object",
 		"properties": map[string]any{
 			"command": map[string]any{
@@ -185,72 +238,49 @@ func (t *ExecTool) Parameters() map[string]any {
 		},
 		"required": []string{"command"},
 	}
+	if t.jobs != nil {
+		params["properties"].(map[string]any)["background"] = map[string]any{
+			"type":        "boolean",
+			"description": "Run the command as a background job without the timeout and return its job ID immediately",
+		}
+	}
+	return params
 }
 
 func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	return t.execute(ctx, args, nil)
+}
+
+// ExecuteAsync implements AsyncExecutor. Foreground commands ignore cb; a
+// background job calls it when the job ends.
+func (t *ExecTool) ExecuteAsync(ctx context.Context, args map[string]any, cb AsyncCallback) *ToolResult {
+	return t.execute(ctx, args, cb)
+}
+
+func (t *ExecTool) execute(ctx context.Context, args map[string]any, cb AsyncCallback) *ToolResult {
 	command, ok := args["command"].(string)
 	if !ok {
 		return ErrorResult("command is required")
 	}
 
-	// GHSA-pv8c-p6jf-3fpp: block exec from remote channels (e.g. Telegram webhooks)
-	// unless explicitly opted-in via config. Fail-closed: empty channel = blocked.
-	if !t.allowRemote {
-		channel := ToolChannel(ctx)
-		if channel == "" {
-			channel, _ = args["__channel"].(string)
-		}
-		channel = strings.TrimSpace(channel)
-		if channel == "" || !constants.IsInternalChannel(channel) {
-			return ErrorResult("exec is restricted to internal channels")
-		}
+	if blocked := t.checkChannel(ctx, args); blocked != nil {
+		return blocked
 	}
 
-	cwd := t.workingDir
-	if wd, ok := args["working_dir"].(string); ok && wd != "" {
-		if t.restrictToWorkspace && t.workingDir != "" {
-			resolvedWD, err := validatePathWithAllowPaths(wd, t.workingDir, true, t.allowedPathPatterns)
-			if err != nil {
-				return ErrorResult("Command blocked by safety guard (" + err.Error() + ")")
-			}
-			cwd = resolvedWD
-		} else {
-			cwd = wd
-		}
-	}
-
-	if cwd == "" {
-		wd, err := os.Getwd()
-		if err == nil {
-			cwd = wd
-		}
+	wd, _ := args["working_dir"].(string)
+	cwd, blocked := t.resolveWorkingDir(wd)
+	if blocked != nil {
+		return blocked
 	}
-
 	if guardError := t.guardCommand(command, cwd); guardError != "" {
 		return ErrorResult(guardError)
 	}
 
-	// Re-resolve symlinks immediately before execution to shrink the TOCTOU window
-	// between validation and cmd.Dir assignment.
-	if t.restrictToWorkspace && t.workingDir != "" && cwd != t.workingDir {
-		resolved, err := filepath.EvalSymlinks(cwd)
-		if err != nil {
-			return ErrorResult(fmt.Sprintf("Command blocked by safety guard (path resolution failed: %v)", err))
-		}
-		if isAllowedPath(resolved, t.allowedPathPatterns) {
-			cwd = resolved
-		} else {
-			absWorkspace, _ := filepath.Abs(t.workingDir)
-			wsResolved, _ := filepath.EvalSymlinks(absWorkspace)
-			if wsResolved == "" {
-				wsResolved = absWorkspace
-			}
-			rel, err := filepath.Rel(wsResolved, resolved)
-			if err != nil || !filepath.IsLocal(rel) {
-				return ErrorResult("Command blocked by safety guard (working directory escaped workspace)")
-			}
-			cwd = resolved
+	if background, _ := args["background"].(bool); background {
+		if t.jobs == nil {
+			return ErrorResult("background jobs are disabled (tools.exec.allow_background)")
 		}
+		return t.jobs.start(ctx, t, command, cwd, cb)
 	}
 
 	// timeout == 0 means no timeout
@@ -263,17 +293,11 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 	defer cancel()
 
-	var cmd *exec.Cmd
-	if runtime.GOOS == "windows" {
-		cmd = exec.CommandContext(cmdCtx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
-	} else {
-		cmd = exec.CommandContext(cmdCtx, "sh", "-c", command)
-	}
-	if cwd != "" {
-		cmd.Dir = cwd
+	cmd, cleanup, err := t.command(cmdCtx, command, cwd)
+	if err != nil {
+		return ErrorResult(fmt.Sprintf("failed to start command: %v", err)).WithError(err)
 	}
-
-	prepareCommandForTermination(cmd)
+	defer cleanup()
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -288,7 +312,6 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 		done <- cmd.Wait()
 	}()
 
-	var err error
 	select {
 	case err = <-done:
 	case <-cmdCtx.Done():
@@ -361,12 +384,113 @@ func (t *ExecTool) Execute(ctx context.Context, args map[string]any) *ToolResult
 	}
 }
 
+// command builds the process running command in cwd, in the sandbox when
+// one is configured. The returned cleanup must be called once it has exited.
+func (t *ExecTool) command(ctx context.Context, command, cwd string) (*exec.Cmd, func(), error) {
+	cleanup := func() {}
+	var cmd *exec.Cmd
+	if t.sandbox != nil {
+		var err error
+		cmd, cleanup, err = t.sandbox.command(ctx, command, cwd)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	if cwd != "" {
+		cmd.Dir = cwd
+	}
+	prepareCommandForTermination(cmd)
+	return cmd, cleanup, nil
+}
+
+// Close kills the running background jobs. The agent calls it on shutdown.
+func (t *ExecTool) Close() error {
+	if t.jobs != nil {
+		t.jobs.killAll()
+	}
+	return nil
+}
+
+// checkChannel returns an error result when commands may not run for the
+// channel of the call.
+func (t *ExecTool) checkChannel(ctx context.Context, args map[string]any) *ToolResult {
+	// GHSA-pv8c-p6jf-3fpp: block exec from remote channels (e.g. Telegram webhooks)
+	// unless explicitly opted-in via config. Fail-closed: empty channel = blocked.
+	if t.allowRemote {
+		return nil
+	}
+	channel := ToolChannel(ctx)
+	if channel == "" {
+		channel, _ = args["__channel"].(string)
+	}
+	channel = strings.TrimSpace(channel)
+	if channel == "" || !constants.IsInternalChannel(channel) {
+		return ErrorResult("exec is restricted to internal channels")
+	}
+	return nil
+}
+
+// resolveWorkingDir returns the directory a command asking for wd runs in,
+// or an error result when wd is outside what the tool may use. An empty wd
+// means the tool's working directory.
+func (t *ExecTool) resolveWorkingDir(wd string) (string, *ToolResult) {
+	cwd := t.workingDir
+	if wd != "" {
+		if t.restrictToWorkspace && t.workingDir != "" {
+			resolvedWD, err := validatePathWithAllowPaths(wd, t.workingDir, true, t.allowedPathPatterns)
+			if err != nil {
+				return "", ErrorResult("Command blocked by safety guard (" + err.Error() + ")")
+			}
+			cwd = resolvedWD
+		} else {
+			cwd = wd
+		}
+	}
+
+	if cwd == "" {
+		wd, err := os.Getwd()
+		if err == nil {
+			cwd = wd
+		}
+	}
+
+	// Re-resolve symlinks immediately before execution to shrink the TOCTOU window
+	// between validation and cmd.Dir assignment.
+	if t.restrictToWorkspace && t.workingDir != "" && cwd != t.workingDir {
+		resolved, err := filepath.EvalSymlinks(cwd)
+		if err != nil {
+			return "", ErrorResult(fmt.Sprintf("Command blocked by safety guard (path resolution failed: %v)", err))
+		}
+		if isAllowedPath(resolved, t.allowedPathPatterns) {
+			cwd = resolved
+		} else {
+			absWorkspace, _ := filepath.Abs(t.workingDir)
+			wsResolved, _ := filepath.EvalSymlinks(absWorkspace)
+			if wsResolved == "" {
+				wsResolved = absWorkspace
+			}
+			rel, err := filepath.Rel(wsResolved, resolved)
+			if err != nil || !filepath.IsLocal(rel) {
+				return "", ErrorResult("Command blocked by safety guard (working directory escaped workspace)")
+			}
+			cwd = resolved
+		}
+	}
+	return cwd, nil
+}
+
 func (t *ExecTool) guardCommand(command, cwd string) string {
 	cmd := strings.TrimSpace(command)
 	lower := strings.ToLower(cmd)
 
-	// Custom allow patterns exempt a command from deny checks.
-	explicitlyAllowed := false
+	// Custom allow patterns exempt a command from deny checks. The deny
+	// patterns and the path checks below are only a fallback: a sandboxed
+	// command cannot reach what they protect.
+	explicitlyAllowed := t.sandbox != nil
 	for _, pattern := range t.customAllowPatterns {
 		if pattern.MatchString(lower) {
 			explicitlyAllowed = true
@@ -395,7 +519,7 @@ func (t *ExecTool) guardCommand(command, cwd string) string {
 		}
 	}
 
-	if t.restrictToWorkspace {
+	if t.restrictToWorkspace && t.sandbox == nil {
 		if strings.Contains(cmd, "..\\") || strings.Contains(cmd, "../") {
 			return "Command blocked by safety guard (path traversal detected)"
 		}
@@ -0,0 +1,620 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	defaultShellSessionIdleTimeout = 10 * time.Minute
+	defaultShellSessionMax         = 4
+
+	defaultShellSessionWait = 5 * time.Second
+	shellSessionOpenWait    = time.Second
+	maxShellSessionWait     = 120 * time.Second
+
+	// shellSessionQuiet is how long output must pause before a call without
+	// wait_for returns what arrived.
+	shellSessionQuiet = 300 * time.Millisecond
+
+	shellSessionMaxOutput = 10000   // bytes returned per call
+	shellSessionBuffer    = 1 << 20 // unread bytes kept per session
+)
+
+// ShellSessionTool keeps interactive shells running between calls, so the
+// working directory, environment, virtualenvs and REPLs carry over. Each
+// session runs on a pseudo-terminal and belongs to the conversation that
+// opened it. Commands go through the same channel check, guard and sandbox
+// as the exec tool.
+type ShellSessionTool struct {
+	exec        *ExecTool
+	idleTimeout time.Duration
+	maxSessions int
+
+	mu       sync.Mutex
+	nextID   int
+	sessions map[string]map[string]*shellSession // conversation -> session ID -> session
+}
+
+// shellSession is one running shell and the output it produced that no call
+// has returned yet.
+type shellSession struct {
+	id      string
+	command string
+	cmd     *exec.Cmd
+	term    io.ReadWriteCloser
+	cleanup func()
+	idle    *time.Timer
+
+	exited   chan struct{} // closed once the process has exited
+	readDone chan struct{} // closed once the terminal has no more output
+	exitErr  error
+
+	mu         sync.Mutex
+	buf        []byte
+	dropped    int
+	lastOutput time.Time
+	lastUsed   time.Time
+}
+
+func NewShellSessionTool(execTool *ExecTool, cfg config.ShellSessionConfig) *ShellSessionTool {
+	idleTimeout := defaultShellSessionIdleTimeout
+	if cfg.IdleTimeoutSeconds > 0 {
+		idleTimeout = time.Duration(cfg.IdleTimeoutSeconds) * time.Second
+	}
+	maxSessions := defaultShellSessionMax
+	if cfg.MaxSessions > 0 {
+		maxSessions = cfg.MaxSessions
+	}
+	return &ShellSessionTool{
+		exec:        execTool,
+		idleTimeout: idleTimeout,
+		maxSessions: maxSessions,
+		sessions:    make(map[string]map[string]*shellSession),
+	}
+}
+
+func (t *ShellSessionTool) Name() string {
+	return "shell_session"
+}
+
+func (t *ShellSessionTool) Description() string {
+	return "Run a persistent interactive shell on a terminal. Unlike exec, state such as the current " +
+		"directory, environment variables and activated virtualenvs carries over between calls, and " +
+		"long-running programs (REPLs, debuggers, builds, serial consoles) keep running. " +
+		"Actions: 'open' starts a shell (or 'command') and returns its session_id; 'send' types 'input' " +
+		"(and Enter unless enter=false) or a Ctrl key via 'ctrl' (e.g. \"c\" to interrupt); 'read' waits " +
+		"for more output; 'close' stops the session; 'list' shows open sessions. Every call returns only " +
+		"the output produced since the previous call. Use 'wait_for' with a regular expression such as a " +
+		fmt.Sprintf("prompt to wait until it appears. Sessions close after %s without use.", t.idleTimeout)
+}
+
+func (t *ShellSessionTool) Parameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"action": map[string]any{
+				"type":        "string",
+				"enum":        []string{"open", "send", "read", "close", "list"},
+				"description": "What to do.",
+			},
+			"session_id": map[string]any{
+				"type":        "string",
+				"description": "Session to use, as returned by open. Required for send, read and close.",
+			},
+			"command": map[string]any{
+				"type":        "string",
+				"description": "open: program to run instead of a shell, e.g. \"python3\" or \"picocom -b 115200 /dev/ttyUSB0\".",
+			},
+			"working_dir": map[string]any{
+				"type":        "string",
+				"description": "open: working directory of the session.",
+			},
+			"input": map[string]any{
+				"type":        "string",
+				"description": "send: text to type.",
+			},
+			"enter": map[string]any{
+				"type":        "boolean",
+				"description": "send: press Enter after the input. Defaults to true.",
+			},
+			"ctrl": map[string]any{
+				"type":        "string",
+				"description": "send: a letter to press with Ctrl instead of input, e.g. \"c\" to interrupt or \"d\" for end of input.",
+			},
+			"wait_for": map[string]any{
+				"type":        "string",
+				"description": "Regular expression; return as soon as the new output matches it.",
+			},
+			"timeout_seconds": map[string]any{
+				"type": "integer",
+				"description": fmt.Sprintf("Longest time to wait for output (default %d, %d for open; max %d).",
+					int(defaultShellSessionWait.Seconds()), int(shellSessionOpenWait.Seconds()),
+					int(maxShellSessionWait.Seconds())),
+			},
+		},
+		"required": []string{"action"},
+	}
+}
+
+func (t *ShellSessionTool) Execute(ctx context.Context, args map[string]any) *ToolResult {
+	action, _ := args["action"].(string)
+	conv := shellConversation(ctx)
+
+	if action == "list" {
+		return SilentResult(t.list(conv))
+	}
+	if blocked := t.exec.checkChannel(ctx, args); blocked != nil {
+		return blocked
+	}
+
+	wait := defaultShellSessionWait
+	if action == "open" {
+		// Most programs print a banner or prompt right away; do not hold a
+		// silent one for the full timeout unless asked to.
+		wait = shellSessionOpenWait
+	}
+	if secs, ok := args["timeout_seconds"].(float64); ok && secs > 0 {
+		wait = min(time.Duration(secs*float64(time.Second)), maxShellSessionWait)
+	}
+	var waitFor *regexp.Regexp
+	if pattern, _ := args["wait_for"].(string); pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return ErrorResult(fmt.Sprintf("invalid wait_for pattern: %v", err))
+		}
+		waitFor = re
+	}
+
+	switch action {
+	case "open":
+		command, _ := args["command"].(string)
+		wd, _ := args["working_dir"].(string)
+		s, blocked := t.open(conv, strings.TrimSpace(command), wd)
+		if blocked != nil {
+			return blocked
+		}
+		return t.output(ctx, conv, s, wait, waitFor)
+	case "send", "read", "close":
+	default:
+		return ErrorResult(fmt.Sprintf("unknown action %q (want open, send, read, close or list)", action))
+	}
+
+	id, _ := args["session_id"].(string)
+	s := t.get(conv, id)
+	if s == nil {
+		return ErrorResult(fmt.Sprintf("shell session %q not found; sessions close after %s without use",
+			id, t.idleTimeout))
+	}
+
+	switch action {
+	case "send":
+		if blocked := t.send(s, args); blocked != nil {
+			return blocked
+		}
+		return t.output(ctx, conv, s, wait, waitFor)
+	case "read":
+		return t.output(ctx, conv, s, wait, waitFor)
+	default: // close
+		out, _, _ := s.take(shellSessionBuffer)
+		t.remove(conv, s)
+		s.stop()
+		msg := fmt.Sprintf("[session %s closed]", s.id)
+		if out != "" {
+			msg += "\n" + out
+		}
+		return SilentResult(msg)
+	}
+}
+
+// Close stops every session. The agent calls it on shutdown.
+func (t *ShellSessionTool) Close() error {
+	t.mu.Lock()
+	var all []*shellSession
+	for _, sessions := range t.sessions {
+		for _, s := range sessions {
+			all = append(all, s)
+		}
+	}
+	t.sessions = make(map[string]map[string]*shellSession)
+	t.mu.Unlock()
+	for _, s := range all {
+		s.stop()
+	}
+	return nil
+}
+
+// shellConversation returns the key sessions are grouped by: the session key
+// of the conversation, or its channel and chat.
+func shellConversation(ctx context.Context) string {
+	if key := ToolSessionKey(ctx); key != "" {
+		return key
+	}
+	return ToolChannel(ctx) + ":" + ToolChatID(ctx)
+}
+
+func (t *ShellSessionTool) open(conv, command, wd string) (*shellSession, *ToolResult) {
+	// Without the sandbox only the text sent is checked, and a program in
+	// the session can reach any path, so workspace restriction would not hold.
+	if t.exec.sandbox == nil && t.exec.restrictToWorkspace {
+		return nil, ErrorResult("shell sessions need the namespaces exec sandbox while " +
+			"restrict_to_workspace is enabled; use exec instead")
+	}
+	cwd, blocked := t.exec.resolveWorkingDir(wd)
+	if blocked != nil {
+		return nil, blocked
+	}
+	if command != "" {
+		if guardError := t.exec.guardCommand(command, cwd); guardError != "" {
+			return nil, ErrorResult(guardError)
+		}
+	}
+
+	t.mu.Lock()
+	t.nextID++
+	id := strconv.Itoa(t.nextID)
+	t.mu.Unlock()
+
+	s, err := t.start(id, command, cwd)
+	if err != nil {
+		return nil, ErrorResult(fmt.Sprintf("failed to open shell session: %v", err)).WithError(err)
+	}
+
+	// The limit is checked together with the insert so concurrent opens
+	// cannot both take the last slot.
+	t.mu.Lock()
+	if len(t.sessions[conv]) >= t.maxSessions {
+		t.mu.Unlock()
+		s.stop()
+		return nil, ErrorResult(fmt.Sprintf(
+			"this conversation already has %d shell sessions open; close one first", t.maxSessions))
+	}
+	s.idle = time.AfterFunc(t.idleTimeout, func() {
+		if t.remove(conv, s) {
+			logger.InfoCF("tools", "Shell session closed after idle timeout",
+				map[string]any{"session_id": s.id, "conversation": conv})
+			s.stop()
+		}
+	})
+	if t.sessions[conv] == nil {
+		t.sessions[conv] = make(map[string]*shellSession)
+	}
+	t.sessions[conv][id] = s
+	t.mu.Unlock()
+
+	logger.InfoCF("tools", "Shell session opened",
+		map[string]any{"session_id": id, "conversation": conv, "command": command, "dir": cwd})
+	return s, nil
+}
+
+// start launches the session's process on a terminal.
+func (t *ShellSessionTool) start(id, command, cwd string) (*shellSession, error) {
+	cleanup := func() {}
+	var cmd *exec.Cmd
+	switch {
+	case t.exec.sandbox != nil:
+		script := command
+		if script == "" {
+			script = "exec sh -i"
+		}
+		var err error
+		if cmd, cleanup, err = t.exec.sandbox.command(context.Background(), script, cwd); err != nil {
+			return nil, err
+		}
+	case runtime.GOOS == "windows":
+		if command == "" {
+			cmd = exec.Command("powershell", "-NoLogo", "-NoProfile", "-Command", "-")
+		} else {
+			cmd = exec.Command("powershell", "-NoLogo", "-NoProfile", "-Command", command)
+		}
+	case command == "":
+		cmd = exec.Command("sh", "-i")
+	default:
+		cmd = exec.Command("sh", "-c", command)
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	// Plain output suits a reader that is not a terminal emulator.
+	cmd.Env = append(cmd.Env, "TERM=dumb", "PAGER=cat", "GIT_PAGER=cat")
+	cmd.Dir = cwd
+
+	term, err := startTerminal(cmd)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	now := time.Now()
+	s := &shellSession{
+		id:       id,
+		command:  command,
+		cmd:      cmd,
+		term:     term,
+		cleanup:  cleanup,
+		exited:   make(chan struct{}),
+		readDone: make(chan struct{}),
+		lastUsed: now,
+	}
+	go s.readLoop()
+	go func() {
+		s.exitErr = cmd.Wait()
+		close(s.exited)
+	}()
+	return s, nil
+}
+
+func (t *ShellSessionTool) get(conv, id string) *shellSession {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.sessions[conv][id]
+	if s != nil {
+		s.idle.Reset(t.idleTimeout)
+	}
+	return s
+}
+
+// remove forgets the session and reports whether it was still known.
+func (t *ShellSessionTool) remove(conv string, s *shellSession) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessions[conv][s.id] != s {
+		return false
+	}
+	delete(t.sessions[conv], s.id)
+	if len(t.sessions[conv]) == 0 {
+		delete(t.sessions, conv)
+	}
+	return true
+}
+
+func (t *ShellSessionTool) list(conv string) string {
+	t.mu.Lock()
+	var sessions []*shellSession
+	for _, s := range t.sessions[conv] {
+		sessions = append(sessions, s)
+	}
+	t.mu.Unlock()
+	if len(sessions) == 0 {
+		return "No shell sessions are open."
+	}
+	slices.SortFunc(sessions, func(a, b *shellSession) int {
+		return strings.Compare(a.id, b.id)
+	})
+	var sb strings.Builder
+	sb.WriteString("Open shell sessions:\n")
+	for _, s := range sessions {
+		command := s.command
+		if command == "" {
+			command = "shell"
+		}
+		s.mu.Lock()
+		idle := time.Since(s.lastUsed).Round(time.Second)
+		s.mu.Unlock()
+		fmt.Fprintf(&sb, "- %s: %s, %s, idle %s\n", s.id, command, s.status(), idle)
+	}
+	return sb.String()
+}
+
+// send writes the input or control key of a send call to the terminal.
+func (t *ShellSessionTool) send(s *shellSession, args map[string]any) *ToolResult {
+	var data []byte
+	if ctrl, _ := args["ctrl"].(string); ctrl != "" {
+		key := strings.ToLower(strings.TrimSpace(ctrl))
+		if len(key) != 1 || key[0] < 'a' || key[0] > 'z' {
+			return ErrorResult(fmt.Sprintf("invalid ctrl key %q (want a letter such as \"c\")", ctrl))
+		}
+		data = []byte{key[0] - 'a' + 1}
+	} else {
+		input, _ := args["input"].(string)
+		if strings.TrimSpace(input) != "" {
+			if guardError := t.exec.guardCommand(input, t.exec.workingDir); guardError != "" {
+				return ErrorResult(guardError)
+			}
+		}
+		data = []byte(input)
+		if enter, ok := args["enter"].(bool); !ok || enter {
+			data = append(data, '\n')
+		}
+	}
+	select {
+	case <-s.exited:
+		return ErrorResult(fmt.Sprintf("shell session %s has exited; read its remaining output or open a new one", s.id))
+	default:
+	}
+	if _, err := s.term.Write(data); err != nil {
+		return ErrorResult(fmt.Sprintf("failed to write to shell session %s: %v", s.id, err)).WithError(err)
+	}
+	return nil
+}
+
+// output waits for the session's output as the call asks and returns it. An
+// exited session whose output has been fully returned is removed.
+func (t *ShellSessionTool) output(
+	ctx context.Context,
+	conv string,
+	s *shellSession,
+	wait time.Duration,
+	waitFor *regexp.Regexp,
+) *ToolResult {
+	s.wait(ctx, wait, waitFor)
+	out, pending, dropped := s.take(shellSessionMaxOutput)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "[session %s: %s]\n", s.id, s.status())
+	if dropped > 0 {
+		fmt.Fprintf(&sb, "[... %d bytes of earlier output dropped]\n", dropped)
+	}
+	if out == "" {
+		sb.WriteString("(no new output)")
+	} else {
+		sb.WriteString(out)
+	}
+	if pending > 0 {
+		fmt.Fprintf(&sb, "\n[%d more bytes pending; use read to get them]", pending)
+	} else if s.finished() && t.remove(conv, s) {
+		s.stop()
+		sb.WriteString("\n[session closed]")
+	}
+	text := sb.String()
+	return &ToolResult{ForLLM: text, ForUser: text}
+}
+
+func (s *shellSession) readLoop() {
+	defer close(s.readDone)
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := s.term.Read(chunk)
+		if n > 0 {
+			s.mu.Lock()
+			s.buf = append(s.buf, chunk[:n]...)
+			if excess := len(s.buf) - shellSessionBuffer; excess > 0 {
+				s.buf = append(s.buf[:0], s.buf[excess:]...)
+				s.dropped += excess
+			}
+			s.lastOutput = time.Now()
+			s.mu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// wait blocks until the output the call waits for is there: a match of
+// waitFor, or without one any output followed by a pause. It also returns
+// when the process exits and on timeout.
+func (s *shellSession) wait(ctx context.Context, timeout time.Duration, waitFor *regexp.Regexp) {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		pending := len(s.buf) > 0
+		quiet := time.Since(s.lastOutput) >= shellSessionQuiet
+		matched := waitFor != nil && waitFor.MatchString(cleanTerminalOutput(s.buf))
+		s.mu.Unlock()
+
+		switch {
+		case matched, s.finished():
+			return
+		case waitFor == nil && pending && quiet:
+			return
+		case !time.Now().Before(deadline):
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// take removes up to limit bytes of unread output, cut at a line end where
+// possible, and returns them cleaned up with the number of bytes still
+// unread and dropped since the last take.
+func (s *shellSession) take(limit int) (string, int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastUsed = time.Now()
+	n := len(s.buf)
+	if n > limit {
+		n = limit
+		if cut := bytes.LastIndexByte(s.buf[:limit], '\n'); cut > 0 {
+			n = cut + 1
+		}
+	}
+	out := cleanTerminalOutput(s.buf[:n])
+	s.buf = append(s.buf[:0], s.buf[n:]...)
+	dropped := s.dropped
+	s.dropped = 0
+	return out, len(s.buf), dropped
+}
+
+// finished reports whether the process has exited and all of its output
+// has been read from the terminal.
+func (s *shellSession) finished() bool {
+	select {
+	case <-s.exited:
+	default:
+		return false
+	}
+	select {
+	case <-s.readDone:
+		return true
+	default:
+		// Background processes may still hold the terminal.
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return time.Since(s.lastOutput) >= shellSessionQuiet
+	}
+}
+
+func (s *shellSession) status() string {
+	select {
+	case <-s.exited:
+	default:
+		return "running"
+	}
+	var exitErr *exec.ExitError
+	switch {
+	case s.exitErr == nil:
+		return "exited with code 0"
+	case errors.As(s.exitErr, &exitErr) && exitErr.ExitCode() >= 0:
+		return fmt.Sprintf("exited with code %d", exitErr.ExitCode())
+	default:
+		return fmt.Sprintf("exited (%v)", s.exitErr)
+	}
+}
+
+// stop kills the session's process group and releases the terminal.
+func (s *shellSession) stop() {
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	_ = terminateProcessTree(s.cmd)
+	select {
+	case <-s.exited:
+	case <-time.After(2 * time.Second):
+	}
+	s.term.Close()
+	s.cleanup()
+}
+
+var (
+	ansiEscapePattern = regexp.MustCompile(`\x1b(\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+	crlfReplacer      = strings.NewReplacer("\r\n", "\n")
+)
+
+// cleanTerminalOutput strips escape sequences and resolves carriage returns
+// the way a terminal shows them, keeping the last rewrite of each line.
+func cleanTerminalOutput(raw []byte) string {
+	text := strings.ToValidUTF8(string(raw), "")
+	text = ansiEscapePattern.ReplaceAllString(text, "")
+	text = crlfReplacer.Replace(text)
+	if !strings.Contains(text, "\r") {
+		return text
+	}
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if idx := strings.LastIndexByte(strings.TrimRight(line, "\r"), '\r'); idx >= 0 {
+			lines[i] = line[idx+1:]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,222 @@
+//go:build !windows
+
+package tools
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+)
+
+func newTestShellSessionTool(t *testing.T, cfg config.ShellSessionConfig) *ShellSessionTool {
+	t.Helper()
+	execTool, err := NewExecTool(t.TempDir(), false)
+	if err != nil {
+		t.Fatalf("NewExecTool() error: %v", err)
+	}
+	tool := NewShellSessionTool(execTool, cfg)
+	t.Cleanup(func() { tool.Close() })
+	return tool
+}
+
+var shellSessionIDPattern = regexp.MustCompile(`\[session (\d+):`)
+
+func openShellSession(t *testing.T, tool *ShellSessionTool, ctx context.Context, args map[string]any) string {
+	t.Helper()
+	args["action"] = "open"
+	result := tool.Execute(ctx, args)
+	if result.IsError {
+		t.Fatalf("open failed: %s", result.ForLLM)
+	}
+	m := shellSessionIDPattern.FindStringSubmatch(result.ForLLM)
+	if m == nil {
+		t.Fatalf("open result has no session id: %s", result.ForLLM)
+	}
+	return m[1]
+}
+
+func sendShellInput(t *testing.T, tool *ShellSessionTool, ctx context.Context, id, input, waitFor string) string {
+	t.Helper()
+	result := tool.Execute(ctx, map[string]any{
+		"action":          "send",
+		"session_id":      id,
+		"input":           input,
+		"wait_for":        waitFor,
+		"timeout_seconds": float64(10),
+	})
+	if result.IsError {
+		t.Fatalf("send %q failed: %s", input, result.ForLLM)
+	}
+	return result.ForLLM
+}
+
+func TestShellSessionTool_StatePersists(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{})
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+	id := openShellSession(t, tool, ctx, map[string]any{})
+
+	sendShellInput(t, tool, ctx, id, "cd /tmp && export PICO_SESSION_VAR=kept", "")
+	out := sendShellInput(t, tool, ctx, id, "echo dir=$PWD var=$PICO_SESSION_VAR", `var=kept`)
+	if !strings.Contains(out, "dir=/tmp var=kept") {
+		t.Errorf("state not kept between sends, got: %s", out)
+	}
+	if !strings.Contains(out, "running") {
+		t.Errorf("expected running status, got: %s", out)
+	}
+}
+
+func TestShellSessionTool_OutputIsIncremental(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{})
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+	id := openShellSession(t, tool, ctx, map[string]any{})
+
+	first := sendShellInput(t, tool, ctx, id, "printf 'first-%s\\n' two", `first-two`)
+	second := sendShellInput(t, tool, ctx, id, "printf 'second-%s\\n' four", `second-four`)
+	if strings.Contains(second, "first-two") {
+		t.Errorf("second call repeated earlier output: %s", second)
+	}
+	if !strings.Contains(first, "first-two") {
+		t.Errorf("first call missing its output: %s", first)
+	}
+}
+
+func TestShellSessionTool_CtrlCInterrupts(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{})
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+	id := openShellSession(t, tool, ctx, map[string]any{})
+
+	tool.Execute(ctx, map[string]any{
+		"action": "send", "session_id": id, "input": "sleep 60", "timeout_seconds": float64(1),
+	})
+	result := tool.Execute(ctx, map[string]any{"action": "send", "session_id": id, "ctrl": "c"})
+	if result.IsError {
+		t.Fatalf("ctrl c failed: %s", result.ForLLM)
+	}
+	start := time.Now()
+	out := sendShellInput(t, tool, ctx, id, "printf 'after-%s\\n' nine", `after-nine`)
+	if !strings.Contains(out, "after-nine") || time.Since(start) > 5*time.Second {
+		t.Errorf("shell did not come back after ctrl c: %s", out)
+	}
+}
+
+func TestShellSessionTool_CommandExitClosesSession(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{})
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+	id := openShellSession(t, tool, ctx, map[string]any{"command": "read line; echo got-$line; exit 3"})
+
+	out := sendShellInput(t, tool, ctx, id, "abc", `exited`)
+	for _, want := range []string{"got-abc", "exited with code 3", "session closed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in output, got: %s", want, out)
+		}
+	}
+	result := tool.Execute(ctx, map[string]any{"action": "read", "session_id": id})
+	if !result.IsError {
+		t.Errorf("expected finished session to be gone, got: %s", result.ForLLM)
+	}
+}
+
+func TestShellSessionTool_SessionsBelongToConversation(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{MaxSessions: 1})
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+	other := WithToolSessionKey(context.Background(), "conv-2")
+	id := openShellSession(t, tool, ctx, map[string]any{})
+
+	result := tool.Execute(other, map[string]any{"action": "read", "session_id": id})
+	if !result.IsError {
+		t.Errorf("expected another conversation not to see the session, got: %s", result.ForLLM)
+	}
+	if list := tool.Execute(other, map[string]any{"action": "list"}); strings.Contains(list.ForLLM, id+":") {
+		t.Errorf("list leaked a session of another conversation: %s", list.ForLLM)
+	}
+
+	result = tool.Execute(ctx, map[string]any{"action": "open"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "close one first") {
+		t.Errorf("expected session limit error, got: %s", result.ForLLM)
+	}
+	openShellSession(t, tool, other, map[string]any{})
+
+	result = tool.Execute(ctx, map[string]any{"action": "close", "session_id": id})
+	if result.IsError {
+		t.Fatalf("close failed: %s", result.ForLLM)
+	}
+	openShellSession(t, tool, ctx, map[string]any{})
+}
+
+func TestShellSessionTool_ConcurrentOpensRespectLimit(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{MaxSessions: 1})
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+
+	var wg sync.WaitGroup
+	var opened atomic.Int32
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if result := tool.Execute(ctx, map[string]any{"action": "open"}); !result.IsError {
+				opened.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := opened.Load(); n != 1 {
+		t.Fatalf("opened %d sessions with max_sessions 1", n)
+	}
+}
+
+func TestShellSessionTool_RestrictedWithoutSandbox(t *testing.T) {
+	execTool, err := NewExecTool(t.TempDir(), true)
+	if err != nil {
+		t.Fatalf("NewExecTool() error: %v", err)
+	}
+	tool := NewShellSessionTool(execTool, config.ShellSessionConfig{})
+	t.Cleanup(func() { tool.Close() })
+
+	result := tool.Execute(context.Background(), map[string]any{"action": "open"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "sandbox") {
+		t.Fatalf("expected open to be refused without the sandbox, got: %s", result.ForLLM)
+	}
+}
+
+func TestShellSessionTool_IdleTimeout(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{})
+	tool.idleTimeout = 200 * time.Millisecond
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+	id := openShellSession(t, tool, ctx, map[string]any{})
+
+	time.Sleep(time.Second)
+	result := tool.Execute(ctx, map[string]any{"action": "read", "session_id": id})
+	if !result.IsError {
+		t.Errorf("expected idle session to be closed, got: %s", result.ForLLM)
+	}
+}
+
+func TestShellSessionTool_GuardBlocksInput(t *testing.T) {
+	tool := newTestShellSessionTool(t, config.ShellSessionConfig{})
+	ctx := WithToolSessionKey(context.Background(), "conv-1")
+
+	result := tool.Execute(ctx, map[string]any{"action": "open", "command": "rm -rf /"})
+	if !result.IsError {
+		t.Errorf("expected dangerous open command to be blocked, got: %s", result.ForLLM)
+	}
+
+	id := openShellSession(t, tool, ctx, map[string]any{})
+	result = tool.Execute(ctx, map[string]any{"action": "send", "session_id": id, "input": "rm -rf /"})
+	if !result.IsError || !strings.Contains(result.ForLLM, "blocked") {
+		t.Errorf("expected dangerous input to be blocked, got: %s", result.ForLLM)
+	}
+}
+
+func TestCleanTerminalOutput(t *testing.T) {
+	raw := "\x1b[1;32mok\x1b[0m\r\nprogress 10%\rprogress 100%\r\n\x1b]0;title\x07done"
+	want := "ok\nprogress 100%\ndone"
+	if got := cleanTerminalOutput([]byte(raw)); got != want {
+		t.Errorf("cleanTerminalOutput() = %q, want %q", got, want)
+	}
+}
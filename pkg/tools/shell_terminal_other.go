@@ -0,0 +1,47 @@
+//go:build !linux
+
+package tools
+
+import (
+	"io"
+	"os"
+	"os/exec"
+)
+
+// startTerminal starts cmd with pipes where pseudo-terminals are not
+// supported. Programs see no terminal: there is no line editing and
+// control characters are passed on as plain input.
+func startTerminal(cmd *exec.Cmd) (io.ReadWriteCloser, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	output, outputW, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		return nil, err
+	}
+	cmd.Stdout, cmd.Stderr = outputW, outputW
+	prepareCommandForTermination(cmd)
+	err = cmd.Start()
+	outputW.Close()
+	if err != nil {
+		stdin.Close()
+		output.Close()
+		return nil, err
+	}
+	return &pipeTerminal{stdin: stdin, output: output}, nil
+}
+
+type pipeTerminal struct {
+	stdin  io.WriteCloser
+	output *os.File
+}
+
+func (p *pipeTerminal) Read(b []byte) (int, error)  { return p.output.Read(b) }
+func (p *pipeTerminal) Write(b []byte) (int, error) { return p.stdin.Write(b) }
+
+func (p *pipeTerminal) Close() error {
+	p.stdin.Close()
+	return p.output.Close()
+}
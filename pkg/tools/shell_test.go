@@ -683,3 +683,12 @@ func TestShellTool_URLBypassPrevented(t *testing.T) {
 		}
 	}
 }
+
+func TestNewExecToolWithConfig_InvalidSandbox(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Tools.Exec.Sandbox = "docker"
+	if _, err := NewExecToolWithConfig(t.TempDir(), true, cfg); err == nil ||
+		!strings.Contains(err.Error(), `invalid exec sandbox "docker"`) {
+		t.Fatalf("error = %v", err)
+	}
+}
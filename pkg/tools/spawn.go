@@ -8,6 +8,7 @@ import (
 
 type SpawnTool struct {
 	spawner        SubTurnSpawner
+	manager        *SubagentManager
 	defaultModel   string
 	maxTokens      int
 	temperature    float64
@@ -22,6 +23,7 @@ func NewSpawnTool(manager *SubagentManager) *SpawnTool {
 		return &SpawnTool{}
 	}
 	return &SpawnTool{
+		manager:      manager,
 		defaultModel: manager.defaultModel,
 		maxTokens:    manager.maxTokens,
 		temperature:  manager.temperature,
@@ -120,6 +122,15 @@ Task: %s`,
 
 	// Use spawner if available (direct SpawnSubTurn call)
 	if t.spawner != nil {
+		// Record the task so spawn_status can report it and it survives a
+		// restart when the manager persists tasks.
+		var taskID string
+		var onProgress func(string)
+		if t.manager != nil {
+			taskID = t.manager.Track(task, label, agentID, ToolChannel(ctx), ToolChatID(ctx))
+			onProgress = func(text string) { t.manager.UpdatePartial(taskID, text) }
+		}
+
 		// Launch async sub-turn in goroutine
 		go func() {
 			result, err := t.spawner.SpawnSubTurn(ctx, SubTurnConfig{
@@ -129,7 +140,12 @@ Task: %s`,
 				MaxTokens:    t.maxTokens,
 				Temperature:  t.temperature,
 				Async:        true, // Async execution
+				Label:        label,
+				OnProgress:   onProgress,
 			})
+			if t.manager != nil {
+				t.manager.Finish(ctx, taskID, result, err)
+			}
 			if err != nil {
 				result = ErrorResult(fmt.Sprintf("Spawn failed: %v", err)).WithError(err)
 			}
@@ -141,10 +157,14 @@ Task: %s`,
 		}()
 
 		// Return immediate acknowledgment
+		name := "subagent"
+		if taskID != "" {
+			name += " " + taskID
+		}
 		if label != "" {
-			return AsyncResult(fmt.Sprintf("Spawned subagent '%s' for task: %s", label, task))
+			return AsyncResult(fmt.Sprintf("Spawned %s '%s' for task: %s", name, label, task))
 		}
-		return AsyncResult(fmt.Sprintf("Spawned subagent for task: %s", task))
+		return AsyncResult(fmt.Sprintf("Spawned %s for task: %s", name, task))
 	}
 
 	// Fallback: spawner not configured
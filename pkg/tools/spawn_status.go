@@ -165,14 +165,20 @@ func spawnStatusFormatTask(task *SubagentTask) string {
 		sb.WriteString(fmt.Sprintf("\n  task:   %s", task.Task))
 	}
 	if task.Result != "" {
-		result := task.Result
-		const maxResultLen = 300
-		runes := []rune(result)
-		if len(runes) > maxResultLen {
-			result = string(runes[:maxResultLen]) + "…"
-		}
-		sb.WriteString(fmt.Sprintf("\n  result: %s", result))
+		sb.WriteString(fmt.Sprintf("\n  result: %s", spawnStatusClip(task.Result)))
+	} else if task.Partial != "" {
+		sb.WriteString(fmt.Sprintf("\n  partial: %s", spawnStatusClip(task.Partial)))
 	}
 
 	return sb.String()
 }
+
+// spawnStatusClip shortens result text for the status report.
+func spawnStatusClip(text string) string {
+	const maxResultLen = 300
+	runes := []rune(text)
+	if len(runes) > maxResultLen {
+		return string(runes[:maxResultLen]) + "…"
+	}
+	return text
+}
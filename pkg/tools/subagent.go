@@ -2,12 +2,21 @@ package tools
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
 	"github.com/sipeed/picoclaw/pkg/providers"
+	"github.com/sipeed/picoclaw/pkg/utils"
 )
 
 // SubTurnSpawner is an interface for spawning sub-turns.
@@ -30,20 +39,31 @@ type SubTurnConfig struct {
 	ActualSystemPrompt string
 	InitialMessages    []providers.Message
 	InitialTokenBudget *atomic.Int64 // Shared token budget for team members; nil if no budget
+	Label              string        // Names the sub-turn in spawn/end events; "" = child turn ID
+	OnProgress         func(string)  // Receives each model reply while the sub-turn runs; may be nil
 }
 
+// SubagentTask is one background subagent run. With persistence enabled it
+// is stored as JSON, so the fields carry json tags.
 type SubagentTask struct {
-	ID            string
-	Task          string
-	Label         string
-	AgentID       string
-	OriginChannel string
-	OriginChatID  string
-	Status        string
-	Result        string
-	Created       int64
+	ID            string `json:"id"`
+	Task          string `json:"task"`
+	Label         string `json:"label,omitempty"`
+	AgentID       string `json:"agent_id,omitempty"`
+	OriginChannel string `json:"origin_channel,omitempty"`
+	OriginChatID  string `json:"origin_chat_id,omitempty"`
+	Status        string `json:"status"`
+	Result        string `json:"result,omitempty"`
+	Partial       string `json:"partial,omitempty"` // Latest model reply while running
+	Created       int64  `json:"created"`
+	Updated       int64  `json:"updated,omitempty"`
 }
 
+const (
+	maxSubagentPartialLen = 2000 // partial output kept per task
+	maxFinishedSubagents  = 32   // finished tasks remembered before the oldest is forgotten
+)
+
 type SpawnSubTurnFunc func(
 	ctx context.Context,
 	task, label, agentID string,
@@ -67,6 +87,8 @@ type SubagentManager struct {
 	hasTemperature bool
 	nextID         int
 	spawner        SpawnSubTurnFunc
+	storeDir       string   // Where tasks are persisted; "" keeps them in memory
+	interrupted    []string // Loaded tasks that were still running, awaiting Resume
 }
 
 func NewSubagentManager(
@@ -115,14 +137,100 @@ func (sm *SubagentManager) RegisterTool(tool Tool) {
 	sm.tools.Register(tool)
 }
 
-func (sm *SubagentManager) Spawn(
-	ctx context.Context,
-	task, label, agentID, originChannel, originChatID string,
-	callback AsyncCallback,
-) (string, error) {
+// EnablePersistence stores every task as a JSON file in dir and loads the
+// tasks a previous process left there. Tasks that were still running are
+// kept for Resume.
+func (sm *SubagentManager) EnablePersistence(dir string) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("subagent: create dir: %w", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("subagent: read dir: %w", err)
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
+	sm.storeDir = dir
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("subagent: read %s: %w", entry.Name(), err)
+		}
+		var task SubagentTask
+		if err := json.Unmarshal(data, &task); err != nil || task.ID == "" {
+			logger.WarnCF("tools", "Skipping unreadable subagent task file",
+				map[string]any{"file": entry.Name()})
+			continue
+		}
+		sm.tasks[task.ID] = &task
+		if n := subagentSeq(task.ID); n >= sm.nextID {
+			sm.nextID = n + 1
+		}
+		if task.Status == "running" {
+			sm.interrupted = append(sm.interrupted, task.ID)
+		}
+	}
+	sort.Strings(sm.interrupted)
+	sm.pruneLocked()
+	return nil
+}
+
+// saveLocked writes the task to the store. The caller must hold sm.mu.
+func (sm *SubagentManager) saveLocked(task *SubagentTask) {
+	task.Updated = time.Now().UnixMilli()
+	if sm.storeDir == "" {
+		return
+	}
+	data, err := json.MarshalIndent(task, "", "  ")
+	if err == nil {
+		err = fileutil.WriteFileAtomic(filepath.Join(sm.storeDir, task.ID+".json"), data, 0o600)
+	}
+	if err != nil {
+		logger.WarnCF("tools", "Failed to persist subagent task",
+			map[string]any{"task_id": task.ID, "error": err.Error()})
+	}
+}
+
+// pruneLocked forgets the oldest finished tasks beyond maxFinishedSubagents
+// and removes their files. The caller must hold sm.mu.
+func (sm *SubagentManager) pruneLocked() {
+	var finished []*SubagentTask
+	for _, task := range sm.tasks {
+		if task.Status != "running" {
+			finished = append(finished, task)
+		}
+	}
+	if len(finished) <= maxFinishedSubagents {
+		return
+	}
+	sort.Slice(finished, func(i, j int) bool {
+		if finished[i].Updated != finished[j].Updated {
+			return finished[i].Updated < finished[j].Updated
+		}
+		return subagentSeq(finished[i].ID) < subagentSeq(finished[j].ID)
+	})
+	for _, task := range finished[:len(finished)-maxFinishedSubagents] {
+		delete(sm.tasks, task.ID)
+		if sm.storeDir != "" {
+			os.Remove(filepath.Join(sm.storeDir, task.ID+".json"))
+		}
+	}
+}
+
+// subagentSeq returns the sequence number in a task ID, or 0.
+func subagentSeq(id string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(id, "subagent-"))
+	return n
+}
 
+// newTaskLocked creates and stores a running task. The caller must hold sm.mu.
+func (sm *SubagentManager) newTaskLocked(
+	task, label, agentID, originChannel, originChatID string,
+) *SubagentTask {
 	taskID := fmt.Sprintf("subagent-%d", sm.nextID)
 	sm.nextID++
 
@@ -137,6 +245,115 @@ func (sm *SubagentManager) Spawn(
 		Created:       time.Now().UnixMilli(),
 	}
 	sm.tasks[taskID] = subagentTask
+	sm.saveLocked(subagentTask)
+	return subagentTask
+}
+
+// Track records a task that the caller runs itself, such as a spawn sub-turn,
+// and returns its ID. Report the outcome with Finish.
+func (sm *SubagentManager) Track(task, label, agentID, originChannel, originChatID string) string {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.newTaskLocked(task, label, agentID, originChannel, originChatID).ID
+}
+
+// UpdatePartial records the latest output of a running task.
+func (sm *SubagentManager) UpdatePartial(taskID, partial string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	task, ok := sm.tasks[taskID]
+	if !ok || task.Status != "running" {
+		return
+	}
+	task.Partial = utils.Truncate(partial, maxSubagentPartialLen)
+	sm.saveLocked(task)
+}
+
+// Finish records the outcome of a task. A nil err completes it with the
+// result; an error fails it, or cancels it when ctx was canceled. It returns
+// the result to report, which is an error result when err is set.
+func (sm *SubagentManager) Finish(
+	ctx context.Context,
+	taskID string,
+	result *ToolResult,
+	err error,
+) *ToolResult {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	task, ok := sm.tasks[taskID]
+	if !ok {
+		return result
+	}
+	if err != nil {
+		task.Status = "failed"
+		task.Result = fmt.Sprintf("Error: %v", err)
+		// Check if it was canceled
+		if ctx.Err() != nil {
+			task.Status = "canceled"
+			task.Result = "Task canceled during execution"
+		}
+		result = &ToolResult{
+			ForLLM:  task.Result,
+			ForUser: "",
+			Silent:  false,
+			IsError: true,
+			Async:   false,
+			Err:     err,
+		}
+	} else {
+		task.Status = "completed"
+		if result != nil {
+			task.Result = result.ForLLM
+		}
+	}
+	task.Partial = ""
+	sm.saveLocked(task)
+	sm.pruneLocked()
+	return result
+}
+
+// Resume re-runs the tasks a previous process left unfinished. Each result
+// goes to deliver together with the task, so it can be sent to the task's
+// origin chat. It returns the number of tasks resumed.
+func (sm *SubagentManager) Resume(
+	ctx context.Context,
+	deliver func(task SubagentTask, result *ToolResult),
+) int {
+	sm.mu.Lock()
+	var resumed []*SubagentTask
+	for _, id := range sm.interrupted {
+		if task, ok := sm.tasks[id]; ok && task.Status == "running" {
+			task.Partial = ""
+			sm.saveLocked(task)
+			resumed = append(resumed, task)
+		}
+	}
+	sm.interrupted = nil
+	sm.mu.Unlock()
+
+	for _, task := range resumed {
+		taskCtx := WithToolContext(ctx, task.OriginChannel, task.OriginChatID)
+		go sm.runTask(taskCtx, task, func(_ context.Context, result *ToolResult) {
+			if deliver == nil {
+				return
+			}
+			if snapshot, ok := sm.GetTaskCopy(task.ID); ok {
+				deliver(snapshot, result)
+			}
+		})
+	}
+	return len(resumed)
+}
+
+func (sm *SubagentManager) Spawn(
+	ctx context.Context,
+	task, label, agentID, originChannel, originChatID string,
+	callback AsyncCallback,
+) (string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	subagentTask := sm.newTaskLocked(task, label, agentID, originChannel, originChatID)
 
 	// Start task in background with context cancellation support
 	go sm.runTask(ctx, subagentTask, callback)
@@ -152,8 +369,6 @@ func (sm *SubagentManager) runTask(
 	task *SubagentTask,
 	callback AsyncCallback,
 ) {
-	task.Status = "running"
-	task.Created = time.Now().UnixMilli()
 	// TODO(eventbus): once subagents are modeled as child turns inside
 	// pkg/agent, emit SubTurnEnd and SubTurnResultDelivered from the parent
 	// AgentLoop instead of this legacy manager.
@@ -164,6 +379,8 @@ func (sm *SubagentManager) runTask(
 		sm.mu.Lock()
 		task.Status = "canceled"
 		task.Result = "Task canceled before execution"
+		sm.saveLocked(task)
+		sm.pruneLocked()
 		sm.mu.Unlock()
 		return
 	default:
@@ -241,34 +458,10 @@ After completing the task, provide a clear summary of what was done.`
 		}
 	}
 
-	sm.mu.Lock()
-	defer func() {
-		sm.mu.Unlock()
-		// Call callback if provided and result is set
-		if callback != nil && result != nil {
-			callback(ctx, result)
-		}
-	}()
-
-	if err != nil {
-		task.Status = "failed"
-		task.Result = fmt.Sprintf("Error: %v", err)
-		// Check if it was canceled
-		if ctx.Err() != nil {
-			task.Status = "canceled"
-			task.Result = "Task canceled during execution"
-		}
-		result = &ToolResult{
-			ForLLM:  task.Result,
-			ForUser: "",
-			Silent:  false,
-			IsError: true,
-			Async:   false,
-			Err:     err,
-		}
-	} else {
-		task.Status = "completed"
-		task.Result = result.ForLLM
+	result = sm.Finish(ctx, task.ID, result, err)
+	// Call callback if provided and result is set
+	if callback != nil && result != nil {
+		callback(ctx, result)
 	}
 }
 
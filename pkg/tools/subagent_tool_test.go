@@ -2,8 +2,12 @@ package tools
 
 import (
 	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/sipeed/picoclaw/pkg/providers"
 )
@@ -64,6 +68,155 @@ func TestSubagentManager_SetLLMOptions_AppliesToRunToolLoop(t *testing.T) {
 	}
 }
 
+// blockingSpawner reports progress, then holds the sub-turn until released.
+type blockingSpawner struct {
+	release chan struct{}
+}
+
+func (s *blockingSpawner) SpawnSubTurn(ctx context.Context, cfg SubTurnConfig) (*ToolResult, error) {
+	if cfg.OnProgress != nil {
+		cfg.OnProgress("half done")
+	}
+	<-s.release
+	return &ToolResult{ForLLM: "all done", ForUser: "all done"}, nil
+}
+
+func waitForTask(t *testing.T, sm *SubagentManager, id string, done func(SubagentTask) bool) SubagentTask {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		task, ok := sm.GetTaskCopy(id)
+		if ok && done(task) {
+			return task
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("task %s = %+v (found %v), condition not met", id, task, ok)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubagentManager_PersistsSpawnedTasks(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir())
+	if err := manager.EnablePersistence(dir); err != nil {
+		t.Fatal(err)
+	}
+	spawner := &blockingSpawner{release: make(chan struct{})}
+	tool := NewSpawnTool(manager)
+	tool.SetSpawner(spawner)
+
+	ctx := WithToolContext(context.Background(), "telegram", "chat-1")
+	res := tool.Execute(ctx, map[string]any{"task": "Summarize the logs", "label": "logs"})
+	if !strings.Contains(res.ForLLM, "subagent-1") {
+		t.Fatalf("ForLLM = %q, want the task ID", res.ForLLM)
+	}
+	waitForTask(t, manager, "subagent-1", func(task SubagentTask) bool { return task.Partial == "half done" })
+
+	// A restart while the task runs finds it running, with its origin and
+	// partial output.
+	restarted := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir())
+	if err := restarted.EnablePersistence(dir); err != nil {
+		t.Fatal(err)
+	}
+	task, ok := restarted.GetTaskCopy("subagent-1")
+	if !ok || task.Status != "running" || task.OriginChannel != "telegram" || task.OriginChatID != "chat-1" ||
+		task.Label != "logs" || task.Partial != "half done" {
+		t.Fatalf("reloaded task = %+v", task)
+	}
+
+	close(spawner.release)
+	waitForTask(t, manager, "subagent-1", func(task SubagentTask) bool { return task.Status == "completed" })
+
+	restarted = NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir())
+	if err := restarted.EnablePersistence(dir); err != nil {
+		t.Fatal(err)
+	}
+	task, _ = restarted.GetTaskCopy("subagent-1")
+	if task.Status != "completed" || task.Result != "all done" || task.Partial != "" {
+		t.Fatalf("reloaded task = %+v, want the completed result", task)
+	}
+	if id := restarted.Track("next", "", "", "", ""); id != "subagent-2" {
+		t.Fatalf("next task ID = %s, want subagent-2", id)
+	}
+}
+
+func TestSubagentManager_ResumeRerunsInterruptedTasks(t *testing.T) {
+	dir := t.TempDir()
+	crashed := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir())
+	if err := crashed.EnablePersistence(dir); err != nil {
+		t.Fatal(err)
+	}
+	crashed.Track("Check the build", "build", "", "slack", "C1")
+	finished := crashed.Track("Old task", "", "", "slack", "C1")
+	crashed.Finish(context.Background(), finished, &ToolResult{ForLLM: "old"}, nil)
+
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir())
+	if err := manager.EnablePersistence(dir); err != nil {
+		t.Fatal(err)
+	}
+	manager.SetSpawner(func(
+		ctx context.Context,
+		task, label, agentID string,
+		tools *ToolRegistry,
+		maxTokens int,
+		temperature float64,
+		hasMaxTokens, hasTemperature bool,
+	) (*ToolResult, error) {
+		return &ToolResult{ForLLM: "rerun " + task + " for " + ToolChannel(ctx) + "/" + ToolChatID(ctx)}, nil
+	})
+
+	delivered := make(chan SubagentTask, 2)
+	if n := manager.Resume(context.Background(), func(task SubagentTask, result *ToolResult) {
+		delivered <- task
+	}); n != 1 {
+		t.Fatalf("Resume() = %d, want only the unfinished task", n)
+	}
+	select {
+	case task := <-delivered:
+		if task.ID != "subagent-1" || task.Status != "completed" || task.Result != "rerun Check the build for slack/C1" {
+			t.Fatalf("delivered task = %+v", task)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("resumed task was not delivered")
+	}
+	if n := manager.Resume(context.Background(), nil); n != 0 {
+		t.Fatalf("second Resume() = %d, want 0", n)
+	}
+}
+
+func TestSubagentManager_PrunesFinishedTasks(t *testing.T) {
+	dir := t.TempDir()
+	manager := NewSubagentManager(&MockLLMProvider{}, "test-model", t.TempDir())
+	if err := manager.EnablePersistence(dir); err != nil {
+		t.Fatal(err)
+	}
+	running := manager.Track("Still running", "", "", "", "")
+	for i := 0; i < maxFinishedSubagents+2; i++ {
+		id := manager.Track(fmt.Sprintf("task %d", i), "", "", "", "")
+		manager.Finish(context.Background(), id, &ToolResult{ForLLM: "done"}, nil)
+	}
+
+	if _, ok := manager.GetTaskCopy(running); !ok {
+		t.Fatal("running task was pruned")
+	}
+	for _, id := range []string{"subagent-2", "subagent-3"} {
+		if _, ok := manager.GetTaskCopy(id); ok {
+			t.Errorf("oldest finished task %s was kept", id)
+		}
+		if _, err := os.Stat(filepath.Join(dir, id+".json")); !os.IsNotExist(err) {
+			t.Errorf("file of %s was kept: %v", id, err)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != maxFinishedSubagents+1 {
+		t.Fatalf("task files = %d, want %d", len(entries), maxFinishedSubagents+1)
+	}
+}
+
 // TestSubagentTool_Name verifies tool name
 func TestSubagentTool_Name(t *testing.T) {
 	provider := &MockLLMProvider{}
@@ -828,6 +828,11 @@ func (t *WebSearchTool) Name() string {
 	return "web_search"
 }
 
+// ConcurrencySafe reports true: web_search only reads.
+func (t *WebSearchTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *WebSearchTool) Description() string {
 	return "Search the web for current information. Returns titles, URLs, and snippets from search results."
 }
@@ -959,6 +964,11 @@ func (t *WebFetchTool) Name() string {
 	return "web_fetch"
 }
 
+// ConcurrencySafe reports true: web_fetch only reads.
+func (t *WebFetchTool) ConcurrencySafe() bool {
+	return true
+}
+
 func (t *WebFetchTool) Description() string {
 	return "Fetch a URL and extract readable content (HTML to text). Use this to get weather info, news, articles, or any web content."
 }
@@ -0,0 +1,324 @@
+// Package usage accounts for the tokens and cost of LLM calls. Totals are
+// kept per day and, within a day, per session, agent, model and channel, and
+// persisted as one JSON file in the workspace state directory.
+package usage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/fileutil"
+	"github.com/sipeed/picoclaw/pkg/logger"
+)
+
+const (
+	// DateLayout is the format of the day keys.
+	DateLayout = "2006-01-02"
+
+	// RetentionDays is how many days of usage are kept.
+	RetentionDays = 90
+
+	// SaveDelay is how long new records are held in memory before the
+	// ledger is written, so a busy agent does not rewrite the file on flash
+	// storage after every call.
+	SaveDelay = 30 * time.Second
+)
+
+// Path returns the usage file of a workspace.
+func Path(workspace string) string {
+	return filepath.Join(workspace, "state", "usage.json")
+}
+
+// Totals are accumulated token counts and cost. CachedTokens is the part of
+// PromptTokens read from a prompt cache, CacheWriteTokens the part written
+// to it.
+type Totals struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	CachedTokens     int     `json:"cached_tokens"`
+	CacheWriteTokens int     `json:"cache_write_tokens,omitempty"`
+	Cost             float64 `json:"cost"`
+}
+
+func (t *Totals) add(o Totals) {
+	t.Requests += o.Requests
+	t.PromptTokens += o.PromptTokens
+	t.CompletionTokens += o.CompletionTokens
+	t.CachedTokens += o.CachedTokens
+	t.CacheWriteTokens += o.CacheWriteTokens
+	t.Cost += o.Cost
+}
+
+// Day is the usage of one day, in total and broken down by dimension.
+type Day struct {
+	Total    Totals             `json:"total"`
+	Sessions map[string]*Totals `json:"sessions,omitempty"`
+	Agents   map[string]*Totals `json:"agents,omitempty"`
+	Models   map[string]*Totals `json:"models,omitempty"`
+	Channels map[string]*Totals `json:"channels,omitempty"`
+}
+
+func (d *Day) add(r Record) {
+	t := r.totals()
+	d.Total.add(t)
+	d.Sessions = addTo(d.Sessions, r.SessionKey, t)
+	d.Agents = addTo(d.Agents, r.AgentID, t)
+	d.Models = addTo(d.Models, r.Model, t)
+	d.Channels = addTo(d.Channels, r.Channel, t)
+}
+
+func addTo(m map[string]*Totals, key string, t Totals) map[string]*Totals {
+	if key == "" {
+		return m
+	}
+	if m == nil {
+		m = make(map[string]*Totals)
+	}
+	if m[key] == nil {
+		m[key] = &Totals{}
+	}
+	m[key].add(t)
+	return m
+}
+
+// Record is the usage of one LLM call.
+type Record struct {
+	SessionKey       string
+	AgentID          string
+	Channel          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int
+	CacheWriteTokens int
+	Cost             float64
+}
+
+func (r Record) totals() Totals {
+	return Totals{
+		Requests:         1,
+		PromptTokens:     r.PromptTokens,
+		CompletionTokens: r.CompletionTokens,
+		CachedTokens:     r.CachedTokens,
+		CacheWriteTokens: r.CacheWriteTokens,
+		Cost:             r.Cost,
+	}
+}
+
+type ledgerFile struct {
+	Days map[string]*Day `json:"days"`
+}
+
+// Ledger accumulates usage records in memory and saves them SaveDelay after
+// the first unsaved record, and on Flush or Close.
+type Ledger struct {
+	mu    sync.Mutex
+	path  string
+	days  map[string]*Day
+	now   func() time.Time
+	delay time.Duration
+	dirty bool
+	timer *time.Timer
+}
+
+// NewLedger opens the ledger stored at path. A missing or unreadable file
+// starts an empty ledger.
+func NewLedger(path string) *Ledger {
+	days, err := Load(path)
+	if err != nil {
+		logger.WarnCF("usage", "Failed to load usage, starting empty",
+			map[string]any{"path": path, "error": err.Error()})
+	}
+	if days == nil {
+		days = make(map[string]*Day)
+	}
+	return &Ledger{path: path, days: days, now: time.Now, delay: SaveDelay}
+}
+
+// Load reads the days stored at path. A missing file yields no days.
+func Load(path string) (map[string]*Day, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("usage: read: %w", err)
+	}
+	var file ledgerFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("usage: decode: %w", err)
+	}
+	return file.Days, nil
+}
+
+// Add books one call on today and schedules a save. Days older than
+// RetentionDays are dropped.
+func (l *Ledger) Add(r Record) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	today := now.Format(DateLayout)
+	if l.days[today] == nil {
+		l.days[today] = &Day{}
+	}
+	l.days[today].add(r)
+
+	oldest := now.AddDate(0, 0, -(RetentionDays - 1)).Format(DateLayout)
+	for date := range l.days {
+		if date < oldest {
+			delete(l.days, date)
+		}
+	}
+
+	l.dirty = true
+	if l.timer == nil {
+		l.timer = time.AfterFunc(l.delay, func() {
+			if err := l.Flush(); err != nil {
+				logger.WarnCF("usage", "Failed to save usage",
+					map[string]any{"path": l.path, "error": err.Error()})
+			}
+		})
+	}
+}
+
+// Flush saves records that are not on disk yet. Call it on shutdown.
+func (l *Ledger) Flush() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	if !l.dirty {
+		return nil
+	}
+	if err := l.save(); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+// save must be called with the lock held.
+func (l *Ledger) save() error {
+	data, err := json.MarshalIndent(ledgerFile{Days: l.days}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("usage: encode: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(l.path), 0o700); err != nil {
+		return fmt.Errorf("usage: create dir: %w", err)
+	}
+	return fileutil.WriteFileAtomic(l.path, data, 0o600)
+}
+
+// TodayCost returns today's total cost and the part of it spent by the
+// given session.
+func (l *Ledger) TodayCost(sessionKey string) (total, session float64) {
+	if l == nil {
+		return 0, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	day := l.days[l.now().Format(DateLayout)]
+	if day == nil {
+		return 0, 0
+	}
+	if t := day.Sessions[sessionKey]; t != nil {
+		session = t.Cost
+	}
+	return day.Total.Cost, session
+}
+
+// Report summarizes the last days days, today included.
+func (l *Ledger) Report(days int) Report {
+	if l == nil {
+		return Summarize(nil, days, time.Now())
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Summarize(l.days, days, l.now())
+}
+
+// Report is the usage over a range of days.
+type Report struct {
+	Since    string            `json:"since"`
+	Until    string            `json:"until"`
+	Total    Totals            `json:"total"`
+	Days     map[string]Totals `json:"days"`
+	Sessions map[string]Totals `json:"sessions"`
+	Agents   map[string]Totals `json:"agents"`
+	Models   map[string]Totals `json:"models"`
+	Channels map[string]Totals `json:"channels"`
+}
+
+// Summarize adds up the given days over the last n days up to now.
+func Summarize(days map[string]*Day, n int, now time.Time) Report {
+	n = max(n, 1)
+	report := Report{
+		Since:    now.AddDate(0, 0, -(n - 1)).Format(DateLayout),
+		Until:    now.Format(DateLayout),
+		Days:     make(map[string]Totals),
+		Sessions: make(map[string]Totals),
+		Agents:   make(map[string]Totals),
+		Models:   make(map[string]Totals),
+		Channels: make(map[string]Totals),
+	}
+	for date, day := range days {
+		if day == nil || date < report.Since || date > report.Until {
+			continue
+		}
+		report.Total.add(day.Total)
+		report.Days[date] = day.Total
+		mergeInto(report.Sessions, day.Sessions)
+		mergeInto(report.Agents, day.Agents)
+		mergeInto(report.Models, day.Models)
+		mergeInto(report.Channels, day.Channels)
+	}
+	return report
+}
+
+func mergeInto(dst map[string]Totals, src map[string]*Totals) {
+	for key, t := range src {
+		if t == nil {
+			continue
+		}
+		sum := dst[key]
+		sum.add(*t)
+		dst[key] = sum
+	}
+}
+
+// SortedKeys returns the keys of a breakdown ordered by cost, then tokens,
+// highest first.
+func SortedKeys(m map[string]Totals) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := m[keys[i]], m[keys[j]]
+		if a.Cost != b.Cost {
+			return a.Cost > b.Cost
+		}
+		if ta, tb := a.PromptTokens+a.CompletionTokens, b.PromptTokens+b.CompletionTokens; ta != tb {
+			return ta > tb
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,111 @@
+package usage
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLedger_AddPersistsAndBreaksDown(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "usage.json")
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+
+	ledger := NewLedger(path)
+	ledger.now = func() time.Time { return now }
+	records := []Record{
+		{SessionKey: "s1", AgentID: "main", Channel: "cli", Model: "gpt", PromptTokens: 100, CompletionTokens: 10, Cost: 0.25},
+		{SessionKey: "s2", AgentID: "main", Channel: "telegram", Model: "gpt", PromptTokens: 50, CachedTokens: 40, Cost: 0.5},
+		{AgentID: "main", Model: "mini", PromptTokens: 5, CompletionTokens: 1},
+	}
+	for _, r := range records {
+		ledger.Add(r)
+	}
+
+	total, session := ledger.TodayCost("s2")
+	if total != 0.75 || session != 0.5 {
+		t.Fatalf("TodayCost(s2) = %v, %v, want 0.75, 0.5", total, session)
+	}
+
+	// A fresh ledger reads the totals back from disk once they are flushed.
+	if err := ledger.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	reloaded := NewLedger(path)
+	reloaded.now = ledger.now
+	report := reloaded.Report(1)
+	if report.Total.Requests != 3 || report.Total.PromptTokens != 155 || report.Total.CachedTokens != 40 {
+		t.Fatalf("total = %+v", report.Total)
+	}
+	if got := report.Models["gpt"]; got.Requests != 2 || got.Cost != 0.75 {
+		t.Fatalf("models[gpt] = %+v", got)
+	}
+	if _, ok := report.Sessions[""]; ok {
+		t.Fatal("calls without a session should not appear in the session breakdown")
+	}
+	if keys := SortedKeys(report.Models); len(keys) != 2 || keys[0] != "gpt" {
+		t.Fatalf("SortedKeys() = %v", keys)
+	}
+}
+
+func TestLedger_DropsDaysPastRetention(t *testing.T) {
+	ledger := NewLedger(filepath.Join(t.TempDir(), "usage.json"))
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+
+	ledger.now = func() time.Time { return now.AddDate(0, 0, -RetentionDays) }
+	ledger.Add(Record{Model: "old", Cost: 1})
+	ledger.now = func() time.Time { return now }
+	ledger.Add(Record{Model: "new", Cost: 2})
+
+	if len(ledger.days) != 1 {
+		t.Fatalf("days = %v, want only today", ledger.days)
+	}
+	if report := ledger.Report(RetentionDays); report.Total.Cost != 2 {
+		t.Fatalf("report total = %+v", report.Total)
+	}
+}
+
+func TestLedger_SavesAfterDelay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	ledger := NewLedger(path)
+	ledger.delay = 20 * time.Millisecond
+
+	ledger.Add(Record{Model: "gpt", Cost: 1})
+	ledger.Add(Record{Model: "gpt", Cost: 2})
+	if days, _ := Load(path); days != nil {
+		t.Fatal("ledger was written before the save delay")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		days, err := Load(path)
+		if err != nil {
+			t.Fatalf("Load() error = %v", err)
+		}
+		if days != nil {
+			if report := Summarize(days, 1, time.Now()); report.Total.Requests != 2 {
+				t.Fatalf("saved total = %+v, want both records in one write", report.Total)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("ledger was not saved after the delay")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSummarize_LimitsRange(t *testing.T) {
+	now := time.Date(2026, 3, 10, 12, 0, 0, 0, time.Local)
+	days := map[string]*Day{
+		"2026-03-10": {Total: Totals{Requests: 1, Cost: 1}},
+		"2026-03-04": {Total: Totals{Requests: 2, Cost: 2}},
+		"2026-03-03": {Total: Totals{Requests: 4, Cost: 4}},
+	}
+	report := Summarize(days, 7, now)
+	if report.Since != "2026-03-04" || report.Until != "2026-03-10" {
+		t.Fatalf("range = %s..%s", report.Since, report.Until)
+	}
+	if report.Total.Requests != 3 || len(report.Days) != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+}
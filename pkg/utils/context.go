@@ -89,6 +89,17 @@ func MeasureContextRunes(messages []providers.Message) int {
 //
 // Returns the truncated message list.
 func TruncateContextSmart(messages []providers.Message, maxRunes int) []providers.Message {
+	return TruncateContext(messages, maxRunes, measureMessageRunes)
+}
+
+// TruncateContext truncates message history like TruncateContextSmart, with
+// limit expressed in whatever unit measure returns, e.g. a model's tokens.
+// Tool results whose tool call was dropped are dropped as well.
+func TruncateContext(
+	messages []providers.Message,
+	limit int,
+	measure func(providers.Message) int,
+) []providers.Message {
 	if len(messages) == 0 {
 		return messages
 	}
@@ -106,63 +117,47 @@ func TruncateContextSmart(messages []providers.Message, maxRunes int) []provider
 	}
 
 	// Calculate system message size
-	systemRunes := 0
+	systemSize := 0
 	for _, msg := range systemMsgs {
-		systemRunes += utf8.RuneCountInString(msg.Content)
-		systemRunes += utf8.RuneCountInString(msg.ReasoningContent)
+		systemSize += measure(msg)
 	}
 
 	// Reserve space for truncation notice (estimate ~80 runes)
 	const truncationNoticeEstimate = 80
 
 	// Allocate remaining space for other messages
-	remainingRunes := maxRunes - systemRunes - truncationNoticeEstimate
-	if remainingRunes <= 0 {
+	remaining := limit - systemSize - truncationNoticeEstimate
+	if remaining <= 0 {
 		// System messages already exceed limit - return only system messages
 		return systemMsgs
 	}
 
 	// Collect recent messages in reverse order until we hit the limit
-	var keptMsgs []providers.Message
-	currentRunes := 0
-
+	kept := len(otherMsgs)
+	current := 0
 	for i := len(otherMsgs) - 1; i >= 0; i-- {
-		msg := otherMsgs[i]
-		msgRunes := utf8.RuneCountInString(msg.Content) +
-			utf8.RuneCountInString(msg.ReasoningContent)
-
-		// Estimate tool call size
-		if len(msg.ToolCalls) > 0 {
-			for _, tc := range msg.ToolCalls {
-				msgRunes += utf8.RuneCountInString(tc.Name)
-				if argsJSON, err := json.Marshal(tc.Arguments); err == nil {
-					msgRunes += utf8.RuneCount(argsJSON)
-				} else {
-					msgRunes += 100
-				}
-			}
-		}
-		msgRunes += utf8.RuneCountInString(msg.ToolCallID)
-
-		if currentRunes+msgRunes > remainingRunes {
+		size := measure(otherMsgs[i])
+		if current+size > remaining {
 			// Would exceed limit, stop collecting
 			break
 		}
-
-		// Prepend to maintain chronological order
-		keptMsgs = append([]providers.Message{msg}, keptMsgs...)
-		currentRunes += msgRunes
+		kept = i
+		current += size
+	}
+	// A tool result cannot open the history: its tool call is gone.
+	for kept < len(otherMsgs) && otherMsgs[kept].Role == "tool" {
+		kept++
 	}
+	keptMsgs := otherMsgs[kept:]
 
 	// If we dropped messages, add a truncation notice
 	result := systemMsgs
-	if len(keptMsgs) < len(otherMsgs) {
-		droppedCount := len(otherMsgs) - len(keptMsgs)
+	if kept > 0 {
 		truncationNotice := providers.Message{
 			Role: "system",
 			Content: fmt.Sprintf(
 				"[Context truncated: %d earlier messages omitted to stay within context limits]",
-				droppedCount,
+				kept,
 			),
 		}
 		result = append(result, truncationNotice)
@@ -171,3 +166,9 @@ func TruncateContextSmart(messages []providers.Message, maxRunes int) []provider
 	result = append(result, keptMsgs...)
 	return result
 }
+
+// measureMessageRunes is the rune count TruncateContextSmart measures a
+// message by, see MeasureContextRunes.
+func measureMessageRunes(msg providers.Message) int {
+	return MeasureContextRunes([]providers.Message{msg})
+}
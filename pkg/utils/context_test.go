@@ -6,6 +6,7 @@
 package utils
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/sipeed/picoclaw/pkg/providers"
@@ -448,3 +449,22 @@ func TestContextTruncationPreservesToolCalls(t *testing.T) {
 		t.Error("Tool call message was not preserved during truncation")
 	}
 }
+
+func TestTruncateContext_DropsOrphanedToolResults(t *testing.T) {
+	messages := []providers.Message{
+		{Role: "system", Content: "System"},
+		{Role: "user", Content: "Look it up"},
+		{Role: "assistant", ToolCalls: []providers.ToolCall{{ID: "call_1", Name: "search"}}},
+		{Role: "tool", ToolCallID: "call_1", Content: "result"},
+		{Role: "assistant", Content: "Found it"},
+	}
+	// Each message counts 1: room for the last two only.
+	got := TruncateContext(messages, 83, func(providers.Message) int { return 1 })
+
+	if len(got) != 3 || got[1].Role != "system" || got[2].Content != "Found it" {
+		t.Fatalf("TruncateContext() = %+v, want system, notice and the final answer", got)
+	}
+	if !strings.Contains(got[1].Content, "3 earlier messages") {
+		t.Fatalf("notice = %q", got[1].Content)
+	}
+}
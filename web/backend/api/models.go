@@ -37,6 +37,8 @@ type modelResponse struct {
 	MaxTokensField string `json:"max_tokens_field,omitempty"`
 	RequestTimeout int    `json:"request_timeout,omitempty"`
 	ThinkingLevel  string `json:"thinking_level,omitempty"`
+	// Accounting
+	Pricing *config.ModelPricing `json:"pricing,omitempty"`
 	// Meta
 	Configured bool `json:"configured"`
 	IsDefault  bool `json:"is_default"`
@@ -81,6 +83,7 @@ func (h *Handler) handleListModels(w http.ResponseWriter, r *http.Request) {
 			MaxTokensField: m.MaxTokensField,
 			RequestTimeout: m.RequestTimeout,
 			ThinkingLevel:  m.ThinkingLevel,
+			Pricing:        m.Pricing,
 			Configured:     configured[i],
 			IsDefault:      m.ModelName == defaultModel,
 		})
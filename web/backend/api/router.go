@@ -51,6 +51,9 @@ func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// Session history
 	h.registerSessionRoutes(mux)
 
+	// Token and cost accounting
+	h.registerUsageRoutes(mux)
+
 	// OAuth login and credential management
 	h.registerOAuthRoutes(mux)
 
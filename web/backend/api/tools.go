@@ -52,12 +52,30 @@ var toolCatalog = []toolCatalogEntry{
 		Category:    "filesystem",
 		ConfigKey:   "list_dir",
 	},
+	{
+		Name:        "grep",
+		Description: "Search file contents with a regular expression, with context lines and paging.",
+		Category:    "filesystem",
+		ConfigKey:   "grep",
+	},
+	{
+		Name:        "glob",
+		Description: "Find files by name pattern, honoring .gitignore.",
+		Category:    "filesystem",
+		ConfigKey:   "glob",
+	},
 	{
 		Name:        "edit_file",
 		Description: "Apply targeted edits to existing files without rewriting everything.",
 		Category:    "filesystem",
 		ConfigKey:   "edit_file",
 	},
+	{
+		Name:        "apply_patch",
+		Description: "Change several files at once from a unified diff or a list of edits, all or nothing.",
+		Category:    "filesystem",
+		ConfigKey:   "apply_patch",
+	},
 	{
 		Name:        "append_file",
 		Description: "Append content to the end of an existing file.",
@@ -70,6 +88,12 @@ var toolCatalog = []toolCatalogEntry{
 		Category:    "filesystem",
 		ConfigKey:   "exec",
 	},
+	{
+		Name:        "shell_session",
+		Description: "Keep interactive shells and REPLs running on a terminal between calls.",
+		Category:    "filesystem",
+		ConfigKey:   "shell_session",
+	},
 	{
 		Name:        "cron",
 		Description: "Schedule one-time or recurring reminders, jobs, and shell commands.",
@@ -100,6 +124,18 @@ var toolCatalog = []toolCatalogEntry{
 		Category:    "communication",
 		ConfigKey:   "send_file",
 	},
+	{
+		Name:        "memory_search",
+		Description: "Search long-term memory and daily notes for relevant excerpts.",
+		Category:    "memory",
+		ConfigKey:   "memory",
+	},
+	{
+		Name:        "memory_write",
+		Description: "Save, correct or forget facts in long-term memory and daily notes.",
+		Category:    "memory",
+		ConfigKey:   "memory",
+	},
 	{
 		Name:        "find_skills",
 		Description: "Search external skill registries for installable skills.",
@@ -124,6 +160,24 @@ var toolCatalog = []toolCatalogEntry{
 		Category:    "agents",
 		ConfigKey:   "spawn_status",
 	},
+	{
+		Name:        "team",
+		Description: "Coordinate several named subagents under one shared token budget.",
+		Category:    "agents",
+		ConfigKey:   "team",
+	},
+	{
+		Name:        "evaluate_and_refine",
+		Description: "Draft with a worker subagent and revise until an evaluator subagent passes it.",
+		Category:    "agents",
+		ConfigKey:   "evaluate_and_refine",
+	},
+	{
+		Name:        "handoff",
+		Description: "Hand the conversation over to another agent until it hands it back.",
+		Category:    "agents",
+		ConfigKey:   "handoff",
+	},
 	{
 		Name:        "i2c",
 		Description: "Interact with I2C hardware devices exposed on the host.",
@@ -220,6 +274,29 @@ func buildToolSupport(cfg *config.Config) []toolSupportItem {
 					reasonCode = "requires_subagent"
 				}
 			}
+		case "apply_patch":
+			if cfg.Tools.IsToolEnabled(entry.ConfigKey) {
+				if cfg.Tools.IsToolEnabled("edit_file") && cfg.Tools.IsToolEnabled("write_file") {
+					status = "enabled"
+				} else {
+					status = "blocked"
+					reasonCode = "requires_edit_and_write_file"
+				}
+			}
+		case "shell_session":
+			if cfg.Tools.IsToolEnabled(entry.ConfigKey) {
+				switch {
+				case !cfg.Tools.IsToolEnabled("exec"):
+					status = "blocked"
+					reasonCode = "requires_exec"
+				case cfg.Agents.Defaults.RestrictToWorkspace &&
+					cfg.Tools.Exec.Sandbox != "namespaces":
+					status = "blocked"
+					reasonCode = "requires_exec_sandbox"
+				default:
+					status = "enabled"
+				}
+			}
 		case "tool_search_tool_regex":
 			status, reasonCode = resolveDiscoveryToolSupport(cfg, cfg.Tools.MCP.Discovery.UseRegex)
 		case "tool_search_tool_bm25":
@@ -275,12 +352,23 @@ func applyToolState(cfg *config.Config, toolName string, enabled bool) error {
 		cfg.Tools.WriteFile.Enabled = enabled
 	case "list_dir":
 		cfg.Tools.ListDir.Enabled = enabled
+	case "grep":
+		cfg.Tools.Grep.Enabled = enabled
+	case "glob":
+		cfg.Tools.Glob.Enabled = enabled
 	case "edit_file":
 		cfg.Tools.EditFile.Enabled = enabled
 	case "append_file":
 		cfg.Tools.AppendFile.Enabled = enabled
+	case "apply_patch":
+		cfg.Tools.ApplyPatch.Enabled = enabled
 	case "exec":
 		cfg.Tools.Exec.Enabled = enabled
+	case "shell_session":
+		cfg.Tools.ShellSession.Enabled = enabled
+		if enabled {
+			cfg.Tools.Exec.Enabled = true
+		}
 	case "cron":
 		cfg.Tools.Cron.Enabled = enabled
 	case "web_search":
@@ -291,6 +379,8 @@ func applyToolState(cfg *config.Config, toolName string, enabled bool) error {
 		cfg.Tools.Message.Enabled = enabled
 	case "send_file":
 		cfg.Tools.SendFile.Enabled = enabled
+	case "memory_search", "memory_write":
+		cfg.Tools.Memory.Enabled = enabled
 	case "find_skills":
 		cfg.Tools.FindSkills.Enabled = enabled
 		if enabled {
@@ -312,6 +402,12 @@ func applyToolState(cfg *config.Config, toolName string, enabled bool) error {
 			cfg.Tools.Spawn.Enabled = true
 			cfg.Tools.Subagent.Enabled = true
 		}
+	case "team":
+		cfg.Tools.Team.Enabled = enabled
+	case "evaluate_and_refine":
+		cfg.Tools.Refine.Enabled = enabled
+	case "handoff":
+		cfg.Tools.Handoff.Enabled = enabled
 	case "i2c":
 		cfg.Tools.I2C.Enabled = enabled
 	case "spi":
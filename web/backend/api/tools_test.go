@@ -21,11 +21,16 @@ func TestHandleListTools(t *testing.T) {
 	}
 	cfg.Tools.ReadFile.Enabled = true
 	cfg.Tools.WriteFile.Enabled = false
+	cfg.Tools.EditFile.Enabled = true
+	cfg.Tools.ApplyPatch.Enabled = true
 	cfg.Tools.Cron.Enabled = true
 	cfg.Tools.FindSkills.Enabled = true
 	cfg.Tools.Skills.Enabled = true
 	cfg.Tools.Spawn.Enabled = true
 	cfg.Tools.Subagent.Enabled = false
+	cfg.Tools.Exec.Enabled = true
+	cfg.Tools.ShellSession.Enabled = true
+	cfg.Agents.Defaults.RestrictToWorkspace = true
 	cfg.Tools.MCP.Enabled = true
 	cfg.Tools.MCP.Discovery.Enabled = true
 	cfg.Tools.MCP.Discovery.UseRegex = true
@@ -67,6 +72,14 @@ func TestHandleListTools(t *testing.T) {
 	if gotTools["spawn"].Status != "blocked" || gotTools["spawn"].ReasonCode != "requires_subagent" {
 		t.Fatalf("spawn = %#v, want blocked/requires_subagent", gotTools["spawn"])
 	}
+	if patch := gotTools["apply_patch"]; patch.Status != "blocked" ||
+		patch.ReasonCode != "requires_edit_and_write_file" {
+		t.Fatalf("apply_patch = %#v, want blocked/requires_edit_and_write_file", patch)
+	}
+	if session := gotTools["shell_session"]; session.Status != "blocked" ||
+		session.ReasonCode != "requires_exec_sandbox" {
+		t.Fatalf("shell_session = %#v, want blocked/requires_exec_sandbox", session)
+	}
 	if gotTools["find_skills"].Status != "enabled" {
 		t.Fatalf("find_skills status = %q, want enabled", gotTools["find_skills"].Status)
 	}
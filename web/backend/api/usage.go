@@ -0,0 +1,74 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+const defaultUsageDays = 30
+
+// registerUsageRoutes binds the usage accounting endpoint to the ServeMux.
+func (h *Handler) registerUsageRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/usage", h.handleGetUsage)
+}
+
+// usageResponse is the usage report together with the configured caps and
+// the time the gateway last saved the usage file.
+type usageResponse struct {
+	usage.Report
+	Limits  config.UsageConfig `json:"limits"`
+	SavedAt *time.Time         `json:"saved_at,omitempty"`
+}
+
+// handleGetUsage returns token and cost totals recorded by the gateway,
+// broken down by day, session, agent, model and channel. It reads the usage
+// file, which the running gateway writes at most every usage.SaveDelay, so
+// the report can miss the calls of that last stretch; saved_at tells how old
+// it is.
+//
+//	GET /api/usage?days=30
+func (h *Handler) handleGetUsage(w http.ResponseWriter, r *http.Request) {
+	days := defaultUsageDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > usage.RetentionDays {
+			http.Error(w, "days must be between 1 and "+strconv.Itoa(usage.RetentionDays), http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	cfg, err := config.LoadConfig(h.configPath)
+	if err != nil {
+		http.Error(w, "failed to load config", http.StatusInternalServerError)
+		return
+	}
+	workspace, err := h.workspaceDir()
+	if err != nil {
+		http.Error(w, "failed to resolve workspace directory", http.StatusInternalServerError)
+		return
+	}
+	path := usage.Path(workspace)
+	recorded, err := usage.Load(path)
+	if err != nil {
+		http.Error(w, "failed to read usage", http.StatusInternalServerError)
+		return
+	}
+	resp := usageResponse{
+		Report: usage.Summarize(recorded, days, time.Now()),
+		Limits: cfg.Usage,
+	}
+	if info, statErr := os.Stat(path); statErr == nil {
+		savedAt := info.ModTime()
+		resp.SavedAt = &savedAt
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
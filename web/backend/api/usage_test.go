@@ -0,0 +1,64 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sipeed/picoclaw/pkg/config"
+	"github.com/sipeed/picoclaw/pkg/usage"
+)
+
+func TestHandleGetUsage(t *testing.T) {
+	configPath, cleanup := setupOAuthTestEnv(t)
+	defer cleanup()
+
+	cfg, err := config.LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	ledger := usage.NewLedger(usage.Path(cfg.Agents.Defaults.Workspace))
+	ledger.Add(usage.Record{
+		SessionKey:       "agent:main:main",
+		AgentID:          "main",
+		Channel:          "telegram",
+		Model:            "gpt-4o",
+		PromptTokens:     1000,
+		CompletionTokens: 200,
+		Cost:             0.5,
+	})
+	if err := ledger.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	h := NewHandler(configPath)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/usage?days=7", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, body=%s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var resp usageResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if resp.Total.Requests != 1 || resp.Total.PromptTokens != 1000 || resp.Total.Cost != 0.5 {
+		t.Fatalf("total = %+v", resp.Total)
+	}
+	if resp.Models["gpt-4o"].CompletionTokens != 200 || resp.Channels["telegram"].Requests != 1 {
+		t.Fatalf("breakdown = models %+v, channels %+v", resp.Models, resp.Channels)
+	}
+	if resp.SavedAt == nil || resp.SavedAt.IsZero() {
+		t.Fatal("expected saved_at for a saved usage file")
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/usage?days=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d for days=0, want %d", rec.Code, http.StatusBadRequest)
+	}
+}